@@ -9,6 +9,7 @@ import (
 	"os"
 
 	"github.com/drone-runners/drone-runner-exec/command/service"
+	"github.com/drone-runners/drone-runner-exec/daemon"
 
 	"gopkg.in/alecthomas/kingpin.v2"
 )
@@ -22,10 +23,22 @@ var nocontext = context.Background()
 // Command parses the command line arguments and then executes a
 // subcommand program.
 func Command() {
+	daemon.Version = version
+
 	app := kingpin.New("drone", "drone exec runner")
 	registerCompile(app)
 	registerExec(app)
 	registerDaemon(app)
+	registerRerun(app)
+	registerWasi(app)
+	registerUlimit(app)
+	registerSeccomp(app)
+	registerCredential(app)
+	registerWait(app)
+	registerDoctor(app)
+	registerPs(app)
+	registerStats(app)
+	registerUpdate(app)
 	service.Register(app)
 
 	kingpin.Version(version)
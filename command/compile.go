@@ -7,13 +7,14 @@ package command
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"strings"
 
 	"github.com/drone-runners/drone-runner-exec/command/internal"
+	"github.com/drone-runners/drone-runner-exec/engine"
 	"github.com/drone-runners/drone-runner-exec/engine/compiler"
 	"github.com/drone-runners/drone-runner-exec/engine/resource"
+	"github.com/drone-runners/drone-runner-exec/internal/port"
 	"github.com/drone/envsubst"
 	"github.com/drone/runner-go/environ"
 	"github.com/drone/runner-go/manifest"
@@ -25,14 +26,17 @@ import (
 type compileCommand struct {
 	*internal.Flags
 
-	Root    string
-	Source  *os.File
-	Environ map[string]string
-	Secrets map[string]string
+	Root     string
+	Source   string
+	Template string
+	Values   string
+	Environ  map[string]string
+	Secrets  map[string]string
+	Script   string
 }
 
 func (c *compileCommand) run(*kingpin.ParseContext) error {
-	rawsource, err := ioutil.ReadAll(c.Source)
+	rawsource, err := readSource(c.Source, c.Template, c.Values, c.Flags)
 	if err != nil {
 		return err
 	}
@@ -78,6 +82,20 @@ func (c *compileCommand) run(*kingpin.ParseContext) error {
 		return err
 	}
 
+	// validate the build parameters and apply the defaults
+	// declared by the pipeline.
+	c.Build.Params, err = resource.ResolveParams(c.Build.Event, c.Build.Params)
+	if err != nil {
+		return err
+	}
+
+	// allocate the named ports requested by the pipeline.
+	ports, err := port.New(port.DefaultMin, port.DefaultMax).
+		Allocate(resource.Ports)
+	if err != nil {
+		return err
+	}
+
 	// compile the pipeline to an intermediate representation.
 	comp := &compiler.Compiler{
 		Pipeline: resource,
@@ -90,9 +108,16 @@ func (c *compileCommand) run(*kingpin.ParseContext) error {
 		Environ:  c.Environ,
 		Secret:   secret.StaticVars(c.Secrets),
 		Root:     c.Root,
+		Ports:    ports,
 	}
 	spec := comp.Compile(nocontext)
 
+	// print the script executed by the named step, to aid
+	// debugging quoting and exit code issues.
+	if c.Script != "" {
+		return printScript(spec, c.Script)
+	}
+
 	// encode the pipeline in json format and print to the
 	// console for inspection.
 	enc := json.NewEncoder(os.Stdout)
@@ -113,8 +138,39 @@ func registerCompile(app *kingpin.Application) {
 
 	cmd.Arg("source", "source file location").
 		Default(".drone.yml").
-		FileVar(&c.Source)
+		StringVar(&c.Source)
+
+	cmd.Flag("template", "render the template instead of the source file").
+		StringVar(&c.Template)
+
+	cmd.Flag("values", "values file provided to the template as input").
+		StringVar(&c.Values)
+
+	cmd.Flag("script", "print the script executed by the named step").
+		StringVar(&c.Script)
 
 	// shared pipeline flags
 	c.Flags = internal.ParseFlags(cmd)
 }
+
+// helper function prints the script executed by the named
+// step. The script is the file passed as the last argument
+// to the step command.
+func printScript(spec *engine.Spec, name string) error {
+	for _, step := range spec.Steps {
+		if step.Name != name {
+			continue
+		}
+		if len(step.Args) != 0 {
+			path := step.Args[len(step.Args)-1]
+			for _, file := range step.Files {
+				if file.Path == path {
+					_, err := os.Stdout.Write(file.Data)
+					return err
+				}
+			}
+		}
+		return fmt.Errorf("step %s does not execute a script", name)
+	}
+	return fmt.Errorf("step %s not found", name)
+}
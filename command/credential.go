@@ -0,0 +1,48 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/drone-runners/drone-runner-exec/engine/credential"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type credentialCommand struct {
+	Socket string
+	Action string
+}
+
+func (c *credentialCommand) run(*kingpin.ParseContext) error {
+	// the credentials are managed by the runner, and cannot
+	// be stored or erased by git.
+	if c.Action != "get" {
+		_, err := io.Copy(ioutil.Discard, os.Stdin)
+		return err
+	}
+	return credential.Get(c.Socket, os.Stdin, os.Stdout)
+}
+
+func registerCredential(app *kingpin.Application) {
+	c := new(credentialCommand)
+
+	// the command is invoked by git as a credential helper,
+	// and is therefore hidden.
+	cmd := app.Command("credential", "git credential helper").
+		Hidden().
+		Action(c.run)
+
+	cmd.Arg("socket", "credential helper socket").
+		Required().
+		StringVar(&c.Socket)
+
+	cmd.Arg("action", "credential helper action").
+		Required().
+		StringVar(&c.Action)
+}
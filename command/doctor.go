@@ -0,0 +1,110 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/daemon"
+	"github.com/drone-runners/drone-runner-exec/engine/script"
+	"github.com/drone-runners/drone-runner-exec/internal/doctor"
+	"github.com/drone-runners/drone-runner-exec/internal/oidc"
+
+	"github.com/drone/runner-go/client"
+	"github.com/joho/godotenv"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type doctorCommand struct {
+	envfile string
+	skew    time.Duration
+}
+
+func (c *doctorCommand) run(*kingpin.ParseContext) error {
+	// load environment variables from file.
+	godotenv.Load(c.envfile)
+
+	// load the configuration from the environment.
+	config, err := daemon.FromEnviron()
+	if err != nil {
+		return err
+	}
+
+	cli := client.New(
+		config.Client.Address,
+		config.Client.Secret,
+		config.Client.SkipVerify,
+	)
+
+	root := config.Runner.Root
+	if root == "" {
+		root = os.TempDir()
+	}
+
+	checks := []doctor.Check{
+		doctor.Server(config.Client.Address),
+	}
+
+	// the rpc token is obtained from the oidc provider before
+	// the token is verified by the server.
+	if config.OIDC.Endpoint != "" {
+		source := oidc.New(oidc.Config{
+			TokenFile:    config.OIDC.TokenFile,
+			TokenURL:     config.OIDC.TokenURL,
+			TokenHeaders: config.OIDC.TokenHeaders,
+			Endpoint:     config.OIDC.Endpoint,
+			Audience:     config.OIDC.Audience,
+		})
+		checks = append(checks, doctor.Check{
+			Name: "oidc token exchange",
+			Run: func(ctx context.Context) (string, error) {
+				if err := source.Refresh(ctx); err != nil {
+					return "", err
+				}
+				cli.Secret = source.Secret()
+				return config.OIDC.Endpoint, nil
+			},
+		})
+	}
+
+	checks = append(checks,
+		doctor.Secret(cli, config.Runner.Name),
+		doctor.Clock(config.Client.Address, c.skew),
+		doctor.Binary("git", "--version"),
+		doctor.Binary(script.Default.Command),
+		doctor.Workspace(root),
+		doctor.Symlink(root),
+	)
+
+	// the history database is accessed with the sqlite3
+	// command line tool.
+	if config.History.Database != "" {
+		checks = append(checks, doctor.Binary("sqlite3", "--version"))
+	}
+
+	results := doctor.Run(nocontext, checks...)
+	if failed := doctor.Report(os.Stdout, results); failed != 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
+
+func registerDoctor(app *kingpin.Application) {
+	c := new(doctorCommand)
+
+	cmd := app.Command("doctor", "diagnoses the runner configuration and host").
+		Action(c.run)
+
+	cmd.Arg("envfile", "load the environment variable file").
+		Default("").
+		StringVar(&c.envfile)
+
+	cmd.Flag("max-clock-skew", "maximum clock skew between the runner and server").
+		Default("1m").
+		DurationVar(&c.skew)
+}
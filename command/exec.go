@@ -7,7 +7,6 @@ package command
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"strings"
 	"time"
@@ -16,6 +15,9 @@ import (
 	"github.com/drone-runners/drone-runner-exec/engine"
 	"github.com/drone-runners/drone-runner-exec/engine/compiler"
 	"github.com/drone-runners/drone-runner-exec/engine/resource"
+	"github.com/drone-runners/drone-runner-exec/internal/machine"
+	"github.com/drone-runners/drone-runner-exec/internal/port"
+	"github.com/drone-runners/drone-runner-exec/internal/timestamp"
 	"github.com/drone-runners/drone-runner-exec/runtime"
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/envsubst"
@@ -33,20 +35,33 @@ import (
 type execCommand struct {
 	*internal.Flags
 
-	Root    string
-	Source  *os.File
-	Environ map[string]string
-	Secrets map[string]string
-	Pretty  bool
-	Procs   int64
+	Root       string
+	Source     string
+	Template   string
+	Values     string
+	Environ    map[string]string
+	Secrets    map[string]string
+	Pretty     bool
+	Timestamps bool
+	Summary    bool
+	Procs      int64
+	Debug      time.Duration
+	Plugins    map[string]string
 }
 
 func (c *execCommand) run(*kingpin.ParseContext) error {
-	rawsource, err := ioutil.ReadAll(c.Source)
+	rawsource, err := readSource(c.Source, c.Template, c.Values, c.Flags)
 	if err != nil {
 		return err
 	}
 
+	// host machine facts are overridden by the custom,
+	// global environment variables.
+	c.Environ = environ.Combine(
+		machine.Gather().Environ(),
+		c.Environ,
+	)
+
 	envs := environ.Combine(
 		c.Environ,
 		environ.System(c.System),
@@ -88,6 +103,20 @@ func (c *execCommand) run(*kingpin.ParseContext) error {
 		return err
 	}
 
+	// validate the build parameters and apply the defaults
+	// declared by the pipeline.
+	c.Build.Params, err = resource.ResolveParams(c.Build.Event, c.Build.Params)
+	if err != nil {
+		return err
+	}
+
+	// allocate the named ports requested by the pipeline.
+	ports, err := port.New(port.DefaultMin, port.DefaultMax).
+		Allocate(resource.Ports)
+	if err != nil {
+		return err
+	}
+
 	// compile the pipeline to an intermediate representation.
 	comp := &compiler.Compiler{
 		Pipeline: resource,
@@ -100,6 +129,10 @@ func (c *execCommand) run(*kingpin.ParseContext) error {
 		Environ:  c.Environ,
 		Secret:   secret.StaticVars(c.Secrets),
 		Root:     c.Root,
+		Ports:    ports,
+		Debug:    c.Debug,
+		Summary:  c.Summary,
+		Plugins:  c.Plugins,
 	}
 	spec := comp.Compile(nocontext)
 
@@ -117,8 +150,12 @@ func (c *execCommand) run(*kingpin.ParseContext) error {
 		})
 	}
 
-	// configures the pipeline timeout.
+	// configures the pipeline timeout, which is optionally
+	// overridden by the pipeline for the build event.
 	timeout := time.Duration(c.Repo.Timeout) * time.Minute
+	if override := resource.Override(c.Build.Event); override.Timeout > 0 {
+		timeout = time.Duration(override.Timeout)
+	}
 	ctx, cancel := context.WithTimeout(nocontext, timeout)
 	defer cancel()
 
@@ -135,10 +172,16 @@ func (c *execCommand) run(*kingpin.ParseContext) error {
 		Repo:   c.Repo,
 		System: c.System,
 	}
+	var streamer pipeline.Streamer = console.New(c.Pretty)
+	if c.Timestamps {
+		streamer = timestamp.NewStreamer(streamer)
+	}
 	err = runtime.NewExecer(
 		pipeline.NopReporter(),
-		console.New(c.Pretty),
+		streamer,
 		engine.New(),
+		nil,
+		nil,
 		c.Procs,
 	).Exec(ctx, spec, state)
 	if err != nil {
@@ -153,6 +196,7 @@ func (c *execCommand) run(*kingpin.ParseContext) error {
 
 func registerExec(app *kingpin.Application) {
 	c := new(execCommand)
+	c.Plugins = map[string]string{}
 
 	cmd := app.Command("exec", "executes a pipeline").
 		Action(c.run)
@@ -163,7 +207,13 @@ func registerExec(app *kingpin.Application) {
 
 	cmd.Arg("source", "source file location").
 		Default(".drone.yml").
-		FileVar(&c.Source)
+		StringVar(&c.Source)
+
+	cmd.Flag("template", "render the template instead of the source file").
+		StringVar(&c.Template)
+
+	cmd.Flag("values", "values file provided to the template as input").
+		StringVar(&c.Values)
 
 	cmd.Flag("pretty", "pretty print the output").
 		Default(
@@ -174,6 +224,19 @@ func registerExec(app *kingpin.Application) {
 			),
 		).BoolVar(&c.Pretty)
 
+	cmd.Flag("timestamps", "prefix each log line with the time and elapsed step time").
+		BoolVar(&c.Timestamps)
+
+	cmd.Flag("cost-summary", "add a final step that writes the cost of each step").
+		BoolVar(&c.Summary)
+
+	cmd.Flag("debug-timeout", "keep the environment of a failed step alive in a debug session").
+		Default("0").
+		DurationVar(&c.Debug)
+
+	cmd.Flag("plugin", "map a plugin image to a host binary").
+		StringMapVar(&c.Plugins)
+
 	// shared pipeline flags
 	c.Flags = internal.ParseFlags(cmd)
 }
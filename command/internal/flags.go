@@ -25,7 +25,7 @@ type Flags struct {
 // ParseFlags parses the flags from the command args.
 func ParseFlags(cmd *kingpin.CmdClause) *Flags {
 	f := &Flags{
-		Build:  &drone.Build{},
+		Build:  &drone.Build{Params: map[string]string{}},
 		Netrc:  &drone.Netrc{},
 		Repo:   &drone.Repo{},
 		Stage:  &drone.Stage{},
@@ -59,6 +59,7 @@ func ParseFlags(cmd *kingpin.CmdClause) *Flags {
 	cmd.Flag("build-action", "build action").Default("").StringVar(&f.Build.Action)
 	cmd.Flag("build-cron", "build cron trigger").Default("").StringVar(&f.Build.Cron)
 	cmd.Flag("build-target", "build deploy target").Default("").StringVar(&f.Build.Deploy)
+	cmd.Flag("build-param", "build parameter").StringMapVar(&f.Build.Params)
 	cmd.Flag("build-created", "build created").Default(now).Int64Var(&f.Build.Created)
 	cmd.Flag("build-updated", "build updated").Default(now).Int64Var(&f.Build.Updated)
 
@@ -0,0 +1,75 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type rerunCommand struct {
+	Server   string
+	Username string
+	Password string
+	Stage    int64
+	Step     string
+}
+
+func (c *rerunCommand) run(*kingpin.ParseContext) error {
+	endpoint := fmt.Sprintf("%s/api/stages/%d/steps/%s/rerun",
+		strings.TrimSuffix(c.Server, "/"),
+		c.Stage,
+		url.PathEscape(c.Step),
+	)
+	req, err := http.NewRequest("POST", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.Username, c.Password)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		return fmt.Errorf("cannot re-run step: %s", res.Status)
+	}
+	_, err = io.Copy(os.Stdout, res.Body)
+	return err
+}
+
+func registerRerun(app *kingpin.Application) {
+	c := new(rerunCommand)
+
+	cmd := app.Command("rerun", "re-runs a failed step against a preserved workspace").
+		Action(c.run)
+
+	cmd.Arg("stage", "stage id").
+		Required().
+		Int64Var(&c.Stage)
+
+	cmd.Arg("step", "step name").
+		Required().
+		StringVar(&c.Step)
+
+	cmd.Flag("server", "runner address").
+		Default("http://localhost:3000").
+		StringVar(&c.Server)
+
+	cmd.Flag("username", "dashboard username").
+		Envar("DRONE_UI_USERNAME").
+		StringVar(&c.Username)
+
+	cmd.Flag("password", "dashboard password").
+		Envar("DRONE_UI_PASSWORD").
+		StringVar(&c.Password)
+}
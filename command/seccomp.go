@@ -0,0 +1,63 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !windows
+
+package command
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/drone-runners/drone-runner-exec/internal/seccomp"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type seccompCommand struct {
+	Profile string
+	Command string
+	Args    []string
+}
+
+func (c *seccompCommand) run(*kingpin.ParseContext) error {
+	profile, err := seccomp.Load(c.Profile)
+	if err != nil {
+		return err
+	}
+	// the command is resolved before the filter is applied,
+	// since the filter may deny the system calls used to
+	// resolve the command path.
+	path, err := exec.LookPath(c.Command)
+	if err != nil {
+		return err
+	}
+	if err := profile.Apply(); err != nil {
+		return fmt.Errorf("cannot apply seccomp profile: %s", err)
+	}
+	return syscall.Exec(path, append([]string{c.Command}, c.Args...), os.Environ())
+}
+
+func registerSeccomp(app *kingpin.Application) {
+	c := new(seccompCommand)
+
+	// the command is invoked by the runner to execute steps
+	// with a seccomp profile, and is therefore hidden.
+	cmd := app.Command("seccomp", "executes a command with a seccomp profile").
+		Hidden().
+		Action(c.run)
+
+	cmd.Flag("profile", "seccomp profile").
+		Default(seccomp.Default).
+		StringVar(&c.Profile)
+
+	cmd.Arg("command", "command to execute").
+		Required().
+		StringVar(&c.Command)
+
+	cmd.Arg("args", "command arguments").
+		StringsVar(&c.Args)
+}
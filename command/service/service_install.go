@@ -8,8 +8,10 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/drone-runners/drone-runner-exec/daemon"
 	"github.com/drone-runners/drone-runner-exec/daemon/service"
 
+	"github.com/joho/godotenv"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -23,6 +25,21 @@ func (c *installCommand) run(*kingpin.ParseContext) error {
 	if _, err := os.Stat(c.config.ConfigFile); err != nil {
 		return fmt.Errorf("cannot read configuration")
 	}
+	// the configuration is validated before the service is
+	// installed, since an invalid configuration would otherwise
+	// fail when the service starts.
+	if err := godotenv.Load(c.config.ConfigFile); err != nil {
+		return fmt.Errorf("cannot parse configuration: %s", err)
+	}
+	config, err := daemon.FromEnviron()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %s", err)
+	}
+	// the runner exits to restart after an automatic update,
+	// and must be restarted by the service manager.
+	if config.Update.Auto && c.config.Restart == "no" {
+		return fmt.Errorf("automatic updates require a restart policy")
+	}
 	s, err := service.New(c.config)
 	if err != nil {
 		return err
@@ -43,7 +60,7 @@ func registerInstall(cmd *kingpin.CmdClause) {
 		Default(service.DefaultDesc).
 		StringVar(&c.config.Desc)
 
-	s.Flag("username", "windows account username").
+	s.Flag("username", "service account username").
 		Default("").
 		StringVar(&c.config.Username)
 
@@ -54,4 +71,12 @@ func registerInstall(cmd *kingpin.CmdClause) {
 	s.Flag("config", "service configuration file").
 		Default(configPath()).
 		StringVar(&c.config.ConfigFile)
+
+	s.Flag("restart", "service restart policy (always, on-failure or no)").
+		Default(service.DefaultRestart).
+		EnumVar(&c.config.Restart, "always", "on-failure", "no")
+
+	s.Flag("restart-delay", "delay before the service is restarted").
+		Default("5s").
+		DurationVar(&c.config.RestartSec)
 }
@@ -22,6 +22,9 @@ func (c *uninstallCommand) run(*kingpin.ParseContext) error {
 	if err != nil {
 		return err
 	}
+	// the service is stopped before uninstall, since systemd
+	// does not stop a service when the unit is removed.
+	s.Stop()
 	return s.Uninstall()
 }
 
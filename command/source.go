@@ -0,0 +1,39 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"io/ioutil"
+
+	"github.com/drone-runners/drone-runner-exec/command/internal"
+	"github.com/drone-runners/drone-runner-exec/internal/include"
+	"github.com/drone-runners/drone-runner-exec/internal/render"
+)
+
+// helper function reads the configuration file. If a template
+// is provided, the template is rendered with the values file
+// and replaces the configuration file. Files included by the
+// configuration are resolved relative to the configuration.
+func readSource(source, template, values string, flags *internal.Flags) ([]byte, error) {
+	path := source
+	if template != "" {
+		path = template
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if template != "" {
+		input, err := render.LoadValues(values)
+		if err != nil {
+			return nil, err
+		}
+		data, err = render.Render(path, data, input, flags.Build, flags.Repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return include.Expand(data, path)
+}
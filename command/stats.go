@@ -0,0 +1,192 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/daemon/admin"
+	"github.com/drone-runners/drone-runner-exec/internal/machine"
+
+	"github.com/docker/go-units"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// adminClient is a client for the administration api of a
+// running daemon.
+type adminClient struct {
+	Server   string
+	Username string
+	Password string
+}
+
+// helper function requests the resource and decodes the json
+// response.
+func (c *adminClient) get(path string, out interface{}) error {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(c.Server, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.Username, c.Password)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		return fmt.Errorf("cannot get %s: %s", path, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (c *adminClient) register(cmd *kingpin.CmdClause) {
+	cmd.Flag("server", "runner address").
+		Default("http://localhost:3000").
+		StringVar(&c.Server)
+
+	cmd.Flag("username", "dashboard username").
+		Envar("DRONE_UI_USERNAME").
+		StringVar(&c.Username)
+
+	cmd.Flag("password", "dashboard password").
+		Envar("DRONE_UI_PASSWORD").
+		StringVar(&c.Password)
+}
+
+type psCommand struct {
+	adminClient
+}
+
+func (c *psCommand) run(*kingpin.ParseContext) error {
+	stats := new(admin.Stats)
+	if err := c.get("/api/stats", stats); err != nil {
+		return err
+	}
+	writeStages(os.Stdout, stats.Stages, time.Now())
+	return nil
+}
+
+type statsCommand struct {
+	adminClient
+}
+
+func (c *statsCommand) run(*kingpin.ParseContext) error {
+	stats := new(admin.Stats)
+	if err := c.get("/api/stats", stats); err != nil {
+		return err
+	}
+	// host resource usage is not available from older
+	// runners, and is omitted.
+	resources := new(struct {
+		Host *machine.Usage `json:"host"`
+	})
+	c.get("/api/resources", resources)
+
+	writeStats(os.Stdout, stats, resources.Host, time.Now())
+	return nil
+}
+
+// helper function writes the running stages and their steps
+// in tabular format.
+func writeStages(w io.Writer, stages []*admin.StageStats, now time.Time) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAGE\tREPO\tBUILD\tNAME\tSTATUS\tDURATION")
+	for _, stage := range stages {
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%s\t%s\n",
+			stage.ID,
+			stage.Repo,
+			stage.Build,
+			stage.Name,
+			stage.Status,
+			elapsed(stage.Started, 0, now),
+		)
+		for _, step := range stage.Steps {
+			fmt.Fprintf(tw, "\t\t\t  %s\t%s\t%s\n",
+				step.Name,
+				step.Status,
+				elapsed(step.Started, step.Stopped, now),
+			)
+		}
+	}
+	tw.Flush()
+}
+
+// helper function writes the runner capacity, host resource
+// usage and recent errors.
+func writeStats(w io.Writer, stats *admin.Stats, host *machine.Usage, now time.Time) {
+	fmt.Fprintf(w, "Capacity:  %d of %d in use", stats.Running, stats.Capacity)
+	if stats.Pending != 0 {
+		fmt.Fprintf(w, ", %d pending", stats.Pending)
+	}
+	fmt.Fprintln(w)
+	if host != nil {
+		fmt.Fprintf(w, "CPU:       %.0f%% of %d cores\n", host.CPUPercent, host.CPUCount)
+		if host.MemoryTotal != 0 {
+			fmt.Fprintf(w, "Memory:    %s of %s\n",
+				units.BytesSize(float64(host.MemoryUsed)),
+				units.BytesSize(float64(host.MemoryTotal)),
+			)
+		}
+		for _, disk := range host.Disks {
+			fmt.Fprintf(w, "Disk:      %s of %s (%s)\n",
+				units.BytesSize(float64(disk.Used)),
+				units.BytesSize(float64(disk.Total)),
+				disk.Path,
+			)
+		}
+	}
+	if len(stats.Stages) != 0 {
+		fmt.Fprintln(w)
+		writeStages(w, stats.Stages, now)
+	}
+	if len(stats.Errors) != 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "Recent errors:")
+		for _, entry := range stats.Errors {
+			fmt.Fprintf(w, "  %s  %-5s  %s\n",
+				time.Unix(entry.Time, 0).Format(time.RFC3339),
+				entry.Level,
+				entry.Message,
+			)
+		}
+	}
+}
+
+// helper function returns the elapsed time of the step or
+// stage, or a dash if not started.
+func elapsed(started, stopped int64, now time.Time) string {
+	if started == 0 {
+		return "-"
+	}
+	if stopped == 0 {
+		stopped = now.Unix()
+	}
+	return (time.Duration(stopped-started) * time.Second).String()
+}
+
+func registerPs(app *kingpin.Application) {
+	c := new(psCommand)
+
+	cmd := app.Command("ps", "lists the running stages of the local runner").
+		Action(c.run)
+
+	c.register(cmd)
+}
+
+func registerStats(app *kingpin.Application) {
+	c := new(statsCommand)
+
+	cmd := app.Command("stats", "displays the capacity, resource usage and recent errors of the local runner").
+		Action(c.run)
+
+	c.register(cmd)
+}
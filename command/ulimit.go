@@ -0,0 +1,94 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !windows
+
+package command
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/drone-runners/drone-runner-exec/engine/resource"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// maps the resource limit names to the resource identifiers.
+var rlimits = map[string]int{
+	resource.UlimitCore:   syscall.RLIMIT_CORE,
+	resource.UlimitNofile: syscall.RLIMIT_NOFILE,
+}
+
+type ulimitCommand struct {
+	Limits  map[string]string
+	Command string
+	Args    []string
+}
+
+func (c *ulimitCommand) run(*kingpin.ParseContext) error {
+	for name, value := range c.Limits {
+		id, ok := rlimits[name]
+		if !ok {
+			return fmt.Errorf("unsupported ulimit %q", name)
+		}
+		limit, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ulimit %s=%s", name, value)
+		}
+		if err := setrlimit(id, limit); err != nil {
+			return fmt.Errorf("cannot set ulimit %s: %s", name, err)
+		}
+	}
+	path, err := exec.LookPath(c.Command)
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, append([]string{c.Command}, c.Args...), os.Environ())
+}
+
+// helper function sets the soft and hard resource limit, such
+// that the limit cannot be raised by the step. The hard limit
+// cannot be raised by an unprivileged process, in which case
+// the current hard limit is used.
+func setrlimit(id int, limit uint64) error {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(id, &rlimit); err != nil {
+		return err
+	}
+	if limit < uint64(rlimit.Max) {
+		assign(&rlimit.Max, limit)
+	}
+	rlimit.Cur = rlimit.Max
+	return syscall.Setrlimit(id, &rlimit)
+}
+
+// helper function assigns the limit to the rlimit field, which
+// is signed or unsigned depending on the platform.
+func assign[T int64 | uint64](field *T, limit uint64) {
+	*field = T(limit)
+}
+
+func registerUlimit(app *kingpin.Application) {
+	c := &ulimitCommand{Limits: map[string]string{}}
+
+	// the command is invoked by the runner to execute steps
+	// with resource limits, and is therefore hidden.
+	cmd := app.Command("ulimit", "executes a command with resource limits").
+		Hidden().
+		Action(c.run)
+
+	cmd.Flag("limit", "resource limit").
+		StringMapVar(&c.Limits)
+
+	cmd.Arg("command", "command to execute").
+		Required().
+		StringVar(&c.Command)
+
+	cmd.Arg("args", "command arguments").
+		StringsVar(&c.Args)
+}
@@ -0,0 +1,18 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !windows,!solaris
+
+package command
+
+import (
+	"github.com/drone-runners/drone-runner-exec/engine/resource"
+
+	"golang.org/x/sys/unix"
+)
+
+// the process limit is not supported on solaris.
+func init() {
+	rlimits[resource.UlimitNproc] = unix.RLIMIT_NPROC
+}
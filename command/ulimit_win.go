@@ -0,0 +1,12 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build windows
+
+package command
+
+import "gopkg.in/alecthomas/kingpin.v2"
+
+// resource limits are not supported on windows.
+func registerUlimit(app *kingpin.Application) {}
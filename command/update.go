@@ -0,0 +1,173 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/daemon/admin"
+	"github.com/drone-runners/drone-runner-exec/daemon/service"
+	"github.com/drone-runners/drone-runner-exec/internal/update"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type updateCommand struct {
+	Endpoint  string
+	PublicKey string
+	Check     bool
+
+	Restart string
+	Server  string
+	Token   string
+	Timeout time.Duration
+}
+
+func (c *updateCommand) run(*kingpin.ParseContext) error {
+	updater, err := update.New(update.Config{
+		Endpoint:  c.Endpoint,
+		PublicKey: c.PublicKey,
+		Version:   version,
+	})
+	if err != nil {
+		return err
+	}
+	release, asset, err := updater.Latest(nocontext)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("current version %s, latest version %s\n", version, release.Version)
+	if !update.Newer(release.Version, version) {
+		fmt.Println("runner is up to date")
+		return nil
+	}
+	if c.Check {
+		return nil
+	}
+
+	data, err := updater.Download(nocontext, release, asset)
+	if err != nil {
+		return err
+	}
+	path, err := update.Executable()
+	if err != nil {
+		return err
+	}
+	if err := update.Install(path, data); err != nil {
+		return err
+	}
+	fmt.Printf("installed version %s to %s\n", release.Version, path)
+
+	if c.Restart == "" {
+		return nil
+	}
+	// the running stages complete before the service is
+	// restarted, if the runner is drained using the fleet api.
+	if c.Token != "" {
+		fmt.Println("draining the runner")
+		if err := c.drain(); err != nil {
+			return err
+		}
+	}
+	s, err := service.New(service.Config{
+		Name: c.Restart,
+		Desc: service.DefaultDesc,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restarting service %s\n", c.Restart)
+	return s.Restart()
+}
+
+// helper function drains the runner, and waits until no stages
+// are pending or running.
+func (c *updateCommand) drain() error {
+	ctx, cancel := context.WithTimeout(nocontext, c.Timeout)
+	defer cancel()
+
+	if _, err := c.do(ctx, "POST", "/api/v1/drain"); err != nil {
+		return err
+	}
+	for {
+		res, err := c.do(ctx, "GET", "/api/v1/health")
+		if err != nil {
+			return err
+		}
+		health := new(admin.Health)
+		err = json.NewDecoder(res.Body).Decode(health)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		if health.Running == 0 && health.Pending == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.New("timeout waiting for running stages to complete")
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (c *updateCommand) do(ctx context.Context, method, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.Server, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode > 299 {
+		res.Body.Close()
+		return nil, fmt.Errorf("cannot %s %s: %s", method, path, res.Status)
+	}
+	return res, nil
+}
+
+func registerUpdate(app *kingpin.Application) {
+	c := new(updateCommand)
+
+	cmd := app.Command("update", "updates the runner to the latest signed release").
+		Action(c.run)
+
+	cmd.Flag("endpoint", "release manifest url").
+		Envar("DRONE_UPDATE_ENDPOINT").
+		Required().
+		StringVar(&c.Endpoint)
+
+	cmd.Flag("public-key", "base64-encoded ed25519 release signing key").
+		Envar("DRONE_UPDATE_PUBLIC_KEY").
+		Required().
+		StringVar(&c.PublicKey)
+
+	cmd.Flag("check", "check for a newer release without installing").
+		BoolVar(&c.Check)
+
+	cmd.Flag("restart", "restart the named service after the update").
+		PlaceHolder(service.DefaultName).
+		StringVar(&c.Restart)
+
+	cmd.Flag("server", "runner address, used to drain the runner before restart").
+		Default("http://localhost:3000").
+		StringVar(&c.Server)
+
+	cmd.Flag("token", "fleet api token, used to drain the runner before restart").
+		Envar("DRONE_FLEET_TOKEN").
+		StringVar(&c.Token)
+
+	cmd.Flag("timeout", "maximum time to wait for running stages to complete").
+		Default("1h").
+		DurationVar(&c.Timeout)
+}
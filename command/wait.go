@@ -0,0 +1,83 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/engine/probe"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type waitCommand struct {
+	Address  string
+	Timeout  time.Duration
+	Interval time.Duration
+	Quiet    bool
+}
+
+func (c *waitCommand) run(ready *engine.Probe) error {
+	ctx, cancel := context.WithCancel(nocontext)
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+
+	ready.Timeout = c.Timeout
+	ready.Interval = c.Interval
+	step := &engine.Step{Name: c.Address, Ready: ready}
+	if err := probe.Wait(ctx, step); err != nil {
+		return err
+	}
+	if !c.Quiet {
+		fmt.Printf("%s is ready\n", c.Address)
+	}
+	return nil
+}
+
+func registerWait(app *kingpin.Application) {
+	c := new(waitCommand)
+
+	// the command is invoked by pipeline steps with the
+	// drone-wait helper, which is installed on the step path.
+	cmd := app.Command("wait", "waits until a service is ready")
+
+	cmd.Flag("timeout", "maximum time to wait").
+		Default("1m").
+		DurationVar(&c.Timeout)
+
+	cmd.Flag("interval", "time between attempts").
+		Default("1s").
+		DurationVar(&c.Interval)
+
+	cmd.Flag("quiet", "do not print when the service is ready").
+		BoolVar(&c.Quiet)
+
+	tcp := cmd.Command("tcp", "waits until the tcp address accepts connections").
+		Action(func(*kingpin.ParseContext) error {
+			return c.run(&engine.Probe{TCP: c.Address})
+		})
+	tcp.Arg("address", "host:port address").
+		Required().
+		StringVar(&c.Address)
+
+	http := cmd.Command("http", "waits until the url responds with a success status").
+		Action(func(*kingpin.ParseContext) error {
+			return c.run(&engine.Probe{HTTP: c.Address})
+		})
+	http.Arg("url", "http url").
+		Required().
+		StringVar(&c.Address)
+}
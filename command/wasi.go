@@ -0,0 +1,80 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/drone-runners/drone-runner-exec/engine/wasi"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type wasiCommand struct {
+	Module string
+	Args   []string
+	Cache  string
+}
+
+func (c *wasiCommand) run(*kingpin.ParseContext) error {
+	ctx, cancel := context.WithCancel(nocontext)
+	defer cancel()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		cancel()
+	}()
+
+	module, err := wasi.Load(ctx, c.Module, c.Cache)
+	if err != nil {
+		return err
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	code, err := wasi.Run(ctx, module, wasi.Config{
+		Dir:    dir,
+		Args:   c.Args,
+		Env:    os.Environ(),
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	})
+	if err != nil {
+		return err
+	}
+	os.Exit(code)
+	return nil
+}
+
+func registerWasi(app *kingpin.Application) {
+	c := new(wasiCommand)
+
+	// the command is invoked by the runner to execute wasi
+	// pipeline steps, and is therefore hidden.
+	cmd := app.Command("wasi", "executes a wasi module").
+		Hidden().
+		Action(c.run)
+
+	cmd.Arg("module", "module path or oci image").
+		Required().
+		StringVar(&c.Module)
+
+	cmd.Arg("args", "module arguments").
+		StringsVar(&c.Args)
+
+	cache, _ := os.UserCacheDir()
+	if cache != "" {
+		cache = filepath.Join(cache, "drone-runner-exec", "wasi")
+	}
+	cmd.Flag("cache", "module cache directory").
+		Default(cache).
+		StringVar(&c.Cache)
+}
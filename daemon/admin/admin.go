@@ -0,0 +1,412 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package admin implements the runner administration api.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/archive"
+	"github.com/drone-runners/drone-runner-exec/internal/ratelimit"
+	"github.com/drone-runners/drone-runner-exec/internal/remote"
+	"github.com/drone-runners/drone-runner-exec/internal/sso"
+	"github.com/drone-runners/drone-runner-exec/internal/usage"
+	"github.com/drone-runners/drone-runner-exec/runtime"
+
+	"github.com/drone/runner-go/handler"
+	"github.com/drone/runner-go/handler/static"
+	loghistory "github.com/drone/runner-go/logger/history"
+	"github.com/drone/runner-go/pipeline/history"
+	"github.com/sirupsen/logrus"
+)
+
+// Config configures the administration api.
+type Config struct {
+	Username string
+	Password string
+
+	// History optionally enables the build history api.
+	History archive.Store
+
+	// Processes optionally enables the host resource api,
+	// which reports the disk usage of the paths.
+	Processes *runtime.Processes
+	Paths     []string
+
+	// Tracer optionally enables the stats api, which reports
+	// the running stages, the capacity and the recent errors
+	// recorded by the log hook.
+	Tracer   *history.History
+	Hook     *loghistory.Hook
+	Capacity int
+
+	// LogRetention optionally excludes log hook entries older
+	// than the retention from the log download api.
+	LogRetention time.Duration
+
+	// Hosts optionally enables the remote hosts api, which
+	// reports the host status and cordons hosts.
+	Hosts *remote.Pool
+
+	// SSO optionally enables dashboard login with the openid
+	// connect provider, in addition to basic authentication.
+	SSO *sso.Provider
+
+	// Breaker optionally enables the circuit breaker api,
+	// which reports and resets the circuit breaker.
+	Breaker *runtime.Breaker
+
+	// Usage optionally enables the usage api, which reports
+	// the execution time of each repository namespace.
+	Usage *usage.Ledger
+
+	// Debugs optionally enables the debug api, which marks
+	// stages and repositories for debugging.
+	Debugs *runtime.Debugs
+
+	// Failures optionally limits the rate of failed basic
+	// authentication attempts of each client, to protect
+	// against credential guessing. Clients that exceed the
+	// limit are rejected before the credentials are checked.
+	Failures *ratelimit.Clients
+}
+
+// New returns a new administration api handler. The api is
+// disabled when no password or sso provider is configured.
+func New(workspaces *runtime.Workspaces, gates *runtime.Gates, config Config) http.Handler {
+	mux := http.NewServeMux()
+	if config.Password == "" && config.SSO == nil {
+		return mux
+	}
+	rerun := HandleRerun(workspaces)
+	decide := HandleDecide(gates)
+	mux.Handle("/api/workspaces", HandleWorkspaces(workspaces))
+	mux.Handle("/api/approvals", HandleApprovals(gates))
+	if config.History != nil {
+		mux.Handle("/api/history", HandleHistory(config.History))
+	}
+	if config.Tracer != nil {
+		mux.Handle("/api/stats", HandleStats(config.Tracer, config.Hook, config.Capacity))
+	}
+	if config.Hook != nil {
+		mux.Handle("/api/logs", HandleLogs(config.Hook, config.LogRetention))
+	}
+	if config.Processes != nil {
+		mux.Handle("/api/resources", HandleResources(config.Processes, config.Paths))
+	}
+	if config.Hosts != nil {
+		mux.Handle("/api/hosts", HandleHosts(config.Hosts))
+		mux.Handle("/api/hosts/", HandleCordon(config.Hosts))
+	}
+	if config.Breaker != nil {
+		mux.Handle("/api/breaker", HandleBreaker(config.Breaker))
+		mux.Handle("/api/breaker/", HandleBreaker(config.Breaker))
+	}
+	if config.Usage != nil {
+		mux.Handle("/api/usage", HandleUsage(config.Usage))
+	}
+	var debug http.HandlerFunc = http.NotFound
+	if config.Debugs != nil {
+		debug = HandleDebug(config.Debugs)
+		mux.Handle("/api/debug", HandleDebugs(config.Debugs))
+		mux.Handle("/api/repos/", debug)
+	}
+	mux.HandleFunc("/api/stages/", func(w http.ResponseWriter, r *http.Request) {
+		switch path.Base(r.URL.Path) {
+		case "approve", "reject":
+			decide(w, r)
+		case "debug":
+			debug(w, r)
+		default:
+			rerun(w, r)
+		}
+	})
+	return Auth(mux, config)
+}
+
+// HandleWorkspaces returns an http.HandlerFunc that writes a
+// json-encoded list of preserved workspaces.
+func HandleWorkspaces(workspaces *runtime.Workspaces) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var out []*workspace
+		for _, item := range workspaces.List() {
+			out = append(out, &workspace{
+				Stage: item.Stage,
+				Repo:  item.Repo,
+				Build: item.Build,
+				Root:  item.Spec.Root,
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// HandleRerun returns an http.HandlerFunc that re-executes a
+// step against the preserved workspace of a completed stage,
+// and streams the step output to the response body. The output
+// and exit code are also appended to the step log.
+//
+//	POST /api/stages/{stage}/steps/{step}/rerun
+func HandleRerun(workspaces *runtime.Workspaces) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 6 || parts[3] != "steps" || parts[5] != "rerun" {
+			http.NotFound(w, r)
+			return
+		}
+		stage, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		name := parts[4]
+
+		log := logrus.WithField("stage.id", stage).
+			WithField("step.name", name)
+
+		if workspaces.Find(stage) == nil {
+			http.Error(w, runtime.ErrWorkspaceNotFound.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		out := &flushWriter{w}
+		log.Infoln("re-running step")
+		state, err := workspaces.Rerun(r.Context(), stage, name, out)
+		if err == runtime.ErrStepNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if state != nil {
+			log.WithField("exit.code", state.ExitCode).
+				Infoln("step re-run complete")
+			fmt.Fprintf(out, "\nexit code %d\n", state.ExitCode)
+			return
+		}
+		log.WithError(err).Warnln("step re-run failed")
+		fmt.Fprintf(out, "\nerror: %s\n", err)
+	}
+}
+
+// HandleApprovals returns an http.HandlerFunc that writes a
+// json-encoded list of paused steps awaiting approval.
+func HandleApprovals(gates *runtime.Gates) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gates.List())
+	}
+}
+
+// HandleDecide returns an http.HandlerFunc that approves or
+// rejects a paused step. The decision is recorded with the
+// authenticated user of the request, and an optional free-form
+// name of the approver is recorded separately, so it cannot
+// replace the authenticated user. The decision is audited in
+// the runner logs and the step logs.
+//
+//	POST /api/stages/{stage}/steps/{step}/approve
+//	POST /api/stages/{stage}/steps/{step}/reject
+func HandleDecide(gates *runtime.Gates) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 6 || parts[3] != "steps" {
+			http.NotFound(w, r)
+			return
+		}
+		stage, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		decision := &runtime.Decision{
+			Approved: parts[5] == "approve",
+			User:     userFrom(r.Context()),
+			Name:     r.FormValue("name"),
+			Comment:  r.FormValue("comment"),
+		}
+		if decision.User == "" {
+			decision.User, _, _ = r.BasicAuth()
+		}
+
+		logrus.WithField("stage.id", stage).
+			WithField("step.name", parts[4]).
+			WithField("approved", decision.Approved).
+			WithField("user", decision.User).
+			WithField("name", decision.Name).
+			Infoln("received approval decision")
+
+		if err := gates.Decide(stage, parts[4], decision); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type workspace struct {
+	Stage int64  `json:"stage_id"`
+	Repo  string `json:"repo"`
+	Build int64  `json:"build"`
+	Root  string `json:"root"`
+}
+
+// Auth wraps the handler with http basic authentication and,
+// if configured, sso session authentication. Users with a sso
+// session are permitted to view, and only members of the admin
+// groups are permitted to perform administrative actions.
+// Unauthenticated dashboard pages redirect to the sso login.
+//
+// Browsers send credentials with requests initiated by other
+// sites, so administrative actions are rejected if initiated
+// by another site, and actions performed with a sso session
+// require the csrf token of the session.
+func Auth(h http.Handler, config Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isAction(r) && !sameOrigin(r) {
+			http.Error(w, "cross-origin request denied", http.StatusForbidden)
+			return
+		}
+		if config.SSO != nil {
+			if session := config.SSO.Session(r); session != nil {
+				if !config.SSO.CanView(session) ||
+					(isAction(r) && !config.SSO.CanAdmin(session)) {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				if isAction(r) && !config.SSO.VerifyToken(session, sso.RequestToken(r)) {
+					http.Error(w, "invalid csrf token", http.StatusForbidden)
+					return
+				}
+				h.ServeHTTP(w, r.WithContext(withUser(r.Context(), session.User)))
+				return
+			}
+		}
+		username, password, ok := r.BasicAuth()
+		if ok && config.Failures != nil && config.Failures.Limited(r) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many failed login attempts", http.StatusTooManyRequests)
+			return
+		}
+		if ok && config.Password != "" &&
+			subtle.ConstantTimeCompare([]byte(username), []byte(config.Username)) == 1 &&
+			subtle.ConstantTimeCompare([]byte(password), []byte(config.Password)) == 1 {
+			h.ServeHTTP(w, r.WithContext(withUser(r.Context(), username)))
+			return
+		}
+		if ok && config.Failures != nil {
+			config.Failures.Allow(r)
+		}
+		if config.SSO != nil && r.Method == "GET" && !strings.HasPrefix(r.URL.Path, "/api/") {
+			http.Redirect(w, r, sso.LoginURL(r.URL.RequestURI()), http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+}
+
+// Dashboard returns the dashboard handler, which serves the
+// runner dashboard pages with the configured authentication.
+// The dashboard is disabled when no password or sso provider
+// is configured.
+func Dashboard(tracer *history.History, hook *loghistory.Hook, config Config) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handler.HandleHealth(tracer))
+	if config.Password == "" && config.SSO == nil {
+		return mux
+	}
+	if config.SSO != nil {
+		mux.Handle("/auth/", config.SSO.Handler())
+	}
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(static.New())))
+	mux.Handle("/logs", Auth(handler.HandleLogHistory(hook), config))
+	mux.Handle("/view", Auth(handler.HandleStage(tracer, hook), config))
+	mux.Handle("/", Auth(handler.HandleIndex(tracer), config))
+	return mux
+}
+
+// helper function returns true if the request performs an
+// administrative action.
+func isAction(r *http.Request) bool {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return false
+	default:
+		return true
+	}
+}
+
+// helper function returns false if the request was initiated
+// by another site. Requests without the fetch metadata, origin
+// and referer headers are not initiated by a browser, and are
+// permitted.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return true
+	case "":
+	default:
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+type userKey struct{}
+
+// helper function returns a context that carries the name of
+// the authenticated user.
+func withUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// helper function returns the name of the authenticated user
+// carried by the context.
+func userFrom(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+// flushWriter is an io.WriteCloser that flushes each write to
+// the client.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+func (f *flushWriter) Close() error {
+	return nil
+}
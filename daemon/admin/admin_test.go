@@ -0,0 +1,218 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/ratelimit"
+	"github.com/drone-runners/drone-runner-exec/internal/sso"
+	"github.com/drone-runners/drone-runner-exec/runtime"
+)
+
+func TestAuth(t *testing.T) {
+	workspaces := runtime.NewWorkspaces(nil, runtime.CleanupNever, 0)
+	h := New(workspaces, runtime.NewGates(), Config{Username: "admin", Password: "correct-horse"})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/workspaces", nil)
+	h.ServeHTTP(w, r)
+	if got, want := w.Code, http.StatusUnauthorized; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/workspaces", nil)
+	r.SetBasicAuth("admin", "correct-horse")
+	h.ServeHTTP(w, r)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+}
+
+func TestRerun_NotFound(t *testing.T) {
+	workspaces := runtime.NewWorkspaces(nil, runtime.CleanupNever, 0)
+	h := HandleRerun(workspaces)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/stages/1/steps/test/rerun", nil)
+	h.ServeHTTP(w, r)
+	if got, want := w.Code, http.StatusNotFound; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/stages/1/steps/test/rerun", nil)
+	h.ServeHTTP(w, r)
+	if got, want := w.Code, http.StatusMethodNotAllowed; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+}
+
+func TestDecide(t *testing.T) {
+	gates := runtime.NewGates()
+	h := HandleDecide(gates)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/stages/1/steps/deploy/approve", nil)
+	h.ServeHTTP(w, r)
+	if got, want := w.Code, http.StatusNotFound; got != want {
+		t.Errorf("Want status %d when step is not paused, got %d", want, got)
+	}
+
+	done := make(chan *runtime.Decision)
+	go func() {
+		decision, _ := gates.Wait(context.Background(), &runtime.Gate{Stage: 1, Step: "deploy"}, time.Minute)
+		done <- decision
+	}()
+	for len(gates.List()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/api/stages/1/steps/deploy/reject?comment=not+today", nil)
+	r.SetBasicAuth("octocat", "correct-horse")
+	h.ServeHTTP(w, r)
+	if got, want := w.Code, http.StatusNoContent; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+	decision := <-done
+	if decision.Approved || decision.User != "octocat" || decision.Comment != "not today" {
+		t.Errorf("Unexpected decision %+v", decision)
+	}
+}
+
+func TestDecide_User(t *testing.T) {
+	gates := runtime.NewGates()
+	h := HandleDecide(gates)
+
+	done := make(chan *runtime.Decision)
+	go func() {
+		decision, _ := gates.Wait(context.Background(), &runtime.Gate{Stage: 1, Step: "deploy"}, time.Minute)
+		done <- decision
+	}()
+	for len(gates.List()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the posted user cannot replace the identity of the
+	// authenticated session.
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/stages/1/steps/deploy/approve?user=admin&name=Jane+Doe", nil)
+	r = r.WithContext(withUser(r.Context(), "octocat"))
+	h.ServeHTTP(w, r)
+	if got, want := w.Code, http.StatusNoContent; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+	decision := <-done
+	if decision.User != "octocat" {
+		t.Errorf("Want decision recorded by the session user, got %q", decision.User)
+	}
+	if decision.Name != "Jane Doe" {
+		t.Errorf("Want approver name recorded separately, got %q", decision.Name)
+	}
+}
+
+func TestAuth_SSO(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"authorization_endpoint": ts.URL + "/authorize",
+			"token_endpoint":         ts.URL + "/token",
+		})
+	}))
+	defer ts.Close()
+	provider, err := sso.New(context.Background(), sso.Config{Issuer: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Auth(http.NotFoundHandler(), Config{SSO: provider})
+
+	// unauthenticated dashboard pages redirect to the login.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/view?id=1", nil))
+	if got, want := w.Header().Get("Location"), "/auth/login?return=%2Fview%3Fid%3D1"; got != want {
+		t.Errorf("Want redirect to %s, got %s", want, got)
+	}
+
+	// unauthenticated api requests are rejected.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/api/workspaces", nil))
+	if got, want := w.Code, http.StatusUnauthorized; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+
+	// basic authentication is rejected when no password is
+	// configured.
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/workspaces", nil)
+	r.SetBasicAuth("", "")
+	h.ServeHTTP(w, r)
+	if got, want := w.Code, http.StatusUnauthorized; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+}
+
+func TestAuth_CrossOrigin(t *testing.T) {
+	h := Auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}), Config{Username: "admin", Password: "correct-horse"})
+	tests := []struct {
+		header, value string
+		want          int
+	}{
+		{"", "", http.StatusOK},
+		{"Sec-Fetch-Site", "same-origin", http.StatusOK},
+		{"Sec-Fetch-Site", "cross-site", http.StatusForbidden},
+		{"Origin", "http://runner.company.com", http.StatusOK},
+		{"Origin", "http://evil.com", http.StatusForbidden},
+		{"Referer", "http://evil.com/page", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "http://runner.company.com/api/stages/1/steps/deploy/approve", nil)
+		r.SetBasicAuth("admin", "correct-horse")
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+		h.ServeHTTP(w, r)
+		if w.Code != test.want {
+			t.Errorf("Want status %d with %s %q, got %d", test.want, test.header, test.value, w.Code)
+		}
+	}
+}
+
+func TestAuth_Failures(t *testing.T) {
+	workspaces := runtime.NewWorkspaces(nil, runtime.CleanupNever, 0)
+	h := New(workspaces, runtime.NewGates(), Config{
+		Username: "admin",
+		Password: "correct-horse",
+		Failures: ratelimit.Requests(0.001, 3),
+	})
+	request := func(password string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/workspaces", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.SetBasicAuth("admin", password)
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	for i := 0; i < 3; i++ {
+		if got, want := request("battery-staple"), http.StatusUnauthorized; got != want {
+			t.Errorf("Want status %d, got %d", want, got)
+		}
+	}
+	if got, want := request("battery-staple"), http.StatusTooManyRequests; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+	// the credentials are not checked once the client exceeds
+	// the limit of failed attempts.
+	if got, want := request("correct-horse"), http.StatusTooManyRequests; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+}
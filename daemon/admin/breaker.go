@@ -0,0 +1,63 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/drone-runners/drone-runner-exec/runtime"
+
+	"github.com/sirupsen/logrus"
+)
+
+// HandleHealthz returns an http.HandlerFunc that reports the
+// health of the runner. The runner is unhealthy while the
+// circuit breaker is tripped, and the json-encoded breaker
+// status is written to the response body.
+//
+//	GET /healthz
+func HandleHealthz(breaker *runtime.Breaker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
+		status := breaker.Status()
+		if !status.Tripped {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(status)
+	}
+}
+
+// HandleBreaker returns an http.HandlerFunc that writes the
+// json-encoded status of the circuit breaker, or resets the
+// circuit breaker.
+//
+//	GET  /api/breaker
+//	POST /api/breaker/reset
+func HandleBreaker(breaker *runtime.Breaker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/breaker":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(breaker.Status())
+		case r.Method == "POST" && r.URL.Path == "/api/breaker/reset":
+			user := userFrom(r.Context())
+			if user == "" {
+				user, _, _ = r.BasicAuth()
+			}
+			breaker.Reset()
+			logrus.WithField("user", user).
+				Infoln("circuit breaker reset")
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/api/breaker" || r.URL.Path == "/api/breaker/reset":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
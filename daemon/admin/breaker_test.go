@@ -0,0 +1,48 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/runtime"
+)
+
+func TestBreaker(t *testing.T) {
+	breaker := runtime.NewBreaker(1, 0, nil)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/healthz", nil)
+	HandleHealthz(breaker).ServeHTTP(w, r)
+	if got, want := w.Code, http.StatusOK; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/breaker", nil)
+	HandleBreaker(breaker).ServeHTTP(w, r)
+	out := new(runtime.BreakerStatus)
+	json.NewDecoder(w.Body).Decode(out)
+	if out.Tripped {
+		t.Errorf("Want breaker not tripped")
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/api/breaker/reset", nil)
+	HandleBreaker(breaker).ServeHTTP(w, r)
+	if got, want := w.Code, http.StatusNoContent; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/breaker/reset", nil)
+	HandleBreaker(breaker).ServeHTTP(w, r)
+	if got, want := w.Code, http.StatusMethodNotAllowed; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+}
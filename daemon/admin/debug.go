@@ -0,0 +1,86 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-exec/runtime"
+
+	"github.com/sirupsen/logrus"
+)
+
+// HandleDebugs returns an http.HandlerFunc that writes the
+// json-encoded stages and repositories marked for debugging.
+//
+//	GET /api/debug
+func HandleDebugs(debugs *runtime.Debugs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(debugs.List())
+	}
+}
+
+// HandleDebug returns an http.HandlerFunc that marks a stage or
+// repository for debugging, or removes the mark. The debug
+// session is enabled for the next failure of the stage, or of
+// a stage of the repository, that has not yet started.
+//
+//	POST   /api/stages/{stage}/debug
+//	DELETE /api/stages/{stage}/debug
+//	POST   /api/repos/{owner}/{name}/debug
+//	DELETE /api/repos/{owner}/{name}/debug
+func HandleDebug(debugs *runtime.Debugs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" && r.Method != "DELETE" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		var stage int64
+		var slug string
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		switch {
+		case len(parts) == 4 && parts[1] == "stages" && parts[3] == "debug":
+			id, err := strconv.ParseInt(parts[2], 10, 64)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			stage = id
+		case len(parts) == 5 && parts[1] == "repos" && parts[4] == "debug":
+			slug = parts[2] + "/" + parts[3]
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		user := userFrom(r.Context())
+		if user == "" {
+			user, _, _ = r.BasicAuth()
+		}
+		log := logrus.WithField("user", user)
+		if slug != "" {
+			log = log.WithField("repo", slug)
+		} else {
+			log = log.WithField("stage.id", stage)
+		}
+
+		switch {
+		case r.Method == "DELETE":
+			debugs.Clear(stage, slug)
+			log.Infoln("debug mark removed")
+		case slug != "":
+			debugs.MarkRepo(slug)
+			log.Infoln("repository marked for debugging")
+		default:
+			debugs.MarkStage(stage)
+			log.Infoln("stage marked for debugging")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/runtime"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDebug(t *testing.T) {
+	debugs := runtime.NewDebugs()
+	h := New(runtime.NewWorkspaces(nil, runtime.CleanupNever, 0), runtime.NewGates(), Config{
+		Username: "admin",
+		Password: "correct-horse",
+		Debugs:   debugs,
+	})
+	request := func(method, path string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		r.SetBasicAuth("admin", "correct-horse")
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/stages/1/debug", nil)
+	h.ServeHTTP(w, r)
+	if got, want := w.Code, http.StatusUnauthorized; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+
+	if got, want := request("POST", "/api/stages/1/debug"), http.StatusNoContent; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+	if got, want := request("POST", "/api/repos/octocat/hello-world/debug"), http.StatusNoContent; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+	if got, want := request("GET", "/api/stages/1/debug"), http.StatusMethodNotAllowed; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+	if got, want := request("POST", "/api/repos/octocat/debug"), http.StatusNotFound; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+	if !debugs.Marked(1, "") || !debugs.Marked(0, "octocat/hello-world") {
+		t.Errorf("Expect stage and repository marked")
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/debug", nil)
+	r.SetBasicAuth("admin", "correct-horse")
+	h.ServeHTTP(w, r)
+	got := new(runtime.Marks)
+	json.NewDecoder(w.Body).Decode(got)
+	want := &runtime.Marks{Stages: []int64{1}, Repos: []string{"octocat/hello-world"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf(diff)
+	}
+
+	if got, want := request("DELETE", "/api/stages/1/debug"), http.StatusNoContent; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+	if debugs.Marked(1, "") {
+		t.Errorf("Expect stage mark removed")
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-exec/runtime"
+
+	"github.com/drone/runner-go/pipeline/history"
+	"github.com/sirupsen/logrus"
+)
+
+// Health reports the health of the runner to fleet management
+// tooling.
+type Health struct {
+	Status   string `json:"status"`
+	Capacity int    `json:"capacity"`
+	Running  int    `json:"running"`
+	Pending  int    `json:"pending"`
+	Drained  bool   `json:"drained"`
+}
+
+// Runner reports the capacity and labels of the runner or a
+// runner profile.
+type Runner struct {
+	Name     string            `json:"name"`
+	Capacity int               `json:"capacity"`
+	Labels   map[string]string `json:"labels"`
+	Drained  bool              `json:"drained"`
+}
+
+// runnerPatch updates the capacity, labels or drain state of
+// a runner. Omitted fields are not updated.
+type runnerPatch struct {
+	Capacity *int              `json:"capacity"`
+	Labels   map[string]string `json:"labels"`
+	Drained  *bool             `json:"drained"`
+}
+
+// Fleet returns the versioned api used by fleet management
+// tooling to control the runner. Requests are authorized with
+// the bearer token, and the api is disabled when no token is
+// configured.
+//
+//	GET    /api/v1/health
+//	GET    /api/v1/stages
+//	GET    /api/v1/runners
+//	PATCH  /api/v1/runners/{name}
+//	POST   /api/v1/drain
+//	DELETE /api/v1/drain
+func Fleet(tracer *history.History, controls []*runtime.Control, token string) http.Handler {
+	mux := http.NewServeMux()
+	if token == "" {
+		return mux
+	}
+	mux.Handle("/api/v1/health", HandleHealth(tracer, controls))
+	mux.Handle("/api/v1/stages", HandleStages(tracer))
+	mux.Handle("/api/v1/runners", HandleRunners(controls))
+	mux.Handle("/api/v1/runners/", HandleRunnerUpdate(controls))
+	mux.Handle("/api/v1/drain", HandleDrain(controls))
+	return TokenAuth(mux, token)
+}
+
+// TokenAuth wraps the handler with bearer token authentication.
+// Requests without the bearer scheme are rejected.
+func TokenAuth(h http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			writeError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		got := strings.TrimPrefix(auth, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// HandleHealth returns an http.HandlerFunc that writes the
+// json-encoded runner health. The status is draining when all
+// runners are drained.
+func HandleHealth(tracer *history.History, controls []*runtime.Control) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		out := &Health{Status: "ok", Drained: len(controls) != 0}
+		for _, control := range controls {
+			out.Capacity += control.Capacity()
+			out.Drained = out.Drained && control.Drained()
+		}
+		_, out.Running, out.Pending = activeStages(tracer)
+		if out.Drained {
+			out.Status = "draining"
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+// HandleStages returns an http.HandlerFunc that writes the
+// json-encoded list of running and pending stages.
+func HandleStages(tracer *history.History) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stages, _, _ := activeStages(tracer)
+		writeJSON(w, http.StatusOK, stages)
+	}
+}
+
+// HandleRunners returns an http.HandlerFunc that writes the
+// json-encoded list of runners.
+func HandleRunners(controls []*runtime.Control) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		out := []*Runner{}
+		for _, control := range controls {
+			out = append(out, runnerFrom(control))
+		}
+		writeJSON(w, http.StatusOK, out)
+	}
+}
+
+// HandleRunnerUpdate returns an http.HandlerFunc that updates
+// the capacity, labels or drain state of the named runner, and
+// writes the json-encoded runner.
+func HandleRunnerUpdate(controls []*runtime.Control) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PATCH" {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/api/v1/runners/")
+		var control *runtime.Control
+		for _, c := range controls {
+			if c.Name() == name {
+				control = c
+			}
+		}
+		if control == nil {
+			writeError(w, http.StatusNotFound, "runner not found")
+			return
+		}
+		in := new(runnerPatch)
+		if err := json.NewDecoder(r.Body).Decode(in); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if in.Capacity != nil && *in.Capacity < 0 {
+			writeError(w, http.StatusBadRequest, "invalid capacity")
+			return
+		}
+
+		log := logrus.WithField("runner", name)
+		if in.Capacity != nil {
+			log.WithField("capacity", *in.Capacity).
+				Infoln("fleet api updated the runner capacity")
+			control.SetCapacity(*in.Capacity)
+		}
+		if in.Labels != nil {
+			log.WithField("labels", in.Labels).
+				Infoln("fleet api updated the runner labels")
+			control.SetLabels(in.Labels)
+		}
+		if in.Drained != nil {
+			log.WithField("drained", *in.Drained).
+				Infoln("fleet api updated the runner drain state")
+			control.Drain(*in.Drained)
+		}
+		writeJSON(w, http.StatusOK, runnerFrom(control))
+	}
+}
+
+// HandleDrain returns an http.HandlerFunc that drains all
+// runners, so that no further stages are requested while the
+// running stages complete, or resumes all runners.
+//
+//	POST   /api/v1/drain
+//	DELETE /api/v1/drain
+func HandleDrain(controls []*runtime.Control) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var drained bool
+		switch r.Method {
+		case "POST":
+			drained = true
+		case "DELETE":
+			drained = false
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		logrus.WithField("drained", drained).
+			Infoln("fleet api updated the drain state")
+		for _, control := range controls {
+			control.Drain(drained)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// helper function returns the runner state of the control.
+func runnerFrom(control *runtime.Control) *Runner {
+	return &Runner{
+		Name:     control.Name(),
+		Capacity: control.Capacity(),
+		Labels:   control.Labels(),
+		Drained:  control.Drained(),
+	}
+}
+
+// helper function writes the json-encoded value.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// helper function writes the json-encoded error message.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
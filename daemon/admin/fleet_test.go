@@ -0,0 +1,89 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/runtime"
+
+	"github.com/drone/runner-go/pipeline"
+	"github.com/drone/runner-go/pipeline/history"
+)
+
+func TestFleet_Unauthorized(t *testing.T) {
+	tracer := history.New(pipeline.NopReporter())
+	h := Fleet(tracer, nil, "correct-horse")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/v1/health", nil)
+	r.Header.Set("Authorization", "Bearer battery-staple")
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Want invalid token rejected, got status %d", w.Code)
+	}
+
+	// the token is rejected without the bearer scheme.
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/health", nil)
+	r.Header.Set("Authorization", "correct-horse")
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Want token without bearer scheme rejected, got status %d", w.Code)
+	}
+}
+
+func TestFleet_Disabled(t *testing.T) {
+	tracer := history.New(pipeline.NopReporter())
+	h := Fleet(tracer, nil, "")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/v1/health", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Want api disabled without token, got status %d", w.Code)
+	}
+}
+
+func TestFleet_Update(t *testing.T) {
+	tracer := history.New(pipeline.NopReporter())
+	control := runtime.NewControl("default", 2, map[string]string{"os": "linux"})
+	h := Fleet(tracer, []*runtime.Control{control}, "correct-horse")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("PATCH", "/api/v1/runners/default",
+		strings.NewReader(`{"capacity":4,"labels":{"gpu":"true"}}`))
+	r.Header.Set("Authorization", "Bearer correct-horse")
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Want runner updated, got status %d: %s", w.Code, w.Body)
+	}
+	if control.Capacity() != 4 || control.Labels()["gpu"] != "true" {
+		t.Errorf("Want capacity and labels updated")
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/api/v1/drain", nil)
+	r.Header.Set("Authorization", "Bearer correct-horse")
+	h.ServeHTTP(w, r)
+	if !control.Drained() {
+		t.Errorf("Want runner drained")
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/health", nil)
+	r.Header.Set("Authorization", "Bearer correct-horse")
+	h.ServeHTTP(w, r)
+	health := new(Health)
+	json.NewDecoder(w.Body).Decode(health)
+	if health.Status != "draining" || health.Capacity != 4 {
+		t.Errorf("Unexpected health %+v", health)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/archive"
+)
+
+// pageSize is the number of stages listed per history page.
+const pageSize = 25
+
+// HandleHistory returns an http.HandlerFunc that writes a
+// json-encoded list of completed stages, optionally filtered
+// by the q and status query parameters, and paginated by the
+// limit and offset query parameters.
+//
+//	GET /api/history?q=octocat&status=failure
+func HandleHistory(store archive.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter := archive.Filter{
+			Query:  r.FormValue("q"),
+			Status: r.FormValue("status"),
+		}
+		filter.Limit, _ = strconv.Atoi(r.FormValue("limit"))
+		filter.Offset, _ = strconv.Atoi(r.FormValue("offset"))
+		stages, err := store.List(filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stages)
+	}
+}
+
+// HandleHistoryPage returns an http.HandlerFunc that renders
+// the searchable build history page of the dashboard.
+//
+//	GET /history?q=octocat&status=failure&page=2
+func HandleHistoryPage(store archive.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.FormValue("page"))
+		if page < 1 {
+			page = 1
+		}
+		filter := archive.Filter{
+			Query:  r.FormValue("q"),
+			Status: r.FormValue("status"),
+			Limit:  pageSize + 1,
+			Offset: (page - 1) * pageSize,
+		}
+		stages, err := store.List(filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// one additional stage is requested to determine if
+		// there is a next page.
+		data := &historyPage{
+			Query:    filter.Query,
+			Status:   filter.Status,
+			Statuses: []string{"success", "failure", "error", "killed"},
+			Stages:   stages,
+		}
+		if len(stages) > pageSize {
+			data.Stages = stages[:pageSize]
+			data.Next = pageLink(filter, page+1)
+		}
+		if page > 1 {
+			data.Prev = pageLink(filter, page-1)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		historyTemplate.Execute(w, data)
+	}
+}
+
+type historyPage struct {
+	Query    string
+	Status   string
+	Statuses []string
+	Stages   []*archive.Stage
+	Prev     string
+	Next     string
+}
+
+// helper function returns the link to the history page.
+func pageLink(filter archive.Filter, page int) string {
+	v := url.Values{}
+	if filter.Query != "" {
+		v.Set("q", filter.Query)
+	}
+	if filter.Status != "" {
+		v.Set("status", filter.Status)
+	}
+	v.Set("page", strconv.Itoa(page))
+	return "/history?" + v.Encode()
+}
+
+var historyTemplate = template.Must(template.New("history").Funcs(template.FuncMap{
+	"timestamp": func(v int64) string {
+		return time.Unix(v, 0).UTC().Format(time.RFC3339)
+	},
+	"duration": func(v int64) string {
+		return (time.Duration(v) * time.Second).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="UTF-8">
+<title>History</title>
+<link rel="stylesheet" type="text/css" href="/static/reset.css">
+<link rel="stylesheet" type="text/css" href="/static/style.css">
+<link rel="icon" type="image/png" id="favicon" href="/static/favicon.png">
+<script src="/static/timeago.js" type="text/javascript"></script>
+</head>
+<body>
+
+<header class="navbar">
+    <nav class="inline-nav">
+        <ul>
+            <li><a href="/">Dashboard</a></li>
+            <li><a href="/logs">Logging</a></li>
+            <li><a href="/history" class="active">History</a></li>
+            <li><a href="/resources">Resources</a></li>
+        </ul>
+    </nav>
+</header>
+
+<main>
+    <section>
+        <header>
+            <h1>History</h1>
+        </header>
+        <form method="GET" action="/history">
+            <input type="search" name="q" value="{{ .Query }}" placeholder="Search repositories, stages and refs" />
+            <select name="status">
+                <option value="">All</option>
+                {{ range $status := .Statuses }}
+                <option value="{{ $status }}"{{ if eq $status $.Status }} selected{{ end }}>{{ $status }}</option>
+                {{ end }}
+            </select>
+            <button type="submit">Search</button>
+        </form>
+        <article class="cards stages">
+            {{ if not .Stages }}
+            <div class="alert sleeping">
+                <p>There is no build history to display.</p>
+            </div>
+            {{ end }}
+            {{ range .Stages }}
+            <div class="card stage">
+                <h2>{{ .Repo }}</h2>
+                <span class="connector"></span>
+                <span class="status {{ .Status }}"></span>
+                <span class="desc">stage <em>{{ .Name }}</em> for build <em>#{{ .Build }}</em>{{ if .Ref }} on <em>{{ .Ref }}</em>{{ end }} in <em>{{ duration .Duration }}</em></span>
+                <span class="time" datetime="{{ timestamp .Finished }}"></span>
+            </div>
+            {{ end }}
+        </article>
+        <nav>
+            {{ if .Prev }}<a href="{{ .Prev }}">Newer</a>{{ end }}
+            {{ if .Next }}<a href="{{ .Next }}">Older</a>{{ end }}
+        </nav>
+    </section>
+</main>
+
+<footer></footer>
+
+<script>
+timeago.render(document.querySelectorAll('.time'));
+</script>
+</body>
+</html>
+`))
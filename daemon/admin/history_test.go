@@ -0,0 +1,74 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/internal/archive"
+)
+
+func TestHistory(t *testing.T) {
+	store := &fakeHistory{stages: []*archive.Stage{{ID: 1, Repo: "octocat/hello-world", Status: "failure"}}}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/history?q=octocat&status=failure&limit=10", nil)
+	HandleHistory(store).ServeHTTP(w, r)
+
+	want := archive.Filter{Query: "octocat", Status: "failure", Limit: 10}
+	if store.filter != want {
+		t.Errorf("Want filter %+v, got %+v", want, store.filter)
+	}
+	var got []*archive.Stage
+	json.NewDecoder(w.Body).Decode(&got)
+	if len(got) != 1 || got[0].Repo != "octocat/hello-world" {
+		t.Errorf("Unexpected history %v", got)
+	}
+}
+
+func TestHistoryPage(t *testing.T) {
+	var stages []*archive.Stage
+	for i := 0; i <= pageSize; i++ {
+		stages = append(stages, &archive.Stage{Repo: "octocat/<hello-world>", Status: "success"})
+	}
+	store := &fakeHistory{stages: stages}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/history?q=octocat&page=2", nil)
+	HandleHistoryPage(store).ServeHTTP(w, r)
+
+	want := archive.Filter{Query: "octocat", Limit: pageSize + 1, Offset: pageSize}
+	if store.filter != want {
+		t.Errorf("Want filter %+v, got %+v", want, store.filter)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "<hello-world>") {
+		t.Errorf("Want repository name escaped")
+	}
+	if got := strings.Count(body, `class="card stage"`); got != pageSize {
+		t.Errorf("Want %d stages rendered, got %d", pageSize, got)
+	}
+	if !strings.Contains(body, `href="/history?page=1&amp;q=octocat"`) {
+		t.Errorf("Want link to the newer page")
+	}
+	if !strings.Contains(body, `href="/history?page=3&amp;q=octocat"`) {
+		t.Errorf("Want link to the older page")
+	}
+}
+
+type fakeHistory struct {
+	stages []*archive.Stage
+	filter archive.Filter
+}
+
+func (h *fakeHistory) Save(*archive.Stage) error { return nil }
+
+func (h *fakeHistory) List(filter archive.Filter) ([]*archive.Stage, error) {
+	h.filter = filter
+	return h.stages, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-exec/internal/remote"
+
+	"github.com/sirupsen/logrus"
+)
+
+// HandleHosts returns an http.HandlerFunc that writes the
+// json-encoded status of the remote hosts.
+//
+//	GET /api/hosts
+func HandleHosts(pool *remote.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		out := pool.List()
+		if out == nil {
+			out = []*remote.Status{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// HandleCordon returns an http.HandlerFunc that cordons or
+// uncordons a remote host. Cordoned hosts are excluded from
+// scheduling, and running stages are not affected.
+//
+//	POST /api/hosts/{name}/cordon
+//	POST /api/hosts/{name}/uncordon
+func HandleCordon(pool *remote.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 4 {
+			http.NotFound(w, r)
+			return
+		}
+		name := parts[2]
+
+		user := userFrom(r.Context())
+		if user == "" {
+			user, _, _ = r.BasicAuth()
+		}
+
+		var err error
+		switch parts[3] {
+		case "cordon":
+			reason := r.FormValue("reason")
+			if reason == "" {
+				reason = "cordoned by " + user
+			}
+			err = pool.Cordon(name, reason)
+		case "uncordon":
+			err = pool.Uncordon(name)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		logrus.WithField("host", name).
+			WithField("user", user).
+			Infof("remote host %sed", parts[3])
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/internal/remote"
+)
+
+func TestHosts(t *testing.T) {
+	pool := remote.NewPool([]*remote.Host{
+		{Name: "mac-1", Capacity: 2},
+	}, 0)
+
+	form := url.Values{"reason": {"disk replacement"}}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/api/hosts/mac-1/cordon", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	HandleCordon(pool).ServeHTTP(w, r)
+	if got, want := w.Code, http.StatusNoContent; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/hosts", nil)
+	HandleHosts(pool).ServeHTTP(w, r)
+	var out []*remote.Status
+	json.NewDecoder(w.Body).Decode(&out)
+	if len(out) != 1 || !out[0].Cordoned || out[0].Reason != "disk replacement" {
+		t.Errorf("Want host cordoned with reason, got %+v", out)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/api/hosts/mac-2/uncordon", nil)
+	HandleCordon(pool).ServeHTTP(w, r)
+	if got, want := w.Code, http.StatusNotFound; got != want {
+		t.Errorf("Want status %d, got %d", want, got)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	loghistory "github.com/drone/runner-go/logger/history"
+	"github.com/sirupsen/logrus"
+)
+
+// HandleLogs returns an http.HandlerFunc that downloads the
+// recent daemon logs recorded by the log hook as a text file,
+// for attaching to support tickets. Entries older than the
+// retention are excluded, and the optional level parameter
+// excludes entries below the level.
+//
+//	GET /api/logs?level=warn
+func HandleLogs(hook *loghistory.Hook, retention time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		level := logrus.TraceLevel
+		if s := r.FormValue("level"); s != "" {
+			var err error
+			level, err = logrus.ParseLevel(s)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		var since int64
+		if retention > 0 {
+			since = time.Now().Add(-retention).Unix()
+		}
+		entries := hook.Filter(func(entry *loghistory.Entry) bool {
+			return entry.Unix >= since && entryLevel(entry) <= level
+		})
+
+		name := fmt.Sprintf("drone-runner-exec-%s.log", time.Now().UTC().Format("20060102T150405Z"))
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		for _, entry := range entries {
+			fmt.Fprintln(w, formatEntry(entry))
+		}
+	}
+}
+
+// helper function returns the logrus level of the entry.
+func entryLevel(entry *loghistory.Entry) logrus.Level {
+	level, err := logrus.ParseLevel(string(entry.Level))
+	if err != nil {
+		return logrus.InfoLevel
+	}
+	return level
+}
+
+// helper function formats the entry in the logfmt format of
+// the daemon logs, with the fields sorted by name.
+func formatEntry(entry *loghistory.Entry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "time=%q level=%s msg=%s",
+		time.Unix(entry.Unix, 0).UTC().Format(time.RFC3339),
+		entry.Level,
+		quote(entry.Message),
+	)
+	var keys []string
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, " %s=%s", key, quote(fmt.Sprint(entry.Data[key])))
+	}
+	return b.String()
+}
+
+// helper function quotes the value if it contains spaces,
+// quotes or control characters.
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \"=\t\r\n") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
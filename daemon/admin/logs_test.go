@@ -0,0 +1,53 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	loghistory "github.com/drone/runner-go/logger/history"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLogs(t *testing.T) {
+	now := time.Now()
+	hook := loghistory.New()
+	hook.Fire(&logrus.Entry{Level: logrus.ErrorLevel, Message: "expired", Time: now.Add(-2 * time.Hour)})
+	hook.Fire(&logrus.Entry{Level: logrus.InfoLevel, Message: "request stage", Time: now})
+	hook.Fire(&logrus.Entry{
+		Level:   logrus.WarnLevel,
+		Message: "cannot accept stage",
+		Time:    now,
+		Data:    logrus.Fields{"stage.id": 1, "error": "conflict"},
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/logs?level=warn", nil)
+	HandleLogs(hook, time.Hour).ServeHTTP(w, r)
+
+	if got := w.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "attachment;") {
+		t.Errorf("Want log file attachment, got %q", got)
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Want 1 log line, got %d", len(lines))
+	}
+	want := `level=warn msg="cannot accept stage" error=conflict stage.id=1`
+	if !strings.HasSuffix(lines[0], want) {
+		t.Errorf("Want log line %q, got %q", want, lines[0])
+	}
+}
+
+func TestLogs_InvalidLevel(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/logs?level=loud", nil)
+	HandleLogs(loghistory.New(), 0).ServeHTTP(w, r)
+	if got, want := w.Code, 400; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+}
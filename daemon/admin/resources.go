@@ -0,0 +1,188 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/machine"
+	"github.com/drone-runners/drone-runner-exec/runtime"
+)
+
+// sampleInterval is the interval over which the host cpu usage
+// is sampled.
+const sampleInterval = 250 * time.Millisecond
+
+// HandleResources returns an http.HandlerFunc that writes the
+// json-encoded resource usage of the host, including the disk
+// usage of the paths, and the process tree and resource usage
+// of each running pipeline step.
+//
+//	GET /api/resources
+func HandleResources(processes *runtime.Processes, paths []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gatherResources(processes, paths))
+	}
+}
+
+// HandleResourcesPage returns an http.HandlerFunc that renders
+// the host resource page of the dashboard.
+//
+//	GET /resources
+func HandleResourcesPage(processes *runtime.Processes, paths []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		resourcesTemplate.Execute(w, gatherResources(processes, paths))
+	}
+}
+
+type resources struct {
+	Host  *machine.Usage `json:"host"`
+	Steps []*stepUsage   `json:"steps"`
+}
+
+type stepUsage struct {
+	*runtime.Process
+	CPUTime float64          `json:"cpu_time"`
+	Memory  int64            `json:"memory"`
+	Tree    *machine.Process `json:"tree,omitempty"`
+}
+
+// helper function gathers the resource usage of the host and
+// the running pipeline steps.
+func gatherResources(processes *runtime.Processes, paths []string) *resources {
+	out := &resources{
+		Host:  machine.Sample(sampleInterval, paths...),
+		Steps: []*stepUsage{},
+	}
+	for _, proc := range processes.List() {
+		step := &stepUsage{Process: proc}
+		if tree := machine.Tree(proc.PID); tree != nil {
+			step.Tree = tree
+			step.CPUTime, step.Memory = tree.Total()
+		}
+		out.Steps = append(out.Steps, step)
+	}
+	return out
+}
+
+// helper function formats the bytes in human readable format.
+func formatBytes(v int64) string {
+	const unit = 1024
+	if v < unit {
+		return fmt.Sprintf("%d B", v)
+	}
+	div, exp := int64(unit), 0
+	for n := v / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(v)/float64(div), "KMGTPE"[exp])
+}
+
+// helper function formats the seconds as a duration.
+func formatSeconds(v float64) string {
+	return (time.Duration(v*1000) * time.Millisecond).String()
+}
+
+// helper function returns the process tree as lines of text,
+// where child processes are indented.
+func treeLines(root *machine.Process) []string {
+	var lines []string
+	var walk func(*machine.Process, int)
+	walk = func(proc *machine.Process, depth int) {
+		lines = append(lines, fmt.Sprintf("%s%d %s (%s, %s)",
+			strings.Repeat("  ", depth),
+			proc.PID,
+			proc.Command,
+			formatSeconds(proc.CPUTime),
+			formatBytes(proc.Memory),
+		))
+		for _, child := range proc.Children {
+			walk(child, depth+1)
+		}
+	}
+	walk(root, 0)
+	return lines
+}
+
+var resourcesTemplate = template.Must(template.New("resources").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+	"percent": func(used, total int64) string {
+		if total == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%.0f%%", float64(used)/float64(total)*100)
+	},
+	"seconds": formatSeconds,
+	"lines":   treeLines,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="UTF-8">
+<meta http-equiv="refresh" content="10">
+<title>Resources</title>
+<link rel="stylesheet" type="text/css" href="/static/reset.css">
+<link rel="stylesheet" type="text/css" href="/static/style.css">
+<link rel="icon" type="image/png" id="favicon" href="/static/favicon.png">
+</head>
+<body>
+
+<header class="navbar">
+    <nav class="inline-nav">
+        <ul>
+            <li><a href="/">Dashboard</a></li>
+            <li><a href="/logs">Logging</a></li>
+            <li><a href="/history">History</a></li>
+            <li><a href="/resources" class="active">Resources</a></li>
+        </ul>
+    </nav>
+</header>
+
+<main>
+    <section>
+        <header>
+            <h1>Resources</h1>
+        </header>
+        <article class="cards">
+            <div class="card">
+                <h2>Host</h2>
+                <span class="desc">cpu <em>{{ printf "%.0f" .Host.CPUPercent }}%</em> of <em>{{ .Host.CPUCount }}</em> cores</span>
+                {{ if .Host.MemoryTotal }}
+                <span class="desc">memory <em>{{ bytes .Host.MemoryUsed }}</em> of <em>{{ bytes .Host.MemoryTotal }}</em> ({{ percent .Host.MemoryUsed .Host.MemoryTotal }})</span>
+                {{ end }}
+                {{ range .Host.Disks }}
+                <span class="desc">disk <em>{{ .Path }}</em> <em>{{ bytes .Used }}</em> of <em>{{ bytes .Total }}</em> ({{ percent .Used .Total }})</span>
+                {{ end }}
+            </div>
+        </article>
+        <article class="cards stages">
+            {{ if not .Steps }}
+            <div class="alert sleeping">
+                <p>There are no running steps to display.</p>
+            </div>
+            {{ end }}
+            {{ range .Steps }}
+            <div class="card stage">
+                <h2>{{ .Repo }}</h2>
+                <span class="desc">step <em>{{ .Step }}</em> for build <em>#{{ .Build }}</em> using <em>{{ seconds .CPUTime }}</em> cpu and <em>{{ bytes .Memory }}</em> memory</span>
+                {{ with .Tree }}<pre>{{ range lines . }}{{ . }}
+{{ end }}</pre>{{ end }}
+            </div>
+            {{ end }}
+        </article>
+    </section>
+</main>
+
+<footer></footer>
+</body>
+</html>
+`))
@@ -0,0 +1,46 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/internal/machine"
+	"github.com/drone-runners/drone-runner-exec/runtime"
+)
+
+func TestResources(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/resources", nil)
+	HandleResources(runtime.NewProcesses(), []string{os.TempDir()}).ServeHTTP(w, r)
+
+	got := new(resources)
+	json.NewDecoder(w.Body).Decode(got)
+	if got.Host == nil || got.Host.CPUCount == 0 {
+		t.Errorf("Want host resource usage")
+	}
+	if got.Steps == nil || len(got.Steps) != 0 {
+		t.Errorf("Want empty list of running steps")
+	}
+}
+
+func TestTreeLines(t *testing.T) {
+	root := &machine.Process{
+		PID:     10,
+		Command: "sh",
+		Memory:  2048,
+		Children: []*machine.Process{
+			{PID: 11, Command: "make", CPUTime: 1.5, Memory: 512},
+		},
+	}
+	want := "10 sh (0s, 2.0 KiB)\n  11 make (1.5s, 512 B)"
+	if got := strings.Join(treeLines(root), "\n"); got != want {
+		t.Errorf("Want process tree %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/drone/drone-go/drone"
+	loghistory "github.com/drone/runner-go/logger/history"
+	"github.com/drone/runner-go/pipeline/history"
+)
+
+// maximum number of recent errors reported.
+const maxErrors = 10
+
+// Stats reports the runner capacity, the running stages and
+// the recent errors.
+type Stats struct {
+	Capacity int           `json:"capacity"`
+	Running  int           `json:"running"`
+	Pending  int           `json:"pending"`
+	Stages   []*StageStats `json:"stages"`
+	Errors   []*ErrorEntry `json:"errors"`
+}
+
+// StageStats reports a running stage and its steps.
+type StageStats struct {
+	ID      int64        `json:"id"`
+	Repo    string       `json:"repo"`
+	Build   int64        `json:"build"`
+	Name    string       `json:"name"`
+	Status  string       `json:"status"`
+	Started int64        `json:"started"`
+	Steps   []*StepStats `json:"steps"`
+}
+
+// StepStats reports a step of a running stage.
+type StepStats struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Started int64  `json:"started"`
+	Stopped int64  `json:"stopped"`
+}
+
+// ErrorEntry is a recent error or warning logged by the runner.
+type ErrorEntry struct {
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Time    int64                  `json:"time"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// HandleStats returns an http.HandlerFunc that writes the
+// json-encoded runner capacity, the running stages with their
+// steps, and the most recent errors and warnings.
+//
+//	GET /api/stats
+func HandleStats(tracer *history.History, hook *loghistory.Hook, capacity int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		out := &Stats{
+			Capacity: capacity,
+			Errors:   []*ErrorEntry{},
+		}
+		out.Stages, out.Running, out.Pending = activeStages(tracer)
+
+		if hook != nil {
+			recent := hook.Filter(func(entry *loghistory.Entry) bool {
+				return entry.Level == loghistory.LevelError ||
+					entry.Level == loghistory.LevelWarn
+			})
+			if len(recent) > maxErrors {
+				recent = recent[len(recent)-maxErrors:]
+			}
+			for _, entry := range recent {
+				out.Errors = append(out.Errors, &ErrorEntry{
+					Level:   string(entry.Level),
+					Message: entry.Message,
+					Time:    entry.Unix,
+					Fields:  entry.Data,
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	}
+}
+
+// helper function returns the running and pending stages, most
+// recent first, and the number of running and pending stages.
+func activeStages(tracer *history.History) (stages []*StageStats, running, pending int) {
+	stages = []*StageStats{}
+	entries := tracer.Entries()
+	sort.Sort(history.ByTimestamp(entries))
+	for _, entry := range entries {
+		switch entry.Stage.Status {
+		case drone.StatusRunning:
+			running++
+		case drone.StatusPending:
+			pending++
+		default:
+			continue
+		}
+		stage := &StageStats{
+			ID:      entry.Stage.ID,
+			Repo:    entry.Repo.Slug,
+			Build:   entry.Build.Number,
+			Name:    entry.Stage.Name,
+			Status:  entry.Stage.Status,
+			Started: entry.Stage.Started,
+			Steps:   []*StepStats{},
+		}
+		for _, step := range entry.Stage.Steps {
+			stage.Steps = append(stage.Steps, &StepStats{
+				Name:    step.Name,
+				Status:  step.Status,
+				Started: step.Started,
+				Stopped: step.Stopped,
+			})
+		}
+		stages = append(stages, stage)
+	}
+	return stages, running, pending
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	loghistory "github.com/drone/runner-go/logger/history"
+	"github.com/drone/runner-go/pipeline"
+	"github.com/drone/runner-go/pipeline/history"
+	"github.com/sirupsen/logrus"
+)
+
+func TestStats(t *testing.T) {
+	tracer := history.New(pipeline.NopReporter())
+	tracer.ReportStage(context.Background(), &pipeline.State{
+		Repo:  &drone.Repo{Slug: "octocat/hello-world"},
+		Build: &drone.Build{Number: 1},
+		Stage: &drone.Stage{ID: 1, Name: "default", Status: drone.StatusRunning},
+	})
+	tracer.ReportStage(context.Background(), &pipeline.State{
+		Repo:  &drone.Repo{Slug: "octocat/hello-world"},
+		Build: &drone.Build{Number: 2},
+		Stage: &drone.Stage{ID: 2, Name: "default", Status: drone.StatusPassing},
+	})
+
+	hook := loghistory.New()
+	hook.Fire(&logrus.Entry{Level: logrus.InfoLevel, Message: "started"})
+	hook.Fire(&logrus.Entry{Level: logrus.ErrorLevel, Message: "cannot accept stage"})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/stats", nil)
+	HandleStats(tracer, hook, 2).ServeHTTP(w, r)
+
+	got := new(Stats)
+	json.NewDecoder(w.Body).Decode(got)
+	if got.Capacity != 2 || got.Running != 1 || got.Pending != 0 {
+		t.Errorf("Unexpected capacity %+v", got)
+	}
+	if len(got.Stages) != 1 || got.Stages[0].ID != 1 {
+		t.Errorf("Want running stage listed")
+	}
+	if len(got.Errors) != 1 || got.Errors[0].Message != "cannot accept stage" {
+		t.Errorf("Want recent error listed")
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/usage"
+)
+
+// HandleUsage returns an http.HandlerFunc that writes the
+// json-encoded execution time of each repository namespace in
+// the month, which defaults to the current month.
+//
+//	GET /api/usage?period=2006-01
+func HandleUsage(ledger *usage.Ledger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		period := usage.Period(time.Now())
+		if s := r.FormValue("period"); s != "" {
+			t, err := time.Parse("2006-01", s)
+			if err != nil {
+				http.Error(w, "invalid period, want YYYY-MM", http.StatusBadRequest)
+				return
+			}
+			period = usage.Period(t)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ledger.Report(period))
+	}
+}
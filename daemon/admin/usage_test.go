@@ -0,0 +1,38 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/usage"
+)
+
+func TestUsage(t *testing.T) {
+	ledger, _ := usage.New("", nil)
+	ledger.Record("octocat", 90*time.Second)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/usage", nil)
+	HandleUsage(ledger).ServeHTTP(w, r)
+
+	var out []*usage.Usage
+	if err := json.NewDecoder(w.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 1 || out[0].Namespace != "octocat" || out[0].Minutes != 1.5 {
+		t.Errorf("Unexpected usage report %+v", out)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/usage?period=october", nil)
+	HandleUsage(ledger).ServeHTTP(w, r)
+	if got, want := w.Code, 400; got != want {
+		t.Errorf("Want status code %d, got %d", want, got)
+	}
+}
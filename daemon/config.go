@@ -5,11 +5,37 @@
 package daemon
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/drone-runners/drone-runner-exec/engine/resource"
+	"github.com/drone-runners/drone-runner-exec/internal/affinity"
+	"github.com/drone-runners/drone-runner-exec/internal/artifact"
+	"github.com/drone-runners/drone-runner-exec/internal/compress"
+	"github.com/drone-runners/drone-runner-exec/internal/cron"
+	"github.com/drone-runners/drone-runner-exec/internal/egress"
+	"github.com/drone-runners/drone-runner-exec/internal/match"
+	"github.com/drone-runners/drone-runner-exec/internal/provenance"
+	"github.com/drone-runners/drone-runner-exec/internal/remote"
+	"github.com/drone-runners/drone-runner-exec/internal/sandbox"
+	"github.com/drone-runners/drone-runner-exec/internal/seal"
+	"github.com/drone-runners/drone-runner-exec/internal/seccomp"
+	"github.com/drone-runners/drone-runner-exec/internal/secretmeta"
+	"github.com/drone-runners/drone-runner-exec/internal/tenant"
+	"github.com/drone-runners/drone-runner-exec/internal/token"
+	"github.com/drone-runners/drone-runner-exec/internal/toolbox"
+	"github.com/drone-runners/drone-runner-exec/internal/update"
+	"github.com/drone-runners/drone-runner-exec/internal/usage"
+
+	"github.com/docker/go-units"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/sirupsen/logrus"
 
 	"github.com/joho/godotenv"
 )
@@ -26,14 +52,32 @@ type Config struct {
 		MaxSize    int    `envconfig:"DRONE_LOG_FILE_MAX_SIZE"    default:"100"`
 	}
 
+	LogHistory struct {
+		Capacity  int           `envconfig:"DRONE_LOG_HISTORY_CAPACITY" default:"250"`
+		Retention time.Duration `envconfig:"DRONE_LOG_HISTORY_RETENTION"`
+		Level     string        `envconfig:"DRONE_LOG_HISTORY_LEVEL"`
+	}
+
 	Client struct {
-		Address    string `ignored:"true"`
-		Proto      string `envconfig:"DRONE_RPC_PROTO"  default:"http"`
-		Host       string `envconfig:"DRONE_RPC_HOST"   required:"true"`
-		Secret     string `envconfig:"DRONE_RPC_SECRET" required:"true"`
-		SkipVerify bool   `envconfig:"DRONE_RPC_SKIP_VERIFY"`
-		Dump       bool   `envconfig:"DRONE_RPC_DUMP_HTTP"`
-		DumpBody   bool   `envconfig:"DRONE_RPC_DUMP_HTTP_BODY"`
+		Address        string        `ignored:"true"`
+		Proto          string        `envconfig:"DRONE_RPC_PROTO"  default:"http"`
+		Host           string        `envconfig:"DRONE_RPC_HOST"   required:"true"`
+		Secret         string        `envconfig:"DRONE_RPC_SECRET"`
+		SecretFile     string        `envconfig:"DRONE_RPC_SECRET_FILE"`
+		SecretInterval time.Duration `envconfig:"DRONE_RPC_SECRET_FILE_INTERVAL" default:"10s"`
+		SkipVerify     bool          `envconfig:"DRONE_RPC_SKIP_VERIFY"`
+		Dump           bool          `envconfig:"DRONE_RPC_DUMP_HTTP"`
+		DumpBody       bool          `envconfig:"DRONE_RPC_DUMP_HTTP_BODY"`
+		Transport      string        `envconfig:"DRONE_RPC_TRANSPORT" default:"http"`
+		GRPCHost       string        `envconfig:"DRONE_RPC_GRPC_HOST"`
+	}
+
+	OIDC struct {
+		Endpoint     string            `envconfig:"DRONE_OIDC_EXCHANGE_ENDPOINT"`
+		Audience     string            `envconfig:"DRONE_OIDC_AUDIENCE"`
+		TokenFile    string            `envconfig:"DRONE_OIDC_TOKEN_FILE"`
+		TokenURL     string            `envconfig:"DRONE_OIDC_TOKEN_URL"`
+		TokenHeaders map[string]string `envconfig:"DRONE_OIDC_TOKEN_HEADERS"`
 	}
 
 	Platform struct {
@@ -41,6 +85,7 @@ type Config struct {
 		Arch    string `envconfig:"DRONE_PLATFORM_ARCH"`
 		Kernel  string `envconfig:"DRONE_PLATFORM_KERNEL"`
 		Variant string `envconfig:"DRONE_PLATFORM_VARIANT"`
+		Version string `envconfig:"DRONE_PLATFORM_VERSION"`
 	}
 
 	Dashboard struct {
@@ -48,6 +93,76 @@ type Config struct {
 		Username string `envconfig:"DRONE_UI_USERNAME"`
 		Password string `envconfig:"DRONE_UI_PASSWORD"`
 		Realm    string `envconfig:"DRONE_UI_REALM" default:"MyRealm"`
+
+		RateLimit float64 `envconfig:"DRONE_UI_RATE_LIMIT" default:"10"`
+		RateBurst int     `envconfig:"DRONE_UI_RATE_BURST" default:"50"`
+
+		OIDC struct {
+			Issuer         string        `envconfig:"DRONE_UI_OIDC_ISSUER"`
+			ClientID       string        `envconfig:"DRONE_UI_OIDC_CLIENT_ID"`
+			ClientSecret   string        `envconfig:"DRONE_UI_OIDC_CLIENT_SECRET"`
+			RedirectURL    string        `envconfig:"DRONE_UI_OIDC_REDIRECT_URL"`
+			Scopes         []string      `envconfig:"DRONE_UI_OIDC_SCOPES"`
+			GroupsClaim    string        `envconfig:"DRONE_UI_OIDC_GROUPS_CLAIM"`
+			Groups         []string      `envconfig:"DRONE_UI_OIDC_GROUPS"`
+			AdminGroups    []string      `envconfig:"DRONE_UI_OIDC_ADMIN_GROUPS"`
+			SessionSecret  string        `envconfig:"DRONE_UI_OIDC_SESSION_SECRET"`
+			SessionTimeout time.Duration `envconfig:"DRONE_UI_OIDC_SESSION_TIMEOUT" default:"8h"`
+		}
+	}
+
+	Fleet struct {
+		Token string `envconfig:"DRONE_FLEET_TOKEN"`
+	}
+
+	Tenant struct {
+		File   string `envconfig:"DRONE_TENANT_USERS_FILE"`
+		Create bool   `envconfig:"DRONE_TENANT_USERS_CREATE"`
+		Prefix string `envconfig:"DRONE_TENANT_USERS_PREFIX" default:"drone-"`
+	}
+
+	Jail struct {
+		Template string `envconfig:"DRONE_JAIL_TEMPLATE"`
+		Dataset  string `envconfig:"DRONE_JAIL_DATASET"`
+		Dir      string `envconfig:"DRONE_JAIL_DIR" default:"/usr/local/drone/jails"`
+	}
+
+	Zone struct {
+		Template string `envconfig:"DRONE_ZONE_TEMPLATE"`
+		Dir      string `envconfig:"DRONE_ZONE_DIR" default:"/zones/drone"`
+	}
+
+	Remote struct {
+		Hosts       string        `envconfig:"DRONE_REMOTE_HOSTS_FILE"`
+		MaxFailures int           `envconfig:"DRONE_REMOTE_MAX_FAILURES" default:"3"`
+		Health      time.Duration `envconfig:"DRONE_REMOTE_HEALTH_INTERVAL" default:"1m"`
+	}
+
+	Breaker struct {
+		Threshold int           `envconfig:"DRONE_BREAKER_THRESHOLD"`
+		Cooldown  time.Duration `envconfig:"DRONE_BREAKER_COOLDOWN"`
+	}
+
+	Usage struct {
+		File       string         `envconfig:"DRONE_USAGE_FILE"`
+		SoftQuotas map[string]int `envconfig:"DRONE_USAGE_SOFT_QUOTAS"`
+		HardQuotas map[string]int `envconfig:"DRONE_USAGE_HARD_QUOTAS"`
+	}
+
+	Throttle struct {
+		Enabled     bool          `envconfig:"DRONE_THROTTLE_ENABLED"`
+		Interval    time.Duration `envconfig:"DRONE_THROTTLE_INTERVAL" default:"30s"`
+		Temperature float64       `envconfig:"DRONE_THROTTLE_TEMPERATURE" default:"85"`
+		Resume      float64       `envconfig:"DRONE_THROTTLE_RESUME_TEMPERATURE" default:"75"`
+		Battery     int           `envconfig:"DRONE_THROTTLE_BATTERY" default:"20"`
+		Capacity    int           `envconfig:"DRONE_THROTTLE_CAPACITY"`
+	}
+
+	Update struct {
+		Auto      bool          `envconfig:"DRONE_UPDATE_AUTO"`
+		Endpoint  string        `envconfig:"DRONE_UPDATE_ENDPOINT"`
+		PublicKey string        `envconfig:"DRONE_UPDATE_PUBLIC_KEY"`
+		Interval  time.Duration `envconfig:"DRONE_UPDATE_INTERVAL" default:"24h"`
 	}
 
 	Server struct {
@@ -68,6 +183,122 @@ type Config struct {
 		Path     string            `envconfig:"DRONE_RUNNER_PATH"`
 		Root     string            `envconfig:"DRONE_RUNNER_ROOT"`
 		Symlinks map[string]string `envconfig:"DRONE_RUNNER_SYMLINKS"`
+		Plugins  map[string]string `envconfig:"DRONE_RUNNER_PLUGINS"`
+		Hosts    map[string]string `envconfig:"DRONE_RUNNER_HOST_ALIASES"`
+		PortMin  int               `envconfig:"DRONE_RUNNER_PORT_MIN" default:"20000"`
+		PortMax  int               `envconfig:"DRONE_RUNNER_PORT_MAX" default:"29999"`
+		Debug    time.Duration     `envconfig:"DRONE_RUNNER_DEBUG_TIMEOUT"`
+		Accept   time.Duration     `envconfig:"DRONE_RUNNER_ACCEPT_TIMEOUT" default:"5m"`
+		Lease    time.Duration     `envconfig:"DRONE_RUNNER_LEASE_INTERVAL" default:"30s"`
+		Duration time.Duration     `envconfig:"DRONE_RUNNER_MAX_DURATION"`
+		Retries  int               `envconfig:"DRONE_RUNNER_INFRA_RETRIES"`
+
+		PathPrepend []string `envconfig:"DRONE_RUNNER_PATH_PREPEND"`
+		Umask       string   `envconfig:"DRONE_RUNNER_UMASK"`
+		Nice        int      `envconfig:"DRONE_RUNNER_NICE"`
+		IONice      IONice   `envconfig:"DRONE_RUNNER_IONICE"`
+		SELinux     string   `envconfig:"DRONE_RUNNER_SELINUX_CONTEXT"`
+		AppArmor    string   `envconfig:"DRONE_RUNNER_APPARMOR_PROFILE"`
+		Seccomp     string   `envconfig:"DRONE_RUNNER_SECCOMP_PROFILE"`
+
+		Sandbox        string `envconfig:"DRONE_RUNNER_SANDBOX_PROFILE"`
+		SandboxTrusted string `envconfig:"DRONE_RUNNER_SANDBOX_PROFILE_TRUSTED"`
+
+		JobMemory    ByteSize `envconfig:"DRONE_RUNNER_JOB_MEMORY_LIMIT"`
+		JobProcesses int      `envconfig:"DRONE_RUNNER_JOB_PROCESS_LIMIT"`
+		JobCPURate   int      `envconfig:"DRONE_RUNNER_JOB_CPU_RATE"`
+
+		Ulimits    map[string]int64 `envconfig:"DRONE_RUNNER_ULIMITS"`
+		UploadRate ByteRate         `envconfig:"DRONE_RUNNER_UPLOAD_RATE_LIMIT"`
+		Profiles   string           `envconfig:"DRONE_RUNNER_PROFILES_FILE"`
+
+		CredentialHelper bool `envconfig:"DRONE_RUNNER_CREDENTIAL_HELPER"`
+		Summary          bool `envconfig:"DRONE_RUNNER_COST_SUMMARY"`
+
+		Cleanup      string `envconfig:"DRONE_RUNNER_CLEANUP" default:"always"`
+		CleanupLimit int    `envconfig:"DRONE_RUNNER_CLEANUP_LIMIT" default:"10"`
+
+		LabelsSource   string        `envconfig:"DRONE_RUNNER_LABELS_SOURCE"`
+		LabelsInterval time.Duration `envconfig:"DRONE_RUNNER_LABELS_INTERVAL" default:"1m"`
+	}
+
+	Affinity struct {
+		Enabled bool   `envconfig:"DRONE_CPU_AFFINITY_ENABLED"`
+		CPUs    string `envconfig:"DRONE_CPU_AFFINITY_CPUS"`
+		NUMA    bool   `envconfig:"DRONE_CPU_AFFINITY_NUMA"`
+	}
+
+	Poller struct {
+		Interval   time.Duration `envconfig:"DRONE_POLLER_INTERVAL"`
+		Timeout    time.Duration `envconfig:"DRONE_POLLER_TIMEOUT"`
+		BackoffMin time.Duration `envconfig:"DRONE_POLLER_BACKOFF_MIN" default:"1s"`
+		BackoffMax time.Duration `envconfig:"DRONE_POLLER_BACKOFF_MAX" default:"1m"`
+		Burst      bool          `envconfig:"DRONE_POLLER_BURST"`
+	}
+
+	Queue struct {
+		Fair    bool           `envconfig:"DRONE_QUEUE_FAIR"`
+		Backlog int            `envconfig:"DRONE_QUEUE_BACKLOG" default:"2"`
+		Weights map[string]int `envconfig:"DRONE_QUEUE_WEIGHTS"`
+	}
+
+	Offline struct {
+		Enabled  bool          `envconfig:"DRONE_OFFLINE_ENABLED"`
+		Timeout  time.Duration `envconfig:"DRONE_OFFLINE_TIMEOUT" default:"1m"`
+		Interval time.Duration `envconfig:"DRONE_OFFLINE_INTERVAL" default:"10s"`
+		MaxLines int           `envconfig:"DRONE_OFFLINE_MAX_LINES" default:"100000"`
+	}
+
+	Chaos struct {
+		Enabled bool          `envconfig:"DRONE_CHAOS_ENABLED"`
+		Network float64       `envconfig:"DRONE_CHAOS_NETWORK_RATE"`
+		Kill    float64       `envconfig:"DRONE_CHAOS_KILL_RATE"`
+		Disk    float64       `envconfig:"DRONE_CHAOS_DISK_RATE"`
+		Delay   time.Duration `envconfig:"DRONE_CHAOS_KILL_DELAY"`
+		Seed    int64         `envconfig:"DRONE_CHAOS_SEED"`
+	}
+
+	Stream struct {
+		Limit       int           `envconfig:"DRONE_STREAM_LIMIT" default:"5242880"`
+		Buffer      int           `envconfig:"DRONE_STREAM_BUFFER" default:"1048576"`
+		BatchSize   int           `envconfig:"DRONE_STREAM_BATCH_SIZE" default:"500"`
+		MinInterval time.Duration `envconfig:"DRONE_STREAM_INTERVAL_MIN" default:"100ms"`
+		MaxInterval time.Duration `envconfig:"DRONE_STREAM_INTERVAL_MAX" default:"5s"`
+		Timestamps  bool          `envconfig:"DRONE_STREAM_TIMESTAMPS"`
+	}
+
+	Startup struct {
+		Script   string        `envconfig:"DRONE_STARTUP_SCRIPT"`
+		Timeout  time.Duration `envconfig:"DRONE_STARTUP_TIMEOUT" default:"30m"`
+		Required bool          `envconfig:"DRONE_STARTUP_REQUIRED"`
+	}
+
+	Cron struct {
+		File   string `envconfig:"DRONE_CRON_FILE"`
+		LogDir string `envconfig:"DRONE_CRON_LOG_DIR"`
+	}
+
+	LowMemory struct {
+		Enabled bool   `envconfig:"DRONE_LOW_MEMORY"`
+		Spool   string `envconfig:"DRONE_LOW_MEMORY_SPOOL"`
+	}
+
+	Compress struct {
+		Algorithm string `envconfig:"DRONE_COMPRESS_ALGORITHM"`
+		Threshold int    `envconfig:"DRONE_COMPRESS_THRESHOLD" default:"1024"`
+	}
+
+	Metrics struct {
+		Anonymous bool          `envconfig:"DRONE_METRICS_ANONYMOUS"`
+		Summary   time.Duration `envconfig:"DRONE_METRICS_SUMMARY_INTERVAL"`
+	}
+
+	Annotations struct {
+		Endpoint  string   `envconfig:"DRONE_ANNOTATIONS_ENDPOINT"`
+		Token     string   `envconfig:"DRONE_ANNOTATIONS_TOKEN"`
+		Dashboard string   `envconfig:"DRONE_ANNOTATIONS_DASHBOARD_UID"`
+		Tags      []string `envconfig:"DRONE_ANNOTATIONS_TAGS"`
+		Events    []string `envconfig:"DRONE_ANNOTATIONS_EVENTS"`
 	}
 
 	Limit struct {
@@ -76,11 +307,130 @@ type Config struct {
 		Trusted bool     `envconfig:"DRONE_LIMIT_TRUSTED"`
 	}
 
+	StepCache struct {
+		Dir string        `envconfig:"DRONE_STEP_CACHE_DIR"`
+		TTL time.Duration `envconfig:"DRONE_STEP_CACHE_TTL" default:"168h"`
+	}
+
+	Verify struct {
+		Commit         bool   `envconfig:"DRONE_VERIFY_COMMIT"`
+		GPGHome        string `envconfig:"DRONE_VERIFY_GPG_HOME"`
+		AllowedSigners string `envconfig:"DRONE_VERIFY_ALLOWED_SIGNERS"`
+	}
+
+	Worktree struct {
+		Dir string        `envconfig:"DRONE_WORKTREE_DIR"`
+		TTL time.Duration `envconfig:"DRONE_WORKTREE_TTL" default:"168h"`
+	}
+
+	Toolbox struct {
+		Dir string `envconfig:"DRONE_TOOLBOX_DIR"`
+	}
+
+	// Egress configures the egress proxy. Step traffic is
+	// routed through the proxy with the HTTP_PROXY and
+	// HTTPS_PROXY environment variables, and is not
+	// transparently redirected.
+	Egress struct {
+		Proxy     bool   `envconfig:"DRONE_EGRESS_PROXY"`
+		Trusted   bool   `envconfig:"DRONE_EGRESS_PROXY_TRUSTED"`
+		RulesFile string `envconfig:"DRONE_EGRESS_RULES_FILE"`
+	}
+
+	KV struct {
+		Endpoint   string `envconfig:"DRONE_KV_ENDPOINT"`
+		Token      string `envconfig:"DRONE_KV_TOKEN"`
+		SkipVerify bool   `envconfig:"DRONE_KV_SKIP_VERIFY"`
+		Dir        string `envconfig:"DRONE_KV_DIR"`
+	}
+
+	Artifacts struct {
+		URL string `envconfig:"DRONE_ARTIFACTS_URL"`
+	}
+
+	Encryption struct {
+		Key        string `envconfig:"DRONE_ENCRYPTION_KEY"`
+		KeyFile    string `envconfig:"DRONE_ENCRYPTION_KEY_FILE"`
+		KeyCommand string `envconfig:"DRONE_ENCRYPTION_KEY_COMMAND"`
+	}
+
+	Provenance struct {
+		URL       string `envconfig:"DRONE_PROVENANCE_URL"`
+		KeyFile   string `envconfig:"DRONE_PROVENANCE_KEY_FILE"`
+		BuilderID string `envconfig:"DRONE_PROVENANCE_BUILDER_ID"`
+	}
+
+	// History configures the build history database. The
+	// database is accessed with the sqlite3 command line tool,
+	// version 3.33 or later, which must be installed on the
+	// host.
+	History struct {
+		Database string `envconfig:"DRONE_HISTORY_DATABASE"`
+	}
+
+	Events struct {
+		Endpoint string   `envconfig:"DRONE_EVENTS_WEBHOOK_ENDPOINT"`
+		Token    string   `envconfig:"DRONE_EVENTS_WEBHOOK_TOKEN"`
+		Types    []string `envconfig:"DRONE_EVENTS_WEBHOOK_TYPES"`
+		Buffer   int      `envconfig:"DRONE_EVENTS_BUFFER" default:"1000"`
+
+		NATS struct {
+			URL     string   `envconfig:"DRONE_EVENTS_NATS_URL"`
+			Token   string   `envconfig:"DRONE_EVENTS_NATS_TOKEN"`
+			Subject string   `envconfig:"DRONE_EVENTS_NATS_SUBJECT" default:"drone"`
+			Types   []string `envconfig:"DRONE_EVENTS_NATS_TYPES" default:"stage.accepted,stage.completed,step.started,step.completed"`
+		}
+
+		// Kafka configures the kafka publisher. Events are
+		// produced with the http api of a Confluent REST
+		// proxy, and the endpoint is the address of the proxy
+		// rather than of the Kafka brokers.
+		Kafka struct {
+			Endpoint string   `envconfig:"DRONE_EVENTS_KAFKA_ENDPOINT"`
+			Token    string   `envconfig:"DRONE_EVENTS_KAFKA_TOKEN"`
+			Topic    string   `envconfig:"DRONE_EVENTS_KAFKA_TOPIC" default:"drone-events"`
+			Types    []string `envconfig:"DRONE_EVENTS_KAFKA_TYPES" default:"stage.accepted,stage.completed,step.started,step.completed"`
+		}
+	}
+
+	Snapshot struct {
+		Enabled  bool              `envconfig:"DRONE_SNAPSHOT_ENABLED"`
+		Packages bool              `envconfig:"DRONE_SNAPSHOT_PACKAGES" default:"true"`
+		Tools    map[string]string `envconfig:"DRONE_SNAPSHOT_TOOLS"`
+		Dir      string            `envconfig:"DRONE_SNAPSHOT_DIR"`
+	}
+
 	Secret struct {
 		Endpoint   string `envconfig:"DRONE_SECRET_PLUGIN_ENDPOINT"`
 		Token      string `envconfig:"DRONE_SECRET_PLUGIN_TOKEN"`
 		SkipVerify bool   `envconfig:"DRONE_SECRET_PLUGIN_SKIP_VERIFY"`
+
+		Targets map[string]string `envconfig:"DRONE_SECRET_TARGETS"`
+
+		RulesFile    string        `envconfig:"DRONE_SECRET_RULES_FILE"`
+		MetadataFile string        `envconfig:"DRONE_SECRET_METADATA_FILE"`
+		Expiry       time.Duration `envconfig:"DRONE_SECRET_EXPIRY_WARNING" default:"168h"`
 	}
+
+	Profiles []Profile         `ignored:"true"`
+	Tasks    []*cron.Task      `ignored:"true"`
+	Tenants  map[string]string `ignored:"true"`
+
+	Sandbox        *sandbox.Profile `ignored:"true"`
+	SandboxTrusted *sandbox.Profile `ignored:"true"`
+
+	Hosts []*remote.Host `ignored:"true"`
+
+	EgressPolicy *egress.Policy `ignored:"true"`
+	ToolboxPath  string         `ignored:"true"`
+
+	Signer *provenance.Signer `ignored:"true"`
+	Seal   *seal.Key          `ignored:"true"`
+
+	SecretMetadata secretmeta.Provider `ignored:"true"`
+	SecretRules    []*match.SecretRule `ignored:"true"`
+
+	UsageQuotas map[string]usage.Quota `ignored:"true"`
 }
 
 // FromEnviron loads the configuration from the environment.
@@ -105,6 +455,83 @@ func FromEnviron() (Config, error) {
 	if config.Dashboard.Password == "" {
 		config.Dashboard.Disabled = true
 	}
+	if config.LowMemory.Enabled {
+		lowMemory(&config)
+	}
+	// the rpc secret can be sourced from a file, which is
+	// watched for changes to support secret rotation.
+	if path := config.Client.SecretFile; path != "" {
+		file, err := token.Load(path)
+		if err != nil {
+			return config, err
+		}
+		config.Client.Secret = file.Secret()
+	}
+	if level := config.LogHistory.Level; level != "" {
+		if _, err := logrus.ParseLevel(level); err != nil {
+			return config, err
+		}
+	}
+	if config.KV.Endpoint != "" && config.KV.Dir != "" {
+		return config, errors.New("cannot configure both DRONE_KV_ENDPOINT and DRONE_KV_DIR")
+	}
+	for _, rate := range []float64{config.Chaos.Network, config.Chaos.Kill, config.Chaos.Disk} {
+		if rate < 0 || rate > 1 {
+			return config, errors.New("chaos failure rates must be between 0 and 1")
+		}
+	}
+	if config.Artifacts.URL != "" {
+		if _, err := artifact.New(config.Artifacts.URL); err != nil {
+			return config, err
+		}
+	}
+
+	// the key used to encrypt locally persisted build data at
+	// rest is loaded, or decrypted with a key management
+	// service, when the runner starts.
+	if e := config.Encryption; e.Key != "" || e.KeyFile != "" || e.KeyCommand != "" {
+		config.Seal, err = seal.Load(e.Key, e.KeyFile, e.KeyCommand)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	// the provenance signing key is loaded when the runner
+	// starts, and is required to record provenance.
+	if config.Provenance.URL != "" {
+		if config.Provenance.KeyFile == "" {
+			return config, errors.New("required key DRONE_PROVENANCE_KEY_FILE missing value")
+		}
+		config.Signer, err = provenance.LoadSigner(config.Provenance.KeyFile)
+		if err != nil {
+			return config, err
+		}
+		if _, err := provenance.NewSink(config.Provenance.URL, config.Signer.PublicKey()); err != nil {
+			return config, err
+		}
+	}
+	if login := config.Dashboard.OIDC; login.Issuer != "" && (login.ClientID == "" || login.RedirectURL == "") {
+		return config, errors.New("required keys DRONE_UI_OIDC_CLIENT_ID and DRONE_UI_OIDC_REDIRECT_URL missing value")
+	}
+	if config.Update.Auto {
+		if config.Update.Endpoint == "" || config.Update.PublicKey == "" {
+			return config, errors.New("required keys DRONE_UPDATE_ENDPOINT and DRONE_UPDATE_PUBLIC_KEY missing value")
+		}
+		if _, err := update.ParseKey(config.Update.PublicKey); err != nil {
+			return config, err
+		}
+		// older releases cannot be refused if the runner is
+		// not built with a release version.
+		if Version == update.Unknown {
+			return config, errors.New("automatic updates require a runner built with a release version")
+		}
+	}
+	if config.Client.Secret == "" && config.OIDC.Endpoint == "" {
+		return config, errors.New("required key DRONE_RPC_SECRET missing value")
+	}
+	if config.Client.GRPCHost == "" {
+		config.Client.GRPCHost = config.Client.Host
+	}
 	config.Client.Address = fmt.Sprintf(
 		"%s://%s",
 		config.Client.Proto,
@@ -124,18 +551,514 @@ func FromEnviron() (Config, error) {
 		}
 	}
 
+	if umask := config.Runner.Umask; umask != "" {
+		if _, err := strconv.ParseUint(umask, 8, 9); err != nil {
+			return config, fmt.Errorf("invalid umask %q", umask)
+		}
+	}
+
+	if nice := config.Runner.Nice; nice < -20 || nice > 19 {
+		return config, fmt.Errorf("invalid nice level %d", nice)
+	}
+
+	// the dynamic port range must be a valid, non-empty range,
+	// otherwise every pipeline with ports would fail.
+	if min, max := config.Runner.PortMin, config.Runner.PortMax; min < 1 || max > 65535 || min > max {
+		return config, fmt.Errorf("invalid port range %d-%d", min, max)
+	}
+
+	if config.Runner.SELinux != "" || config.Runner.AppArmor != "" {
+		if config.Runner.SELinux != "" && config.Runner.AppArmor != "" {
+			return config, errors.New("cannot configure both DRONE_RUNNER_SELINUX_CONTEXT and DRONE_RUNNER_APPARMOR_PROFILE")
+		}
+		if runtime.GOOS != "linux" {
+			return config, errors.New("selinux and apparmor are only supported on linux")
+		}
+	}
+
+	// the host aliases replace the hosts file of the steps in
+	// a private mount namespace, which requires linux.
+	if len(config.Runner.Hosts) != 0 {
+		if runtime.GOOS != "linux" {
+			return config, errors.New("host aliases are only supported on linux")
+		}
+		for name, ip := range config.Runner.Hosts {
+			if net.ParseIP(ip) == nil {
+				return config, fmt.Errorf("invalid host alias %s:%s", name, ip)
+			}
+		}
+	}
+
+	// the seccomp profile is loaded when the runner starts, so
+	// that an invalid custom profile does not fail every step.
+	if name := config.Runner.Seccomp; name != "" {
+		if runtime.GOOS != "linux" {
+			return config, errors.New("seccomp is only supported on linux")
+		}
+		if _, err := seccomp.Load(name); err != nil {
+			return config, err
+		}
+	}
+
+	// the sandbox profiles are parsed when the runner starts,
+	// and are rendered for each pipeline.
+	if config.Runner.Sandbox != "" || config.Runner.SandboxTrusted != "" {
+		if runtime.GOOS != "darwin" {
+			return config, errors.New("sandbox profiles are only supported on macos")
+		}
+		var err error
+		if name := config.Runner.Sandbox; name != "" {
+			if config.Sandbox, err = sandbox.Load(name); err != nil {
+				return config, fmt.Errorf("cannot load sandbox profile: %s", err)
+			}
+		}
+		if name := config.Runner.SandboxTrusted; name != "" {
+			if config.SandboxTrusted, err = sandbox.Load(name); err != nil {
+				return config, fmt.Errorf("cannot load trusted sandbox profile: %s", err)
+			}
+		}
+	}
+
+	// each stage is optionally executed in an ephemeral jail
+	// cloned from the template snapshot.
+	if config.Jail.Template != "" {
+		if runtime.GOOS != "freebsd" {
+			return config, errors.New("jails are only supported on freebsd")
+		}
+		if !strings.Contains(config.Jail.Template, "@") {
+			return config, errors.New("DRONE_JAIL_TEMPLATE must be a zfs snapshot")
+		}
+		if config.Jail.Dataset == "" {
+			return config, errors.New("DRONE_JAIL_DATASET is required when jails are enabled")
+		}
+		if config.Tenant.File != "" || config.Tenant.Create {
+			return config, errors.New("namespace users are not supported in jails")
+		}
+		if len(config.Runner.Ulimits) != 0 {
+			return config, errors.New("DRONE_RUNNER_ULIMITS is not supported in jails")
+		}
+	}
+
+	// each stage is optionally executed in an ephemeral zone
+	// cloned from the template zone.
+	if config.Zone.Template != "" {
+		if runtime.GOOS != "illumos" && runtime.GOOS != "solaris" {
+			return config, errors.New("zones are only supported on illumos")
+		}
+		if config.Tenant.File != "" || config.Tenant.Create {
+			return config, errors.New("namespace users are not supported in zones")
+		}
+		if len(config.Runner.Ulimits) != 0 {
+			return config, errors.New("DRONE_RUNNER_ULIMITS is not supported in zones")
+		}
+	}
+
+	// the remote hosts are sourced from a separate file. The
+	// features that require the pipeline root on the local
+	// host cannot be used with remote hosts.
+	if path := config.Remote.Hosts; path != "" {
+		hosts, err := remote.Load(path)
+		if err != nil {
+			return config, err
+		}
+		config.Hosts = hosts
+		if err := lintRemote(config); err != nil {
+			return config, err
+		}
+	}
+
+	if config.Runner.JobMemory != 0 || config.Runner.JobProcesses != 0 || config.Runner.JobCPURate != 0 {
+		if runtime.GOOS != "windows" {
+			return config, errors.New("job object limits are only supported on windows")
+		}
+		if config.Runner.JobProcesses < 0 {
+			return config, errors.New("invalid DRONE_RUNNER_JOB_PROCESS_LIMIT")
+		}
+		if rate := config.Runner.JobCPURate; rate < 0 || rate > 100 {
+			return config, errors.New("DRONE_RUNNER_JOB_CPU_RATE must be a percentage between 1 and 100")
+		}
+	}
+
+	if name := config.Compress.Algorithm; name != "" && !compress.Valid(name) {
+		return config, fmt.Errorf("unsupported compression algorithm %q", name)
+	}
+
+	if err := lintUlimits(config.Runner.Ulimits); err != nil {
+		return config, err
+	}
+
 	// setting a custom path is a common configuration
 	// requirement. We therefore provide a configuration
 	// parameter specifically for PATH and then append
 	// to the environment variable list.
+	name, sep := "PATH", ":"
+	if config.Platform.OS == "windows" {
+		name, sep = "Path", ";"
+	}
 	if path := config.Runner.Path; path != "" {
-		switch config.Platform.OS {
-		case "windows":
-			config.Runner.Environ["Path"] = path
-		default:
-			config.Runner.Environ["PATH"] = path
+		config.Runner.Environ[name] = path
+	}
+
+	// the runner-managed tool directories are prepended to
+	// the path, in order, so that hosts can provide hermetic
+	// toolchains without modifying the global profile.
+	if dirs := config.Runner.PathPrepend; len(dirs) != 0 {
+		path := config.Runner.Path
+		if path == "" {
+			path = os.Getenv(name)
+		}
+		config.Runner.Environ[name] = prependPath(dirs, path, sep)
+	}
+
+	// named runner profiles can be sourced from a separate
+	// file, since profiles cannot be expressed as flat
+	// environment variables.
+	if path := config.Runner.Profiles; path != "" {
+		profiles, err := loadProfiles(path)
+		if err != nil {
+			return config, err
+		}
+		config.Profiles = profiles
+		if err := lintProfiles(config); err != nil {
+			return config, err
+		}
+	}
+
+	// the mapping of repository namespaces to operating system
+	// users is sourced from a separate file.
+	if path := config.Tenant.File; path != "" {
+		users, err := tenant.Load(path)
+		if err != nil {
+			return config, err
+		}
+		config.Tenants = users
+	}
+	if (config.Tenant.File != "" || config.Tenant.Create) && runtime.GOOS == "windows" {
+		return config, errors.New("namespace users are not supported on windows")
+	}
+
+	// the cpus are partitioned into the cpu sets of the stages
+	// when the runner starts.
+	if config.Affinity.Enabled {
+		if runtime.GOOS != "linux" {
+			return config, errors.New("cpu affinity is only supported on linux")
+		}
+		if cpus := config.Affinity.CPUs; cpus != "" {
+			if _, err := affinity.Parse(cpus); err != nil {
+				return config, fmt.Errorf("invalid DRONE_CPU_AFFINITY_CPUS: %s", err)
+			}
+		}
+	}
+
+	// the quotas of execution time are configured in minutes
+	// per month, keyed by namespace, and the default quota is
+	// keyed by an asterisk.
+	config.UsageQuotas = map[string]usage.Quota{}
+	for namespace, minutes := range config.Usage.SoftQuotas {
+		if minutes < 1 {
+			return config, fmt.Errorf("DRONE_USAGE_SOFT_QUOTAS: invalid quota for namespace %s", namespace)
+		}
+		quota := config.UsageQuotas[namespace]
+		quota.Soft = time.Duration(minutes) * time.Minute
+		config.UsageQuotas[namespace] = quota
+	}
+	for namespace, minutes := range config.Usage.HardQuotas {
+		if minutes < 1 {
+			return config, fmt.Errorf("DRONE_USAGE_HARD_QUOTAS: invalid quota for namespace %s", namespace)
+		}
+		quota := config.UsageQuotas[namespace]
+		quota.Hard = time.Duration(minutes) * time.Minute
+		config.UsageQuotas[namespace] = quota
+	}
+
+	// the host sensors are only read on linux.
+	if config.Throttle.Enabled {
+		if runtime.GOOS != "linux" {
+			return config, errors.New("throttling is only supported on linux")
+		}
+		if config.Throttle.Interval <= 0 {
+			return config, errors.New("DRONE_THROTTLE_INTERVAL must be greater than zero")
+		}
+		if config.Throttle.Resume > config.Throttle.Temperature {
+			return config, errors.New("DRONE_THROTTLE_RESUME_TEMPERATURE must not exceed DRONE_THROTTLE_TEMPERATURE")
+		}
+		if config.Throttle.Battery < 0 || config.Throttle.Battery > 100 {
+			return config, errors.New("DRONE_THROTTLE_BATTERY must be a percentage between 0 and 100")
+		}
+		if config.Throttle.Capacity < 0 {
+			return config, errors.New("DRONE_THROTTLE_CAPACITY must not be negative")
+		}
+	}
+
+	// the keys used to verify commit signatures must exist
+	// when the runner starts.
+	if path := config.Verify.GPGHome; path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return config, fmt.Errorf("invalid DRONE_VERIFY_GPG_HOME: %s", err)
+		}
+	}
+	if path := config.Verify.AllowedSigners; path != "" {
+		if _, err := os.Stat(path); err != nil {
+			return config, fmt.Errorf("invalid DRONE_VERIFY_ALLOWED_SIGNERS: %s", err)
+		}
+	}
+
+	// the base clones are shared by the stages of a repository,
+	// and must be writable by the step processes.
+	if config.Worktree.Dir != "" {
+		if config.Tenant.File != "" || config.Tenant.Create {
+			return config, errors.New("DRONE_WORKTREE_DIR is not supported with namespace users")
+		}
+		if config.Jail.Template != "" || config.Zone.Template != "" {
+			return config, errors.New("DRONE_WORKTREE_DIR is not supported in jails and zones")
+		}
+		if config.Sandbox != nil || config.SandboxTrusted != nil {
+			return config, errors.New("DRONE_WORKTREE_DIR is not supported with sandbox profiles")
+		}
+	}
+
+	// the rules restricting the builds that can resolve secrets
+	// are sourced from a separate file.
+	if path := config.Secret.RulesFile; path != "" {
+		config.SecretRules, err = match.LoadSecretRules(path)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	// the toolbox of the runner version is verified when the
+	// runner starts, so that an incomplete toolbox does not
+	// fail every build.
+	if root := config.Toolbox.Dir; root != "" {
+		if config.Jail.Template != "" || config.Zone.Template != "" {
+			return config, errors.New("DRONE_TOOLBOX_DIR is not supported in jails and zones")
+		}
+		config.ToolboxPath, err = toolbox.Open(root, Version)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	// the egress allowlists are sourced from a separate file.
+	// If the proxy is enabled without rules, outbound requests
+	// are denied, other than to the git server. The proxy is
+	// enforced by the proxy environment variables only, and
+	// traffic is not transparently redirected to the proxy.
+	if config.Egress.Proxy {
+		config.EgressPolicy = &egress.Policy{Trusted: config.Egress.Trusted}
+		if path := config.Egress.RulesFile; path != "" {
+			config.EgressPolicy.Rules, err = egress.LoadRules(path)
+			if err != nil {
+				return config, err
+			}
+		}
+	} else if config.Egress.RulesFile != "" {
+		return config, errors.New("DRONE_EGRESS_RULES_FILE requires DRONE_EGRESS_PROXY")
+	}
+
+	// the expiry and rotation metadata of secrets is sourced
+	// from a separate file.
+	if path := config.Secret.MetadataFile; path != "" {
+		config.SecretMetadata, err = secretmeta.Load(path)
+		if err != nil {
+			return config, err
+		}
+	}
+
+	// the fair queue requests stages in excess of the capacity,
+	// and the namespace weights are relative shares of the
+	// capacity.
+	if config.Queue.Fair {
+		if config.Queue.Backlog < 1 {
+			return config, errors.New("DRONE_QUEUE_BACKLOG must be greater than zero")
 		}
+		for namespace, weight := range config.Queue.Weights {
+			if weight < 1 {
+				return config, fmt.Errorf("DRONE_QUEUE_WEIGHTS: invalid weight for namespace %s", namespace)
+			}
+		}
+	}
+
+	// scheduled maintenance tasks are sourced from a separate
+	// file, and are validated when the runner starts.
+	if path := config.Cron.File; path != "" {
+		tasks, err := cron.Load(path)
+		if err != nil {
+			return config, err
+		}
+		config.Tasks = tasks
 	}
 
 	return config, nil
 }
+
+// helper function returns an error if the ulimits are not
+// supported or invalid.
+func lintUlimits(ulimits map[string]int64) error {
+	for name, value := range ulimits {
+		switch name {
+		case resource.UlimitCore, resource.UlimitNofile, resource.UlimitNproc:
+		default:
+			return fmt.Errorf("unsupported ulimit %q", name)
+		}
+		if value < 0 {
+			return fmt.Errorf("invalid ulimit %s=%d", name, value)
+		}
+	}
+	return nil
+}
+
+// helper function prepends the directories to the path list.
+// Empty and duplicate directories are removed, such that the
+// prepended directories take precedence.
+func prependPath(dirs []string, path, sep string) string {
+	var list []string
+	seen := map[string]struct{}{}
+	all := append([]string(nil), dirs...)
+	all = append(all, strings.Split(path, sep)...)
+	for _, dir := range all {
+		dir = strings.TrimSpace(dir)
+		if dir == "" {
+			continue
+		}
+		if _, ok := seen[dir]; ok {
+			continue
+		}
+		seen[dir] = struct{}{}
+		list = append(list, dir)
+	}
+	return strings.Join(list, sep)
+}
+
+// helper function returns an error if the configuration uses
+// a feature that is not supported with remote hosts.
+func lintRemote(config Config) error {
+	var unsupported []string
+	if runtime.GOOS == "windows" {
+		return errors.New("remote hosts are not supported on windows")
+	}
+	if config.Tenant.File != "" || config.Tenant.Create {
+		unsupported = append(unsupported, "namespace users")
+	}
+	if config.Jail.Template != "" || config.Zone.Template != "" {
+		unsupported = append(unsupported, "jails and zones")
+	}
+	if len(config.Runner.Ulimits) != 0 || config.Runner.Seccomp != "" {
+		unsupported = append(unsupported, "ulimits and seccomp profiles")
+	}
+	if config.Runner.SELinux != "" || config.Runner.AppArmor != "" || config.Sandbox != nil || config.SandboxTrusted != nil {
+		unsupported = append(unsupported, "security profiles")
+	}
+	if config.Runner.CredentialHelper {
+		unsupported = append(unsupported, "the credential helper")
+	}
+	if config.Runner.Debug > 0 {
+		unsupported = append(unsupported, "debug sessions")
+	}
+	if config.Artifacts.URL != "" {
+		unsupported = append(unsupported, "artifacts")
+	}
+	if config.Worktree.Dir != "" {
+		unsupported = append(unsupported, "worktree workspaces")
+	}
+	if config.Verify.Commit || config.Verify.GPGHome != "" || config.Verify.AllowedSigners != "" {
+		unsupported = append(unsupported, "checkout verification")
+	}
+	if config.Egress.Proxy {
+		unsupported = append(unsupported, "the egress proxy")
+	}
+	if len(config.Runner.Hosts) != 0 {
+		unsupported = append(unsupported, "host aliases")
+	}
+	if config.Toolbox.Dir != "" {
+		unsupported = append(unsupported, "the toolbox")
+	}
+	if len(unsupported) != 0 {
+		return fmt.Errorf("remote hosts do not support %s", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// ByteRate defines a bandwidth limit in bytes per second. The
+// value is parsed from a human readable size, with an optional
+// per second suffix (e.g. 512kB, 10MB/s).
+type ByteRate int64
+
+// Decode implements the envconfig decoder interface.
+func (r *ByteRate) Decode(value string) error {
+	v, err := units.FromHumanSize(strings.TrimSuffix(value, "/s"))
+	if err != nil || v <= 0 {
+		return fmt.Errorf("invalid rate limit %q", value)
+	}
+	*r = ByteRate(v)
+	return nil
+}
+
+// ByteSize defines a size in bytes. The value is parsed from a
+// human readable size (e.g. 512MB, 4GB).
+type ByteSize int64
+
+// Decode implements the envconfig decoder interface.
+func (s *ByteSize) Decode(value string) error {
+	v, err := units.RAMInBytes(value)
+	if err != nil || v <= 0 {
+		return fmt.Errorf("invalid size %q", value)
+	}
+	*s = ByteSize(v)
+	return nil
+}
+
+// IONice defines the io scheduling class and level. The value
+// is parsed from the class name, with an optional level (e.g.
+// idle, best-effort:7).
+type IONice struct {
+	Class int
+	Level int
+}
+
+// io scheduling classes, see ionice(1)
+var ioClasses = map[string]int{
+	"realtime":    1,
+	"best-effort": 2,
+	"idle":        3,
+}
+
+// Decode implements the envconfig decoder interface.
+func (n *IONice) Decode(value string) error {
+	name, level := value, ""
+	if i := strings.IndexByte(value, ':'); i != -1 {
+		name, level = value[:i], value[i+1:]
+	}
+	class, ok := ioClasses[name]
+	if !ok {
+		return fmt.Errorf("invalid io scheduling class %q", name)
+	}
+	n.Class = class
+	if level == "" {
+		return nil
+	}
+	v, err := strconv.Atoi(level)
+	if err != nil || v < 0 || v > 7 {
+		return fmt.Errorf("invalid io scheduling level %q", level)
+	}
+	n.Level = v
+	return nil
+}
+
+// helper function reduces the memory footprint of the runner
+// for hosts with limited memory, such as single board computers.
+// Values explicitly set in the environment take precedence.
+func lowMemory(config *Config) {
+	if os.Getenv("DRONE_STREAM_LIMIT") == "" {
+		config.Stream.Limit = 1048576 // 1MB
+	}
+	if os.Getenv("DRONE_STREAM_BUFFER") == "" {
+		config.Stream.Buffer = 65536 // 64KB
+	}
+	if os.Getenv("DRONE_STREAM_BATCH_SIZE") == "" {
+		config.Stream.BatchSize = 100
+	}
+	if os.Getenv("DRONE_OFFLINE_MAX_LINES") == "" {
+		config.Offline.MaxLines = 10000
+	}
+}
@@ -3,3 +3,164 @@
 // that can be found in the LICENSE file.
 
 package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFromEnviron_SecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	ioutil.WriteFile(path, []byte("correct-horse\n"), 0600)
+
+	os.Setenv("DRONE_RPC_HOST", "drone.company.com")
+	os.Setenv("DRONE_RPC_SECRET_FILE", path)
+	defer os.Unsetenv("DRONE_RPC_HOST")
+	defer os.Unsetenv("DRONE_RPC_SECRET_FILE")
+
+	config, err := FromEnviron()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := config.Client.Secret, "correct-horse"; got != want {
+		t.Errorf("Want secret %q loaded from file, got %q", want, got)
+	}
+
+	os.Unsetenv("DRONE_RPC_SECRET_FILE")
+	if _, err := FromEnviron(); err == nil {
+		t.Errorf("Expect error when secret missing")
+	}
+}
+
+func TestFromEnviron_PathPrepend(t *testing.T) {
+	os.Setenv("DRONE_RPC_HOST", "drone.company.com")
+	os.Setenv("DRONE_RPC_SECRET", "correct-horse")
+	os.Setenv("DRONE_RUNNER_PATH", "/usr/local/bin:/usr/bin")
+	os.Setenv("DRONE_RUNNER_PATH_PREPEND", "/opt/go/bin,/opt/node/bin,/usr/bin")
+	defer os.Unsetenv("DRONE_RPC_HOST")
+	defer os.Unsetenv("DRONE_RPC_SECRET")
+	defer os.Unsetenv("DRONE_RUNNER_PATH")
+	defer os.Unsetenv("DRONE_RUNNER_PATH_PREPEND")
+
+	config, err := FromEnviron()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := config.Runner.Environ["PATH"]
+	want := "/opt/go/bin:/opt/node/bin:/usr/bin:/usr/local/bin"
+	if config.Platform.OS != "windows" && got != want {
+		t.Errorf("Want path %q, got %q", want, got)
+	}
+}
+
+func Test_prependPath(t *testing.T) {
+	got := prependPath([]string{`C:\go\bin`, ""}, `C:\Windows;;C:\go\bin`, ";")
+	if want := `C:\go\bin;C:\Windows`; got != want {
+		t.Errorf("Want path %q, got %q", want, got)
+	}
+}
+
+func TestIONice(t *testing.T) {
+	tests := []struct {
+		value string
+		want  IONice
+		err   bool
+	}{
+		{value: "idle", want: IONice{Class: 3}},
+		{value: "best-effort:7", want: IONice{Class: 2, Level: 7}},
+		{value: "best-effort:8", err: true},
+		{value: "lowest", err: true},
+	}
+	for _, test := range tests {
+		var got IONice
+		err := got.Decode(test.value)
+		if test.err != (err != nil) {
+			t.Errorf("Unexpected error %v decoding %q", err, test.value)
+		}
+		if !test.err && got != test.want {
+			t.Errorf("Want %+v decoding %q, got %+v", test.want, test.value, got)
+		}
+	}
+}
+
+func TestByteRate(t *testing.T) {
+	var r ByteRate
+	if err := r.Decode("10MB/s"); err != nil || r != 10000000 {
+		t.Errorf("Want 10MB/s decoded, got %d, %v", r, err)
+	}
+	if err := r.Decode("512kB"); err != nil || r != 512000 {
+		t.Errorf("Want 512kB decoded, got %d, %v", r, err)
+	}
+	if err := r.Decode("fast"); err == nil {
+		t.Errorf("Expect error when rate invalid")
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	var s ByteSize
+	if err := s.Decode("512MB"); err != nil || s != 512*1024*1024 {
+		t.Errorf("Want 512MB decoded, got %d, %v", s, err)
+	}
+	if err := s.Decode("large"); err == nil {
+		t.Errorf("Expect error when size invalid")
+	}
+}
+
+func TestFromEnviron_PortRange(t *testing.T) {
+	os.Setenv("DRONE_RPC_HOST", "drone.company.com")
+	os.Setenv("DRONE_RPC_SECRET", "correct-horse")
+	defer os.Unsetenv("DRONE_RPC_HOST")
+	defer os.Unsetenv("DRONE_RPC_SECRET")
+	defer os.Unsetenv("DRONE_RUNNER_PORT_MIN")
+	defer os.Unsetenv("DRONE_RUNNER_PORT_MAX")
+
+	tests := []struct {
+		min, max string
+		valid    bool
+	}{
+		{"20000", "29999", true},
+		{"8080", "8080", true},
+		{"1", "65535", true},
+		{"0", "100", false},
+		{"30000", "20000", false},
+		{"60000", "70000", false},
+	}
+	for _, test := range tests {
+		os.Setenv("DRONE_RUNNER_PORT_MIN", test.min)
+		os.Setenv("DRONE_RUNNER_PORT_MAX", test.max)
+		_, err := FromEnviron()
+		if test.valid && err != nil {
+			t.Errorf("Want port range %s-%s valid, got %s", test.min, test.max, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("Want error for port range %s-%s", test.min, test.max)
+		}
+	}
+}
+
+func TestFromEnviron_LowMemory(t *testing.T) {
+	os.Setenv("DRONE_RPC_HOST", "drone.company.com")
+	os.Setenv("DRONE_RPC_SECRET", "correct-horse")
+	os.Setenv("DRONE_LOW_MEMORY", "true")
+	os.Setenv("DRONE_STREAM_BATCH_SIZE", "50")
+	defer os.Unsetenv("DRONE_RPC_HOST")
+	defer os.Unsetenv("DRONE_RPC_SECRET")
+	defer os.Unsetenv("DRONE_LOW_MEMORY")
+	defer os.Unsetenv("DRONE_STREAM_BATCH_SIZE")
+
+	config, err := FromEnviron()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := config.Stream.Limit, 1048576; got != want {
+		t.Errorf("Want stream limit %d, got %d", want, got)
+	}
+	if got, want := config.Offline.MaxLines, 10000; got != want {
+		t.Errorf("Want offline max lines %d, got %d", want, got)
+	}
+	if got, want := config.Stream.BatchSize, 50; got != want {
+		t.Errorf("Want explicit batch size %d preserved, got %d", want, got)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/cron"
+	"github.com/drone-runners/drone-runner-exec/internal/metrics"
+
+	"github.com/drone/runner-go/shell"
+
+	"github.com/sirupsen/logrus"
+)
+
+// helper function runs the scheduled maintenance task with the
+// host shell, and with the runner environment. The task output
+// is written to the runner logs, and is optionally appended to
+// a per-task log file.
+func runTask(ctx context.Context, config Config, task *cron.Task) error {
+	log := logrus.WithField("task", task.Name)
+	log.Debugln("running the scheduled task")
+
+	file, err := ioutil.TempFile("", "drone-task-*"+shell.Suffix)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(shell.Script([]string{task.Command}))
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	logs := log.Writer()
+	defer logs.Close()
+	var output io.Writer = logs
+	if dir := config.Cron.LogDir; dir != "" {
+		path := filepath.Join(dir, task.Name+".log")
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(f, "--- %s\n", time.Now().Format(time.RFC3339))
+		output = io.MultiWriter(logs, f)
+	}
+
+	start := time.Now()
+	err = runScript(ctx, file.Name(), config.Runner.Environ, task.Timeout, output)
+	status := "success"
+	if err != nil {
+		status = "failure"
+	}
+	metrics.TaskDuration.Observe(time.Since(start), nil, task.Name, status)
+	return err
+}
@@ -8,17 +8,51 @@ package daemon
 
 import (
 	"context"
+	"net"
+	"net/http"
+	"os"
 	"time"
 
+	"github.com/drone-runners/drone-runner-exec/daemon/admin"
 	"github.com/drone-runners/drone-runner-exec/engine"
+	remoteengine "github.com/drone-runners/drone-runner-exec/engine/remote"
 	"github.com/drone-runners/drone-runner-exec/engine/resource"
+	"github.com/drone-runners/drone-runner-exec/internal/affinity"
+	"github.com/drone-runners/drone-runner-exec/internal/annotation"
+	"github.com/drone-runners/drone-runner-exec/internal/archive"
+	"github.com/drone-runners/drone-runner-exec/internal/artifact"
+	"github.com/drone-runners/drone-runner-exec/internal/chaos"
+	"github.com/drone-runners/drone-runner-exec/internal/compress"
+	"github.com/drone-runners/drone-runner-exec/internal/cron"
+	"github.com/drone-runners/drone-runner-exec/internal/kv"
+	"github.com/drone-runners/drone-runner-exec/internal/labels"
+	"github.com/drone-runners/drone-runner-exec/internal/livelog"
+	"github.com/drone-runners/drone-runner-exec/internal/machine"
 	"github.com/drone-runners/drone-runner-exec/internal/match"
+	"github.com/drone-runners/drone-runner-exec/internal/metrics"
+	"github.com/drone-runners/drone-runner-exec/internal/offline"
+	"github.com/drone-runners/drone-runner-exec/internal/oidc"
+	"github.com/drone-runners/drone-runner-exec/internal/port"
+	"github.com/drone-runners/drone-runner-exec/internal/provenance"
+	"github.com/drone-runners/drone-runner-exec/internal/ratelimit"
+	remotehost "github.com/drone-runners/drone-runner-exec/internal/remote"
+	"github.com/drone-runners/drone-runner-exec/internal/rpc"
+	"github.com/drone-runners/drone-runner-exec/internal/snapshot"
+	"github.com/drone-runners/drone-runner-exec/internal/sso"
+	"github.com/drone-runners/drone-runner-exec/internal/stepcache"
+	"github.com/drone-runners/drone-runner-exec/internal/tenant"
+	"github.com/drone-runners/drone-runner-exec/internal/thermal"
+	"github.com/drone-runners/drone-runner-exec/internal/timestamp"
+	"github.com/drone-runners/drone-runner-exec/internal/token"
+	"github.com/drone-runners/drone-runner-exec/internal/usage"
 	"github.com/drone-runners/drone-runner-exec/runtime"
+	"github.com/drone-runners/drone-runner-exec/runtime/event"
 
 	"github.com/drone/runner-go/client"
 	"github.com/drone/runner-go/handler/router"
 	"github.com/drone/runner-go/logger"
 	loghistory "github.com/drone/runner-go/logger/history"
+	"github.com/drone/runner-go/pipeline"
 	"github.com/drone/runner-go/pipeline/history"
 	"github.com/drone/runner-go/pipeline/remote"
 	"github.com/drone/runner-go/secret"
@@ -27,8 +61,24 @@ import (
 	"github.com/orandin/lumberjackrus"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
 )
 
+// middleware wraps the execution of pipeline steps.
+var middleware []runtime.Middleware
+
+// Events publishes pipeline lifecycle events. Custom runner
+// binaries may subscribe to the events before the daemon
+// starts.
+var Events = event.New()
+
+// Use registers middleware that wraps the execution of pipeline
+// steps. Use allows custom runner binaries to add behavior to
+// pipeline steps, and must be called before the daemon starts.
+func Use(m ...runtime.Middleware) {
+	middleware = append(middleware, m...)
+}
+
 // Run runs the service and blocks until complete.
 func Run(ctx context.Context, config Config) error {
 	setupLogger(config)
@@ -49,57 +99,699 @@ func Run(ctx context.Context, config Config) error {
 		),
 	)
 
+	// the rpc secret is optionally reloaded when the secret
+	// file changes, or is obtained from an oidc provider, so
+	// the secret can be rotated without restart.
+	var secretFunc func() string
+	switch {
+	case config.OIDC.Endpoint != "":
+		source := oidc.New(oidc.Config{
+			TokenFile:    config.OIDC.TokenFile,
+			TokenURL:     config.OIDC.TokenURL,
+			TokenHeaders: config.OIDC.TokenHeaders,
+			Endpoint:     config.OIDC.Endpoint,
+			Audience:     config.OIDC.Audience,
+		})
+		if err := source.Refresh(ctx); err != nil {
+			logrus.WithError(err).
+				Errorln("cannot obtain the rpc token")
+			return err
+		}
+		go source.Run(ctx)
+		secretFunc = source.Secret
+	case config.Client.SecretFile != "":
+		file, err := token.Load(config.Client.SecretFile)
+		if err != nil {
+			logrus.WithError(err).
+				Errorln("cannot load the rpc secret file")
+			return err
+		}
+		go file.Watch(ctx, config.Client.SecretInterval)
+		secretFunc = file.Secret
+	default:
+		secretFunc = func() string { return config.Client.Secret }
+	}
+	// optionally limit the bandwidth of runner to server
+	// traffic, so that log uploads do not saturate the uplink.
+	// The limit is shared by the http and grpc connections.
+	var dialOpts []grpc.DialOption
+	if rate := config.Runner.UploadRate; rate > 0 {
+		limiter := ratelimit.New(int64(rate))
+		wrapTransport(cli, func(base http.RoundTripper) http.RoundTripper {
+			return ratelimit.Transport(base, limiter)
+		})
+		dial := ratelimit.Dialer(limiter)
+		dialOpts = append(dialOpts, grpc.WithContextDialer(
+			func(ctx context.Context, address string) (net.Conn, error) {
+				return dial(ctx, "tcp", address)
+			},
+		))
+	}
+
+	if config.OIDC.Endpoint != "" || config.Client.SecretFile != "" {
+		wrapTransport(cli, func(base http.RoundTripper) http.RoundTripper {
+			return token.Transport(base, secretFunc)
+		})
+	}
+
+	// optionally compress log uploads that exceed the
+	// threshold, if accepted by the server.
+	if config.Compress.Algorithm != "" {
+		wrapTransport(cli, func(base http.RoundTripper) http.RoundTripper {
+			return &compress.Transport{
+				Base:      base,
+				Algorithm: config.Compress.Algorithm,
+				Threshold: config.Compress.Threshold,
+			}
+		})
+	}
+
+	// optionally use the grpc transport for stage assignment
+	// and log upload, falling back to the http client if the
+	// server does not support grpc.
+	var transport client.Client = cli
+	if config.Client.Transport == "grpc" {
+		conn, err := rpc.Dial(
+			config.Client.GRPCHost,
+			secretFunc,
+			config.Client.Proto == "https",
+			config.Client.SkipVerify,
+			cli,
+			dialOpts...,
+		)
+		if err != nil {
+			logrus.WithError(err).
+				Errorln("cannot create the grpc transport")
+			return err
+		}
+		defer conn.Close()
+		conn.Compressor = config.Compress.Algorithm
+		conn.Threshold = config.Compress.Threshold
+		transport = conn
+	}
+
+	// chaos mode optionally injects simulated failures, to
+	// verify the recovery behavior of the runner.
+	chaosConfig := chaos.Config{
+		Network: config.Chaos.Network,
+		Kill:    config.Chaos.Kill,
+		Disk:    config.Chaos.Disk,
+		Delay:   config.Chaos.Delay,
+		Seed:    config.Chaos.Seed,
+	}
+	if config.Chaos.Enabled {
+		logrus.Warnln("chaos mode enabled, simulating failures")
+		transport = chaos.NewClient(transport, chaosConfig)
+	}
+
+	// optionally buffer stage results and logs while the
+	// server is unreachable, so that accepted stages are not
+	// failed by transient server outages.
+	if config.Offline.Enabled {
+		transport = offline.New(transport, offline.Config{
+			Machine:  config.Runner.Name,
+			Timeout:  config.Offline.Timeout,
+			Interval: config.Offline.Interval,
+			MaxLines: config.Offline.MaxLines,
+		})
+	}
+
 	engine := engine.New()
-	remote := remote.New(cli)
+
+	// stages are optionally executed on a pool of remote hosts,
+	// selected by the stage labels.
+	var hosts *remotehost.Pool
+	if len(config.Hosts) != 0 {
+		hosts = remotehost.NewPool(config.Hosts, config.Remote.MaxFailures)
+		engine = remoteengine.New(engine, hosts, remoteengine.Dial)
+
+		// hosts that fail the health check are excluded from
+		// scheduling until the next successful check.
+		if config.Remote.Health > 0 {
+			go hosts.Monitor(ctx, config.Remote.Health, remoteengine.Check(remoteengine.Dial))
+		}
+	}
+	if config.Chaos.Enabled {
+		engine = chaos.NewEngine(engine, chaosConfig)
+	}
+	workspaces := runtime.NewWorkspaces(
+		engine,
+		config.Runner.Cleanup,
+		config.Runner.CleanupLimit,
+	)
+	gates := runtime.NewGates()
+
+	// stages and repositories are marked for debugging with
+	// the administration api, if debug sessions are enabled.
+	var debugs *runtime.Debugs
+	if config.Runner.Debug > 0 {
+		debugs = runtime.NewDebugs()
+	}
+
+	// the processes of running steps are tracked, so that the
+	// dashboard can report their resource usage.
+	processes := runtime.NewProcesses()
+	steps := []runtime.Middleware{}
+	steps = append(steps, middleware...)
+	steps = append(steps, processes.Middleware())
+
+	remote := remote.New(transport)
 	tracer := history.New(remote)
-	hook := loghistory.New()
-	logrus.AddHook(hook)
 
-	poller := &runtime.Poller{
-		Client: cli,
-		Runner: &runtime.Runner{
-			Client:   cli,
-			Environ:  config.Runner.Environ,
-			Machine:  config.Runner.Name,
-			Root:     config.Runner.Root,
-			Symlinks: config.Runner.Symlinks,
-			Reporter: tracer,
-			Match: match.Func(
-				config.Limit.Repos,
-				config.Limit.Events,
-				config.Limit.Trusted,
-			),
-			Secret: secret.External(
-				config.Secret.Endpoint,
-				config.Secret.Token,
-				config.Secret.SkipVerify,
-			),
-			Execer: runtime.NewExecer(
-				tracer,
-				remote,
-				engine,
-				config.Runner.Procs,
-			),
-		},
-		Filter: &client.Filter{
-			Kind:    resource.Kind,
-			Type:    resource.Type,
-			OS:      config.Platform.OS,
-			Arch:    config.Platform.Arch,
-			Variant: config.Platform.Variant,
-			Kernel:  config.Platform.Kernel,
-			Labels:  config.Runner.Labels,
-		},
+	// step logs are streamed in batches on a dedicated
+	// goroutine per step, with bounded memory. The uploaded
+	// logs are recorded for preserved workspaces, so that the
+	// output of re-run steps is appended to the step log.
+	var streamer pipeline.Streamer = livelog.NewStreamer(workspaces.Client(transport), livelog.Config{
+		Limit:       config.Stream.Limit,
+		Buffer:      config.Stream.Buffer,
+		BatchSize:   config.Stream.BatchSize,
+		MinInterval: config.Stream.MinInterval,
+		MaxInterval: config.Stream.MaxInterval,
+		Spool:       config.LowMemory.Enabled,
+		Dir:         config.LowMemory.Spool,
+		Key:         config.Seal,
+	})
+	// step log lines are optionally prefixed with the time
+	// the line was written and the elapsed step time. Events
+	// carry the elapsed time as structured metadata instead.
+	if config.Stream.Timestamps {
+		streamer = timestamp.NewStreamer(streamer)
+	}
+	streamer = event.NewStreamer(streamer, Events)
+	// the dashboard log history is disabled in low memory
+	// mode, since the logs are retained in memory.
+	hook := loghistory.NewLimit(config.LogHistory.Capacity)
+	if !config.LowMemory.Enabled {
+		logrus.AddHook(newHistoryHook(hook, config.LogHistory.Level))
 	}
 
-	var g errgroup.Group
-	server := server.Server{
-		Addr: config.Server.Port,
-		Handler: router.New(tracer, hook, router.Config{
+	// optionally emit stage events as annotations to the
+	// operational dashboards.
+	var reporter pipeline.Reporter = tracer
+	if config.Annotations.Endpoint != "" {
+		reporter = annotation.New(tracer, annotation.Config{
+			Endpoint:  config.Annotations.Endpoint,
+			Token:     config.Annotations.Token,
+			Dashboard: config.Annotations.Dashboard,
+			Tags:      config.Annotations.Tags,
+			Events:    config.Annotations.Events,
+		})
+	}
+	reporter = event.NewReporter(reporter, Events)
+
+	// completed stage summaries are optionally persisted, so
+	// that the dashboard history survives a restart.
+	var archives archive.Store
+	if path := config.History.Database; path != "" {
+		store, err := archive.SQLite(path)
+		if err != nil {
+			logrus.WithError(err).
+				WithField("database", path).
+				Errorln("cannot open the history database")
+			return err
+		}
+		archives = store
+		reporter = archive.NewReporter(reporter, archives)
+	}
+
+	// lifecycle events are optionally posted to a webhook.
+	if config.Events.Endpoint != "" {
+		events, cancel := Events.Subscribe(config.Events.Buffer)
+		defer cancel()
+		go event.Webhook(ctx, events,
+			config.Events.Endpoint,
+			config.Events.Token,
+			config.Events.Types,
+		)
+	}
+
+	// lifecycle events are optionally streamed to nats or kafka
+	// for downstream analytics and deployment orchestration.
+	if config.Events.NATS.URL != "" {
+		events, cancel := Events.Subscribe(config.Events.Buffer)
+		defer cancel()
+		go event.NATS(ctx, events, event.NATSConfig{
+			URL:     config.Events.NATS.URL,
+			Token:   config.Events.NATS.Token,
+			Subject: config.Events.NATS.Subject,
+			Types:   config.Events.NATS.Types,
+		})
+	}
+	if config.Events.Kafka.Endpoint != "" {
+		events, cancel := Events.Subscribe(config.Events.Buffer)
+		defer cancel()
+		go event.Kafka(ctx, events, event.KafkaConfig{
+			Endpoint: config.Events.Kafka.Endpoint,
+			Token:    config.Events.Kafka.Token,
+			Topic:    config.Events.Kafka.Topic,
+			Types:    config.Events.Kafka.Types,
+		})
+	}
+
+	// the platform version defaults to the host operating
+	// system version (the distribution version on linux).
+	host := machine.Gather()
+	version := config.Platform.Version
+	if version == "" {
+		version = host.OSVersion
+	}
+
+	// values exported by a stage are optionally published to
+	// a shared store, for consumption by dependent stages.
+	var store kv.Store
+	switch {
+	case config.KV.Endpoint != "":
+		store = kv.HTTP(config.KV.Endpoint, config.KV.Token, config.KV.SkipVerify)
+	case config.KV.Dir != "" && config.Seal != nil:
+		store = kv.EncryptedDir(config.KV.Dir, config.Seal)
+	case config.KV.Dir != "":
+		store = kv.Dir(config.KV.Dir)
+	}
+
+	// artifacts produced by a stage are optionally handed off
+	// to dependent stages using the configured backend.
+	var artifacts artifact.Backend
+	if config.Artifacts.URL != "" {
+		artifacts, _ = artifact.New(config.Artifacts.URL)
+	}
+
+	// the signed provenance of each stage is optionally
+	// recorded once the stage completes.
+	var recorder *provenance.Recorder
+	if config.Provenance.URL != "" {
+		sink, _ := provenance.NewSink(config.Provenance.URL, config.Signer.PublicKey())
+		recorder = provenance.New(config.Provenance.BuilderID, config.Signer, sink)
+	}
+
+	// steps with a cache key are skipped if the inputs are
+	// unchanged since a previous successful run.
+	var cache stepcache.Store
+	if config.StepCache.Dir != "" {
+		cache = stepcache.Dir(config.StepCache.Dir, config.StepCache.TTL)
+	}
+
+	// the stage workspaces are optionally added as git
+	// worktrees of persistent base clones, which are pruned
+	// when no longer used.
+	var worktrees *runtime.Worktrees
+	if config.Worktree.Dir != "" {
+		worktrees = runtime.NewWorktrees(config.Worktree.Dir)
+		steps = append(steps, worktrees.Middleware())
+		go worktrees.Monitor(ctx, time.Hour, config.Worktree.TTL)
+	}
+
+	// the checkout is optionally verified before any user
+	// step is executed.
+	var verifier *runtime.Verifier
+	if config.Verify.Commit || config.Verify.GPGHome != "" || config.Verify.AllowedSigners != "" {
+		verifier = runtime.NewVerifier(config.Verify.GPGHome, config.Verify.AllowedSigners)
+		steps = append(steps, verifier.Middleware())
+	}
+
+	// the host state is optionally recorded when a stage
+	// starts, and compared with the previous build of the
+	// repository.
+	var snapshotConfig *snapshot.Config
+	var snapshots snapshot.Store
+	if config.Snapshot.Enabled {
+		snapshotConfig = &snapshot.Config{
+			Packages: config.Snapshot.Packages,
+			Tools:    config.Snapshot.Tools,
+		}
+		snapshots = snapshot.Memory()
+		if config.Snapshot.Dir != "" {
+			snapshots = snapshot.Dir(config.Snapshot.Dir)
+		}
+	}
+
+	// ports are allocated from a single range shared by the
+	// runner profiles.
+	ports := port.New(
+		config.Runner.PortMin,
+		config.Runner.PortMax,
+	)
+
+	// the steps of each repository namespace optionally run
+	// as a dedicated operating system user.
+	var tenants *tenant.Users
+	if config.Tenant.File != "" || config.Tenant.Create {
+		tenants = tenant.New(tenant.Config{
+			Users:  config.Tenants,
+			Create: config.Tenant.Create,
+			Prefix: config.Tenant.Prefix,
+		})
+	}
+
+	// the runner and each named runner profile poll the server
+	// for stages matching their labels, and run the stages with
+	// their own settings.
+	configs := []Config{config}
+	for _, profile := range config.Profiles {
+		configs = append(configs, profile.apply(config))
+	}
+	// the execution time of each repository namespace is
+	// accounted by the runner and the runner profiles, and is
+	// optionally persisted across restarts.
+	ledger, err := usage.New(config.Usage.File, config.UsageQuotas)
+	if err != nil {
+		logrus.WithError(err).
+			Errorln("cannot load the usage ledger")
+		return err
+	}
+
+	// the throttle lowers the number of stages the runner and
+	// each runner profile request concurrently while the host
+	// is too hot, or the battery is nearly empty.
+	var throttle *runtime.Throttle
+	if config.Throttle.Enabled {
+		throttle = runtime.NewThrottle(config.Throttle.Capacity, Events)
+	}
+
+	// the cpus of the host are partitioned into a cpu set for
+	// each stage executed concurrently by the runner and the
+	// runner profiles.
+	var cpus *affinity.Pool
+	if config.Affinity.Enabled {
+		sets, err := cpuSets(config, configs)
+		if err != nil {
+			logrus.WithError(err).
+				Errorln("cannot partition the cpus")
+			return err
+		}
+		cpus = affinity.NewPool(sets)
+	}
+
+	// the circuit breaker stops the runner and each runner
+	// profile from requesting stages after consecutive
+	// infrastructure failures, and notifies the subscribers.
+	var breaker *runtime.Breaker
+	if config.Breaker.Threshold > 0 {
+		breaker = runtime.NewBreaker(config.Breaker.Threshold, config.Breaker.Cooldown, Events)
+	}
+
+	// the runner labels are optionally loaded from a file or
+	// http endpoint, and merged with the static labels of the
+	// runner and each runner profile.
+	var source *labels.Source
+	var loaded map[string]string
+	if config.Runner.LabelsSource != "" {
+		source = labels.New(config.Runner.LabelsSource)
+		var err error
+		if loaded, err = source.Load(ctx); err != nil {
+			logrus.WithError(err).
+				Errorln("cannot load the runner labels")
+			return err
+		}
+	}
+
+	var pollers []*runtime.Poller
+	var controls []*runtime.Control
+	for i, config := range configs {
+		// the capacity and labels of each runner are controlled
+		// by the fleet api, and runners are named by profile.
+		name := config.Runner.Name
+		if i > 0 {
+			name = configs[0].Profiles[i-1].Name
+		}
+		control := runtime.NewControl(name, config.Runner.Capacity, labels.Merge(config.Runner.Labels, loaded))
+		controls = append(controls, control)
+
+		// accepted stages are scheduled across namespaces by
+		// the fair queue, which requests a backlog of stages in
+		// excess of the capacity.
+		var queue *runtime.Queue
+		var backlog int
+		if config.Queue.Fair {
+			queue = runtime.NewQueue(control, config.Queue.Weights)
+			backlog = config.Queue.Backlog
+		}
+
+		pollers = append(pollers, &runtime.Poller{
+			Client: transport,
+			Runner: &runtime.Runner{
+				Client:   transport,
+				Environ:  config.Runner.Environ,
+				Machine:  config.Runner.Name,
+				Host:     host,
+				Version:  version,
+				Root:     config.Runner.Root,
+				Symlinks: config.Runner.Symlinks,
+				Plugins:  config.Runner.Plugins,
+				Umask:    config.Runner.Umask,
+				Priority: priority(config),
+				Security: security(config),
+				Seccomp:  config.Runner.Seccomp,
+				Job:      job(config),
+				Jail:     jail(config),
+				Zone:     zone(config),
+				Hosts:    hosts,
+				Queue:    queue,
+				Usage:    ledger,
+				Ulimits:  config.Runner.Ulimits,
+				Ports:    ports,
+				CPUs:     cpus,
+				Tenants:  tenants,
+				Store:    store,
+				Cache:    cache,
+				Debug:    config.Runner.Debug,
+				Debugs:   debugs,
+				Summary:  config.Runner.Summary,
+				Reporter: reporter,
+				Events:   Events,
+
+				Sandbox:        config.Sandbox,
+				SandboxTrusted: config.SandboxTrusted,
+				Worktrees:      worktrees,
+				Verifier:       verifier,
+				Egress:         config.EgressPolicy,
+				HostAliases:    config.Runner.Hosts,
+				Toolbox:        config.ToolboxPath,
+
+				AcceptTimeout: config.Runner.Accept,
+				LeaseInterval: config.Runner.Lease,
+				MaxDuration:   config.Runner.Duration,
+				Retries:       config.Runner.Retries,
+
+				CredentialHelper: config.Runner.CredentialHelper,
+				Artifacts:        artifacts,
+				Provenance:       recorder,
+				Snapshot:         snapshotConfig,
+				Snapshots:        snapshots,
+
+				Match: match.Func(
+					config.Limit.Repos,
+					config.Limit.Events,
+					config.Limit.Trusted,
+				),
+				Secret: secret.External(
+					config.Secret.Endpoint,
+					config.Secret.Token,
+					config.Secret.SkipVerify,
+				),
+				SecretTargets:  config.Secret.Targets,
+				SecretRules:    config.SecretRules,
+				SecretMetadata: config.SecretMetadata,
+				SecretExpiry:   config.Secret.Expiry,
+				Execer: runtime.NewExecer(
+					reporter,
+					streamer,
+					engine,
+					workspaces,
+					gates,
+					config.Runner.Procs,
+					steps...,
+				),
+			},
+			Filter: &client.Filter{
+				Kind:    resource.Kind,
+				Type:    resource.Type,
+				OS:      config.Platform.OS,
+				Arch:    config.Platform.Arch,
+				Variant: config.Platform.Variant,
+				Kernel:  config.Platform.Kernel,
+				Labels:  config.Runner.Labels,
+			},
+			Interval:   config.Poller.Interval,
+			Timeout:    config.Poller.Timeout,
+			BackoffMin: config.Poller.BackoffMin,
+			BackoffMax: config.Poller.BackoffMax,
+			Burst:      config.Poller.Burst,
+			Backlog:    backlog,
+			Control:    control,
+			Breaker:    breaker,
+			Throttle:   throttle,
+		})
+	}
+
+	// the host sensors are read at the interval, and the
+	// pollers are throttled while the sensors exceed the
+	// limits.
+	if throttle != nil {
+		limits := thermal.Limits{
+			Temperature: config.Throttle.Temperature,
+			Resume:      config.Throttle.Resume,
+			Battery:     config.Throttle.Battery,
+		}
+		go thermal.Watch(ctx, config.Throttle.Interval, limits, func(throttled bool, reason string) {
+			if throttled {
+				logrus.WithField("reason", reason).
+					Warnln("host throttled, lowering capacity")
+			} else {
+				logrus.Infoln("host resumed, restoring capacity")
+			}
+			throttle.Set(throttled, reason)
+		})
+	}
+
+	// the runner labels are refreshed at the interval, and the
+	// pollers request stages with the refreshed labels without
+	// restarting the runner.
+	if source != nil {
+		go source.Watch(ctx, config.Runner.LabelsInterval, loaded, func(next map[string]string) {
+			for i, control := range controls {
+				control.SetLabels(labels.Merge(configs[i].Runner.Labels, next))
+			}
+		})
+	}
+
+	// the resource page reports the disk usage of the root
+	// directory of the runner and each runner profile, and the
+	// stats api reports the combined capacity.
+	var paths []string
+	var capacity int
+	seen := map[string]bool{}
+	for _, config := range configs {
+		capacity += config.Runner.Capacity
+		root := config.Runner.Root
+		if root == "" {
+			root = os.TempDir()
+		}
+		if !seen[root] {
+			seen[root] = true
+			paths = append(paths, root)
+		}
+	}
+
+	// the dashboard optionally supports login with the openid
+	// connect provider, in addition to basic authentication.
+	var provider *sso.Provider
+	if login := config.Dashboard.OIDC; login.Issuer != "" {
+		var err error
+		provider, err = sso.New(ctx, sso.Config{
+			Issuer:       login.Issuer,
+			ClientID:     login.ClientID,
+			ClientSecret: login.ClientSecret,
+			RedirectURL:  login.RedirectURL,
+			Scopes:       login.Scopes,
+			GroupsClaim:  login.GroupsClaim,
+			Groups:       login.Groups,
+			AdminGroups:  login.AdminGroups,
+			Secret:       login.SessionSecret,
+			Timeout:      login.SessionTimeout,
+		})
+		if err != nil {
+			logrus.WithError(err).
+				WithField("issuer", login.Issuer).
+				Errorln("cannot configure the dashboard sso provider")
+			return err
+		}
+	}
+	dashboard := config.Dashboard.Password != "" || provider != nil
+
+	adminConfig := admin.Config{
+		Username:  config.Dashboard.Username,
+		Password:  config.Dashboard.Password,
+		History:   archives,
+		Processes: processes,
+		Paths:     paths,
+		Tracer:    tracer,
+		Hook:      hook,
+		Capacity:  capacity,
+		SSO:       provider,
+		Hosts:     hosts,
+		Breaker:   breaker,
+		Usage:     ledger,
+		Debugs:    debugs,
+
+		LogRetention: config.LogHistory.Retention,
+	}
+
+	// the request rate of each dashboard client is limited,
+	// to protect the runner from misbehaving clients. The rate
+	// limit applies to the dashboard pages only, and not to the
+	// metrics and apis, which are polled by automation. Failed
+	// basic authentication attempts are limited separately for
+	// all authenticated endpoints, including the apis, to
+	// protect against credential guessing.
+	limit := func(h http.Handler) http.Handler { return h }
+	if config.Dashboard.RateLimit > 0 {
+		limit = ratelimit.Requests(
+			config.Dashboard.RateLimit,
+			config.Dashboard.RateBurst,
+		).Handler
+		adminConfig.Failures = ratelimit.Requests(
+			config.Dashboard.RateLimit,
+			config.Dashboard.RateBurst,
+		)
+	}
+
+	// the metrics endpoint requires the dashboard credentials,
+	// if configured, unless anonymous access is enabled.
+	metricsHandler := metrics.Handler(metrics.Default...)
+	if dashboard && !config.Metrics.Anonymous {
+		metricsHandler = admin.Auth(metricsHandler, adminConfig)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", admin.New(workspaces, gates, adminConfig))
+	mux.Handle("/api/v1/", admin.Fleet(tracer, controls, config.Fleet.Token))
+	mux.Handle("/metrics", metricsHandler)
+	if breaker != nil {
+		mux.Handle("/healthz", admin.HandleHealthz(breaker))
+	}
+	if dashboard {
+		mux.Handle("/resources", limit(admin.Auth(admin.HandleResourcesPage(processes, paths), adminConfig)))
+	}
+	if archives != nil && dashboard {
+		mux.Handle("/history", limit(admin.Auth(admin.HandleHistoryPage(archives), adminConfig)))
+	}
+	if provider != nil {
+		mux.Handle("/", limit(admin.Dashboard(tracer, hook, adminConfig)))
+	} else {
+		mux.Handle("/", limit(router.New(tracer, hook, router.Config{
 			Username: config.Dashboard.Username,
 			Password: config.Dashboard.Password,
 			Realm:    config.Dashboard.Realm,
-		}),
+		})))
+	}
+
+	// the startup script is run once when the daemon starts,
+	// to warm caches or authenticate to registries. If the
+	// script is required, the runner does not poll the server
+	// for stages unless the script succeeds.
+	if path := config.Startup.Script; path != "" {
+		logrus.WithField("script", path).
+			Infoln("running the startup script")
+		if err := runStartup(ctx, config); err != nil {
+			logrus.WithError(err).
+				WithField("script", path).
+				Errorln("startup script failed")
+			if config.Startup.Required {
+				return err
+			}
+		}
+	}
+
+	// the daemon is stopped when the runner is updated, so
+	// that the updated runner is restarted.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var g errgroup.Group
+	server := server.Server{
+		Addr:    config.Server.Port,
+		Handler: mux,
 	}
 
 	logrus.WithField("addr", config.Server.Port).
@@ -131,18 +823,65 @@ func Run(ctx context.Context, config Config) error {
 		}
 	}
 
-	g.Go(func() error {
-		logrus.WithField("capacity", config.Runner.Capacity).
-			WithField("endpoint", config.Client.Address).
-			WithField("kind", resource.Kind).
-			WithField("type", resource.Type).
-			Infoln("polling the remote server")
+	for i, poller := range pollers {
+		poller, config := poller, configs[i]
+		g.Go(func() error {
+			logrus.WithField("capacity", config.Runner.Capacity).
+				WithField("endpoint", config.Client.Address).
+				WithField("kind", resource.Kind).
+				WithField("type", resource.Type).
+				WithField("labels", config.Runner.Labels).
+				Infoln("polling the remote server")
 
-		poller.Poll(ctx, config.Runner.Capacity)
-		return nil
-	})
+			poller.Poll(ctx, config.Runner.Capacity)
+			return nil
+		})
+	}
+
+	// scheduled maintenance tasks run in the background for
+	// the lifetime of the daemon.
+	if len(config.Tasks) != 0 {
+		g.Go(func() error {
+			logrus.WithField("tasks", len(config.Tasks)).
+				Infoln("starting the task scheduler")
+			cron.Run(ctx, config.Tasks, func(ctx context.Context, task *cron.Task) {
+				if err := runTask(ctx, config, task); err != nil {
+					logrus.WithError(err).
+						WithField("task", task.Name).
+						Errorln("scheduled task failed")
+				}
+			})
+			return nil
+		})
+	}
+
+	if config.Metrics.Summary > 0 {
+		g.Go(func() error {
+			metrics.Summarize(ctx, config.Metrics.Summary, metrics.Default...)
+			return nil
+		})
+	}
 
-	err := g.Wait()
+	// the runner optionally installs newer signed releases,
+	// and restarts once running stages complete.
+	if config.Update.Auto {
+		g.Go(func() error {
+			logrus.WithField("endpoint", config.Update.Endpoint).
+				WithField("interval", config.Update.Interval).
+				Infoln("starting the automatic updater")
+			err := runUpdate(ctx, config, tracer, controls)
+			if err != nil {
+				cancel()
+			}
+			return err
+		})
+	}
+
+	err = g.Wait()
+	if err == ErrRestart {
+		logrus.Infoln("restarting the updated runner")
+		return err
+	}
 	if err != nil {
 		logrus.WithError(err).
 			Errorln("shutting down the server")
@@ -184,3 +923,104 @@ func setupLogger(config Config) error {
 	logrus.AddHook(hook)
 	return nil
 }
+
+// helper function wraps the transport of the http client.
+func wrapTransport(cli *client.HTTPClient, wrap func(http.RoundTripper) http.RoundTripper) {
+	httpClient := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	if cli.Client != nil {
+		httpClient.Transport = cli.Client.Transport
+	}
+	httpClient.Transport = wrap(httpClient.Transport)
+	cli.Client = httpClient
+}
+
+// helper function returns the scheduling priority of step
+// processes, or nil if no priority is configured.
+func priority(config Config) *engine.Priority {
+	if config.Runner.Nice == 0 && config.Runner.IONice.Class == 0 {
+		return nil
+	}
+	return &engine.Priority{
+		Nice:    config.Runner.Nice,
+		IOClass: config.Runner.IONice.Class,
+		IOLevel: config.Runner.IONice.Level,
+	}
+}
+
+// helper function returns the cpu sets of the stages, which
+// partition the configured cpus, or the online cpus of the
+// host, by the combined capacity of the runner profiles.
+func cpuSets(config Config, configs []Config) ([][]int, error) {
+	var capacity int
+	for _, profile := range configs {
+		capacity += profile.Runner.Capacity
+	}
+	cpus, err := affinity.Online()
+	if config.Affinity.CPUs != "" {
+		cpus, err = affinity.Parse(config.Affinity.CPUs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var nodes [][]int
+	if config.Affinity.NUMA {
+		if nodes, err = affinity.Nodes(); err != nil {
+			return nil, err
+		}
+	}
+	return affinity.Partition(cpus, nodes, capacity)
+}
+
+// helper function returns the job object limits of step
+// processes, or nil if not configured.
+func job(config Config) *engine.Job {
+	if config.Runner.JobMemory == 0 && config.Runner.JobProcesses == 0 && config.Runner.JobCPURate == 0 {
+		return nil
+	}
+	return &engine.Job{
+		Memory:    int64(config.Runner.JobMemory),
+		Processes: uint32(config.Runner.JobProcesses),
+		CPURate:   uint32(config.Runner.JobCPURate),
+	}
+}
+
+// helper function returns the jail template of the stages, or
+// nil if not configured.
+func jail(config Config) *engine.Jail {
+	if config.Jail.Template == "" {
+		return nil
+	}
+	return &engine.Jail{
+		Template: config.Jail.Template,
+		Dataset:  config.Jail.Dataset,
+		Path:     config.Jail.Dir,
+	}
+}
+
+// helper function returns the zone template of the stages, or
+// nil if not configured.
+func zone(config Config) *engine.Zone {
+	if config.Zone.Template == "" {
+		return nil
+	}
+	return &engine.Zone{
+		Template: config.Zone.Template,
+		Path:     config.Zone.Dir,
+	}
+}
+
+// helper function returns the selinux context or apparmor
+// profile of step processes, or nil if not configured.
+func security(config Config) *engine.Security {
+	if config.Runner.SELinux == "" && config.Runner.AppArmor == "" {
+		return nil
+	}
+	return &engine.Security{
+		SELinux:  config.Runner.SELinux,
+		AppArmor: config.Runner.AppArmor,
+	}
+}
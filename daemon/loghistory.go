@@ -0,0 +1,34 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	loghistory "github.com/drone/runner-go/logger/history"
+	"github.com/sirupsen/logrus"
+)
+
+// historyHook records the daemon logs at or above the level
+// in the in-memory log history, so that verbose debug logs do
+// not displace the recent errors.
+type historyHook struct {
+	*loghistory.Hook
+	levels []logrus.Level
+}
+
+// helper function returns a logrus hook that records entries
+// at or above the level in the log history. An empty level
+// records all entries.
+func newHistoryHook(hook *loghistory.Hook, level string) logrus.Hook {
+	levels := logrus.AllLevels
+	if level, err := logrus.ParseLevel(level); err == nil {
+		levels = logrus.AllLevels[:level+1]
+	}
+	return &historyHook{Hook: hook, levels: levels}
+}
+
+// Levels returns the levels recorded by the hook.
+func (h *historyHook) Levels() []logrus.Level {
+	return h.levels
+}
@@ -0,0 +1,17 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build windows
+
+package daemon
+
+import "os/exec"
+
+// helper function configures the process.
+func setupProcess(cmd *exec.Cmd) {}
+
+// helper function kills the process.
+func killProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+
+	"github.com/buildkite/yaml"
+)
+
+// Profile defines a named runner profile. Each profile polls
+// the server for stages matching the profile labels, and runs
+// them with the profile settings. Settings not defined by the
+// profile are inherited from the runner configuration.
+type Profile struct {
+	Name     string            `yaml:"name"`
+	Capacity int               `yaml:"capacity"`
+	Labels   map[string]string `yaml:"labels"`
+	Environ  map[string]string `yaml:"environ"`
+	Root     string            `yaml:"root"`
+	Symlinks map[string]string `yaml:"symlinks"`
+	Plugins  map[string]string `yaml:"plugins"`
+	Umask    string            `yaml:"umask"`
+	Ulimits  map[string]int64  `yaml:"ulimits"`
+	Limit    struct {
+		Repos   []string `yaml:"repos"`
+		Events  []string `yaml:"events"`
+		Trusted *bool    `yaml:"trusted"`
+	} `yaml:"limit"`
+}
+
+// helper function loads the runner profiles from the file.
+func loadProfiles(path string) ([]Profile, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []Profile
+	if err := yaml.Unmarshal(raw, &profiles); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// helper function validates the runner profiles. The server
+// routes stages to runners with matching labels, so each
+// profile requires unique labels.
+func lintProfiles(config Config) error {
+	names := map[string]struct{}{}
+	labels := []map[string]string{config.Runner.Labels}
+	for _, p := range config.Profiles {
+		if p.Name == "" {
+			return errors.New("invalid or missing profile name")
+		}
+		if _, ok := names[p.Name]; ok {
+			return fmt.Errorf("duplicate profile %q", p.Name)
+		}
+		names[p.Name] = struct{}{}
+		if len(p.Labels) == 0 {
+			return fmt.Errorf("missing labels for profile %q", p.Name)
+		}
+		for _, other := range labels {
+			if reflect.DeepEqual(p.Labels, other) {
+				return fmt.Errorf("duplicate labels for profile %q", p.Name)
+			}
+		}
+		labels = append(labels, p.Labels)
+		if p.Umask != "" {
+			if _, err := strconv.ParseUint(p.Umask, 8, 9); err != nil {
+				return fmt.Errorf("invalid umask %q for profile %q", p.Umask, p.Name)
+			}
+		}
+		if err := lintUlimits(p.Ulimits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply returns a copy of the runner configuration with the
+// profile settings applied.
+func (p Profile) apply(config Config) Config {
+	config.Profiles = nil
+	config.Runner.Labels = p.Labels
+	if p.Capacity > 0 {
+		config.Runner.Capacity = p.Capacity
+	}
+	if p.Root != "" {
+		config.Runner.Root = p.Root
+	}
+	if p.Symlinks != nil {
+		config.Runner.Symlinks = p.Symlinks
+	}
+	if p.Plugins != nil {
+		config.Runner.Plugins = p.Plugins
+	}
+	if p.Umask != "" {
+		config.Runner.Umask = p.Umask
+	}
+	if p.Ulimits != nil {
+		config.Runner.Ulimits = p.Ulimits
+	}
+	if p.Limit.Repos != nil {
+		config.Limit.Repos = p.Limit.Repos
+	}
+	if p.Limit.Events != nil {
+		config.Limit.Events = p.Limit.Events
+	}
+	if p.Limit.Trusted != nil {
+		config.Limit.Trusted = *p.Limit.Trusted
+	}
+	environ := map[string]string{}
+	for k, v := range config.Runner.Environ {
+		environ[k] = v
+	}
+	for k, v := range p.Environ {
+		environ[k] = v
+	}
+	config.Runner.Environ = environ
+	return config
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testProfiles = `
+- name: trusted-deploy
+  labels:
+    workload: deploy
+  root: /var/lib/drone/deploy
+  environ:
+    DEPLOY_ENV: production
+  limit:
+    trusted: true
+- name: untrusted-test
+  capacity: 4
+  labels:
+    workload: test
+  umask: "0077"
+  ulimits:
+    nproc: 512
+`
+
+func TestFromEnviron_Profiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.yml")
+	ioutil.WriteFile(path, []byte(testProfiles), 0600)
+
+	os.Setenv("DRONE_RPC_HOST", "drone.company.com")
+	os.Setenv("DRONE_RPC_SECRET", "correct-horse")
+	os.Setenv("DRONE_RUNNER_PROFILES_FILE", path)
+	defer os.Unsetenv("DRONE_RPC_HOST")
+	defer os.Unsetenv("DRONE_RPC_SECRET")
+	defer os.Unsetenv("DRONE_RUNNER_PROFILES_FILE")
+
+	config, err := FromEnviron()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(config.Profiles), 2; got != want {
+		t.Fatalf("Want %d profiles, got %d", want, got)
+	}
+
+	deploy := config.Profiles[0].apply(config)
+	if got, want := deploy.Runner.Root, "/var/lib/drone/deploy"; got != want {
+		t.Errorf("Want root %q, got %q", want, got)
+	}
+	if got, want := deploy.Runner.Environ["DEPLOY_ENV"], "production"; got != want {
+		t.Errorf("Want profile environ %q, got %q", want, got)
+	}
+	if _, ok := config.Runner.Environ["DEPLOY_ENV"]; ok {
+		t.Errorf("Expect runner environ not modified by profile")
+	}
+	if !deploy.Limit.Trusted {
+		t.Errorf("Want profile limited to trusted repositories")
+	}
+
+	test := config.Profiles[1].apply(config)
+	if got, want := test.Runner.Capacity, 4; got != want {
+		t.Errorf("Want capacity %d, got %d", want, got)
+	}
+	if got, want := test.Runner.Labels["workload"], "test"; got != want {
+		t.Errorf("Want labels workload=%s, got %s", want, got)
+	}
+	if got, want := test.Runner.Root, config.Runner.Root; got != want {
+		t.Errorf("Want root inherited from runner, got %q", got)
+	}
+}
+
+func TestLintProfiles(t *testing.T) {
+	tests := []Profile{
+		{Labels: map[string]string{"a": "b"}},
+		{Name: "test"},
+		{Name: "test", Labels: map[string]string{"a": "b"}, Umask: "999"},
+		{Name: "test", Labels: map[string]string{"a": "b"}, Ulimits: map[string]int64{"stack": 1}},
+	}
+	for i, profile := range tests {
+		var config Config
+		config.Profiles = []Profile{profile}
+		if err := lintProfiles(config); err == nil {
+			t.Errorf("Expect lint error for profile %d", i)
+		}
+	}
+
+	var config Config
+	config.Profiles = []Profile{
+		{Name: "a", Labels: map[string]string{"a": "b"}},
+		{Name: "b", Labels: map[string]string{"a": "b"}},
+	}
+	if err := lintProfiles(config); err == nil {
+		t.Errorf("Expect lint error for duplicate labels")
+	}
+}
@@ -6,6 +6,7 @@ package service
 
 import (
 	"context"
+	"os"
 
 	"github.com/drone-runners/drone-runner-exec/daemon"
 
@@ -27,7 +28,13 @@ func (m *manager) Start(service.Service) error {
 	}
 	ctx, cancel := context.WithCancel(nocontext)
 	m.cancel = cancel
-	go daemon.Run(ctx, config)
+	go func() {
+		// the process exits when the runner is updated, and
+		// is restarted by the service manager.
+		if daemon.Run(ctx, config) == daemon.ErrRestart {
+			os.Exit(1)
+		}
+	}()
 	return nil
 }
 
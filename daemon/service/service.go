@@ -5,8 +5,11 @@
 package service
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/kardianos/service"
 )
@@ -17,15 +20,20 @@ const (
 
 	// DefaultDesc is the default service description.
 	DefaultDesc = "Drone Exec Runner"
+
+	// DefaultRestart is the default restart policy.
+	DefaultRestart = "always"
 )
 
 // Config configures the service.
 type Config struct {
-	Name       string // service name
-	Desc       string // service description
-	Username   string // service username (windows only)
-	Password   string // service password (windows only)
-	ConfigFile string // service configuration file path
+	Name       string        // service name
+	Desc       string        // service description
+	Username   string        // service username
+	Password   string        // service password (windows only)
+	ConfigFile string        // service configuration file path
+	Restart    string        // restart policy (linux and darwin only)
+	RestartSec time.Duration // restart delay (linux and darwin only)
 }
 
 // New creates and configures a new service.
@@ -37,12 +45,37 @@ func New(conf Config) (service.Service, error) {
 		Arguments:   []string{"service", "run", "--config", conf.ConfigFile},
 	}
 
+	restart := conf.Restart
+	if restart == "" {
+		restart = DefaultRestart
+	}
+	switch restart {
+	case "always", "on-failure", "no":
+	default:
+		return nil, fmt.Errorf("unsupported restart policy %q", restart)
+	}
+	restartSec := int(conf.RestartSec / time.Second)
+	if restartSec <= 0 {
+		restartSec = 5
+	}
+
 	switch runtime.GOOS {
+	case "linux":
+		config.UserName = conf.Username
+		config.Option = service.KeyValue{
+			"SystemdScript":   systemdScript,
+			"EnvironmentFile": conf.ConfigFile,
+			"Restart":         restart,
+			"RestartSec":      restartSec,
+		}
 	case "darwin":
+		config.UserName = conf.Username
 		config.Option = service.KeyValue{
-			"KeepAlive":   true,
-			"RunAtLoad":   true,
-			"UserService": os.Getuid() != 0,
+			"LaunchdConfig": launchdConfig,
+			"UserService":   os.Getuid() != 0,
+			"LogFile":       logFile(conf.Name),
+			"Restart":       restart,
+			"RestartSec":    restartSec,
 		}
 	case "windows":
 		if conf.Username != "" {
@@ -56,3 +89,11 @@ func New(conf Config) (service.Service, error) {
 	m := new(manager)
 	return service.New(m, config)
 }
+
+// helper function returns the log file of the launchd service.
+func logFile(name string) string {
+	if home, err := os.UserHomeDir(); err == nil && os.Getuid() != 0 {
+		return filepath.Join(home, "Library", "Logs", name+".log")
+	}
+	return filepath.Join("/var/log", name+".log")
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package service
+
+// systemdScript is the systemd unit template. The service
+// loads the environment from the configuration file, and is
+// restarted by systemd according to the restart policy.
+const systemdScript = `[Unit]
+Description={{.Description}}
+Documentation=https://docs.drone.io/runner/exec/overview/
+After=network-online.target
+Wants=network-online.target
+ConditionFileIsExecutable={{.Path|cmdEscape}}
+
+[Service]
+ExecStart={{.Path|cmdEscape}}{{range .Arguments}} {{.|cmd}}{{end}}
+{{- if .UserName}}
+User={{.UserName}}
+{{- end}}
+EnvironmentFile=-{{.Option.EnvironmentFile|cmdEscape}}
+Restart={{.Option.Restart}}
+RestartSec={{.Option.RestartSec}}
+StartLimitInterval=5
+StartLimitBurst=10
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// launchdConfig is the launchd property list template. The
+// service output is written to the log file, and the service
+// is restarted by launchd according to the restart policy.
+const launchdConfig = `<?xml version='1.0' encoding='UTF-8'?>
+<!DOCTYPE plist PUBLIC "-//Apple Computer//DTD PLIST 1.0//EN"
+"http://www.apple.com/DTDs/PropertyList-1.0.dtd" >
+<plist version='1.0'>
+<dict>
+<key>Label</key><string>{{html .Name}}</string>
+<key>ProgramArguments</key>
+<array>
+	<string>{{html .Path}}</string>
+{{- range .Config.Arguments}}
+	<string>{{html .}}</string>
+{{- end}}
+</array>
+{{- if .UserName}}
+<key>UserName</key><string>{{html .UserName}}</string>
+{{- end}}
+<key>StandardOutPath</key><string>{{html .Option.LogFile}}</string>
+<key>StandardErrorPath</key><string>{{html .Option.LogFile}}</string>
+{{- if eq .Option.Restart "always"}}
+<key>KeepAlive</key><true/>
+{{- else if eq .Option.Restart "on-failure"}}
+<key>KeepAlive</key><dict><key>SuccessfulExit</key><false/></dict>
+{{- else}}
+<key>KeepAlive</key><false/>
+{{- end}}
+<key>ThrottleInterval</key><integer>{{.Option.RestartSec}}</integer>
+<key>RunAtLoad</key><true/>
+<key>Disabled</key><false/>
+</dict>
+</plist>
+`
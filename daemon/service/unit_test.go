@@ -0,0 +1,96 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/kardianos/service"
+)
+
+// unit is the template data provided by the service manager.
+type unit struct {
+	*service.Config
+	Path string
+}
+
+func TestSystemdScript(t *testing.T) {
+	funcs := template.FuncMap{
+		"cmd":       func(s string) string { return s },
+		"cmdEscape": func(s string) string { return s },
+	}
+	tmpl := template.Must(template.New("").Funcs(funcs).Parse(systemdScript))
+	buf := new(bytes.Buffer)
+	err := tmpl.Execute(buf, &unit{
+		Path: "/usr/local/bin/drone-runner-exec",
+		Config: &service.Config{
+			Name:        DefaultName,
+			Description: DefaultDesc,
+			UserName:    "drone",
+			Arguments:   []string{"service", "run", "--config", "/etc/drone-runner-exec/config"},
+			Option: service.KeyValue{
+				"EnvironmentFile": "/etc/drone-runner-exec/config",
+				"Restart":         "on-failure",
+				"RestartSec":      5,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"ExecStart=/usr/local/bin/drone-runner-exec service run --config /etc/drone-runner-exec/config\n",
+		"User=drone\n",
+		"EnvironmentFile=-/etc/drone-runner-exec/config\n",
+		"Restart=on-failure\n",
+		"RestartSec=5\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Want systemd unit to contain %q, got\n%s", want, buf)
+		}
+	}
+}
+
+func TestLaunchdConfig(t *testing.T) {
+	funcs := template.FuncMap{
+		"bool": func(v bool) string { return "true" },
+	}
+	tmpl := template.Must(template.New("").Funcs(funcs).Parse(launchdConfig))
+	buf := new(bytes.Buffer)
+	err := tmpl.Execute(buf, &unit{
+		Path: "/usr/local/bin/drone-runner-exec",
+		Config: &service.Config{
+			Name:      DefaultName,
+			Arguments: []string{"service", "run"},
+			Option: service.KeyValue{
+				"LogFile":    "/var/log/drone-runner-exec.log",
+				"Restart":    "on-failure",
+				"RestartSec": 5,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<string>/usr/local/bin/drone-runner-exec</string>",
+		"<key>StandardOutPath</key><string>/var/log/drone-runner-exec.log</string>",
+		"<key>KeepAlive</key><dict><key>SuccessfulExit</key><false/></dict>",
+		"<key>ThrottleInterval</key><integer>5</integer>",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Want launchd config to contain %q, got\n%s", want, buf)
+		}
+	}
+}
+
+func TestNew_InvalidRestart(t *testing.T) {
+	if _, err := New(Config{Name: DefaultName, Restart: "sometimes"}); err == nil {
+		t.Errorf("Want unsupported restart policy rejected")
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/drone/runner-go/environ"
+	"github.com/drone/runner-go/shell"
+
+	"github.com/sirupsen/logrus"
+)
+
+// helper function runs the startup script with the host shell,
+// and with the runner environment. The script output is written
+// to the runner logs.
+func runStartup(ctx context.Context, config Config) error {
+	output := logrus.WithField("script", config.Startup.Script).Writer()
+	defer output.Close()
+	return runScript(ctx, config.Startup.Script, config.Runner.Environ, config.Startup.Timeout, output)
+}
+
+// helper function runs the script with the host shell. The
+// script is killed, including any child processes, if the
+// timeout is exceeded.
+func runScript(ctx context.Context, path string, envs map[string]string, timeout time.Duration, output io.Writer) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	command, args := shell.Command()
+	cmd := exec.Command(command, append(args, path)...)
+	cmd.Env = append(os.Environ(), environ.Slice(envs)...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	setupProcess(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	// the process group is killed on timeout, since child
+	// processes would otherwise hold the output open.
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		killProcess(cmd)
+		<-done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !windows
+
+package daemon
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/cron"
+)
+
+func TestRunStartup(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "startup.sh")
+	ioutil.WriteFile(script, []byte("echo $GOPROXY > "+filepath.Join(dir, "out")), 0700)
+
+	var config Config
+	config.Startup.Script = script
+	config.Runner.Environ = map[string]string{"GOPROXY": "direct"}
+	if err := runStartup(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := ioutil.ReadFile(filepath.Join(dir, "out"))
+	if got, want := string(out), "direct\n"; got != want {
+		t.Errorf("Want runner environment %q, got %q", want, got)
+	}
+
+	ioutil.WriteFile(script, []byte("exit 1"), 0700)
+	if err := runStartup(context.Background(), config); err == nil {
+		t.Errorf("Expect error when startup script fails")
+	}
+
+	ioutil.WriteFile(script, []byte("sleep 10"), 0700)
+	config.Startup.Timeout = 10 * time.Millisecond
+	if err := runStartup(context.Background(), config); err == nil {
+		t.Errorf("Expect error when startup script times out")
+	}
+}
+
+func TestRunTask(t *testing.T) {
+	dir := t.TempDir()
+
+	var config Config
+	config.Cron.LogDir = dir
+	config.Runner.Environ = map[string]string{"GOPROXY": "direct"}
+	task := &cron.Task{Name: "prune", Command: "echo pruning $GOPROXY"}
+	if err := runTask(context.Background(), config, task); err != nil {
+		t.Fatal(err)
+	}
+	out, _ := ioutil.ReadFile(filepath.Join(dir, "prune.log"))
+	if !strings.Contains(string(out), "pruning direct") {
+		t.Errorf("Expect task output in task log, got %q", out)
+	}
+
+	task.Command = "exit 1"
+	if err := runTask(context.Background(), config, task); err == nil {
+		t.Errorf("Expect error when task fails")
+	}
+}
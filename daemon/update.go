@@ -0,0 +1,106 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/update"
+	"github.com/drone-runners/drone-runner-exec/runtime"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline/history"
+	"github.com/sirupsen/logrus"
+)
+
+// Version is the runner version, which is compared with the
+// latest release when automatic updates are enabled.
+var Version = "0.0.0"
+
+// ErrRestart is returned by Run when the runner binary is
+// updated, and the process should exit so that the service
+// manager restarts the updated runner.
+var ErrRestart = errors.New("runner updated, restarting")
+
+// helper function checks for a newer release at the update
+// interval. When a newer release is installed, the runner is
+// drained, and ErrRestart is returned once the running stages
+// complete.
+func runUpdate(ctx context.Context, config Config, tracer *history.History, controls []*runtime.Control) error {
+	updater, err := update.New(update.Config{
+		Endpoint:  config.Update.Endpoint,
+		PublicKey: config.Update.PublicKey,
+		Version:   Version,
+	})
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(config.Update.Interval):
+		}
+
+		version, err := install(ctx, updater)
+		if err != nil {
+			logrus.WithError(err).
+				Errorln("cannot update the runner")
+			continue
+		}
+		if version == "" {
+			continue
+		}
+
+		logrus.WithField("version", version).
+			Infoln("runner updated, draining before restart")
+		for _, control := range controls {
+			control.Drain(true)
+		}
+		for !idle(tracer) {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Second):
+			}
+		}
+		return ErrRestart
+	}
+}
+
+// helper function installs the latest release if newer than
+// the running version, and returns the installed version.
+func install(ctx context.Context, updater *update.Updater) (string, error) {
+	release, asset, err := updater.Latest(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !update.Newer(release.Version, Version) {
+		return "", nil
+	}
+	data, err := updater.Download(ctx, release, asset)
+	if err != nil {
+		return "", err
+	}
+	path, err := update.Executable()
+	if err != nil {
+		return "", err
+	}
+	return release.Version, update.Install(path, data)
+}
+
+// helper function returns true if no stages are pending or
+// running.
+func idle(tracer *history.History) bool {
+	for _, entry := range tracer.Entries() {
+		switch entry.Stage.Status {
+		case drone.StatusPending, drone.StatusRunning:
+			return false
+		}
+	}
+	return true
+}
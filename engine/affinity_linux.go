@@ -0,0 +1,19 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package engine
+
+import "golang.org/x/sys/unix"
+
+// helper function pins the process to the cpus. Child processes
+// inherit the cpu affinity of the process.
+func setAffinity(pid int, cpus []int) error {
+	var set unix.CPUSet
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+	return unix.SchedSetaffinity(pid, &set)
+}
@@ -0,0 +1,14 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux
+
+package engine
+
+// helper function pins the process to the cpus. Cpu affinity
+// is only supported on linux, and is ignored on other
+// platforms.
+func setAffinity(pid int, cpus []int) error {
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-exec/engine/script"
+)
+
+// Builder builds a Spec that executes commands in a workspace
+// created in the root directory. The steps run serially, in
+// the order they are added.
+type Builder struct {
+	spec  *Spec
+	envs  map[string]string
+	shell *script.Shell
+}
+
+// NewBuilder returns a new Builder. The root directory holds
+// the workspace, home directory and generated scripts, and is
+// removed when the pipeline environment is destroyed.
+func NewBuilder(root string) *Builder {
+	b := &Builder{
+		spec:  &Spec{Root: root},
+		envs:  map[string]string{},
+		shell: script.Default,
+	}
+	for _, dir := range []string{b.Workspace(), b.home(), b.opt()} {
+		b.spec.Files = append(b.spec.Files, &File{
+			Path:  dir,
+			Mode:  0700,
+			IsDir: true,
+		})
+	}
+	// the host environment is not inherited by the steps,
+	// with the exception of the path.
+	b.envs["PATH"] = os.Getenv("PATH")
+	b.envs["HOME"] = b.home()
+	b.envs["USERPROFILE"] = b.home() // for windows
+	return b
+}
+
+// Workspace returns the workspace directory, which is the
+// working directory of the steps.
+func (b *Builder) Workspace() string {
+	return filepath.Join(b.spec.Root, "workspace")
+}
+
+func (b *Builder) home() string {
+	return filepath.Join(b.spec.Root, "home")
+}
+
+func (b *Builder) opt() string {
+	return filepath.Join(b.spec.Root, "opt")
+}
+
+// Env sets an environment variable for all steps.
+func (b *Builder) Env(key, value string) *Builder {
+	b.envs[key] = value
+	return b
+}
+
+// Shell sets the shell used to execute the commands of the
+// steps that are subsequently added.
+func (b *Builder) Shell(shell *script.Shell) *Builder {
+	b.shell = shell
+	return b
+}
+
+// Commands adds a step that executes the commands using the
+// shell. The step fails on the first failing command.
+func (b *Builder) Commands(name string, commands ...string) *Builder {
+	path := filepath.Join(b.opt(), fmt.Sprintf("step%d%s", len(b.spec.Steps), b.shell.Suffix))
+	command, args := b.shell.Exec(path)
+	step := b.add(name, command, args)
+	step.Files = append(step.Files, &File{
+		Path: path,
+		Mode: 0700,
+		Data: []byte(b.shell.Script(commands, script.Options{})),
+	})
+	return b
+}
+
+// Exec adds a step that executes the binary directly, without
+// shell interpretation of the arguments.
+func (b *Builder) Exec(name, command string, args ...string) *Builder {
+	b.add(name, command, args)
+	return b
+}
+
+// Build returns the Spec. The environment variables are
+// applied to all steps.
+func (b *Builder) Build() *Spec {
+	for _, step := range b.spec.Steps {
+		for k, v := range b.envs {
+			if _, ok := step.Envs[k]; !ok {
+				step.Envs[k] = v
+			}
+		}
+	}
+	return b.spec
+}
+
+// helper function adds a step that depends on the previous
+// step.
+func (b *Builder) add(name, command string, args []string) *Step {
+	step := &Step{
+		Name:       strings.TrimSpace(name),
+		Command:    command,
+		Args:       args,
+		Envs:       map[string]string{},
+		RunPolicy:  RunOnSuccess,
+		WorkingDir: b.Workspace(),
+	}
+	if n := len(b.spec.Steps); n != 0 {
+		step.DependsOn = []string{b.spec.Steps[n-1].Name}
+	}
+	b.spec.Steps = append(b.spec.Steps, step)
+	return step
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "task")
+	spec := NewBuilder(root).
+		Env("GREETING", "hello").
+		Commands("build", "echo build").
+		Exec("test", "go", "version").
+		Build()
+
+	if got, want := len(spec.Steps), 2; got != want {
+		t.Fatalf("Want %d steps, got %d", want, got)
+	}
+	build, test := spec.Steps[0], spec.Steps[1]
+	if len(build.Files) != 1 || !strings.HasPrefix(build.Files[0].Path, root) {
+		t.Errorf("Expect build script written to the root directory")
+	}
+	if got, want := test.DependsOn, []string{"build"}; len(got) != 1 || got[0] != want[0] {
+		t.Errorf("Want step depends on %v, got %v", want, got)
+	}
+	if got, want := test.Envs["GREETING"], "hello"; got != want {
+		t.Errorf("Want environment variable %q, got %q", want, got)
+	}
+	if got, want := test.WorkingDir, filepath.Join(root, "workspace"); got != want {
+		t.Errorf("Want working directory %q, got %q", want, got)
+	}
+}
+
+func TestExecute(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "task")
+	spec := NewBuilder(root).
+		Commands("greet", "echo hello").
+		Commands("fail", "exit 3").
+		Commands("skipped", "echo unreachable").
+		Build()
+
+	var buf bytes.Buffer
+	err := Execute(context.Background(), New(), spec, &buf)
+	var exit *ExitError
+	if !errors.As(err, &exit) || exit.Step != "fail" || exit.ExitCode != 3 {
+		t.Errorf("Want exit error for failed step, got %v", err)
+	}
+	if !strings.Contains(buf.String(), "hello") {
+		t.Errorf("Expect step output written, got %q", buf.String())
+	}
+	if strings.Contains(buf.String(), "unreachable") {
+		t.Errorf("Expect steps after failure skipped")
+	}
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Errorf("Expect root directory removed")
+	}
+}
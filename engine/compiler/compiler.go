@@ -8,11 +8,16 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/engine/credential"
 	"github.com/drone-runners/drone-runner-exec/engine/resource"
+	"github.com/drone-runners/drone-runner-exec/engine/script"
+	"github.com/drone-runners/drone-runner-exec/internal/sandbox"
 
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/clone"
@@ -80,15 +85,137 @@ type Compiler struct {
 	// temp directory.
 	Root string
 
+	// Worktree provides the optional path of the persistent
+	// base clone of the repository. If set, the clone step adds
+	// the workspace as a git worktree of the base clone instead
+	// of cloning the repository.
+	Worktree string
+
+	// Shell provides an optional default shell for the clone
+	// step and for steps that do not configure a shell. It is
+	// used when the stage is executed on a remote host with a
+	// different platform than the runner.
+	Shell *script.Shell
+
 	// Symlinks provides an optional list of symlinks that are
 	// created and linked to the pipeline workspace.
 	Symlinks map[string]string
+
+	// Debug defines how long the environment of a failed step
+	// is kept alive in a debug session. Debug sessions are only
+	// enabled for trusted repositories that enable debugging in
+	// the pipeline configuration.
+	Debug time.Duration
+
+	// DebugMarked enables the debug session regardless of the
+	// pipeline configuration, because an administrator marked
+	// the stage or repository for debugging.
+	DebugMarked bool
+
+	// Ports provides an optional list of named ports that are
+	// allocated to the pipeline and exposed to each pipeline
+	// step as environment variables.
+	Ports map[string]int
+
+	// Plugins provides an optional lookup table that maps
+	// plugin images to plugin binaries installed on the host.
+	Plugins map[string]string
+
+	// HostAliases provides an optional lookup table that maps
+	// hostnames to ip addresses for the duration of the stage.
+	// The runner aliases take precedence over the pipeline
+	// host aliases.
+	HostAliases map[string]string
+
+	// Umask provides an optional octal umask for step
+	// processes and files created by the runner. The pipeline
+	// umask is combined with the runner umask, and can only
+	// further restrict file permissions.
+	Umask string
+
+	// Priority provides an optional cpu and io scheduling
+	// priority for step processes.
+	Priority *engine.Priority
+
+	// Summary adds a final step to the stage that writes the
+	// wall time, cpu time, peak memory and cache status of the
+	// other steps to the step log.
+	Summary bool
+
+	// CPUs provides an optional cpu set the step processes
+	// are pinned to.
+	CPUs []int
+
+	// Ulimits provides optional resource limits for step
+	// processes. The runner limits are the maximum limits,
+	// and cannot be exceeded by the pipeline.
+	Ulimits map[string]int64
+
+	// Security provides an optional selinux context or
+	// apparmor profile for step processes. Trusted
+	// repositories may override the runner configuration.
+	Security *engine.Security
+
+	// Seccomp provides an optional seccomp profile for the
+	// step processes of untrusted repositories. The profile
+	// is the default profile, or the path to a json profile.
+	Seccomp string
+
+	// Sandbox provides an optional macos sandbox profile for
+	// the step processes of untrusted repositories, and
+	// SandboxTrusted for the step processes of trusted
+	// repositories.
+	Sandbox        *sandbox.Profile
+	SandboxTrusted *sandbox.Profile
+
+	// Job provides optional limits of the windows job object
+	// that contains the step processes.
+	Job *engine.Job
+
+	// Jail optionally executes the step processes in an
+	// ephemeral freebsd jail cloned from the template
+	// snapshot. The dataset and path are the parent dataset
+	// and directory of the cloned jail roots.
+	Jail *engine.Jail
+
+	// Zone optionally executes the step processes in an
+	// ephemeral illumos zone cloned from the template zone.
+	// The path is the parent directory of the zone paths.
+	Zone *engine.Zone
+
+	// CredentialHelper configures git to request the netrc
+	// credentials from a runner-managed socket, instead of
+	// writing the credentials to disk. The credentials are
+	// only served to step processes.
+	CredentialHelper bool
+
+	// Helpers installs the runner helper commands, such as
+	// drone-wait, on the step path. The helpers execute the
+	// runner binary, and are not available on remote hosts,
+	// jails and zones.
+	Helpers bool
+
+	// Toolbox provides the optional directory of the pinned
+	// tools provided by the runner, which is versioned with the
+	// runner release. The toolbox is added to the step path
+	// after the runner helpers. Steps opt out of the helpers
+	// and toolbox with DRONE_TOOLBOX_DISABLED=true.
+	Toolbox string
+
+	// Artifacts enables the artifact handoff between dependent
+	// stages. The artifacts of upstream stages are downloaded
+	// to a directory exposed to steps as DRONE_ARTIFACTS.
+	Artifacts bool
 }
 
 // Compile compiles the configuration file.
 func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 	spec := new(engine.Spec)
 
+	// custom builds are matched by action, so that steps can
+	// be conditioned on the custom event name.
+	c.Build = customEvent(c.Build)
+
 	if c.Root != "" {
 		spec.Root = filepath.Join(
 			c.Root,
@@ -106,6 +233,44 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 	spec.Platform.Variant = c.Pipeline.Platform.Variant
 	spec.Platform.Version = c.Pipeline.Platform.Version
 
+	// files created by the runner are restricted by the
+	// runner and pipeline umask.
+	spec.Umask = convertUmask(c.Umask, c.Pipeline.Umask)
+
+	// the step processes are limited by the runner job limits,
+	// which cannot be changed by the pipeline.
+	spec.Job = c.Job
+
+	// each pipeline is executed in a dedicated jail, which is
+	// named after the pipeline root.
+	if c.Jail != nil {
+		name := filepath.Base(spec.Root)
+		spec.Jail = &engine.Jail{
+			Name:     name,
+			Template: c.Jail.Template,
+			Dataset:  path.Join(c.Jail.Dataset, name),
+			Path:     filepath.Join(c.Jail.Path, name),
+		}
+	}
+
+	// each pipeline is executed in a dedicated zone, which is
+	// named after the pipeline root.
+	if c.Zone != nil {
+		name := filepath.Base(spec.Root)
+		spec.Zone = &engine.Zone{
+			Name:     name,
+			Template: c.Zone.Template,
+			Path:     filepath.Join(c.Zone.Path, name),
+		}
+	}
+
+	// debug sessions provide shell access to the host machine
+	// and are therefore limited to trusted repositories, unless
+	// requested by an administrator.
+	if (c.Pipeline.Debug && c.Repo.Trusted || c.DebugMarked) && c.Debug > 0 {
+		spec.Debug = &engine.Debug{Timeout: c.Debug}
+	}
+
 	// creates a home directory in the root.
 	homedir := filepath.Join(spec.Root, "home", "drone")
 	spec.Files = append(spec.Files, &engine.File{
@@ -129,8 +294,47 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 		IsDir: true,
 	})
 
-	// creates the netrc file
-	if c.Netrc != nil {
+	// installs the runner helpers to the pipeline bin
+	// directory, which is prepended to the step path.
+	if c.Helpers {
+		bindir := filepath.Join(spec.Root, "opt", "bin")
+		command, err := executable()
+		if err != nil {
+			command = os.Args[0]
+		}
+		spec.Files = append(spec.Files,
+			&engine.File{
+				Path:  bindir,
+				Mode:  0700,
+				IsDir: true,
+			},
+			waitHelper(bindir, command),
+		)
+	}
+
+	// creates the hosts file of the pipeline, if host aliases
+	// are defined by the runner or the pipeline.
+	if aliases := convertHosts(c.Pipeline.Hosts, c.HostAliases); len(aliases) != 0 {
+		spec.Hosts = &engine.Hosts{
+			Path:    filepath.Join(spec.Root, "opt", "hosts"),
+			Aliases: aliases,
+		}
+	}
+
+	// creates the git credential helper socket, if enabled
+	// and supported by the host, otherwise creates the netrc
+	// file.
+	var credentialEnvs map[string]string
+	if c.Netrc != nil && c.CredentialHelper && credential.Supported {
+		socket := filepath.Join(spec.Root, "opt", "credential.sock")
+		spec.Credential = &engine.Credential{
+			Socket:   socket,
+			Machine:  c.Netrc.Machine,
+			Login:    c.Netrc.Login,
+			Password: c.Netrc.Password,
+		}
+		credentialEnvs = credentialEnviron(socket)
+	} else if c.Netrc != nil {
 		netrcpath := filepath.Join(homedir, netrc)
 		netrcdata := fmt.Sprintf(
 			"machine %s login %s password %s",
@@ -153,12 +357,8 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 		})
 	}
 
-	// create the default environment variables.
-	envs := environ.Combine(
-		hostEnviron(),
-		c.Environ,
-		c.Build.Params,
-		environ.Proxy(),
+	// create the pipeline environment variables.
+	pipelineEnvs := environ.Combine(
 		environ.System(c.System),
 		environ.Repo(c.Repo),
 		environ.Build(c.Build),
@@ -174,6 +374,8 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 		}),
 		// TODO(bradrydzewski) windows variable HOMEDRIVE
 		// TODO(bradrydzewski) windows variable LOCALAPPDATA
+		portsEnviron(c.Ports),
+		credentialEnvs,
 		map[string]string{
 			"HOME":                homedir,
 			"HOMEPATH":            homedir, // for windows
@@ -182,8 +384,57 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 			"DRONE_WORKSPACE":     sourcedir,
 			"GIT_TERMINAL_PROMPT": "0",
 		},
+		toolboxEnviron(c.Toolbox),
 	)
 
+	// creates the directory to hold the artifacts of the
+	// upstream stages, if enabled.
+	if c.Artifacts {
+		spec.Artifacts = &engine.Artifacts{
+			Dir:    filepath.Join(spec.Root, "artifacts"),
+			Source: sourcedir,
+			Paths:  c.Pipeline.Artifacts,
+		}
+		spec.Files = append(spec.Files, &engine.File{
+			Path:  spec.Artifacts.Dir,
+			Mode:  0700,
+			IsDir: true,
+		})
+		pipelineEnvs["DRONE_ARTIFACTS"] = spec.Artifacts.Dir
+	}
+
+	// the service connection details are exposed to all
+	// pipeline steps as environment variables.
+	for _, src := range c.Pipeline.Services {
+		pipelineEnvs = environ.Combine(pipelineEnvs, serviceEnviron(src))
+	}
+
+	// create the default environment variables, which
+	// include variables inherited from the host machine and
+	// the runner configuration.
+	envs := environ.Combine(
+		hostEnviron(),
+		c.Environ,
+		c.Build.Params,
+		environ.Proxy(),
+		pipelineEnvs,
+	)
+
+	// create the minimal environment variables for steps
+	// that disable environment inheritance.
+	isolated := environ.Combine(
+		minimalEnviron(c.Environ),
+		c.Build.Params,
+		pipelineEnvs,
+	)
+
+	// the runner helpers and toolbox are found on the step
+	// path, ahead of the host machine commands.
+	if toolpath := c.toolpath(spec); toolpath != "" {
+		envs[pathVar] = prependPath(toolpath, envs[pathVar])
+		isolated[pathVar] = prependPath(toolpath, isolated[pathVar])
+	}
+
 	// create clone step, maybe
 	if c.Pipeline.Clone.Disable == false {
 		clonepath := filepath.Join(spec.Root, "opt", "clone"+shell.Suffix)
@@ -191,23 +442,35 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 		if repoUrl == "" && c.Repo.SSHURL != "" {
 			repoUrl = c.Repo.SSHURL
 		}
-		clonefile := shell.Script(
-			clone.Commands(
-				clone.Args{
-					Branch: c.Build.Target,
-					Commit: c.Build.After,
-					Ref:    c.Build.Ref,
-					Remote: repoUrl,
-				},
-			),
-		)
+		cloneargs := clone.Args{
+			Branch: c.Build.Target,
+			Commit: c.Build.After,
+			Ref:    c.Build.Ref,
+			Remote: repoUrl,
+		}
+		clonecmds := clone.Commands(cloneargs)
+		clonecmds = sparseCheckout(clonecmds, c.Pipeline.Clone.Sparse)
+
+		// the workspace is optionally added as a worktree of
+		// the persistent base clone of the repository. Sparse
+		// checkout only applies to fresh clones.
+		if c.Worktree != "" {
+			clonecmds = worktreeCommands(c.Worktree, sourcedir, cloneargs)
+		}
+		clonefile := shell.Script(clonecmds)
 
 		cmd, args := shell.Command()
-		spec.Steps = append(spec.Steps, &engine.Step{
+		if c.Shell != nil {
+			clonepath = filepath.Join(spec.Root, "opt", "clone"+c.Shell.Suffix)
+			clonefile = c.Shell.Script(clonecmds, script.Options{})
+			cmd, args = c.Shell.Command, append([]string{}, c.Shell.Args...)
+		}
+		dst := &engine.Step{
 			Name:      "clone",
 			Args:      append(args, clonepath),
 			Command:   cmd,
 			Envs:      envs,
+			Group:     "clone",
 			RunPolicy: engine.RunAlways,
 			Files: []*engine.File{
 				{
@@ -216,68 +479,43 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 					Data: []byte(clonefile),
 				},
 			},
-			Secrets:    []*engine.Secret{},
-			WorkingDir: sourcedir,
-		})
-	}
-
-	// create steps
-	for _, src := range c.Pipeline.Steps {
-		buildslug := slug.Make(src.Name)
-		buildpath := filepath.Join(spec.Root, "opt", buildslug+shell.Suffix)
-		buildfile := shell.Script(src.Commands)
-
-		cmd, args := shell.Command()
-		dst := &engine.Step{
-			Name:      src.Name,
-			Args:      append(args, buildpath),
-			Command:   cmd,
-			Detach:    src.Detach,
-			DependsOn: src.DependsOn,
-			Envs: environ.Combine(envs,
-				environ.Expand(
-					convertStaticEnv(src.Environment),
-				),
-			),
-			IgnoreErr:    strings.EqualFold(src.Failure, "ignore"),
-			IgnoreStdout: false,
-			IgnoreStderr: false,
-			RunPolicy:    engine.RunOnSuccess,
-			Files: []*engine.File{
-				{
-					Path: buildpath,
-					Mode: 0700,
-					Data: []byte(buildfile),
-				},
-			},
-			Secrets:    convertSecretEnv(src.Environment),
-			WorkingDir: sourcedir,
+			Secrets:     []*engine.Secret{},
+			HostAliases: spec.Hosts != nil,
+			Priority:    c.Priority,
+			CPUs:        c.CPUs,
+			Sandbox:     c.sandbox(spec),
+			Security:    c.security(),
+			Umask:       spec.Umask,
+			WorkingDir:  sourcedir,
 		}
+
+		// the clone step executes the repository hooks, and is
+		// limited and confined the same as the pipeline steps.
+		configureUlimits(dst, convertUlimits(c.Ulimits, c.Pipeline.Ulimits, nil))
+		configureSeccomp(dst, c.seccomp())
 		spec.Steps = append(spec.Steps, dst)
+	}
 
-		// set the pipeline step run policy. steps run on
-		// success by default, but may be optionally configured
-		// to run on failure.
-		if isRunAlways(src) {
-			dst.RunPolicy = engine.RunAlways
-		} else if isRunOnFailure(src) {
-			dst.RunPolicy = engine.RunOnFailure
+	// create services. services are executed as detached
+	// steps and are torn down when the pipeline completes.
+	for _, src := range c.Pipeline.Services {
+		stepEnvs := envs
+		if !inheritEnviron(c.Pipeline, src) {
+			stepEnvs = isolated
 		}
+		dst := c.createStep(spec, src, stepEnvs)
+		dst.Detach = true
+		spec.Steps = append(spec.Steps, dst)
+	}
 
-		// if the pipeline step has unmet conditions the step is
-		// automatically skipped.
-		if !src.When.Match(manifest.Match{
-			Action:   c.Build.Action,
-			Cron:     c.Build.Cron,
-			Ref:      c.Build.Ref,
-			Repo:     c.Repo.Slug,
-			Instance: c.System.Host,
-			Target:   c.Build.Deploy,
-			Event:    c.Build.Event,
-			Branch:   c.Build.Target,
-		}) {
-			dst.RunPolicy = engine.RunNever
+	// create steps
+	for _, src := range c.Pipeline.Steps {
+		stepEnvs := envs
+		if !inheritEnviron(c.Pipeline, src) {
+			stepEnvs = isolated
 		}
+		dst := c.createStep(spec, src, stepEnvs)
+		spec.Steps = append(spec.Steps, dst)
 	}
 
 	if isGraph(spec) == false {
@@ -288,6 +526,10 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 		removeCloneDeps(spec)
 	}
 
+	if c.Summary {
+		configureSummary(spec)
+	}
+
 	for _, step := range spec.Steps {
 		for _, s := range step.Secrets {
 			found, _ := c.Secret.Find(ctx, &secret.Request{
@@ -304,3 +546,223 @@ func (c *Compiler) Compile(ctx context.Context) *engine.Spec {
 
 	return spec
 }
+
+// helper function creates an intermediate representation of
+// the pipeline step or service.
+func (c *Compiler) createStep(spec *engine.Spec, src *resource.Step, envs map[string]string) *engine.Step {
+	// the step commands are executed by the configured shell,
+	// or the default shell for the host platform.
+	sh := script.Lookup(src.Shell)
+	if src.Shell == "" && c.Shell != nil {
+		sh = c.Shell
+	}
+	if sh == nil {
+		sh = script.Default
+	}
+
+	buildslug := slug.Make(src.Name)
+	buildpath := filepath.Join(spec.Root, "opt", buildslug+sh.Suffix)
+	buildfile := sh.Script(src.Commands, script.Options{
+		Quiet: src.Quiet,
+		Trace: src.Trace,
+	})
+
+	// values exported by the step are written to the outputs
+	// file, and are injected into subsequent steps.
+	outputpath := filepath.Join(spec.Root, "opt", buildslug+".output")
+
+	cmd, args := sh.Exec(buildpath)
+	dst := &engine.Step{
+		Name:      src.Name,
+		Args:      args,
+		Command:   cmd,
+		Detach:    src.Detach,
+		DependsOn: src.DependsOn,
+		Envs: environ.Combine(envs,
+			environ.Expand(
+				convertStaticEnv(src.Environment),
+			),
+			map[string]string{
+				"DRONE_OUTPUT": outputpath,
+			},
+		),
+		IgnoreErr:    strings.EqualFold(src.Failure, "ignore"),
+		IgnoreStdout: false,
+		IgnoreStderr: false,
+		Ready:        convertProbe(src.Ready),
+		RunPolicy:    engine.RunOnSuccess,
+		Files: []*engine.File{
+			{
+				Path: buildpath,
+				Mode: 0700,
+				Data: []byte(buildfile),
+			},
+		},
+		Secrets:    convertSecretEnv(src.Environment),
+		Priority:   c.Priority,
+		CPUs:       c.CPUs,
+		Umask:      convertUmask(c.Umask, c.Pipeline.Umask, src.Umask),
+		WorkingDir: envs["DRONE_WORKSPACE"],
+	}
+
+	// steps opt out of the runner helpers and toolbox, for
+	// example, to use other versions of the tools.
+	if strings.EqualFold(dst.Envs["DRONE_TOOLBOX_DISABLED"], "true") {
+		if toolpath := c.toolpath(spec); toolpath != "" {
+			path := strings.TrimPrefix(dst.Envs[pathVar], toolpath)
+			dst.Envs[pathVar] = strings.TrimPrefix(path, string(os.PathListSeparator))
+		}
+	}
+
+	// steps with an entrypoint execute the binary directly,
+	// without shell interpretation of the arguments.
+	if len(src.Entrypoint) != 0 && src.Runtime == "" {
+		dst.Command = src.Entrypoint[0]
+		dst.Args = append(append([]string{}, src.Entrypoint[1:]...), src.Args...)
+		dst.Files = nil
+	}
+
+	if src.CacheKey != nil {
+		dst.Cache = &engine.Cache{
+			Files: src.CacheKey.Files,
+			Env:   src.CacheKey.Env,
+		}
+	}
+
+	// pause steps wait for approval, and do not execute a
+	// command.
+	if src.Pause != nil {
+		dst.Pause = &engine.Pause{
+			Message: src.Pause.Message,
+			Timeout: time.Duration(src.Pause.Timeout),
+		}
+		dst.Command = ""
+		dst.Args = nil
+		dst.Files = nil
+	}
+
+	// secret files are written to the secrets directory
+	// while the step is running, and the file paths are
+	// exposed to the step as environment variables.
+	if len(src.SecretFiles) != 0 {
+		secrets, paths := convertSecretFiles(
+			src.SecretFiles,
+			filepath.Join(spec.Root, "secrets", buildslug),
+		)
+		dst.Envs = environ.Combine(dst.Envs, paths)
+		dst.Secrets = append(dst.Secrets, secrets...)
+	}
+
+	// plugin steps execute the plugin binary installed on the
+	// host, configured using the plugin settings.
+	if src.Image != "" {
+		settings, secrets := convertSettings(src.Settings)
+		dst.Command = pluginCommand(c.Plugins, src.Image)
+		dst.Args = nil
+		dst.Files = nil
+		dst.Envs = environ.Combine(dst.Envs, settings)
+		dst.Secrets = append(dst.Secrets, secrets...)
+	}
+
+	// steps with a container runtime execute the image using
+	// the docker or podman command line, and wasi steps are
+	// executed by the runner in a sandboxed runtime.
+	ulimits := convertUlimits(c.Ulimits, c.Pipeline.Ulimits, src.Ulimits)
+	switch src.Runtime {
+	case resource.RuntimeDocker, resource.RuntimePodman:
+		configureContainer(spec, src, dst, ulimits)
+	case resource.RuntimeWasi:
+		configureWasi(src, dst)
+		configureUlimits(dst, ulimits)
+		configureSeccomp(dst, c.seccomp())
+		dst.Security = c.security()
+		dst.Sandbox = c.sandbox(spec)
+		dst.NoNetwork = src.Network == resource.NetworkNone
+		dst.HostAliases = spec.Hosts != nil
+	default:
+		configureUlimits(dst, ulimits)
+		configureSeccomp(dst, c.seccomp())
+		dst.Security = c.security()
+		dst.Sandbox = c.sandbox(spec)
+		dst.NoNetwork = src.Network == resource.NetworkNone
+		dst.HostAliases = spec.Hosts != nil
+	}
+
+	// set the pipeline step run policy. steps run on
+	// success by default, but may be optionally configured
+	// to run on failure.
+	if isRunAlways(src) {
+		dst.RunPolicy = engine.RunAlways
+	} else if isRunOnFailure(src) {
+		dst.RunPolicy = engine.RunOnFailure
+	}
+
+	// steps are skipped if the files changed by the build do
+	// not match the path conditions of the pipeline or step.
+	// The changed files are evaluated once the repository is
+	// cloned.
+	for _, cond := range []manifest.Condition{c.Pipeline.Trigger.Paths, src.When.Paths} {
+		if paths := convertPaths(cond); paths != nil {
+			dst.Paths = append(dst.Paths, paths)
+		}
+	}
+
+	// if the pipeline step has unmet conditions the step is
+	// automatically skipped.
+	if !src.When.Match(manifest.Match{
+		Action:   c.Build.Action,
+		Cron:     c.Build.Cron,
+		Ref:      c.Build.Ref,
+		Repo:     c.Repo.Slug,
+		Instance: c.System.Host,
+		Target:   c.Build.Deploy,
+		Event:    c.Build.Event,
+		Branch:   c.Build.Target,
+	}) {
+		dst.RunPolicy = engine.RunNever
+	}
+	return dst
+}
+
+// helper function returns the selinux context or apparmor
+// profile of the step processes. The pipeline configuration
+// overrides the runner configuration for trusted repositories
+// only, since the runner configuration may confine untrusted
+// pipelines.
+func (c *Compiler) security() *engine.Security {
+	if s := c.Pipeline.Security; s != nil && c.Repo.Trusted {
+		return &engine.Security{
+			SELinux:  s.SELinux,
+			AppArmor: s.AppArmor,
+		}
+	}
+	return c.Security
+}
+
+// helper function returns the macos sandbox profile of the
+// step processes, rendered for the pipeline root. The profile
+// is selected by the trust level of the repository.
+func (c *Compiler) sandbox(spec *engine.Spec) string {
+	profile := c.Sandbox
+	if c.Repo.Trusted {
+		profile = c.SandboxTrusted
+	}
+	if profile == nil {
+		return ""
+	}
+	return profile.Render(sandbox.Data{
+		Root:      spec.Root,
+		Workspace: filepath.Join(spec.Root, "drone", "src"),
+		Temp:      tempdir(),
+	})
+}
+
+// helper function returns the seccomp profile of the step
+// processes. Trusted repositories are not restricted, since
+// trusted pipelines may require privileged system calls.
+func (c *Compiler) seccomp() string {
+	if c.Repo.Trusted {
+		return ""
+	}
+	return c.Seccomp
+}
@@ -7,15 +7,22 @@
 package compiler
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/dchest/uniuri"
 	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/engine/credential"
 	"github.com/drone-runners/drone-runner-exec/engine/resource"
+	"github.com/drone-runners/drone-runner-exec/engine/script"
+	"github.com/drone-runners/drone-runner-exec/internal/sandbox"
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/manifest"
 	"github.com/drone/runner-go/secret"
@@ -89,9 +96,525 @@ func TestCompile_RunFaiure(t *testing.T) {
 	}
 }
 
+// This test verifies that services are compiled to detached
+// steps that execute before the pipeline steps, and that the
+// service connection details are exposed to pipeline steps.
+func TestCompile_Services(t *testing.T) {
+	ir := testCompile(t, "testdata/services.yml", "testdata/services.json")
+	if ir.Steps[1].Detach == false {
+		t.Errorf("Expect service is detached")
+	}
+	if got, want := ir.Steps[2].Envs["DRONE_SERVICE_REDIS_PORT"], "6379"; got != want {
+		t.Errorf("Want service port %q, got %q", want, got)
+	}
+}
+
+// This test verifies that debug sessions are only enabled for
+// trusted repositories.
+func TestCompile_Debug(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/debug.yml")
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(nil)
+	compiler.Debug = time.Minute
+
+	if ir := compiler.Compile(nocontext); ir.Debug != nil {
+		t.Errorf("Expect debug disabled for untrusted repository")
+	}
+
+	compiler.Repo.Trusted = true
+	ir := compiler.Compile(nocontext)
+	if ir.Debug == nil || ir.Debug.Timeout != time.Minute {
+		t.Errorf("Expect debug enabled for trusted repository")
+	}
+}
+
+// This test verifies that debug sessions are enabled for stages
+// marked by an administrator, regardless of the pipeline
+// configuration.
+func TestCompile_DebugMarked(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/debug.yml")
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Pipeline.Debug = false
+	compiler.Secret = secret.StaticVars(nil)
+	compiler.DebugMarked = true
+
+	if ir := compiler.Compile(nocontext); ir.Debug != nil {
+		t.Errorf("Expect debug disabled without debug timeout")
+	}
+
+	compiler.Debug = time.Minute
+	ir := compiler.Compile(nocontext)
+	if ir.Debug == nil || ir.Debug.Timeout != time.Minute {
+		t.Errorf("Expect debug enabled for marked stage")
+	}
+}
+
+// This test verifies that the pipeline security settings only
+// override the runner security settings for trusted
+// repositories.
+func TestCompile_Security(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/security.yml")
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(nil)
+	compiler.Security = &engine.Security{AppArmor: "drone-untrusted"}
+
+	ir := compiler.Compile(nocontext)
+	for _, step := range ir.Steps {
+		if step.Security == nil || step.Security.AppArmor != "drone-untrusted" {
+			t.Errorf("Expect runner apparmor profile for untrusted repository")
+		}
+	}
+
+	compiler.Repo.Trusted = true
+	ir = compiler.Compile(nocontext)
+	for _, step := range ir.Steps {
+		if step.Security == nil || step.Security.AppArmor != "drone-trusted" {
+			t.Errorf("Expect pipeline apparmor profile for trusted repository")
+		}
+	}
+}
+
+// This test verifies that the steps of untrusted repositories
+// are executed with the seccomp profile.
+func TestCompile_Seccomp(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/security.yml")
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(nil)
+	compiler.Seccomp = "default"
+
+	ir := compiler.Compile(nocontext)
+	step := ir.Steps[len(ir.Steps)-1]
+	want := []string{"seccomp", "--profile", "default", "--"}
+	if len(step.Args) < len(want) || !cmp.Equal(step.Args[:len(want)], want) {
+		t.Errorf("Expect seccomp profile for untrusted repository, got %v", step.Args)
+	}
+
+	compiler.Repo.Trusted = true
+	ir = compiler.Compile(nocontext)
+	step = ir.Steps[len(ir.Steps)-1]
+	if len(step.Args) != 0 && step.Args[0] == "seccomp" {
+		t.Errorf("Expect no seccomp profile for trusted repository")
+	}
+}
+
+// This test verifies that the clone step is executed with
+// the seccomp profile and resource limits of the pipeline.
+func TestCompile_CloneSecurity(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/security.yml")
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(nil)
+	compiler.Seccomp = "default"
+	compiler.Ulimits = map[string]int64{"nproc": 512}
+
+	ir := compiler.Compile(nocontext)
+	step := ir.Steps[0]
+	if step.Name != "clone" {
+		t.Fatalf("Expect clone step, got %s", step.Name)
+	}
+	args := strings.Join(step.Args, " ")
+	if !strings.HasPrefix(args, "seccomp --profile default -- ") {
+		t.Errorf("Expect seccomp profile for clone step, got %v", step.Args)
+	}
+	if !strings.Contains(args, " ulimit --limit nproc=512 -- ") {
+		t.Errorf("Expect resource limits for clone step, got %v", step.Args)
+	}
+}
+
+// This test verifies that the sandbox profile is selected by
+// the trust level of the repository, and is rendered for the
+// pipeline root.
+func TestCompile_Sandbox(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/security.yml")
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(nil)
+	compiler.Sandbox, _ = sandbox.Parse(`(allow file-write* (subpath "{{ .Workspace }}"))`)
+
+	ir := compiler.Compile(nocontext)
+	for _, step := range ir.Steps {
+		if !strings.Contains(step.Sandbox, filepath.Join("drone", "src")) {
+			t.Errorf("Expect sandbox profile rendered for untrusted repository, got %q", step.Sandbox)
+		}
+	}
+
+	compiler.Repo.Trusted = true
+	ir = compiler.Compile(nocontext)
+	for _, step := range ir.Steps {
+		if step.Sandbox != "" {
+			t.Errorf("Expect no sandbox profile for trusted repository")
+		}
+	}
+}
+
+// This test verifies that each pipeline is executed in a
+// dedicated jail named after the pipeline root.
+func TestCompile_Jail(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/security.yml")
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(nil)
+	compiler.Root = "/var/drone"
+	compiler.Jail = &engine.Jail{
+		Template: "zroot/jails/template@base",
+		Dataset:  "zroot/jails/drone",
+		Path:     "/usr/local/drone/jails",
+	}
+
+	random = notRandom
+	defer func() {
+		random = uniuri.New
+	}()
+
+	ir := compiler.Compile(nocontext)
+	want := &engine.Jail{
+		Name:     "drone-random",
+		Template: "zroot/jails/template@base",
+		Dataset:  "zroot/jails/drone/drone-random",
+		Path:     "/usr/local/drone/jails/drone-random",
+	}
+	if diff := cmp.Diff(want, ir.Jail); diff != "" {
+		t.Errorf("Unexpected jail")
+		t.Log(diff)
+	}
+}
+
+// This test verifies that each pipeline is executed in a
+// dedicated zone named after the pipeline root.
+func TestCompile_Zone(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/security.yml")
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(nil)
+	compiler.Root = "/var/drone"
+	compiler.Zone = &engine.Zone{
+		Template: "drone-template",
+		Path:     "/zones/drone",
+	}
+
+	random = notRandom
+	defer func() {
+		random = uniuri.New
+	}()
+
+	ir := compiler.Compile(nocontext)
+	want := &engine.Zone{
+		Name:     "drone-random",
+		Template: "drone-template",
+		Path:     "/zones/drone/drone-random",
+	}
+	if diff := cmp.Diff(want, ir.Zone); diff != "" {
+		t.Errorf("Unexpected zone")
+		t.Log(diff)
+	}
+}
+
+// This test verifies that the configured default shell is
+// used for the clone step and steps without a shell, which is
+// required to execute the stage on a remote windows host.
+func TestCompile_Shell(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/security.yml")
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(nil)
+	compiler.Root = "C:/drone"
+	compiler.Shell = script.Powershell
+
+	random = notRandom
+	defer func() {
+		random = uniuri.New
+	}()
+
+	ir := compiler.Compile(nocontext)
+	for _, step := range ir.Steps {
+		if got, want := step.Command, "powershell"; got != want {
+			t.Errorf("Want step %s command %s, got %s", step.Name, want, got)
+		}
+		if got, want := step.Files[0].Path, ".ps1"; !strings.HasSuffix(got, want) {
+			t.Errorf("Want step %s script %s with suffix %s", step.Name, got, want)
+		}
+	}
+}
+
+// This test verifies that steps with an entrypoint execute
+// the binary directly, and that arguments are passed through
+// without shell interpretation.
+func TestCompile_Entrypoint(t *testing.T) {
+	manifest, err := manifest.ParseFile("testdata/entrypoint.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(nil)
+
+	ir := compiler.Compile(nocontext)
+	step := ir.Steps[0]
+	if got, want := step.Command, "go"; got != want {
+		t.Errorf("Want command %q, got %q", want, got)
+	}
+	want := []string{"build", "-ldflags=-X main.version=$DRONE_TAG", "./..."}
+	if diff := cmp.Diff(want, step.Args); diff != "" {
+		t.Errorf("Expect arguments passed through unmodified")
+		t.Log(diff)
+	}
+	if len(step.Files) != 0 {
+		t.Errorf("Expect no build script for entrypoint steps")
+	}
+}
+
 // This test verifies that secrets defined in the yaml are
 // requested and stored in the intermediate representation
 // at compile time.
+func TestCompile_InheritEnvironment(t *testing.T) {
+	defer func() {
+		getenv = os.Getenv
+	}()
+	getenv = func(s string) string {
+		return map[string]string{
+			"PATH": "/usr/local/bin:/usr/bin",
+			"USER": "drone",
+		}[s]
+	}
+
+	manifest, err := manifest.ParseFile("testdata/inherit.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Environ = map[string]string{"GOPROXY": "direct"}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(nil)
+
+	ir := compiler.Compile(nocontext)
+	build, deploy := ir.Steps[0].Envs, ir.Steps[1].Envs
+	if got, want := build["PATH"], "/usr/local/bin:/usr/bin"; got != want {
+		t.Errorf("Want host PATH %q, got %q", want, got)
+	}
+	if got, want := build["GOFLAGS"], "-mod=vendor"; got != want {
+		t.Errorf("Want step environment %q, got %q", want, got)
+	}
+	if _, ok := build["USER"]; ok {
+		t.Errorf("Expect host environment not inherited")
+	}
+	if _, ok := build["GOPROXY"]; ok {
+		t.Errorf("Expect runner environment not inherited")
+	}
+	if build["DRONE_WORKSPACE"] == "" {
+		t.Errorf("Expect drone environment variables")
+	}
+	if deploy["USER"] != "drone" || deploy["GOPROXY"] != "direct" {
+		t.Errorf("Expect step to override pipeline inheritance")
+	}
+}
+
+// this test verifies the netrc credentials are served by the
+// credential helper socket, and are not written to disk.
+func TestCompile_CredentialHelper(t *testing.T) {
+	if !credential.Supported {
+		t.Skip("credential helper not supported")
+	}
+	manifest, err := manifest.ParseFile("testdata/serial.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Netrc = &drone.Netrc{Machine: "github.com", Login: "octocat", Password: "correct-horse"}
+	compiler.CredentialHelper = true
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(nil)
+
+	ir := compiler.Compile(nocontext)
+	if ir.Credential == nil {
+		t.Fatalf("Expect credential helper configured")
+	}
+	if got, want := ir.Credential.Password, "correct-horse"; got != want {
+		t.Errorf("Want credential password %q, got %q", want, got)
+	}
+	for _, file := range ir.Files {
+		if bytes.Contains(file.Data, []byte("correct-horse")) {
+			t.Errorf("Expect credentials not written to disk")
+		}
+	}
+	for _, step := range ir.Steps {
+		if !strings.Contains(step.Envs["GIT_CONFIG_VALUE_1"], ir.Credential.Socket) {
+			t.Errorf("Expect git credential helper configured for step %s", step.Name)
+		}
+	}
+}
+
+// this test verifies the artifacts directory is created and
+// exposed to pipeline steps when artifact handoff is enabled.
+func TestCompile_Artifacts(t *testing.T) {
+	manifest, err := manifest.ParseFile("testdata/serial.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Pipeline.Artifacts = []string{"dist"}
+	compiler.Secret = secret.StaticVars(nil)
+
+	if ir := compiler.Compile(nocontext); ir.Artifacts != nil {
+		t.Errorf("Expect artifact handoff disabled by default")
+	}
+
+	compiler.Artifacts = true
+	ir := compiler.Compile(nocontext)
+	if ir.Artifacts == nil {
+		t.Fatalf("Expect artifact handoff enabled")
+	}
+	if diff := cmp.Diff(ir.Artifacts.Paths, []string{"dist"}); diff != "" {
+		t.Errorf("Expect artifact paths copied from the pipeline")
+		t.Log(diff)
+	}
+	for _, step := range ir.Steps {
+		if got, want := step.Envs["DRONE_ARTIFACTS"], ir.Artifacts.Dir; got != want {
+			t.Errorf("Want artifacts directory %q, got %q", want, got)
+		}
+	}
+}
+
+// this test verifies the runner helpers are installed to the
+// pipeline bin directory, which is prepended to the step path.
+func TestCompile_Helpers(t *testing.T) {
+	manifest, err := manifest.ParseFile("testdata/serial.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(nil)
+	compiler.Helpers = true
+
+	ir := compiler.Compile(nocontext)
+	bindir := filepath.Join(ir.Root, "opt", "bin")
+	var found bool
+	for _, file := range ir.Files {
+		if filepath.Dir(file.Path) == bindir && strings.HasPrefix(filepath.Base(file.Path), "drone-wait") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expect drone-wait helper installed")
+	}
+	for _, step := range ir.Steps {
+		if got := step.Envs[pathVar]; !strings.HasPrefix(got, bindir) {
+			t.Errorf("Expect helpers on the path of step %s, got %q", step.Name, got)
+		}
+	}
+}
+
+// this test verifies the runner toolbox is added to the step
+// path, and that steps can opt out of the toolbox.
+func TestCompile_Toolbox(t *testing.T) {
+	manifest, err := manifest.ParseFile("testdata/serial.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiler := Compiler{}
+	compiler.Build = &drone.Build{}
+	compiler.Repo = &drone.Repo{}
+	compiler.Stage = &drone.Stage{}
+	compiler.System = &drone.System{}
+	compiler.Manifest = manifest
+	compiler.Pipeline = manifest.Resources[0].(*resource.Pipeline)
+	compiler.Secret = secret.StaticVars(nil)
+	compiler.Toolbox = filepath.Join("/opt", "drone", "toolbox", "1.2.3")
+
+	ir := compiler.Compile(nocontext)
+	for _, step := range ir.Steps {
+		if got := step.Envs[pathVar]; !strings.HasPrefix(got, compiler.Toolbox) {
+			t.Errorf("Expect toolbox on the path of step %s, got %q", step.Name, got)
+		}
+		if got, want := step.Envs["DRONE_TOOLBOX_VERSION"], "1.2.3"; got != want {
+			t.Errorf("Want toolbox version %s, got %s", want, got)
+		}
+	}
+
+	compiler.Environ = map[string]string{"DRONE_TOOLBOX_DISABLED": "true"}
+	ir = compiler.Compile(nocontext)
+	for _, step := range ir.Steps[1:] {
+		if got := step.Envs[pathVar]; strings.Contains(got, compiler.Toolbox) {
+			t.Errorf("Expect toolbox removed from the path of step %s, got %q", step.Name, got)
+		}
+	}
+}
+
 func TestCompile_Secrets(t *testing.T) {
 	manifest, _ := manifest.ParseFile("testdata/secret.yml")
 	compiler := Compiler{}
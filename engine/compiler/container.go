@@ -0,0 +1,141 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/engine/resource"
+	"github.com/drone-runners/drone-runner-exec/engine/script"
+
+	"github.com/gosimple/slug"
+)
+
+// default functions to get the user and group ids.
+var (
+	getuid = os.Getuid
+	getgid = os.Getgid
+)
+
+// helper function configures the step to execute in a
+// container using the docker or podman command line. The
+// pipeline root is mounted at the same path, and the step
+// uses the host network, so that paths and ports are
+// consistent with the steps executing natively. Steps that
+// disable the network are attached to no network instead.
+func configureContainer(spec *engine.Spec, src *resource.Step, dst *engine.Step, ulimits map[string]int64) {
+	name := fmt.Sprintf("%s-%s", filepath.Base(spec.Root), slug.Make(src.Name))
+	network := "host"
+	if src.Network == resource.NetworkNone {
+		network = "none"
+	}
+	args := []string{
+		"run", "--rm",
+		"--name", name,
+		"--network", network,
+		"--volume", spec.Root + ":" + spec.Root,
+		"--workdir", dst.WorkingDir,
+	}
+
+	// files created in the workspace are owned by the runner
+	// user, so they can be removed when the pipeline completes.
+	if uid := getuid(); uid > 0 {
+		args = append(args, "--user", fmt.Sprintf("%d:%d", uid, getgid()))
+	}
+
+	// host aliases are added to the container hosts file.
+	if spec.Hosts != nil {
+		for _, alias := range spec.Hosts.Aliases {
+			for _, name := range alias.Hostnames {
+				args = append(args, "--add-host", name+":"+alias.IP)
+			}
+		}
+	}
+
+	// resource limits are applied to the container, since
+	// limits applied to the command line are not inherited.
+	for _, name := range sortedKeys(ulimits) {
+		args = append(args, "--ulimit", fmt.Sprintf("%s=%d", name, ulimits[name]))
+	}
+
+	// the environment is forwarded to the container by name
+	// to prevent secrets from being exposed in the process
+	// arguments. host variables are excluded, since they are
+	// not applicable to the container.
+	excluded := map[string]bool{}
+	for _, name := range hostVars {
+		excluded[name] = true
+	}
+	var names []string
+	for name := range dst.Envs {
+		if !excluded[name] {
+			names = append(names, name)
+		}
+	}
+	for _, secret := range dst.Secrets {
+		if secret.Env != "" {
+			names = append(names, secret.Env)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "--env", name)
+	}
+
+	// steps that define commands execute a posix shell script
+	// written to the pipeline root, steps that define an
+	// entrypoint override the container entrypoint, otherwise
+	// the container entrypoint is executed, as is the case
+	// for plugins.
+	switch {
+	case len(src.Entrypoint) != 0:
+		args = append(args, "--entrypoint", src.Entrypoint[0], src.Image)
+		args = append(args, src.Entrypoint[1:]...)
+		args = append(args, src.Args...)
+		dst.Files = nil
+	case len(src.Commands) == 0:
+		args = append(args, src.Image)
+		dst.Files = nil
+	default:
+		path := filepath.Join(spec.Root, "opt", slug.Make(src.Name))
+		dst.Files = []*engine.File{
+			{
+				Path: path,
+				Mode: 0700,
+				Data: []byte(script.Sh.Script(src.Commands, script.Options{
+					Quiet: src.Quiet,
+					Trace: src.Trace,
+				})),
+			},
+		}
+		command, flags := script.Sh.Exec(path)
+		args = append(args, "--entrypoint", command, src.Image)
+		args = append(args, flags...)
+	}
+
+	dst.Command = src.Runtime
+	dst.Args = args
+	dst.Stop = []string{src.Runtime, "rm", "--force", name}
+}
+
+// default function returns the runner executable.
+var executable = os.Executable
+
+// helper function configures the step to execute the wasi
+// module using the runner executable, which embeds the wasi
+// runtime.
+func configureWasi(src *resource.Step, dst *engine.Step) {
+	command, err := executable()
+	if err != nil {
+		command = os.Args[0]
+	}
+	dst.Command = command
+	dst.Args = []string{"wasi", src.Image}
+	dst.Files = nil
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"os"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/engine/resource"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_configureContainer(t *testing.T) {
+	getuid = func() int { return 1000 }
+	getgid = func() int { return 1000 }
+	defer func() {
+		getuid = os.Getuid
+		getgid = os.Getgid
+	}()
+
+	spec := &engine.Spec{Root: "/tmp/drone-random"}
+	src := &resource.Step{
+		Name:     "lint",
+		Image:    "golangci/golangci-lint",
+		Runtime:  "docker",
+		Commands: []string{"golangci-lint run"},
+	}
+	dst := &engine.Step{
+		Envs: map[string]string{
+			"PATH":      "/usr/bin",
+			"CI":        "true",
+			"DRONE_TAG": "v1.0.0",
+		},
+		Secrets:    []*engine.Secret{{Name: "token", Env: "TOKEN"}},
+		WorkingDir: "/tmp/drone-random/drone/src",
+	}
+	configureContainer(spec, src, dst, nil)
+
+	want := []string{
+		"run", "--rm",
+		"--name", "drone-random-lint",
+		"--network", "host",
+		"--volume", "/tmp/drone-random:/tmp/drone-random",
+		"--workdir", "/tmp/drone-random/drone/src",
+		"--user", "1000:1000",
+		"--env", "CI",
+		"--env", "DRONE_TAG",
+		"--env", "TOKEN",
+		"--entrypoint", "/bin/sh", "golangci/golangci-lint",
+		"-e", "/tmp/drone-random/opt/lint",
+	}
+	if got := dst.Command; got != "docker" {
+		t.Errorf("Want command docker, got %s", got)
+	}
+	if diff := cmp.Diff(want, dst.Args); diff != "" {
+		t.Errorf(diff)
+	}
+	if diff := cmp.Diff([]string{"docker", "rm", "--force", "drone-random-lint"}, dst.Stop); diff != "" {
+		t.Errorf(diff)
+	}
+	if len(dst.Files) != 1 || dst.Files[0].Path != "/tmp/drone-random/opt/lint" {
+		t.Errorf("Expect build script written to the pipeline root")
+	}
+}
+
+func Test_configureContainer_Plugin(t *testing.T) {
+	spec := &engine.Spec{Root: "/tmp/drone-random"}
+	src := &resource.Step{
+		Name:    "notify",
+		Image:   "plugins/slack",
+		Runtime: "podman",
+	}
+	dst := &engine.Step{Files: []*engine.File{{Path: "/tmp/drone-random/opt/notify"}}}
+	configureContainer(spec, src, dst, nil)
+
+	if got := dst.Args[len(dst.Args)-1]; got != "plugins/slack" {
+		t.Errorf("Expect container entrypoint executed, got args %v", dst.Args)
+	}
+	if len(dst.Files) != 0 {
+		t.Errorf("Expect no build script for plugin containers")
+	}
+	if got := dst.Command; got != "podman" {
+		t.Errorf("Want command podman, got %s", got)
+	}
+}
+
+func Test_configureContainer_Entrypoint(t *testing.T) {
+	spec := &engine.Spec{Root: "/tmp/drone-random"}
+	src := &resource.Step{
+		Name:       "lint",
+		Image:      "golang",
+		Runtime:    "docker",
+		Entrypoint: []string{"go", "vet"},
+		Args:       []string{"./..."},
+	}
+	dst := &engine.Step{Files: []*engine.File{{Path: "/tmp/drone-random/opt/lint"}}}
+	configureContainer(spec, src, dst, nil)
+
+	want := []string{"--entrypoint", "go", "golang", "vet", "./..."}
+	if diff := cmp.Diff(want, dst.Args[len(dst.Args)-len(want):]); diff != "" {
+		t.Errorf(diff)
+	}
+	if len(dst.Files) != 0 {
+		t.Errorf("Expect no build script for entrypoint containers")
+	}
+}
+
+func Test_configureContainer_Ulimits(t *testing.T) {
+	spec := &engine.Spec{Root: "/tmp/drone-random"}
+	src := &resource.Step{Name: "test", Image: "golang", Runtime: "docker"}
+	dst := &engine.Step{}
+	configureContainer(spec, src, dst, map[string]int64{"nproc": 512, "nofile": 1024})
+
+	var got []string
+	for i, arg := range dst.Args {
+		if arg == "--ulimit" {
+			got = append(got, dst.Args[i+1])
+		}
+	}
+	want := []string{"nofile=1024", "nproc=512"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func Test_configureContainer_NoNetwork(t *testing.T) {
+	spec := &engine.Spec{Root: "/tmp/drone-random"}
+	src := &resource.Step{Name: "test", Image: "golang", Runtime: "docker", Network: "none"}
+	dst := &engine.Step{}
+	configureContainer(spec, src, dst, nil)
+
+	if got, want := dst.Args[5], "none"; got != want {
+		t.Errorf("Want network %s, got %s", want, got)
+	}
+	if dst.NoNetwork {
+		t.Errorf("Expect container network disabled by the runtime, not the runner")
+	}
+}
+
+func Test_configureContainer_HostAliases(t *testing.T) {
+	spec := &engine.Spec{
+		Root: "/tmp/drone-random",
+		Hosts: &engine.Hosts{
+			Aliases: []*engine.HostAlias{{IP: "10.0.0.5", Hostnames: []string{"api.internal"}}},
+		},
+	}
+	src := &resource.Step{Name: "test", Image: "golang", Runtime: "docker"}
+	dst := &engine.Step{}
+	configureContainer(spec, src, dst, nil)
+
+	var got []string
+	for i, arg := range dst.Args {
+		if arg == "--add-host" {
+			got = append(got, dst.Args[i+1])
+		}
+	}
+	if diff := cmp.Diff([]string{"api.internal:10.0.0.5"}, got); diff != "" {
+		t.Errorf(diff)
+	}
+}
@@ -20,3 +20,20 @@ func hostEnviron() map[string]string {
 	}
 	return envs
 }
+
+// minimalEnviron is a helper function that returns the minimal
+// list of host machine variables required by child processes,
+// for steps that do not inherit the host environment. Runner
+// variables take precedence over host machine variables, so
+// that a custom runner path is honored.
+func minimalEnviron(runner map[string]string) map[string]string {
+	envs := map[string]string{}
+	for _, name := range minimalVars {
+		if value := runner[name]; value != "" {
+			envs[name] = value
+		} else if value := getenv(name); value != "" {
+			envs[name] = value
+		}
+	}
+	return envs
+}
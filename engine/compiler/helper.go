@@ -0,0 +1,29 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !windows
+
+package compiler
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+)
+
+// name of the path environment variable.
+const pathVar = "PATH"
+
+// helper function returns the drone-wait helper, which is a
+// shell script that executes the runner wait command.
+func waitHelper(dir, command string) *engine.File {
+	quoted := "'" + strings.Replace(command, "'", `'\''`, -1) + "'"
+	return &engine.File{
+		Path: filepath.Join(dir, "drone-wait"),
+		Mode: 0755,
+		Data: []byte(fmt.Sprintf("#!/bin/sh\nexec %s wait \"$@\"\n", quoted)),
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build windows
+
+package compiler
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+)
+
+// name of the path environment variable.
+const pathVar = "Path"
+
+// helper function returns the drone-wait helper, which is a
+// batch file that executes the runner wait command.
+func waitHelper(dir, command string) *engine.File {
+	return &engine.File{
+		Path: filepath.Join(dir, "drone-wait.cmd"),
+		Mode: 0755,
+		Data: []byte(fmt.Sprintf("@\"%s\" wait %%*\r\n", command)),
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone/runner-go/manifest"
+)
+
+// helper function returns the host binary used to execute
+// the plugin image. The image is looked up in the plugin
+// table, with and without the image tag. If the image is not
+// found, the binary defaults to the drone-<name> convention
+// (e.g. plugins/slack maps to drone-slack).
+func pluginCommand(plugins map[string]string, image string) string {
+	if command, ok := plugins[image]; ok {
+		return command
+	}
+	name := trimTag(image)
+	if command, ok := plugins[name]; ok {
+		return command
+	}
+	return "drone-" + path.Base(name)
+}
+
+// helper function removes the tag and digest from the image.
+func trimTag(image string) string {
+	if i := strings.Index(image, "@"); i != -1 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// helper function converts the plugin settings to PLUGIN_
+// prefixed environment variables, returning the settings
+// derived from secrets separately.
+func convertSettings(src map[string]*manifest.Parameter) (map[string]string, []*engine.Secret) {
+	envs := map[string]string{}
+	secrets := []*engine.Secret{}
+	for k, v := range src {
+		if v == nil {
+			continue
+		}
+		key := "PLUGIN_" + envName(k)
+		if strings.TrimSpace(v.Secret) != "" {
+			secrets = append(secrets, &engine.Secret{
+				Name: v.Secret,
+				Mask: true,
+				Env:  key,
+			})
+			continue
+		}
+		envs[key] = encodeParam(v.Value)
+	}
+	return envs, secrets
+}
+
+// helper function encodes the parameter value as a string.
+// Lists of scalar values are comma separated, and complex
+// values are json encoded, matching the plugin protocol.
+func encodeParam(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}:
+		var parts []string
+		for _, item := range v {
+			switch item.(type) {
+			case map[interface{}]interface{}, []interface{}:
+				return encodeJSON(v)
+			}
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, ",")
+	case map[interface{}]interface{}:
+		return encodeJSON(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// helper function json encodes the value, converting yaml
+// maps to json compatible maps.
+func encodeJSON(v interface{}) string {
+	out, _ := json.Marshal(jsonValue(v))
+	return string(out)
+}
+
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, item := range v {
+			m[fmt.Sprint(k)] = jsonValue(item)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, item := range v {
+			s[i] = jsonValue(item)
+		}
+		return s
+	default:
+		return v
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone/runner-go/manifest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_pluginCommand(t *testing.T) {
+	plugins := map[string]string{
+		"plugins/slack":    "/usr/local/bin/slack",
+		"plugins/s3:1.2.0": "/opt/s3-1.2.0",
+	}
+	tests := []struct {
+		image, command string
+	}{
+		{"plugins/slack", "/usr/local/bin/slack"},
+		{"plugins/slack:1", "/usr/local/bin/slack"},
+		{"plugins/s3:1.2.0", "/opt/s3-1.2.0"},
+		{"plugins/s3", "drone-s3"},
+		{"plugins/webhook@sha256:abc", "drone-webhook"},
+		{"localhost:5000/plugins/git:latest", "drone-git"},
+	}
+	for _, test := range tests {
+		if got, want := pluginCommand(plugins, test.image), test.command; got != want {
+			t.Errorf("Want command %q for image %q, got %q", want, test.image, got)
+		}
+	}
+}
+
+func Test_convertSettings(t *testing.T) {
+	settings := map[string]*manifest.Parameter{
+		"channel":  {Value: "dev"},
+		"retries":  {Value: 3},
+		"debug":    {Value: true},
+		"tags":     {Value: []interface{}{"latest", 1}},
+		"template": {Value: map[interface{}]interface{}{"color": "green"}},
+		"webhook":  {Secret: "slack_webhook"},
+	}
+	envs, secrets := convertSettings(settings)
+
+	wantEnvs := map[string]string{
+		"PLUGIN_CHANNEL":  "dev",
+		"PLUGIN_RETRIES":  "3",
+		"PLUGIN_DEBUG":    "true",
+		"PLUGIN_TAGS":     "latest,1",
+		"PLUGIN_TEMPLATE": `{"color":"green"}`,
+	}
+	if diff := cmp.Diff(wantEnvs, envs); diff != "" {
+		t.Errorf(diff)
+	}
+	wantSecrets := []*engine.Secret{
+		{Name: "slack_webhook", Env: "PLUGIN_WEBHOOK", Mask: true},
+	}
+	if diff := cmp.Diff(wantSecrets, secrets); diff != "" {
+		t.Errorf(diff)
+	}
+}
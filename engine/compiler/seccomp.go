@@ -0,0 +1,29 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !windows
+
+package compiler
+
+import (
+	"os"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+)
+
+// helper function configures the step to execute using the
+// runner executable, which applies the seccomp profile before
+// replacing itself with the step command.
+func configureSeccomp(dst *engine.Step, profile string) {
+	if profile == "" {
+		return
+	}
+	command, err := executable()
+	if err != nil {
+		command = os.Args[0]
+	}
+	args := []string{"seccomp", "--profile", profile, "--", dst.Command}
+	dst.Args = append(args, dst.Args...)
+	dst.Command = command
+}
@@ -0,0 +1,13 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build windows
+
+package compiler
+
+import "github.com/drone-runners/drone-runner-exec/engine"
+
+// helper function configures the step seccomp profile. Windows
+// does not support seccomp and the step is unmodified.
+func configureSeccomp(dst *engine.Step, profile string) {}
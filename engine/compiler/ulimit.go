@@ -0,0 +1,34 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !windows
+
+package compiler
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+)
+
+// helper function configures the step to execute using the
+// runner executable, which sets the resource limits before
+// replacing itself with the step command.
+func configureUlimits(dst *engine.Step, ulimits map[string]int64) {
+	if len(ulimits) == 0 {
+		return
+	}
+	command, err := executable()
+	if err != nil {
+		command = os.Args[0]
+	}
+	args := []string{"ulimit"}
+	for _, name := range sortedKeys(ulimits) {
+		args = append(args, "--limit", fmt.Sprintf("%s=%d", name, ulimits[name]))
+	}
+	args = append(args, "--", dst.Command)
+	dst.Args = append(args, dst.Args...)
+	dst.Command = command
+}
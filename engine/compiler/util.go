@@ -5,7 +5,15 @@
 package compiler
 
 import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/drone-runners/drone-runner-exec/engine"
 	"github.com/drone-runners/drone-runner-exec/engine/resource"
@@ -34,6 +42,37 @@ func isRunOnFailure(step *resource.Step) bool {
 	return step.When.Status.Match(drone.StatusFailing)
 }
 
+// eventCustom is the event of builds created with the api.
+const eventCustom = "custom"
+
+// helper function returns the build with the custom event name
+// as the build action. Custom builds created with the api
+// provide the event name with the DRONE_BUILD_ACTION parameter,
+// and unknown events are treated as custom events named after
+// the event.
+func customEvent(build *drone.Build) *drone.Build {
+	if build == nil {
+		return build
+	}
+	var action string
+	switch build.Event {
+	case drone.EventPush, drone.EventPullRequest, drone.EventTag,
+		drone.EventPromote, drone.EventRollback, "cron", "":
+		return build
+	case eventCustom:
+		if build.Action != "" || build.Params["DRONE_BUILD_ACTION"] == "" {
+			return build
+		}
+		action = build.Params["DRONE_BUILD_ACTION"]
+	default:
+		action = build.Event
+	}
+	copy := *build
+	copy.Event = eventCustom
+	copy.Action = action
+	return &copy
+}
+
 // helper function returns true if the pipeline specification
 // manually defines an execution graph.
 func isGraph(spec *engine.Spec) bool {
@@ -57,6 +96,30 @@ func configureSerial(spec *engine.Spec) {
 	}
 }
 
+// summaryStep is the name of the summary step.
+const summaryStep = "summary"
+
+// helper function adds the summary step, which depends on all
+// other steps so that it runs once the other steps complete.
+// The summary step is not added if a step of the same name
+// exists.
+func configureSummary(spec *engine.Spec) {
+	var deps []string
+	for _, step := range spec.Steps {
+		if step.Name == summaryStep {
+			return
+		}
+		deps = append(deps, step.Name)
+	}
+	spec.Steps = append(spec.Steps, &engine.Step{
+		Name:      summaryStep,
+		DependsOn: deps,
+		Envs:      map[string]string{},
+		RunPolicy: engine.RunAlways,
+		Summary:   true,
+	})
+}
+
 // helper function converts the environment variables to a map,
 // returning only inline environment variables not derived from
 // a secret.
@@ -87,6 +150,31 @@ func convertSecretEnv(src map[string]*manifest.Variable) []*engine.Secret {
 	return dst
 }
 
+// helper function converts the secret files to a list of
+// secrets written to the secrets directory, and returns the
+// environment variables used to expose the file paths. Files
+// that resolve outside of the secrets directory are ignored.
+func convertSecretFiles(src map[string]*manifest.Variable, dir string) ([]*engine.Secret, map[string]string) {
+	secrets := []*engine.Secret{}
+	envs := map[string]string{}
+	for k, v := range src {
+		if strings.TrimSpace(v.Secret) == "" {
+			continue
+		}
+		path := filepath.Join(dir, k)
+		if filepath.Dir(path) != filepath.Clean(dir) {
+			continue
+		}
+		secrets = append(secrets, &engine.Secret{
+			Name: v.Secret,
+			Mask: true,
+			File: path,
+		})
+		envs["DRONE_SECRET_FILE_"+envName(k)] = path
+	}
+	return secrets, envs
+}
+
 // helper function modifies the pipeline dependency graph to
 // account for the clone step.
 func configureCloneDeps(spec *engine.Spec) {
@@ -115,3 +203,259 @@ func removeCloneDeps(spec *engine.Spec) {
 		}
 	}
 }
+
+// regular expression matches characters that are not valid
+// in an environment variable name.
+var envre = regexp.MustCompile("[^A-Z0-9_]")
+
+// helper function converts the name to a valid environment
+// variable name.
+func envName(name string) string {
+	return envre.ReplaceAllString(strings.ToUpper(name), "_")
+}
+
+// helper function returns the environment variables used to
+// expose the allocated ports to the pipeline steps.
+func portsEnviron(ports map[string]int) map[string]string {
+	envs := map[string]string{}
+	for name, port := range ports {
+		envs["DRONE_PORT_"+envName(name)] = strconv.Itoa(port)
+	}
+	return envs
+}
+
+// helper function returns the environment variables used to
+// configure git to request credentials from the runner using
+// the credential helper socket. The empty helper resets the
+// list of helpers defined in the git configuration files.
+func credentialEnviron(socket string) map[string]string {
+	command, err := executable()
+	if err != nil {
+		command = os.Args[0]
+	}
+	return map[string]string{
+		"GIT_CONFIG_COUNT":   "2",
+		"GIT_CONFIG_KEY_0":   "credential.helper",
+		"GIT_CONFIG_VALUE_0": "",
+		"GIT_CONFIG_KEY_1":   "credential.helper",
+		"GIT_CONFIG_VALUE_1": fmt.Sprintf("!'%s' credential '%s'", command, socket),
+	}
+}
+
+// helper function returns the environment variables used to
+// connect to the service.
+func serviceEnviron(src *resource.Step) map[string]string {
+	name := envName(src.Name)
+	envs := map[string]string{
+		"DRONE_SERVICE_" + name + "_HOST": "localhost",
+	}
+	if src.Ready != nil && src.Ready.TCP != "" {
+		_, port, err := net.SplitHostPort(src.Ready.TCP)
+		if err != nil {
+			port = src.Ready.TCP
+		}
+		envs["DRONE_SERVICE_"+name+"_PORT"] = port
+	}
+	return envs
+}
+
+// helper function converts the readiness probe to the
+// intermediate representation.
+func convertProbe(src *resource.Probe) *engine.Probe {
+	if src == nil {
+		return nil
+	}
+	dst := &engine.Probe{
+		HTTP:     src.HTTP,
+		Timeout:  time.Duration(src.Timeout),
+		Interval: time.Duration(src.Interval),
+	}
+	if src.TCP != "" {
+		dst.TCP = src.TCP
+		// if only the port is provided the probe defaults
+		// to the local host.
+		if _, _, err := net.SplitHostPort(src.TCP); err != nil {
+			dst.TCP = net.JoinHostPort("localhost", src.TCP)
+		}
+	}
+	if src.Command != "" {
+		dst.Command, dst.Args = inlineCommand(src.Command)
+	}
+	return dst
+}
+
+// helper function converts the path condition to the
+// intermediate representation. Include patterns prefixed with
+// an exclamation mark are converted to exclude patterns. A nil
+// value is returned if the condition is empty.
+func convertPaths(src manifest.Condition) *engine.Paths {
+	if len(src.Include) == 0 && len(src.Exclude) == 0 {
+		return nil
+	}
+	dst := &engine.Paths{
+		Exclude: append([]string{}, src.Exclude...),
+	}
+	for _, pattern := range src.Include {
+		if strings.HasPrefix(pattern, "!") {
+			dst.Exclude = append(dst.Exclude, strings.TrimPrefix(pattern, "!"))
+		} else {
+			dst.Include = append(dst.Include, pattern)
+		}
+	}
+	return dst
+}
+
+// helper function configures a sparse checkout of the paths,
+// which is inserted into the clone commands once the remote is
+// added. Blobs are fetched on demand, so that only the blobs of
+// the checked out paths are downloaded.
+func sparseCheckout(commands, paths []string) []string {
+	if len(paths) == 0 {
+		return commands
+	}
+	var out []string
+	for _, command := range commands {
+		out = append(out, command)
+		if strings.HasPrefix(command, "git remote add origin") {
+			out = append(out,
+				"git config remote.origin.promisor true",
+				"git config remote.origin.partialclonefilter blob:none",
+				"git sparse-checkout init --cone",
+				"git sparse-checkout set "+strings.Join(paths, " "),
+			)
+		}
+	}
+	return out
+}
+
+// helper function returns true if the step inherits the host
+// machine and runner environment. The step setting takes
+// precedence over the pipeline setting.
+func inheritEnviron(pipeline *resource.Pipeline, step *resource.Step) bool {
+	if step.InheritEnvironment != nil {
+		return *step.InheritEnvironment
+	}
+	if pipeline.InheritEnvironment != nil {
+		return *pipeline.InheritEnvironment
+	}
+	return true
+}
+
+// helper function combines the octal umask values. A nil value
+// is returned if no umask is defined.
+func convertUmask(masks ...string) *uint32 {
+	var umask uint32
+	var found bool
+	for _, mask := range masks {
+		v, err := strconv.ParseUint(mask, 8, 9)
+		if err != nil {
+			continue
+		}
+		umask |= uint32(v)
+		found = true
+	}
+	if !found {
+		return nil
+	}
+	return &umask
+}
+
+// helper function combines the resource limits. The step limits
+// take precedence over the pipeline limits, and the runner limits
+// define the maximum limits. A nil value is returned if no limits
+// are defined.
+func convertUlimits(runner, pipeline, step map[string]int64) map[string]int64 {
+	ulimits := map[string]int64{}
+	for name, value := range pipeline {
+		ulimits[name] = value
+	}
+	for name, value := range step {
+		ulimits[name] = value
+	}
+	for name, max := range runner {
+		if value, ok := ulimits[name]; !ok || value > max {
+			ulimits[name] = max
+		}
+	}
+	if len(ulimits) == 0 {
+		return nil
+	}
+	return ulimits
+}
+
+// helper function combines the host aliases, grouped by ip
+// address in hostname order. The runner aliases take
+// precedence over the pipeline aliases.
+func convertHosts(pipeline []*resource.HostAlias, runner map[string]string) []*engine.HostAlias {
+	ips := map[string]string{}
+	for _, alias := range pipeline {
+		for _, name := range alias.Hostnames {
+			ips[name] = alias.IP
+		}
+	}
+	for name, ip := range runner {
+		ips[name] = ip
+	}
+	var names []string
+	for name := range ips {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var aliases []*engine.HostAlias
+	index := map[string]*engine.HostAlias{}
+	for _, name := range names {
+		ip := ips[name]
+		alias, ok := index[ip]
+		if !ok {
+			alias = &engine.HostAlias{IP: ip}
+			index[ip] = alias
+			aliases = append(aliases, alias)
+		}
+		alias.Hostnames = append(alias.Hostnames, name)
+	}
+	return aliases
+}
+
+// helper function returns the directories of the runner
+// helpers and toolbox, which are prepended to the step path.
+func (c *Compiler) toolpath(spec *engine.Spec) string {
+	var dirs []string
+	if c.Helpers {
+		dirs = append(dirs, filepath.Join(spec.Root, "opt", "bin"))
+	}
+	if c.Toolbox != "" {
+		dirs = append(dirs, c.Toolbox)
+	}
+	return strings.Join(dirs, string(os.PathListSeparator))
+}
+
+// helper function returns the environment variables that
+// expose the toolbox directory and version to the steps. The
+// toolbox directory is named after the runner version.
+func toolboxEnviron(toolbox string) map[string]string {
+	if toolbox == "" {
+		return nil
+	}
+	return map[string]string{
+		"DRONE_TOOLBOX":         toolbox,
+		"DRONE_TOOLBOX_VERSION": filepath.Base(toolbox),
+	}
+}
+
+// helper function prepends the directory to the path list.
+func prependPath(dir, path string) string {
+	if path == "" {
+		return dir
+	}
+	return dir + string(os.PathListSeparator) + path
+}
+
+// helper function returns the map keys in sorted order.
+func sortedKeys(m map[string]int64) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
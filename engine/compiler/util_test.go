@@ -9,6 +9,7 @@ import (
 
 	"github.com/drone-runners/drone-runner-exec/engine"
 	"github.com/drone-runners/drone-runner-exec/engine/resource"
+	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/manifest"
 
 	"github.com/google/go-cmp/cmp"
@@ -87,6 +88,38 @@ func Test_configureSerial(t *testing.T) {
 	}
 }
 
+func Test_configureSummary(t *testing.T) {
+	spec := new(engine.Spec)
+	spec.Steps = []*engine.Step{
+		{Name: "build"},
+		{Name: "test", DependsOn: []string{"build"}},
+	}
+	configureSummary(spec)
+
+	want := &engine.Step{
+		Name:      "summary",
+		DependsOn: []string{"build", "test"},
+		Envs:      map[string]string{},
+		RunPolicy: engine.RunAlways,
+		Summary:   true,
+	}
+	if len(spec.Steps) != 3 {
+		t.Fatalf("Want summary step added")
+	}
+	if diff := cmp.Diff(spec.Steps[2], want); diff != "" {
+		t.Errorf("Unexpected summary step")
+		t.Log(diff)
+	}
+
+	// the summary step is not added if a step of the same
+	// name exists.
+	spec.Steps = []*engine.Step{{Name: "summary"}}
+	configureSummary(spec)
+	if len(spec.Steps) != 1 {
+		t.Errorf("Want summary step not added")
+	}
+}
+
 func Test_convertStaticEnv(t *testing.T) {
 	vars := map[string]*manifest.Variable{
 		"username": &manifest.Variable{Value: "octocat"},
@@ -119,6 +152,76 @@ func Test_convertSecretEnv(t *testing.T) {
 	}
 }
 
+func Test_convertPaths(t *testing.T) {
+	if got := convertPaths(manifest.Condition{}); got != nil {
+		t.Errorf("Want nil paths for empty condition")
+	}
+	got := convertPaths(manifest.Condition{
+		Include: []string{"pkg/**", "!docs/**"},
+		Exclude: []string{"**/*.md"},
+	})
+	want := &engine.Paths{
+		Include: []string{"pkg/**"},
+		Exclude: []string{"**/*.md", "docs/**"},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected paths")
+		t.Log(diff)
+	}
+}
+
+func Test_sparseCheckout(t *testing.T) {
+	commands := []string{
+		"git init",
+		"git remote add origin https://github.com/octocat/hello-world.git",
+		"git fetch origin +refs/heads/master:",
+	}
+	if got := sparseCheckout(commands, nil); len(got) != len(commands) {
+		t.Errorf("Want commands unchanged without sparse paths")
+	}
+	got := sparseCheckout(commands, []string{"services/api", "libs/common"})
+	want := []string{
+		"git init",
+		"git remote add origin https://github.com/octocat/hello-world.git",
+		"git config remote.origin.promisor true",
+		"git config remote.origin.partialclonefilter blob:none",
+		"git sparse-checkout init --cone",
+		"git sparse-checkout set services/api libs/common",
+		"git fetch origin +refs/heads/master:",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected clone commands")
+		t.Log(diff)
+	}
+}
+
+func Test_convertSecretFiles(t *testing.T) {
+	vars := map[string]*manifest.Variable{
+		"kubeconfig":      &manifest.Variable{Secret: "kube_config"},
+		"ignored":         &manifest.Variable{Value: "octocat"},
+		"../../opt/clone": &manifest.Variable{Secret: "kube_config"},
+	}
+	secrets, envs := convertSecretFiles(vars, "/tmp/drone/secrets/deploy")
+	want := []*engine.Secret{
+		{
+			Name: "kube_config",
+			File: "/tmp/drone/secrets/deploy/kubeconfig",
+			Mask: true,
+		},
+	}
+	if diff := cmp.Diff(secrets, want); diff != "" {
+		t.Errorf("Unexpected secret list")
+		t.Log(diff)
+	}
+	wantEnvs := map[string]string{
+		"DRONE_SECRET_FILE_KUBECONFIG": "/tmp/drone/secrets/deploy/kubeconfig",
+	}
+	if diff := cmp.Diff(envs, wantEnvs); diff != "" {
+		t.Errorf("Unexpected environment variable set")
+		t.Log(diff)
+	}
+}
+
 func Test_configureCloneDeps(t *testing.T) {
 	before := new(engine.Spec)
 	before.Steps = []*engine.Step{
@@ -189,3 +292,85 @@ func Test_removeCloneDeps_CloneEnabled(t *testing.T) {
 		t.Log(diff)
 	}
 }
+
+func Test_portsEnviron(t *testing.T) {
+	ports := map[string]int{
+		"postgres": 20000,
+		"web-api":  20001,
+	}
+	want := map[string]string{
+		"DRONE_PORT_POSTGRES": "20000",
+		"DRONE_PORT_WEB_API":  "20001",
+	}
+	if diff := cmp.Diff(portsEnviron(ports), want); diff != "" {
+		t.Errorf("Unexpected port environment variables")
+		t.Log(diff)
+	}
+}
+
+func Test_convertUmask(t *testing.T) {
+	if got := convertUmask("", ""); got != nil {
+		t.Errorf("Expect nil umask when not configured")
+	}
+	got := convertUmask("0022", "", "0007")
+	if got == nil || *got != 0027 {
+		t.Errorf("Want combined umask 0027, got %v", got)
+	}
+}
+
+func Test_convertUlimits(t *testing.T) {
+	if got := convertUlimits(nil, nil, nil); got != nil {
+		t.Errorf("Expect nil ulimits when not configured")
+	}
+	got := convertUlimits(
+		map[string]int64{"nofile": 4096, "nproc": 512},
+		map[string]int64{"nofile": 1024, "core": 0},
+		map[string]int64{"nproc": 1024},
+	)
+	want := map[string]int64{"nofile": 1024, "nproc": 512, "core": 0}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Expect runner limits cannot be exceeded")
+		t.Log(diff)
+	}
+}
+
+func Test_convertHosts(t *testing.T) {
+	if got := convertHosts(nil, nil); got != nil {
+		t.Errorf("Expect nil host aliases when not configured")
+	}
+	got := convertHosts(
+		[]*resource.HostAlias{
+			{IP: "10.0.0.5", Hostnames: []string{"api.internal", "db.internal"}},
+		},
+		map[string]string{"db.internal": "10.0.0.6", "cache.internal": "10.0.0.6"},
+	)
+	want := []*engine.HostAlias{
+		{IP: "10.0.0.5", Hostnames: []string{"api.internal"}},
+		{IP: "10.0.0.6", Hostnames: []string{"cache.internal", "db.internal"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Expect runner host aliases take precedence")
+		t.Log(diff)
+	}
+}
+
+func Test_customEvent(t *testing.T) {
+	tests := []struct {
+		build  *drone.Build
+		event  string
+		action string
+	}{
+		{&drone.Build{Event: "push", Action: ""}, "push", ""},
+		{&drone.Build{Event: "pull_request", Action: "opened"}, "pull_request", "opened"},
+		{&drone.Build{Event: "custom"}, "custom", ""},
+		{&drone.Build{Event: "custom", Action: "nightly"}, "custom", "nightly"},
+		{&drone.Build{Event: "custom", Params: map[string]string{"DRONE_BUILD_ACTION": "nightly-perf"}}, "custom", "nightly-perf"},
+		{&drone.Build{Event: "nightly-perf"}, "custom", "nightly-perf"},
+	}
+	for _, test := range tests {
+		got := customEvent(test.build)
+		if got.Event != test.event || got.Action != test.action {
+			t.Errorf("Want event %s and action %q, got %s and %q", test.event, test.action, got.Event, got.Action)
+		}
+	}
+}
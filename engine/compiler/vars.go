@@ -6,6 +6,8 @@
 
 package compiler
 
+import "github.com/drone/runner-go/shell"
+
 // netrc filename
 const netrc = ".netrc"
 
@@ -15,3 +17,16 @@ var hostVars = []string{
 	"PATH",
 	"USER",
 }
+
+// parameters required by child processes when the host
+// environment is not inherited.
+var minimalVars = []string{
+	"PATH",
+}
+
+// helper function returns the command and arguments used to
+// execute an inline shell command.
+func inlineCommand(s string) (string, []string) {
+	cmd, args := shell.Command()
+	return cmd, append(args, "-c", s)
+}
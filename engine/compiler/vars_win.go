@@ -6,6 +6,8 @@
 
 package compiler
 
+import "github.com/drone/runner-go/shell"
+
 // netrc filename
 const netrc = "_netrc"
 
@@ -41,3 +43,19 @@ var hostVars = []string{
 	"USERNAME",
 	"windir",
 }
+
+// parameters required by child processes when the host
+// environment is not inherited.
+var minimalVars = []string{
+	"Path",
+	"PATHEXT",
+	"SystemDrive",
+	"SystemRoot",
+}
+
+// helper function returns the command and arguments used to
+// execute an inline powershell command.
+func inlineCommand(s string) (string, []string) {
+	cmd, args := shell.Command()
+	return cmd, append(args, s)
+}
@@ -0,0 +1,46 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/drone/runner-go/clone"
+)
+
+// helper function returns the commands that fetch the commit
+// into the base clone of the repository, and add the workspace
+// as a detached worktree of the commit. The commands only use
+// git, and are idempotent, so that the base clone is created
+// by the first stage of the repository.
+func worktreeCommands(base, workspace string, args clone.Args) []string {
+	commands := []string{
+		fmt.Sprintf("git init -q --bare %s", base),
+		fmt.Sprintf("git -C %s config remote.origin.url %s", base, args.Remote),
+		fmt.Sprintf("git -C %s worktree prune", base),
+	}
+	switch {
+	case strings.HasPrefix(args.Ref, "refs/tags/"):
+		return append(commands,
+			fmt.Sprintf("git -C %s fetch origin +%s:%s", base, args.Ref, args.Ref),
+			fmt.Sprintf("git -C %s worktree add --detach %s %s", base, workspace, args.Ref),
+		)
+	case strings.HasPrefix(args.Ref, "refs/pull/"),
+		strings.HasPrefix(args.Ref, "refs/pull-requests/"),
+		strings.HasPrefix(args.Ref, "refs/merge-requests/"):
+		return append(commands,
+			fmt.Sprintf("git -C %s fetch origin +refs/heads/%s:refs/remotes/origin/%s", base, args.Branch, args.Branch),
+			fmt.Sprintf("git -C %s fetch origin +%s:%s", base, args.Ref, args.Ref),
+			fmt.Sprintf("git -C %s worktree add --detach %s refs/remotes/origin/%s", base, workspace, args.Branch),
+			fmt.Sprintf("git -C %s merge %s", workspace, args.Commit),
+		)
+	default:
+		return append(commands,
+			fmt.Sprintf("git -C %s fetch origin +refs/heads/%s:refs/remotes/origin/%s", base, args.Branch, args.Branch),
+			fmt.Sprintf("git -C %s worktree add --detach %s %s", base, workspace, args.Commit),
+		)
+	}
+}
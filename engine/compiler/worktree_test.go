@@ -0,0 +1,56 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"testing"
+
+	"github.com/drone/runner-go/clone"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_worktreeCommands(t *testing.T) {
+	args := clone.Args{
+		Branch: "master",
+		Commit: "a6586b3db244fb6b1198f2b25c213ded5b44f9fa",
+		Ref:    "refs/heads/master",
+		Remote: "https://github.com/octocat/hello-world.git",
+	}
+	got := worktreeCommands("/var/lib/drone/octocat/hello-world.git", "/tmp/drone/src", args)
+	want := []string{
+		"git init -q --bare /var/lib/drone/octocat/hello-world.git",
+		"git -C /var/lib/drone/octocat/hello-world.git config remote.origin.url https://github.com/octocat/hello-world.git",
+		"git -C /var/lib/drone/octocat/hello-world.git worktree prune",
+		"git -C /var/lib/drone/octocat/hello-world.git fetch origin +refs/heads/master:refs/remotes/origin/master",
+		"git -C /var/lib/drone/octocat/hello-world.git worktree add --detach /tmp/drone/src a6586b3db244fb6b1198f2b25c213ded5b44f9fa",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected worktree commands")
+		t.Log(diff)
+	}
+}
+
+func Test_worktreeCommands_PullRequest(t *testing.T) {
+	args := clone.Args{
+		Branch: "master",
+		Commit: "a6586b3db244fb6b1198f2b25c213ded5b44f9fa",
+		Ref:    "refs/pull/42/head",
+		Remote: "https://github.com/octocat/hello-world.git",
+	}
+	got := worktreeCommands("/base.git", "/tmp/drone/src", args)
+	want := []string{
+		"git init -q --bare /base.git",
+		"git -C /base.git config remote.origin.url https://github.com/octocat/hello-world.git",
+		"git -C /base.git worktree prune",
+		"git -C /base.git fetch origin +refs/heads/master:refs/remotes/origin/master",
+		"git -C /base.git fetch origin +refs/pull/42/head:refs/pull/42/head",
+		"git -C /base.git worktree add --detach /tmp/drone/src refs/remotes/origin/master",
+		"git -C /tmp/drone/src merge a6586b3db244fb6b1198f2b25c213ded5b44f9fa",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected worktree commands")
+		t.Log(diff)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package credential provides a git credential helper that
+// serves the build credentials over a unix socket, so that the
+// credentials are not written to disk. Credentials are only
+// served to processes in the process group of a running step.
+package credential
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Server serves the build credentials to the git credential
+// helper over a unix socket.
+type Server struct {
+	machine  string
+	login    string
+	password string
+
+	listener net.Listener
+
+	mu     sync.Mutex
+	groups map[int]struct{}
+}
+
+// Listen returns a new Server listening on the unix socket.
+func Listen(path, machine, login, password string) (*Server, error) {
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	s := &Server{
+		machine:  machine,
+		login:    login,
+		password: password,
+		listener: listener,
+		groups:   map[int]struct{}{},
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Allow allows processes in the process group to request
+// the credentials.
+func (s *Server) Allow(pgid int) {
+	s.mu.Lock()
+	s.groups[pgid] = struct{}{}
+	s.mu.Unlock()
+}
+
+// Revoke revokes access to the credentials for processes in
+// the process group.
+func (s *Server) Revoke(pgid int) {
+	s.mu.Lock()
+	delete(s.groups, pgid)
+	s.mu.Unlock()
+}
+
+// Close stops the server and removes the socket.
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	pgid, err := peerGroup(conn)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	_, ok := s.groups[pgid]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	attrs, err := parse(conn)
+	if err != nil {
+		return
+	}
+	// the credentials are only provided for the netrc machine,
+	// and git falls back to the next credential helper, if any,
+	// for other hosts.
+	if host := attrs["host"]; host != s.machine {
+		return
+	}
+	fmt.Fprintf(conn, "username=%s\npassword=%s\n", s.login, s.password)
+}
+
+// Get requests the credentials from the server, using the git
+// credential helper protocol. The request attributes are read
+// from the reader, and the credentials are written to the
+// writer.
+func Get(path string, r io.Reader, w io.Writer) error {
+	attrs, err := parse(r)
+	if err != nil {
+		return err
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for k, v := range attrs {
+		fmt.Fprintf(conn, "%s=%s\n", k, v)
+	}
+	if _, err := io.WriteString(conn, "\n"); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, conn)
+	return err
+}
+
+// helper function parses the key value attributes of the git
+// credential helper protocol, which are terminated by a blank
+// line or end of file.
+func parse(r io.Reader) (map[string]string, error) {
+	attrs := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			attrs[k] = v
+		}
+	}
+	return attrs, scanner.Err()
+}
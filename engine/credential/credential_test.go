@@ -0,0 +1,58 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux darwin
+
+package credential
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credential.sock")
+	server, err := Listen(path, "github.com", "octocat", "correct-horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	request := "protocol=https\nhost=github.com\n\n"
+	want := "username=octocat\npassword=correct-horse\n"
+
+	// the credentials are not served to processes outside
+	// the allowed process groups.
+	var out bytes.Buffer
+	Get(path, strings.NewReader(request), &out)
+	if out.Len() != 0 {
+		t.Errorf("Expect credentials not served to unknown process group")
+	}
+
+	server.Allow(syscall.Getpgrp())
+	out.Reset()
+	if err := Get(path, strings.NewReader(request), &out); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != want {
+		t.Errorf("Want credentials %q, got %q", want, got)
+	}
+
+	// the credentials are only served for the netrc machine.
+	out.Reset()
+	Get(path, strings.NewReader("protocol=https\nhost=gitlab.com\n"), &out)
+	if out.Len() != 0 {
+		t.Errorf("Expect credentials not served to other hosts")
+	}
+
+	server.Revoke(syscall.Getpgrp())
+	out.Reset()
+	Get(path, strings.NewReader(request), &out)
+	if out.Len() != 0 {
+		t.Errorf("Expect credentials not served once revoked")
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build darwin
+
+package credential
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Supported is true if the credential helper is supported on
+// the host operating system.
+const Supported = true
+
+// helper function returns the process group of the process at
+// the other end of the unix socket connection.
+func peerGroup(conn net.Conn) (int, error) {
+	raw, err := conn.(*net.UnixConn).SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var pid int
+	var pidErr error
+	err = raw.Control(func(fd uintptr) {
+		pid, pidErr = unix.GetsockoptInt(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERPID)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if pidErr != nil {
+		return 0, pidErr
+	}
+	return syscall.Getpgid(pid)
+}
@@ -0,0 +1,22 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux,!darwin
+
+package credential
+
+import (
+	"errors"
+	"net"
+)
+
+// Supported is true if the credential helper is supported on
+// the host operating system.
+const Supported = false
+
+// the peer process cannot be identified on this platform, so
+// credentials are never served.
+func peerGroup(net.Conn) (int, error) {
+	return 0, errors.New("peer credentials not supported")
+}
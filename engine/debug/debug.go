@@ -0,0 +1,103 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package debug provides interactive debug sessions for failed
+// pipeline steps.
+package debug
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+
+	"github.com/gosimple/slug"
+)
+
+// interval at which the session is checked for termination.
+var interval = 5 * time.Second
+
+// Session starts a detached tmux session with the failed step
+// environment, and blocks until the session is terminated by
+// the user, the debug timeout is exceeded, or the context is
+// cancelled. Session instructions are written to w.
+func Session(ctx context.Context, spec *engine.Spec, step *engine.Step, w io.Writer) error {
+	tmux, err := exec.LookPath("tmux")
+	if err != nil {
+		fmt.Fprintln(w, "debug session unavailable: tmux not found")
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s", filepath.Base(spec.Root), slug.Make(step.Name))
+	path := filepath.Join(spec.Root, "opt", name+".debug")
+	err = ioutil.WriteFile(path, []byte(Script(step)), 0600)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, tmux, "new-session", "-d",
+		"-s", name, "-c", step.WorkingDir, "/bin/sh", path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		fmt.Fprintf(w, "debug session unavailable: %s\n", out)
+		return err
+	}
+	defer exec.Command(tmux, "kill-session", "-t", name).Run()
+
+	timeout := spec.Debug.Timeout
+	fmt.Fprintf(w, "debug session started, expires in %s\n", timeout)
+	fmt.Fprintf(w, "attach to the session with: tmux attach -t %s\n", name)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(w, "debug session expired")
+			return nil
+		case <-time.After(interval):
+		}
+		err := exec.Command(tmux, "has-session", "-t", name).Run()
+		if err != nil {
+			fmt.Fprintln(w, "debug session terminated")
+			return nil
+		}
+	}
+}
+
+// Script returns a shell script that exports the step
+// environment and then starts an interactive shell.
+func Script(step *engine.Step) string {
+	envs := map[string]string{}
+	for k, v := range step.Envs {
+		envs[k] = v
+	}
+	for _, secret := range step.Secrets {
+		envs[secret.Env] = string(secret.Data)
+	}
+	var keys []string
+	for k := range envs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := new(bytes.Buffer)
+	for _, k := range keys {
+		fmt.Fprintf(buf, "export %s=%s\n", k, quote(envs[k]))
+	}
+	buf.WriteString("exec ${SHELL:-/bin/sh}\n")
+	return buf.String()
+}
+
+// helper function quotes the string for use in a posix shell.
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
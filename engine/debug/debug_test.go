@@ -0,0 +1,33 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package debug
+
+import (
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+)
+
+func TestScript(t *testing.T) {
+	step := &engine.Step{
+		Envs: map[string]string{
+			"GOOS":    "linux",
+			"MESSAGE": "it's done",
+		},
+		Secrets: []*engine.Secret{
+			{Env: "PASSWORD", Data: []byte("correct-horse")},
+		},
+	}
+	got, want := Script(step), testScript
+	if got != want {
+		t.Errorf("Want script %q, got %q", want, got)
+	}
+}
+
+var testScript = `export GOOS='linux'
+export MESSAGE='it'\''s done'
+export PASSWORD='correct-horse'
+exec ${SHELL:-/bin/sh}
+`
@@ -0,0 +1,26 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package engine executes pipeline steps as processes on the
+// host machine.
+//
+// The package can be embedded by other programs to execute
+// commands without the runner daemon. A Spec describes the
+// pipeline environment and steps, and is typically created by
+// the yaml compiler, or by a Builder:
+//
+//	spec := engine.NewBuilder("/tmp/task-1").
+//		Env("GOFLAGS", "-mod=vendor").
+//		Commands("build", "go build ./...").
+//		Commands("test", "go test ./...").
+//		Build()
+//
+//	err := engine.Execute(ctx, engine.New(), spec, os.Stdout)
+//
+// Execute runs the steps serially. Programs that require
+// parallel steps, detached steps or status reporting should
+// use the Engine interface directly: Setup creates the pipeline
+// environment, Run executes each step, and Destroy removes the
+// pipeline environment.
+package engine
@@ -11,6 +11,12 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine/credential"
 
 	"github.com/drone/runner-go/environ"
 	"github.com/drone/runner-go/logger"
@@ -18,10 +24,17 @@ import (
 
 // New returns a new engine.
 func New() Engine {
-	return new(engine)
+	return &engine{
+		credentials: map[*Spec]*credential.Server{},
+		jobs:        map[*Spec]*job{},
+	}
 }
 
-type engine struct{}
+type engine struct {
+	mu          sync.Mutex
+	credentials map[*Spec]*credential.Server
+	jobs        map[*Spec]*job
+}
 
 // Setup the pipeline environment.
 func (e *engine) Setup(ctx context.Context, spec *Spec) error {
@@ -35,7 +48,7 @@ func (e *engine) Setup(ctx context.Context, spec *Spec) error {
 		if file.IsDir == false {
 			continue
 		}
-		err = os.MkdirAll(file.Path, 0700)
+		err = os.MkdirAll(file.Path, fileMode(0700, spec.Umask))
 		if err != nil {
 			logger.FromContext(ctx).
 				WithError(err).
@@ -49,7 +62,7 @@ func (e *engine) Setup(ctx context.Context, spec *Spec) error {
 		if file.IsDir == true {
 			continue
 		}
-		err = ioutil.WriteFile(file.Path, file.Data, os.FileMode(file.Mode))
+		err = ioutil.WriteFile(file.Path, file.Data, fileMode(file.Mode, spec.Umask))
 		if err != nil {
 			logger.FromContext(ctx).
 				WithError(err).
@@ -58,6 +71,17 @@ func (e *engine) Setup(ctx context.Context, spec *Spec) error {
 		}
 	}
 
+	// creates the hosts file of the pipeline, which extends
+	// the host machine hosts file with the host aliases.
+	if spec.Hosts != nil {
+		if err := writeHosts(spec.Hosts); err != nil {
+			logger.FromContext(ctx).
+				WithError(err).
+				Error("cannot write hosts file")
+			return err
+		}
+	}
+
 	// create symlinks
 	for _, link := range spec.Links {
 		if err := os.Symlink(link.Source, link.Target); err != nil {
@@ -70,13 +94,43 @@ func (e *engine) Setup(ctx context.Context, spec *Spec) error {
 		}
 	}
 
+	// starts the git credential helper server, which serves
+	// the build credentials to the pipeline steps.
+	if c := spec.Credential; c != nil {
+		server, err := credential.Listen(c.Socket, c.Machine, c.Login, c.Password)
+		if err != nil {
+			logger.FromContext(ctx).
+				WithError(err).
+				Error("cannot create credential helper socket")
+			return err
+		}
+		e.mu.Lock()
+		e.credentials[spec] = server
+		e.mu.Unlock()
+	}
+
+	// creates the job that contains the step processes, which
+	// are terminated when the pipeline is destroyed.
+	j, err := newJob(spec.Job)
+	if err != nil {
+		logger.FromContext(ctx).
+			WithError(err).
+			Error("cannot create job object")
+		return err
+	}
+	if j != nil {
+		e.mu.Lock()
+		e.jobs[spec] = j
+		e.mu.Unlock()
+	}
+
 	// creates step files
 	for _, step := range spec.Steps {
 		for _, file := range step.Files {
 			if file.IsDir == true {
 				continue
 			}
-			err = ioutil.WriteFile(file.Path, file.Data, os.FileMode(file.Mode))
+			err = ioutil.WriteFile(file.Path, file.Data, fileMode(file.Mode, spec.Umask))
 			if err != nil {
 				logger.FromContext(ctx).
 					WithError(err).
@@ -86,36 +140,247 @@ func (e *engine) Setup(ctx context.Context, spec *Spec) error {
 		}
 	}
 
+	// the pipeline root is owned by the pipeline user, if
+	// configured, and is not accessible to other users.
+	if user := spec.User; user != nil {
+		if err := chownAll(spec.Root, user); err != nil {
+			logger.FromContext(ctx).
+				WithError(err).
+				WithField("user", user.Name).
+				Error("cannot change owner of the pipeline root")
+			return err
+		}
+		if err := os.Chmod(spec.Root, 0700); err != nil {
+			return err
+		}
+	}
+
+	// creates the jail that executes the step processes, once
+	// the pipeline root is populated.
+	if spec.Jail != nil {
+		if err := createJail(ctx, spec); err != nil {
+			logger.FromContext(ctx).
+				WithError(err).
+				WithField("jail", spec.Jail.Name).
+				Error("cannot create jail")
+			return err
+		}
+	}
+
+	// creates the zone that executes the step processes, once
+	// the pipeline root is populated.
+	if spec.Zone != nil {
+		if err := createZone(ctx, spec); err != nil {
+			logger.FromContext(ctx).
+				WithError(err).
+				WithField("zone", spec.Zone.Name).
+				Error("cannot create zone")
+			return err
+		}
+	}
+
 	return nil
 }
 
 // Destroy the pipeline environment.
 func (e *engine) Destroy(ctx context.Context, spec *Spec) error {
+	e.mu.Lock()
+	if server, ok := e.credentials[spec]; ok {
+		server.Close()
+		delete(e.credentials, spec)
+	}
+	if j, ok := e.jobs[spec]; ok {
+		j.close()
+		delete(e.jobs, spec)
+	}
+	e.mu.Unlock()
+	if spec.Jail != nil {
+		if err := destroyJail(spec); err != nil {
+			logger.FromContext(ctx).
+				WithError(err).
+				WithField("jail", spec.Jail.Name).
+				Error("cannot destroy jail")
+		}
+	}
+	if spec.Zone != nil {
+		if err := destroyZone(spec); err != nil {
+			logger.FromContext(ctx).
+				WithError(err).
+				WithField("zone", spec.Zone.Name).
+				Error("cannot destroy zone")
+		}
+	}
 	return os.RemoveAll(spec.Root)
 }
 
 // Run runs the pipeline step.
 func (e *engine) Run(ctx context.Context, spec *Spec, step *Step, output io.Writer) (*State, error) {
-	cmd := exec.CommandContext(ctx, step.Command, step.Args...)
-	cmd.Env = environ.Slice(step.Envs)
+	command, args := step.Command, step.Args
+	if step.Umask != nil {
+		command, args = umaskCommand(*step.Umask, command, args)
+	}
+	// the step process transitions to the selinux context or
+	// apparmor profile when executed. The step is errored if
+	// the context or profile cannot be applied.
+	if step.Security != nil {
+		var err error
+		command, args, err = securityCommand(step.Security, command, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the step process is executed by sandbox-exec with the
+	// rendered sandbox profile on macos. Steps without network
+	// access are denied network access by the sandbox on macos,
+	// and steps without network access or with host aliases
+	// wait for the step namespaces to be ready on linux.
+	profile := step.Sandbox
+	if step.NoNetwork {
+		var err error
+		profile, err = networkProfile(profile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if step.NoNetwork || step.HostAliases {
+		command, args = gateCommand(command, args)
+	}
+	if profile != "" {
+		var err error
+		command, args, err = sandboxCommand(profile, command, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	env := environ.Slice(step.Envs)
+	for _, secret := range step.Secrets {
+		if secret.Env == "" {
+			continue
+		}
+		s := fmt.Sprintf("%s=%s", secret.Env, string(secret.Data))
+		env = append(env, s)
+	}
+
+	// the step process is executed in the pipeline jail or
+	// zone, if configured.
+	if spec.Jail != nil {
+		var err error
+		command, args, err = jailCommand(spec.Jail, step.WorkingDir, command, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if spec.Zone != nil {
+		var err error
+		command, args, err = zoneCommand(spec, step.WorkingDir, env, command, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = env
 	cmd.Dir = step.WorkingDir
 	cmd.Stdout = output
 	cmd.Stderr = output
+	setupProcess(cmd)
 
-	for _, secret := range step.Secrets {
-		s := fmt.Sprintf("%s=%s", secret.Env, string(secret.Data))
-		cmd.Env = append(cmd.Env, s)
+	// file secrets are written to disk for the duration of
+	// the step, and are removed when the step exits.
+	defer removeSecretFiles(step)
+	if err := writeSecretFiles(step); err != nil {
+		return nil, err
 	}
 
+	// the step process runs as the pipeline user, if
+	// configured, and the file secrets are owned by the user.
+	if user := spec.User; user != nil {
+		for _, secret := range step.Secrets {
+			if secret.File == "" {
+				continue
+			}
+			if err := os.Lchown(secret.File, int(user.UID), int(user.GID)); err != nil {
+				return nil, err
+			}
+		}
+		if err := setUser(cmd, user); err != nil {
+			return nil, err
+		}
+	}
+
+	// the step process is started in new namespaces on linux,
+	// which are prepared before the step command is executed.
+	release := func() error { return nil }
+	if step.NoNetwork || step.HostAliases {
+		var hosts string
+		if spec.Hosts != nil {
+			hosts = spec.Hosts.Path
+		}
+		var err error
+		release, err = isolateProcess(ctx, cmd, step, hosts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	kills := oomKills()
 	err := cmd.Start()
+	if rerr := release(); rerr != nil && err == nil {
+		killProcess(cmd)
+		cmd.Wait()
+		return nil, rerr
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	// the step process is assigned to the pipeline job, and
+	// is terminated if it cannot be contained by the job.
+	e.mu.Lock()
+	j := e.jobs[spec]
+	e.mu.Unlock()
+	if err := assignJob(j, cmd); err != nil {
+		killProcess(cmd)
+		cmd.Wait()
+		return nil, err
+	}
+
 	log := logger.FromContext(ctx)
 	log = log.WithField("process.pid", cmd.Process.Pid)
 	log.Debug("process started")
 
+	if step.Priority != nil {
+		if err := setPriority(cmd, step.Priority); err != nil {
+			log.WithError(err).Warn("cannot set process priority")
+		}
+	}
+
+	// the step process is pinned to the cpu set of the stage.
+	// Child processes inherit the cpu affinity, however child
+	// processes started before the affinity was set are not
+	// pinned.
+	if len(step.CPUs) != 0 {
+		if err := setAffinity(cmd.Process.Pid, step.CPUs); err != nil {
+			log.WithError(err).Warn("cannot set process cpu affinity")
+		}
+	}
+
+	if fn := processFuncFrom(ctx); fn != nil {
+		fn(cmd.Process.Pid, true)
+		defer fn(cmd.Process.Pid, false)
+	}
+
+	// the step process group is allowed to request the build
+	// credentials while the step is running.
+	e.mu.Lock()
+	server := e.credentials[spec]
+	e.mu.Unlock()
+	if server != nil {
+		server.Allow(cmd.Process.Pid)
+		defer server.Revoke(cmd.Process.Pid)
+	}
+
 	done := make(chan error)
 	go func() {
 		done <- cmd.Wait()
@@ -124,7 +389,8 @@ func (e *engine) Run(ctx context.Context, spec *Spec, step *Step, output io.Writ
 	select {
 	case err = <-done:
 	case <-ctx.Done():
-		cmd.Process.Kill()
+		killProcess(cmd)
+		stopProcess(step)
 
 		log.Debug("process killed")
 		return nil, ctx.Err()
@@ -138,15 +404,79 @@ func (e *engine) Run(ctx context.Context, spec *Spec, step *Step, output io.Writ
 	if err != nil {
 		state.ExitCode = 255
 	}
+	if ps := cmd.ProcessState; ps != nil {
+		state.CPU = ps.UserTime() + ps.SystemTime()
+		state.MaxRSS = maxRSS(ps)
+	}
 	if exiterr, ok := err.(*exec.ExitError); ok {
 		state.ExitCode = exiterr.ExitCode()
+		// a process terminated by a signal has no exit code,
+		// and reports the exit code of a shell instead. A
+		// killed process is attributed to the out of memory
+		// killer if the kernel killed a process meanwhile.
+		if status, ok := exiterr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			state.ExitCode = 128 + int(status.Signal())
+			state.Signal = status.Signal().String()
+			state.OOMKilled = status.Signal() == syscall.SIGKILL && oomKills() > kills
+		}
 	}
 
 	log.WithField("process.exit", state.ExitCode).
+		WithField("process.signal", state.Signal).
+		WithField("process.oom", state.OOMKilled).
 		Debug("process finished")
 	return state, err
 }
 
+// helper function executes the optional stop command, used
+// to stop processes that are not terminated with the step
+// process, such as containers.
+func stopProcess(step *Step) {
+	if len(step.Stop) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, step.Stop[0], step.Stop[1:]...)
+	cmd.Env = environ.Slice(step.Envs)
+	cmd.Run()
+}
+
+// helper function returns the file mode with the umask
+// applied. The umask can only restrict the file mode.
+func fileMode(mode uint32, umask *uint32) os.FileMode {
+	if umask == nil {
+		return os.FileMode(mode)
+	}
+	return os.FileMode(mode &^ *umask)
+}
+
+// helper function writes the file secrets to disk, readable
+// by the step user only.
+func writeSecretFiles(step *Step) error {
+	for _, secret := range step.Secrets {
+		if secret.File == "" {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(secret.File), 0700); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(secret.File, secret.Data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// helper function removes the file secrets from disk.
+func removeSecretFiles(step *Step) {
+	for _, secret := range step.Secrets {
+		if secret.File != "" {
+			os.Remove(secret.File)
+		}
+	}
+}
+
 type nilReader struct{}
 
 func (*nilReader) Read(p []byte) (n int, err error) {
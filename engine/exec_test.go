@@ -3,3 +3,226 @@
 // that can be found in the LICENSE file.
 
 package engine
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSecretFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "secrets", "deploy", "kubeconfig")
+	step := &Step{
+		Secrets: []*Secret{
+			{Name: "password", Env: "PASSWORD", Data: []byte("correct-horse")},
+			{Name: "kubeconfig", File: path, Data: []byte("apiVersion: v1")},
+		},
+	}
+	if err := writeSecretFiles(step); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "apiVersion: v1"; got != want {
+		t.Errorf("Want secret file %q, got %q", want, got)
+	}
+	if info, _ := os.Stat(path); runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Want secret file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	removeSecretFiles(step)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Want secret file removed")
+	}
+}
+
+func TestUmask(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("umask not supported on windows")
+	}
+	umask := uint32(0027)
+	if got, want := fileMode(0777, &umask), os.FileMode(0750); got != want {
+		t.Errorf("Want file mode %v, got %v", want, got)
+	}
+	if got, want := fileMode(0644, nil), os.FileMode(0644); got != want {
+		t.Errorf("Want file mode %v, got %v", want, got)
+	}
+
+	buf := new(bytes.Buffer)
+	step := &Step{Command: "/bin/sh", Args: []string{"-c", "umask"}, Umask: &umask}
+	if _, err := New().Run(context.Background(), &Spec{}, step, buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(buf.String()), "0027"; got != want {
+		t.Errorf("Want umask %q, got %q", want, got)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("nice levels not supported on windows")
+	}
+	buf := new(bytes.Buffer)
+	step := &Step{
+		Command:  "/bin/sh",
+		Args:     []string{"-c", "sleep 0.1; nice"},
+		Priority: &Priority{Nice: 5},
+	}
+	if _, err := New().Run(context.Background(), &Spec{}, step, buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "5" {
+		t.Errorf("Want nice level 5, got %q", got)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("resident set size not supported on windows")
+	}
+	step := &Step{
+		Command: "/bin/sh",
+		Args:    []string{"-c", "true"},
+	}
+	state, err := New().Run(context.Background(), &Spec{}, step, new(bytes.Buffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.MaxRSS <= 0 {
+		t.Errorf("Want peak resident set size, got %d", state.MaxRSS)
+	}
+}
+
+func TestSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals not supported on windows")
+	}
+	step := &Step{Command: "/bin/sh", Args: []string{"-c", "kill -TERM $$"}}
+	state, _ := New().Run(context.Background(), &Spec{}, step, ioutil.Discard)
+	if state == nil {
+		t.Fatal("Want process state")
+	}
+	if got, want := state.ExitCode, 143; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+	if got, want := state.Signal, "terminated"; got != want {
+		t.Errorf("Want signal %q, got %q", want, got)
+	}
+	if state.OOMKilled {
+		t.Errorf("Want process not oom killed")
+	}
+}
+
+func TestUser(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("users not supported on windows")
+	}
+	if os.Getuid() != 0 {
+		t.Skip("running as another user requires root")
+	}
+	root, err := ioutil.TempDir("", "drone-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	spec := &Spec{
+		Root:  root,
+		Files: []*File{{Path: filepath.Join(root, "home"), IsDir: true}},
+		User:  &User{Name: "nobody", UID: 65534, GID: 65534},
+	}
+	if err := New().Setup(context.Background(), spec); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	step := &Step{
+		Command:    "/bin/sh",
+		Args:       []string{"-c", "id -u && touch home/file"},
+		WorkingDir: root,
+	}
+	if _, err := New().Run(context.Background(), spec, step, buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "65534" {
+		t.Errorf("Want step run as uid 65534, got %q", got)
+	}
+	if info, _ := os.Stat(root); info.Mode().Perm() != 0700 {
+		t.Errorf("Want pipeline root accessible to the user only, got %s", info.Mode())
+	}
+}
+
+func TestNoNetwork(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("network namespaces only supported on linux")
+	}
+	if os.Getuid() != 0 {
+		t.Skip("creating a network namespace requires root")
+	}
+	buf := new(bytes.Buffer)
+	step := &Step{
+		Command:   "/bin/sh",
+		Args:      []string{"-c", "tail -n +3 /proc/net/dev | cut -d: -f1"},
+		NoNetwork: true,
+	}
+	if _, err := New().Run(context.Background(), &Spec{}, step, buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "lo" {
+		t.Errorf("Want loopback interface only, got %q", got)
+	}
+}
+
+func TestHostAliases(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("host aliases only supported on linux")
+	}
+	if os.Getuid() != 0 {
+		t.Skip("mounting the hosts file requires root")
+	}
+	root, err := ioutil.TempDir("", "drone-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	spec := &Spec{
+		Root: root,
+		Hosts: &Hosts{
+			Path:    filepath.Join(root, "hosts"),
+			Aliases: []*HostAlias{{IP: "127.0.0.9", Hostnames: []string{"api.internal"}}},
+		},
+	}
+	if err := New().Setup(context.Background(), spec); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	step := &Step{
+		Command:     "/bin/sh",
+		Args:        []string{"-c", "grep api.internal /etc/hosts"},
+		HostAliases: true,
+	}
+	if _, err := New().Run(context.Background(), spec, step, buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "127.0.0.9\tapi.internal" {
+		t.Errorf("Want host alias in the step hosts file, got %q", got)
+	}
+	if data, _ := ioutil.ReadFile("/etc/hosts"); strings.Contains(string(data), "api.internal") {
+		t.Errorf("Want host machine hosts file unchanged")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ExitError is returned by Execute when a step exits with a
+// non-zero exit code.
+type ExitError struct {
+	Step     string
+	ExitCode int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("step %s exited with code %d", e.Step, e.ExitCode)
+}
+
+// Execute sets up the pipeline environment, runs the steps
+// serially in order according to their run policy, and then
+// destroys the pipeline environment. The output of the steps
+// is written to the writer. Execute returns an ExitError for
+// the first failed step, unless the step ignores errors.
+// Detached steps are not supported.
+func Execute(ctx context.Context, engine Engine, spec *Spec, output io.Writer) error {
+	for _, step := range spec.Steps {
+		if step.Detach {
+			return errors.New("engine: detached steps are not supported")
+		}
+	}
+	if err := engine.Setup(ctx, spec); err != nil {
+		return err
+	}
+	defer engine.Destroy(context.Background(), spec)
+
+	var result error
+	for _, step := range spec.Steps {
+		switch step.RunPolicy {
+		case RunNever:
+			continue
+		case RunOnSuccess:
+			if result != nil {
+				continue
+			}
+		case RunOnFailure:
+			if result == nil {
+				continue
+			}
+		}
+		state, err := engine.Run(ctx, spec, step, output)
+		if state == nil {
+			// the step did not exit, because the process could
+			// not be started or the context was cancelled.
+			return err
+		}
+		if state.ExitCode != 0 && !step.IgnoreErr && result == nil {
+			result = &ExitError{Step: step.Name, ExitCode: state.ExitCode}
+		}
+	}
+	return result
+}
@@ -0,0 +1,36 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// path of the host machine hosts file, which is a variable so
+// that it can be replaced in tests.
+var hostsFile = "/etc/hosts"
+
+// helper function writes the hosts file, which contains the
+// host aliases followed by the host machine hosts file. The
+// aliases take precedence, since resolvers return the first
+// matching entry.
+func writeHosts(hosts *Hosts) error {
+	data, err := ioutil.ReadFile(hostsFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("# drone host aliases\n")
+	for _, alias := range hosts.Aliases {
+		fmt.Fprintf(&buf, "%s\t%s\n", alias.IP, strings.Join(alias.Hostnames, " "))
+	}
+	buf.WriteString("\n")
+	buf.Write(data)
+	return ioutil.WriteFile(hosts.Path, buf.Bytes(), 0644)
+}
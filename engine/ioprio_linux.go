@@ -0,0 +1,26 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package engine
+
+import "syscall"
+
+// ioprio_set parameters, see linux/ioprio.h
+const (
+	ioprioWhoPgrp    = 2
+	ioprioClassShift = 13
+)
+
+// helper function sets the io scheduling class and level of
+// the process group.
+func setIOPriority(pgid, class, level int) error {
+	prio := class<<ioprioClassShift | level
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoPgrp, uintptr(pgid), uintptr(prio))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
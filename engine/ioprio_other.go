@@ -0,0 +1,14 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux,!windows
+
+package engine
+
+// helper function sets the io scheduling class and level of
+// the process group. The io scheduling class is only supported
+// on linux, and is ignored on other platforms.
+func setIOPriority(pgid, class, level int) error {
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/drone/runner-go/logger"
+)
+
+// helper function returns the command and arguments used to
+// execute the command once the step namespaces are ready. The
+// command is executed by a shell that waits for the runner to
+// close the gate, on file descriptor 3, before replacing itself
+// with the command.
+func gateCommand(command string, args []string) (string, []string) {
+	script := "read -r _ <&3; exec 3<&-; exec \"$0\" \"$@\""
+	return "/bin/sh", append([]string{"-c", script, command}, args...)
+}
+
+// helper function configures the process to start in new
+// network and mount namespaces, as required by the step. The
+// returned function prepares the namespaces and releases the
+// gate, and must be called once the process is started. The
+// step is errored if the host aliases cannot be mounted, but
+// not if the loopback interface cannot be brought up, since
+// the step remains isolated from the network.
+func isolateProcess(ctx context.Context, cmd *exec.Cmd, step *Step, hosts string) (func() error, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.ExtraFiles = []*os.File{r}
+	if step.NoNetwork {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	if step.HostAliases {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNS
+	}
+	return func() error {
+		defer r.Close()
+		defer w.Close()
+		if cmd.Process == nil {
+			return nil
+		}
+		if step.HostAliases {
+			if err := mountHosts(ctx, cmd.Process.Pid, hosts); err != nil {
+				return fmt.Errorf("cannot mount host aliases: %s", err)
+			}
+		}
+		if step.NoNetwork {
+			if err := setupLoopback(cmd.Process.Pid); err != nil {
+				logger.FromContext(ctx).WithError(err).Warn("cannot bring up loopback interface")
+			}
+		}
+		return nil
+	}, nil
+}
+
+// helper function bind mounts the hosts file over /etc/hosts
+// in the mount namespace of the process. Mounts cannot be
+// changed from a multi-threaded process, so the namespace is
+// entered with nsenter. The namespace is made private first,
+// so that the mount does not propagate to the host.
+func mountHosts(ctx context.Context, pid int, hosts string) error {
+	path, err := exec.LookPath("nsenter")
+	if err != nil {
+		return fmt.Errorf("nsenter is not installed")
+	}
+	script := "mount --make-rprivate / && mount --bind \"$0\" /etc/hosts"
+	out, err := exec.CommandContext(ctx, path,
+		"--target", strconv.Itoa(pid), "--mount", "--",
+		"/bin/sh", "-c", script, hosts,
+	).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
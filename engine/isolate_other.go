@@ -0,0 +1,30 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// helper function returns the command unchanged.
+func gateCommand(command string, args []string) (string, []string) {
+	return command, args
+}
+
+// helper function returns an error if the step defines host
+// aliases, since the hosts file cannot be replaced for the
+// step process alone on this platform. Steps are isolated
+// from the network by the sandbox profile, if supported.
+func isolateProcess(ctx context.Context, cmd *exec.Cmd, step *Step, hosts string) (func() error, error) {
+	if step.HostAliases {
+		return nil, fmt.Errorf("host aliases are not supported on %s", runtime.GOOS)
+	}
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build freebsd
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// helper function creates the jail. The template snapshot is
+// cloned to the jail dataset, the pipeline root is mounted in
+// the jail root, and the jail is started without processes.
+func createJail(ctx context.Context, spec *Spec) error {
+	jail := spec.Jail
+	err := runCommand(ctx, "zfs", "clone", "-o", "mountpoint="+jail.Path, jail.Template, jail.Dataset)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(jail.Path, spec.Root)
+	if err := os.MkdirAll(target, 0700); err != nil {
+		destroyJail(spec)
+		return err
+	}
+	if err := runCommand(ctx, "mount_nullfs", spec.Root, target); err != nil {
+		destroyJail(spec)
+		return err
+	}
+	err = runCommand(ctx, "jail", "-c",
+		"name="+jail.Name,
+		"path="+jail.Path,
+		"host.hostname="+jail.Name,
+		"ip4=inherit",
+		"ip6=inherit",
+		"persist",
+	)
+	if err != nil {
+		destroyJail(spec)
+		return err
+	}
+	return nil
+}
+
+// helper function removes the jail, which terminates the jail
+// processes, and then destroys the cloned dataset. Removal
+// continues if a step fails, so that a partially created jail
+// is removed.
+func destroyJail(spec *Spec) error {
+	ctx := context.Background()
+	jail := spec.Jail
+	runCommand(ctx, "jail", "-r", jail.Name)
+	runCommand(ctx, "umount", "-f", filepath.Join(jail.Path, spec.Root))
+	return runCommand(ctx, "zfs", "destroy", "-r", "-f", jail.Dataset)
+}
+
+// helper function returns the command and arguments used to
+// execute the command in the jail. The jexec command does not
+// change the working directory, so the command is executed by
+// a shell that changes the directory before replacing itself
+// with the command.
+func jailCommand(jail *Jail, dir, command string, args []string) (string, []string, error) {
+	if dir == "" {
+		dir = "/"
+	}
+	script := `cd "$0" && exec "$@"`
+	return "/usr/sbin/jexec", append([]string{jail.Name, "/bin/sh", "-c", script, dir, command}, args...), nil
+}
+
+// helper function runs the command and returns an error that
+// includes the command output if the command fails.
+func runCommand(ctx context.Context, name string, args ...string) error {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %s: %s", name, args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
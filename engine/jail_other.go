@@ -0,0 +1,34 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !freebsd
+
+package engine
+
+import (
+	"context"
+	"errors"
+)
+
+// errJailNotSupported is returned when the jail is configured
+// on a platform other than freebsd.
+var errJailNotSupported = errors.New("jails are only supported on freebsd")
+
+// helper function returns an error, since jails are only
+// supported on freebsd.
+func createJail(ctx context.Context, spec *Spec) error {
+	return errJailNotSupported
+}
+
+// helper function returns an error, since jails are only
+// supported on freebsd.
+func destroyJail(spec *Spec) error {
+	return errJailNotSupported
+}
+
+// helper function returns an error, since jails are only
+// supported on freebsd.
+func jailCommand(jail *Jail, dir, command string, args []string) (string, []string, error) {
+	return "", nil, errJailNotSupported
+}
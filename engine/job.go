@@ -0,0 +1,39 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !windows
+
+package engine
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// errJobNotSupported is returned when the job limits are
+// configured on a platform other than windows.
+var errJobNotSupported = errors.New("job object limits are only supported on windows")
+
+// job is a placeholder for the windows job object. Step
+// processes are contained by their process group instead.
+type job struct{}
+
+// helper function returns the job that contains the step
+// processes, which is only supported on windows.
+func newJob(limits *Job) (*job, error) {
+	if limits != nil {
+		return nil, errJobNotSupported
+	}
+	return nil, nil
+}
+
+// helper function assigns the started process to the job.
+func assignJob(j *job, cmd *exec.Cmd) error {
+	return nil
+}
+
+// helper function closes the job.
+func (j *job) close() error {
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build windows
+
+package engine
+
+import (
+	"os/exec"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// job object cpu rate control constants, which are not
+// defined by the windows package.
+const (
+	cpuRateControlEnable  = 0x1
+	cpuRateControlHardCap = 0x4
+)
+
+// JOBOBJECT_CPU_RATE_CONTROL_INFORMATION
+type cpuRateControl struct {
+	ControlFlags uint32
+	CPURate      uint32
+}
+
+// job is a windows job object that contains the step processes
+// of the pipeline. The processes are terminated when the job
+// is closed, so that no process outlives the pipeline.
+type job struct {
+	handle windows.Handle
+}
+
+// helper function creates the job object with the limits.
+func newJob(limits *Job) (*job, error) {
+	handle, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	j := &job{handle: handle}
+
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	if limits != nil && limits.Memory > 0 {
+		info.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_JOB_MEMORY
+		info.JobMemoryLimit = uintptr(limits.Memory)
+	}
+	if limits != nil && limits.Processes > 0 {
+		info.BasicLimitInformation.LimitFlags |= windows.JOB_OBJECT_LIMIT_ACTIVE_PROCESS
+		info.BasicLimitInformation.ActiveProcessLimit = limits.Processes
+	}
+	_, err = windows.SetInformationJobObject(
+		handle,
+		windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)),
+		uint32(unsafe.Sizeof(info)),
+	)
+	if err != nil {
+		j.close()
+		return nil, err
+	}
+
+	// the cpu rate is a hard cap in hundredths of a percent
+	// of the total processor time of the host.
+	if limits != nil && limits.CPURate > 0 {
+		rate := cpuRateControl{
+			ControlFlags: cpuRateControlEnable | cpuRateControlHardCap,
+			CPURate:      limits.CPURate * 100,
+		}
+		_, err = windows.SetInformationJobObject(
+			handle,
+			windows.JobObjectCpuRateControlInformation,
+			uintptr(unsafe.Pointer(&rate)),
+			uint32(unsafe.Sizeof(rate)),
+		)
+		if err != nil {
+			j.close()
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// helper function assigns the started process to the job, and
+// then resumes the process. The process is started suspended,
+// so that it cannot create child processes outside the job.
+func assignJob(j *job, cmd *exec.Cmd) error {
+	if j != nil {
+		h, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(cmd.Process.Pid))
+		if err != nil {
+			return err
+		}
+		err = windows.AssignProcessToJobObject(j.handle, h)
+		windows.CloseHandle(h)
+		if err != nil {
+			return err
+		}
+	}
+	return resumeProcess(uint32(cmd.Process.Pid))
+}
+
+// helper function resumes the threads of the suspended process.
+func resumeProcess(pid uint32) error {
+	snapshot, err := windows.CreateToolhelp32Snapshot(windows.TH32CS_SNAPTHREAD, 0)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(snapshot)
+
+	entry := windows.ThreadEntry32{}
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = windows.Thread32First(snapshot, &entry); err == nil; err = windows.Thread32Next(snapshot, &entry) {
+		if entry.OwnerProcessID != pid {
+			continue
+		}
+		thread, err := windows.OpenThread(windows.THREAD_SUSPEND_RESUME, false, entry.ThreadID)
+		if err != nil {
+			return err
+		}
+		_, err = windows.ResumeThread(thread)
+		windows.CloseHandle(thread)
+		if err != nil {
+			return err
+		}
+	}
+	if err == windows.ERROR_NO_MORE_FILES {
+		return nil
+	}
+	return err
+}
+
+// helper function closes the job, which terminates the
+// processes that are still running.
+func (j *job) close() error {
+	return windows.CloseHandle(j.handle)
+}
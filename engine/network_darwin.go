@@ -0,0 +1,22 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build darwin
+
+package engine
+
+// helper function returns the sandbox profile that denies
+// network access, other than to the loopback interface. The
+// rules are appended to the profile, if defined, since the
+// last matching rule takes precedence.
+func networkProfile(profile string) (string, error) {
+	if profile == "" {
+		profile = "(version 1)\n(allow default)\n"
+	}
+	return profile +
+		"(deny network*)\n" +
+		"(allow network* (local ip \"localhost:*\"))\n" +
+		"(allow network* (remote ip \"localhost:*\"))\n" +
+		"(allow network* (remote unix-socket))\n", nil
+}
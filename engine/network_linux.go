@@ -0,0 +1,58 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package engine
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// helper function returns the sandbox profile unchanged, since
+// steps are isolated from the network with a network namespace
+// on linux.
+func networkProfile(profile string) (string, error) {
+	return profile, nil
+}
+
+// helper function brings up the loopback interface in the
+// network namespace of the process. The namespace is entered
+// from a locked thread, which is discarded when the goroutine
+// exits, so that other goroutines are not affected.
+func setupLoopback(pid int) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		errc <- func() error {
+			f, err := os.Open(fmt.Sprintf("/proc/%d/ns/net", pid))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if err := unix.Setns(int(f.Fd()), unix.CLONE_NEWNET); err != nil {
+				return err
+			}
+			fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+			if err != nil {
+				return err
+			}
+			defer unix.Close(fd)
+			ifr, err := unix.NewIfreq("lo")
+			if err != nil {
+				return err
+			}
+			if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+				return err
+			}
+			ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+			return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+		}()
+	}()
+	return <-errc
+}
@@ -0,0 +1,19 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux,!darwin
+
+package engine
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// helper function returns an error, since steps cannot be
+// isolated from the network on this platform. The step is
+// errored, rather than executed with network access.
+func networkProfile(profile string) (string, error) {
+	return "", fmt.Errorf("network isolation is not supported on %s", runtime.GOOS)
+}
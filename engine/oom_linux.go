@@ -0,0 +1,34 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package engine
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// helper function returns the number of processes killed by
+// the kernel out of memory killer since boot. The counter is
+// used to attribute a killed step process to the oom killer.
+func oomKills() uint64 {
+	f, err := os.Open("/proc/vmstat")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, _ := strconv.ParseUint(fields[1], 10, 64)
+			return n
+		}
+	}
+	return 0
+}
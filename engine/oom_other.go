@@ -0,0 +1,14 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux
+
+package engine
+
+// helper function returns the number of processes killed by
+// the out of memory killer. The counter is only supported on
+// linux, and is always zero on other platforms.
+func oomKills() uint64 {
+	return 0
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package probe implements readiness probes for detached
+// pipeline steps and services.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+
+	"github.com/drone/runner-go/environ"
+)
+
+// default probe timeout and interval.
+var (
+	defaultTimeout  = time.Minute
+	defaultInterval = time.Second
+)
+
+// Wait blocks until the step readiness probe succeeds. An
+// error is returned if the probe does not succeed before the
+// probe timeout is exceeded or the context is cancelled.
+func Wait(ctx context.Context, step *engine.Step) error {
+	probe := step.Ready
+	if probe == nil {
+		return nil
+	}
+
+	timeout := probe.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	interval := probe.Interval
+	if interval == 0 {
+		interval = defaultInterval
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		err := check(ctx, step)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s not ready after %s: %s", step.Name, timeout, err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// helper function performs a single readiness check.
+func check(ctx context.Context, step *engine.Step) error {
+	probe := step.Ready
+	switch {
+	case probe.TCP != "":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", probe.TCP)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case probe.HTTP != "":
+		req, err := http.NewRequest("GET", probe.HTTP, nil)
+		if err != nil {
+			return err
+		}
+		res, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode > 399 {
+			return fmt.Errorf("http status %d", res.StatusCode)
+		}
+		return nil
+	case probe.Command != "":
+		cmd := exec.CommandContext(ctx, probe.Command, probe.Args...)
+		cmd.Env = environ.Slice(step.Envs)
+		cmd.Dir = step.WorkingDir
+		return cmd.Run()
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+)
+
+var nocontext = context.Background()
+
+func TestWait_TCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer l.Close()
+
+	step := &engine.Step{
+		Name:  "redis",
+		Ready: &engine.Probe{TCP: l.Addr().String()},
+	}
+	if err := Wait(nocontext, step); err != nil {
+		t.Errorf("Expect tcp probe success, got %s", err)
+	}
+}
+
+func TestWait_HTTP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	step := &engine.Step{
+		Name:  "web",
+		Ready: &engine.Probe{HTTP: ts.URL},
+	}
+	if err := Wait(nocontext, step); err != nil {
+		t.Errorf("Expect http probe success, got %s", err)
+	}
+}
+
+func TestWait_Timeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(503)
+	}))
+	defer ts.Close()
+
+	step := &engine.Step{
+		Name: "web",
+		Ready: &engine.Probe{
+			HTTP:     ts.URL,
+			Timeout:  50 * time.Millisecond,
+			Interval: 10 * time.Millisecond,
+		},
+	}
+	if err := Wait(nocontext, step); err == nil {
+		t.Errorf("Expect http probe timeout")
+	}
+}
+
+func TestWait_NoProbe(t *testing.T) {
+	if err := Wait(nocontext, &engine.Step{}); err != nil {
+		t.Errorf("Expect no error when probe is nil")
+	}
+}
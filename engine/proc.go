@@ -0,0 +1,91 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !windows
+
+package engine
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+)
+
+// helper function configures the process to run in a new
+// process group, so that the process and its children can be
+// terminated together.
+func setupProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// helper function kills the process and all processes in its
+// process group.
+func killProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// helper function sets the cpu and io scheduling priority of
+// the process group, which includes any child processes that
+// were started before the priority was set.
+func setPriority(cmd *exec.Cmd, priority *Priority) error {
+	pid := cmd.Process.Pid
+	if priority.Nice != 0 {
+		err := syscall.Setpriority(syscall.PRIO_PGRP, pid, priority.Nice)
+		if err != nil {
+			return err
+		}
+	}
+	if priority.IOClass != 0 {
+		return setIOPriority(pid, priority.IOClass, priority.IOLevel)
+	}
+	return nil
+}
+
+// helper function returns the peak resident set size of the
+// largest process of the process tree, in bytes.
+func maxRSS(state *os.ProcessState) int64 {
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	// the peak resident set size is reported in bytes on
+	// darwin, and in kilobytes on other platforms.
+	if runtime.GOOS == "darwin" {
+		return int64(usage.Maxrss)
+	}
+	return int64(usage.Maxrss) * 1024
+}
+
+// helper function returns the command and arguments used to
+// execute the command with the umask. The umask is inherited
+// by child processes, and cannot be set for the child process
+// alone, so the command is executed by a shell that sets the
+// umask before replacing itself with the command.
+func umaskCommand(umask uint32, command string, args []string) (string, []string) {
+	script := fmt.Sprintf("umask %04o && exec \"$0\" \"$@\"", umask)
+	return "/bin/sh", append([]string{"-c", script, command}, args...)
+}
+
+// helper function configures the process to run as the user.
+func setUser(cmd *exec.Cmd, user *User) error {
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid: user.UID,
+		Gid: user.GID,
+	}
+	return nil
+}
+
+// helper function changes the owner of the directory and its
+// contents to the user. Symbolic links are not followed.
+func chownAll(root string, user *User) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, int(user.UID), int(user.GID))
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build windows
+
+package engine
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// helper function configures the process to start suspended,
+// so that it can be assigned to the pipeline job before it
+// creates child processes.
+func setupProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: windows.CREATE_SUSPENDED,
+	}
+}
+
+// helper function kills the process.
+func killProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// helper function sets the priority class of the process,
+// which is inherited by child processes. The nice level is
+// mapped to the nearest priority class. Windows does not
+// support an io scheduling class.
+func setPriority(cmd *exec.Cmd, priority *Priority) error {
+	var class uint32
+	switch {
+	case priority.Nice >= 15:
+		class = windows.IDLE_PRIORITY_CLASS
+	case priority.Nice > 0:
+		class = windows.BELOW_NORMAL_PRIORITY_CLASS
+	case priority.Nice < 0:
+		class = windows.ABOVE_NORMAL_PRIORITY_CLASS
+	default:
+		return nil
+	}
+	h, err := windows.OpenProcess(windows.PROCESS_SET_INFORMATION, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(h)
+	return windows.SetPriorityClass(h, class)
+}
+
+// helper function returns the peak resident set size of the
+// process, in bytes. The resident set size is not reported on
+// windows and zero is returned.
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
+
+// helper function returns the command and arguments used to
+// execute the command with the umask. Windows does not support
+// a umask and the command is returned unmodified.
+func umaskCommand(umask uint32, command string, args []string) (string, []string) {
+	return command, args
+}
+
+// errUserNotSupported is returned when the pipeline user is
+// configured on windows.
+var errUserNotSupported = errors.New("running steps as another user is not supported on windows")
+
+// helper function configures the process to run as the user.
+// Windows does not support running as another user without
+// the user password.
+func setUser(cmd *exec.Cmd, user *User) error {
+	return errUserNotSupported
+}
+
+// helper function changes the owner of the directory and its
+// contents to the user, which is not supported on windows.
+func chownAll(root string, user *User) error {
+	return errUserNotSupported
+}
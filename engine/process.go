@@ -0,0 +1,28 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import "context"
+
+// ProcessFunc is invoked with the process id when the step
+// process starts, and again when the step process exits.
+type ProcessFunc func(pid int, running bool)
+
+type processKey struct{}
+
+// WithProcessFunc returns a context that carries the function,
+// which is invoked by the engine when the step process starts
+// and exits. This allows the caller to observe the process
+// tree of a running step.
+func WithProcessFunc(ctx context.Context, fn ProcessFunc) context.Context {
+	return context.WithValue(ctx, processKey{}, fn)
+}
+
+// helper function returns the process function carried by the
+// context, or nil if the context does not carry a function.
+func processFuncFrom(ctx context.Context) ProcessFunc {
+	fn, _ := ctx.Value(processKey{}).(ProcessFunc)
+	return fn
+}
@@ -0,0 +1,279 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package remote provides an engine that executes pipelines on
+// remote hosts. Pipelines that are not assigned to a remote
+// host are executed by the local engine.
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/internal/remote"
+
+	"github.com/dchest/uniuri"
+	"github.com/drone/runner-go/environ"
+	"github.com/drone/runner-go/logger"
+)
+
+// Client executes commands and writes files on a remote host.
+type Client interface {
+	// Mkdir creates the directory and any parent directories.
+	Mkdir(ctx context.Context, path string) error
+
+	// WriteFile writes the file with the file mode.
+	WriteFile(ctx context.Context, path string, data []byte, mode uint32) error
+
+	// Symlink creates the symbolic link.
+	Symlink(ctx context.Context, source, target string) error
+
+	// Run runs the command and returns the exit code.
+	Run(ctx context.Context, cmd *Command) (int, error)
+
+	// RemoveAll removes the path and any children.
+	RemoveAll(ctx context.Context, path string) error
+
+	// Close closes the connection to the host.
+	Close() error
+}
+
+// Command defines a command executed on the remote host.
+type Command struct {
+	Command string
+	Args    []string
+	Dir     string
+	Env     []string
+	Umask   *uint32
+	Output  io.Writer
+
+	// PIDFile is the path of the file to which the process
+	// identifier is written, so that the process can be
+	// terminated when the command is cancelled.
+	PIDFile string
+}
+
+// Dialer returns a client connected to the host.
+type Dialer func(*remote.Host) (Client, error)
+
+// Dial returns a client connected to the host using the host
+// protocol.
+func Dial(host *remote.Host) (Client, error) {
+	switch host.Protocol {
+	case remote.ProtocolSSH:
+		return DialSSH(host)
+	case remote.ProtocolWinRM:
+		return DialWinRM(host)
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q", host.Protocol)
+	}
+}
+
+// Check returns a health check that connects to the host and
+// verifies the build root can be created.
+func Check(dial Dialer) remote.Checker {
+	return func(ctx context.Context, host *remote.Host) error {
+		client, err := dial(host)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		return client.Mkdir(ctx, host.Root)
+	}
+}
+
+// New returns an engine that executes pipelines assigned to a
+// remote host on the host, and all other pipelines using the
+// local engine.
+func New(local engine.Engine, pool *remote.Pool, dial Dialer) engine.Engine {
+	return &remoteEngine{
+		local:   local,
+		pool:    pool,
+		dial:    dial,
+		clients: map[*engine.Spec]Client{},
+	}
+}
+
+type remoteEngine struct {
+	local engine.Engine
+	pool  *remote.Pool
+	dial  Dialer
+
+	mu      sync.Mutex
+	clients map[*engine.Spec]Client
+}
+
+// Setup the pipeline environment.
+func (e *remoteEngine) Setup(ctx context.Context, spec *engine.Spec) error {
+	if spec.Remote == nil {
+		return e.local.Setup(ctx, spec)
+	}
+	host := e.pool.Lookup(spec.Remote.Host)
+	if host == nil {
+		return fmt.Errorf("remote host %q does not exist", spec.Remote.Host)
+	}
+	client, err := e.dial(host)
+	if err != nil {
+		logger.FromContext(ctx).
+			WithError(err).
+			WithField("host", host.Name).
+			Error("cannot connect to remote host")
+		return err
+	}
+	e.mu.Lock()
+	e.clients[spec] = client
+	e.mu.Unlock()
+
+	if err := client.Mkdir(ctx, spec.Root); err != nil {
+		return err
+	}
+	for _, file := range spec.Files {
+		if file.IsDir {
+			if err := client.Mkdir(ctx, file.Path); err != nil {
+				return err
+			}
+		}
+	}
+	for _, file := range spec.Files {
+		if !file.IsDir {
+			if err := client.WriteFile(ctx, file.Path, file.Data, fileMode(file.Mode, spec.Umask)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, link := range spec.Links {
+		if err := client.Symlink(ctx, link.Source, link.Target); err != nil {
+			return err
+		}
+	}
+	for _, step := range spec.Steps {
+		for _, file := range step.Files {
+			if file.IsDir {
+				continue
+			}
+			if err := client.WriteFile(ctx, file.Path, file.Data, fileMode(file.Mode, spec.Umask)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Destroy the pipeline environment.
+func (e *remoteEngine) Destroy(ctx context.Context, spec *engine.Spec) error {
+	if spec.Remote == nil {
+		return e.local.Destroy(ctx, spec)
+	}
+	e.mu.Lock()
+	client, ok := e.clients[spec]
+	delete(e.clients, spec)
+	e.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	defer client.Close()
+	return client.RemoveAll(ctx, spec.Root)
+}
+
+// Run runs the pipeline step.
+func (e *remoteEngine) Run(ctx context.Context, spec *engine.Spec, step *engine.Step, output io.Writer) (*engine.State, error) {
+	if spec.Remote == nil {
+		return e.local.Run(ctx, spec, step, output)
+	}
+	e.mu.Lock()
+	client, ok := e.clients[spec]
+	e.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("remote host %q is not connected", spec.Remote.Host)
+	}
+	// steps are errored, rather than executed with network
+	// access, since the remote step cannot be isolated.
+	if step.NoNetwork {
+		return nil, errors.New("network isolation is not supported on remote hosts")
+	}
+	if step.HostAliases {
+		return nil, errors.New("host aliases are not supported on remote hosts")
+	}
+
+	env := environ.Slice(step.Envs)
+	for _, secret := range step.Secrets {
+		if secret.Env != "" {
+			env = append(env, secret.Env+"="+string(secret.Data))
+		}
+	}
+
+	// file secrets are written to the remote host for the
+	// duration of the step.
+	for _, secret := range step.Secrets {
+		if secret.File == "" {
+			continue
+		}
+		defer client.RemoveAll(noContext, secret.File)
+		if err := client.Mkdir(ctx, path.Dir(secret.File)); err != nil {
+			return nil, err
+		}
+		if err := client.WriteFile(ctx, secret.File, secret.Data, 0600); err != nil {
+			return nil, err
+		}
+	}
+
+	pidfile := path.Join(spec.Root, "opt", uniuri.New()+".pid")
+	defer client.RemoveAll(noContext, pidfile)
+
+	code, err := client.Run(ctx, &Command{
+		Command: step.Command,
+		Args:    step.Args,
+		Dir:     step.WorkingDir,
+		Env:     env,
+		Umask:   step.Umask,
+		Output:  output,
+		PIDFile: pidfile,
+	})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &engine.State{
+		ExitCode: code,
+		Exited:   true,
+	}, nil
+}
+
+// Create creates the pipeline state.
+func (e *remoteEngine) Create(ctx context.Context, spec *engine.Spec, step *engine.Step) error {
+	return e.local.Create(ctx, spec, step)
+}
+
+// Start the pipeline step.
+func (e *remoteEngine) Start(ctx context.Context, spec *engine.Spec, step *engine.Step) error {
+	return e.local.Start(ctx, spec, step)
+}
+
+// Wait for the pipeline step to complete and returns the completion results.
+func (e *remoteEngine) Wait(ctx context.Context, spec *engine.Spec, step *engine.Step) (*engine.State, error) {
+	return e.local.Wait(ctx, spec, step)
+}
+
+// Tail the pipeline step logs.
+func (e *remoteEngine) Tail(ctx context.Context, spec *engine.Spec, step *engine.Step) (io.ReadCloser, error) {
+	return e.local.Tail(ctx, spec, step)
+}
+
+var noContext = context.Background()
+
+// helper function returns the file mode with the umask
+// applied.
+func fileMode(mode uint32, umask *uint32) uint32 {
+	if umask == nil {
+		return mode
+	}
+	return mode &^ *umask
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/internal/remote"
+)
+
+type fakeClient struct {
+	files   map[string][]byte
+	removed []string
+	command *Command
+	closed  bool
+}
+
+func (c *fakeClient) Mkdir(ctx context.Context, path string) error {
+	return nil
+}
+
+func (c *fakeClient) WriteFile(ctx context.Context, path string, data []byte, mode uint32) error {
+	c.files[path] = data
+	return nil
+}
+
+func (c *fakeClient) Symlink(ctx context.Context, source, target string) error {
+	return nil
+}
+
+func (c *fakeClient) Run(ctx context.Context, cmd *Command) (int, error) {
+	c.command = cmd
+	return 2, nil
+}
+
+func (c *fakeClient) RemoveAll(ctx context.Context, path string) error {
+	c.removed = append(c.removed, path)
+	return nil
+}
+
+func (c *fakeClient) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestEngine(t *testing.T) {
+	client := &fakeClient{files: map[string][]byte{}}
+	pool := remote.NewPool([]*remote.Host{{Name: "mac-1"}}, 0)
+	dial := func(*remote.Host) (Client, error) {
+		return client, nil
+	}
+
+	spec := &engine.Spec{
+		Root:   "/tmp/drone-abc",
+		Remote: &engine.Remote{Host: "mac-1"},
+		Files: []*engine.File{
+			{Path: "/tmp/drone-abc/opt/step1", Data: []byte("go build"), Mode: 0700},
+		},
+	}
+	step := &engine.Step{
+		Name:    "step1",
+		Command: "/bin/sh",
+		Args:    []string{"/tmp/drone-abc/opt/step1"},
+		Envs:    map[string]string{"CI": "true"},
+		Secrets: []*engine.Secret{
+			{Name: "token", Env: "TOKEN", Data: []byte("secret")},
+		},
+	}
+
+	e := New(nil, pool, dial)
+	if err := e.Setup(noContext, spec); err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := string(client.files["/tmp/drone-abc/opt/step1"]), "go build"; got != want {
+		t.Errorf("Want script %q written to remote host, got %q", want, got)
+	}
+
+	state, err := e.Run(noContext, spec, step, ioutil.Discard)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := state.ExitCode, 2; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+	if got, want := client.command.Env, []string{"CI=true", "TOKEN=secret"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Want environment %v, got %v", want, got)
+	}
+
+	if err := e.Destroy(noContext, spec); err != nil {
+		t.Error(err)
+	}
+	if !client.closed {
+		t.Errorf("Want client closed on destroy")
+	}
+	if got, want := client.removed[len(client.removed)-1], spec.Root; got != want {
+		t.Errorf("Want root %s removed, got %s", want, got)
+	}
+}
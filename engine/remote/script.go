@@ -0,0 +1,48 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// matches valid environment variable names.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// helper function returns the posix shell script that records
+// the process identifier, exports the environment, and then
+// replaces itself with the command.
+func script(cmd *Command) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "echo $$ > %s\n", quote(cmd.PIDFile))
+	if cmd.Umask != nil {
+		fmt.Fprintf(&buf, "umask %04o\n", *cmd.Umask)
+	}
+	for _, env := range cmd.Env {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 || !envName.MatchString(parts[0]) {
+			continue
+		}
+		fmt.Fprintf(&buf, "export %s=%s\n", parts[0], quote(parts[1]))
+	}
+	if cmd.Dir != "" {
+		fmt.Fprintf(&buf, "cd %s || exit 255\n", quote(cmd.Dir))
+	}
+	buf.WriteString("exec")
+	for _, arg := range append([]string{cmd.Command}, cmd.Args...) {
+		buf.WriteString(" ")
+		buf.WriteString(quote(arg))
+	}
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+// helper function returns the string quoted for a posix shell.
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,46 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !windows
+
+package remote
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// This test verifies that the script exports the environment
+// and executes the command with the arguments unmodified.
+func TestScript(t *testing.T) {
+	dir := t.TempDir()
+	pidfile := filepath.Join(dir, "step.pid")
+	umask := uint32(022)
+
+	cmd := exec.Command("/bin/sh", "-s")
+	cmd.Stdin = strings.NewReader(script(&Command{
+		Command: "/bin/sh",
+		Args:    []string{"-c", `printf '%s|%s|%s' "$GREETING" "$1" "$(pwd)"`, "sh", "it's $HOME"},
+		Dir:     dir,
+		Env:     []string{"GREETING=hello 'world'\nagain", "INVALID-NAME=x"},
+		Umask:   &umask,
+		PIDFile: pidfile,
+	}))
+	out, err := cmd.Output()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	resolved, _ := filepath.EvalSymlinks(dir)
+	want := "hello 'world'\nagain|it's $HOME|" + resolved
+	if got := string(out); got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+	if data, _ := ioutil.ReadFile(pidfile); len(data) == 0 {
+		t.Errorf("Expect process identifier written to the pid file")
+	}
+}
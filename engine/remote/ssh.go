@@ -0,0 +1,158 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/remote"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// timeout used to connect to the remote host.
+const dialTimeout = 30 * time.Second
+
+// DialSSH returns a client connected to the host over ssh. The
+// host must provide a posix shell.
+func DialSSH(host *remote.Host) (Client, error) {
+	config := &ssh.ClientConfig{
+		User:    host.Username,
+		Timeout: dialTimeout,
+	}
+	if host.PrivateKey != "" {
+		data, err := ioutil.ReadFile(host.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse private key: %s", err)
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+	if host.Password != "" {
+		config.Auth = append(config.Auth, ssh.Password(host.Password))
+	}
+	if host.Insecure {
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		callback, err := knownhosts.New(host.KnownHosts)
+		if err != nil {
+			return nil, err
+		}
+		config.HostKeyCallback = callback
+	}
+	client, err := ssh.Dial("tcp", host.Address, config)
+	if err != nil {
+		return nil, err
+	}
+	return &sshClient{client: client}, nil
+}
+
+type sshClient struct {
+	client *ssh.Client
+}
+
+// Mkdir creates the directory and any parent directories.
+func (c *sshClient) Mkdir(ctx context.Context, path string) error {
+	return c.exec(ctx, "mkdir -p -m 0700 "+quote(path), nil)
+}
+
+// WriteFile writes the file with the file mode. The file data
+// is streamed to the remote shell.
+func (c *sshClient) WriteFile(ctx context.Context, path string, data []byte, mode uint32) error {
+	script := fmt.Sprintf("umask 077 && cat > %s && chmod %04o %s", quote(path), mode, quote(path))
+	return c.exec(ctx, script, data)
+}
+
+// Symlink creates the symbolic link.
+func (c *sshClient) Symlink(ctx context.Context, source, target string) error {
+	return c.exec(ctx, fmt.Sprintf("ln -s %s %s", quote(source), quote(target)), nil)
+}
+
+// RemoveAll removes the path and any children.
+func (c *sshClient) RemoveAll(ctx context.Context, path string) error {
+	return c.exec(ctx, "rm -rf "+quote(path), nil)
+}
+
+// Close closes the connection to the host.
+func (c *sshClient) Close() error {
+	return c.client.Close()
+}
+
+// Run runs the command and returns the exit code. The script,
+// including the environment, is streamed to the remote shell,
+// so that secrets are not exposed in the process arguments.
+func (c *sshClient) Run(ctx context.Context, cmd *Command) (int, error) {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+
+	session.Stdin = strings.NewReader(script(cmd))
+	session.Stdout = cmd.Output
+	session.Stderr = cmd.Output
+	if err := session.Start("/bin/sh -s"); err != nil {
+		return 0, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// the process group is terminated using a separate
+		// session, since most servers ignore signals sent over
+		// the session.
+		kill := fmt.Sprintf(`pid=$(cat %s) && kill -KILL -- -$(ps -o pgid= -p $pid | tr -d ' ') $pid`, quote(cmd.PIDFile))
+		c.exec(noContext, kill, nil)
+		return 0, ctx.Err()
+	}
+
+	switch err := err.(type) {
+	case nil:
+		return 0, nil
+	case *ssh.ExitError:
+		return err.ExitStatus(), nil
+	case *ssh.ExitMissingError:
+		return 255, nil
+	default:
+		return 0, err
+	}
+}
+
+// helper function executes the shell script, with the optional
+// standard input, and returns an error if the script fails.
+func (c *sshClient) exec(ctx context.Context, script string, stdin []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	session, err := c.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	var output bytes.Buffer
+	session.Stdout = &output
+	session.Stderr = &output
+	if stdin != nil {
+		session.Stdin = bytes.NewReader(stdin)
+	}
+	if err := session.Run(script); err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
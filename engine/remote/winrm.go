@@ -0,0 +1,415 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/drone-runners/drone-runner-exec/internal/remote"
+)
+
+// ws-management actions used by the windows remote shell.
+const (
+	actionCreate  = "http://schemas.xmlsoap.org/ws/2004/09/transfer/Create"
+	actionDelete  = "http://schemas.xmlsoap.org/ws/2004/09/transfer/Delete"
+	actionCommand = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/Command"
+	actionSend    = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/Send"
+	actionReceive = "http://schemas.microsoft.com/wbem/wsman/1/windows/shell/Receive"
+)
+
+// fault code returned when a receive request times out before
+// the command writes output.
+const faultTimedOut = "2150858793"
+
+// maximum size of the standard input sent in a single request,
+// which must fit the default maximum envelope size.
+const sendChunk = 32 * 1024
+
+// DialWinRM returns a client connected to the host over windows
+// remote management, using basic authentication. The host must
+// provide powershell.
+func DialWinRM(host *remote.Host) (Client, error) {
+	scheme := "http"
+	if host.TLS {
+		scheme = "https"
+	}
+	client := &winrmClient{
+		endpoint: fmt.Sprintf("%s://%s/wsman", scheme, host.Address),
+		username: host.Username,
+		password: host.Password,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: host.Insecure,
+				},
+			},
+		},
+	}
+	// the connection is verified by creating and deleting a
+	// shell, so that invalid credentials fail the stage setup.
+	ctx, cancel := context.WithTimeout(noContext, dialTimeout)
+	defer cancel()
+	shell, err := client.createShell(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client.deleteShell(ctx, shell)
+	return client, nil
+}
+
+type winrmClient struct {
+	endpoint string
+	username string
+	password string
+	client   *http.Client
+}
+
+// Mkdir creates the directory and any parent directories.
+func (c *winrmClient) Mkdir(ctx context.Context, path string) error {
+	return c.exec(ctx, "New-Item -ItemType Directory -Force -Path "+psQuote(path)+" | Out-Null", nil)
+}
+
+// WriteFile writes the file. The file data is streamed to the
+// remote shell, and the file mode is ignored.
+func (c *winrmClient) WriteFile(ctx context.Context, path string, data []byte, mode uint32) error {
+	script := fmt.Sprintf(
+		"[IO.File]::WriteAllBytes(%s, [Convert]::FromBase64String([Console]::In.ReadToEnd()))",
+		psQuote(path),
+	)
+	return c.exec(ctx, script, []byte(base64.StdEncoding.EncodeToString(data)))
+}
+
+// Symlink creates the symbolic link.
+func (c *winrmClient) Symlink(ctx context.Context, source, target string) error {
+	script := fmt.Sprintf(
+		"New-Item -ItemType SymbolicLink -Path %s -Target %s | Out-Null",
+		psQuote(target),
+		psQuote(source),
+	)
+	return c.exec(ctx, script, nil)
+}
+
+// RemoveAll removes the path and any children.
+func (c *winrmClient) RemoveAll(ctx context.Context, path string) error {
+	script := fmt.Sprintf(
+		"if (Test-Path -LiteralPath %s) { Remove-Item -LiteralPath %s -Recurse -Force }",
+		psQuote(path),
+		psQuote(path),
+	)
+	return c.exec(ctx, script, nil)
+}
+
+// Close closes the connection to the host.
+func (c *winrmClient) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// Run runs the command and returns the exit code. The script,
+// including the environment, is streamed to the remote shell,
+// so that secrets are not exposed in the process arguments.
+func (c *winrmClient) Run(ctx context.Context, cmd *Command) (int, error) {
+	code, err := c.run(ctx, bootstrap, []byte(psScript(cmd)), cmd.Output)
+	if ctx.Err() != nil {
+		// the process tree is terminated using a separate
+		// shell, since terminating the remote shell does not
+		// reliably terminate the child processes.
+		kill := fmt.Sprintf(
+			"taskkill /T /F /PID (Get-Content -LiteralPath %s)",
+			psQuote(cmd.PIDFile),
+		)
+		c.exec(noContext, kill, nil)
+		return 0, ctx.Err()
+	}
+	return code, err
+}
+
+// helper function executes the powershell script, with the
+// optional standard input, and returns an error if the script
+// fails.
+func (c *winrmClient) exec(ctx context.Context, script string, stdin []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var output bytes.Buffer
+	code, err := c.run(ctx, script, stdin, &output)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("exit status %d: %s", code, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// helper function executes the powershell script in a new
+// remote shell, streams the output to the writer, and returns
+// the exit code.
+func (c *winrmClient) run(ctx context.Context, script string, stdin []byte, output io.Writer) (int, error) {
+	shell, err := c.createShell(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer c.deleteShell(noContext, shell)
+
+	body := fmt.Sprintf(
+		`<rsp:CommandLine><rsp:Command>powershell</rsp:Command><rsp:Arguments>-NoProfile -NonInteractive -EncodedCommand %s</rsp:Arguments></rsp:CommandLine>`,
+		encodeCommand(script),
+	)
+	options := map[string]string{
+		"WINRS_CONSOLEMODE_STDIN": "TRUE",
+		"WINRS_SKIP_CMD_SHELL":    "TRUE",
+	}
+	res, err := c.post(ctx, actionCommand, shell, options, body)
+	if err != nil {
+		return 0, err
+	}
+	command := res.Body.CommandResponse.CommandID
+
+	// the standard input is always closed, even if empty,
+	// since powershell blocks reading the console input.
+	for {
+		n, end := len(stdin), "true"
+		if n > sendChunk {
+			n, end = sendChunk, "false"
+		}
+		body := fmt.Sprintf(
+			`<rsp:Send><rsp:Stream Name="stdin" CommandId="%s" End="%s">%s</rsp:Stream></rsp:Send>`,
+			command,
+			end,
+			base64.StdEncoding.EncodeToString(stdin[:n]),
+		)
+		if _, err := c.post(ctx, actionSend, shell, nil, body); err != nil {
+			return 0, err
+		}
+		stdin = stdin[n:]
+		if len(stdin) == 0 {
+			break
+		}
+	}
+
+	for {
+		body := fmt.Sprintf(
+			`<rsp:Receive><rsp:DesiredStream CommandId="%s">stdout stderr</rsp:DesiredStream></rsp:Receive>`,
+			command,
+		)
+		res, err := c.post(ctx, actionReceive, shell, nil, body)
+		if err == errTimedOut {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		for _, stream := range res.Body.ReceiveResponse.Streams {
+			data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(stream.Data))
+			if err != nil {
+				return 0, err
+			}
+			output.Write(data)
+		}
+		state := res.Body.ReceiveResponse.CommandState
+		if strings.HasSuffix(state.State, "/Done") {
+			return state.ExitCode, nil
+		}
+	}
+}
+
+// helper function creates a remote shell and returns the shell
+// identifier.
+func (c *winrmClient) createShell(ctx context.Context) (string, error) {
+	body := `<rsp:Shell><rsp:InputStreams>stdin</rsp:InputStreams><rsp:OutputStreams>stdout stderr</rsp:OutputStreams></rsp:Shell>`
+	options := map[string]string{
+		"WINRS_NOPROFILE": "TRUE",
+		"WINRS_CODEPAGE":  "65001",
+	}
+	res, err := c.post(ctx, actionCreate, "", options, body)
+	if err != nil {
+		return "", err
+	}
+	if res.Body.Shell.ShellID == "" {
+		return "", errors.New("winrm: missing shell identifier")
+	}
+	return res.Body.Shell.ShellID, nil
+}
+
+// helper function deletes the remote shell, which terminates
+// any running commands.
+func (c *winrmClient) deleteShell(ctx context.Context, shell string) error {
+	_, err := c.post(ctx, actionDelete, shell, nil, "")
+	return err
+}
+
+// errTimedOut is returned when a receive request times out
+// before the command writes output.
+var errTimedOut = errors.New("winrm: operation timed out")
+
+// helper function posts the ws-management request and returns
+// the response envelope.
+func (c *winrmClient) post(ctx context.Context, action, shell string, options map[string]string, body string) (*envelope, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, envelopeHeader, c.endpoint, messageID(), action)
+	if shell != "" {
+		fmt.Fprintf(&buf, `<w:SelectorSet><w:Selector Name="ShellId">%s</w:Selector></w:SelectorSet>`, shell)
+	}
+	if len(options) != 0 {
+		buf.WriteString(`<w:OptionSet>`)
+		var names []string
+		for name := range options {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&buf, `<w:Option Name="%s">%s</w:Option>`, name, options[name])
+		}
+		buf.WriteString(`</w:OptionSet>`)
+	}
+	fmt.Fprintf(&buf, `</env:Header><env:Body>%s</env:Body></env:Envelope>`, body)
+
+	req, err := http.NewRequest("POST", c.endpoint, &buf)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/soap+xml;charset=UTF-8")
+	req.SetBasicAuth(c.username, c.password)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		return nil, errors.New("winrm: unauthorized")
+	}
+
+	out := new(envelope)
+	if err := xml.Unmarshal(data, out); err != nil {
+		return nil, fmt.Errorf("winrm: cannot parse response: %s: %s", res.Status, err)
+	}
+	if fault := out.Body.Fault; fault != nil {
+		if fault.Detail.Code == faultTimedOut {
+			return nil, errTimedOut
+		}
+		return nil, fmt.Errorf("winrm: %s", strings.TrimSpace(fault.Reason))
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("winrm: %s", res.Status)
+	}
+	return out, nil
+}
+
+// envelopeHeader is the ws-management request envelope, up to
+// the end of the header.
+const envelopeHeader = `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:w="http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd" xmlns:p="http://schemas.microsoft.com/wbem/wsman/1/wsman.xsd" xmlns:rsp="http://schemas.microsoft.com/wbem/wsman/1/windows/shell"><env:Header>` +
+	`<a:To>%s</a:To>` +
+	`<a:ReplyTo><a:Address env:mustUnderstand="true">http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address></a:ReplyTo>` +
+	`<w:MaxEnvelopeSize env:mustUnderstand="true">153600</w:MaxEnvelopeSize>` +
+	`<a:MessageID>uuid:%s</a:MessageID>` +
+	`<w:Locale xml:lang="en-US" env:mustUnderstand="false"/>` +
+	`<w:OperationTimeout>PT60S</w:OperationTimeout>` +
+	`<w:ResourceURI env:mustUnderstand="true">http://schemas.microsoft.com/wbem/wsman/1/windows/shell/cmd</w:ResourceURI>` +
+	`<a:Action env:mustUnderstand="true">%s</a:Action>`
+
+// envelope defines the ws-management response envelope.
+type envelope struct {
+	Body struct {
+		Shell struct {
+			ShellID string `xml:"ShellId"`
+		} `xml:"Shell"`
+		CommandResponse struct {
+			CommandID string `xml:"CommandId"`
+		} `xml:"CommandResponse"`
+		ReceiveResponse struct {
+			Streams []struct {
+				Name string `xml:"Name,attr"`
+				Data string `xml:",chardata"`
+			} `xml:"Stream"`
+			CommandState struct {
+				State    string `xml:"State,attr"`
+				ExitCode int    `xml:"ExitCode"`
+			} `xml:"CommandState"`
+		} `xml:"ReceiveResponse"`
+		Fault *struct {
+			Reason string `xml:"Reason>Text"`
+			Detail struct {
+				Code string `xml:"Code,attr"`
+			} `xml:"Detail>WSManFault"`
+		} `xml:"Fault"`
+	} `xml:"Body"`
+}
+
+// bootstrap is the powershell script that reads the command
+// script from the standard input and executes it.
+const bootstrap = `& ([scriptblock]::Create([Console]::In.ReadToEnd()))`
+
+// helper function returns the powershell script that records
+// the process identifier, exports the environment, and then
+// executes the command and exits with the command exit code.
+func psScript(cmd *Command) string {
+	var buf bytes.Buffer
+	buf.WriteString("$ErrorActionPreference = 'Stop'\n")
+	fmt.Fprintf(&buf, "Set-Content -LiteralPath %s -Value $PID\n", psQuote(cmd.PIDFile))
+	for _, env := range cmd.Env {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 || !envName.MatchString(parts[0]) {
+			continue
+		}
+		fmt.Fprintf(&buf, "$env:%s = %s\n", parts[0], psQuote(parts[1]))
+	}
+	if cmd.Dir != "" {
+		fmt.Fprintf(&buf, "Set-Location -LiteralPath %s\n", psQuote(cmd.Dir))
+	}
+	buf.WriteString("&")
+	for _, arg := range append([]string{cmd.Command}, cmd.Args...) {
+		buf.WriteString(" ")
+		buf.WriteString(psQuote(arg))
+	}
+	buf.WriteString("\nexit $LASTEXITCODE\n")
+	return buf.String()
+}
+
+// helper function returns a random message identifier in the
+// uuid format.
+func messageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// helper function returns the string quoted as a powershell
+// verbatim string.
+func psQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// helper function returns the script encoded for the powershell
+// -EncodedCommand flag, which is base64 encoded utf-16.
+func encodeCommand(script string) string {
+	var buf bytes.Buffer
+	for _, r := range utf16.Encode([]rune(script)) {
+		binary.Write(&buf, binary.LittleEndian, r)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/internal/remote"
+)
+
+var (
+	actionRe = regexp.MustCompile(`<a:Action[^>]*>([^<]+)</a:Action>`)
+	stdinRe  = regexp.MustCompile(`<rsp:Stream Name="stdin"[^>]*>([^<]*)</rsp:Stream>`)
+)
+
+const fakeEnvelope = `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:rsp="http://schemas.microsoft.com/wbem/wsman/1/windows/shell" xmlns:f="http://schemas.microsoft.com/wbem/wsman/1/wsmanfault"><s:Body>%s</s:Body></s:Envelope>`
+
+func TestWinRM(t *testing.T) {
+	var stdin bytes.Buffer
+	var receives int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username != "drone" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		action := actionRe.FindStringSubmatch(string(data))[1]
+		switch action {
+		case actionCreate:
+			fmt.Fprintf(w, fakeEnvelope, `<rsp:Shell><rsp:ShellId>shell-1</rsp:ShellId></rsp:Shell>`)
+		case actionCommand:
+			fmt.Fprintf(w, fakeEnvelope, `<rsp:CommandResponse><rsp:CommandId>command-1</rsp:CommandId></rsp:CommandResponse>`)
+		case actionSend:
+			chunk, _ := base64.StdEncoding.DecodeString(stdinRe.FindStringSubmatch(string(data))[1])
+			stdin.Write(chunk)
+			fmt.Fprintf(w, fakeEnvelope, ``)
+		case actionReceive:
+			receives++
+			if receives == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, fakeEnvelope, `<s:Fault><s:Reason><s:Text>timed out</s:Text></s:Reason><s:Detail><f:WSManFault Code="2150858793"/></s:Detail></s:Fault>`)
+				return
+			}
+			fmt.Fprintf(w, fakeEnvelope, `<rsp:ReceiveResponse>`+
+				`<rsp:Stream Name="stdout" CommandId="command-1">aGVsbG8=</rsp:Stream>`+
+				`<rsp:CommandState CommandId="command-1" State="http://schemas.microsoft.com/wbem/wsman/1/windows/shell/CommandState/Done"><rsp:ExitCode>3</rsp:ExitCode></rsp:CommandState>`+
+				`</rsp:ReceiveResponse>`)
+		case actionDelete:
+			fmt.Fprintf(w, fakeEnvelope, ``)
+		}
+	}))
+	defer server.Close()
+
+	client, err := DialWinRM(&remote.Host{
+		Address:  strings.TrimPrefix(server.URL, "http://"),
+		Username: "drone",
+		Password: "secret",
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var output bytes.Buffer
+	code, err := client.Run(noContext, &Command{
+		Command: "powershell",
+		Args:    []string{"-file", "C:/drone/opt/step.ps1"},
+		Env:     []string{"TOKEN=it's"},
+		Output:  &output,
+		PIDFile: "C:/drone/opt/step.pid",
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := code, 3; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+	if got, want := output.String(), "hello"; got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+	if got, want := stdin.String(), "$env:TOKEN = 'it''s'\n"; !strings.Contains(got, want) {
+		t.Errorf("Want script to export %q, got %q", want, got)
+	}
+
+	_, err = DialWinRM(&remote.Host{
+		Address:  strings.TrimPrefix(server.URL, "http://"),
+		Username: "drone",
+		Password: "invalid",
+	})
+	if err == nil {
+		t.Errorf("Want error connecting with invalid credentials")
+	}
+}
+
+func TestEncodeCommand(t *testing.T) {
+	if got, want := encodeCommand("dir"), "ZABpAHIA"; got != want {
+		t.Errorf("Want encoded command %s, got %s", want, got)
+	}
+}
@@ -4,7 +4,11 @@
 
 package resource
 
-import "github.com/drone/runner-go/manifest"
+import (
+	"time"
+
+	"github.com/drone/runner-go/manifest"
+)
 
 var (
 	_ manifest.Resource          = (*Pipeline)(nil)
@@ -19,6 +23,30 @@ const (
 	Type = "exec"
 )
 
+// Defines the supported step container runtimes.
+const (
+	RuntimeDocker = "docker"
+	RuntimePodman = "podman"
+	RuntimeWasi   = "wasi"
+)
+
+// Defines the supported build parameter types.
+const (
+	ParamString  = "string"
+	ParamNumber  = "number"
+	ParamBoolean = "boolean"
+)
+
+// NetworkNone disables network access for the step.
+const NetworkNone = "none"
+
+// Defines the supported step resource limits.
+const (
+	UlimitCore   = "core"
+	UlimitNofile = "nofile"
+	UlimitNproc  = "nproc"
+)
+
 type (
 	// Pipeline is a pipeline resource that executes pipelines
 	// on the host machine without any virtualization.
@@ -28,32 +56,179 @@ type (
 		Type      string              `json:"type,omitempty"`
 		Name      string              `json:"name,omitempty"`
 		Deps      []string            `json:"depends_on,omitempty"`
-		Clone     manifest.Clone      `json:"clone,omitempty"`
+		Artifacts []string            `json:"artifacts,omitempty"`
+		Clone     Clone               `json:"clone,omitempty"`
+		Debug     bool                `json:"debug,omitempty"`
+		Hosts     []*HostAlias        `json:"host_aliases,omitempty" yaml:"host_aliases"`
 		Platform  manifest.Platform   `json:"platform,omitempty"`
+		Ports     []string            `json:"ports,omitempty"`
+		Security  *Security           `json:"security,omitempty"`
 		Trigger   manifest.Conditions `json:"conditions,omitempty"`
+		Ulimits   map[string]int64    `json:"ulimits,omitempty"`
+		Umask     string              `json:"umask,omitempty"`
 		Workspace manifest.Workspace  `json:"workspace,omitempty"`
 
-		Steps []*Step `json:"steps,omitempty"`
+		Services []*Step `json:"services,omitempty"`
+		Steps    []*Step `json:"steps,omitempty"`
+
+		// InheritEnvironment controls whether steps inherit
+		// the host machine and runner environment. If false,
+		// steps start with a minimal environment.
+		InheritEnvironment *bool `json:"inherit_environment,omitempty" yaml:"inherit_environment"`
+
+		// Parameters declares the build parameters expected by
+		// promote, rollback and custom builds.
+		Parameters map[string]*Parameter `json:"parameters,omitempty"`
+
+		// Overrides defines the stage behavior for builds of
+		// the named events, such as a longer timeout for cron
+		// builds.
+		Overrides map[string]*Override `json:"overrides,omitempty"`
+	}
+
+	// Override defines the stage behavior for builds of an
+	// event. Timeout overrides the repository timeout, and
+	// FreshWorkspace disables the reuse of the persistent base
+	// clone and of the cached step results.
+	Override struct {
+		Timeout        Duration `json:"timeout,omitempty"`
+		FreshWorkspace bool     `json:"fresh_workspace,omitempty" yaml:"fresh_workspace"`
+	}
+
+	// Parameter declares a build parameter, with an optional
+	// default value that is used when the parameter is not
+	// provided.
+	Parameter struct {
+		Type        string   `json:"type,omitempty"`
+		Description string   `json:"description,omitempty"`
+		Default     *string  `json:"default,omitempty"`
+		Required    bool     `json:"required,omitempty"`
+		Enum        []string `json:"enum,omitempty"`
 	}
 
 	// Step defines a Pipeline step.
 	Step struct {
-		Name        string                        `json:"name,omitempty"`
-		Shell       string                        `json:"shell,omitempty"`
-		DependsOn   []string                      `json:"depends_on,omitempty" yaml:"depends_on"`
-		Detach      bool                          `json:"detach,omitempty"`
-		Environment map[string]*manifest.Variable `json:"environment,omitempty"`
-		Failure     string                        `json:"failure,omitempty"`
-		Commands    []string                      `json:"commands,omitempty"`
-		When        manifest.Conditions           `json:"when,omitempty"`
-
-		// Image is an unsupported field but is defined so
-		// that we can see when a user is setting this
-		// field and return a linting error.
-		Image string `json:"-"`
+		Name        string                         `json:"name,omitempty"`
+		Shell       string                         `json:"shell,omitempty"`
+		DependsOn   []string                       `json:"depends_on,omitempty" yaml:"depends_on"`
+		Detach      bool                           `json:"detach,omitempty"`
+		Environment map[string]*manifest.Variable  `json:"environment,omitempty"`
+		Failure     string                         `json:"failure,omitempty"`
+		Commands    []string                       `json:"commands,omitempty"`
+		Entrypoint  []string                       `json:"entrypoint,omitempty"`
+		Args        []string                       `json:"args,omitempty"`
+		Quiet       bool                           `json:"quiet,omitempty"`
+		Trace       bool                           `json:"trace,omitempty"`
+		Ready       *Probe                         `json:"ready,omitempty"`
+		Runtime     string                         `json:"runtime,omitempty"`
+		SecretFiles map[string]*manifest.Variable  `json:"secret_files,omitempty" yaml:"secret_files"`
+		Settings    map[string]*manifest.Parameter `json:"settings,omitempty"`
+		Ulimits     map[string]int64               `json:"ulimits,omitempty"`
+		Umask       string                         `json:"umask,omitempty"`
+		When        manifest.Conditions            `json:"when,omitempty"`
+
+		// Image identifies a plugin step. Plugin steps are
+		// mapped to plugin binaries installed on the host
+		// machine, since images cannot be executed by an
+		// exec pipeline.
+		Image string `json:"image,omitempty"`
+
+		// Pause defines an approval gate. The stage pauses
+		// until the step is approved or rejected.
+		Pause *Pause `json:"pause,omitempty"`
+
+		// Network disables network access for the step when
+		// set to none, so that hermetic steps cannot reach the
+		// network. The loopback interface remains available.
+		Network string `json:"network,omitempty"`
+
+		// InheritEnvironment overrides the pipeline setting
+		// for the step.
+		InheritEnvironment *bool `json:"inherit_environment,omitempty" yaml:"inherit_environment"`
+
+		// CacheKey defines the step inputs. The step is skipped
+		// if the inputs are unchanged since a previous
+		// successful run.
+		CacheKey *CacheKey `json:"cache_key,omitempty" yaml:"cache_key"`
+	}
+
+	// CacheKey defines the inputs of a step, which are hashed
+	// with the step commands to identify a previous run.
+	CacheKey struct {
+		Files []string `json:"files,omitempty"`
+		Env   []string `json:"env,omitempty"`
+	}
+
+	// Clone configures the clone step. Sparse optionally
+	// restricts the checkout to the listed directories, which
+	// are relative to the repository root.
+	Clone struct {
+		manifest.Clone `yaml:",inline"`
+
+		Sparse []string `json:"sparse,omitempty"`
+	}
+
+	// Security defines the selinux context or apparmor profile
+	// of the step processes, which overrides the runner
+	// configuration for trusted repositories.
+	Security struct {
+		SELinux  string `json:"selinux,omitempty"`
+		AppArmor string `json:"apparmor,omitempty"`
+	}
+
+	// HostAlias maps the hostnames to the ip address for the
+	// duration of the stage.
+	HostAlias struct {
+		IP        string   `json:"ip,omitempty"`
+		Hostnames []string `json:"hostnames,omitempty"`
+	}
+
+	// Pause defines an approval gate that pauses the stage
+	// until the step is approved using the runner admin api.
+	Pause struct {
+		Message string   `json:"message,omitempty"`
+		Timeout Duration `json:"timeout,omitempty"`
+	}
+
+	// Probe defines a readiness probe used to determine when
+	// a detached step or service is accepting connections.
+	Probe struct {
+		TCP      string   `json:"tcp,omitempty"`
+		HTTP     string   `json:"http,omitempty"`
+		Command  string   `json:"command,omitempty"`
+		Timeout  Duration `json:"timeout,omitempty"`
+		Interval Duration `json:"interval,omitempty"`
 	}
 )
 
+// Duration is a time.Duration that can be unmarshaled from a
+// yaml duration string (e.g. 30s, 5m).
+type Duration time.Duration
+
+// UnmarshalYAML implements yaml unmarshalling.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Override returns the stage behavior for builds of the event.
+// The zero value is returned if the pipeline does not override
+// the behavior for the event.
+func (p *Pipeline) Override(event string) Override {
+	if o := p.Overrides[event]; o != nil {
+		return *o
+	}
+	return Override{}
+}
+
 // GetVersion returns the resource version.
 func (p *Pipeline) GetVersion() string { return p.Version }
 
@@ -85,3 +260,14 @@ func (p *Pipeline) GetStep(name string) *Step {
 	}
 	return nil
 }
+
+// GetService returns the named service. If no service exists
+// with the given name, a nil value is returned.
+func (p *Pipeline) GetService(name string) *Step {
+	for _, service := range p.Services {
+		if service.Name == name {
+			return service
+		}
+	}
+	return nil
+}
@@ -26,6 +26,19 @@ func TestGetStep(t *testing.T) {
 	}
 }
 
+func TestGetService(t *testing.T) {
+	service := &Step{Name: "redis"}
+	pipeline := &Pipeline{
+		Services: []*Step{service},
+	}
+	if pipeline.GetService("redis") != service {
+		t.Errorf("Expected named service")
+	}
+	if pipeline.GetService("mysql") != nil {
+		t.Errorf("Expected nil service")
+	}
+}
+
 func TestGetters(t *testing.T) {
 	platform := manifest.Platform{
 		OS:   "linux",
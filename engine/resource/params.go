@@ -0,0 +1,130 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// paramName matches valid parameter names, which are exposed
+// to the steps as environment variables.
+var paramName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ResolveParams returns the build parameters with the declared
+// parameters validated against their type, and the defaults
+// applied to the declared parameters that are not provided.
+// Boolean and number values are normalized, so that steps can
+// compare them as strings. Required parameters are only
+// enforced for the events that accept build parameters.
+func (p *Pipeline) ResolveParams(event string, params map[string]string) (map[string]string, error) {
+	if len(p.Parameters) == 0 {
+		return params, nil
+	}
+	out := map[string]string{}
+	for k, v := range params {
+		out[k] = v
+	}
+	for _, name := range sortedParams(p.Parameters) {
+		param := p.Parameters[name]
+		value, ok := out[name]
+		if !ok {
+			switch {
+			case param.Default != nil:
+				value = *param.Default
+			case param.Required && acceptsParams(event):
+				return nil, fmt.Errorf("missing required parameter %s", name)
+			default:
+				continue
+			}
+		}
+		value, err := checkParam(param, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameter %s: %s", name, err)
+		}
+		out[name] = value
+	}
+	return out, nil
+}
+
+// helper function returns the value normalized to the
+// parameter type, or an error if the value does not match the
+// parameter type or enumeration.
+func checkParam(param *Parameter, value string) (string, error) {
+	switch param.Type {
+	case ParamBoolean:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a boolean", value)
+		}
+		value = strconv.FormatBool(b)
+	case ParamNumber:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a number", value)
+		}
+		value = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	if len(param.Enum) == 0 {
+		return value, nil
+	}
+	for _, allowed := range param.Enum {
+		if value == allowed {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("%q is not one of %q", value, param.Enum)
+}
+
+// helper function returns true if the event accepts build
+// parameters, which includes promote and rollback events, and
+// custom events created with the api.
+func acceptsParams(event string) bool {
+	switch event {
+	case "push", "pull_request", "tag", "cron", "":
+		return false
+	default:
+		return true
+	}
+}
+
+// helper function returns the parameter names in order.
+func sortedParams(params map[string]*Parameter) []string {
+	var names []string
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lintParams returns an error if the parameter declarations
+// are invalid.
+func lintParams(params map[string]*Parameter) error {
+	for _, name := range sortedParams(params) {
+		param := params[name]
+		if !paramName.MatchString(name) {
+			return errors.New("Linter: invalid parameter name")
+		}
+		if param == nil {
+			return errors.New("Linter: invalid parameter declaration")
+		}
+		switch param.Type {
+		case "", ParamString, ParamNumber, ParamBoolean:
+		default:
+			return errors.New("Linter: unsupported parameter type")
+		}
+		if param.Default == nil {
+			continue
+		}
+		if _, err := checkParam(param, *param.Default); err != nil {
+			return fmt.Errorf("Linter: invalid parameter default: %s", err)
+		}
+	}
+	return nil
+}
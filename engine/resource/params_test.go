@@ -0,0 +1,83 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package resource
+
+import (
+	"testing"
+
+	"github.com/drone/runner-go/manifest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResolveParams(t *testing.T) {
+	resources, err := manifest.ParseFile("testdata/params.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := resources.Resources[0].(*Pipeline)
+
+	got, err := pipeline.ResolveParams("promote", map[string]string{
+		"TARGET":  "staging",
+		"DRY_RUN": "1",
+		"OTHER":   "value",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"TARGET":   "staging",
+		"REPLICAS": "2",
+		"DRY_RUN":  "true",
+		"OTHER":    "value",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected build parameters")
+		t.Log(diff)
+	}
+
+	// required parameters are only enforced for the events
+	// that accept build parameters.
+	if _, err := pipeline.ResolveParams("push", nil); err != nil {
+		t.Errorf("Expect no error for push events, got %s", err)
+	}
+
+	tests := []map[string]string{
+		{},
+		{"TARGET": "testing"},
+		{"TARGET": "staging", "REPLICAS": "two"},
+		{"TARGET": "staging", "DRY_RUN": "maybe"},
+	}
+	for _, params := range tests {
+		if _, err := pipeline.ResolveParams("promote", params); err == nil {
+			t.Errorf("Expect error for parameters %v", params)
+		}
+	}
+}
+
+func TestLint_Params(t *testing.T) {
+	p := new(Pipeline)
+	p.Steps = []*Step{{Name: "build"}}
+	p.Parameters = map[string]*Parameter{
+		"VERSION": {Type: ParamString},
+	}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	invalid := "yes"
+	tests := []map[string]*Parameter{
+		{"1VERSION": {}},
+		{"VERSION": {Type: "date"}},
+		{"VERSION": nil},
+		{"DRY_RUN": {Type: ParamBoolean, Default: &invalid}},
+		{"TARGET": {Enum: []string{"staging"}, Default: &invalid}},
+	}
+	for _, params := range tests {
+		p.Parameters = params
+		if err := lint(p); err == nil {
+			t.Errorf("Expect lint error for parameters %v", params)
+		}
+	}
+}
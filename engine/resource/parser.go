@@ -6,6 +6,14 @@ package resource
 
 import (
 	"errors"
+	"net"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-exec/engine/script"
 
 	"github.com/drone/runner-go/manifest"
 
@@ -37,7 +45,84 @@ func match(r *manifest.RawResource) bool {
 
 // lint returns an error if any pipeline values are invalid.
 func lint(pipeline *Pipeline) error {
+	if !isUmask(pipeline.Umask) {
+		return errors.New("Linter: invalid umask")
+	}
+	if err := lintUlimits(pipeline.Ulimits); err != nil {
+		return err
+	}
+	if s := pipeline.Security; s != nil && s.SELinux != "" && s.AppArmor != "" {
+		return errors.New("Linter: cannot configure both selinux and apparmor")
+	}
+	for _, path := range pipeline.Artifacts {
+		if !isRelative(path) {
+			return errors.New("Linter: artifact paths must be relative to the workspace")
+		}
+	}
+	for _, path := range pipeline.Clone.Sparse {
+		if !isRelative(path) || !sparsePath.MatchString(path) {
+			return errors.New("Linter: invalid sparse checkout path")
+		}
+	}
+	if err := lintHosts(pipeline.Hosts); err != nil {
+		return err
+	}
+	if err := lintParams(pipeline.Parameters); err != nil {
+		return err
+	}
+	for event, override := range pipeline.Overrides {
+		if event == "" || override == nil {
+			return errors.New("Linter: invalid event override")
+		}
+		if override.Timeout < 0 {
+			return errors.New("Linter: invalid event override timeout")
+		}
+	}
+	ports := map[string]struct{}{}
+	for _, port := range pipeline.Ports {
+		if port == "" {
+			return errors.New("Linter: invalid or missing port name")
+		}
+		if _, ok := ports[port]; ok {
+			return errors.New("Linter: duplicate port name")
+		}
+		ports[port] = struct{}{}
+	}
+
 	names := map[string]struct{}{}
+	for _, service := range pipeline.Services {
+		if service.Name == "" {
+			return errors.New("Linter: invalid or missing service name")
+		}
+		if _, ok := names[service.Name]; ok {
+			return errors.New("Linter: duplicate service name")
+		}
+		if service.Image != "" {
+			return errors.New("Linter: cannot define images for an exec pipeline")
+		}
+		if len(service.Commands) == 0 && len(service.Entrypoint) == 0 {
+			return errors.New("Linter: missing service commands")
+		}
+		if err := lintEntrypoint(service); err != nil {
+			return err
+		}
+		if script.Lookup(service.Shell) == nil {
+			return errors.New("Linter: unsupported shell")
+		}
+		if !isUmask(service.Umask) {
+			return errors.New("Linter: invalid umask")
+		}
+		if err := lintUlimits(service.Ulimits); err != nil {
+			return err
+		}
+		if err := lintProbe(service.Ready); err != nil {
+			return err
+		}
+		if err := lintSecretFiles(service); err != nil {
+			return err
+		}
+		names[service.Name] = struct{}{}
+	}
 	for _, step := range pipeline.Steps {
 		if step.Name == "" {
 			return errors.New("Linter: invalid or missing step name")
@@ -45,10 +130,238 @@ func lint(pipeline *Pipeline) error {
 		if _, ok := names[step.Name]; ok {
 			return errors.New("Linter: duplicate step name")
 		}
-		if step.Image != "" {
-			return errors.New("Linter: cannot define images for an exec pipeline")
+		switch step.Runtime {
+		case "", RuntimeDocker, RuntimePodman, RuntimeWasi:
+		default:
+			return errors.New("Linter: unsupported step runtime")
+		}
+		if step.Runtime != "" && step.Image == "" {
+			return errors.New("Linter: container runtime requires an image")
+		}
+		if step.Runtime == "" && step.Image != "" && len(step.Commands) != 0 {
+			return errors.New("Linter: cannot define commands for a plugin step")
+		}
+		if step.Runtime == RuntimeWasi && len(step.Commands) != 0 {
+			return errors.New("Linter: cannot define commands for a wasi step")
+		}
+		if step.Network != "" && step.Network != NetworkNone {
+			return errors.New("Linter: unsupported step network")
+		}
+		if step.Image == "" && len(step.Settings) != 0 {
+			return errors.New("Linter: cannot define settings without a plugin image")
+		}
+		if script.Lookup(step.Shell) == nil {
+			return errors.New("Linter: unsupported shell")
+		}
+		if err := lintEntrypoint(step); err != nil {
+			return err
+		}
+		if step.Quiet && step.Trace {
+			return errors.New("Linter: cannot enable trace for a quiet step")
+		}
+		if step.Runtime == RuntimeWasi && len(step.SecretFiles) != 0 {
+			return errors.New("Linter: cannot define secret files for a wasi step")
+		}
+		if err := lintSecretFiles(step); err != nil {
+			return err
+		}
+		if !isUmask(step.Umask) {
+			return errors.New("Linter: invalid umask")
+		}
+		if err := lintUlimits(step.Ulimits); err != nil {
+			return err
+		}
+		if step.Ready != nil && step.Detach == false {
+			return errors.New("Linter: readiness probes require a detached step")
+		}
+		if err := lintProbe(step.Ready); err != nil {
+			return err
+		}
+		if err := lintPause(step); err != nil {
+			return err
+		}
+		if err := lintCacheKey(step); err != nil {
+			return err
 		}
 		names[step.Name] = struct{}{}
 	}
 	return nil
 }
+
+// lintSecretFiles returns an error if the secret files are
+// invalid. The file names are joined with the secrets directory,
+// and cannot reference another directory.
+func lintSecretFiles(step *Step) error {
+	for name, file := range step.SecretFiles {
+		if file == nil || file.Secret == "" {
+			return errors.New("Linter: secret files must be sourced from a secret")
+		}
+		if !isFileName(name) {
+			return errors.New("Linter: invalid secret file name")
+		}
+	}
+	return nil
+}
+
+// lintPause returns an error if the approval gate is invalid.
+// A paused step waits for approval, and cannot execute commands.
+func lintPause(step *Step) error {
+	if step.Pause == nil {
+		return nil
+	}
+	if len(step.Commands) != 0 || len(step.Entrypoint) != 0 || step.Image != "" {
+		return errors.New("Linter: cannot define commands for a pause step")
+	}
+	if step.Detach {
+		return errors.New("Linter: cannot detach a pause step")
+	}
+	if step.Pause.Timeout < 0 {
+		return errors.New("Linter: invalid pause timeout")
+	}
+	return nil
+}
+
+// lintCacheKey returns an error if the cache key is invalid.
+// The files must be relative to the workspace, and detached
+// and paused steps cannot be skipped.
+func lintCacheKey(step *Step) error {
+	if step.CacheKey == nil {
+		return nil
+	}
+	if len(step.CacheKey.Files) == 0 && len(step.CacheKey.Env) == 0 {
+		return errors.New("Linter: cache key requires files or env")
+	}
+	if step.Detach || step.Pause != nil {
+		return errors.New("Linter: cannot define a cache key for a detached or pause step")
+	}
+	for _, pattern := range step.CacheKey.Files {
+		if !isRelative(pattern) {
+			return errors.New("Linter: cache key files must be relative to the workspace")
+		}
+	}
+	return nil
+}
+
+// sparsePath matches the characters permitted in a sparse
+// checkout path, which is written to the clone script without
+// quoting.
+var sparsePath = regexp.MustCompile(`^[A-Za-z0-9._/@+-]+$`)
+
+// hostname matches a host alias hostname, which is written to
+// the hosts file.
+var hostname = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+
+// isRelative returns true if the path is relative, and does
+// not reference the parent directory.
+func isRelative(s string) bool {
+	if s == "" || path.IsAbs(s) || filepath.IsAbs(s) {
+		return false
+	}
+	for _, part := range strings.Split(filepath.ToSlash(s), "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// isFileName returns true if the value is a file name, which
+// does not contain a path separator or reference the parent
+// directory.
+func isFileName(s string) bool {
+	switch s {
+	case "", ".", "..":
+		return false
+	}
+	return !strings.ContainsAny(s, `/\:`) && !filepath.IsAbs(s)
+}
+
+// isUmask returns true if the value is empty, or is a valid
+// octal umask.
+func isUmask(s string) bool {
+	if s == "" {
+		return true
+	}
+	_, err := strconv.ParseUint(s, 8, 9)
+	return err == nil
+}
+
+// lintUlimits returns an error if the resource limits are
+// invalid.
+func lintUlimits(ulimits map[string]int64) error {
+	for name, value := range ulimits {
+		switch name {
+		case UlimitCore, UlimitNofile, UlimitNproc:
+		default:
+			return errors.New("Linter: unsupported ulimit")
+		}
+		if value < 0 {
+			return errors.New("Linter: invalid ulimit value")
+		}
+	}
+	return nil
+}
+
+// lintHosts returns an error if the host aliases are invalid.
+func lintHosts(hosts []*HostAlias) error {
+	for _, alias := range hosts {
+		if alias == nil || net.ParseIP(alias.IP) == nil {
+			return errors.New("Linter: invalid or missing host alias ip")
+		}
+		if len(alias.Hostnames) == 0 {
+			return errors.New("Linter: missing host alias hostnames")
+		}
+		for _, name := range alias.Hostnames {
+			if !hostname.MatchString(name) {
+				return errors.New("Linter: invalid host alias hostname")
+			}
+		}
+	}
+	return nil
+}
+
+// lintEntrypoint returns an error if the entrypoint is invalid.
+// The entrypoint is executed directly, without a shell, and
+// cannot be combined with commands or shell options.
+func lintEntrypoint(step *Step) error {
+	if len(step.Entrypoint) == 0 {
+		if len(step.Args) != 0 {
+			return errors.New("Linter: cannot define args without an entrypoint")
+		}
+		return nil
+	}
+	if step.Entrypoint[0] == "" {
+		return errors.New("Linter: invalid or missing entrypoint")
+	}
+	if len(step.Commands) != 0 {
+		return errors.New("Linter: cannot define both commands and an entrypoint")
+	}
+	if step.Shell != "" || step.Quiet || step.Trace {
+		return errors.New("Linter: cannot define shell options for an entrypoint")
+	}
+	if step.Image != "" && step.Runtime != RuntimeDocker && step.Runtime != RuntimePodman {
+		return errors.New("Linter: cannot define an entrypoint for a plugin step")
+	}
+	return nil
+}
+
+// lintProbe returns an error if the readiness probe is invalid.
+func lintProbe(probe *Probe) error {
+	if probe == nil {
+		return nil
+	}
+	var n int
+	if probe.TCP != "" {
+		n++
+	}
+	if probe.HTTP != "" {
+		n++
+	}
+	if probe.Command != "" {
+		n++
+	}
+	if n != 1 {
+		return errors.New("Linter: readiness probe requires exactly one of tcp, http or command")
+	}
+	return nil
+}
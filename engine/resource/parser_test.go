@@ -6,6 +6,7 @@ package resource
 
 import (
 	"testing"
+	"time"
 
 	"github.com/drone/runner-go/manifest"
 
@@ -42,8 +43,10 @@ func TestParse(t *testing.T) {
 				OS:   "linux",
 				Arch: "arm64",
 			},
-			Clone: manifest.Clone{
-				Depth: 50,
+			Clone: Clone{
+				Clone: manifest.Clone{
+					Depth: 50,
+				},
 			},
 			Trigger: manifest.Conditions{
 				Branch: manifest.Condition{
@@ -148,8 +151,417 @@ func TestLint(t *testing.T) {
 		t.Errorf("Expect error when empty name")
 	}
 
-	p.Steps = []*Step{{Name: "build"}, {Name: "test", Image: "plugins/docker"}}
+	p.Steps = []*Step{{Name: "build"}, {Name: "test", Image: "plugins/docker", Commands: []string{"docker build ."}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when image and commands defined")
+	}
+}
+
+func TestLint_Shell(t *testing.T) {
+	p := new(Pipeline)
+	p.Steps = []*Step{{Name: "build", Shell: "bash"}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	p.Steps = []*Step{{Name: "build", Shell: "fish"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when shell unsupported")
+	}
+}
+
+func TestLint_Trace(t *testing.T) {
+	p := new(Pipeline)
+	p.Steps = []*Step{{Name: "build", Trace: true}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	p.Steps = []*Step{{Name: "build", Quiet: true, Trace: true}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when quiet step enables trace")
+	}
+}
+
+func TestParse_Sparse(t *testing.T) {
+	resources, err := manifest.ParseFile("testdata/sparse.yml")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	pipeline := resources.Resources[0].(*Pipeline)
+	if got, want := pipeline.Clone.Depth, 1; got != want {
+		t.Errorf("Want clone depth %d, got %d", want, got)
+	}
+	if diff := cmp.Diff(pipeline.Clone.Sparse, []string{"services/api", "libs/common"}); diff != "" {
+		t.Errorf("Unexpected sparse checkout paths")
+		t.Log(diff)
+	}
+}
+
+func TestLint_Sparse(t *testing.T) {
+	p := new(Pipeline)
+	p.Steps = []*Step{{Name: "build"}}
+	p.Clone.Sparse = []string{"services/api"}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	for _, path := range []string{"../api", "/services/api", "services/$(id)"} {
+		p.Clone.Sparse = []string{path}
+		if err := lint(p); err == nil {
+			t.Errorf("Expect error when sparse path is %s", path)
+		}
+	}
+}
+
+func TestLint_CacheKey(t *testing.T) {
+	p := new(Pipeline)
+	p.Steps = []*Step{{Name: "generate", CacheKey: &CacheKey{Files: []string{"proto/**/*.proto"}}}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	p.Steps = []*Step{{Name: "generate", CacheKey: &CacheKey{}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when cache key is empty")
+	}
+
+	p.Steps = []*Step{{Name: "generate", CacheKey: &CacheKey{Files: []string{"../secrets"}}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when cache key files are outside the workspace")
+	}
+
+	p.Steps = []*Step{{Name: "redis", Detach: true, CacheKey: &CacheKey{Env: []string{"REDIS_VERSION"}}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when detached step defines a cache key")
+	}
+}
+
+func TestLint_SecretFiles(t *testing.T) {
+	p := new(Pipeline)
+	p.Steps = []*Step{{
+		Name: "deploy",
+		SecretFiles: map[string]*manifest.Variable{
+			"kubeconfig": {Secret: "kubeconfig"},
+		},
+	}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	p.Steps[0].SecretFiles["kubeconfig"] = &manifest.Variable{Value: "apiVersion: v1"}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when secret file not sourced from a secret")
+	}
+
+	for _, name := range []string{"../../opt/clone", "../../../../etc/cron.d/x", "/etc/passwd", "..", `..\clone`, "C:clone"} {
+		p.Steps[0].SecretFiles = map[string]*manifest.Variable{
+			name: {Secret: "kubeconfig"},
+		}
+		if err := lint(p); err == nil {
+			t.Errorf("Expect error when secret file name %q invalid", name)
+		}
+	}
+}
+
+func TestLint_Entrypoint(t *testing.T) {
+	p := new(Pipeline)
+	p.Steps = []*Step{{Name: "build", Entrypoint: []string{"go"}, Args: []string{"build", "./..."}}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	p.Steps = []*Step{{Name: "build", Args: []string{"build"}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when args defined without entrypoint")
+	}
+
+	p.Steps = []*Step{{Name: "build", Entrypoint: []string{"go"}, Commands: []string{"go build"}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when entrypoint and commands defined")
+	}
+
+	p.Steps = []*Step{{Name: "build", Entrypoint: []string{"go"}, Shell: "bash"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when entrypoint and shell defined")
+	}
+
+	p.Steps = []*Step{{Name: "build", Entrypoint: []string{"go"}, Image: "golang"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when entrypoint defined for plugin")
+	}
+
+	p.Steps = []*Step{{Name: "build", Entrypoint: []string{"go"}, Image: "golang", Runtime: "docker"}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+}
+
+func TestLint_Plugins(t *testing.T) {
+	p := new(Pipeline)
+	p.Steps = []*Step{{
+		Name:  "notify",
+		Image: "plugins/slack",
+		Settings: map[string]*manifest.Parameter{
+			"channel": {Value: "dev"},
+		},
+	}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	p.Steps[0].Image = ""
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when settings defined without image")
+	}
+
+	p.Services = []*Step{{Name: "redis", Image: "redis", Commands: []string{"redis-server"}}}
+	p.Steps = []*Step{{Name: "test"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when service image defined")
+	}
+}
+
+func TestLint_Runtime(t *testing.T) {
+	p := new(Pipeline)
+	p.Steps = []*Step{{Name: "lint", Image: "golang", Runtime: "docker", Commands: []string{"go vet ./..."}}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	p.Steps = []*Step{{Name: "lint", Runtime: "podman", Commands: []string{"go vet ./..."}}}
 	if err := lint(p); err == nil {
-		t.Errorf("Expect error when image defined")
+		t.Errorf("Expect error when runtime defined without image")
+	}
+
+	p.Steps = []*Step{{Name: "lint", Image: "ghcr.io/octocat/lint:1", Runtime: "wasi"}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	p.Steps[0].Commands = []string{"lint"}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when wasi step defines commands")
+	}
+
+	p.Steps = []*Step{{Name: "lint", Image: "golang", Runtime: "lxc"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when runtime unsupported")
+	}
+}
+
+func TestLint_Network(t *testing.T) {
+	p := new(Pipeline)
+	p.Steps = []*Step{{Name: "test", Network: "none", Commands: []string{"go test ./..."}}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	p.Steps[0].Network = "host"
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when network unsupported")
+	}
+}
+
+func TestLint_Hosts(t *testing.T) {
+	p := new(Pipeline)
+	p.Steps = []*Step{{Name: "test"}}
+	p.Hosts = []*HostAlias{{IP: "10.0.0.5", Hostnames: []string{"api.internal", "db"}}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	p.Hosts = []*HostAlias{{IP: "api", Hostnames: []string{"api.internal"}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when host alias ip invalid")
+	}
+
+	p.Hosts = []*HostAlias{{IP: "::1", Hostnames: []string{"api internal"}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when host alias hostname invalid")
+	}
+
+	p.Hosts = []*HostAlias{{IP: "::1"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when host alias hostnames missing")
+	}
+}
+
+func TestLint_Services(t *testing.T) {
+	p := new(Pipeline)
+	p.Services = []*Step{{Name: "redis", Commands: []string{"redis-server"}}}
+	p.Steps = []*Step{{Name: "test"}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	p.Steps = []*Step{{Name: "redis"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when step and service name conflict")
+	}
+
+	p.Services = []*Step{{Name: "redis"}}
+	p.Steps = []*Step{{Name: "test"}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when service commands empty")
+	}
+}
+
+func TestLint_Ready(t *testing.T) {
+	p := new(Pipeline)
+	p.Steps = []*Step{{Name: "web", Detach: true, Ready: &Probe{HTTP: "http://localhost:8080"}}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	p.Steps = []*Step{{Name: "web", Ready: &Probe{HTTP: "http://localhost:8080"}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when readiness probe defined for attached step")
+	}
+
+	p.Steps = []*Step{{Name: "web", Detach: true, Ready: &Probe{}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when readiness probe is empty")
+	}
+
+	p.Steps = []*Step{{Name: "web", Detach: true, Ready: &Probe{TCP: "8080", HTTP: "http://localhost:8080"}}}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when readiness probe defines multiple checks")
+	}
+}
+
+func TestParseReady(t *testing.T) {
+	got, err := manifest.ParseFile("testdata/ready.yml")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	pipeline := got.Resources[0].(*Pipeline)
+	want := &Probe{
+		TCP:     "5432",
+		Timeout: Duration(30 * time.Second),
+	}
+	if diff := cmp.Diff(pipeline.Steps[0].Ready, want); diff != "" {
+		t.Errorf("Unexpected readiness probe")
+		t.Log(diff)
+	}
+}
+
+func TestLint_Ports(t *testing.T) {
+	p := new(Pipeline)
+	p.Ports = []string{"postgres", "redis"}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	p.Ports = []string{"postgres", "postgres"}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when duplicate port name")
+	}
+
+	p.Ports = []string{""}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when empty port name")
+	}
+}
+
+func TestLint_Umask(t *testing.T) {
+	p := new(Pipeline)
+	p.Umask = "0027"
+	p.Steps = []*Step{{Name: "build", Umask: "077"}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+	for _, umask := range []string{"0999", "rwx", "01000"} {
+		p.Steps[0].Umask = umask
+		if err := lint(p); err == nil {
+			t.Errorf("Expect error when umask %q invalid", umask)
+		}
+	}
+}
+
+func TestLint_Ulimits(t *testing.T) {
+	p := new(Pipeline)
+	p.Ulimits = map[string]int64{"nofile": 1024}
+	p.Steps = []*Step{{Name: "test", Ulimits: map[string]int64{"nproc": 100, "core": 0}}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+	p.Steps[0].Ulimits = map[string]int64{"stack": 100}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when ulimit unsupported")
+	}
+	p.Steps[0].Ulimits = map[string]int64{"nofile": -1}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when ulimit negative")
+	}
+}
+
+func TestLint_Artifacts(t *testing.T) {
+	p := new(Pipeline)
+	p.Artifacts = []string{"dist", "build/*.tar.gz"}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+	for _, path := range []string{"/etc/passwd", "../secrets", "dist/../../home", ""} {
+		p.Artifacts = []string{path}
+		if err := lint(p); err == nil {
+			t.Errorf("Expect error when artifact path %q invalid", path)
+		}
+	}
+}
+
+func TestLint_Pause(t *testing.T) {
+	p := new(Pipeline)
+	p.Steps = []*Step{{Name: "approve", Pause: &Pause{Message: "deploy?"}}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+	p.Steps[0].Commands = []string{"make deploy"}
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when pause step defines commands")
+	}
+	p.Steps[0].Commands = nil
+	p.Steps[0].Detach = true
+	if err := lint(p); err == nil {
+		t.Errorf("Expect error when pause step is detached")
+	}
+}
+
+func TestParse_Overrides(t *testing.T) {
+	resources, err := manifest.ParseFile("testdata/overrides.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := resources.Resources[0].(*Pipeline)
+	want := Override{Timeout: Duration(3 * time.Hour), FreshWorkspace: true}
+	if diff := cmp.Diff(pipeline.Override("cron"), want); diff != "" {
+		t.Errorf("Unexpected cron override")
+		t.Log(diff)
+	}
+	if diff := cmp.Diff(pipeline.Override("push"), Override{}); diff != "" {
+		t.Errorf("Expect no override for push events")
+		t.Log(diff)
+	}
+}
+
+func TestLint_Overrides(t *testing.T) {
+	p := new(Pipeline)
+	p.Steps = []*Step{{Name: "build"}}
+	p.Overrides = map[string]*Override{"cron": {Timeout: Duration(time.Hour)}}
+	if err := lint(p); err != nil {
+		t.Errorf("Expect no lint error, got %s", err)
+	}
+
+	for _, overrides := range []map[string]*Override{
+		{"": {}},
+		{"cron": nil},
+		{"cron": {Timeout: Duration(-time.Hour)}},
+	} {
+		p.Overrides = overrides
+		if err := lint(p); err == nil {
+			t.Errorf("Expect lint error for overrides %v", overrides)
+		}
 	}
 }
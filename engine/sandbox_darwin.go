@@ -0,0 +1,27 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build darwin
+
+package engine
+
+import (
+	"fmt"
+	"os"
+)
+
+// path of the sandbox-exec utility, which is a variable so
+// that it can be replaced in tests.
+var sandboxExec = "/usr/bin/sandbox-exec"
+
+// helper function returns the command and arguments used to
+// execute the command with the sandbox profile. The profile
+// is passed inline, so that it cannot be modified by steps
+// that have write access to the pipeline root.
+func sandboxCommand(profile string, command string, args []string) (string, []string, error) {
+	if _, err := os.Stat(sandboxExec); err != nil {
+		return "", nil, fmt.Errorf("cannot apply sandbox profile: %s", err)
+	}
+	return sandboxExec, append([]string{"-p", profile, command}, args...), nil
+}
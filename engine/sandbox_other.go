@@ -0,0 +1,15 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !darwin
+
+package engine
+
+import "errors"
+
+// helper function returns an error, since sandbox profiles
+// are only supported on macos.
+func sandboxCommand(profile string, command string, args []string) (string, []string, error) {
+	return "", nil, errors.New("sandbox profiles are only supported on macos")
+}
@@ -0,0 +1,100 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// cmdScript converts the commands to a batch script. The
+// script exits on the first failing command with the command
+// exit code, and the failing command is written to the log
+// footer. The exit code of a multi-line command is checked
+// after each line, except for continued lines and lines in a
+// parenthesized block.
+func cmdScript(commands []string, opts Options) string {
+	echo := !opts.Quiet && !opts.Trace
+	buf := new(bytes.Buffer)
+	if opts.Trace {
+		fmt.Fprintln(buf, "@echo on")
+	} else {
+		fmt.Fprintln(buf, "@echo off")
+	}
+	for _, command := range commands {
+		lines := strings.Split(command, "\n")
+		fmt.Fprintln(buf)
+		if echo {
+			fmt.Fprintf(buf, "echo + %s\n", cmdEscape(strings.Join(lines, " ")))
+		}
+		var depth int
+		var pending []string
+		for i, line := range lines {
+			fmt.Fprintln(buf, line)
+			pending = append(pending, line)
+			depth += cmdDepth(line)
+			last := i == len(lines)-1
+			if !last && (depth > 0 || strings.HasSuffix(strings.TrimSpace(line), "^")) {
+				continue
+			}
+			var footer string
+			if echo {
+				footer = ": " + cmdEscape(strings.Join(pending, " "))
+			}
+			fmt.Fprintf(buf, cmdCheck, footer)
+			pending = nil
+		}
+	}
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "exit /b 0")
+	return buf.String()
+}
+
+// cmdEscape escapes the special characters of the string for
+// use with the batch echo command.
+func cmdEscape(s string) string {
+	var buf strings.Builder
+	for _, r := range s {
+		switch r {
+		case '%':
+			buf.WriteString("%%")
+			continue
+		case '^', '&', '|', '<', '>', '(', ')':
+			buf.WriteRune('^')
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// cmdDepth returns the change in the parenthesis depth of the
+// line, ignoring quoted and escaped parentheses.
+func cmdDepth(line string) int {
+	var depth int
+	var quoted, escaped bool
+	for _, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '^' && !quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case r == '(' && !quoted:
+			depth++
+		case r == ')' && !quoted:
+			depth--
+		}
+	}
+	return depth
+}
+
+// cmdCheck exits with the exit code of the failing command.
+const cmdCheck = `if %%errorlevel%% neq 0 (
+  echo + step failed with exit code %%errorlevel%%%s
+  exit /b %%errorlevel%%
+)
+`
@@ -0,0 +1,69 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// posixScript returns a function that converts the commands
+// to a posix shell script. The script exits on the first
+// failing command, preserving the command exit code, and the
+// failing command is written to the log footer.
+func posixScript(pipefail string) func([]string, Options) string {
+	return func(commands []string, opts Options) string {
+		echo := !opts.Quiet && !opts.Trace
+		buf := new(bytes.Buffer)
+		fmt.Fprintln(buf)
+		fmt.Fprintln(buf, "set -e")
+		fmt.Fprintln(buf, pipefail)
+		if echo {
+			buf.WriteString(posixTrap + "\n")
+		} else {
+			buf.WriteString(posixTrapQuiet + "\n")
+		}
+		if opts.Trace {
+			fmt.Fprintln(buf, "set -x")
+		}
+		for _, command := range commands {
+			if echo {
+				fmt.Fprintf(buf, posixTrace, posixQuote(command), command)
+			} else {
+				fmt.Fprintf(buf, "\n%s\n", command)
+			}
+		}
+		return buf.String()
+	}
+}
+
+// posixQuote returns the string quoted for use in a posix
+// shell, where no characters are expanded.
+func posixQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// pipefail options for bash, and for posix shells that may
+// not support the option.
+const (
+	bashPipefail  = "set -o pipefail"
+	posixPipefail = "if (set -o pipefail) 2>/dev/null; then set -o pipefail; fi"
+)
+
+// posixTrap writes the failing command and exit code when the
+// script exits, without altering the exit code.
+const posixTrap = `trap '__drone_exit=$?; if [ $__drone_exit -ne 0 ]; then printf "+ step failed with exit code %s: %s\n" "$__drone_exit" "$__drone_command"; fi' EXIT`
+
+// posixTrapQuiet writes the exit code when the script exits,
+// without writing the failing command.
+const posixTrapQuiet = `trap '__drone_exit=$?; if [ $__drone_exit -ne 0 ]; then printf "+ step failed with exit code %s\n" "$__drone_exit"; fi' EXIT`
+
+// posixTrace traces and executes the command.
+const posixTrace = `
+__drone_command=%s
+printf '+ %%s\n' "$__drone_command"
+%s
+`
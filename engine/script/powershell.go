@@ -0,0 +1,65 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// powershellScript converts the commands to a powershell
+// script. The script exits on the first failing command, or
+// the first terminating error, and the failing command is
+// written to the log footer.
+func powershellScript(commands []string, opts Options) string {
+	echo := !opts.Quiet && !opts.Trace
+	buf := new(bytes.Buffer)
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, powershellOptions)
+	if opts.Trace {
+		fmt.Fprintln(buf, "Set-PSDebug -Trace 1")
+	}
+	for _, command := range commands {
+		if echo {
+			fmt.Fprintf(buf, powershellTrace, powershellQuote(command))
+		}
+		fmt.Fprintf(buf, powershellExec, command)
+	}
+	return buf.String()
+}
+
+// powershellQuote returns the string quoted as a powershell
+// verbatim string, where no characters are expanded.
+func powershellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// powershellOptions configures the script to stop on error,
+// and writes the failing command when a terminating error
+// is raised.
+const powershellOptions = `$ErrorActionPreference = 'Stop'
+$__drone_command = ''
+trap {
+  Write-Output $_
+  Write-Output ('+ step failed with exit code 1' + $(if ($__drone_command) { ': ' + $__drone_command }))
+  exit 1
+}`
+
+// powershellTrace traces the command.
+const powershellTrace = `
+$__drone_command = %s
+Write-Output ('+ ' + $__drone_command)`
+
+// powershellExec executes the command, and exits with the
+// exit code of the failing native command.
+const powershellExec = `
+$global:LASTEXITCODE = 0
+%s
+if ($LASTEXITCODE -ne 0) {
+  Write-Output ('+ step failed with exit code ' + $LASTEXITCODE + $(if ($__drone_command) { ': ' + $__drone_command }))
+  exit $LASTEXITCODE
+}
+`
@@ -0,0 +1,131 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package script generates the shell scripts that execute the
+// commands of a pipeline step.
+package script
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Shell defines a shell used to execute pipeline step scripts.
+type Shell struct {
+	// Name is the name of the shell.
+	Name string
+
+	// Command is the shell executable.
+	Command string
+
+	// Args are the shell arguments, which precede the script
+	// file path.
+	Args []string
+
+	// Suffix is the script file extension.
+	Suffix string
+
+	generate func([]string, Options) string
+}
+
+// Options configures the generated script.
+type Options struct {
+	// Quiet disables echoing the commands, for commands that
+	// contain interpolated sensitive values.
+	Quiet bool
+
+	// Trace enables shell tracing (e.g. set -x) for
+	// debugging, which replaces echoing the commands.
+	Trace bool
+}
+
+// Supported shells.
+var (
+	Sh = &Shell{
+		Name:     "sh",
+		Command:  "/bin/sh",
+		Args:     []string{"-e"},
+		generate: posixScript(posixPipefail),
+	}
+	Bash = &Shell{
+		Name:     "bash",
+		Command:  "bash",
+		Args:     []string{"-e"},
+		generate: posixScript(bashPipefail),
+	}
+	Powershell = &Shell{
+		Name:     "powershell",
+		Command:  "powershell",
+		Args:     []string{"-noprofile", "-noninteractive", "-file"},
+		Suffix:   ".ps1",
+		generate: powershellScript,
+	}
+	Pwsh = &Shell{
+		Name:     "pwsh",
+		Command:  "pwsh",
+		Args:     []string{"-noprofile", "-noninteractive", "-file"},
+		Suffix:   ".ps1",
+		generate: powershellScript,
+	}
+	Cmd = &Shell{
+		Name:     "cmd",
+		Command:  "cmd",
+		Args:     []string{"/d", "/c"},
+		Suffix:   ".cmd",
+		generate: cmdScript,
+	}
+)
+
+var shells = map[string]*Shell{
+	Sh.Name:         Sh,
+	Bash.Name:       Bash,
+	Powershell.Name: Powershell,
+	Pwsh.Name:       Pwsh,
+	Cmd.Name:        Cmd,
+}
+
+// Lookup returns the named shell, or the default shell for
+// the host platform if the name is empty. If the name is a
+// path to the shell executable, the shell is looked up by the
+// base name and executed using the path. A nil value is
+// returned if the shell is not supported.
+func Lookup(name string) *Shell {
+	if name == "" {
+		return Default
+	}
+	if shell, ok := shells[name]; ok {
+		return shell
+	}
+	base := strings.TrimSuffix(filepath.Base(name), ".exe")
+	shell, ok := shells[base]
+	if !ok || base == name {
+		return nil
+	}
+	copy := *shell
+	copy.Command = name
+	return &copy
+}
+
+// Names returns the names of the supported shells.
+func Names() []string {
+	var names []string
+	for name := range shells {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Script returns the script that executes the commands.
+func (s *Shell) Script(commands []string, opts Options) string {
+	return s.generate(commands, opts)
+}
+
+// Exec returns the command and arguments that execute the
+// script at the given path.
+func (s *Shell) Exec(path string) (string, []string) {
+	args := append([]string{}, s.Args...)
+	return s.Command, append(args, path)
+}
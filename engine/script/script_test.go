@@ -0,0 +1,210 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package script
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// test cases are generated for every supported shell, and
+// compared to the golden file testdata/<shell>/<case>.golden
+var tests = []struct {
+	name     string
+	commands []string
+	opts     Options
+}{
+	{
+		name:     "simple",
+		commands: []string{"go build", "go test"},
+	},
+	{
+		name:     "quotes",
+		commands: []string{`echo "hello world"`, `echo 'single quoted'`},
+	},
+	{
+		name:     "variables",
+		commands: []string{"echo $DRONE_COMMIT", "echo ${DRONE_BRANCH}"},
+	},
+	{
+		name:     "multiline",
+		commands: []string{"if true; then\n  echo yes\nfi"},
+	},
+	{
+		name:     "multiline_exit",
+		commands: []string{"go build\ngo vet\ngo test"},
+	},
+	{
+		name:     "multiline_block",
+		commands: []string{"if exist go.mod (\n  go build\n)\ngo test ^\n  -v"},
+	},
+	{
+		name:     "exit",
+		commands: []string{"false", "echo unreachable"},
+	},
+	{
+		name:     "special",
+		commands: []string{"echo `whoami` $(id) 100% & done | cat > out.txt"},
+	},
+	{
+		name:     "quiet",
+		commands: []string{"login --password $PASSWORD"},
+		opts:     Options{Quiet: true},
+	},
+	{
+		name:     "trace",
+		commands: []string{"go build", "go test"},
+		opts:     Options{Trace: true},
+	},
+}
+
+func TestScript(t *testing.T) {
+	for _, name := range Names() {
+		shell := Lookup(name)
+		for _, test := range tests {
+			path := filepath.Join("testdata", name, test.name+".golden")
+			got := shell.Script(test.commands, test.opts)
+			if *update {
+				os.MkdirAll(filepath.Dir(path), 0755)
+				ioutil.WriteFile(path, []byte(got), 0644)
+				continue
+			}
+			want, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			if diff := cmp.Diff(string(want), got); diff != "" {
+				t.Errorf("Unexpected %s script for %s: %s", name, test.name, diff)
+			}
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if Lookup("") != Default {
+		t.Errorf("Expect default shell when name is empty")
+	}
+	if Lookup("bash") != Bash {
+		t.Errorf("Expect bash shell")
+	}
+	if shell := Lookup("/usr/local/bin/bash"); shell == nil || shell.Command != "/usr/local/bin/bash" {
+		t.Errorf("Expect bash shell executed using path")
+	}
+	if Lookup("/usr/bin/fish") != nil {
+		t.Errorf("Expect nil shell when path not supported")
+	}
+	if Lookup("fish") != nil {
+		t.Errorf("Expect nil shell when not supported")
+	}
+}
+
+func TestExec(t *testing.T) {
+	cmd, args := Pwsh.Exec("C:\\drone\\opt\\build.ps1")
+	if got, want := cmd, "pwsh"; got != want {
+		t.Errorf("Want command %s, got %s", want, got)
+	}
+	want := []string{"-noprofile", "-noninteractive", "-file", "C:\\drone\\opt\\build.ps1"}
+	if diff := cmp.Diff(want, args); diff != "" {
+		t.Errorf(diff)
+	}
+	if len(Pwsh.Args) != 3 {
+		t.Errorf("Expect shell arguments are not modified")
+	}
+}
+
+func TestScript_Exec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("posix shells not available")
+	}
+	tests := []struct {
+		shell    *Shell
+		commands []string
+		opts     Options
+		code     int
+		output   []string
+		excluded []string
+	}{
+		{
+			shell:    Sh,
+			commands: []string{"echo one", "exit 3", "echo unreachable"},
+			code:     3,
+			output:   []string{"+ echo one\none\n", "+ step failed with exit code 3: exit 3\n"},
+			excluded: []string{"unreachable\n"},
+		},
+		{
+			shell:    Bash,
+			commands: []string{"false | true", "echo unreachable"},
+			code:     1,
+			output:   []string{"+ step failed with exit code 1: false | true\n"},
+			excluded: []string{"unreachable\n"},
+		},
+		{
+			shell:    Sh,
+			commands: []string{"echo `echo hi` '$HOME'"},
+			code:     0,
+			output:   []string{"+ echo `echo hi` '$HOME'\nhi $HOME\n"},
+			excluded: []string{"step failed"},
+		},
+		{
+			shell:    Sh,
+			commands: []string{"echo $0 > /dev/null", "exit 2"},
+			opts:     Options{Quiet: true},
+			code:     2,
+			output:   []string{"+ step failed with exit code 2\n"},
+			excluded: []string{"echo", "exit 2"},
+		},
+		{
+			shell:    Sh,
+			commands: []string{"echo traced"},
+			opts:     Options{Trace: true},
+			code:     0,
+			output:   []string{"+ echo traced\ntraced\n"},
+		},
+	}
+	for _, test := range tests {
+		if _, err := exec.LookPath(test.shell.Command); err != nil {
+			continue
+		}
+		dir, err := ioutil.TempDir("", "script")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "script"+test.shell.Suffix)
+		ioutil.WriteFile(path, []byte(test.shell.Script(test.commands, test.opts)), 0700)
+		cmd, args := test.shell.Exec(path)
+		out, err := exec.Command(cmd, args...).CombinedOutput()
+		code := 0
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			code = exiterr.ExitCode()
+		}
+		if code != test.code {
+			t.Errorf("Want %s exit code %d, got %d", test.shell.Name, test.code, code)
+		}
+		for _, s := range test.output {
+			if !strings.Contains(string(out), s) {
+				t.Errorf("Expect %s output to contain %q, got %q", test.shell.Name, s, out)
+			}
+		}
+		for _, s := range test.excluded {
+			if strings.Contains(string(out), s) {
+				t.Errorf("Expect %s output to exclude %q, got %q", test.shell.Name, s, out)
+			}
+		}
+	}
+}
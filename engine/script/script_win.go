@@ -0,0 +1,10 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build windows
+
+package script
+
+// Default is the default shell for the host platform.
+var Default = Powershell
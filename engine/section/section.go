@@ -0,0 +1,160 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package section encodes collapsible log sections. A section
+// is started by a line that contains a group marker, and ends
+// with a line that contains an endgroup marker:
+//
+//	##[group]Install dependencies
+//	...
+//	##[endgroup]
+//
+// The github actions workflow commands are also accepted, and
+// are encoded with the same markers:
+//
+//	::group::Install dependencies
+//	...
+//	::endgroup::
+package section
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// markers used to encode the log sections.
+const (
+	groupMarker    = "##[group]"
+	endgroupMarker = "##[endgroup]"
+)
+
+// markers accepted from the step output, in addition to the
+// encoded markers.
+const (
+	actionsGroup    = "::group::"
+	actionsEndgroup = "::endgroup::"
+)
+
+// Group writes a marker that starts the named section.
+func Group(w io.Writer, name string) {
+	fmt.Fprintf(w, "%s%s\n", groupMarker, name)
+}
+
+// End writes a marker that ends the current section.
+func End(w io.Writer) {
+	fmt.Fprintln(w, endgroupMarker)
+}
+
+// IsMarker returns true if the line is an encoded section
+// marker.
+func IsMarker(line string) bool {
+	return strings.HasPrefix(line, groupMarker) || strings.HasPrefix(line, endgroupMarker)
+}
+
+// Writer is an io.Writer that encodes the section markers
+// written to the log. Markers must be written on their own
+// line. Sections that are not ended are closed when the writer
+// is closed, and endgroup markers without a matching group
+// marker are discarded.
+type Writer struct {
+	w     io.WriteCloser
+	buf   []byte
+	depth int
+}
+
+// New returns a section writer that wraps writer w.
+func New(w io.WriteCloser) io.WriteCloser {
+	return &Writer{w: w}
+}
+
+// Write writes p to the base writer, encoding lines that
+// contain section markers. A partial line is buffered until
+// the line is complete if it may contain a marker.
+func (s *Writer) Write(p []byte) (int, error) {
+	data := p
+	if len(s.buf) != 0 {
+		data = append(s.buf, p...)
+		s.buf = nil
+	}
+
+	var out bytes.Buffer
+	for len(data) != 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			if isPrefix(data) {
+				s.buf = append([]byte{}, data...)
+			} else {
+				out.Write(data)
+			}
+			break
+		}
+		line := data[:i+1]
+		data = data[i+1:]
+		out.Write(s.encode(line))
+	}
+	if out.Len() == 0 {
+		return len(p), nil
+	}
+	_, err := s.w.Write(out.Bytes())
+	return len(p), err
+}
+
+// Close ends the open sections and closes the base writer.
+func (s *Writer) Close() error {
+	var out bytes.Buffer
+	if len(s.buf) != 0 {
+		out.Write(s.encode(append(s.buf, '\n')))
+		s.buf = nil
+	}
+	for ; s.depth > 0; s.depth-- {
+		End(&out)
+	}
+	if out.Len() != 0 {
+		s.w.Write(out.Bytes())
+	}
+	return s.w.Close()
+}
+
+// helper function returns the encoded line.
+func (s *Writer) encode(line []byte) []byte {
+	text := strings.TrimSpace(string(line))
+	switch {
+	case strings.HasPrefix(text, groupMarker):
+		return s.group(strings.TrimPrefix(text, groupMarker))
+	case strings.HasPrefix(text, actionsGroup):
+		return s.group(strings.TrimPrefix(text, actionsGroup))
+	case text == endgroupMarker, text == actionsEndgroup:
+		if s.depth == 0 {
+			return nil
+		}
+		s.depth--
+		return []byte(endgroupMarker + "\n")
+	default:
+		return line
+	}
+}
+
+// helper function returns the encoded group marker.
+func (s *Writer) group(name string) []byte {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Output"
+	}
+	s.depth++
+	return []byte(groupMarker + name + "\n")
+}
+
+// helper function returns true if the partial line may be the
+// start of a marker.
+func isPrefix(data []byte) bool {
+	text := strings.TrimLeft(string(data), " \t")
+	for _, marker := range []string{groupMarker, endgroupMarker, actionsGroup, actionsEndgroup} {
+		if strings.HasPrefix(marker, text) || strings.HasPrefix(text, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package section
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := New(&nopCloser{buf})
+	io.WriteString(w, "before\n")
+	io.WriteString(w, "  ::group::  Install \r\n")
+	io.WriteString(w, "npm install\n##[gr")
+	io.WriteString(w, "oup]nested\nnested output\n")
+	io.WriteString(w, "##[endgroup]\n::endgroup::\n")
+	io.WriteString(w, "::endgroup::\n")
+	io.WriteString(w, "after")
+	w.Close()
+
+	want := "before\n" +
+		"##[group]Install\n" +
+		"npm install\n" +
+		"##[group]nested\n" +
+		"nested output\n" +
+		"##[endgroup]\n" +
+		"##[endgroup]\n" +
+		"after"
+	if got := buf.String(); got != want {
+		t.Errorf("Want encoded output %q, got %q", want, got)
+	}
+}
+
+// this test verifies that sections that are not ended are
+// closed when the writer is closed.
+func TestWriter_Unterminated(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := New(&nopCloser{buf})
+	Group(w, "clone")
+	io.WriteString(w, "git init\n##[group]")
+	w.Close()
+
+	want := "##[group]clone\n" +
+		"git init\n" +
+		"##[group]Output\n" +
+		"##[endgroup]\n" +
+		"##[endgroup]\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Want encoded output %q, got %q", want, got)
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (*nopCloser) Close() error {
+	return nil
+}
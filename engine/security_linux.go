@@ -0,0 +1,88 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// security module interfaces, which are variables so that they
+// can be replaced in tests.
+var (
+	apparmorProfiles = "/sys/kernel/security/apparmor/profiles"
+	selinuxContext   = "/sys/fs/selinux/context"
+)
+
+// helper function returns the command and arguments used to
+// execute the command with the selinux context or apparmor
+// profile. The process cannot transition itself before exec,
+// so the command is executed by runcon or aa-exec, which
+// transition before replacing themselves with the command.
+func securityCommand(security *Security, command string, args []string) (string, []string, error) {
+	switch {
+	case security.AppArmor != "":
+		profile := security.AppArmor
+		if err := checkAppArmor(profile); err != nil {
+			return "", nil, fmt.Errorf("cannot apply apparmor profile %q: %s", profile, err)
+		}
+		path, err := exec.LookPath("aa-exec")
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot apply apparmor profile %q: aa-exec is not installed", profile)
+		}
+		return path, append([]string{"-p", profile, "--", command}, args...), nil
+	case security.SELinux != "":
+		context := security.SELinux
+		if err := checkSELinux(context); err != nil {
+			return "", nil, fmt.Errorf("cannot apply selinux context %q: %s", context, err)
+		}
+		path, err := exec.LookPath("runcon")
+		if err != nil {
+			return "", nil, fmt.Errorf("cannot apply selinux context %q: runcon is not installed", context)
+		}
+		return path, append([]string{context, command}, args...), nil
+	}
+	return command, args, nil
+}
+
+// helper function returns an error if apparmor is disabled or
+// the profile is not loaded.
+func checkAppArmor(profile string) error {
+	f, err := os.Open(apparmorProfiles)
+	if err != nil {
+		return fmt.Errorf("apparmor is not enabled")
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// each line lists the profile name and mode, for
+		// example, "drone-step (enforce)".
+		line := scanner.Text()
+		if i := strings.LastIndex(line, " ("); i != -1 && line[:i] == profile {
+			return nil
+		}
+	}
+	return fmt.Errorf("profile is not loaded")
+}
+
+// helper function returns an error if selinux is disabled or
+// the context is invalid. The context is validated by writing
+// to the selinux context interface.
+func checkSELinux(context string) error {
+	f, err := os.OpenFile(selinuxContext, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("selinux is not enabled")
+	}
+	defer f.Close()
+	if _, err := f.Write(append([]byte(context), 0)); err != nil {
+		return fmt.Errorf("invalid context")
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package engine
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecurityCommand_AppArmor(t *testing.T) {
+	dir := t.TempDir()
+	before := apparmorProfiles
+	defer func() { apparmorProfiles = before }()
+
+	apparmorProfiles = filepath.Join(dir, "missing")
+	_, _, err := securityCommand(&Security{AppArmor: "drone-step"}, "/bin/sh", nil)
+	if err == nil || !strings.Contains(err.Error(), "apparmor is not enabled") {
+		t.Errorf("Want apparmor disabled error, got %v", err)
+	}
+
+	apparmorProfiles = filepath.Join(dir, "profiles")
+	ioutil.WriteFile(apparmorProfiles, []byte("docker-default (enforce)\n"), 0600)
+	_, _, err = securityCommand(&Security{AppArmor: "drone-step"}, "/bin/sh", nil)
+	if err == nil || !strings.Contains(err.Error(), `cannot apply apparmor profile "drone-step": profile is not loaded`) {
+		t.Errorf("Want profile not loaded error, got %v", err)
+	}
+
+	if err := checkAppArmor("docker-default"); err != nil {
+		t.Errorf("Want loaded profile accepted, got %v", err)
+	}
+}
+
+func TestSecurityCommand_SELinux(t *testing.T) {
+	before := selinuxContext
+	defer func() { selinuxContext = before }()
+
+	selinuxContext = filepath.Join(t.TempDir(), "missing")
+	_, _, err := securityCommand(&Security{SELinux: "system_u:system_r:drone_t:s0"}, "/bin/sh", nil)
+	if err == nil || !strings.Contains(err.Error(), "selinux is not enabled") {
+		t.Errorf("Want selinux disabled error, got %v", err)
+	}
+}
+
+func TestSecurityCommand_None(t *testing.T) {
+	command, args, err := securityCommand(&Security{}, "/bin/sh", []string{"-c", "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command != "/bin/sh" || len(args) != 2 {
+		t.Errorf("Want command unmodified, got %s %v", command, args)
+	}
+}
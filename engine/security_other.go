@@ -0,0 +1,18 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux
+
+package engine
+
+import "errors"
+
+// helper function returns an error, since selinux and apparmor
+// are only supported on linux.
+func securityCommand(security *Security, command string, args []string) (string, []string, error) {
+	if security.AppArmor == "" && security.SELinux == "" {
+		return command, args, nil
+	}
+	return "", nil, errors.New("selinux and apparmor are only supported on linux")
+}
@@ -4,6 +4,8 @@
 
 package engine
 
+import "time"
+
 type (
 	// Spec provides the pipeline spec. This provides the
 	// required instructions for reproducable pipeline
@@ -15,22 +17,130 @@ type (
 		Files    []*File  `json:"files,omitempty"`
 		Links    []*Link  `json:"links,omitempty"`
 		Steps    []*Step  `json:"steps,omitempty"`
+		Debug    *Debug   `json:"debug,omitempty"`
+		Umask    *uint32  `json:"umask,omitempty"`
+
+		Credential *Credential `json:"credential,omitempty"`
+		Artifacts  *Artifacts  `json:"artifacts,omitempty"`
+		Hosts      *Hosts      `json:"hosts,omitempty"`
+		User       *User       `json:"user,omitempty"`
+		Job        *Job        `json:"job,omitempty"`
+		Jail       *Jail       `json:"jail,omitempty"`
+		Zone       *Zone       `json:"zone,omitempty"`
+		Remote     *Remote     `json:"remote,omitempty"`
+	}
+
+	// Remote defines the remote host that executes the
+	// pipeline, instead of the local host.
+	Remote struct {
+		Host string `json:"host,omitempty"`
+	}
+
+	// Zone defines the ephemeral illumos zone that executes
+	// the step processes. The zone is cloned from the template
+	// zone, and the pipeline root is mounted in the zone at
+	// the same path.
+	Zone struct {
+		Name     string `json:"name,omitempty"`
+		Template string `json:"template,omitempty"`
+		Path     string `json:"path,omitempty"`
+	}
+
+	// Jail defines the ephemeral freebsd jail that executes
+	// the step processes. The jail root is a zfs clone of the
+	// template snapshot, and the pipeline root is mounted in
+	// the jail at the same path.
+	Jail struct {
+		Name     string `json:"name,omitempty"`
+		Template string `json:"template,omitempty"`
+		Dataset  string `json:"dataset,omitempty"`
+		Path     string `json:"path,omitempty"`
+	}
+
+	// Job defines the limits of the windows job object that
+	// contains the step processes of the pipeline. A zero
+	// value is not limited.
+	Job struct {
+		Memory    int64  `json:"memory,omitempty"`
+		Processes uint32 `json:"processes,omitempty"`
+		CPURate   uint32 `json:"cpu_rate,omitempty"`
+	}
+
+	// User defines the operating system user that owns the
+	// pipeline root and runs the step processes.
+	User struct {
+		Name string `json:"name,omitempty"`
+		UID  uint32 `json:"uid,omitempty"`
+		GID  uint32 `json:"gid,omitempty"`
+	}
+
+	// Artifacts configures the artifacts handed off between
+	// dependent stages. Artifacts of upstream stages are
+	// downloaded to the directory, and the workspace paths
+	// are uploaded once the stage completes.
+	Artifacts struct {
+		Dir    string   `json:"dir,omitempty"`
+		Source string   `json:"source,omitempty"`
+		Paths  []string `json:"paths,omitempty"`
+	}
+
+	// Hosts defines the host aliases of the pipeline. The
+	// hosts file is written to the path, and replaces the host
+	// machine hosts file for the steps with host aliases.
+	Hosts struct {
+		Path    string       `json:"path,omitempty"`
+		Aliases []*HostAlias `json:"aliases,omitempty"`
+	}
+
+	// HostAlias maps the hostnames to the ip address.
+	HostAlias struct {
+		IP        string   `json:"ip,omitempty"`
+		Hostnames []string `json:"hostnames,omitempty"`
+	}
+
+	// Credential configures the git credential helper socket,
+	// which serves the build credentials to step processes.
+	Credential struct {
+		Socket   string `json:"socket,omitempty"`
+		Machine  string `json:"machine,omitempty"`
+		Login    string `json:"login,omitempty"`
+		Password string `json:"password,omitempty"`
+	}
+
+	// Debug configures interactive debug sessions that keep
+	// the environment of a failed step alive for inspection.
+	Debug struct {
+		Timeout time.Duration `json:"timeout,omitempty"`
 	}
 
 	// Step defines a pipeline step.
 	Step struct {
 		Args         []string          `json:"args,omitempty"`
+		Cache        *Cache            `json:"cache,omitempty"`
 		Command      string            `json:"command,omitempty"`
+		CPUs         []int             `json:"cpus,omitempty"`
 		Detach       bool              `json:"detach,omitempty"`
 		DependsOn    []string          `json:"depends_on,omitempty"`
 		Envs         map[string]string `json:"environment,omitempty"`
 		Files        []*File           `json:"files,omitempty"`
+		Group        string            `json:"group,omitempty"`
+		HostAliases  bool              `json:"host_aliases,omitempty"`
 		IgnoreErr    bool              `json:"ignore_err,omitempty"`
 		IgnoreStdout bool              `json:"ignore_stderr,omitempty"`
 		IgnoreStderr bool              `json:"ignore_stdout,omitempty"`
 		Name         string            `json:"name,omitempt"`
+		NoNetwork    bool              `json:"no_network,omitempty"`
+		Pause        *Pause            `json:"pause,omitempty"`
+		Paths        []*Paths          `json:"paths,omitempty"`
+		Priority     *Priority         `json:"priority,omitempty"`
+		Ready        *Probe            `json:"ready,omitempty"`
 		RunPolicy    RunPolicy         `json:"run_policy,omitempty"`
+		Sandbox      string            `json:"sandbox,omitempty"`
 		Secrets      []*Secret         `json:"secrets,omitempty"`
+		Security     *Security         `json:"security,omitempty"`
+		Stop         []string          `json:"stop,omitempty"`
+		Summary      bool              `json:"summary,omitempty"`
+		Umask        *uint32           `json:"umask,omitempty"`
 		WorkingDir   string            `json:"working_dir,omitempty"`
 	}
 
@@ -44,12 +154,64 @@ type (
 		IsDir bool   `json:"is_dir,omitempty"`
 	}
 
+	// Cache defines the step inputs. The step is skipped if
+	// the inputs are unchanged since a previous successful
+	// run. Files are glob patterns relative to the working
+	// directory.
+	Cache struct {
+		Files []string `json:"files,omitempty"`
+		Env   []string `json:"env,omitempty"`
+	}
+
+	// Paths defines the patterns matched against the files
+	// changed by the build. The step is skipped unless a
+	// changed file matches an include pattern, and does not
+	// match an exclude pattern.
+	Paths struct {
+		Include []string `json:"include,omitempty"`
+		Exclude []string `json:"exclude,omitempty"`
+	}
+
+	// Pause defines an approval gate that pauses the stage
+	// until the step is approved or rejected.
+	Pause struct {
+		Message string        `json:"message,omitempty"`
+		Timeout time.Duration `json:"timeout,omitempty"`
+	}
+
+	// Priority defines the cpu and io scheduling priority
+	// of the step process.
+	Priority struct {
+		Nice    int `json:"nice,omitempty"`
+		IOClass int `json:"io_class,omitempty"`
+		IOLevel int `json:"io_level,omitempty"`
+	}
+
+	// Security defines the selinux context or apparmor
+	// profile under which the step process is launched.
+	Security struct {
+		SELinux  string `json:"selinux,omitempty"`
+		AppArmor string `json:"apparmor,omitempty"`
+	}
+
 	// Link defines a symbolic link.
 	Link struct {
 		Source string `json:"source,omitempty"`
 		Target string `json:"target,omitempty"`
 	}
 
+	// Probe defines a readiness probe that is used to
+	// determine when a detached step is ready to accept
+	// connections.
+	Probe struct {
+		TCP      string        `json:"tcp,omitempty"`
+		HTTP     string        `json:"http,omitempty"`
+		Command  string        `json:"command,omitempty"`
+		Args     []string      `json:"args,omitempty"`
+		Timeout  time.Duration `json:"timeout,omitempty"`
+		Interval time.Duration `json:"interval,omitempty"`
+	}
+
 	// Platform defines the target platform.
 	Platform struct {
 		OS      string `json:"os,omitempty"`
@@ -58,19 +220,26 @@ type (
 		Version string `json:"version,omitempty"`
 	}
 
-	// Secret represents a secret variable.
+	// Secret represents a secret variable. The secret is
+	// exposed to the step as an environment variable, or is
+	// written to the file path for the duration of the step.
 	Secret struct {
 		Name string `json:"name,omitempty"`
 		Env  string `json:"env,omitempty"`
+		File string `json:"file,omitempty"`
 		Data []byte `json:"data,omitempty"`
 		Mask bool   `json:"mask,omitempty"`
 	}
 
 	// State represents the process state.
 	State struct {
-		ExitCode  int  // Container exit code
-		Exited    bool // Container exited
-		OOMKilled bool // Container is oom killed
+		ExitCode  int    // Container exit code
+		Exited    bool   // Container exited
+		OOMKilled bool   // Container is oom killed
+		Signal    string // Process terminated by signal
+
+		CPU    time.Duration // Process user and system cpu time
+		MaxRSS int64         // Process peak resident set size in bytes
 	}
 )
 
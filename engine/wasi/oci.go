@@ -0,0 +1,218 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package wasi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// media type of the wasm module layer.
+const mediaTypeWasm = "application/vnd.wasm.content.layer.v1+wasm"
+
+// accepted manifest media types.
+var manifestTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ErrNoModule is returned when the image does not contain a
+// wasm module layer.
+var ErrNoModule = errors.New("image does not contain a wasm module")
+
+// Reference identifies a module in an OCI registry.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses the OCI image reference. Images
+// without a registry default to docker hub.
+func ParseReference(ref string) Reference {
+	var r Reference
+	if i := strings.Index(ref, "@"); i != -1 {
+		r.Digest = ref[i+1:]
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		r.Tag = ref[i+1:]
+		ref = ref[:i]
+	}
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		r.Registry, ref = parts[0], parts[1]
+	} else {
+		r.Registry = "registry-1.docker.io"
+		if !strings.Contains(ref, "/") {
+			ref = "library/" + ref
+		}
+	}
+	r.Repository = ref
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	return r
+}
+
+// Pull pulls the module from the OCI registry. Modules are
+// cached by digest in the cache directory, if provided.
+func Pull(ctx context.Context, ref, cache string) ([]byte, error) {
+	r := ParseReference(ref)
+	c := &registry{client: http.DefaultClient, scheme: "https"}
+	if strings.HasPrefix(r.Registry, "localhost") || strings.HasPrefix(r.Registry, "127.0.0.1") {
+		c.scheme = "http"
+	}
+
+	version := r.Digest
+	if version == "" {
+		version = r.Tag
+	}
+	manifest := new(manifest)
+	err := c.get(ctx, r, "manifests/"+version, strings.Join(manifestTypes, ","), func(data []byte) error {
+		return json.Unmarshal(data, manifest)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var layer *descriptor
+	for _, l := range manifest.Layers {
+		if l.MediaType == mediaTypeWasm {
+			layer = l
+			break
+		}
+	}
+	if layer == nil {
+		return nil, ErrNoModule
+	}
+
+	path := ""
+	if cache != "" {
+		path = filepath.Join(cache, strings.Replace(layer.Digest, ":", "-", 1)+".wasm")
+		if data, err := ioutil.ReadFile(path); err == nil {
+			return data, nil
+		}
+	}
+
+	var module []byte
+	err = c.get(ctx, r, "blobs/"+layer.Digest, "*/*", func(data []byte) error {
+		sum := sha256.Sum256(data)
+		if "sha256:"+hex.EncodeToString(sum[:]) != layer.Digest {
+			return fmt.Errorf("module digest mismatch: %s", layer.Digest)
+		}
+		module = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		os.MkdirAll(cache, 0700)
+		ioutil.WriteFile(path, module, 0600)
+	}
+	return module, nil
+}
+
+type manifest struct {
+	Layers []*descriptor `json:"layers"`
+}
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+}
+
+// registry is a minimal, anonymous OCI registry client.
+type registry struct {
+	client *http.Client
+	scheme string
+	token  string
+}
+
+func (c *registry) get(ctx context.Context, r Reference, path, accept string, fn func([]byte) error) error {
+	endpoint := fmt.Sprintf("%s://%s/v2/%s/%s", c.scheme, r.Registry, r.Repository, path)
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("GET", endpoint, nil)
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Accept", accept)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		res, err := c.client.Do(req)
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		if res.StatusCode == 401 && c.token == "" {
+			if err := c.authorize(ctx, res.Header.Get("WWW-Authenticate")); err != nil {
+				return err
+			}
+			continue
+		}
+		if res.StatusCode > 299 {
+			return fmt.Errorf("cannot pull %s: registry returned status %d", r.Repository, res.StatusCode)
+		}
+		return fn(data)
+	}
+	return fmt.Errorf("cannot pull %s: unauthorized", r.Repository)
+}
+
+var challengeRE = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// helper function requests an anonymous bearer token using
+// the authentication challenge.
+func (c *registry) authorize(ctx context.Context, challenge string) error {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return fmt.Errorf("unsupported registry authentication")
+	}
+	params := map[string]string{}
+	for _, match := range challengeRE.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	query := url.Values{}
+	query.Set("service", params["service"])
+	query.Set("scope", params["scope"])
+	req, err := http.NewRequest("GET", params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	out := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return err
+	}
+	c.token = out.Token
+	if c.token == "" {
+		c.token = out.AccessToken
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package wasi
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want Reference
+	}{
+		{"lint", Reference{Registry: "registry-1.docker.io", Repository: "library/lint", Tag: "latest"}},
+		{"octocat/lint:1", Reference{Registry: "registry-1.docker.io", Repository: "octocat/lint", Tag: "1"}},
+		{"ghcr.io/octocat/lint@sha256:abc", Reference{Registry: "ghcr.io", Repository: "octocat/lint", Digest: "sha256:abc"}},
+		{"localhost:5000/lint:2", Reference{Registry: "localhost:5000", Repository: "lint", Tag: "2"}},
+	}
+	for _, test := range tests {
+		if diff := cmp.Diff(test.want, ParseReference(test.ref)); diff != "" {
+			t.Errorf("Unexpected reference for %s: %s", test.ref, diff)
+		}
+	}
+}
+
+func TestPull(t *testing.T) {
+	module := []byte("\x00asm\x01\x00\x00\x00")
+	sum := sha256.Sum256(module)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			w.Write([]byte(`{"token":"anonymous"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer anonymous" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="http://%s/token",service="test",scope="repository:octocat/lint:pull"`, r.Host))
+			w.WriteHeader(401)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/octocat/lint/manifests/1":
+			fmt.Fprintf(w, `{"layers":[{"mediaType":%q,"digest":%q}]}`, mediaTypeWasm, digest)
+		case "/v2/octocat/lint/blobs/" + digest:
+			w.Write(module)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer ts.Close()
+
+	cache, err := ioutil.TempDir("", "wasi")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(cache)
+
+	ref := strings.TrimPrefix(ts.URL, "http://") + "/octocat/lint:1"
+	got, err := Pull(context.Background(), ref, cache)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(got) != string(module) {
+		t.Errorf("Unexpected module contents")
+	}
+	if _, err := os.Stat(cache + "/" + strings.Replace(digest, ":", "-", 1) + ".wasm"); err != nil {
+		t.Errorf("Expect module cached by digest")
+	}
+}
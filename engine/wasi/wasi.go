@@ -0,0 +1,94 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package wasi executes WASI modules in a sandboxed runtime
+// embedded in the runner.
+package wasi
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// Config configures the module execution.
+type Config struct {
+	// Dir is the host directory mounted as the module root
+	// directory. The module has no access to files outside
+	// this directory.
+	Dir string
+
+	// Args provides the module arguments.
+	Args []string
+
+	// Env provides the module environment.
+	Env []string
+
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Run executes the module and returns the module exit code.
+func Run(ctx context.Context, module []byte, config Config) (int, error) {
+	r := wazero.NewRuntimeWithConfig(ctx,
+		wazero.NewRuntimeConfig().
+			WithCloseOnContextDone(true),
+	)
+	defer r.Close(ctx)
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		return 0, err
+	}
+
+	mc := wazero.NewModuleConfig().
+		WithArgs(append([]string{"module"}, config.Args...)...).
+		WithStdout(config.Stdout).
+		WithStderr(config.Stderr).
+		WithStdin(&nopReader{}).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader)
+	if config.Dir != "" {
+		mc = mc.WithFSConfig(
+			wazero.NewFSConfig().WithDirMount(config.Dir, "/"),
+		)
+	}
+	for _, env := range config.Env {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) == 2 {
+			mc = mc.WithEnv(parts[0], parts[1])
+		}
+	}
+
+	_, err := r.InstantiateWithConfig(ctx, module, mc)
+	if exiterr, ok := err.(*sys.ExitError); ok {
+		return int(exiterr.ExitCode()), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// Load returns the module from the local path or, if the path
+// does not exist, pulls the module from the OCI registry.
+func Load(ctx context.Context, ref, cache string) ([]byte, error) {
+	if _, err := os.Stat(ref); err == nil {
+		return ioutil.ReadFile(ref)
+	}
+	return Pull(ctx, ref, cache)
+}
+
+type nopReader struct{}
+
+func (*nopReader) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
@@ -0,0 +1,34 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !solaris
+
+package engine
+
+import (
+	"context"
+	"errors"
+)
+
+// errZoneNotSupported is returned when the zone is configured
+// on a platform other than illumos.
+var errZoneNotSupported = errors.New("zones are only supported on illumos")
+
+// helper function returns an error, since zones are only
+// supported on illumos.
+func createZone(ctx context.Context, spec *Spec) error {
+	return errZoneNotSupported
+}
+
+// helper function returns an error, since zones are only
+// supported on illumos.
+func destroyZone(spec *Spec) error {
+	return errZoneNotSupported
+}
+
+// helper function returns an error, since zones are only
+// supported on illumos.
+func zoneCommand(spec *Spec, dir string, env []string, command string, args []string) (string, []string, error) {
+	return "", nil, errZoneNotSupported
+}
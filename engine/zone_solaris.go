@@ -0,0 +1,107 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build solaris
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+)
+
+// helper function creates the zone. The zone is configured from
+// the template zone with the pipeline root mounted read-write,
+// cloned from the template zone, and then booted.
+func createZone(ctx context.Context, spec *Spec) error {
+	zone := spec.Zone
+	config := strings.Join([]string{
+		"create -t " + zone.Template,
+		"set zonepath=" + zone.Path,
+		"set autoboot=false",
+		"add fs",
+		"set dir=" + spec.Root,
+		"set special=" + spec.Root,
+		"set type=lofs",
+		"end",
+		"commit",
+	}, "; ")
+	if err := runZone(ctx, "zonecfg", "-z", zone.Name, config); err != nil {
+		return err
+	}
+	if err := runZone(ctx, "zoneadm", "-z", zone.Name, "clone", zone.Template); err != nil {
+		destroyZone(spec)
+		return err
+	}
+	if err := runZone(ctx, "zoneadm", "-z", zone.Name, "boot"); err != nil {
+		destroyZone(spec)
+		return err
+	}
+	return nil
+}
+
+// helper function halts and uninstalls the zone, and then
+// deletes the zone configuration. Removal continues if a step
+// fails, so that a partially created zone is removed.
+func destroyZone(spec *Spec) error {
+	ctx := context.Background()
+	name := spec.Zone.Name
+	runZone(ctx, "zoneadm", "-z", name, "halt")
+	runZone(ctx, "zoneadm", "-z", name, "uninstall", "-F")
+	return runZone(ctx, "zonecfg", "-z", name, "delete", "-F")
+}
+
+// helper function returns the command and arguments used to
+// execute the command in the zone. The zlogin command joins
+// the arguments into a single shell command, and does not pass
+// the environment, so the environment is written to a file in
+// the pipeline root that the shell sources and removes before
+// executing the command.
+func zoneCommand(spec *Spec, dir string, env []string, command string, args []string) (string, []string, error) {
+	file, err := ioutil.TempFile(spec.Root, ".env-")
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+	for _, kv := range env {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fmt.Fprintf(file, "export %s=%s\n", parts[0], shellQuote(parts[1]))
+	}
+
+	if dir == "" {
+		dir = "/"
+	}
+	quoted := []string{shellQuote(command)}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	script := fmt.Sprintf(". %s && rm -f %s && cd %s && exec %s",
+		shellQuote(file.Name()),
+		shellQuote(file.Name()),
+		shellQuote(dir),
+		strings.Join(quoted, " "),
+	)
+	return "/usr/sbin/zlogin", []string{spec.Zone.Name, script}, nil
+}
+
+// helper function returns the string quoted for the shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// helper function runs the command and returns an error that
+// includes the command output if the command fails.
+func runZone(ctx context.Context, name string, args ...string) error {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %s: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
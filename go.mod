@@ -1,26 +1,34 @@
 module github.com/drone-runners/drone-runner-exec
 
-go 1.17
+go 1.18
 
 require (
+	github.com/bmatcuk/doublestar v1.1.1
 	github.com/buildkite/yaml v2.1.0+incompatible
 	github.com/dchest/uniuri v0.0.0-20160212164326-8902c56451e9
+	github.com/docker/go-units v0.4.0
 	github.com/drone/drone-go v1.0.5-0.20190504210458-4d6116b897ba
 	github.com/drone/envsubst v1.0.2
 	github.com/drone/runner-go v1.3.1
 	github.com/drone/signal v1.0.0
 	github.com/golang/mock v1.3.1
-	github.com/google/go-cmp v0.3.0
+	github.com/google/go-cmp v0.5.9
 	github.com/gosimple/slug v1.5.0
 	github.com/hashicorp/go-multierror v1.0.0
 	github.com/joho/godotenv v1.3.0
 	github.com/kardianos/service v1.0.0
 	github.com/kelseyhightower/envconfig v1.3.0
+	github.com/klauspost/compress v1.16.7
 	github.com/mattn/go-isatty v0.0.8
 	github.com/natessilva/dag v0.0.0-20180124060714-7194b8dcc5c4
 	github.com/orandin/lumberjackrus v1.0.1
 	github.com/sirupsen/logrus v1.8.1
+	github.com/tetratelabs/wazero v1.0.3
+	golang.org/x/crypto v0.0.0-20190621222207-cc06ce4a13d4
 	golang.org/x/sync v0.0.0-20190423024810-112230192c58
+	golang.org/x/sys v0.7.0
+	golang.org/x/time v0.3.0
+	google.golang.org/grpc v1.56.3
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 )
 
@@ -30,14 +38,13 @@ require (
 	github.com/BurntSushi/toml v1.1.0 // indirect
 	github.com/alecthomas/template v0.0.0-20160405071501-a0175ee3bccc // indirect
 	github.com/alecthomas/units v0.0.0-20151022065526-2efee857e7cf // indirect
-	github.com/bmatcuk/doublestar v1.1.1 // indirect
 	github.com/coreos/go-semver v0.3.0 // indirect
-	github.com/docker/go-units v0.4.0 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/hashicorp/errwrap v1.0.0 // indirect
 	github.com/rainycape/unidecode v0.0.0-20150907023854-cb7f23ec59be // indirect
-	golang.org/x/crypto v0.0.0-20190621222207-cc06ce4a13d4 // indirect
-	golang.org/x/net v0.0.0-20190404232315-eb5bcb51f2a3 // indirect
-	golang.org/x/sys v0.0.0-20220520151302-bc2c85ada10a // indirect
-	golang.org/x/text v0.3.0 // indirect
+	golang.org/x/net v0.9.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
 )
@@ -0,0 +1,198 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package affinity partitions the cpus of the host into
+// disjoint cpu sets, which are assigned to concurrently running
+// stages, so that the steps of a stage are pinned to the same
+// cpus, and optionally the same numa node.
+package affinity
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNotSupported is returned when cpu affinity is not
+// supported by the host operating system.
+var ErrNotSupported = errors.New("cpu affinity is not supported on this platform")
+
+// Parse parses a cpu list in the linux cpulist format, for
+// example 0-3,8,10-11.
+func Parse(s string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(strings.TrimSpace(s), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last := part, part
+		if i := strings.Index(part, "-"); i != -1 {
+			first, last = part[:i], part[i+1:]
+		}
+		a, err := strconv.Atoi(first)
+		if err != nil || a < 0 {
+			return nil, fmt.Errorf("invalid cpu list %q", s)
+		}
+		b, err := strconv.Atoi(last)
+		if err != nil || b < a {
+			return nil, fmt.Errorf("invalid cpu list %q", s)
+		}
+		for cpu := a; cpu <= b; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	if len(cpus) == 0 {
+		return nil, fmt.Errorf("invalid cpu list %q", s)
+	}
+	return unique(cpus), nil
+}
+
+// Format returns the cpus in the linux cpulist format.
+func Format(cpus []int) string {
+	var parts []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// Partition partitions the cpus into n disjoint cpu sets. If
+// numa nodes are provided, each cpu set is contained within a
+// single node, and the sets are distributed across the nodes
+// in proportion to the number of cpus of each node.
+func Partition(cpus []int, nodes [][]int, n int) ([][]int, error) {
+	if n < 1 {
+		return nil, errors.New("invalid number of cpu sets")
+	}
+	groups := [][]int{cpus}
+	if len(nodes) != 0 {
+		groups = nil
+		for _, node := range nodes {
+			if group := intersect(node, cpus); len(group) != 0 {
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	// each cpu set is assigned to the group with the most cpus
+	// per assigned set.
+	shares := make([]int, len(groups))
+	for i := 0; i < n; i++ {
+		next := -1
+		for j, group := range groups {
+			if shares[j] >= len(group) {
+				continue
+			}
+			if next == -1 || len(group)*(shares[next]+1) > len(groups[next])*(shares[j]+1) {
+				next = j
+			}
+		}
+		if next == -1 {
+			return nil, fmt.Errorf("cannot partition %d cpus into %d cpu sets", len(cpus), n)
+		}
+		shares[next]++
+	}
+
+	var sets [][]int
+	for j, group := range groups {
+		sets = append(sets, split(group, shares[j])...)
+	}
+	return sets, nil
+}
+
+// Pool assigns the cpu sets to running stages. A cpu set
+// remains assigned until released, ensuring concurrent stages
+// are never pinned to the same cpus.
+type Pool struct {
+	sync.Mutex
+
+	sets [][]int
+	used []bool
+}
+
+// NewPool returns a new pool of cpu sets.
+func NewPool(sets [][]int) *Pool {
+	return &Pool{
+		sets: sets,
+		used: make([]bool, len(sets)),
+	}
+}
+
+// Acquire assigns a free cpu set. It returns false if all cpu
+// sets are assigned.
+func (p *Pool) Acquire() ([]int, bool) {
+	p.Lock()
+	defer p.Unlock()
+	for i, used := range p.used {
+		if !used {
+			p.used[i] = true
+			return p.sets[i], true
+		}
+	}
+	return nil, false
+}
+
+// Release releases the cpu set so it can be re-assigned.
+func (p *Pool) Release(cpus []int) {
+	p.Lock()
+	defer p.Unlock()
+	for i, set := range p.sets {
+		if len(set) != 0 && len(cpus) != 0 && set[0] == cpus[0] {
+			p.used[i] = false
+			return
+		}
+	}
+}
+
+// helper function splits the cpus into n contiguous sets of
+// nearly equal size.
+func split(cpus []int, n int) [][]int {
+	var sets [][]int
+	for i := 0; i < n; i++ {
+		first := i * len(cpus) / n
+		last := (i + 1) * len(cpus) / n
+		sets = append(sets, cpus[first:last])
+	}
+	return sets
+}
+
+// helper function returns the cpus of a that are also in b.
+func intersect(a, b []int) []int {
+	in := map[int]bool{}
+	for _, cpu := range b {
+		in[cpu] = true
+	}
+	var out []int
+	for _, cpu := range a {
+		if in[cpu] {
+			out = append(out, cpu)
+		}
+	}
+	return out
+}
+
+// helper function returns the sorted, unique cpus.
+func unique(cpus []int) []int {
+	sort.Ints(cpus)
+	out := cpus[:0]
+	for i, cpu := range cpus {
+		if i == 0 || cpu != cpus[i-1] {
+			out = append(out, cpu)
+		}
+	}
+	return out
+}
@@ -0,0 +1,48 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package affinity
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+)
+
+// sysfs is the root of the linux sysfs filesystem.
+var sysfs = "/sys"
+
+// Online returns the online cpus of the host.
+func Online() ([]int, error) {
+	data, err := ioutil.ReadFile(filepath.Join(sysfs, "devices/system/cpu/online"))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(string(data))
+}
+
+// Nodes returns the cpus of each numa node of the host. Nodes
+// without cpus are ignored.
+func Nodes() ([][]int, error) {
+	paths, err := filepath.Glob(filepath.Join(sysfs, "devices/system/node/node*/cpulist"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var nodes [][]int
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		cpus, err := Parse(string(data))
+		if err != nil {
+			continue
+		}
+		nodes = append(nodes, cpus)
+	}
+	return nodes, nil
+}
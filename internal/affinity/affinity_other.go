@@ -0,0 +1,19 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux
+
+package affinity
+
+// Online returns the online cpus of the host. Cpu affinity is
+// only supported on linux.
+func Online() ([]int, error) {
+	return nil, ErrNotSupported
+}
+
+// Nodes returns the cpus of each numa node of the host. Cpu
+// affinity is only supported on linux.
+func Nodes() ([][]int, error) {
+	return nil, ErrNotSupported
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package affinity
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	got, err := Parse("0-3,8, 10-11\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{0, 1, 2, 3, 8, 10, 11}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected cpus")
+		t.Log(diff)
+	}
+	if got, want := Format(got), "0-3,8,10-11"; got != want {
+		t.Errorf("Want cpu list %s, got %s", want, got)
+	}
+
+	for _, s := range []string{"", "a", "3-1", "-1"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Want error parsing cpu list %q", s)
+		}
+	}
+}
+
+func TestPartition(t *testing.T) {
+	cpus, _ := Parse("0-7")
+	got, err := Partition(cpus, nil, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]int{{0, 1}, {2, 3, 4}, {5, 6, 7}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected cpu sets")
+		t.Log(diff)
+	}
+
+	if _, err := Partition(cpus, nil, 9); err == nil {
+		t.Errorf("Want error when cpus fewer than cpu sets")
+	}
+}
+
+func TestPartition_NUMA(t *testing.T) {
+	cpus, _ := Parse("0-11")
+	nodes := [][]int{{0, 1, 2, 3, 4, 5, 6, 7}, {8, 9, 10, 11}}
+	got, err := Partition(cpus, nodes, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]int{{0, 1, 2, 3}, {4, 5, 6, 7}, {8, 9, 10, 11}}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected cpu sets")
+		t.Log(diff)
+	}
+}
+
+func TestPool(t *testing.T) {
+	pool := NewPool([][]int{{0, 1}, {2, 3}})
+	a, ok := pool.Acquire()
+	if !ok {
+		t.Fatalf("Want cpu set acquired")
+	}
+	b, ok := pool.Acquire()
+	if !ok {
+		t.Fatalf("Want cpu set acquired")
+	}
+	if cmp.Equal(a, b) {
+		t.Errorf("Want disjoint cpu sets")
+	}
+	if _, ok := pool.Acquire(); ok {
+		t.Errorf("Want pool exhausted")
+	}
+	pool.Release(a)
+	if got, ok := pool.Acquire(); !ok || !cmp.Equal(got, a) {
+		t.Errorf("Want released cpu set re-acquired")
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package annotation emits pipeline events as Grafana
+// annotations.
+package annotation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/logger"
+	"github.com/drone/runner-go/pipeline"
+)
+
+// Config configures the annotations endpoint.
+type Config struct {
+	// Endpoint is the base address of the Grafana server.
+	Endpoint string
+
+	// Token is the Grafana service account token.
+	Token string
+
+	// Dashboard is the optional dashboard uid. If empty the
+	// annotations are created as organization annotations.
+	Dashboard string
+
+	// Tags are added to every annotation.
+	Tags []string
+
+	// Events optionally limits annotations to the listed
+	// build events.
+	Events []string
+}
+
+// Reporter is a pipeline.Reporter that creates an annotation
+// when a stage starts, and completes the annotation region
+// when the stage finishes.
+type Reporter struct {
+	base   pipeline.Reporter
+	config Config
+	client *http.Client
+
+	mu    sync.Mutex
+	items map[int64]int64
+}
+
+// New returns a new Reporter that wraps the base reporter.
+func New(base pipeline.Reporter, config Config) *Reporter {
+	return &Reporter{
+		base:   base,
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		items:  map[int64]int64{},
+	}
+}
+
+// ReportStage reports the stage status, and completes the
+// annotation when the stage is finished.
+func (r *Reporter) ReportStage(ctx context.Context, state *pipeline.State) error {
+	err := r.base.ReportStage(ctx, state)
+	state.Lock()
+	stage, text, tags := *state.Stage, describe(state), r.tags(state)
+	match := r.match(state.Build)
+	state.Unlock()
+
+	if !match || isRunning(stage.Status) {
+		return err
+	}
+
+	r.mu.Lock()
+	id, ok := r.items[stage.ID]
+	delete(r.items, stage.ID)
+	r.mu.Unlock()
+
+	req := &annotation{
+		Time:    stage.Started * 1000,
+		TimeEnd: stage.Stopped * 1000,
+		Tags:    tags,
+		Text:    text,
+	}
+	if ok {
+		r.patch(ctx, id, req)
+	} else {
+		r.post(ctx, req)
+	}
+	return err
+}
+
+// ReportStep reports the named step status, and creates the
+// annotation when the first step of the stage starts.
+func (r *Reporter) ReportStep(ctx context.Context, state *pipeline.State, name string) error {
+	err := r.base.ReportStep(ctx, state, name)
+	state.Lock()
+	stage, text, tags := *state.Stage, describe(state), r.tags(state)
+	match := r.match(state.Build)
+	state.Unlock()
+
+	if !match || stage.Status != drone.StatusRunning {
+		return err
+	}
+
+	r.mu.Lock()
+	_, ok := r.items[stage.ID]
+	if !ok {
+		// reserve the stage to prevent concurrent steps from
+		// creating duplicate annotations.
+		r.items[stage.ID] = 0
+	}
+	r.mu.Unlock()
+	if ok {
+		return err
+	}
+
+	id := r.post(ctx, &annotation{
+		Time: stage.Started * 1000,
+		Tags: tags,
+		Text: text,
+	})
+
+	r.mu.Lock()
+	if _, ok := r.items[stage.ID]; ok {
+		r.items[stage.ID] = id
+	}
+	r.mu.Unlock()
+	return err
+}
+
+// helper function returns true if annotations are enabled
+// for the build event.
+func (r *Reporter) match(build *drone.Build) bool {
+	if len(r.config.Events) == 0 {
+		return true
+	}
+	for _, event := range r.config.Events {
+		if event == build.Event {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns the annotation tags.
+func (r *Reporter) tags(state *pipeline.State) []string {
+	tags := append([]string{}, r.config.Tags...)
+	tags = append(tags,
+		"drone",
+		state.Repo.Slug,
+		state.Build.Event,
+		state.Stage.Status,
+	)
+	if state.Build.Deploy != "" {
+		tags = append(tags, state.Build.Deploy)
+	}
+	return tags
+}
+
+// helper function creates the annotation and returns the
+// annotation id, or zero if the request fails.
+func (r *Reporter) post(ctx context.Context, in *annotation) int64 {
+	in.Dashboard = r.config.Dashboard
+	out := new(annotationResponse)
+	endpoint := strings.TrimSuffix(r.config.Endpoint, "/") + "/api/annotations"
+	if err := r.do(ctx, "POST", endpoint, in, out); err != nil {
+		logger.FromContext(ctx).
+			WithError(err).
+			Warnln("cannot create annotation")
+		return 0
+	}
+	return out.ID
+}
+
+// helper function updates the annotation.
+func (r *Reporter) patch(ctx context.Context, id int64, in *annotation) {
+	if id == 0 {
+		r.post(ctx, in)
+		return
+	}
+	endpoint := fmt.Sprintf("%s/api/annotations/%d", strings.TrimSuffix(r.config.Endpoint, "/"), id)
+	if err := r.do(ctx, "PATCH", endpoint, in, nil); err != nil {
+		logger.FromContext(ctx).
+			WithError(err).
+			Warnln("cannot update annotation")
+	}
+}
+
+func (r *Reporter) do(ctx context.Context, method, endpoint string, in, out interface{}) error {
+	buf := new(bytes.Buffer)
+	json.NewEncoder(buf).Encode(in)
+	req, err := http.NewRequest(method, endpoint, buf)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if r.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.config.Token)
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		return fmt.Errorf("annotation request failed with status %d", res.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// helper function returns the annotation text.
+func describe(state *pipeline.State) string {
+	return fmt.Sprintf("%s #%d %s %s",
+		state.Repo.Slug,
+		state.Build.Number,
+		state.Stage.Name,
+		state.Stage.Status,
+	)
+}
+
+// helper function returns true if the status is pending
+// or running.
+func isRunning(status string) bool {
+	return status == drone.StatusPending || status == drone.StatusRunning
+}
+
+type annotation struct {
+	Dashboard string   `json:"dashboardUID,omitempty"`
+	Time      int64    `json:"time,omitempty"`
+	TimeEnd   int64    `json:"timeEnd,omitempty"`
+	Tags      []string `json:"tags"`
+	Text      string   `json:"text"`
+}
+
+type annotationResponse struct {
+	ID int64 `json:"id"`
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package annotation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+)
+
+var nocontext = context.Background()
+
+func TestReporter(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	var payloads []*annotation
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got, want := r.Header.Get("Authorization"), "Bearer secret"; got != want {
+			t.Errorf("Want authorization header %q, got %q", want, got)
+		}
+		in := new(annotation)
+		json.NewDecoder(r.Body).Decode(in)
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		payloads = append(payloads, in)
+		mu.Unlock()
+		w.Write([]byte(`{"id":42}`))
+	}))
+	defer ts.Close()
+
+	state := testState()
+	reporter := New(&nopReporter{}, Config{
+		Endpoint: ts.URL,
+		Token:    "secret",
+		Tags:     []string{"production"},
+	})
+
+	state.Stage.Status = drone.StatusRunning
+	reporter.ReportStep(nocontext, state, "build")
+	reporter.ReportStep(nocontext, state, "test")
+
+	state.Stage.Status = drone.StatusPassing
+	state.Stage.Stopped = 1257894060
+	reporter.ReportStage(nocontext, state)
+
+	want := []string{
+		"POST /api/annotations",
+		"PATCH /api/annotations/42",
+	}
+	if len(requests) != len(want) {
+		t.Errorf("Want requests %v, got %v", want, requests)
+		return
+	}
+	for i := range want {
+		if requests[i] != want[i] {
+			t.Errorf("Want request %q, got %q", want[i], requests[i])
+		}
+	}
+	if got, want := payloads[0].Time, int64(1257894000000); got != want {
+		t.Errorf("Want annotation time %d, got %d", want, got)
+	}
+	if got, want := payloads[1].TimeEnd, int64(1257894060000); got != want {
+		t.Errorf("Want annotation end time %d, got %d", want, got)
+	}
+	if got, want := payloads[1].Text, "octocat/hello-world #1 default success"; got != want {
+		t.Errorf("Want annotation text %q, got %q", want, got)
+	}
+	if got, want := payloads[1].Tags[0], "production"; got != want {
+		t.Errorf("Want configured tag %q, got %q", want, got)
+	}
+}
+
+func TestReporter_Events(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expect no annotation for unmatched event")
+	}))
+	defer ts.Close()
+
+	state := testState()
+	state.Stage.Status = drone.StatusPassing
+	reporter := New(&nopReporter{}, Config{
+		Endpoint: ts.URL,
+		Events:   []string{drone.EventPromote},
+	})
+	reporter.ReportStage(nocontext, state)
+}
+
+func testState() *pipeline.State {
+	return &pipeline.State{
+		Repo:  &drone.Repo{Slug: "octocat/hello-world"},
+		Build: &drone.Build{Number: 1, Event: drone.EventPush},
+		Stage: &drone.Stage{
+			ID:      1,
+			Name:    "default",
+			Status:  drone.StatusPending,
+			Started: 1257894000,
+		},
+	}
+}
+
+type nopReporter struct{}
+
+func (*nopReporter) ReportStage(context.Context, *pipeline.State) error        { return nil }
+func (*nopReporter) ReportStep(context.Context, *pipeline.State, string) error { return nil }
@@ -0,0 +1,129 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package archive persists completed stage summaries, so that
+// the build history survives a runner restart.
+package archive
+
+import (
+	"context"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/logger"
+	"github.com/drone/runner-go/pipeline"
+)
+
+// Stage is a summary of a completed stage.
+type Stage struct {
+	ID       int64   `json:"id"`
+	Repo     string  `json:"repo"`
+	Build    int64   `json:"build"`
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Event    string  `json:"event"`
+	Ref      string  `json:"ref"`
+	Started  int64   `json:"started"`
+	Finished int64   `json:"finished"`
+	Duration int64   `json:"duration"`
+	Steps    []*Step `json:"steps"`
+}
+
+// Step is a summary of a completed step.
+type Step struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	ExitCode int    `json:"exit_code"`
+	Duration int64  `json:"duration"`
+}
+
+// Filter filters the stage history.
+type Filter struct {
+	// Query matches the repository, stage name or ref.
+	Query string
+
+	// Status matches the stage status.
+	Status string
+
+	Limit  int
+	Offset int
+}
+
+// Store stores the stage history.
+type Store interface {
+	// Save saves the stage summary, replacing any previous
+	// summary of the stage.
+	Save(stage *Stage) error
+
+	// List returns the stage summaries matching the filter,
+	// most recent first.
+	List(filter Filter) ([]*Stage, error)
+}
+
+// New returns a new stage summary for the pipeline state.
+// The pipeline state must be locked.
+func New(state *pipeline.State) *Stage {
+	out := &Stage{
+		ID:       state.Stage.ID,
+		Repo:     state.Repo.Slug,
+		Build:    state.Build.Number,
+		Name:     state.Stage.Name,
+		Status:   state.Stage.Status,
+		Event:    state.Build.Event,
+		Ref:      state.Build.Ref,
+		Started:  state.Stage.Started,
+		Finished: state.Stage.Stopped,
+		Duration: duration(state.Stage.Started, state.Stage.Stopped),
+	}
+	for _, step := range state.Stage.Steps {
+		out.Steps = append(out.Steps, &Step{
+			Name:     step.Name,
+			Status:   step.Status,
+			ExitCode: step.ExitCode,
+			Duration: duration(step.Started, step.Stopped),
+		})
+	}
+	return out
+}
+
+var _ pipeline.Reporter = (*Reporter)(nil)
+
+// Reporter is a pipeline.Reporter that saves the summary of
+// each completed stage.
+type Reporter struct {
+	pipeline.Reporter
+	store Store
+}
+
+// NewReporter returns a new Reporter that wraps the base
+// reporter.
+func NewReporter(base pipeline.Reporter, store Store) *Reporter {
+	return &Reporter{Reporter: base, store: store}
+}
+
+// ReportStage reports the stage status, and saves the stage
+// summary when the stage is completed.
+func (r *Reporter) ReportStage(ctx context.Context, state *pipeline.State) error {
+	err := r.Reporter.ReportStage(ctx, state)
+	state.Lock()
+	stage := New(state)
+	state.Unlock()
+	switch stage.Status {
+	case drone.StatusPending, drone.StatusRunning:
+	default:
+		if err := r.store.Save(stage); err != nil {
+			logger.FromContext(ctx).
+				WithError(err).
+				Warnln("cannot save the stage history")
+		}
+	}
+	return err
+}
+
+// helper function returns the duration in seconds.
+func duration(started, stopped int64) int64 {
+	if started == 0 || stopped < started {
+		return 0
+	}
+	return stopped - started
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package archive
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSQLite(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+	store, err := SQLite(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stages, err := store.List(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stages) != 0 {
+		t.Errorf("Want empty history, got %d stages", len(stages))
+	}
+
+	first := &Stage{
+		ID:       1,
+		Repo:     "octocat/hello-world",
+		Build:    1,
+		Name:     "default",
+		Status:   drone.StatusPassing,
+		Ref:      "refs/heads/master",
+		Finished: 100,
+		Steps:    []*Step{{Name: "test", Status: drone.StatusPassing}},
+	}
+	second := &Stage{
+		ID:       2,
+		Repo:     "octocat/it's-a-trap",
+		Build:    7,
+		Name:     "default",
+		Status:   drone.StatusFailing,
+		Finished: 200,
+		Steps:    []*Step{{Name: "test", Status: drone.StatusFailing, ExitCode: 1}},
+	}
+	for _, stage := range []*Stage{first, second, first} {
+		if err := store.Save(stage); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		filter Filter
+		want   []*Stage
+	}{
+		{Filter{}, []*Stage{second, first}},
+		{Filter{Query: "trap"}, []*Stage{second}},
+		{Filter{Query: "it's"}, []*Stage{second}},
+		{Filter{Query: "%"}, []*Stage{}},
+		{Filter{Status: drone.StatusPassing}, []*Stage{first}},
+		{Filter{Limit: 1, Offset: 1}, []*Stage{first}},
+	}
+	for _, test := range tests {
+		got, err := store.List(test.filter)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf("Unexpected history for filter %+v", test.filter)
+			t.Log(diff)
+		}
+	}
+}
+
+func TestSQLite_NotInstalled(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := SQLite(filepath.Join(t.TempDir(), "history.db")); err != ErrNoSQLite {
+		t.Errorf("Want error %s, got %v", ErrNoSQLite, err)
+	}
+}
+
+func TestReporter(t *testing.T) {
+	store := &memory{}
+	reporter := NewReporter(pipeline.NopReporter(), store)
+	state := &pipeline.State{
+		Build: &drone.Build{Number: 1, Event: "push"},
+		Repo:  &drone.Repo{Slug: "octocat/hello-world"},
+		Stage: &drone.Stage{
+			ID:      1,
+			Name:    "default",
+			Status:  drone.StatusRunning,
+			Started: 10,
+			Steps: []*drone.Step{
+				{Name: "test", Status: drone.StatusRunning, Started: 10},
+			},
+		},
+	}
+	reporter.ReportStage(context.Background(), state)
+	if len(store.stages) != 0 {
+		t.Errorf("Want running stage not saved")
+	}
+
+	state.Stage.Status = drone.StatusPassing
+	state.Stage.Stopped = 25
+	state.Stage.Steps[0].Status = drone.StatusPassing
+	state.Stage.Steps[0].Stopped = 20
+	reporter.ReportStage(context.Background(), state)
+	if len(store.stages) != 1 {
+		t.Fatalf("Want completed stage saved")
+	}
+	got := store.stages[0]
+	if got.Duration != 15 || got.Steps[0].Duration != 10 {
+		t.Errorf("Want stage and step durations, got %d and %d", got.Duration, got.Steps[0].Duration)
+	}
+}
+
+type memory struct {
+	stages []*Stage
+}
+
+func (m *memory) Save(stage *Stage) error {
+	m.stages = append(m.stages, stage)
+	return nil
+}
+
+func (m *memory) List(Filter) ([]*Stage, error) {
+	return m.stages, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS stages (
+ id       INTEGER PRIMARY KEY
+,repo     TEXT
+,build    INTEGER
+,name     TEXT
+,status   TEXT
+,event    TEXT
+,ref      TEXT
+,started  INTEGER
+,finished INTEGER
+,duration INTEGER
+,steps    TEXT
+);
+CREATE INDEX IF NOT EXISTS ix_stages_finished ON stages (finished);
+`
+
+// ErrNoSQLite is returned when the sqlite3 command line tool
+// is not installed.
+var ErrNoSQLite = errors.New("sqlite3 command line tool is not installed")
+
+// SQLite returns a Store that persists the stage history to
+// the sqlite database at path, using the sqlite3 command line
+// tool, version 3.33 or later for json output. The tool must
+// be installed on the host, and is executed for each query.
+// The database is created if it does not exist.
+func SQLite(path string) (Store, error) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		return nil, ErrNoSQLite
+	}
+	s := &sqlite{path: path}
+	if _, err := s.exec(schema); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type sqlite struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (s *sqlite) Save(stage *Stage) error {
+	steps, err := json.Marshal(stage.Steps)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(fmt.Sprintf(
+		"INSERT OR REPLACE INTO stages VALUES (%d, %s, %d, %s, %s, %s, %s, %d, %d, %d, %s);",
+		stage.ID,
+		quote(stage.Repo),
+		stage.Build,
+		quote(stage.Name),
+		quote(stage.Status),
+		quote(stage.Event),
+		quote(stage.Ref),
+		stage.Started,
+		stage.Finished,
+		stage.Duration,
+		quote(string(steps)),
+	))
+	return err
+}
+
+func (s *sqlite) List(filter Filter) ([]*Stage, error) {
+	var where []string
+	if filter.Query != "" {
+		like := quote("%" + escapeLike(filter.Query) + "%")
+		where = append(where, fmt.Sprintf(
+			`(repo LIKE %[1]s ESCAPE '\' OR name LIKE %[1]s ESCAPE '\' OR ref LIKE %[1]s ESCAPE '\')`, like))
+	}
+	if filter.Status != "" {
+		where = append(where, "status = "+quote(filter.Status))
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 25
+	}
+
+	query := "SELECT * FROM stages"
+	if len(where) != 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY finished DESC, id DESC LIMIT %d OFFSET %d;", limit, filter.Offset)
+
+	out, err := s.exec(query)
+	if err != nil {
+		return nil, err
+	}
+	// the sqlite3 command line tool writes no output, rather
+	// than an empty json array, when there are no rows.
+	if len(bytes.TrimSpace(out)) == 0 {
+		return []*Stage{}, nil
+	}
+	var rows []*row
+	if err := json.Unmarshal(out, &rows); err != nil {
+		return nil, err
+	}
+	stages := make([]*Stage, 0, len(rows))
+	for _, row := range rows {
+		stage := &row.Stage
+		json.Unmarshal([]byte(row.Steps), &stage.Steps)
+		stages = append(stages, stage)
+	}
+	return stages, nil
+}
+
+// row is a database row. The steps are stored as a json
+// encoded string.
+type row struct {
+	Stage
+	Steps string `json:"steps"`
+}
+
+// helper function executes the sql statements and returns the
+// json encoded output. The statements are written to stdin,
+// which avoids command line length limits.
+func (s *sqlite) exec(sql string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sqlite3", "-bail", "-json", "-cmd", ".timeout 5000", s.path)
+	cmd.Stdin = strings.NewReader(sql)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("sqlite3: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// helper function returns the string as a quoted sql literal.
+func quote(s string) string {
+	s = strings.ReplaceAll(s, "\x00", "")
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// helper function escapes the wildcards in a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
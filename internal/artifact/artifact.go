@@ -0,0 +1,165 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package artifact transfers the artifacts produced by a
+// pipeline stage to dependent stages, which may run on other
+// hosts.
+package artifact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Key identifies the artifacts produced by a stage.
+type Key struct {
+	Repo  string // repository slug
+	Build int64  // build number
+	Stage string // stage name
+}
+
+// path returns the slash-separated relative path of the
+// artifacts in the backend.
+func (k Key) path() string {
+	return path.Join(k.Repo, fmt.Sprint(k.Build), url.PathEscape(k.Stage))
+}
+
+// Backend transfers stage artifacts.
+type Backend interface {
+	// Upload uploads the contents of the source directory.
+	Upload(ctx context.Context, src string, key Key) error
+
+	// Download downloads the stage artifacts to the destination
+	// directory. Download is a no-op if the stage did not upload
+	// any artifacts.
+	Download(ctx context.Context, key Key, dst string) error
+}
+
+// New returns the Backend for the url. The scheme selects the
+// backend: s3:// uses the aws command line tool, rsync:// and
+// ssh:// use rsync, and file:// or a plain path copies to a
+// directory, which can be shared by runners using a network
+// file system.
+func New(rawurl string) (Backend, error) {
+	if rawurl == "" {
+		return nil, errors.New("artifact: missing url")
+	}
+	if filepath.IsAbs(rawurl) {
+		return Dir(rawurl), nil
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		return Dir(filepath.FromSlash(u.Path)), nil
+	case "s3":
+		if u.Host == "" {
+			return nil, errors.New("artifact: missing s3 bucket")
+		}
+		return S3(u.Host, strings.Trim(u.Path, "/")), nil
+	case "rsync":
+		return Rsync(strings.TrimSuffix(rawurl, "/")), nil
+	case "ssh":
+		if u.Host == "" {
+			return nil, errors.New("artifact: missing ssh host")
+		}
+		// rsync expects remote shell targets in the
+		// [user@]host:path format.
+		target := u.Host + ":" + u.Path
+		if u.User != nil {
+			target = u.User.Username() + "@" + target
+		}
+		return Rsync(strings.TrimSuffix(target, "/")), nil
+	default:
+		return nil, fmt.Errorf("artifact: unsupported scheme %q", u.Scheme)
+	}
+}
+
+// Collect copies the workspace files matching the glob patterns
+// to the destination directory, preserving the paths relative
+// to the workspace. Directories are copied recursively.
+func Collect(src string, patterns []string, dst string) error {
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(src, filepath.FromSlash(pattern)))
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("artifact: no files match %s", pattern)
+		}
+		for _, match := range matches {
+			rel, err := filepath.Rel(src, match)
+			if err != nil {
+				return err
+			}
+			if err := copyTree(match, filepath.Join(dst, rel)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// helper function recursively copies the file or directory.
+// Symbolic links are copied as links.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, 0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(name)
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return err
+			}
+			return copyFile(name, target, info.Mode().Perm())
+		default:
+			// sockets, devices and named pipes are ignored.
+			return nil
+		}
+	})
+}
+
+// helper function copies the regular file.
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package artifact
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		url  string
+		want Backend
+		err  bool
+	}{
+		{url: "/mnt/artifacts", want: &dir{path: "/mnt/artifacts"}},
+		{url: "file:///mnt/artifacts", want: &dir{path: filepath.FromSlash("/mnt/artifacts")}},
+		{url: "s3://bucket/drone/", want: &s3{bucket: "bucket", prefix: "drone"}},
+		{url: "rsync://cache.company.com/artifacts/", want: &rsync{target: "rsync://cache.company.com/artifacts"}},
+		{url: "ssh://drone@cache.company.com/srv/artifacts", want: &rsync{target: "drone@cache.company.com:/srv/artifacts"}},
+		{url: "ftp://cache.company.com", err: true},
+		{url: "s3:///drone", err: true},
+		{url: "", err: true},
+	}
+	for _, test := range tests {
+		got, err := New(test.url)
+		if test.err != (err != nil) {
+			t.Errorf("Unexpected error %v parsing %q", err, test.url)
+			continue
+		}
+		if !test.err && !equal(got, test.want) {
+			t.Errorf("Want backend %#v parsing %q, got %#v", test.want, test.url, got)
+		}
+	}
+}
+
+func TestDir(t *testing.T) {
+	workspace := t.TempDir()
+	os.MkdirAll(filepath.Join(workspace, "dist", "bin"), 0700)
+	ioutil.WriteFile(filepath.Join(workspace, "dist", "bin", "app"), []byte("binary"), 0700)
+	ioutil.WriteFile(filepath.Join(workspace, "coverage.out"), []byte("coverage"), 0600)
+	ioutil.WriteFile(filepath.Join(workspace, "main.go"), []byte("package main"), 0600)
+
+	collected := t.TempDir()
+	if err := Collect(workspace, []string{"dist", "*.out"}, collected); err != nil {
+		t.Fatal(err)
+	}
+	if err := Collect(workspace, []string{"missing/*"}, t.TempDir()); err == nil {
+		t.Errorf("Expect error when pattern matches no files")
+	}
+
+	backend := Dir(t.TempDir())
+	key := Key{Repo: "octocat/hello-world", Build: 1, Stage: "build linux"}
+	if err := backend.Upload(context.Background(), collected, key); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := t.TempDir()
+	if err := backend.Download(context.Background(), key, dst); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dst, "dist", "bin", "app")); string(data) != "binary" {
+		t.Errorf("Expect directory artifacts downloaded")
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dst, "coverage.out")); string(data) != "coverage" {
+		t.Errorf("Expect file artifacts downloaded")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "main.go")); !os.IsNotExist(err) {
+		t.Errorf("Expect undeclared files not downloaded")
+	}
+
+	key.Stage = "test"
+	if err := backend.Download(context.Background(), key, t.TempDir()); err != nil {
+		t.Errorf("Expect no error when stage has no artifacts, got %s", err)
+	}
+}
+
+func equal(a, b Backend) bool {
+	switch a := a.(type) {
+	case *dir:
+		b, ok := b.(*dir)
+		return ok && *a == *b
+	case *s3:
+		b, ok := b.(*s3)
+		return ok && *a == *b
+	case *rsync:
+		b, ok := b.(*rsync)
+		return ok && *a == *b
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package artifact
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Rsync returns a Backend that transfers the artifacts with
+// rsync. The target is an rsync:// url or a remote shell target
+// in the [user@]host:path format.
+func Rsync(target string) Backend {
+	return &rsync{target: target}
+}
+
+type rsync struct {
+	target string
+}
+
+func (r *rsync) Upload(ctx context.Context, src string, key Key) error {
+	// older versions of rsync cannot create the missing parent
+	// directories on the remote host, so the key path is staged
+	// locally and the staging directory is transferred.
+	temp, err := ioutil.TempDir("", "drone-artifact")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(temp)
+	if err := copyTree(src, filepath.Join(temp, filepath.FromSlash(key.path()))); err != nil {
+		return err
+	}
+	_, err = run(ctx, "rsync", "-a", temp+"/", r.target+"/")
+	return err
+}
+
+func (r *rsync) Download(ctx context.Context, key Key, dst string) error {
+	if err := os.MkdirAll(dst, 0700); err != nil {
+		return err
+	}
+	out, err := run(ctx, "rsync", "-a", r.target+"/"+key.path()+"/", dst+"/")
+	if err != nil && strings.Contains(out, "No such file or directory") {
+		return nil
+	}
+	return err
+}
+
+// S3 returns a Backend that transfers the artifacts to the
+// bucket with the aws command line tool. Credentials are
+// sourced from the runner environment.
+func S3(bucket, prefix string) Backend {
+	return &s3{bucket: bucket, prefix: prefix}
+}
+
+type s3 struct {
+	bucket string
+	prefix string
+}
+
+func (s *s3) url(key Key) string {
+	if s.prefix == "" {
+		return "s3://" + s.bucket + "/" + key.path()
+	}
+	return "s3://" + s.bucket + "/" + s.prefix + "/" + key.path()
+}
+
+func (s *s3) Upload(ctx context.Context, src string, key Key) error {
+	_, err := run(ctx, "aws", "s3", "cp", "--recursive", "--only-show-errors", src, s.url(key))
+	return err
+}
+
+func (s *s3) Download(ctx context.Context, key Key, dst string) error {
+	_, err := run(ctx, "aws", "s3", "cp", "--recursive", "--only-show-errors", s.url(key), dst)
+	return err
+}
+
+// helper function runs the command and returns the combined
+// output. The output is included in the error message.
+func run(ctx context.Context, name string, args ...string) (string, error) {
+	var buf bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	if err := cmd.Run(); err != nil {
+		out := strings.TrimSpace(buf.String())
+		return out, fmt.Errorf("%s: %s: %s", name, err, out)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package artifact
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Dir returns a Backend that copies the artifacts to a
+// directory, which can be shared by runners using a network
+// file system.
+func Dir(path string) Backend {
+	return &dir{path: path}
+}
+
+type dir struct {
+	path string
+}
+
+func (d *dir) Upload(ctx context.Context, src string, key Key) error {
+	target := filepath.Join(d.path, filepath.FromSlash(key.path()))
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+	// the artifacts are copied to a temporary directory which
+	// is renamed once complete, so that dependent stages never
+	// observe a partial upload.
+	temp, err := ioutil.TempDir(filepath.Dir(target), ".upload")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(temp)
+	if err := copyTree(src, temp); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	return os.Rename(temp, target)
+}
+
+func (d *dir) Download(ctx context.Context, key Key, dst string) error {
+	source := filepath.Join(d.path, filepath.FromSlash(key.path()))
+	if _, err := os.Stat(source); os.IsNotExist(err) {
+		return nil
+	}
+	return copyTree(source, dst)
+}
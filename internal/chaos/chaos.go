@@ -0,0 +1,82 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package chaos injects simulated failures into the runner, so
+// that platform teams can verify the recovery behavior of the
+// runner and their pipelines. Chaos mode should only be enabled
+// on dedicated runners, selected using runner labels.
+package chaos
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// default maximum delay before a step is killed.
+const defaultDelay = 30 * time.Second
+
+// Config configures the simulated failures. Rates are the
+// probability, between 0 and 1, that a failure is injected.
+type Config struct {
+	// Network is the rate at which calls to the server fail
+	// with a network error.
+	Network float64
+
+	// Kill is the rate at which steps are killed at a random
+	// point during execution.
+	Kill float64
+
+	// Disk is the rate at which the pipeline environment
+	// cannot be created because the disk is full.
+	Disk float64
+
+	// Delay is the maximum delay before a step is killed.
+	Delay time.Duration
+
+	// Seed optionally seeds the random number generator, so
+	// that failures are reproducible.
+	Seed int64
+}
+
+// errors returned by simulated failures.
+var (
+	errNetwork = &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("chaos: simulated network error")}
+	errDisk    = errors.New("chaos: simulated disk full: no space left on device")
+)
+
+// dice returns true with the configured probability.
+type dice struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newDice(seed int64) *dice {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &dice{rand: rand.New(rand.NewSource(seed))}
+}
+
+// roll returns true with probability p.
+func (d *dice) roll(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rand.Float64() < p
+}
+
+// duration returns a random duration in the range [0, max).
+func (d *dice) duration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return time.Duration(d.rand.Int63n(int64(max)))
+}
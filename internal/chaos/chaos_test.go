@@ -0,0 +1,113 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/internal/lease"
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+func TestDice(t *testing.T) {
+	d := newDice(1)
+	if d.roll(0) {
+		t.Errorf("Expect zero rate never fails")
+	}
+	if !d.roll(1) {
+		t.Errorf("Expect rate of one always fails")
+	}
+	if got := d.duration(time.Second); got < 0 || got >= time.Second {
+		t.Errorf("Want duration in range, got %s", got)
+	}
+}
+
+func TestClient(t *testing.T) {
+	c := NewClient(new(fakeClient), Config{Network: 1})
+	err := c.Update(context.Background(), &drone.Stage{})
+	var nerr net.Error
+	if !errors.As(err, &nerr) {
+		t.Errorf("Want simulated network error, got %v", err)
+	}
+}
+
+func TestClient_Renew(t *testing.T) {
+	c := NewClient(new(fakeClient), Config{})
+	if err := lease.Renew(context.Background(), c, &drone.Stage{}); err != nil {
+		t.Errorf("Want lease renewed by the wrapped client, got %v", err)
+	}
+
+	c = NewClient(new(fakeClient), Config{Network: 1})
+	err := lease.Renew(context.Background(), c, &drone.Stage{})
+	var nerr net.Error
+	if !errors.As(err, &nerr) {
+		t.Errorf("Want simulated network error, got %v", err)
+	}
+}
+
+func TestEngine_Disk(t *testing.T) {
+	spec := &engine.Spec{
+		Steps: []*engine.Step{{Envs: map[string]string{}}},
+	}
+	e := NewEngine(new(fakeEngine), Config{Disk: 1})
+	if err := e.Setup(context.Background(), spec); err != nil {
+		t.Errorf("Expect no failure unless the pipeline opts in, got %s", err)
+	}
+	spec.Steps[0].Envs[Optin] = "true"
+	if err := e.Setup(context.Background(), spec); err != errDisk {
+		t.Errorf("Want simulated disk full, got %v", err)
+	}
+}
+
+func TestEngine_Kill(t *testing.T) {
+	step := &engine.Step{Envs: map[string]string{Optin: "true"}}
+	e := NewEngine(new(fakeEngine), Config{Kill: 1, Delay: time.Millisecond})
+	var buf bytes.Buffer
+	state, err := e.Run(context.Background(), &engine.Spec{}, step, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.ExitCode != 137 {
+		t.Errorf("Want killed exit code, got %d", state.ExitCode)
+	}
+	if buf.Len() == 0 {
+		t.Errorf("Expect killed step logged")
+	}
+}
+
+// fakeClient succeeds all calls.
+type fakeClient struct {
+	client.Client
+}
+
+func (*fakeClient) Update(context.Context, *drone.Stage) error {
+	return nil
+}
+
+func (*fakeClient) Renew(context.Context, *drone.Stage) error {
+	return nil
+}
+
+// fakeEngine runs steps until the context is cancelled.
+type fakeEngine struct {
+	engine.Engine
+}
+
+func (*fakeEngine) Setup(context.Context, *engine.Spec) error {
+	return nil
+}
+
+func (*fakeEngine) Run(ctx context.Context, _ *engine.Spec, _ *engine.Step, _ io.Writer) (*engine.State, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package chaos
+
+import (
+	"context"
+
+	"github.com/drone-runners/drone-runner-exec/internal/lease"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+// Client is a client.Client that fails calls to the server
+// with simulated network errors.
+type Client struct {
+	client.Client
+
+	rate float64
+	dice *dice
+}
+
+// NewClient returns a new chaos client that wraps the client.
+func NewClient(base client.Client, config Config) *Client {
+	return &Client{
+		Client: base,
+		rate:   config.Network,
+		dice:   newDice(config.Seed),
+	}
+}
+
+// Detail gets the build stage details for execution.
+func (c *Client) Detail(ctx context.Context, stage *drone.Stage) (*client.Context, error) {
+	if c.dice.roll(c.rate) {
+		return nil, errNetwork
+	}
+	return c.Client.Detail(ctx, stage)
+}
+
+// Update updates the build stage.
+func (c *Client) Update(ctx context.Context, stage *drone.Stage) error {
+	if c.dice.roll(c.rate) {
+		return errNetwork
+	}
+	return c.Client.Update(ctx, stage)
+}
+
+// UpdateStep updates the build step.
+func (c *Client) UpdateStep(ctx context.Context, step *drone.Step) error {
+	if c.dice.roll(c.rate) {
+		return errNetwork
+	}
+	return c.Client.UpdateStep(ctx, step)
+}
+
+// Watch watches for build cancellation requests.
+func (c *Client) Watch(ctx context.Context, stage int64) (bool, error) {
+	if c.dice.roll(c.rate) {
+		return false, errNetwork
+	}
+	return c.Client.Watch(ctx, stage)
+}
+
+// Batch batch writes logs to the build logs.
+func (c *Client) Batch(ctx context.Context, step int64, lines []*drone.Line) error {
+	if c.dice.roll(c.rate) {
+		return errNetwork
+	}
+	return c.Client.Batch(ctx, step, lines)
+}
+
+// Upload uploads the full logs to the server.
+func (c *Client) Upload(ctx context.Context, step int64, lines []*drone.Line) error {
+	if c.dice.roll(c.rate) {
+		return errNetwork
+	}
+	return c.Client.Upload(ctx, step, lines)
+}
+
+// Renew renews the stage lease, if supported by the client.
+func (c *Client) Renew(ctx context.Context, stage *drone.Stage) error {
+	if c.dice.roll(c.rate) {
+		return errNetwork
+	}
+	return lease.Renew(ctx, c.Client, stage)
+}
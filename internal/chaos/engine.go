@@ -0,0 +1,88 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone/runner-go/logger"
+)
+
+// Optin is the environment variable used by a pipeline to opt
+// in to simulated step failures.
+const Optin = "DRONE_CHAOS"
+
+// Engine is an engine.Engine that simulates a full disk when
+// the pipeline environment is created, and kills steps at
+// random points during execution. Failures are only injected
+// into pipelines that opt in by setting DRONE_CHAOS=true in the
+// environment or build parameters.
+type Engine struct {
+	engine.Engine
+
+	config Config
+	dice   *dice
+}
+
+// NewEngine returns a new chaos engine that wraps the engine.
+func NewEngine(base engine.Engine, config Config) *Engine {
+	if config.Delay <= 0 {
+		config.Delay = defaultDelay
+	}
+	return &Engine{
+		Engine: base,
+		config: config,
+		dice:   newDice(config.Seed),
+	}
+}
+
+// Setup the pipeline environment.
+func (e *Engine) Setup(ctx context.Context, spec *engine.Spec) error {
+	if optin(spec) && e.dice.roll(e.config.Disk) {
+		logger.FromContext(ctx).Warn("chaos: simulating disk full")
+		return errDisk
+	}
+	return e.Engine.Setup(ctx, spec)
+}
+
+// Run runs the pipeline step, and kills the step after a
+// random delay if selected for failure.
+func (e *Engine) Run(ctx context.Context, spec *engine.Spec, step *engine.Step, output io.Writer) (*engine.State, error) {
+	if step.Envs[Optin] != "true" || !e.dice.roll(e.config.Kill) {
+		return e.Engine.Run(ctx, spec, step, output)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	delay := e.dice.duration(e.config.Delay)
+	timer := time.AfterFunc(delay, cancel)
+
+	// if the timer is stopped before it fires, the step
+	// completed before it was killed.
+	state, err := e.Engine.Run(ctx, spec, step, output)
+	if timer.Stop() {
+		return state, err
+	}
+	logger.FromContext(ctx).
+		WithField("delay", delay).
+		Warn("chaos: simulating killed step")
+	fmt.Fprintf(output, "chaos: step killed after %s\n", delay)
+	return &engine.State{ExitCode: 137, Exited: true}, nil
+}
+
+// helper function returns true if any step in the pipeline
+// opts in to simulated failures.
+func optin(spec *engine.Spec) bool {
+	for _, step := range spec.Steps {
+		if step.Envs[Optin] == "true" {
+			return true
+		}
+	}
+	return false
+}
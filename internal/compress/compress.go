@@ -0,0 +1,129 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package compress provides compression of log and file
+// uploads to the server.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+)
+
+// Supported compression algorithms.
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// Valid returns true if the compression algorithm is supported.
+func Valid(name string) bool {
+	return name == Gzip || name == Zstd
+}
+
+// Encode returns the data compressed with the named algorithm.
+func Encode(name string, data []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	var w io.WriteCloser
+	switch name {
+	case Gzip:
+		w = gzip.NewWriter(buf)
+	case Zstd:
+		zw, err := zstd.NewWriter(buf)
+		if err != nil {
+			return nil, err
+		}
+		w = zw
+	default:
+		return nil, fmt.Errorf("compress: unsupported algorithm %q", name)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Transport is an http.RoundTripper that compresses the body
+// of upload requests that exceed the threshold. If the server
+// does not accept the compressed request, the request is
+// retried uncompressed, and compression is disabled.
+type Transport struct {
+	Base      http.RoundTripper
+	Algorithm string
+	Threshold int
+
+	disabled int32
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || !isUpload(req) || atomic.LoadInt32(&t.disabled) == 1 {
+		return t.base().RoundTrip(req)
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < t.Threshold {
+		return t.base().RoundTrip(withBody(req, data))
+	}
+	compressed, err := Encode(t.Algorithm, data)
+	if err != nil {
+		return nil, err
+	}
+	creq := withBody(req, compressed)
+	creq.Header.Set("Content-Encoding", t.Algorithm)
+	res, err := t.base().RoundTrip(creq)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusUnsupportedMediaType {
+		return res, nil
+	}
+	res.Body.Close()
+	atomic.StoreInt32(&t.disabled, 1)
+	logrus.WithField("algorithm", t.Algorithm).
+		Warnln("server does not accept compressed uploads")
+	return t.base().RoundTrip(withBody(req, data))
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// helper function returns true if the request uploads logs or
+// files to the server.
+func isUpload(req *http.Request) bool {
+	if req.Method != http.MethodPost && req.Method != http.MethodPut {
+		return false
+	}
+	return strings.Contains(req.URL.Path, "/logs/")
+}
+
+// helper function returns a copy of the request with the body.
+func withBody(req *http.Request, data []byte) *http.Request {
+	req = req.Clone(req.Context())
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	return req
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestEncode(t *testing.T) {
+	data := []byte(strings.Repeat("hello world\n", 100))
+	for _, name := range []string{Gzip, Zstd} {
+		compressed, err := Encode(name, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := decode(t, name, compressed); !bytes.Equal(got, data) {
+			t.Errorf("Want %s data decoded", name)
+		}
+	}
+	if _, err := Encode("lz4", data); err == nil {
+		t.Errorf("Expect error when algorithm unsupported")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var encoding string
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: &Transport{Algorithm: Gzip, Threshold: 100}}
+	data := strings.Repeat("hello world\n", 100)
+	client.Post(ts.URL+"/rpc/v2/step/1/logs/batch", "application/json", strings.NewReader(data))
+	if encoding != Gzip {
+		t.Errorf("Want request compressed, got encoding %q", encoding)
+	}
+	if got := decode(t, Gzip, body); string(got) != data {
+		t.Errorf("Want compressed body decoded")
+	}
+
+	client.Post(ts.URL+"/rpc/v2/step/1/logs/batch", "application/json", strings.NewReader("hello"))
+	if encoding != "" || string(body) != "hello" {
+		t.Errorf("Want request below threshold uncompressed")
+	}
+
+	client.Post(ts.URL+"/rpc/v2/stage", "application/json", strings.NewReader(data))
+	if encoding != "" {
+		t.Errorf("Want non-upload request uncompressed")
+	}
+}
+
+func TestTransport_NotAccepted(t *testing.T) {
+	var requests int
+	var body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Content-Encoding") != "" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer ts.Close()
+
+	transport := &Transport{Algorithm: Zstd}
+	client := &http.Client{Transport: transport}
+	res, err := client.Post(ts.URL+"/rpc/v2/step/1/logs/upload", "application/json", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || body != "hello" {
+		t.Errorf("Want request retried uncompressed")
+	}
+	client.Post(ts.URL+"/rpc/v2/step/1/logs/upload", "application/json", strings.NewReader("hello"))
+	if requests != 3 {
+		t.Errorf("Want compression disabled, got %d requests", requests)
+	}
+}
+
+func decode(t *testing.T, name string, data []byte) []byte {
+	var out []byte
+	var err error
+	switch name {
+	case Gzip:
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			out, err = ioutil.ReadAll(r)
+		}
+	case Zstd:
+		var r *zstd.Decoder
+		if r, err = zstd.NewReader(bytes.NewReader(data)); err == nil {
+			out, err = ioutil.ReadAll(r)
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package cron schedules periodic host maintenance tasks, such
+// as cache pruning and mirror refresh.
+package cron
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/buildkite/yaml"
+)
+
+// Task defines a scheduled maintenance task.
+type Task struct {
+	Name     string        `yaml:"name"`
+	Schedule string        `yaml:"schedule"`
+	Command  string        `yaml:"command"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// Load loads the tasks from the yaml file, and returns an
+// error if a task is invalid.
+func Load(path string) ([]*Task, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tasks []*Task
+	if err := yaml.Unmarshal(raw, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, Lint(tasks)
+}
+
+// Lint returns an error if a task is invalid.
+func Lint(tasks []*Task) error {
+	names := map[string]struct{}{}
+	for _, task := range tasks {
+		if task.Name == "" {
+			return errors.New("invalid or missing task name")
+		}
+		if _, ok := names[task.Name]; ok {
+			return fmt.Errorf("duplicate task %q", task.Name)
+		}
+		names[task.Name] = struct{}{}
+		if task.Command == "" {
+			return fmt.Errorf("missing command for task %q", task.Name)
+		}
+		if _, err := Parse(task.Schedule); err != nil {
+			return fmt.Errorf("task %q: %s", task.Name, err)
+		}
+	}
+	return nil
+}
+
+// Run invokes the function for each task on the task schedule
+// until the context is cancelled. Runs of the same task never
+// overlap; an activation is skipped if the previous run has
+// not completed.
+func Run(ctx context.Context, tasks []*Task, fn func(context.Context, *Task)) {
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		schedule, err := Parse(task.Schedule)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(task *Task) {
+			defer wg.Done()
+			run(ctx, task, schedule, fn)
+		}(task)
+	}
+	wg.Wait()
+}
+
+func run(ctx context.Context, task *Task, schedule Schedule, fn func(context.Context, *Task)) {
+	for {
+		next := schedule.Next(now())
+		if next.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		fn(ctx, task)
+	}
+}
+
+// now returns the current time, and can be replaced for
+// testing purposes.
+var now = time.Now
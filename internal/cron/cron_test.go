@@ -0,0 +1,28 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package cron
+
+import "testing"
+
+func TestLint(t *testing.T) {
+	tests := [][]*Task{
+		{{Schedule: "@daily", Command: "true"}},
+		{{Name: "prune", Schedule: "@daily"}},
+		{{Name: "prune", Schedule: "daily", Command: "true"}},
+		{
+			{Name: "prune", Schedule: "@daily", Command: "true"},
+			{Name: "prune", Schedule: "@hourly", Command: "true"},
+		},
+	}
+	for i, tasks := range tests {
+		if err := Lint(tasks); err == nil {
+			t.Errorf("Expect lint error for test %d", i)
+		}
+	}
+	valid := []*Task{{Name: "prune", Schedule: "0 3 * * *", Command: "go clean -cache"}}
+	if err := Lint(valid); err != nil {
+		t.Error(err)
+	}
+}
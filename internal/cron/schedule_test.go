@@ -0,0 +1,57 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	from := time.Date(2024, time.January, 31, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, time.January, 31, 10, 45, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, time.January, 31, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 3 * * 0", time.Date(2024, time.February, 4, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * 7", time.Date(2024, time.February, 4, 3, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"30 9-17/4 * * 1-5", time.Date(2024, time.January, 31, 13, 30, 0, 0, time.UTC)},
+		{"0 0 1,15 * 3", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 6h", time.Date(2024, time.January, 31, 16, 30, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		schedule, err := Parse(test.spec)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q: %s", test.spec, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(test.next) {
+			t.Errorf("Want next activation %s for %q, got %s", test.next, test.spec, got)
+		}
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"@every 1s",
+		"@fortnightly",
+	}
+	for _, spec := range tests {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Expect error parsing %q", spec)
+		}
+	}
+}
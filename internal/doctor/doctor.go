@@ -0,0 +1,227 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package doctor provides diagnostic checks for the runner
+// host and configuration.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/drone/runner-go/client"
+)
+
+// Check is a named diagnostic check. The check returns
+// optional details on success, or an error on failure.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) (string, error)
+}
+
+// Result is the result of a diagnostic check.
+type Result struct {
+	Name   string
+	Detail string
+	Err    error
+}
+
+// Run runs the checks, in order, and returns the results.
+func Run(ctx context.Context, checks ...Check) []*Result {
+	var results []*Result
+	for _, check := range checks {
+		detail, err := check.Run(ctx)
+		results = append(results, &Result{
+			Name:   check.Name,
+			Detail: detail,
+			Err:    err,
+		})
+	}
+	return results
+}
+
+// Report writes a pass/fail report and returns the number of
+// failed checks.
+func Report(w io.Writer, results []*Result) int {
+	var failed int
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, result := range results {
+		status, detail := "PASS", result.Detail
+		if result.Err != nil {
+			status, detail = "FAIL", result.Err.Error()
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", status, result.Name, detail)
+	}
+	tw.Flush()
+	return failed
+}
+
+// Server returns a check that verifies the server is
+// reachable. Any http response indicates the server is
+// reachable.
+func Server(address string) Check {
+	return Check{
+		Name: "server connectivity",
+		Run: func(ctx context.Context) (string, error) {
+			res, err := head(ctx, address)
+			if err != nil {
+				return "", err
+			}
+			res.Body.Close()
+			return address, nil
+		},
+	}
+}
+
+// Secret returns a check that verifies the shared secret is
+// accepted by the server.
+func Secret(cli client.Client, machine string) Check {
+	return Check{
+		Name: "shared secret",
+		Run: func(ctx context.Context) (string, error) {
+			ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			defer cancel()
+			if err := cli.Ping(ctx, machine); err != nil {
+				return "", fmt.Errorf("cannot authenticate: %s", err)
+			}
+			return "accepted", nil
+		},
+	}
+}
+
+// Clock returns a check that verifies the clock skew between
+// the host and the server does not exceed the maximum skew.
+func Clock(address string, max time.Duration) Check {
+	return Check{
+		Name: "clock skew",
+		Run: func(ctx context.Context) (string, error) {
+			before := time.Now()
+			res, err := head(ctx, address)
+			if err != nil {
+				return "", err
+			}
+			res.Body.Close()
+			date, err := http.ParseTime(res.Header.Get("Date"))
+			if err != nil {
+				return "", errors.New("server did not return the date")
+			}
+			// the server date is compared to the midpoint of
+			// the request to account for latency.
+			local := before.Add(time.Since(before) / 2)
+			skew := local.Sub(date).Round(time.Second)
+			if skew < 0 {
+				skew = -skew
+			}
+			if skew > max {
+				return "", fmt.Errorf("clock skew of %s exceeds %s", skew, max)
+			}
+			return skew.String(), nil
+		},
+	}
+}
+
+// Binary returns a check that verifies the binary is
+// installed and executable.
+func Binary(name string, args ...string) Check {
+	return Check{
+		Name: name + " installed",
+		Run: func(ctx context.Context) (string, error) {
+			path, err := exec.LookPath(name)
+			if err != nil {
+				return "", err
+			}
+			if len(args) == 0 {
+				return path, nil
+			}
+			out, err := exec.CommandContext(ctx, path, args...).Output()
+			if err != nil {
+				return "", fmt.Errorf("cannot execute %s: %s", path, err)
+			}
+			return strings.TrimSpace(firstLine(string(out))), nil
+		},
+	}
+}
+
+// Workspace returns a check that verifies pipeline workspaces
+// can be created in the root directory.
+func Workspace(root string) Check {
+	return Check{
+		Name: "workspace permissions",
+		Run: func(ctx context.Context) (string, error) {
+			dir, err := tempdir(root)
+			if err != nil {
+				return "", err
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "drone", "src", "README")
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				return "", err
+			}
+			if err := ioutil.WriteFile(path, []byte("hello"), 0600); err != nil {
+				return "", err
+			}
+			return root, nil
+		},
+	}
+}
+
+// Symlink returns a check that verifies symbolic links can be
+// created in the root directory. Creating symbolic links on
+// windows requires developer mode or elevated privileges.
+func Symlink(root string) Check {
+	return Check{
+		Name: "symlink capability",
+		Run: func(ctx context.Context) (string, error) {
+			dir, err := tempdir(root)
+			if err != nil {
+				return "", err
+			}
+			defer os.RemoveAll(dir)
+			err = os.Symlink(dir, filepath.Join(dir, "link"))
+			if err != nil {
+				return "", err
+			}
+			return "supported", nil
+		},
+	}
+}
+
+// helper function creates a temporary directory in the root
+// directory, creating the root directory if not exists.
+func tempdir(root string) (string, error) {
+	if err := os.MkdirAll(root, 0777); err != nil {
+		return "", err
+	}
+	return ioutil.TempDir(root, "drone-doctor-")
+}
+
+// helper function sends a head request to the address.
+func head(ctx context.Context, address string) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequest("HEAD", address, nil)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req.WithContext(ctx))
+}
+
+// helper function returns the first line of the string.
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i != -1 {
+		return s[:i]
+	}
+	return s
+}
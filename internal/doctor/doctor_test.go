@@ -0,0 +1,104 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/runner-go/client"
+)
+
+var noContext = context.Background()
+
+func TestReport(t *testing.T) {
+	results := Run(noContext,
+		Check{Name: "passing", Run: func(context.Context) (string, error) {
+			return "ok", nil
+		}},
+		Check{Name: "failing", Run: func(context.Context) (string, error) {
+			return "", errors.New("not ok")
+		}},
+	)
+	buf := new(bytes.Buffer)
+	if got := Report(buf, results); got != 1 {
+		t.Errorf("Want 1 failed check, got %d", got)
+	}
+	want := "PASS  passing  ok\nFAIL  failing  not ok\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Want report %q, got %q", want, got)
+	}
+}
+
+func TestServer(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+	if _, err := Server(ts.URL).Run(noContext); err != nil {
+		t.Errorf("Expect server reachable, got %s", err)
+	}
+	ts.Close()
+	if _, err := Server(ts.URL).Run(noContext); err == nil {
+		t.Errorf("Expect error when server unreachable")
+	}
+}
+
+func TestClock(t *testing.T) {
+	var date time.Time
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", date.UTC().Format(http.TimeFormat))
+	}))
+	defer ts.Close()
+
+	date = time.Now()
+	if _, err := Clock(ts.URL, time.Minute).Run(noContext); err != nil {
+		t.Errorf("Expect clock in sync, got %s", err)
+	}
+	date = time.Now().Add(-5 * time.Minute)
+	if _, err := Clock(ts.URL, time.Minute).Run(noContext); err == nil {
+		t.Errorf("Expect error when clock skew exceeds maximum")
+	}
+}
+
+func TestSecret(t *testing.T) {
+	if _, err := Secret(&fakeClient{}, "runner").Run(noContext); err != nil {
+		t.Errorf("Expect secret accepted, got %s", err)
+	}
+	cli := &fakeClient{err: errors.New("Unauthorized")}
+	_, err := Secret(cli, "runner").Run(noContext)
+	if err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("Expect error when secret rejected, got %v", err)
+	}
+}
+
+func TestBinary(t *testing.T) {
+	if _, err := Binary("drone-doctor-not-found").Run(noContext); err == nil {
+		t.Errorf("Expect error when binary not found")
+	}
+}
+
+func TestWorkspace(t *testing.T) {
+	root := t.TempDir()
+	if _, err := Workspace(root).Run(noContext); err != nil {
+		t.Errorf("Expect workspace created, got %s", err)
+	}
+	if _, err := Symlink(root).Run(noContext); err != nil {
+		t.Logf("symbolic links not supported: %s", err)
+	}
+}
+
+type fakeClient struct {
+	client.Client
+	err error
+}
+
+func (c *fakeClient) Ping(context.Context, string) error {
+	return c.err
+}
@@ -0,0 +1,149 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package egress
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/runner-go/logger"
+)
+
+func TestLoadRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-egress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "egress.yml")
+	ioutil.WriteFile(path, []byte("- repo: octocat/*\n  step: test\n  domains: [ proxy.golang.org ]\n"), 0600)
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].Domains[0] != "proxy.golang.org" {
+		t.Errorf("Unexpected rules %v", rules)
+	}
+
+	ioutil.WriteFile(path, []byte("- repo: octocat/*\n"), 0600)
+	if _, err := LoadRules(path); err == nil {
+		t.Errorf("Expect error when rule does not define domains")
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	rules := []*Rule{
+		{Repo: "octocat/*", Domains: []string{"*.github.com"}},
+		{Repo: "octocat/hello-world", Step: "test", Domains: []string{"proxy.golang.org"}},
+	}
+	tests := []struct {
+		repo, step, host string
+		want             bool
+	}{
+		{"octocat/hello-world", "build", "api.github.com", true},
+		{"octocat/hello-world", "build", "API.GitHub.com.", true},
+		{"octocat/hello-world", "build", "proxy.golang.org", false},
+		{"octocat/hello-world", "test", "proxy.golang.org", true},
+		{"spaceghost/hello-world", "test", "api.github.com", false},
+	}
+	for _, test := range tests {
+		if got := Allowed(rules, test.repo, test.step, test.host); got != test.want {
+			t.Errorf("Want %s %s %s allowed %v, got %v", test.repo, test.step, test.host, test.want, got)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "" {
+			t.Errorf("Expect proxy credentials removed from the request")
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer upstream.Close()
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer secure.Close()
+
+	rules := []*Rule{{Step: "test", Domains: []string{"127.0.0.1"}}}
+	proxy, err := Start(rules, "octocat/hello-world", nil, logger.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+
+	environ := map[string]map[string]string{}
+	for _, step := range []string{"test", "build"} {
+		if environ[step], err = proxy.Environ(step); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client := func(step string) *http.Client {
+		u, _ := url.Parse(environ[step]["HTTP_PROXY"])
+		transport := secure.Client().Transport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(u)
+		return &http.Client{Transport: transport}
+	}
+
+	res, err := client("test").Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "hello" {
+		t.Errorf("Want response proxied, got %d %q", res.StatusCode, body)
+	}
+
+	res, err = client("test").Get(secure.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "secure" {
+		t.Errorf("Want connection tunneled, got %d %q", res.StatusCode, body)
+	}
+
+	res, err = client("build").Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Want request denied for step, got %d", res.StatusCode)
+	}
+
+	// the step is identified by the token, which cannot be
+	// used to claim the allowlist of another step.
+	u, _ := url.Parse(environ["build"]["HTTP_PROXY"])
+	password, _ := u.User.Password()
+	u.User = url.UserPassword("test", password)
+	res, err = (&http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(u)}}).Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Want request denied for the step of the token, got %d", res.StatusCode)
+	}
+
+	u.User = url.UserPassword("test", "invalid")
+	res, err = (&http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(u)}}).Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusProxyAuthRequired {
+		t.Errorf("Want request unauthorized, got %d", res.StatusCode)
+	}
+}
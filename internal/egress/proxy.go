@@ -0,0 +1,263 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package egress
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/runner-go/logger"
+)
+
+// Proxy is a stage-scoped http proxy that filters the outbound
+// requests of the stage steps. Each step authenticates with a
+// token issued to the step, which is embedded in the proxy url,
+// and requests are attributed to the step the token was issued
+// to, so that a step cannot claim the allowlist of another step.
+//
+// The proxy is enforced by the environment variables honoured
+// by most http clients. Traffic is not transparently redirected
+// to the proxy, so steps that ignore the variables are not
+// filtered, unless direct outbound traffic is blocked by the
+// host firewall.
+type Proxy struct {
+	rules []*Rule
+	repo  string
+	log   logger.Logger
+
+	listener net.Listener
+	server   *http.Server
+	dialer   *net.Dialer
+	client   *http.Transport
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	tokens map[string]string
+}
+
+// Start starts a proxy for the repository on a random loopback
+// port. The proxy allows the domains of the matching rules,
+// and the additional hosts, which typically include the git
+// server. The proxy must be closed when the stage completes.
+func Start(rules []*Rule, repo string, hosts []string, log logger.Logger) (*Proxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) != 0 {
+		rules = append(rules[:len(rules):len(rules)], &Rule{Domains: hosts})
+	}
+	p := &Proxy{
+		rules:    rules,
+		repo:     repo,
+		log:      log,
+		listener: listener,
+		dialer:   &net.Dialer{Timeout: 30 * time.Second},
+		conns:    map[net.Conn]struct{}{},
+		tokens:   map[string]string{},
+	}
+	p.client = &http.Transport{
+		DialContext:         p.dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	p.server = &http.Server{Handler: p}
+	go p.server.Serve(listener)
+	return p, nil
+}
+
+// Environ returns the environment variables that route the
+// step traffic through the proxy, with a token issued to the
+// step.
+func (p *Proxy) Environ(step string) (map[string]string, error) {
+	token, err := p.issue(step)
+	if err != nil {
+		return nil, err
+	}
+	u := &url.URL{
+		Scheme: "http",
+		User:   url.UserPassword(step, token),
+		Host:   p.listener.Addr().String(),
+	}
+	proxy := u.String()
+	noproxy := "localhost,127.0.0.1,::1"
+	return map[string]string{
+		"HTTP_PROXY":  proxy,
+		"HTTPS_PROXY": proxy,
+		"http_proxy":  proxy,
+		"https_proxy": proxy,
+		"NO_PROXY":    noproxy,
+		"no_proxy":    noproxy,
+	}, nil
+}
+
+// Close stops the proxy, and closes the open tunnels.
+func (p *Proxy) Close() error {
+	err := p.server.Close()
+	p.client.CloseIdleConnections()
+	p.mu.Lock()
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.mu.Unlock()
+	return err
+}
+
+// ServeHTTP proxies the request, if the request is authorized
+// and the destination host is allowed.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	step, ok := p.authenticate(r)
+	if !ok {
+		w.Header().Set("Proxy-Authenticate", `Basic realm="drone"`)
+		http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+		return
+	}
+
+	host := r.URL.Hostname()
+	if r.Method == http.MethodConnect {
+		host, _, _ = net.SplitHostPort(r.Host)
+	}
+	allowed := host != "" && Allowed(p.rules, p.repo, step, host)
+
+	p.log.
+		WithField("audit", "egress").
+		WithField("step.name", step).
+		WithField("method", r.Method).
+		WithField("host", host).
+		WithField("allowed", allowed).
+		Info("outbound request")
+
+	if !allowed {
+		http.Error(w, "egress to "+host+" is not allowed", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	p.forward(w, r)
+}
+
+// helper function issues a random token to the step.
+func (p *Proxy) issue(step string) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+	p.mu.Lock()
+	p.tokens[token] = step
+	p.mu.Unlock()
+	return token, nil
+}
+
+// helper function returns the name of the step the token was
+// issued to, and true if the request is authenticated with a
+// token issued by the proxy. The user name of the credentials
+// is ignored.
+func (p *Proxy) authenticate(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Proxy-Authorization")
+	if !strings.HasPrefix(auth, "Basic ") {
+		return "", false
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "Basic "))
+	if err != nil {
+		return "", false
+	}
+	i := strings.LastIndex(string(raw), ":")
+	if i == -1 {
+		return "", false
+	}
+	token := raw[i+1:]
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for issued, step := range p.tokens {
+		if subtle.ConstantTimeCompare(token, []byte(issued)) == 1 {
+			return step, true
+		}
+	}
+	return "", false
+}
+
+// helper function forwards the plain http request.
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Scheme != "http" || r.URL.Host == "" {
+		http.Error(w, "invalid proxy request", http.StatusBadRequest)
+		return
+	}
+	req := r.Clone(r.Context())
+	req.RequestURI = ""
+	req.Header.Del("Proxy-Authorization")
+	req.Header.Del("Proxy-Connection")
+	res, err := p.client.RoundTrip(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(res.StatusCode)
+	io.Copy(w, res.Body)
+}
+
+// helper function tunnels the https connection.
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := p.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "cannot tunnel connection", http.StatusInternalServerError)
+		return
+	}
+	conn, buf, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+
+	// the tunnel is closed when either side closes the
+	// connection, or when the proxy is closed.
+	p.track(conn, true)
+	p.track(upstream, true)
+	defer p.track(conn, false)
+	defer p.track(upstream, false)
+
+	done := make(chan struct{}, 1)
+	go func() {
+		io.Copy(upstream, buf)
+		done <- struct{}{}
+	}()
+	io.Copy(conn, upstream)
+	conn.Close()
+	upstream.Close()
+	<-done
+}
+
+// helper function tracks the open tunnel connections, which
+// are closed when the proxy is closed.
+func (p *Proxy) track(conn net.Conn, open bool) {
+	p.mu.Lock()
+	if open {
+		p.conns[conn] = struct{}{}
+	} else {
+		delete(p.conns, conn)
+	}
+	p.mu.Unlock()
+}
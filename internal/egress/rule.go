@@ -0,0 +1,83 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package egress provides a stage-scoped http proxy that filters
+// the outbound requests of pipeline steps by domain, and logs
+// the requests for audit.
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/buildkite/yaml"
+)
+
+// Policy defines the egress allowlists of the runner.
+type Policy struct {
+	// Rules defines the domains allowed for the matching
+	// repositories and steps. Requests to other domains are
+	// denied.
+	Rules []*Rule
+
+	// Trusted routes the steps of trusted repositories through
+	// the proxy. By default, only the steps of untrusted
+	// repositories are routed through the proxy.
+	Trusted bool
+}
+
+// Rule allows the steps matching the repository and step name
+// patterns to request the domains. Empty patterns match all
+// repositories and steps.
+type Rule struct {
+	Repo    string   `yaml:"repo"`
+	Step    string   `yaml:"step"`
+	Domains []string `yaml:"domains"`
+}
+
+// LoadRules loads the egress rules from a yaml file.
+func LoadRules(path string) ([]*Rule, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*Rule
+	if err := yaml.Unmarshal(raw, &rules); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if len(rule.Domains) == 0 {
+			return nil, errors.New("egress rule must define domains")
+		}
+		for _, pattern := range append([]string{rule.Repo, rule.Step}, rule.Domains...) {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("egress rule: invalid pattern %q", pattern)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// Allowed returns true if the rules allow the step of the
+// repository to request the host.
+func Allowed(rules []*Rule, repo, step, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, rule := range rules {
+		if ok, _ := filepath.Match(rule.Repo, repo); rule.Repo != "" && !ok {
+			continue
+		}
+		if ok, _ := filepath.Match(rule.Step, step); rule.Step != "" && !ok {
+			continue
+		}
+		for _, domain := range rule.Domains {
+			if ok, _ := filepath.Match(strings.ToLower(domain), host); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
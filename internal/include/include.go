@@ -0,0 +1,223 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package include composes a pipeline configuration split
+// across multiple local yaml files, so that the composed
+// configuration can be tested with the local commands.
+//
+// A document that only declares includes is replaced by the
+// documents of the included files:
+//
+//	include:
+//	- pipelines/backend.yml
+//	- pipelines/frontend.yml
+//
+// A document that declares includes in addition to other keys
+// is prefixed with the included fragments, so that the anchors
+// defined by the fragments can be referenced by the document:
+//
+//	kind: pipeline
+//	include: [ fragments/defaults.yml ]
+//	steps:
+//	- <<: *defaults
+//	  commands: [ make test ]
+//
+// Included paths are relative to the including file, and may
+// include other files.
+package include
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/buildkite/yaml"
+)
+
+// Expand returns the configuration with the includes resolved.
+// The path is the location of the configuration, and included
+// paths are relative to the directory of the path.
+func Expand(data []byte, path string) ([]byte, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := expand(data, abs, []string{abs})
+	if err != nil {
+		return nil, err
+	}
+	return join(docs), nil
+}
+
+// helper function returns the documents of the configuration
+// with the includes resolved. The stack contains the files
+// being expanded, to detect include cycles.
+func expand(data []byte, path string, stack []string) ([]string, error) {
+	var out []string
+	for _, doc := range split(data) {
+		block, rest := extract(doc)
+		if block == "" {
+			out = append(out, doc)
+			continue
+		}
+		paths, err := parse(block)
+		if err != nil {
+			return nil, fmt.Errorf("include: %s: %s", path, err)
+		}
+
+		var included [][]string
+		for _, name := range paths {
+			docs, err := load(filepath.Join(filepath.Dir(path), filepath.FromSlash(name)), stack)
+			if err != nil {
+				return nil, err
+			}
+			included = append(included, docs)
+		}
+
+		// a document that only declares includes is replaced
+		// by the included documents.
+		if isEmpty(rest) {
+			for _, docs := range included {
+				out = append(out, docs...)
+			}
+			continue
+		}
+
+		// a document that declares other keys is prefixed
+		// with the included fragments, which must be single
+		// documents.
+		var buf strings.Builder
+		for i, docs := range included {
+			if len(docs) != 1 {
+				return nil, fmt.Errorf("include: %s: fragment %s is not a single document", path, paths[i])
+			}
+			buf.WriteString(docs[0])
+		}
+		buf.WriteString(rest)
+		out = append(out, buf.String())
+	}
+	return out, nil
+}
+
+// helper function reads and expands the included file.
+func load(path string, stack []string) ([]string, error) {
+	for _, prev := range stack {
+		if prev == path {
+			return nil, fmt.Errorf("include: cycle detected: %s", strings.Join(append(stack, path), " -> "))
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("include: %s", err)
+	}
+	return expand(data, path, append(stack[:len(stack):len(stack)], path))
+}
+
+// helper function splits the configuration into documents,
+// and discards empty documents.
+func split(data []byte) []string {
+	var docs []string
+	var buf strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimRight(line, " \t") == "---" {
+			docs = append(docs, buf.String())
+			buf.Reset()
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	docs = append(docs, buf.String())
+
+	var out []string
+	for _, doc := range docs {
+		if !isEmpty(doc) {
+			out = append(out, doc)
+		}
+	}
+	return out
+}
+
+// helper function returns the top-level include block of the
+// document, and the document without the block. The block is
+// extracted from the text, since the document may reference
+// anchors that are defined by the included fragments.
+func extract(doc string) (block, rest string) {
+	lines := strings.SplitAfter(doc, "\n")
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "include:") {
+			continue
+		}
+		end := i + 1
+		for end < len(lines) {
+			next := lines[end]
+			if next == "" || (!strings.HasPrefix(next, " ") && !strings.HasPrefix(next, "-") && !strings.HasPrefix(next, "\t") && strings.TrimSpace(next) != "") {
+				break
+			}
+			end++
+		}
+		block = strings.Join(lines[i:end], "")
+		rest = strings.Join(lines[:i], "") + strings.Join(lines[end:], "")
+		return block, rest
+	}
+	return "", doc
+}
+
+// helper function parses the include block, which is a path or
+// a list of paths.
+func parse(block string) ([]string, error) {
+	var single struct {
+		Include string `yaml:"include"`
+	}
+	if err := yaml.Unmarshal([]byte(block), &single); err == nil {
+		if single.Include == "" {
+			return nil, errors.New("invalid include")
+		}
+		return []string{single.Include}, nil
+	}
+	var list struct {
+		Include []string `yaml:"include"`
+	}
+	if err := yaml.Unmarshal([]byte(block), &list); err != nil {
+		return nil, fmt.Errorf("invalid include: %s", err)
+	}
+	for _, name := range list.Include {
+		if name == "" {
+			return nil, errors.New("invalid include")
+		}
+	}
+	return list.Include, nil
+}
+
+// helper function joins the documents.
+func join(docs []string) []byte {
+	var buf bytes.Buffer
+	for _, doc := range docs {
+		buf.WriteString("---\n")
+		buf.WriteString(doc)
+		if !strings.HasSuffix(doc, "\n") {
+			buf.WriteString("\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// helper function returns true if the document only contains
+// whitespace and comments.
+func isEmpty(doc string) bool {
+	for _, line := range strings.Split(doc, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+	return true
+}
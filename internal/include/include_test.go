@@ -0,0 +1,101 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package include
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine/resource"
+
+	"github.com/drone/runner-go/manifest"
+)
+
+func TestExpand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"fragments/defaults.yml": "defaults: &defaults\n  commands: [ go test ./... ]\n",
+		"pipelines/backend.yml": `---
+kind: pipeline
+type: exec
+name: backend
+include: ../fragments/defaults.yml
+steps:
+- name: test
+  <<: *defaults
+`,
+		"pipelines/frontend.yml": `---
+kind: pipeline
+type: exec
+name: frontend
+steps:
+- name: test
+  commands: [ npm test ]
+`,
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0700)
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source := "---\ninclude:\n- pipelines/backend.yml\n- pipelines/frontend.yml\n"
+	data, err := Expand([]byte(source), filepath.Join(dir, ".drone.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := manifest.ParseString(string(data))
+	if err != nil {
+		t.Fatalf("Cannot parse composed configuration: %s\n%s", err, data)
+	}
+	if got, want := len(m.Resources), 2; got != want {
+		t.Fatalf("Want %d resources, got %d", want, got)
+	}
+	backend, err := resource.Lookup("backend", m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := backend.Steps[0].Commands; len(got) != 1 || got[0] != "go test ./..." {
+		t.Errorf("Want anchors resolved from fragment, got %v", got)
+	}
+}
+
+func TestExpand_Cycle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "a.yml")
+	ioutil.WriteFile(path, []byte("include: b.yml\n"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, "b.yml"), []byte("include: a.yml\n"), 0600)
+
+	data, _ := ioutil.ReadFile(path)
+	if _, err := Expand(data, path); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Want include cycle error, got %v", err)
+	}
+}
+
+func TestExpand_None(t *testing.T) {
+	source := "---\nkind: pipeline\nname: default\n---\nkind: secret\nname: token\n"
+	data, err := Expand([]byte(source), ".drone.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != source {
+		t.Errorf("Want configuration unchanged, got\n%s", got)
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package kv stores small key/value outputs published by a
+// pipeline stage, so that dependent stages, possibly running
+// on other runners, can consume the values.
+package kv
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/seal"
+)
+
+// MaxSize is the maximum encoded size of the values published
+// by a stage.
+const MaxSize = 65536 // 64KB
+
+// ErrTooLarge is returned when the values exceed MaxSize.
+var ErrTooLarge = errors.New("kv: values exceed the maximum size")
+
+// Key identifies the values published by a stage.
+type Key struct {
+	Repo  string // repository slug
+	Build int64  // build number
+	Stage string // stage name
+}
+
+// Store stores the values published by pipeline stages.
+type Store interface {
+	// Put publishes the stage values.
+	Put(ctx context.Context, key Key, values map[string]string) error
+
+	// Get returns the stage values, or nil if the stage did
+	// not publish any values.
+	Get(ctx context.Context, key Key) (map[string]string, error)
+}
+
+// helper function encodes the values, and returns an error if
+// the values exceed the maximum size.
+func encode(values map[string]string) ([]byte, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxSize {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+// Dir returns a Store that stores the values in a directory,
+// which can be shared by runners using a network file system.
+func Dir(path string) Store {
+	return &dir{path: path}
+}
+
+// EncryptedDir returns a Store that stores the values in a
+// directory, encrypted at rest with the key. Runners sharing
+// the directory must use the same key.
+func EncryptedDir(path string, key *seal.Key) Store {
+	return &dir{path: path, key: key}
+}
+
+type dir struct {
+	path string
+	key  *seal.Key
+}
+
+func (d *dir) file(key Key) string {
+	return filepath.Join(
+		d.path,
+		filepath.FromSlash(key.Repo),
+		fmt.Sprint(key.Build),
+		url.PathEscape(key.Stage)+".json",
+	)
+}
+
+func (d *dir) Put(ctx context.Context, key Key, values map[string]string) error {
+	data, err := encode(values)
+	if err != nil {
+		return err
+	}
+	if d.key != nil {
+		if data, err = d.key.Seal(data); err != nil {
+			return err
+		}
+	}
+	path := d.file(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// the file is written atomically, since dependent stages
+	// on other runners may read the file concurrently.
+	temp := path + ".tmp"
+	if err := ioutil.WriteFile(temp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+func (d *dir) Get(ctx context.Context, key Key) (map[string]string, error) {
+	data, err := ioutil.ReadFile(d.file(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if d.key != nil {
+		if data, err = d.key.Open(data); err != nil {
+			return nil, err
+		}
+	}
+	values := map[string]string{}
+	return values, json.Unmarshal(data, &values)
+}
+
+// HTTP returns a Store that stores the values using a remote
+// http endpoint. The values are stored with a PUT request, and
+// retrieved with a GET request, to the path
+// /{namespace}/{name}/{build}/{stage} relative to the endpoint.
+func HTTP(endpoint, token string, skipverify bool) Store {
+	client := &http.Client{Timeout: 30 * time.Second}
+	if skipverify {
+		client.Transport = &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		}
+	}
+	return &remote{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		token:    token,
+		client:   client,
+	}
+}
+
+type remote struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+func (r *remote) url(key Key) string {
+	return fmt.Sprintf("%s/%s/%d/%s",
+		r.endpoint,
+		key.Repo,
+		key.Build,
+		url.PathEscape(key.Stage),
+	)
+}
+
+func (r *remote) Put(ctx context.Context, key Key, values map[string]string) error {
+	data, err := encode(values)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", r.url(key), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := r.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode > 299 {
+		return fmt.Errorf("kv: unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+func (r *remote) Get(ctx context.Context, key Key) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", r.url(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := r.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.StatusCode > 299 {
+		return nil, fmt.Errorf("kv: unexpected status %s", res.Status)
+	}
+	values := map[string]string{}
+	return values, json.NewDecoder(res.Body).Decode(&values)
+}
+
+func (r *remote) do(req *http.Request) (*http.Response, error) {
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	return r.client.Do(req)
+}
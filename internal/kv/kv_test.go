@@ -0,0 +1,108 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package kv
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/internal/seal"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var noContext = context.Background()
+
+func TestDir(t *testing.T) {
+	testStore(t, Dir(t.TempDir()))
+}
+
+func TestEncryptedDir(t *testing.T) {
+	key, _ := seal.New(bytes.Repeat([]byte{1}, seal.KeySize))
+	dir := t.TempDir()
+	testStore(t, EncryptedDir(dir, key))
+
+	// the values are not stored in plaintext.
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			if data, _ := ioutil.ReadFile(path); bytes.Contains(data, []byte("1.2.3")) {
+				t.Errorf("Want values encrypted at rest")
+			}
+		}
+		return nil
+	})
+}
+
+func TestHTTP(t *testing.T) {
+	var mu sync.Mutex
+	data := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer correct-horse" {
+			w.WriteHeader(401)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case "PUT":
+			raw, _ := ioutil.ReadAll(r.Body)
+			data[r.URL.EscapedPath()] = string(raw)
+		case "GET":
+			raw, ok := data[r.URL.EscapedPath()]
+			if !ok {
+				w.WriteHeader(404)
+				return
+			}
+			w.Write([]byte(raw))
+		}
+	}))
+	defer server.Close()
+
+	testStore(t, HTTP(server.URL+"/", "correct-horse", false))
+
+	// the values are stored at the documented path.
+	if _, ok := data["/octocat/hello-world/42/build%20linux"]; !ok {
+		t.Errorf("Want values stored by repository, build and stage")
+	}
+	if _, err := HTTP(server.URL, "", false).Get(noContext, Key{}); err == nil {
+		t.Errorf("Expect error when unauthorized")
+	}
+}
+
+func testStore(t *testing.T, store Store) {
+	key := Key{Repo: "octocat/hello-world", Build: 42, Stage: "build linux"}
+	got, err := store.Get(noContext, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Errorf("Want nil values when stage did not publish")
+	}
+
+	want := map[string]string{"version": "1.2.3"}
+	if err := store.Put(noContext, key, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.Get(noContext, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf(diff)
+	}
+
+	large := map[string]string{"blob": strings.Repeat("x", MaxSize)}
+	if err := store.Put(noContext, key, large); err != ErrTooLarge {
+		t.Errorf("Want ErrTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package labels loads the runner labels from a file or http
+// endpoint, which is refreshed periodically so that the labels
+// used to request stages follow changes to the host machine,
+// such as installed toolchain versions, without restarting the
+// runner.
+package labels
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/buildkite/yaml"
+	"github.com/drone/runner-go/logger"
+)
+
+// Source provides labels from a yaml or json file, or from
+// an http endpoint that returns a yaml or json object.
+type Source struct {
+	path   string
+	client *http.Client
+}
+
+// New returns a new label source. The path is a file path or
+// an http url.
+func New(path string) *Source {
+	return &Source{
+		path:   path,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Load loads the labels from the source.
+func (s *Source) Load(ctx context.Context) (map[string]string, error) {
+	data, err := s.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{}
+	if err := yaml.Unmarshal(data, &labels); err != nil {
+		return nil, fmt.Errorf("labels: %s: %s", s.path, err)
+	}
+	return labels, nil
+}
+
+// Watch loads the labels at the interval until the context is
+// cancelled, and calls the update function when the labels
+// change. The initial labels are the labels previously loaded
+// from the source.
+func (s *Source) Watch(ctx context.Context, interval time.Duration, initial map[string]string, update func(map[string]string)) {
+	log := logger.FromContext(ctx).WithField("source", s.path)
+	prev := initial
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		next, err := s.Load(ctx)
+		if err != nil {
+			log.WithError(err).Warnln("cannot refresh the runner labels")
+			continue
+		}
+		if reflect.DeepEqual(prev, next) {
+			continue
+		}
+		log.WithField("labels", next).Infoln("runner labels refreshed")
+		prev = next
+		update(next)
+	}
+}
+
+// Merge returns the labels loaded from the source merged with
+// the static labels. The static labels take precedence, so
+// that the labels that identify a runner profile cannot be
+// overridden by the source.
+func Merge(static, loaded map[string]string) map[string]string {
+	if len(loaded) == 0 {
+		return static
+	}
+	out := map[string]string{}
+	for k, v := range loaded {
+		out[k] = v
+	}
+	for k, v := range static {
+		out[k] = v
+	}
+	return out
+}
+
+// helper function reads the raw labels from the file or http
+// endpoint.
+func (s *Source) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.path, "http://") && !strings.HasPrefix(s.path, "https://") {
+		return ioutil.ReadFile(s.path)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", s.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		return nil, fmt.Errorf("labels: %s: unexpected status %s", s.path, res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
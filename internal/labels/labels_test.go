@@ -0,0 +1,106 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package labels
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "labels.yml")
+	ioutil.WriteFile(path, []byte("xcode: 15.2\nsimulator: true\n"), 0600)
+
+	got, err := New(path).Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"xcode": "15.2", "simulator": "true"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Unexpected labels")
+		t.Log(diff)
+	}
+
+	if _, err := New(filepath.Join(t.TempDir(), "missing")).Load(context.Background()); err == nil {
+		t.Errorf("Want error when labels file missing")
+	}
+}
+
+func TestLoad_HTTP(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/labels" {
+			w.WriteHeader(404)
+			return
+		}
+		w.Write([]byte(`{"xcode": "15.2"}`))
+	}))
+	defer ts.Close()
+
+	got, err := New(ts.URL + "/labels").Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, map[string]string{"xcode": "15.2"}); diff != "" {
+		t.Errorf("Unexpected labels")
+		t.Log(diff)
+	}
+
+	if _, err := New(ts.URL + "/missing").Load(context.Background()); err == nil {
+		t.Errorf("Want error when the endpoint returns an error status")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "labels.yml")
+	ioutil.WriteFile(path, []byte("xcode: 15.2\n"), 0600)
+	source := New(path)
+	initial, err := source.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan map[string]string, 10)
+	go source.Watch(ctx, time.Millisecond, initial, func(labels map[string]string) {
+		updates <- labels
+	})
+
+	// the file may be read while it is being written, so the
+	// updates are read until the labels are refreshed.
+	ioutil.WriteFile(path, []byte("xcode: 16.0\n"), 0600)
+	want := map[string]string{"xcode": "16.0"}
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case got := <-updates:
+			if cmp.Equal(got, want) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Want labels refreshed")
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	static := map[string]string{"profile": "ios"}
+	if got := Merge(static, nil); !cmp.Equal(got, static) {
+		t.Errorf("Want static labels when no labels are loaded")
+	}
+	got := Merge(static, map[string]string{"profile": "android", "xcode": "15.2"})
+	want := map[string]string{"profile": "ios", "xcode": "15.2"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Expect static labels take precedence")
+		t.Log(diff)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package lease provides machine-scoped stage leases, used to
+// detect when a running stage is owned by another machine.
+package lease
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+	"github.com/drone/runner-go/logger"
+)
+
+var (
+	// ErrLost is returned when the stage is leased by
+	// another machine.
+	ErrLost = errors.New("lease: stage is leased by another machine")
+
+	// ErrNotSupported is returned when the client or server
+	// does not support stage leases.
+	ErrNotSupported = errors.New("lease: not supported")
+)
+
+// Renewer is implemented by clients that support stage leases.
+type Renewer interface {
+	// Renew renews the stage lease for the stage machine, and
+	// updates the stage version. It returns ErrLost if the
+	// stage is leased by another machine.
+	Renew(ctx context.Context, stage *drone.Stage) error
+}
+
+// Renew renews the stage lease, returning ErrNotSupported if
+// the client does not support stage leases.
+func Renew(ctx context.Context, c client.Client, stage *drone.Stage) error {
+	if r, ok := c.(Renewer); ok {
+		return r.Renew(ctx, stage)
+	}
+	return ErrNotSupported
+}
+
+// Keepalive renews the stage lease at the interval until the
+// context is cancelled. The stage version is updated by each
+// renewal, while holding the lock that guards the stage, so
+// that subsequent stage updates do not fail with an optimistic
+// lock error. The lost function is invoked, and the renewal
+// stops, if the lease is lost.
+func Keepalive(ctx context.Context, c client.Client, stage *drone.Stage, mu sync.Locker, interval time.Duration, lost func()) {
+	log := logger.FromContext(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		// the stage is copied to avoid concurrent modification
+		// of the stage while it is running.
+		renewed := &drone.Stage{
+			ID:      stage.ID,
+			Machine: stage.Machine,
+		}
+		err := Renew(ctx, c, renewed)
+		switch {
+		case err == nil:
+			mu.Lock()
+			if renewed.Version > stage.Version {
+				stage.Version = renewed.Version
+				stage.Updated = renewed.Updated
+			}
+			mu.Unlock()
+			log.Traceln("stage lease renewed")
+		case errors.Is(err, ErrNotSupported):
+			log.Debugln("stage leases not supported")
+			return
+		case errors.Is(err, ErrLost):
+			log.Errorln("stage lease lost")
+			lost()
+			return
+		case ctx.Err() != nil:
+			return
+		default:
+			log.WithError(err).Warnln("cannot renew stage lease")
+		}
+	}
+}
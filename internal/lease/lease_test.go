@@ -0,0 +1,89 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package lease
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+func TestRenew_NotSupported(t *testing.T) {
+	var c client.Client
+	if err := Renew(context.Background(), c, &drone.Stage{}); err != ErrNotSupported {
+		t.Errorf("Want ErrNotSupported, got %v", err)
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	c := &fakeClient{errs: []error{nil, errors.New("connection reset"), ErrLost}}
+	stage := &drone.Stage{ID: 1, Machine: "runner-1"}
+
+	mu := new(sync.Mutex)
+	lost := make(chan struct{})
+	go Keepalive(context.Background(), c, stage, mu, time.Millisecond, func() {
+		close(lost)
+	})
+
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatalf("Want lost function invoked")
+	}
+	if got := c.count(); got != 3 {
+		t.Errorf("Want lease renewed 3 times, got %d", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := stage.Version; got != 2 {
+		t.Errorf("Want stage version updated by renewal, got %d", got)
+	}
+}
+
+func TestKeepalive_NotSupported(t *testing.T) {
+	c := &fakeClient{errs: []error{ErrNotSupported}}
+	done := make(chan struct{})
+	go func() {
+		Keepalive(context.Background(), c, &drone.Stage{}, new(sync.Mutex), time.Millisecond, func() {
+			t.Errorf("Want lost function not invoked")
+		})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Want keepalive stopped when leases not supported")
+	}
+}
+
+type fakeClient struct {
+	client.Client
+
+	sync.Mutex
+	errs  []error
+	calls int
+}
+
+func (c *fakeClient) Renew(ctx context.Context, stage *drone.Stage) error {
+	c.Lock()
+	defer c.Unlock()
+	err := c.errs[c.calls%len(c.errs)]
+	c.calls++
+	if err == nil {
+		stage.Version = int64(c.calls + 1)
+	}
+	return err
+}
+
+func (c *fakeClient) count() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.calls
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package livelog
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/drone-runners/drone-runner-exec/internal/seal"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// buffer stores the log history until it is uploaded.
+type buffer interface {
+	// push appends the line to the history.
+	push(line *drone.Line) error
+
+	// pop discards the oldest line, and returns the size of
+	// the discarded message.
+	pop() int
+
+	// len returns the number of lines in the history.
+	len() int
+
+	// lines returns the lines in the history.
+	lines() ([]*drone.Line, error)
+
+	// close releases the buffer resources.
+	close() error
+}
+
+// memBuffer stores the log history in memory.
+type memBuffer struct {
+	history []*drone.Line
+}
+
+func (b *memBuffer) push(line *drone.Line) error {
+	b.history = append(b.history, line)
+	return nil
+}
+
+func (b *memBuffer) pop() int {
+	size := len(b.history[0].Message)
+	b.history = b.history[1:]
+	return size
+}
+
+func (b *memBuffer) len() int {
+	return len(b.history)
+}
+
+func (b *memBuffer) lines() ([]*drone.Line, error) {
+	return append(b.history[:0:0], b.history...), nil
+}
+
+func (b *memBuffer) close() error {
+	b.history = nil
+	return nil
+}
+
+// fileBuffer stores the log history in a temporary file, to
+// reduce memory usage on hosts with limited memory. Only the
+// message sizes are stored in memory, so that the oldest lines
+// can be discarded when the log limit is exceeded.
+//
+// If the key is set, each line is encrypted, and is stored
+// base64 encoded.
+type fileBuffer struct {
+	file  *os.File
+	w     *bufio.Writer
+	key   *seal.Key
+	sizes []int
+	skip  int
+}
+
+func newFileBuffer(dir string, key *seal.Key) (*fileBuffer, error) {
+	file, err := ioutil.TempFile(dir, "drone-log-")
+	if err != nil {
+		return nil, err
+	}
+	return &fileBuffer{file: file, w: bufio.NewWriter(file), key: key}, nil
+}
+
+func (b *fileBuffer) push(line *drone.Line) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	if b.key != nil {
+		sealed, err := b.key.Seal(data)
+		if err != nil {
+			return err
+		}
+		data = []byte(base64.StdEncoding.EncodeToString(sealed))
+	}
+	b.sizes = append(b.sizes, len(line.Message))
+	b.w.Write(data)
+	return b.w.WriteByte('\n')
+}
+
+func (b *fileBuffer) pop() int {
+	size := b.sizes[b.skip]
+	b.skip++
+	return size
+}
+
+func (b *fileBuffer) len() int {
+	return len(b.sizes) - b.skip
+}
+
+func (b *fileBuffer) lines() ([]*drone.Line, error) {
+	if err := b.w.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := b.file.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	lines := make([]*drone.Line, 0, b.len())
+	scanner := bufio.NewScanner(b.file)
+	scanner.Buffer(nil, 1024*1024*64)
+	for i := 0; scanner.Scan(); i++ {
+		if i < b.skip {
+			continue
+		}
+		data := scanner.Bytes()
+		if b.key != nil {
+			sealed, err := base64.StdEncoding.DecodeString(string(data))
+			if err != nil {
+				return nil, err
+			}
+			if data, err = b.key.Open(sealed); err != nil {
+				return nil, err
+			}
+		}
+		line := new(drone.Line)
+		if err := json.Unmarshal(data, line); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+func (b *fileBuffer) close() error {
+	b.file.Close()
+	return os.Remove(b.file.Name())
+}
@@ -0,0 +1,313 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package livelog provides a Writer that streams step output
+// to the server in batches, using a dedicated goroutine per
+// step, so that slow uploads do not block the step.
+package livelog
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/seal"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+	"github.com/drone/runner-go/pipeline"
+)
+
+// default configuration values.
+const (
+	defaultLimit       = 5242880 // 5MB
+	defaultBuffer      = 1048576 // 1MB
+	defaultBatchSize   = 500
+	defaultMinInterval = 100 * time.Millisecond
+	defaultMaxInterval = 5 * time.Second
+)
+
+// Config configures the Writer.
+type Config struct {
+	// Limit is the maximum log size in bytes. If the limit is
+	// exceeded, live streaming stops and the oldest lines are
+	// discarded from the uploaded log.
+	Limit int
+
+	// Buffer is the maximum size in bytes of lines pending
+	// upload. If the buffer is full, the oldest pending lines
+	// are discarded from the live stream, but are included in
+	// the uploaded log.
+	Buffer int
+
+	// BatchSize is the maximum number of lines uploaded in a
+	// single batch. A full batch is uploaded immediately.
+	BatchSize int
+
+	// MinInterval and MaxInterval bound the flush interval,
+	// which adapts to the upload latency.
+	MinInterval time.Duration
+	MaxInterval time.Duration
+
+	// Spool optionally stores the log history in temporary
+	// files in the directory, instead of in memory. If the
+	// directory is empty, the system temporary directory is
+	// used.
+	Spool bool
+	Dir   string
+
+	// Key optionally encrypts the spooled log history at rest.
+	Key *seal.Key
+}
+
+// Writer is an io.Writer that streams logs to the server.
+type Writer struct {
+	client client.Client
+	config Config
+	id     int64
+
+	mu      sync.Mutex
+	now     time.Time
+	num     int
+	size    int
+	buffer  int
+	dropped int
+	stopped bool
+	pending []*drone.Line
+	history buffer
+
+	once   sync.Once
+	ready  chan struct{}
+	full   chan struct{}
+	closed chan struct{}
+	exited chan struct{}
+}
+
+// New returns a new Writer that streams logs for the step.
+func New(client client.Client, id int64, config Config) *Writer {
+	if config.Limit <= 0 {
+		config.Limit = defaultLimit
+	}
+	if config.Buffer <= 0 {
+		config.Buffer = defaultBuffer
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaultBatchSize
+	}
+	if config.MinInterval <= 0 {
+		config.MinInterval = defaultMinInterval
+	}
+	if config.MaxInterval < config.MinInterval {
+		config.MaxInterval = defaultMaxInterval
+	}
+	var history buffer = new(memBuffer)
+	if config.Spool {
+		// if the spool file cannot be created the history
+		// is stored in memory.
+		if b, err := newFileBuffer(config.Dir, config.Key); err == nil {
+			history = b
+		}
+	}
+	w := &Writer{
+		client:  client,
+		config:  config,
+		id:      id,
+		history: history,
+		now:     time.Now(),
+		ready:   make(chan struct{}, 1),
+		full:    make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write buffers the lines for upload. Write never blocks on
+// the upload, so that a slow server does not stall the step.
+func (w *Writer) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	for _, part := range split(p) {
+		line := &drone.Line{
+			Number:    w.num,
+			Message:   part,
+			Timestamp: int64(time.Since(w.now).Seconds()),
+		}
+		w.num++
+
+		// if the log limit is exceeded, live streaming stops
+		// and the oldest lines are discarded.
+		for w.size+len(part) > w.config.Limit && w.history.len() != 0 {
+			w.stopped = true
+			w.size -= w.history.pop()
+		}
+		w.size += len(part)
+		w.history.push(line)
+
+		if w.stopped {
+			continue
+		}
+
+		// if the buffer is full, the oldest pending lines are
+		// discarded from the live stream.
+		w.pending = append(w.pending, line)
+		w.buffer += len(part)
+		for w.buffer > w.config.Buffer && len(w.pending) > 1 {
+			w.buffer -= len(w.pending[0].Message)
+			w.pending = w.pending[1:]
+			w.dropped++
+		}
+	}
+	full := len(w.pending) >= w.config.BatchSize
+	w.mu.Unlock()
+
+	notify(w.ready)
+	if full {
+		notify(w.full)
+	}
+	return len(p), nil
+}
+
+// Close flushes the pending lines and uploads the full log to
+// the server.
+func (w *Writer) Close() error {
+	w.once.Do(func() {
+		close(w.closed)
+	})
+	<-w.exited
+	w.flush()
+	w.mu.Lock()
+	lines, err := w.history.lines()
+	w.history.close()
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return w.client.Upload(context.Background(), w.id, lines)
+}
+
+// Dropped returns the number of lines discarded from the live
+// stream because the buffer was full.
+func (w *Writer) Dropped() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dropped
+}
+
+// run uploads the pending lines in batches until the writer is
+// closed. The flush interval adapts to the upload latency, so
+// that slow servers receive fewer, larger batches.
+func (w *Writer) run() {
+	defer close(w.exited)
+	interval := w.config.MinInterval
+	for {
+		select {
+		case <-w.closed:
+			return
+		case <-w.ready:
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-w.closed:
+			timer.Stop()
+			return
+		case <-w.full:
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		start := time.Now()
+		err := w.flush()
+		interval = w.adapt(interval, time.Since(start), err)
+	}
+}
+
+// adapt returns the next flush interval. The interval backs
+// off exponentially on error, and otherwise tracks twice the
+// upload latency.
+func (w *Writer) adapt(interval, latency time.Duration, err error) time.Duration {
+	next := latency * 2
+	if err != nil {
+		next = interval * 2
+	}
+	if next < w.config.MinInterval {
+		next = w.config.MinInterval
+	}
+	if next > w.config.MaxInterval {
+		next = w.config.MaxInterval
+	}
+	return next
+}
+
+// flush uploads the pending lines in batches. We intentionally
+// ignore errors beyond adapting the flush interval, since live
+// logs are ephemeral and the full log is uploaded on close.
+func (w *Writer) flush() error {
+	for {
+		w.mu.Lock()
+		n := len(w.pending)
+		if n > w.config.BatchSize {
+			n = w.config.BatchSize
+		}
+		lines := append(w.pending[:0:0], w.pending[:n]...)
+		w.pending = w.pending[n:]
+		for _, line := range lines {
+			w.buffer -= len(line.Message)
+		}
+		w.mu.Unlock()
+
+		if len(lines) == 0 {
+			return nil
+		}
+		if err := w.client.Batch(context.Background(), w.id, lines); err != nil {
+			return err
+		}
+	}
+}
+
+// helper function sends a non-blocking notification.
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// helper function splits the output into lines, since output
+// may be buffered and contain multiple lines.
+func split(p []byte) []string {
+	s := string(p)
+	if !strings.Contains(strings.TrimSuffix(s, "\n"), "\n") {
+		return []string{s}
+	}
+	v := strings.SplitAfter(s, "\n")
+	if v[len(v)-1] == "" {
+		v = v[:len(v)-1]
+	}
+	return v
+}
+
+var _ pipeline.Streamer = (*Streamer)(nil)
+
+// Streamer implements a pipeline streamer that streams step
+// logs to the server using a batched Writer.
+type Streamer struct {
+	client client.Client
+	config Config
+}
+
+// NewStreamer returns a new Streamer.
+func NewStreamer(client client.Client, config Config) *Streamer {
+	return &Streamer{client: client, config: config}
+}
+
+// Stream returns an io.WriteCloser to stream the stdout and
+// stderr of the pipeline step to the server.
+func (s *Streamer) Stream(ctx context.Context, state *pipeline.State, name string) io.WriteCloser {
+	src := state.Find(name)
+	return New(s.client, src.ID, s.config)
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package livelog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/seal"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+func TestWriter(t *testing.T) {
+	c := &fakeClient{}
+	w := New(c, 1, Config{BatchSize: 2, MinInterval: time.Millisecond})
+	w.Write([]byte("hello\nworld\n"))
+	w.Write([]byte("!\n"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.streamed(); got != 3 {
+		t.Errorf("Want 3 lines streamed, got %d", got)
+	}
+	for _, batch := range c.batches {
+		if len(batch) > 2 {
+			t.Errorf("Want batches limited to 2 lines, got %d", len(batch))
+		}
+	}
+	if len(c.upload) != 3 {
+		t.Errorf("Want 3 lines uploaded, got %d", len(c.upload))
+	}
+}
+
+// this test verifies that a slow server does not block the
+// writer, and that pending lines are bounded.
+func TestWriter_Backpressure(t *testing.T) {
+	c := &fakeClient{block: make(chan struct{})}
+	w := New(c, 1, Config{Buffer: 100, MinInterval: time.Millisecond})
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(w, "line %03d\n", i)
+	}
+	w.mu.Lock()
+	buffer := w.buffer
+	w.mu.Unlock()
+	if buffer > 100 {
+		t.Errorf("Want pending lines bounded to 100 bytes, got %d", buffer)
+	}
+	if w.Dropped() == 0 {
+		t.Errorf("Want pending lines dropped when buffer is full")
+	}
+	close(c.block)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.upload) != 1000 {
+		t.Errorf("Want all lines uploaded, got %d", len(c.upload))
+	}
+}
+
+func TestWriter_Limit(t *testing.T) {
+	c := &fakeClient{}
+	w := New(c, 1, Config{Limit: 10})
+	w.Write([]byte("hello\n"))
+	w.Write([]byte("world\n"))
+	w.Close()
+	if len(c.upload) != 1 || c.upload[0].Message != "world\n" {
+		t.Errorf("Want oldest lines discarded when limit exceeded")
+	}
+}
+
+// this test verifies the log history is spooled to a file,
+// and the file is removed once the log is uploaded.
+func TestWriter_Spool(t *testing.T) {
+	dir := t.TempDir()
+	c := &fakeClient{}
+	w := New(c, 1, Config{Limit: 12, Spool: true, Dir: dir})
+	if _, ok := w.history.(*fileBuffer); !ok {
+		t.Fatalf("Want log history spooled to file")
+	}
+	w.Write([]byte("hello\nworld\n!\n"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.upload) != 2 || c.upload[0].Message != "world\n" || c.upload[1].Number != 2 {
+		t.Errorf("Want oldest lines discarded when limit exceeded, got %v", c.upload)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Want spool file removed after upload")
+	}
+}
+
+// this test verifies the spooled log history is encrypted at
+// rest when a key is configured.
+func TestWriter_SpoolEncrypted(t *testing.T) {
+	key, _ := seal.New(bytes.Repeat([]byte{1}, seal.KeySize))
+	dir := t.TempDir()
+	c := &fakeClient{}
+	w := New(c, 1, Config{Spool: true, Dir: dir, Key: key})
+	w.Write([]byte("correct horse battery staple\n"))
+
+	w.mu.Lock()
+	buf := w.history.(*fileBuffer)
+	buf.w.Flush()
+	data, _ := ioutil.ReadFile(buf.file.Name())
+	w.mu.Unlock()
+	if bytes.Contains(data, []byte("correct horse")) {
+		t.Errorf("Want spooled log history encrypted at rest")
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.upload) != 1 || c.upload[0].Message != "correct horse battery staple\n" {
+		t.Errorf("Want decrypted log history uploaded, got %v", c.upload)
+	}
+}
+
+func TestAdapt(t *testing.T) {
+	w := &Writer{config: Config{MinInterval: time.Second, MaxInterval: 10 * time.Second}}
+	if got := w.adapt(time.Second, time.Millisecond, nil); got != time.Second {
+		t.Errorf("Want minimum interval, got %s", got)
+	}
+	if got := w.adapt(time.Second, 3*time.Second, nil); got != 6*time.Second {
+		t.Errorf("Want interval adapted to latency, got %s", got)
+	}
+	if got := w.adapt(8*time.Second, time.Second, fmt.Errorf("timeout")); got != 10*time.Second {
+		t.Errorf("Want maximum interval on error, got %s", got)
+	}
+}
+
+type fakeClient struct {
+	client.Client
+	sync.Mutex
+	block   chan struct{}
+	batches [][]*drone.Line
+	upload  []*drone.Line
+}
+
+func (c *fakeClient) Batch(ctx context.Context, step int64, lines []*drone.Line) error {
+	if c.block != nil {
+		<-c.block
+	}
+	c.Lock()
+	c.batches = append(c.batches, lines)
+	c.Unlock()
+	return nil
+}
+
+func (c *fakeClient) Upload(ctx context.Context, step int64, lines []*drone.Line) error {
+	c.upload = lines
+	return nil
+}
+
+func (c *fakeClient) streamed() int {
+	c.Lock()
+	defer c.Unlock()
+	var n int
+	for _, batch := range c.batches {
+		n += len(batch)
+	}
+	return n
+}
+
+func TestSplit(t *testing.T) {
+	got := split([]byte("hello\nworld\n"))
+	if len(got) != 2 || got[0] != "hello\n" || got[1] != "world\n" {
+		t.Errorf("Unexpected lines %q", got)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package machine gathers facts about the host machine.
+package machine
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// Facts describes the host machine.
+type Facts struct {
+	Hostname      string
+	OSVersion     string
+	KernelVersion string
+	CPUCount      int
+	MemoryMB      int64
+	Boot          time.Time
+}
+
+// Gather gathers facts about the host machine. Facts that
+// cannot be determined are left empty.
+func Gather() *Facts {
+	hostname, _ := os.Hostname()
+	return &Facts{
+		Hostname:      hostname,
+		OSVersion:     osVersion(),
+		KernelVersion: kernelVersion(),
+		CPUCount:      runtime.NumCPU(),
+		MemoryMB:      memory() / 1024 / 1024,
+		Boot:          boot(),
+	}
+}
+
+// Environ returns the host machine facts as environment
+// variables. The uptime is calculated when invoked.
+func (f *Facts) Environ() map[string]string {
+	envs := map[string]string{
+		"DRONE_MACHINE_CPU_COUNT": strconv.Itoa(f.CPUCount),
+	}
+	if f.Hostname != "" {
+		envs["DRONE_MACHINE_HOSTNAME"] = f.Hostname
+	}
+	if f.OSVersion != "" {
+		envs["DRONE_MACHINE_OS_VERSION"] = f.OSVersion
+	}
+	if f.KernelVersion != "" {
+		envs["DRONE_MACHINE_KERNEL_VERSION"] = f.KernelVersion
+	}
+	if f.MemoryMB != 0 {
+		envs["DRONE_MACHINE_MEMORY_MB"] = strconv.FormatInt(f.MemoryMB, 10)
+	}
+	if !f.Boot.IsZero() {
+		uptime := int64(time.Since(f.Boot) / time.Second)
+		envs["DRONE_MACHINE_UPTIME"] = strconv.FormatInt(uptime, 10)
+	}
+	return envs
+}
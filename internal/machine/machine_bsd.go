@@ -0,0 +1,45 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build freebsd openbsd netbsd dragonfly
+
+package machine
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// helper function returns the kernel release.
+func osVersion() string {
+	release, _ := unix.Sysctl("kern.osrelease")
+	return release
+}
+
+// helper function returns the kernel release, which is also
+// the operating system release.
+func kernelVersion() string {
+	return osVersion()
+}
+
+// helper function returns the total memory in bytes. OpenBSD
+// and NetBSD report memory larger than 2GB in hw.physmem64.
+func memory() int64 {
+	for _, name := range []string{"hw.physmem64", "hw.physmem"} {
+		if n, err := unix.SysctlUint64(name); err == nil {
+			return int64(n)
+		}
+	}
+	return 0
+}
+
+// helper function returns the boot time.
+func boot() time.Time {
+	tv, err := unix.SysctlTimeval("kern.boottime")
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(tv.Unix())
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build darwin
+
+package machine
+
+import (
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// helper function returns the macOS product version.
+func osVersion() string {
+	out, _ := exec.Command("sw_vers", "-productVersion").Output()
+	return strings.TrimSpace(string(out))
+}
+
+// helper function returns the darwin kernel release.
+func kernelVersion() string {
+	out, _ := exec.Command("uname", "-r").Output()
+	return strings.TrimSpace(string(out))
+}
+
+// helper function returns the total memory in bytes.
+func memory() int64 {
+	out, _ := exec.Command("sysctl", "-n", "hw.memsize").Output()
+	n, _ := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	return n
+}
+
+var bootRE = regexp.MustCompile(`sec = (\d+)`)
+
+// helper function returns the boot time.
+func boot() time.Time {
+	out, _ := exec.Command("sysctl", "-n", "kern.boottime").Output()
+	match := bootRE.FindStringSubmatch(string(out))
+	if len(match) != 2 {
+		return time.Time{}
+	}
+	secs, _ := strconv.ParseInt(match[1], 10, 64)
+	return time.Unix(secs, 0)
+}
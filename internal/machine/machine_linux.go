@@ -0,0 +1,82 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package machine
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// helper function returns the distribution version from the
+// os-release file (e.g. 22.04).
+func osVersion() string {
+	for _, path := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		if raw, err := ioutil.ReadFile(path); err == nil {
+			return osRelease(string(raw), "VERSION_ID")
+		}
+	}
+	return ""
+}
+
+// helper function returns the kernel release.
+func kernelVersion() string {
+	raw, _ := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	return strings.TrimSpace(string(raw))
+}
+
+// helper function returns the unquoted value of the key in
+// the os-release file.
+func osRelease(raw, key string) string {
+	for _, line := range strings.Split(raw, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) != 2 || parts[0] != key {
+			continue
+		}
+		if s, err := strconv.Unquote(parts[1]); err == nil {
+			return s
+		}
+		return strings.Trim(parts[1], `"'`)
+	}
+	return ""
+}
+
+// helper function returns the total memory in bytes.
+func memory() int64 {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kb, _ := strconv.ParseInt(fields[1], 10, 64)
+		return kb * 1024
+	}
+	return 0
+}
+
+// helper function returns the boot time.
+func boot() time.Time {
+	raw, _ := ioutil.ReadFile("/proc/uptime")
+	fields := strings.Fields(string(raw))
+	if len(fields) == 0 {
+		return time.Time{}
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Now().Add(-time.Duration(secs * float64(time.Second)))
+}
@@ -0,0 +1,26 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package machine
+
+import "testing"
+
+func TestOSRelease(t *testing.T) {
+	raw := `NAME="Ubuntu"
+VERSION="22.04.3 LTS (Jammy Jellyfish)"
+ID=ubuntu
+VERSION_ID="22.04"
+`
+	if got, want := osRelease(raw, "VERSION_ID"), "22.04"; got != want {
+		t.Errorf("Want version %q, got %q", want, got)
+	}
+	if got, want := osRelease(raw, "ID"), "ubuntu"; got != want {
+		t.Errorf("Want id %q, got %q", want, got)
+	}
+	if got := osRelease(raw, "BUILD_ID"); got != "" {
+		t.Errorf("Want empty value for missing key, got %q", got)
+	}
+}
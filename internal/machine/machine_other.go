@@ -0,0 +1,30 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux,!darwin,!windows,!freebsd,!openbsd,!netbsd,!dragonfly,!solaris
+
+package machine
+
+import (
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// helper function returns the kernel release.
+func osVersion() string {
+	out, _ := exec.Command("uname", "-r").Output()
+	return strings.TrimSpace(string(out))
+}
+
+// helper function returns the kernel release.
+func kernelVersion() string {
+	return osVersion()
+}
+
+// helper function returns the total memory in bytes.
+func memory() int64 { return 0 }
+
+// helper function returns the boot time.
+func boot() time.Time { return time.Time{} }
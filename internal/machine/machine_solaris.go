@@ -0,0 +1,46 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build solaris
+
+package machine
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// helper function returns the kernel version, which identifies
+// the illumos distribution release (e.g. omnios-r151046).
+func osVersion() string {
+	out, _ := exec.Command("uname", "-v").Output()
+	return strings.TrimSpace(string(out))
+}
+
+// helper function returns the kernel release (e.g. 5.11).
+func kernelVersion() string {
+	out, _ := exec.Command("uname", "-r").Output()
+	return strings.TrimSpace(string(out))
+}
+
+// helper function returns the total memory in bytes. The
+// system configuration reports the memory in megabytes.
+func memory() int64 {
+	out, _ := exec.Command("/usr/sbin/prtconf", "-m").Output()
+	n, _ := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	return n * 1024 * 1024
+}
+
+// helper function returns the boot time.
+func boot() time.Time {
+	out, _ := exec.Command("kstat", "-p", "unix:0:system_misc:boot_time").Output()
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return time.Time{}
+	}
+	secs, _ := strconv.ParseInt(fields[1], 10, 64)
+	return time.Unix(secs, 0)
+}
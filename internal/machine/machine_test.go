@@ -0,0 +1,51 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package machine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEnviron(t *testing.T) {
+	facts := &Facts{
+		Hostname:      "runner-1",
+		OSVersion:     "22.04",
+		KernelVersion: "5.15.0",
+		CPUCount:      4,
+		MemoryMB:      8192,
+		Boot:          time.Now().Add(-time.Hour),
+	}
+	want := map[string]string{
+		"DRONE_MACHINE_HOSTNAME":       "runner-1",
+		"DRONE_MACHINE_OS_VERSION":     "22.04",
+		"DRONE_MACHINE_KERNEL_VERSION": "5.15.0",
+		"DRONE_MACHINE_CPU_COUNT":      "4",
+		"DRONE_MACHINE_MEMORY_MB":      "8192",
+		"DRONE_MACHINE_UPTIME":         "3600",
+	}
+	if diff := cmp.Diff(want, facts.Environ()); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func TestEnviron_Unknown(t *testing.T) {
+	facts := &Facts{CPUCount: 1}
+	want := map[string]string{
+		"DRONE_MACHINE_CPU_COUNT": "1",
+	}
+	if diff := cmp.Diff(want, facts.Environ()); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func TestGather(t *testing.T) {
+	facts := Gather()
+	if facts.CPUCount == 0 {
+		t.Errorf("Expect cpu count gathered")
+	}
+}
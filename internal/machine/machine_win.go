@@ -0,0 +1,65 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build windows
+
+package machine
+
+import (
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// helper function returns the windows version.
+func osVersion() string {
+	out, _ := exec.Command("cmd", "/c", "ver").Output()
+	return strings.TrimSpace(string(out))
+}
+
+// helper function returns the kernel release, which is not
+// reported separately from the windows version.
+func kernelVersion() string {
+	return ""
+}
+
+type memoryStatusEx struct {
+	Length               uint32
+	MemoryLoad           uint32
+	TotalPhys            uint64
+	AvailPhys            uint64
+	TotalPageFile        uint64
+	AvailPageFile        uint64
+	TotalVirtual         uint64
+	AvailVirtual         uint64
+	AvailExtendedVirtual uint64
+}
+
+var (
+	kernel32                 = syscall.NewLazyDLL("kernel32.dll")
+	procGlobalMemoryStatusEx = kernel32.NewProc("GlobalMemoryStatusEx")
+	procGetTickCount64       = kernel32.NewProc("GetTickCount64")
+)
+
+// helper function returns the total memory in bytes.
+func memory() int64 {
+	var status memoryStatusEx
+	status.Length = uint32(unsafe.Sizeof(status))
+	ret, _, _ := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status)))
+	if ret == 0 {
+		return 0
+	}
+	return int64(status.TotalPhys)
+}
+
+// helper function returns the boot time.
+func boot() time.Time {
+	ms, _, _ := procGetTickCount64.Call()
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-time.Duration(ms) * time.Millisecond)
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package machine
+
+import (
+	"runtime"
+	"sort"
+	"time"
+)
+
+// Usage describes the current resource usage of the host
+// machine. Usage that cannot be determined is left empty.
+type Usage struct {
+	CPUCount    int     `json:"cpu_count"`
+	CPUPercent  float64 `json:"cpu_percent"`
+	MemoryTotal int64   `json:"memory_total"`
+	MemoryUsed  int64   `json:"memory_used"`
+	Disks       []*Disk `json:"disks,omitempty"`
+}
+
+// Disk describes the usage of the file system that contains
+// the path.
+type Disk struct {
+	Path  string `json:"path"`
+	Total int64  `json:"total"`
+	Used  int64  `json:"used"`
+}
+
+// Process describes a process and its child processes.
+type Process struct {
+	PID      int        `json:"pid"`
+	PPID     int        `json:"ppid"`
+	Command  string     `json:"command"`
+	CPUTime  float64    `json:"cpu_time"`
+	Memory   int64      `json:"memory"`
+	Children []*Process `json:"children,omitempty"`
+}
+
+// Sample samples the host cpu usage over the interval, and
+// returns the resource usage, including the disk usage of the
+// file systems that contain the paths.
+func Sample(interval time.Duration, paths ...string) *Usage {
+	usage := &Usage{
+		CPUCount:   runtime.NumCPU(),
+		CPUPercent: cpuPercent(interval),
+	}
+	usage.MemoryTotal, usage.MemoryUsed = memoryUsage()
+	for _, path := range paths {
+		total, used, err := diskUsage(path)
+		if err != nil {
+			continue
+		}
+		usage.Disks = append(usage.Disks, &Disk{
+			Path:  path,
+			Total: total,
+			Used:  used,
+		})
+	}
+	return usage
+}
+
+// Tree returns the process tree rooted at the process id, or
+// nil if the process does not exist, or the process table
+// cannot be read on this platform.
+func Tree(pid int) *Process {
+	return tree(processes(), pid)
+}
+
+// helper function builds the process tree rooted at the
+// process id from the process table.
+func tree(procs []*Process, pid int) *Process {
+	children := map[int][]*Process{}
+	var root *Process
+	for _, proc := range procs {
+		if proc.PID == pid {
+			root = proc
+		} else {
+			children[proc.PPID] = append(children[proc.PPID], proc)
+		}
+	}
+	if root == nil {
+		return nil
+	}
+	var walk func(*Process)
+	walk = func(parent *Process) {
+		parent.Children = children[parent.PID]
+		sort.Slice(parent.Children, func(i, j int) bool {
+			return parent.Children[i].PID < parent.Children[j].PID
+		})
+		for _, child := range parent.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+	return root
+}
+
+// Total returns the cpu time and memory of the process and its
+// child processes.
+func (p *Process) Total() (cpu float64, memory int64) {
+	cpu, memory = p.CPUTime, p.Memory
+	for _, child := range p.Children {
+		c, m := child.Total()
+		cpu += c
+		memory += m
+	}
+	return
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package machine
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// clock ticks per second, used to report process cpu time.
+// The value is fixed at 100 on all supported architectures.
+const clockTicks = 100
+
+// helper function returns the cpu usage percentage over the
+// interval.
+func cpuPercent(interval time.Duration) float64 {
+	idle1, total1 := cpuTimes()
+	time.Sleep(interval)
+	idle2, total2 := cpuTimes()
+	if total2 <= total1 {
+		return 0
+	}
+	busy := float64((total2 - total1) - (idle2 - idle1))
+	return busy / float64(total2-total1) * 100
+}
+
+// helper function returns the idle and total cpu time.
+func cpuTimes() (idle, total uint64) {
+	raw, _ := ioutil.ReadFile("/proc/stat")
+	line := strings.SplitN(string(raw), "\n", 2)[0]
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0
+	}
+	for i, field := range fields[1:] {
+		n, _ := strconv.ParseUint(field, 10, 64)
+		total += n
+		// idle and iowait
+		if i == 3 || i == 4 {
+			idle += n
+		}
+	}
+	return idle, total
+}
+
+// helper function returns the total and used memory in bytes.
+func memoryUsage() (total, used int64) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	var available int64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, _ := strconv.ParseInt(fields[1], 10, 64)
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb * 1024
+		case "MemAvailable:":
+			available = kb * 1024
+		}
+	}
+	return total, total - available
+}
+
+// helper function returns the total and used disk space in
+// bytes of the file system that contains the path.
+func diskUsage(path string) (total, used int64, err error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+	total = int64(stat.Blocks) * int64(stat.Bsize)
+	used = total - int64(stat.Bfree)*int64(stat.Bsize)
+	return total, used, nil
+}
+
+// helper function returns the process table.
+func processes() []*Process {
+	paths, _ := filepath.Glob("/proc/[0-9]*/stat")
+	pagesize := int64(os.Getpagesize())
+	var procs []*Process
+	for _, path := range paths {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if proc := parseStat(string(raw), pagesize); proc != nil {
+			procs = append(procs, proc)
+		}
+	}
+	return procs
+}
+
+// helper function parses the /proc/[pid]/stat file. The command
+// is enclosed in parentheses, and may contain spaces.
+func parseStat(s string, pagesize int64) *Process {
+	open := strings.IndexByte(s, '(')
+	end := strings.LastIndexByte(s, ')')
+	if open == -1 || end < open {
+		return nil
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(s[:open]))
+	if err != nil {
+		return nil
+	}
+	// the fields following the command, starting with the
+	// process state (field 3).
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 22 {
+		return nil
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	rss, _ := strconv.ParseInt(fields[21], 10, 64)
+	return &Process{
+		PID:     pid,
+		PPID:    ppid,
+		Command: s[open+1 : end],
+		CPUTime: float64(utime+stime) / clockTicks,
+		Memory:  rss * pagesize,
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux,!windows
+
+package machine
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// helper function returns the cpu usage percentage, which
+// cannot be sampled on this platform.
+func cpuPercent(time.Duration) float64 { return 0 }
+
+// helper function returns the total memory in bytes. The used
+// memory cannot be determined on this platform.
+func memoryUsage() (total, used int64) {
+	return memory(), 0
+}
+
+// helper function returns the total and used disk space in
+// bytes of the file system that contains the path.
+func diskUsage(path string) (total, used int64, err error) {
+	out, err := exec.Command("df", "-Pk", path).Output()
+	if err != nil {
+		return 0, 0, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(fields) < 3 {
+		return 0, 0, nil
+	}
+	total, _ = strconv.ParseInt(fields[1], 10, 64)
+	used, _ = strconv.ParseInt(fields[2], 10, 64)
+	return total * 1024, used * 1024, nil
+}
+
+// helper function returns the process table.
+func processes() []*Process {
+	out, err := exec.Command("ps", "-axo", "pid=,ppid=,rss=,time=,comm=").Output()
+	if err != nil {
+		return nil
+	}
+	return parsePS(string(out))
+}
+
+// helper function parses the output of the ps command.
+func parsePS(s string) []*Process {
+	var procs []*Process
+	for _, line := range strings.Split(s, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		rss, _ := strconv.ParseInt(fields[2], 10, 64)
+		procs = append(procs, &Process{
+			PID:     pid,
+			PPID:    ppid,
+			Command: strings.Join(fields[4:], " "),
+			CPUTime: parseCPUTime(fields[3]),
+			Memory:  rss * 1024,
+		})
+	}
+	return procs
+}
+
+// helper function parses the cpu time in the [[dd-]hh:]mm:ss
+// format, where the seconds may include a fraction.
+func parseCPUTime(s string) float64 {
+	var secs float64
+	if i := strings.IndexByte(s, '-'); i != -1 {
+		days, _ := strconv.ParseFloat(s[:i], 64)
+		secs += days * 86400
+		s = s[i+1:]
+	}
+	parts := strings.Split(s, ":")
+	for i, part := range parts {
+		n, _ := strconv.ParseFloat(part, 64)
+		switch len(parts) - i {
+		case 3:
+			secs += n * 3600
+		case 2:
+			secs += n * 60
+		case 1:
+			secs += n
+		}
+	}
+	return secs
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package machine
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	procs := []*Process{
+		{PID: 1, PPID: 0, CPUTime: 1, Memory: 100},
+		{PID: 10, PPID: 1, CPUTime: 2, Memory: 200},
+		{PID: 12, PPID: 10, CPUTime: 3, Memory: 300},
+		{PID: 11, PPID: 10, CPUTime: 4, Memory: 400},
+		{PID: 20, PPID: 1, CPUTime: 5, Memory: 500},
+	}
+	root := tree(procs, 10)
+	if root == nil {
+		t.Fatalf("Want process tree")
+	}
+	if len(root.Children) != 2 || root.Children[0].PID != 11 || root.Children[1].PID != 12 {
+		t.Errorf("Want child processes sorted by pid")
+	}
+	if cpu, memory := root.Total(); cpu != 9 || memory != 900 {
+		t.Errorf("Want total cpu 9 and memory 900, got %v and %v", cpu, memory)
+	}
+	if tree(procs, 99) != nil {
+		t.Errorf("Want nil tree for unknown process")
+	}
+}
+
+func TestSample(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("skipping on non-linux platform")
+	}
+	usage := Sample(0, os.TempDir())
+	if usage.MemoryTotal == 0 || usage.MemoryUsed == 0 {
+		t.Errorf("Want memory usage")
+	}
+	if len(usage.Disks) != 1 || usage.Disks[0].Total == 0 {
+		t.Errorf("Want disk usage")
+	}
+	proc := Tree(os.Getpid())
+	if proc == nil || proc.Memory == 0 {
+		t.Errorf("Want process tree of the current process")
+	}
+}
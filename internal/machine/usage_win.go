@@ -0,0 +1,84 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build windows
+
+package machine
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	procGetSystemTimes      = kernel32.NewProc("GetSystemTimes")
+	procGetDiskFreeSpaceExW = kernel32.NewProc("GetDiskFreeSpaceExW")
+)
+
+// helper function returns the cpu usage percentage over the
+// interval.
+func cpuPercent(interval time.Duration) float64 {
+	idle1, total1 := cpuTimes()
+	time.Sleep(interval)
+	idle2, total2 := cpuTimes()
+	if total2 <= total1 {
+		return 0
+	}
+	busy := float64((total2 - total1) - (idle2 - idle1))
+	return busy / float64(total2-total1) * 100
+}
+
+// helper function returns the idle and total cpu time. The
+// kernel time includes the idle time.
+func cpuTimes() (idle, total uint64) {
+	var i, k, u syscall.Filetime
+	ret, _, _ := procGetSystemTimes.Call(
+		uintptr(unsafe.Pointer(&i)),
+		uintptr(unsafe.Pointer(&k)),
+		uintptr(unsafe.Pointer(&u)),
+	)
+	if ret == 0 {
+		return 0, 0
+	}
+	idle = uint64(i.HighDateTime)<<32 | uint64(i.LowDateTime)
+	kernel := uint64(k.HighDateTime)<<32 | uint64(k.LowDateTime)
+	user := uint64(u.HighDateTime)<<32 | uint64(u.LowDateTime)
+	return idle, kernel + user
+}
+
+// helper function returns the total and used memory in bytes.
+func memoryUsage() (total, used int64) {
+	var status memoryStatusEx
+	status.Length = uint32(unsafe.Sizeof(status))
+	ret, _, _ := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status)))
+	if ret == 0 {
+		return 0, 0
+	}
+	return int64(status.TotalPhys), int64(status.TotalPhys - status.AvailPhys)
+}
+
+// helper function returns the total and used disk space in
+// bytes of the volume that contains the path.
+func diskUsage(path string) (total, used int64, err error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var avail, size, free uint64
+	ret, _, err := procGetDiskFreeSpaceExW.Call(
+		uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&avail)),
+		uintptr(unsafe.Pointer(&size)),
+		uintptr(unsafe.Pointer(&free)),
+	)
+	if ret == 0 {
+		return 0, 0, err
+	}
+	return int64(size), int64(size - free), nil
+}
+
+// helper function returns the process table, which is not
+// supported on this platform.
+func processes() []*Process { return nil }
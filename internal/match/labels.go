@@ -0,0 +1,118 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package match
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Labels returns true if the labels satisfy the label selector.
+// Each selector value is an expression that the label value
+// must satisfy:
+//
+//	gpu: "true"              equal to the value
+//	region: in(eu-1,eu-2)    equal to one of the values
+//	region: notin(us-1)      missing, or not one of the values
+//	zone: exists()           defined with any value
+//	spot: !exists()          not defined
+//	arch: "!=arm64"          missing, or not equal to the value
+//	memory: ">=16"           a number compared to the value
+//
+// The expression may be written with the >, >=, < and <= numeric
+// comparisons. An error is returned if an expression is invalid.
+func Labels(selector, labels map[string]string) (bool, error) {
+	for key, expr := range selector {
+		value, ok := labels[key]
+		matched, err := matchLabel(strings.TrimSpace(expr), value, ok)
+		if err != nil {
+			return false, fmt.Errorf("label %s: %s", key, err)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// helper function returns true if the label value satisfies
+// the expression.
+func matchLabel(expr, value string, ok bool) (bool, error) {
+	switch {
+	case expr == "exists()":
+		return ok, nil
+	case expr == "!exists()":
+		return !ok, nil
+	case strings.HasPrefix(expr, "in("):
+		values, err := parseSet(expr, "in(")
+		return ok && contains(values, value), err
+	case strings.HasPrefix(expr, "notin("):
+		values, err := parseSet(expr, "notin(")
+		return !ok || !contains(values, value), err
+	case strings.HasPrefix(expr, "!="):
+		return !ok || value != strings.TrimSpace(expr[2:]), nil
+	case strings.HasPrefix(expr, ">="),
+		strings.HasPrefix(expr, "<="):
+		return compare(expr[:2], strings.TrimSpace(expr[2:]), value, ok)
+	case strings.HasPrefix(expr, ">"),
+		strings.HasPrefix(expr, "<"):
+		return compare(expr[:1], strings.TrimSpace(expr[1:]), value, ok)
+	default:
+		return ok && value == expr, nil
+	}
+}
+
+// helper function parses the comma-separated values of the set
+// expression.
+func parseSet(expr, prefix string) ([]string, error) {
+	if !strings.HasSuffix(expr, ")") {
+		return nil, fmt.Errorf("invalid expression %q", expr)
+	}
+	var values []string
+	for _, v := range strings.Split(expr[len(prefix):len(expr)-1], ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("invalid expression %q", expr)
+	}
+	return values, nil
+}
+
+// helper function returns the numeric comparison of the label
+// value to the expression value. A label value that is missing
+// or is not a number does not satisfy the comparison.
+func compare(op, want, value string, ok bool) (bool, error) {
+	b, err := strconv.ParseFloat(want, 64)
+	if err != nil {
+		return false, fmt.Errorf("invalid number %q", want)
+	}
+	a, err := strconv.ParseFloat(value, 64)
+	if !ok || err != nil {
+		return false, nil
+	}
+	switch op {
+	case ">":
+		return a > b, nil
+	case ">=":
+		return a >= b, nil
+	case "<":
+		return a < b, nil
+	default:
+		return a <= b, nil
+	}
+}
+
+// helper function returns true if the values contain v.
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package match
+
+import "testing"
+
+func TestLabels(t *testing.T) {
+	labels := map[string]string{
+		"gpu":    "true",
+		"region": "eu-1",
+		"memory": "32",
+	}
+	tests := []struct {
+		expr  string
+		key   string
+		match bool
+		err   bool
+	}{
+		{key: "gpu", expr: "true", match: true},
+		{key: "gpu", expr: "false", match: false},
+		{key: "region", expr: "in(eu-1, eu-2)", match: true},
+		{key: "region", expr: "in(us-1)", match: false},
+		{key: "region", expr: "notin(us-1)", match: true},
+		{key: "zone", expr: "notin(us-1)", match: true},
+		{key: "region", expr: "exists()", match: true},
+		{key: "zone", expr: "exists()", match: false},
+		{key: "zone", expr: "!exists()", match: true},
+		{key: "region", expr: "!=eu-1", match: false},
+		{key: "zone", expr: "!=eu-1", match: true},
+		{key: "memory", expr: ">=16", match: true},
+		{key: "memory", expr: "<16", match: false},
+		{key: "region", expr: ">16", match: false},
+		{key: "zone", expr: "", match: false},
+		{key: "region", expr: "in(eu-1", err: true},
+		{key: "region", expr: "in()", err: true},
+		{key: "memory", expr: ">=lots", err: true},
+	}
+	for _, test := range tests {
+		got, err := Labels(map[string]string{test.key: test.expr}, labels)
+		if test.err != (err != nil) {
+			t.Errorf("Unexpected error %v matching %s: %q", err, test.key, test.expr)
+		}
+		if got != test.match {
+			t.Errorf("Want match %v for %s: %q", test.match, test.key, test.expr)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package match
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/buildkite/yaml"
+	"github.com/drone/drone-go/drone"
+)
+
+// SecretRule restricts the builds that can resolve the secrets
+// matching the name pattern. Empty lists match all builds.
+type SecretRule struct {
+	Name     string   `yaml:"name"`
+	Events   []string `yaml:"events"`
+	Branches []string `yaml:"branches"`
+	Refs     []string `yaml:"refs"`
+	Repos    []string `yaml:"repos"`
+}
+
+// LoadSecretRules loads the secret rules from a yaml file.
+func LoadSecretRules(path string) ([]*SecretRule, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*SecretRule
+	if err := yaml.Unmarshal(raw, &rules); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, errors.New("invalid or missing secret rule name")
+		}
+		if _, err := filepath.Match(rule.Name, ""); err != nil {
+			return nil, fmt.Errorf("secret rule %q: invalid name pattern", rule.Name)
+		}
+	}
+	return rules, nil
+}
+
+// Secret returns true if the named secret can be resolved for
+// the repository and build. A secret must satisfy every rule
+// matching the secret name. The branch is matched against the
+// build target branch, and the ref against the build git
+// reference. Secrets that do not match a rule are always
+// available.
+func Secret(name string, repo *drone.Repo, build *drone.Build, rules []*SecretRule) bool {
+	for _, rule := range rules {
+		if ok, _ := filepath.Match(rule.Name, name); !ok {
+			continue
+		}
+		if !match(build.Event, rule.Events) ||
+			!match(build.Target, rule.Branches) ||
+			!match(build.Ref, rule.Refs) ||
+			!match(repo.Slug, rule.Repos) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package match
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestSecret(t *testing.T) {
+	rules := []*SecretRule{
+		{Name: "deploy_*", Events: []string{"tag"}, Refs: []string{"refs/tags/v*"}},
+		{Name: "deploy_*", Repos: []string{"octocat/*"}},
+		{Name: "npm_token", Events: []string{"push", "tag"}, Branches: []string{"main", "release/*"}},
+	}
+	tests := []struct {
+		name   string
+		repo   string
+		event  string
+		target string
+		ref    string
+		match  bool
+	}{
+		{name: "deploy_key", repo: "octocat/hello-world", event: "tag", ref: "refs/tags/v1.0.0", match: true},
+		{name: "deploy_key", repo: "octocat/hello-world", event: "tag", ref: "refs/tags/nightly", match: false},
+		{name: "deploy_key", repo: "octocat/hello-world", event: "push", ref: "refs/heads/main", match: false},
+		{name: "deploy_key", repo: "spaceghost/hello-world", event: "tag", ref: "refs/tags/v1.0.0", match: false},
+		{name: "npm_token", repo: "spaceghost/hello-world", event: "push", target: "release/1.0", match: true},
+		{name: "npm_token", repo: "spaceghost/hello-world", event: "pull_request", target: "main", match: false},
+		{name: "npm_token", repo: "spaceghost/hello-world", event: "push", target: "feature", match: false},
+		{name: "docker_password", repo: "spaceghost/hello-world", event: "pull_request", match: true},
+	}
+	for _, test := range tests {
+		repo := &drone.Repo{Slug: test.repo}
+		build := &drone.Build{Event: test.event, Target: test.target, Ref: test.ref}
+		if got := Secret(test.name, repo, build, rules); got != test.match {
+			t.Errorf("Want match %v for secret %s, event %s, branch %q, ref %q", test.match, test.name, test.event, test.target, test.ref)
+		}
+	}
+}
+
+func TestLoadSecretRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yml")
+	ioutil.WriteFile(path, []byte(`
+- name: deploy_*
+  events: [ tag ]
+  refs: [ refs/tags/v* ]
+`), 0600)
+	rules, err := LoadSecretRules(path)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := rules[0].Refs[0], "refs/tags/v*"; got != want {
+		t.Errorf("Want ref pattern %s, got %s", want, got)
+	}
+
+	ioutil.WriteFile(path, []byte(`- events: [ tag ]`), 0600)
+	if _, err := LoadSecretRules(path); err == nil {
+		t.Errorf("Expect error loading rule without name")
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package match
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// Target returns true if the named secret is available to the
+// build. The scopes map secret name patterns to a |-separated
+// list of deployment target patterns. A scoped secret is only
+// available to promote and rollback builds that deploy to a
+// matching target. Secrets that do not match a scope are always
+// available.
+func Target(name string, build *drone.Build, scopes map[string]string) bool {
+	for pattern, targets := range scopes {
+		if ok, _ := filepath.Match(pattern, name); !ok {
+			continue
+		}
+		if !isDeployment(build) {
+			return false
+		}
+		if match(build.Deploy, strings.Split(targets, "|")) == false {
+			return false
+		}
+	}
+	return true
+}
+
+// helper function returns true if the build is a deployment.
+func isDeployment(build *drone.Build) bool {
+	switch build.Event {
+	case drone.EventPromote, drone.EventRollback:
+		return build.Deploy != ""
+	default:
+		return false
+	}
+}
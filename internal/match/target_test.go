@@ -0,0 +1,40 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package match
+
+import (
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestTarget(t *testing.T) {
+	scopes := map[string]string{
+		"prod_*":        "production|production-*",
+		"staging_token": "staging",
+	}
+	tests := []struct {
+		name   string
+		event  string
+		deploy string
+		match  bool
+	}{
+		{name: "prod_token", event: "promote", deploy: "production", match: true},
+		{name: "prod_token", event: "rollback", deploy: "production-eu", match: true},
+		{name: "prod_token", event: "promote", deploy: "staging", match: false},
+		{name: "prod_token", event: "push", deploy: "production", match: false},
+		{name: "prod_token", event: "promote", deploy: "", match: false},
+		{name: "staging_token", event: "promote", deploy: "staging", match: true},
+		{name: "staging_token", event: "pull_request", match: false},
+		{name: "docker_password", event: "pull_request", match: true},
+		{name: "docker_password", event: "promote", deploy: "production", match: true},
+	}
+	for _, test := range tests {
+		build := &drone.Build{Event: test.event, Deploy: test.deploy}
+		if got := Target(test.name, build, scopes); got != test.match {
+			t.Errorf("Want match %v for secret %s, event %s, target %q", test.match, test.name, test.event, test.deploy)
+		}
+	}
+}
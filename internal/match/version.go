@@ -0,0 +1,113 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package match
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version returns true if the version satisfies the version
+// constraint. The constraint is a comma-separated list of
+// comparisons (e.g. ">=12, <14") that must all be satisfied.
+// Versions are compared by their numeric dot-separated parts,
+// ignoring any suffix (e.g. 5.15.0-91-generic is compared as
+// 5.15.0), so that macOS, Windows build numbers and Linux
+// kernel releases can be matched.
+//
+// Equality only compares the parts defined in the constraint,
+// so that =12 is satisfied by 12.6.1.
+func Version(constraint, version string) (bool, error) {
+	if strings.TrimSpace(constraint) == "" {
+		return true, nil
+	}
+	have, ok := parseVersion(version)
+	if !ok {
+		return false, fmt.Errorf("invalid version %q", version)
+	}
+	for _, expr := range strings.Split(constraint, ",") {
+		expr = strings.TrimSpace(expr)
+		op := strings.TrimRight(expr, "0123456789.")
+		op = strings.TrimSpace(op)
+		want, ok := parseVersion(strings.TrimSpace(expr[len(op):]))
+		if !ok {
+			return false, fmt.Errorf("invalid version constraint %q", expr)
+		}
+		var match bool
+		switch op {
+		case "", "=", "==":
+			match = compareVersion(have[:min(len(have), len(want))], want) == 0
+		case "!=":
+			match = compareVersion(have[:min(len(have), len(want))], want) != 0
+		case ">":
+			match = compareVersion(have, want) > 0
+		case ">=":
+			match = compareVersion(have, want) >= 0
+		case "<":
+			match = compareVersion(have, want) < 0
+		case "<=":
+			match = compareVersion(have, want) <= 0
+		default:
+			return false, fmt.Errorf("invalid version constraint %q", expr)
+		}
+		if !match {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// helper function parses the numeric parts of the version,
+// ignoring any non-numeric suffix.
+func parseVersion(s string) ([]int, bool) {
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexFunc(s, func(r rune) bool {
+		return r != '.' && (r < '0' || r > '9')
+	}); i != -1 {
+		s = s[:i]
+	}
+	s = strings.TrimSuffix(s, ".")
+	if s == "" {
+		return nil, false
+	}
+	var parts []int
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
+
+// helper function compares the versions, treating missing
+// parts as zero.
+func compareVersion(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
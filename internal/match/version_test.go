@@ -0,0 +1,39 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package match
+
+import "testing"
+
+func TestVersion(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		match      bool
+		err        bool
+	}{
+		{constraint: "", version: "", match: true},
+		{constraint: ">=12", version: "12.6.1", match: true},
+		{constraint: ">=12", version: "11.7", match: false},
+		{constraint: ">=12, <14", version: "13.0", match: true},
+		{constraint: ">=12, <14", version: "14.1", match: false},
+		{constraint: "12", version: "12.6.1", match: true},
+		{constraint: "=12.5", version: "12.6.1", match: false},
+		{constraint: "!=12", version: "13.1", match: true},
+		{constraint: ">=10.0.19045", version: "10.0.22631", match: true},
+		{constraint: "<5.15", version: "5.15.0-91-generic", match: false},
+		{constraint: "<=5.15", version: "5.15.0-91-generic", match: true},
+		{constraint: "~12", version: "12.0", err: true},
+		{constraint: ">=12", version: "unknown", err: true},
+	}
+	for _, test := range tests {
+		got, err := Version(test.constraint, test.version)
+		if test.err != (err != nil) {
+			t.Errorf("Unexpected error %v matching %q to %q", err, test.version, test.constraint)
+		}
+		if got != test.match {
+			t.Errorf("Want match %v for %q to %q", test.match, test.version, test.constraint)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Handler returns an http.Handler that writes the histograms
+// in the Prometheus text format. The OpenMetrics format, which
+// includes exemplars, is written if requested by the client.
+func Handler(histograms ...*Histogram) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		openmetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+		if openmetrics {
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		}
+		Write(w, openmetrics, histograms...)
+	})
+}
+
+// Write writes the histograms to w in the Prometheus text
+// format, or the OpenMetrics format if openmetrics is true.
+func Write(w io.Writer, openmetrics bool, histograms ...*Histogram) error {
+	buf := bufio.NewWriter(w)
+	for _, h := range histograms {
+		h.write(buf, openmetrics)
+	}
+	if openmetrics {
+		buf.WriteString("# EOF\n")
+	}
+	return buf.Flush()
+}
+
+func (h *Histogram) write(w *bufio.Writer, openmetrics bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", h.Name, h.Help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", h.Name)
+	if openmetrics && strings.HasSuffix(h.Name, "_seconds") {
+		fmt.Fprintf(w, "# UNIT %s seconds\n", h.Name)
+	}
+
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, n := range s.counts {
+			cumulative += n
+			le := "+Inf"
+			if i < len(h.Buckets) {
+				le = formatFloat(h.Buckets[i])
+			}
+			fmt.Fprintf(w, "%s_bucket{%s} %d", h.Name, h.labels(s.values, "le", le), cumulative)
+			if e := s.exemplars[i]; openmetrics && e != nil {
+				fmt.Fprintf(w, " # {%s} %s %s",
+					formatLabels(e.labels),
+					formatFloat(e.value),
+					strconv.FormatFloat(float64(e.time.UnixNano())/1e9, 'f', 3, 64),
+				)
+			}
+			w.WriteString("\n")
+		}
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", h.Name, h.labels(s.values), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", h.Name, h.labels(s.values), s.count)
+	}
+}
+
+// helper function formats the series labels, with optional
+// additional label pairs.
+func (h *Histogram) labels(values []string, extra ...string) string {
+	var pairs []string
+	for i, name := range h.Labels {
+		if i < len(values) {
+			pairs = append(pairs, name+"="+strconv.Quote(values[i]))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+"="+strconv.Quote(extra[i+1]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// helper function formats the labels sorted by name.
+func formatLabels(labels map[string]string) string {
+	var pairs []string
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+strconv.Quote(value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package metrics records histograms of pipeline queue and
+// execution durations.
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets defines the default histogram buckets, in
+// seconds.
+var DefaultBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+
+// Pipeline and maintenance task histograms.
+var (
+	QueueLatency = NewHistogram(
+		"drone_stage_queue_seconds",
+		"Time a stage waits in the queue before it is accepted.",
+		"repo",
+	)
+	CloneDuration = NewHistogram(
+		"drone_clone_duration_seconds",
+		"Time taken to clone the repository.",
+		"repo",
+	)
+	StageDuration = NewHistogram(
+		"drone_stage_duration_seconds",
+		"Time taken to execute a pipeline stage, by repository namespace.",
+		"namespace",
+	)
+	StepDuration = NewHistogram(
+		"drone_step_duration_seconds",
+		"Time taken to execute a pipeline step.",
+		"repo", "step",
+	)
+	StepFailures = NewHistogram(
+		"drone_step_failure_seconds",
+		"Time taken to execute a failed pipeline step, by failure reason.",
+		"repo", "step", "reason",
+	)
+	TaskDuration = NewHistogram(
+		"drone_task_duration_seconds",
+		"Time taken to run a scheduled maintenance task.",
+		"task", "status",
+	)
+)
+
+// Default provides the default pipeline histograms.
+var Default = []*Histogram{
+	QueueLatency,
+	CloneDuration,
+	StageDuration,
+	StepDuration,
+	StepFailures,
+	TaskDuration,
+}
+
+// Histogram records the distribution of observed durations,
+// partitioned by label values.
+type Histogram struct {
+	Name    string
+	Help    string
+	Labels  []string
+	Buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values    []string
+	counts    []uint64
+	count     uint64
+	sum       float64
+	exemplars []*exemplar
+}
+
+type exemplar struct {
+	labels map[string]string
+	value  float64
+	time   time.Time
+}
+
+// NewHistogram returns a new histogram with the default
+// buckets.
+func NewHistogram(name, help string, labels ...string) *Histogram {
+	return &Histogram{
+		Name:    name,
+		Help:    help,
+		Labels:  labels,
+		Buckets: DefaultBuckets,
+		series:  map[string]*series{},
+	}
+}
+
+// Observe records the duration for the label values. The
+// optional exemplar labels identify the observation, for
+// example the build that was observed.
+func (h *Histogram) Observe(d time.Duration, labels map[string]string, values ...string) {
+	value := d.Seconds()
+	key := strings.Join(values, "\x00")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &series{
+			values:    values,
+			counts:    make([]uint64, len(h.Buckets)+1),
+			exemplars: make([]*exemplar, len(h.Buckets)+1),
+		}
+		h.series[key] = s
+	}
+	i := sort.SearchFloat64s(h.Buckets, value)
+	s.counts[i]++
+	s.count++
+	s.sum += value
+	if len(labels) != 0 {
+		s.exemplars[i] = &exemplar{
+			labels: labels,
+			value:  value,
+			time:   time.Now(),
+		}
+	}
+}
+
+// Summary returns the total number of observations, the mean,
+// and the approximate 95th percentile across all series.
+func (h *Histogram) Summary() (count uint64, mean, p95 float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var sum float64
+	counts := make([]uint64, len(h.Buckets)+1)
+	for _, s := range h.series {
+		for i, n := range s.counts {
+			counts[i] += n
+		}
+		count += s.count
+		sum += s.sum
+	}
+	if count == 0 {
+		return 0, 0, 0
+	}
+	return count, sum / float64(count), quantile(0.95, h.Buckets, counts, count)
+}
+
+// helper function returns the approximate quantile using the
+// upper bound of the bucket that contains the quantile.
+func quantile(q float64, buckets []float64, counts []uint64, count uint64) float64 {
+	rank := q * float64(count)
+	var cumulative uint64
+	for i, n := range counts {
+		cumulative += n
+		if float64(cumulative) < rank {
+			continue
+		}
+		if i < len(buckets) {
+			return buckets[i]
+		}
+		break
+	}
+	if len(buckets) == 0 {
+		return 0
+	}
+	return buckets[len(buckets)-1]
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummary(t *testing.T) {
+	h := NewHistogram("test_seconds", "test", "repo")
+	for i := 0; i < 19; i++ {
+		h.Observe(2*time.Second, nil, "octocat/hello-world")
+	}
+	h.Observe(40*time.Second, nil, "octocat/spoon-knife")
+
+	count, mean, p95 := h.Summary()
+	if got, want := count, uint64(20); got != want {
+		t.Errorf("Want count %d, got %d", want, got)
+	}
+	if got, want := mean, 3.9; got != want {
+		t.Errorf("Want mean %v, got %v", want, got)
+	}
+	if got, want := p95, 5.0; got != want {
+		t.Errorf("Want p95 %v, got %v", want, got)
+	}
+}
+
+func TestSummary_Empty(t *testing.T) {
+	h := NewHistogram("test_seconds", "test")
+	if count, _, _ := h.Summary(); count != 0 {
+		t.Errorf("Expect empty summary")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	h := NewHistogram("test_seconds", "test", "repo", "step")
+	h.Buckets = []float64{1, 10}
+	h.Observe(5*time.Second, nil, "octocat/hello-world", "build")
+
+	var buf bytes.Buffer
+	Write(&buf, false, h)
+	want := `# HELP test_seconds test
+# TYPE test_seconds histogram
+test_seconds_bucket{repo="octocat/hello-world",step="build",le="1"} 0
+test_seconds_bucket{repo="octocat/hello-world",step="build",le="10"} 1
+test_seconds_bucket{repo="octocat/hello-world",step="build",le="+Inf"} 1
+test_seconds_sum{repo="octocat/hello-world",step="build"} 5
+test_seconds_count{repo="octocat/hello-world",step="build"} 1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Unexpected output\n%s", got)
+	}
+}
+
+func TestHandler_Exemplars(t *testing.T) {
+	h := NewHistogram("test_seconds", "test", "repo")
+	h.Observe(5*time.Second, map[string]string{"build_id": "1"}, "octocat/hello-world")
+
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	w := httptest.NewRecorder()
+	Handler(h).ServeHTTP(w, r)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `le="5"} 1 # {build_id="1"} 5 `) {
+		t.Errorf("Expect exemplar in openmetrics output\n%s", body)
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("Expect openmetrics output terminated with EOF")
+	}
+
+	r = httptest.NewRequest("GET", "/metrics", nil)
+	w = httptest.NewRecorder()
+	Handler(h).ServeHTTP(w, r)
+	if strings.Contains(w.Body.String(), "build_id") {
+		t.Errorf("Expect no exemplars in prometheus text output")
+	}
+}
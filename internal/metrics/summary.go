@@ -0,0 +1,41 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Summarize writes a summary of the histograms to the log at
+// the specified interval, for environments where the metrics
+// are not collected. It blocks until the context is cancelled.
+func Summarize(ctx context.Context, interval time.Duration, histograms ...*Histogram) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			logrus.WithFields(Fields(histograms...)).
+				Infoln("metrics summary")
+		}
+	}
+}
+
+// Fields returns a summary of the histograms as log fields.
+func Fields(histograms ...*Histogram) logrus.Fields {
+	fields := logrus.Fields{}
+	for _, h := range histograms {
+		count, mean, p95 := h.Summary()
+		fields[h.Name+".count"] = count
+		fields[h.Name+".mean"] = mean
+		fields[h.Name+".p95"] = p95
+	}
+	return fields
+}
@@ -0,0 +1,336 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package offline provides a client that buffers stage
+// results and logs while the server is unreachable, and
+// reconciles the buffered results when the server returns.
+package offline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/lease"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+	"github.com/drone/runner-go/logger"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Config configures the offline queue.
+type Config struct {
+	// Machine is the runner name used to ping the server.
+	Machine string
+
+	// Timeout is the duration a call may block before the
+	// server is considered unreachable.
+	Timeout time.Duration
+
+	// Interval is the interval at which the server is
+	// pinged while unreachable.
+	Interval time.Duration
+
+	// MaxLines limits the number of buffered log lines. The
+	// oldest streamed lines are dropped when exceeded. Full
+	// log uploads are never dropped.
+	MaxLines int
+}
+
+// Client is a client.Client that buffers stage updates, step
+// updates and logs while the server is unreachable, allowing
+// accepted stages to run to completion.
+type Client struct {
+	client.Client
+
+	config Config
+
+	mu      sync.Mutex
+	queue   []*entry
+	lines   int
+	running bool
+
+	// latest known versions, used to prevent optimistic lock
+	// errors when buffered updates are replayed.
+	stages map[int64]int64
+	steps  map[int64]int64
+}
+
+// New returns a new offline client that wraps the client.
+func New(base client.Client, config Config) *Client {
+	return &Client{
+		Client: base,
+		config: config,
+		stages: map[int64]int64{},
+		steps:  map[int64]int64{},
+	}
+}
+
+// Pending returns the number of buffered calls.
+func (c *Client) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.queue)
+}
+
+// Update updates the build stage. Stages with steps that are
+// not yet created by the server cannot be buffered, and block
+// until the server is reachable.
+func (c *Client) Update(ctx context.Context, stage *drone.Stage) error {
+	e := &entry{stage: stage}
+	for _, step := range stage.Steps {
+		if step.ID == 0 {
+			return c.wait(ctx, e)
+		}
+	}
+	return c.send(ctx, e)
+}
+
+// UpdateStep updates the build step.
+func (c *Client) UpdateStep(ctx context.Context, step *drone.Step) error {
+	return c.send(ctx, &entry{step: step})
+}
+
+// Batch batch writes logs to the build logs.
+func (c *Client) Batch(ctx context.Context, step int64, lines []*drone.Line) error {
+	return c.send(ctx, &entry{id: step, lines: lines})
+}
+
+// Upload uploads the full logs to the server.
+func (c *Client) Upload(ctx context.Context, step int64, lines []*drone.Line) error {
+	return c.send(ctx, &entry{id: step, lines: lines, upload: true})
+}
+
+// Renew renews the stage lease, if supported by the client.
+// The renewed stage version is used by buffered updates.
+func (c *Client) Renew(ctx context.Context, stage *drone.Stage) error {
+	err := lease.Renew(ctx, c.Client, stage)
+	if err == nil {
+		c.mu.Lock()
+		c.stages[stage.ID] = stage.Version
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// helper function sends the call to the server, or buffers
+// the call if the server is unreachable. Calls are buffered
+// while the queue is not empty to preserve ordering.
+func (c *Client) send(ctx context.Context, e *entry) error {
+	c.mu.Lock()
+	if len(c.queue) != 0 {
+		c.push(e.copy())
+		c.mu.Unlock()
+		return nil
+	}
+	c.mu.Unlock()
+
+	ctxtimeout, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+	err := c.call(ctxtimeout, e)
+	if err == nil || ctx.Err() != nil || !unreachable(err) {
+		return err
+	}
+
+	logger.FromContext(ctx).
+		WithError(err).
+		Warnln("server unreachable, buffering results")
+
+	c.mu.Lock()
+	c.push(e.copy())
+	c.mu.Unlock()
+	return nil
+}
+
+// helper function queues the call and blocks until the call
+// is replayed, or the context is cancelled.
+func (c *Client) wait(ctx context.Context, e *entry) error {
+	e.done = make(chan error, 1)
+	c.mu.Lock()
+	if len(c.queue) == 0 {
+		c.mu.Unlock()
+		return c.call(ctx, e)
+	}
+	c.push(e)
+	c.mu.Unlock()
+
+	select {
+	case err := <-e.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// helper function appends the entry to the queue and starts
+// the reconciler. The caller must hold the lock.
+func (c *Client) push(e *entry) {
+	c.queue = append(c.queue, e)
+	if !e.upload {
+		c.lines += len(e.lines)
+	}
+	// drop the oldest streamed lines when the buffer is full,
+	// excluding the head of the queue, which may be in-flight.
+	// the full logs are uploaded when the step completes.
+	for i := 1; c.config.MaxLines > 0 && c.lines > c.config.MaxLines && i < len(c.queue); {
+		if item := c.queue[i]; item.lines != nil && !item.upload {
+			c.lines -= len(item.lines)
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			continue
+		}
+		i++
+	}
+	if !c.running {
+		c.running = true
+		go c.reconcile()
+	}
+}
+
+// reconcile replays the buffered calls, in order, once the
+// server is reachable.
+func (c *Client) reconcile() {
+	log := logger.Default
+	for {
+		c.mu.Lock()
+		if len(c.queue) == 0 {
+			c.running = false
+			c.mu.Unlock()
+			log.Infoln("server reachable, buffered results reconciled")
+			return
+		}
+		e := c.queue[0]
+		c.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+		err := c.Client.Ping(ctx, c.config.Machine)
+		if err == nil {
+			err = c.call(ctx, e)
+		}
+		cancel()
+
+		if err != nil && unreachable(err) {
+			log.WithError(err).Debugln("server unreachable, retrying")
+			time.Sleep(c.config.Interval)
+			continue
+		}
+		if err != nil {
+			log.WithError(err).Warnln("cannot reconcile buffered result")
+		}
+
+		c.mu.Lock()
+		c.queue = c.queue[1:]
+		if !e.upload {
+			c.lines -= len(e.lines)
+		}
+		c.mu.Unlock()
+		if e.done != nil {
+			e.done <- err
+		}
+	}
+}
+
+// helper function invokes the call, using the latest known
+// versions of the stage and steps.
+func (c *Client) call(ctx context.Context, e *entry) error {
+	switch {
+	case e.stage != nil:
+		c.mu.Lock()
+		if v, ok := c.stages[e.stage.ID]; ok {
+			e.stage.Version = v
+		}
+		for _, step := range e.stage.Steps {
+			if v, ok := c.steps[step.ID]; ok {
+				step.Version = v
+			}
+		}
+		c.mu.Unlock()
+		err := c.Client.Update(ctx, e.stage)
+		if err == nil {
+			c.mu.Lock()
+			c.stages[e.stage.ID] = e.stage.Version
+			for _, step := range e.stage.Steps {
+				c.steps[step.ID] = step.Version
+			}
+			c.mu.Unlock()
+		}
+		return err
+	case e.step != nil:
+		c.mu.Lock()
+		if v, ok := c.steps[e.step.ID]; ok {
+			e.step.Version = v
+		}
+		c.mu.Unlock()
+		err := c.Client.UpdateStep(ctx, e.step)
+		if err == nil {
+			c.mu.Lock()
+			c.steps[e.step.ID] = e.step.Version
+			c.mu.Unlock()
+		}
+		return err
+	case e.upload:
+		return c.Client.Upload(ctx, e.id, e.lines)
+	default:
+		return c.Client.Batch(ctx, e.id, e.lines)
+	}
+}
+
+// entry is a buffered call.
+type entry struct {
+	stage  *drone.Stage
+	step   *drone.Step
+	id     int64
+	lines  []*drone.Line
+	upload bool
+	done   chan error
+}
+
+// copy returns a deep copy of the entry, since the caller
+// continues to modify the stage and step after the call.
+func (e *entry) copy() *entry {
+	dst := &entry{
+		id:     e.id,
+		upload: e.upload,
+		done:   e.done,
+	}
+	if e.lines != nil {
+		dst.lines = append([]*drone.Line{}, e.lines...)
+	}
+	if e.stage != nil {
+		dst.stage = new(drone.Stage)
+		deepcopy(e.stage, dst.stage)
+	}
+	if e.step != nil {
+		dst.step = new(drone.Step)
+		deepcopy(e.step, dst.step)
+	}
+	return dst
+}
+
+func deepcopy(src, dst interface{}) {
+	data, _ := json.Marshal(src)
+	json.Unmarshal(data, dst)
+}
+
+// helper function returns true if the error indicates the
+// server is unreachable, as opposed to rejecting the call.
+func unreachable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
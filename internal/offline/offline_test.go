@@ -0,0 +1,263 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package offline
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+)
+
+func TestOffline(t *testing.T) {
+	base := &fakeClient{}
+	c := New(base, Config{
+		Timeout:  time.Second,
+		Interval: time.Millisecond,
+	})
+
+	stage := &drone.Stage{ID: 1, Steps: []*drone.Step{{ID: 2}}}
+	if err := c.Update(context.Background(), stage); err != nil {
+		t.Fatal(err)
+	}
+
+	base.setDown(true)
+	step := &drone.Step{ID: 2, Status: drone.StatusRunning}
+	if err := c.UpdateStep(context.Background(), step); err != nil {
+		t.Errorf("Want step update buffered, got error %s", err)
+	}
+	lines := []*drone.Line{{Message: "hello"}}
+	if err := c.Batch(context.Background(), 2, lines); err != nil {
+		t.Errorf("Want logs buffered, got error %s", err)
+	}
+	step.Status = drone.StatusPassing
+	if err := c.UpdateStep(context.Background(), step); err != nil {
+		t.Errorf("Want step update buffered, got error %s", err)
+	}
+	if got, want := c.Pending(), 3; got != want {
+		t.Errorf("Want %d buffered calls, got %d", want, got)
+	}
+
+	base.setDown(false)
+	waitPending(t, c)
+
+	want := []string{"update:1", "step:2:running", "batch:2", "step:2:success"}
+	if got := base.history(); !equal(got, want) {
+		t.Errorf("Want calls replayed in order %v, got %v", want, got)
+	}
+
+	// the step version is incremented on each update, and the
+	// latest version is used for subsequent updates.
+	if err := c.UpdateStep(context.Background(), step); err != nil {
+		t.Errorf("Want no optimistic lock error, got %s", err)
+	}
+}
+
+func TestOffline_Renew(t *testing.T) {
+	base := &fakeClient{}
+	c := New(base, Config{Timeout: time.Second})
+
+	stage := &drone.Stage{ID: 1}
+	if err := c.Update(context.Background(), stage); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stage version is incremented by the lease renewal,
+	// and the renewed version is used for subsequent updates.
+	if err := c.Renew(context.Background(), &drone.Stage{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Update(context.Background(), stage); err != nil {
+		t.Errorf("Want no optimistic lock error, got %s", err)
+	}
+}
+
+func TestOffline_Rejected(t *testing.T) {
+	base := &fakeClient{err: errors.New("Not Found")}
+	c := New(base, Config{Timeout: time.Second})
+	if err := c.UpdateStep(context.Background(), &drone.Step{ID: 1}); err == nil {
+		t.Errorf("Want error returned when server rejects the call")
+	}
+	if c.Pending() != 0 {
+		t.Errorf("Want rejected call not buffered")
+	}
+}
+
+func TestOffline_MaxLines(t *testing.T) {
+	base := &fakeClient{}
+	base.setDown(true)
+	c := New(base, Config{
+		Timeout:  time.Millisecond,
+		Interval: time.Hour,
+		MaxLines: 2,
+	})
+	for i := 0; i < 3; i++ {
+		c.Batch(context.Background(), 1, []*drone.Line{{Number: i}})
+	}
+	c.Upload(context.Background(), 1, []*drone.Line{{}, {}, {}})
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if got, want := len(c.queue), 3; got != want {
+		t.Errorf("Want %d buffered calls, got %d", want, got)
+	}
+	if got := c.queue[1].lines[0].Number; got != 2 {
+		t.Errorf("Want oldest lines dropped, got line %d", got)
+	}
+	if !c.queue[2].upload {
+		t.Errorf("Want full log upload buffered")
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{context.DeadlineExceeded, true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{client.ErrOptimisticLock, false},
+		{errors.New("Not Found"), false},
+	}
+	for _, test := range tests {
+		if got := unreachable(test.err); got != test.want {
+			t.Errorf("Want unreachable %v for %q", test.want, test.err)
+		}
+	}
+}
+
+func waitPending(t *testing.T, c *Client) {
+	for i := 0; i < 1000; i++ {
+		if c.Pending() == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Want buffered calls reconciled")
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fakeClient simulates the server, incrementing versions on
+// update and rejecting stale versions.
+type fakeClient struct {
+	client.Client
+
+	sync.Mutex
+	down     bool
+	err      error
+	calls    []string
+	versions map[int64]int64
+	stages   map[int64]int64
+}
+
+func (c *fakeClient) setDown(down bool) {
+	c.Lock()
+	c.down = down
+	c.Unlock()
+}
+
+func (c *fakeClient) history() []string {
+	c.Lock()
+	defer c.Unlock()
+	return c.calls
+}
+
+func (c *fakeClient) check() error {
+	if c.err != nil {
+		return c.err
+	}
+	if c.down {
+		return &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	}
+	return nil
+}
+
+func (c *fakeClient) Ping(context.Context, string) error {
+	c.Lock()
+	defer c.Unlock()
+	return c.check()
+}
+
+func (c *fakeClient) Update(_ context.Context, stage *drone.Stage) error {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.stages == nil {
+		c.stages = map[int64]int64{}
+	}
+	if stage.Version != c.stages[stage.ID] {
+		return client.ErrOptimisticLock
+	}
+	c.calls = append(c.calls, "update:1")
+	stage.Version++
+	c.stages[stage.ID] = stage.Version
+	return nil
+}
+
+func (c *fakeClient) Renew(_ context.Context, stage *drone.Stage) error {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.stages == nil {
+		c.stages = map[int64]int64{}
+	}
+	c.stages[stage.ID]++
+	stage.Version = c.stages[stage.ID]
+	return nil
+}
+
+func (c *fakeClient) UpdateStep(_ context.Context, step *drone.Step) error {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.check(); err != nil {
+		return err
+	}
+	if c.versions == nil {
+		c.versions = map[int64]int64{}
+	}
+	if step.Version != c.versions[step.ID] {
+		return client.ErrOptimisticLock
+	}
+	c.versions[step.ID]++
+	step.Version++
+	c.calls = append(c.calls, "step:2:"+step.Status)
+	return nil
+}
+
+func (c *fakeClient) Batch(context.Context, int64, []*drone.Line) error {
+	c.Lock()
+	defer c.Unlock()
+	if err := c.check(); err != nil {
+		return err
+	}
+	c.calls = append(c.calls, "batch:2")
+	return nil
+}
+
+func (c *fakeClient) Upload(context.Context, int64, []*drone.Line) error {
+	c.Lock()
+	defer c.Unlock()
+	return c.check()
+}
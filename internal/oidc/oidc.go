@@ -0,0 +1,225 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package oidc provides keyless runner authentication. The
+// runner obtains a workload identity token from an oidc
+// provider, and exchanges the identity token for a short-lived
+// rpc token using oauth2 token exchange (rfc 8693).
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/runner-go/logger"
+)
+
+// token exchange parameters.
+const (
+	grantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenType = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// Config configures the identity provider and the token
+// exchange endpoint.
+type Config struct {
+	// TokenFile is the path to the identity token, for
+	// example, a projected service account token. The file
+	// is read on each refresh.
+	TokenFile string
+
+	// TokenURL is the identity token endpoint, for example,
+	// the cloud instance metadata server.
+	TokenURL string
+
+	// TokenHeaders are added to identity token requests, for
+	// example, the Metadata-Flavor header.
+	TokenHeaders map[string]string
+
+	// Endpoint is the token exchange endpoint.
+	Endpoint string
+
+	// Audience is the audience of the exchanged token.
+	Audience string
+
+	// Client is the http client, defaults to the default
+	// http client.
+	Client *http.Client
+}
+
+// Source provides a short-lived rpc token that is refreshed
+// before the token expires.
+type Source struct {
+	config Config
+
+	mu     sync.RWMutex
+	token  string
+	expiry time.Time
+}
+
+// New returns a new token source.
+func New(config Config) *Source {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	return &Source{config: config}
+}
+
+// Secret returns the current rpc token.
+func (s *Source) Secret() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.token
+}
+
+// Expiry returns the expiry of the current rpc token.
+func (s *Source) Expiry() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.expiry
+}
+
+// Refresh obtains an identity token and exchanges it for a
+// new rpc token.
+func (s *Source) Refresh(ctx context.Context) error {
+	identity, err := s.identity(ctx)
+	if err != nil {
+		return fmt.Errorf("oidc: cannot get identity token: %s", err)
+	}
+	token, expiry, err := s.exchange(ctx, identity)
+	if err != nil {
+		return fmt.Errorf("oidc: cannot exchange identity token: %s", err)
+	}
+	s.mu.Lock()
+	s.token = token
+	s.expiry = expiry
+	s.mu.Unlock()
+	return nil
+}
+
+// Run refreshes the rpc token before it expires, until the
+// context is cancelled.
+func (s *Source) Run(ctx context.Context) {
+	log := logger.FromContext(ctx)
+	delay := refreshDelay(s.Expiry(), time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if err := s.Refresh(ctx); err != nil {
+			log.WithError(err).Warnln("cannot refresh the rpc token")
+			delay = 30 * time.Second
+			continue
+		}
+		log.Debugln("rpc token refreshed")
+		delay = refreshDelay(s.Expiry(), time.Now())
+	}
+}
+
+// helper function returns the identity token.
+func (s *Source) identity(ctx context.Context) (string, error) {
+	if s.config.TokenFile != "" {
+		data, err := ioutil.ReadFile(s.config.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if s.config.TokenURL == "" {
+		return "", errors.New("no identity token source configured")
+	}
+	req, err := http.NewRequest("GET", s.config.TokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range s.config.TokenHeaders {
+		req.Header.Set(k, v)
+	}
+	res, err := s.config.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode > 299 {
+		return "", fmt.Errorf("unexpected status: %s", res.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// helper function exchanges the identity token for an rpc
+// token, and returns the token and expiry.
+func (s *Source) exchange(ctx context.Context, identity string) (string, time.Time, error) {
+	form := url.Values{}
+	form.Set("grant_type", grantType)
+	form.Set("subject_token", identity)
+	form.Set("subject_token_type", tokenType)
+	if s.config.Audience != "" {
+		form.Set("audience", s.config.Audience)
+	}
+	req, err := http.NewRequest("POST", s.config.Endpoint, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	issued := time.Now()
+	res, err := s.config.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		return "", time.Time{}, fmt.Errorf("unexpected status: %s", res.Status)
+	}
+	out := new(response)
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return "", time.Time{}, err
+	}
+	if out.AccessToken == "" {
+		return "", time.Time{}, errors.New("missing access token")
+	}
+	var expiry time.Time
+	if out.ExpiresIn > 0 {
+		expiry = issued.Add(time.Duration(out.ExpiresIn) * time.Second)
+	}
+	return out.AccessToken, expiry, nil
+}
+
+// response is the token exchange response.
+type response struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// helper function returns the delay before the token is
+// refreshed, which is when 80% of the remaining token
+// lifetime has elapsed. Tokens without an expiry are
+// refreshed hourly.
+func refreshDelay(expiry, now time.Time) time.Duration {
+	if expiry.IsZero() {
+		return time.Hour
+	}
+	delay := expiry.Sub(now) * 4 / 5
+	if delay < 10*time.Second {
+		delay = 10 * time.Second
+	}
+	return delay
+}
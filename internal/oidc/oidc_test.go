@@ -0,0 +1,108 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var noContext = context.Background()
+
+func TestRefresh(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/identity":
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				w.WriteHeader(403)
+				return
+			}
+			w.Write([]byte("eyJhbGciOiJSUzI1NiJ9.identity\n"))
+		case "/token":
+			r.ParseForm()
+			if r.Form.Get("grant_type") != grantType ||
+				r.Form.Get("subject_token") != "eyJhbGciOiJSUzI1NiJ9.identity" ||
+				r.Form.Get("audience") != "drone" {
+				w.WriteHeader(400)
+				return
+			}
+			json.NewEncoder(w).Encode(&response{
+				AccessToken: "short-lived",
+				ExpiresIn:   3600,
+			})
+		}
+	}))
+	defer ts.Close()
+
+	s := New(Config{
+		TokenURL:     ts.URL + "/identity",
+		TokenHeaders: map[string]string{"Metadata-Flavor": "Google"},
+		Endpoint:     ts.URL + "/token",
+		Audience:     "drone",
+	})
+	if err := s.Refresh(noContext); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.Secret(), "short-lived"; got != want {
+		t.Errorf("Want token %q, got %q", want, got)
+	}
+	if d := time.Until(s.Expiry()); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("Want token expiry in one hour, got %s", d)
+	}
+}
+
+func TestRefresh_TokenFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	ioutil.WriteFile(path, []byte("projected"), 0600)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("subject_token") != "projected" {
+			w.WriteHeader(401)
+			return
+		}
+		w.Write([]byte(`{"access_token":"short-lived"}`))
+	}))
+	defer ts.Close()
+
+	s := New(Config{TokenFile: path, Endpoint: ts.URL})
+	if err := s.Refresh(noContext); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.Secret(), "short-lived"; got != want {
+		t.Errorf("Want token %q, got %q", want, got)
+	}
+
+	ioutil.WriteFile(path, []byte("expired"), 0600)
+	if err := s.Refresh(noContext); err == nil {
+		t.Errorf("Want error when exchange rejected")
+	}
+	if got, want := s.Secret(), "short-lived"; got != want {
+		t.Errorf("Want existing token retained, got %q", got)
+	}
+}
+
+func TestRefreshDelay(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		expiry time.Time
+		want   time.Duration
+	}{
+		{time.Time{}, time.Hour},
+		{now.Add(10 * time.Minute), 8 * time.Minute},
+		{now.Add(time.Second), 10 * time.Second},
+	}
+	for _, test := range tests {
+		if got := refreshDelay(test.expiry, now); got != test.want {
+			t.Errorf("Want delay %s, got %s", test.want, got)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package port provides a port allocator that is used to assign
+// unique ports to concurrently running pipelines.
+package port
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Default port range.
+const (
+	DefaultMin = 20000
+	DefaultMax = 29999
+)
+
+// ErrExhausted is returned when no ports are available in the
+// configured port range.
+var ErrExhausted = errors.New("port range exhausted")
+
+// function returns true if the port is free on the host.
+var available = defaultAvailable
+
+func defaultAvailable(port int) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+// Allocator allocates ports from a fixed range. Ports remain
+// allocated until released, ensuring concurrent pipelines are
+// never assigned the same port.
+type Allocator struct {
+	sync.Mutex
+
+	min  int
+	max  int
+	next int
+	used map[int]struct{}
+}
+
+// New returns a new port allocator for the inclusive range.
+func New(min, max int) *Allocator {
+	return &Allocator{
+		min:  min,
+		max:  max,
+		next: min,
+		used: map[int]struct{}{},
+	}
+}
+
+// Allocate allocates a port for each name. If the port range
+// is exhausted, the ports are released and an error is
+// returned.
+func (a *Allocator) Allocate(names []string) (map[string]int, error) {
+	a.Lock()
+	defer a.Unlock()
+
+	ports := map[string]int{}
+	for _, name := range names {
+		port, ok := a.allocate()
+		if !ok {
+			a.release(ports)
+			return nil, ErrExhausted
+		}
+		ports[name] = port
+	}
+	return ports, nil
+}
+
+// Release releases the ports so they can be re-allocated.
+func (a *Allocator) Release(ports map[string]int) {
+	a.Lock()
+	a.release(ports)
+	a.Unlock()
+}
+
+func (a *Allocator) allocate() (int, bool) {
+	size := a.max - a.min + 1
+	for i := 0; i < size; i++ {
+		port := a.next
+		a.next++
+		if a.next > a.max {
+			a.next = a.min
+		}
+		if _, ok := a.used[port]; ok {
+			continue
+		}
+		if !available(port) {
+			continue
+		}
+		a.used[port] = struct{}{}
+		return port, true
+	}
+	return 0, false
+}
+
+func (a *Allocator) release(ports map[string]int) {
+	for _, port := range ports {
+		delete(a.used, port)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package port
+
+import "testing"
+
+func TestAllocate(t *testing.T) {
+	defer func() {
+		available = defaultAvailable
+	}()
+	available = func(int) bool { return true }
+
+	a := New(8000, 8002)
+	ports, err := a.Allocate([]string{"postgres", "redis"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := ports["postgres"], 8000; got != want {
+		t.Errorf("Want port %d, got %d", want, got)
+	}
+	if got, want := ports["redis"], 8001; got != want {
+		t.Errorf("Want port %d, got %d", want, got)
+	}
+
+	_, err = a.Allocate([]string{"mysql", "mongo"})
+	if err != ErrExhausted {
+		t.Errorf("Expect port range exhausted")
+	}
+
+	// the failed allocation must not leak ports.
+	ports2, err := a.Allocate([]string{"mysql"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := ports2["mysql"], 8002; got != want {
+		t.Errorf("Want port %d, got %d", want, got)
+	}
+
+	a.Release(ports)
+	ports3, err := a.Allocate([]string{"postgres", "redis"})
+	if err != nil {
+		t.Errorf("Expect released ports re-allocated, got %s", err)
+	}
+	if len(ports3) != 2 {
+		t.Errorf("Expect two ports allocated")
+	}
+}
+
+func TestAllocate_Unavailable(t *testing.T) {
+	defer func() {
+		available = defaultAvailable
+	}()
+	available = func(port int) bool { return port != 8000 }
+
+	a := New(8000, 8001)
+	ports, err := a.Allocate([]string{"postgres"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := ports["postgres"], 8001; got != want {
+		t.Errorf("Expect port in use on host skipped, got %d", got)
+	}
+}
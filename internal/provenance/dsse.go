@@ -0,0 +1,126 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package provenance
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Envelope is a DSSE envelope that carries the signed statement.
+type Envelope struct {
+	PayloadType string       `json:"payloadType"`
+	Payload     string       `json:"payload"`
+	Signatures  []*Signature `json:"signatures"`
+}
+
+// Signature is a DSSE envelope signature.
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// Signer signs the DSSE envelopes.
+type Signer struct {
+	key    crypto.Signer
+	keyID  string
+	public []byte
+}
+
+// LoadSigner loads the PEM encoded private key used to sign the
+// envelopes. The key must be an ed25519, ecdsa or rsa key.
+func LoadSigner(path string) (*Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("provenance: cannot decode private key")
+	}
+	var key interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("provenance: cannot parse private key: %s", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("provenance: unsupported private key")
+	}
+	return NewSigner(signer)
+}
+
+// NewSigner returns a new Signer for the private key.
+func NewSigner(key crypto.Signer) (*Signer, error) {
+	switch key.(type) {
+	case ed25519.PrivateKey, *ecdsa.PrivateKey, *rsa.PrivateKey:
+	default:
+		return nil, errors.New("provenance: unsupported private key")
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(der)
+	return &Signer{
+		key:    key,
+		keyID:  hex.EncodeToString(sum[:]),
+		public: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+	}, nil
+}
+
+// PublicKey returns the PEM encoded public key.
+func (s *Signer) PublicKey() []byte {
+	return s.public
+}
+
+// Sign returns the DSSE envelope of the payload.
+func (s *Signer) Sign(payloadType string, payload []byte) (*Envelope, error) {
+	message := pae(payloadType, payload)
+	var digest []byte
+	var opts crypto.SignerOpts
+	switch s.key.(type) {
+	case ed25519.PrivateKey:
+		digest, opts = message, crypto.Hash(0)
+	default:
+		sum := sha256.Sum256(message)
+		digest, opts = sum[:], crypto.SHA256
+	}
+	sig, err := s.key.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures: []*Signature{
+			{KeyID: s.keyID, Sig: base64.StdEncoding.EncodeToString(sig)},
+		},
+	}, nil
+}
+
+// helper function returns the DSSE pre-authentication encoding
+// of the payload, which is the signed message.
+func pae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
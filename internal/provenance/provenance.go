@@ -0,0 +1,141 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package provenance generates signed in-toto statements with
+// SLSA provenance predicates for the stages executed by the
+// runner.
+package provenance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+)
+
+// in-toto statement and predicate types.
+const (
+	StatementType  = "https://in-toto.io/Statement/v1"
+	PredicateType  = "https://slsa.dev/provenance/v1"
+	BuildType      = "https://github.com/drone-runners/drone-runner-exec/build/v1"
+	PayloadType    = "application/vnd.in-toto+json"
+	DefaultBuilder = "https://github.com/drone-runners/drone-runner-exec"
+)
+
+type (
+	// Statement is an in-toto statement.
+	Statement struct {
+		Type          string     `json:"_type"`
+		Subject       []*Subject `json:"subject"`
+		PredicateType string     `json:"predicateType"`
+		Predicate     *Predicate `json:"predicate"`
+	}
+
+	// Subject is an artifact produced by the build.
+	Subject struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	}
+
+	// Predicate is a SLSA provenance predicate.
+	Predicate struct {
+		BuildDefinition *BuildDefinition `json:"buildDefinition"`
+		RunDetails      *RunDetails      `json:"runDetails"`
+	}
+
+	// BuildDefinition describes the inputs of the build.
+	BuildDefinition struct {
+		BuildType            string                 `json:"buildType"`
+		ExternalParameters   map[string]interface{} `json:"externalParameters"`
+		InternalParameters   map[string]interface{} `json:"internalParameters,omitempty"`
+		ResolvedDependencies []*Resource            `json:"resolvedDependencies,omitempty"`
+	}
+
+	// Resource describes a resource used by the build.
+	Resource struct {
+		URI    string            `json:"uri,omitempty"`
+		Name   string            `json:"name,omitempty"`
+		Digest map[string]string `json:"digest,omitempty"`
+	}
+
+	// RunDetails describes the execution of the build.
+	RunDetails struct {
+		Builder  *Builder  `json:"builder"`
+		Metadata *Metadata `json:"metadata"`
+	}
+
+	// Builder identifies the runner that executed the build.
+	Builder struct {
+		ID string `json:"id"`
+	}
+
+	// Metadata describes the build invocation.
+	Metadata struct {
+		InvocationID string    `json:"invocationId"`
+		StartedOn    time.Time `json:"startedOn"`
+		FinishedOn   time.Time `json:"finishedOn"`
+	}
+
+	// Step describes an executed pipeline step. The environment
+	// digest is computed from the step environment, excluding
+	// secrets.
+	Step struct {
+		Name        string `json:"name"`
+		Status      string `json:"status"`
+		ExitCode    int    `json:"exitCode"`
+		Command     string `json:"command,omitempty"`
+		Environment string `json:"environment,omitempty"`
+	}
+)
+
+// Key identifies the provenance of a stage.
+type Key struct {
+	Repo  string // repository slug
+	Build int64  // build number
+	Stage string // stage name
+}
+
+// path returns the slash-separated relative path of the
+// provenance in the sink.
+func (k Key) path() string {
+	return path.Join(k.Repo, fmt.Sprint(k.Build), url.PathEscape(k.Stage)+".intoto.jsonl")
+}
+
+// Recorder signs the provenance of a stage, and writes the
+// signed envelope to the sink.
+type Recorder struct {
+	// Builder is the builder id recorded in the provenance.
+	Builder string
+
+	signer *Signer
+	sink   Sink
+}
+
+// New returns a new Recorder.
+func New(builder string, signer *Signer, sink Sink) *Recorder {
+	if builder == "" {
+		builder = DefaultBuilder
+	}
+	return &Recorder{
+		Builder: builder,
+		signer:  signer,
+		sink:    sink,
+	}
+}
+
+// Record signs the statement and writes the signed envelope
+// to the sink.
+func (r *Recorder) Record(ctx context.Context, key Key, statement *Statement) error {
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return err
+	}
+	envelope, err := r.signer.Sign(PayloadType, payload)
+	if err != nil {
+		return fmt.Errorf("provenance: cannot sign statement: %s", err)
+	}
+	return r.sink.Write(ctx, key, envelope)
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package provenance
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+var noContext = context.Background()
+
+func TestSign(t *testing.T) {
+	_, edkey, _ := ed25519.GenerateKey(rand.Reader)
+	eckey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	payload := []byte(`{"_type":"https://in-toto.io/Statement/v1"}`)
+	message := pae(PayloadType, payload)
+
+	for _, key := range []interface{}{edkey, eckey} {
+		der, _ := x509.MarshalPKCS8PrivateKey(key)
+		path := filepath.Join(t.TempDir(), "key.pem")
+		ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+
+		signer, err := LoadSigner(path)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		envelope, err := signer.Sign(PayloadType, payload)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got, want := envelope.Payload, base64.StdEncoding.EncodeToString(payload); got != want {
+			t.Errorf("Want encoded payload %s, got %s", want, got)
+		}
+		sig, _ := base64.StdEncoding.DecodeString(envelope.Signatures[0].Sig)
+		switch key := key.(type) {
+		case ed25519.PrivateKey:
+			if !ed25519.Verify(key.Public().(ed25519.PublicKey), message, sig) {
+				t.Errorf("Want valid ed25519 signature")
+			}
+		case *ecdsa.PrivateKey:
+			sum := sha256.Sum256(message)
+			if !ecdsa.VerifyASN1(&key.PublicKey, sum[:], sig) {
+				t.Errorf("Want valid ecdsa signature")
+			}
+		}
+	}
+}
+
+func TestPAE(t *testing.T) {
+	got := string(pae("application/example", []byte("hello world")))
+	want := "DSSEv1 19 application/example 11 hello world"
+	if got != want {
+		t.Errorf("Want pre-authentication encoding %q, got %q", want, got)
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"/var/lib/drone/provenance", true},
+		{"file:///var/lib/drone/provenance", true},
+		{"oci://registry.example.com/octocat/provenance", true},
+		{"rekor://rekor.sigstore.dev", true},
+		{"oci://registry.example.com", false},
+		{"rekor://", false},
+		{"ftp://example.com", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		_, err := NewSink(test.url, nil)
+		if test.valid && err != nil {
+			t.Errorf("Want valid sink %s, got %s", test.url, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("Want invalid sink %s", test.url)
+		}
+	}
+}
+
+func TestRecorder_Dir(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	signer, _ := NewSigner(key)
+	dir := t.TempDir()
+
+	recorder := New("", signer, Dir(dir))
+	if got, want := recorder.Builder, DefaultBuilder; got != want {
+		t.Errorf("Want default builder %s, got %s", want, got)
+	}
+	statement := &Statement{Type: StatementType, PredicateType: PredicateType}
+	stage := Key{Repo: "octocat/hello-world", Build: 42, Stage: "default"}
+	if err := recorder.Record(noContext, stage, statement); err != nil {
+		t.Error(err)
+		return
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "octocat", "hello-world", "42", "default.intoto.jsonl"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	envelope := new(Envelope)
+	if err := json.Unmarshal(data, envelope); err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := envelope.PayloadType, PayloadType; got != want {
+		t.Errorf("Want payload type %s, got %s", want, got)
+	}
+}
+
+func TestRekor(t *testing.T) {
+	var entry struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			ProposedContent struct {
+				Envelope  string   `json:"envelope"`
+				Verifiers []string `json:"verifiers"`
+			} `json:"proposedContent"`
+		} `json:"spec"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/log/entries" {
+			w.WriteHeader(404)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&entry)
+		w.WriteHeader(201)
+	}))
+	defer server.Close()
+
+	sink := Rekor(server.URL, []byte("public key"))
+	if err := sink.Write(noContext, Key{}, &Envelope{PayloadType: PayloadType}); err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := entry.Kind, "dsse"; got != want {
+		t.Errorf("Want rekor entry kind %s, got %s", want, got)
+	}
+	if got, want := entry.Spec.ProposedContent.Verifiers[0], base64.StdEncoding.EncodeToString([]byte("public key")); got != want {
+		t.Errorf("Want public key verifier %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package provenance
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Sink stores the signed provenance envelopes.
+type Sink interface {
+	// Write writes the envelope of the stage.
+	Write(ctx context.Context, key Key, envelope *Envelope) error
+}
+
+// NewSink returns the Sink for the url. The scheme selects the
+// sink: file:// or a plain path writes to a directory, oci://
+// pushes to an oci registry with the oras command line tool,
+// and rekor:// uploads to a rekor transparency log over https.
+// The public key is uploaded with the envelope to rekor.
+func NewSink(rawurl string, public []byte) (Sink, error) {
+	if rawurl == "" {
+		return nil, errors.New("provenance: missing url")
+	}
+	if filepath.IsAbs(rawurl) {
+		return Dir(rawurl), nil
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		return Dir(filepath.FromSlash(u.Path)), nil
+	case "oci":
+		if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			return nil, errors.New("provenance: missing oci repository")
+		}
+		return OCI(u.Host + "/" + strings.Trim(u.Path, "/")), nil
+	case "rekor":
+		if u.Host == "" {
+			return nil, errors.New("provenance: missing rekor host")
+		}
+		return Rekor("https://"+u.Host+strings.TrimSuffix(u.Path, "/"), public), nil
+	default:
+		return nil, fmt.Errorf("provenance: unsupported scheme %q", u.Scheme)
+	}
+}
+
+// Dir returns a Sink that writes the envelopes to a directory,
+// with a file per stage.
+func Dir(path string) Sink {
+	return &dir{path: path}
+}
+
+type dir struct {
+	path string
+}
+
+func (d *dir) Write(ctx context.Context, key Key, envelope *Envelope) error {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(d.path, filepath.FromSlash(key.path()))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// OCI returns a Sink that pushes the envelopes to the oci
+// repository with the oras command line tool. Each stage is
+// tagged with the build number and stage name. Credentials are
+// sourced from the runner docker configuration.
+func OCI(repository string) Sink {
+	return &oci{repository: repository}
+}
+
+type oci struct {
+	repository string
+}
+
+// invalid tag characters are replaced.
+var invalidTag = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+func (o *oci) Write(ctx context.Context, key Key, envelope *Envelope) error {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	temp, err := ioutil.TempDir("", "drone-provenance")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(temp)
+	if err := ioutil.WriteFile(filepath.Join(temp, "provenance.intoto.jsonl"), data, 0600); err != nil {
+		return err
+	}
+	tag := invalidTag.ReplaceAllString(fmt.Sprintf("build-%d-%s", key.Build, key.Stage), "-")
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	cmd := exec.CommandContext(ctx, "oras", "push",
+		"--artifact-type", PayloadType,
+		o.repository+":"+tag,
+		"provenance.intoto.jsonl:application/vnd.dsse.envelope.v1+json",
+	)
+	cmd.Dir = temp
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("provenance: oras push: %s: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Rekor returns a Sink that uploads the envelopes to the rekor
+// transparency log at the server address.
+func Rekor(server string, public []byte) Sink {
+	return &rekor{server: server, public: public, client: http.DefaultClient}
+}
+
+type rekor struct {
+	server string
+	public []byte
+	client *http.Client
+}
+
+func (r *rekor) Write(ctx context.Context, key Key, envelope *Envelope) error {
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	entry := map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "dsse",
+		"spec": map[string]interface{}{
+			"proposedContent": map[string]interface{}{
+				"envelope":  string(data),
+				"verifiers": []string{base64.StdEncoding.EncodeToString(r.public)},
+			},
+		},
+	}
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", r.server+"/api/v1/log/entries", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	// the log returns a conflict if the entry already exists.
+	if res.StatusCode == http.StatusCreated || res.StatusCode == http.StatusConflict {
+		return nil
+	}
+	out, _ := ioutil.ReadAll(res.Body)
+	return fmt.Errorf("provenance: rekor: %s: %s", res.Status, strings.TrimSpace(string(out)))
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package ratelimit provides bandwidth limiting for runner to
+// server traffic, and request rate limiting for the dashboard.
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// minBurst is the minimum burst size in bytes, so that small
+// rate limits do not fragment writes.
+const minBurst = 32 * 1024
+
+// New returns a limiter that limits bandwidth to the number of
+// bytes per second, shared by all connections.
+func New(bytesPerSecond int64) *rate.Limiter {
+	burst := int(bytesPerSecond)
+	if burst < minBurst {
+		burst = minBurst
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+}
+
+// Conn is a net.Conn that limits the write bandwidth.
+type Conn struct {
+	net.Conn
+	limiter *rate.Limiter
+}
+
+// Write writes the data to the connection, blocking until the
+// bandwidth limit permits the write.
+func (c *Conn) Write(p []byte) (int, error) {
+	var written int
+	for len(p) != 0 {
+		n := len(p)
+		if burst := c.limiter.Burst(); n > burst {
+			n = burst
+		}
+		if err := c.limiter.WaitN(context.Background(), n); err != nil {
+			return written, err
+		}
+		m, err := c.Conn.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Dialer returns a dial function that limits the write
+// bandwidth of the connection.
+func Dialer(limiter *rate.Limiter) func(context.Context, string, string) (net.Conn, error) {
+	dialer := new(net.Dialer)
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return &Conn{Conn: conn, limiter: limiter}, nil
+	}
+}
+
+// Transport returns a copy of the http transport that limits
+// the write bandwidth of its connections. The transport is
+// returned unmodified if it is not an *http.Transport.
+func Transport(base http.RoundTripper, limiter *rate.Limiter) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return base
+	}
+	t = t.Clone()
+	t.DialContext = Dialer(limiter)
+	return t
+}
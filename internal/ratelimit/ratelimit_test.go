@@ -0,0 +1,89 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go ioutil.ReadAll(server)
+
+	// the limiter permits an initial burst of 100 bytes, and
+	// 1000 bytes per second thereafter.
+	conn := &Conn{Conn: client, limiter: rate.NewLimiter(1000, 100)}
+	start := time.Now()
+	n, err := conn.Write(make([]byte, 300))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 300 {
+		t.Errorf("Want 300 bytes written, got %d", n)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Want write limited, completed in %s", elapsed)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if got := New(1024).Burst(); got != minBurst {
+		t.Errorf("Want minimum burst %d, got %d", minBurst, got)
+	}
+	if got := New(1048576).Burst(); got != 1048576 {
+		t.Errorf("Want burst equal to the rate, got %d", got)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	limiter := New(1024)
+	if _, ok := Transport(nil, limiter).(*http.Transport); !ok {
+		t.Errorf("Want default transport limited")
+	}
+	base := &http.Transport{}
+	if got := Transport(base, limiter).(*http.Transport); got == base || got.DialContext == nil {
+		t.Errorf("Want copy of the transport limited")
+	}
+	custom := http.RoundTripper(roundTripFunc(nil))
+	if _, ok := Transport(custom, limiter).(roundTripFunc); !ok {
+		t.Errorf("Want custom transport returned unmodified")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestRequests(t *testing.T) {
+	h := Requests(0.001, 2).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func(addr string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = addr
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	for i := 0; i < 2; i++ {
+		if got := request("10.0.0.1:1234"); got != http.StatusOK {
+			t.Errorf("Want burst permitted, got status %d", got)
+		}
+	}
+	if got := request("10.0.0.1:5678"); got != http.StatusTooManyRequests {
+		t.Errorf("Want request limited, got status %d", got)
+	}
+	if got := request("10.0.0.2:1234"); got != http.StatusOK {
+		t.Errorf("Want other client permitted, got status %d", got)
+	}
+}
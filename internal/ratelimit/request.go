@@ -0,0 +1,104 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// idleTimeout is the duration after which an idle client is
+// forgotten.
+const idleTimeout = 10 * time.Minute
+
+// Clients limits the request rate of each client, where the
+// client is identified by the remote address.
+type Clients struct {
+	limit rate.Limit
+	burst int
+
+	mu     sync.Mutex
+	items  map[string]*client
+	pruned time.Time
+}
+
+type client struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+// Requests returns a new Clients that limits each client to
+// the number of requests per second, with the burst size.
+func Requests(perSecond float64, burst int) *Clients {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Clients{
+		limit:  rate.Limit(perSecond),
+		burst:  burst,
+		items:  map[string]*client{},
+		pruned: time.Now(),
+	}
+}
+
+// Allow returns true if the request is permitted by the rate
+// limit of the client.
+func (c *Clients) Allow(r *http.Request) bool {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lookup(r, now).AllowN(now, 1)
+}
+
+// Limited returns true if the client has exceeded the rate
+// limit. Unlike Allow, the request is not counted.
+func (c *Clients) Limited(r *http.Request) bool {
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lookup(r, now).TokensAt(now) < 1
+}
+
+// helper function returns the limiter of the client that
+// sent the request, and forgets idle clients. The caller
+// must hold the lock.
+func (c *Clients) lookup(r *http.Request, now time.Time) *rate.Limiter {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if now.Sub(c.pruned) > idleTimeout {
+		for key, item := range c.items {
+			if now.Sub(item.seen) > idleTimeout {
+				delete(c.items, key)
+			}
+		}
+		c.pruned = now
+	}
+	item, ok := c.items[host]
+	if !ok {
+		item = &client{limiter: rate.NewLimiter(c.limit, c.burst)}
+		c.items[host] = item
+	}
+	item.seen = now
+	return item.limiter
+}
+
+// Handler wraps the handler with the rate limit. Requests that
+// exceed the rate limit are rejected with status 429.
+func (c *Clients) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.Allow(r) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package remote defines the pool of remote hosts that execute
+// pipelines on behalf of the runner.
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+
+	"github.com/drone-runners/drone-runner-exec/internal/match"
+
+	"github.com/buildkite/yaml"
+)
+
+// Protocols used to connect to the host.
+const (
+	// ProtocolSSH connects to the host over ssh. The host
+	// must provide a posix shell.
+	ProtocolSSH = "ssh"
+
+	// ProtocolWinRM connects to the host over windows remote
+	// management. The host must provide powershell.
+	ProtocolWinRM = "winrm"
+)
+
+// ErrNoHost is returned when no host matches the stage labels.
+var ErrNoHost = errors.New("no remote host matches the stage labels")
+
+// Host defines a remote host.
+type Host struct {
+	Name       string            `yaml:"name"`
+	Address    string            `yaml:"address"`
+	Protocol   string            `yaml:"protocol"`
+	Username   string            `yaml:"username"`
+	Password   string            `yaml:"password"`
+	PrivateKey string            `yaml:"private_key_file"`
+	KnownHosts string            `yaml:"known_hosts_file"`
+	Insecure   bool              `yaml:"insecure_skip_verify"`
+	TLS        bool              `yaml:"tls"`
+	Root       string            `yaml:"root"`
+	Capacity   int               `yaml:"capacity"`
+	Labels     map[string]string `yaml:"labels"`
+}
+
+// Load loads the hosts from the yaml file.
+func Load(path string) ([]*Host, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []*Host
+	if err := yaml.Unmarshal(data, &hosts); err != nil {
+		return nil, fmt.Errorf("cannot parse remote hosts: %s", err)
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("remote hosts file does not define any hosts")
+	}
+	seen := map[string]struct{}{}
+	for _, host := range hosts {
+		if err := host.defaults(); err != nil {
+			return nil, err
+		}
+		if _, ok := seen[host.Name]; ok {
+			return nil, fmt.Errorf("duplicate remote host %q", host.Name)
+		}
+		seen[host.Name] = struct{}{}
+	}
+	return hosts, nil
+}
+
+// helper function applies the default values and returns an
+// error if the host is invalid.
+func (h *Host) defaults() error {
+	switch {
+	case h.Name == "":
+		return errors.New("remote host requires a name")
+	case h.Address == "":
+		return fmt.Errorf("remote host %q requires an address", h.Name)
+	case h.Username == "":
+		return fmt.Errorf("remote host %q requires a username", h.Name)
+	}
+	if h.Protocol == "" {
+		h.Protocol = ProtocolSSH
+	}
+	switch h.Protocol {
+	case ProtocolSSH:
+		if h.Password == "" && h.PrivateKey == "" {
+			return fmt.Errorf("remote host %q requires a password or private key", h.Name)
+		}
+		if h.KnownHosts == "" && !h.Insecure {
+			return fmt.Errorf("remote host %q requires a known hosts file", h.Name)
+		}
+		h.Address = withPort(h.Address, "22")
+		if h.Root == "" {
+			h.Root = "/tmp"
+		}
+	case ProtocolWinRM:
+		if h.Password == "" {
+			return fmt.Errorf("remote host %q requires a password", h.Name)
+		}
+		if h.TLS {
+			h.Address = withPort(h.Address, "5986")
+		} else {
+			h.Address = withPort(h.Address, "5985")
+		}
+		if h.Root == "" {
+			h.Root = "C:/Windows/Temp"
+		}
+	default:
+		return fmt.Errorf("remote host %q has unsupported protocol %q", h.Name, h.Protocol)
+	}
+	if h.Capacity <= 0 {
+		h.Capacity = 1
+	}
+	return nil
+}
+
+// helper function returns the address with the default port,
+// if the address does not include a port.
+func withPort(address, port string) string {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return net.JoinHostPort(address, port)
+	}
+	return address
+}
+
+// helper function returns true if the host labels satisfy the
+// stage label selector expressions.
+func (h *Host) match(labels map[string]string) (bool, error) {
+	return match.Labels(labels, h.Labels)
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts.yml")
+	ioutil.WriteFile(path, []byte(`
+- name: mac-1
+  address: 10.0.0.5
+  username: drone
+  private_key_file: /etc/drone/id_ed25519
+  known_hosts_file: /etc/drone/known_hosts
+  labels:
+    os: darwin
+`), 0600)
+
+	hosts, err := Load(path)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	host := hosts[0]
+	if got, want := host.Address, "10.0.0.5:22"; got != want {
+		t.Errorf("Want address %s, got %s", want, got)
+	}
+	if got, want := host.Protocol, ProtocolSSH; got != want {
+		t.Errorf("Want protocol %s, got %s", want, got)
+	}
+	if got, want := host.Capacity, 1; got != want {
+		t.Errorf("Want capacity %d, got %d", want, got)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []string{
+		`- address: 10.0.0.5`,
+		`- { name: a, address: 10.0.0.5, username: drone }`,
+		`- { name: a, address: 10.0.0.5, username: drone, password: secret }`,
+		`- { name: a, address: 10.0.0.5, username: drone, password: secret, insecure_skip_verify: true, protocol: telnet }`,
+		`- { name: a, address: 10.0.0.5, username: drone, private_key_file: /etc/drone/id_rsa, protocol: winrm }`,
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "hosts.yml")
+		ioutil.WriteFile(path, []byte(test), 0600)
+		if _, err := Load(path); err == nil {
+			t.Errorf("Expect error loading hosts %s", test)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrHostNotFound is returned when the named host does not
+// exist in the pool.
+var ErrHostNotFound = errors.New("remote host not found")
+
+// Checker checks the health of the host.
+type Checker func(context.Context, *Host) error
+
+// Status reports the state of a host in the pool.
+type Status struct {
+	Name     string            `json:"name"`
+	Address  string            `json:"address"`
+	Protocol string            `json:"protocol"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Capacity int               `json:"capacity"`
+	Running  int               `json:"running"`
+	Healthy  bool              `json:"healthy"`
+	Error    string            `json:"error,omitempty"`
+	Checked  int64             `json:"checked,omitempty"`
+	Failures int               `json:"failures"`
+	Cordoned bool              `json:"cordoned"`
+	Reason   string            `json:"reason,omitempty"`
+}
+
+// Pool manages the capacity and availability of the remote
+// hosts. Stages are not scheduled on hosts that are cordoned
+// or that fail the health check.
+type Pool struct {
+	mu      sync.Mutex
+	hosts   []*Host
+	status  map[string]*Status
+	changed chan struct{}
+
+	// maximum number of consecutive failed stages before the
+	// host is cordoned. Zero disables automatic cordoning.
+	maxFailures int
+}
+
+// NewPool returns a new pool of the hosts. The host is cordoned
+// after the maximum number of consecutive failed stages, if
+// greater than zero.
+func NewPool(hosts []*Host, maxFailures int) *Pool {
+	pool := &Pool{
+		hosts:       hosts,
+		status:      map[string]*Status{},
+		changed:     make(chan struct{}),
+		maxFailures: maxFailures,
+	}
+	for _, host := range hosts {
+		pool.status[host.Name] = &Status{
+			Name:     host.Name,
+			Address:  host.Address,
+			Protocol: host.Protocol,
+			Labels:   host.Labels,
+			Capacity: host.Capacity,
+			Healthy:  true,
+		}
+	}
+	return pool
+}
+
+// Lookup returns the named host, or nil if the host does not
+// exist.
+func (p *Pool) Lookup(name string) *Host {
+	for _, host := range p.hosts {
+		if host.Name == name {
+			return host
+		}
+	}
+	return nil
+}
+
+// Acquire returns a host that matches the stage labels and has
+// free capacity, blocking until a matching host is available.
+// The stage labels are label selector expressions evaluated
+// against the host labels. The host must be released when the
+// stage completes.
+func (p *Pool) Acquire(ctx context.Context, labels map[string]string) (*Host, error) {
+	for {
+		p.mu.Lock()
+		var matched bool
+		for _, host := range p.hosts {
+			ok, err := host.match(labels)
+			if err != nil {
+				p.mu.Unlock()
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			matched = true
+			status := p.status[host.Name]
+			if status.Cordoned || !status.Healthy {
+				continue
+			}
+			if status.Running < host.Capacity {
+				status.Running++
+				p.mu.Unlock()
+				return host, nil
+			}
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		if !matched {
+			return nil, ErrNoHost
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Release releases the host capacity used by the stage. A non-nil
+// error records a failed stage, and the host is cordoned after
+// the maximum number of consecutive failed stages.
+func (p *Pool) Release(host *Host, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status := p.status[host.Name]
+	if status.Running > 0 {
+		status.Running--
+	}
+	if err == nil {
+		status.Failures = 0
+	} else {
+		status.Failures++
+		if p.maxFailures > 0 && status.Failures >= p.maxFailures && !status.Cordoned {
+			status.Cordoned = true
+			status.Reason = fmt.Sprintf("%d consecutive failed stages: %s", status.Failures, err)
+		}
+	}
+	p.notify()
+}
+
+// Cordon excludes the named host from scheduling. Running
+// stages are not affected.
+func (p *Pool) Cordon(name, reason string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status, ok := p.status[name]
+	if !ok {
+		return ErrHostNotFound
+	}
+	status.Cordoned = true
+	status.Reason = reason
+	return nil
+}
+
+// Uncordon returns the named host to scheduling, and resets
+// the consecutive failed stages.
+func (p *Pool) Uncordon(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	status, ok := p.status[name]
+	if !ok {
+		return ErrHostNotFound
+	}
+	status.Cordoned = false
+	status.Reason = ""
+	status.Failures = 0
+	p.notify()
+	return nil
+}
+
+// List returns the status of the hosts, ordered by name.
+func (p *Pool) List() []*Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []*Status
+	for _, status := range p.status {
+		copy := *status
+		out = append(out, &copy)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Check checks the health of each host, and excludes unhealthy
+// hosts from scheduling until the next successful check.
+func (p *Pool) Check(ctx context.Context, check Checker) {
+	var wg sync.WaitGroup
+	for _, host := range p.hosts {
+		wg.Add(1)
+		go func(host *Host) {
+			defer wg.Done()
+			err := check(ctx, host)
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			status := p.status[host.Name]
+			status.Checked = time.Now().Unix()
+			if err != nil {
+				status.Healthy = false
+				status.Error = err.Error()
+				return
+			}
+			if !status.Healthy {
+				status.Healthy = true
+				status.Error = ""
+				p.notify()
+			}
+		}(host)
+	}
+	wg.Wait()
+}
+
+// Monitor checks the health of each host at the interval,
+// until the context is cancelled.
+func (p *Pool) Monitor(ctx context.Context, interval time.Duration, check Checker) {
+	for {
+		p.Check(ctx, check)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// helper function wakes the stages waiting for a host. The
+// caller must hold the lock.
+func (p *Pool) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package remote
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	pool := NewPool([]*Host{
+		{Name: "linux-1", Capacity: 1, Labels: map[string]string{"os": "linux"}},
+		{Name: "mac-1", Capacity: 1, Labels: map[string]string{"os": "darwin"}},
+	}, 0)
+
+	host, err := pool.Acquire(context.Background(), map[string]string{"os": "darwin"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := host.Name, "mac-1"; got != want {
+		t.Errorf("Want host %s, got %s", want, got)
+	}
+
+	if _, err := pool.Acquire(context.Background(), map[string]string{"os": "windows"}); err != ErrNoHost {
+		t.Errorf("Want ErrNoHost when no host matches, got %v", err)
+	}
+
+	// the matching host is busy, and the request blocks until
+	// the host is released.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Acquire(ctx, map[string]string{"os": "darwin"}); err != context.DeadlineExceeded {
+		t.Errorf("Want request blocked while host busy, got %v", err)
+	}
+
+	go pool.Release(host, nil)
+	if _, err := pool.Acquire(context.Background(), map[string]string{"os": "darwin"}); err != nil {
+		t.Errorf("Want host acquired once released, got %v", err)
+	}
+}
+
+func TestPool_Cordon(t *testing.T) {
+	pool := NewPool([]*Host{
+		{Name: "mac-1", Capacity: 1},
+	}, 2)
+
+	// the host is cordoned after two consecutive failed
+	// stages, and stages block until the host is uncordoned.
+	for i := 0; i < 2; i++ {
+		host, err := pool.Acquire(context.Background(), nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		pool.Release(host, errors.New("connection refused"))
+	}
+	if status := pool.List()[0]; !status.Cordoned {
+		t.Errorf("Want host cordoned after consecutive failures")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Acquire(ctx, nil); err != context.DeadlineExceeded {
+		t.Errorf("Want request blocked while host cordoned, got %v", err)
+	}
+
+	if err := pool.Uncordon("mac-1"); err != nil {
+		t.Error(err)
+	}
+	if status := pool.List()[0]; status.Cordoned || status.Failures != 0 {
+		t.Errorf("Want host uncordoned and failures reset")
+	}
+	if _, err := pool.Acquire(context.Background(), nil); err != nil {
+		t.Errorf("Want host acquired once uncordoned, got %v", err)
+	}
+
+	if err := pool.Cordon("linux-1", "maintenance"); err != ErrHostNotFound {
+		t.Errorf("Want ErrHostNotFound, got %v", err)
+	}
+}
+
+func TestPool_Check(t *testing.T) {
+	pool := NewPool([]*Host{
+		{Name: "mac-1", Capacity: 1},
+	}, 0)
+
+	var healthy bool
+	check := func(context.Context, *Host) error {
+		if !healthy {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	pool.Check(context.Background(), check)
+	if status := pool.List()[0]; status.Healthy || status.Error == "" {
+		t.Errorf("Want host unhealthy when the check fails")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Acquire(ctx, nil); err != context.DeadlineExceeded {
+		t.Errorf("Want request blocked while host unhealthy, got %v", err)
+	}
+
+	healthy = true
+	pool.Check(context.Background(), check)
+	if _, err := pool.Acquire(context.Background(), nil); err != nil {
+		t.Errorf("Want host acquired once healthy, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package render renders pipeline templates locally, with the
+// same template data as the server-side yaml template
+// extension, so that templates can be tested before they are
+// uploaded to the server.
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"github.com/buildkite/yaml"
+	"github.com/drone/drone-go/drone"
+)
+
+// LoadValues loads the template input from a yaml values file.
+// An empty path returns empty values.
+func LoadValues(path string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	if path == "" {
+		return values, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[interface{}]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("render: %s: %s", path, err)
+	}
+	for k, v := range raw {
+		values[fmt.Sprint(k)] = normalize(v)
+	}
+	return values, nil
+}
+
+// Render renders the template. The values are provided to the
+// template as the input, with the build and repository.
+func Render(name string, data []byte, values map[string]interface{}, build *drone.Build, repo *drone.Repo) ([]byte, error) {
+	tmpl, err := template.New(name).
+		Option("missingkey=zero").
+		Funcs(funcs).
+		Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("render: %s", err)
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, map[string]interface{}{
+		"build": toMap(build),
+		"repo":  toMap(repo),
+		"input": values,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("render: %s", err)
+	}
+	return out.Bytes(), nil
+}
+
+// funcs provides the template functions.
+var funcs = template.FuncMap{
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"trim":    strings.TrimSpace,
+	"replace": func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"join":    func(sep string, v []interface{}) string { return strings.Join(toStrings(v), sep) },
+	"quote":   func(v interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(v)) },
+	"indent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+	},
+	"default": func(def, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+	"toJson": func(v interface{}) (string, error) {
+		out, err := json.Marshal(v)
+		return string(out), err
+	},
+}
+
+// helper function returns the json representation of the value
+// as a map, so that the template keys match the json keys.
+func toMap(v interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	data, _ := json.Marshal(v)
+	json.Unmarshal(data, &out)
+	return out
+}
+
+// helper function converts the yaml maps to string keyed maps,
+// which can be encoded as json.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		out := map[string]interface{}{}
+		for k, vv := range v {
+			out[fmt.Sprint(k)] = normalize(vv)
+		}
+		return out
+	case []interface{}:
+		for i, vv := range v {
+			v[i] = normalize(vv)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// helper function returns the values as strings.
+func toStrings(v []interface{}) []string {
+	out := make([]string, len(v))
+	for i, vv := range v {
+		out[i] = fmt.Sprint(vv)
+	}
+	return out
+}
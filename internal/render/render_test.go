@@ -0,0 +1,64 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+)
+
+func TestRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "values.yml")
+	ioutil.WriteFile(path, []byte("image: golang\ncommands:\n- go build\n- go test\nenv:\n  CGO_ENABLED: 0\n"), 0600)
+	values, err := LoadValues(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := `kind: pipeline
+name: {{ .repo.name }}-{{ .build.target }}
+steps:
+- name: {{ .input.image | upper }}
+  commands:
+{{- range .input.commands }}
+  - {{ . }}
+{{- end }}
+  environment: {{ toJson .input.env }}
+`
+	build := &drone.Build{Target: "main"}
+	repo := &drone.Repo{Name: "hello-world"}
+	out, err := Render("pipeline.tmpl.yml", []byte(tmpl), values, build, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `kind: pipeline
+name: hello-world-main
+steps:
+- name: GOLANG
+  commands:
+  - go build
+  - go test
+  environment: {"CGO_ENABLED":0}
+`
+	if got := string(out); got != want {
+		t.Errorf("Unexpected rendered template\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestRender_Error(t *testing.T) {
+	if _, err := Render("pipeline.tmpl.yml", []byte("{{ .input.name "), nil, nil, nil); err == nil {
+		t.Errorf("Want error for invalid template")
+	}
+}
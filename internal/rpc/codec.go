@@ -0,0 +1,57 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// errFallback is returned when the server does not implement
+// the method, and the http client should be used.
+var errFallback = errors.New("rpc: method not implemented")
+
+// Codec is a grpc codec that encodes messages as json, using
+// the same message format as the http runner api.
+type Codec struct{}
+
+// Marshal returns the json encoding of v.
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal parses the json encoded data into v.
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Name returns the codec name, used as the content subtype.
+func (Codec) Name() string {
+	return "json"
+}
+
+// logs is the message used to upload step logs.
+type logs struct {
+	Step  int64         `json:"step"`
+	Lines []*drone.Line `json:"lines"`
+}
+
+// empty is the empty response message.
+type empty struct{}
+
+// token provides the shared secret as per-rpc credentials.
+// The secret is evaluated for each call to support rotation.
+type token func() string
+
+func (t token) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"x-drone-token": t()}, nil
+}
+
+func (t token) RequireTransportSecurity() bool {
+	return false
+}
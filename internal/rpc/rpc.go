@@ -0,0 +1,293 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package rpc implements an optional grpc transport to the
+// server, using long-lived streams for stage assignment and
+// log upload. Methods not implemented by the server fall back
+// to the http client.
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/lease"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+)
+
+// Service is the fully qualified name of the runner service.
+const Service = "drone.runner.v1.Runner"
+
+// method names.
+const (
+	methodStages = "/" + Service + "/Stages"
+	methodBatch  = "/" + Service + "/Batch"
+	methodUpload = "/" + Service + "/Upload"
+	methodLease  = "/" + Service + "/Lease"
+)
+
+// Client is a client.Client that requests stages and uploads
+// logs using grpc, and uses the http client for all other
+// methods.
+type Client struct {
+	client.Client
+
+	conn *grpc.ClientConn
+	done chan struct{}
+
+	mu      sync.Mutex
+	streams map[string]*stream
+
+	// Compressor optionally names the grpc compressor used
+	// to compress log uploads that exceed the threshold.
+	Compressor string
+	Threshold  int
+
+	// flags are set when the server does not implement the
+	// method, at which point the http client is used.
+	nostream   int32
+	nologs     int32
+	nocompress int32
+}
+
+// New returns a new grpc client that uses the connection,
+// and falls back to the http client.
+func New(conn *grpc.ClientConn, fallback client.Client) *Client {
+	return &Client{
+		Client:  fallback,
+		conn:    conn,
+		done:    make(chan struct{}),
+		streams: map[string]*stream{},
+	}
+}
+
+// Dial returns a new grpc client connected to the address. The
+// secret function returns the current shared secret. Additional
+// dial options are optionally applied to the connection.
+func Dial(address string, secret func() string, secure, skipverify bool, fallback client.Client, opts ...grpc.DialOption) (*Client, error) {
+	creds := insecure.NewCredentials()
+	if secure {
+		creds = credentials.NewTLS(&tls.Config{
+			InsecureSkipVerify: skipverify,
+		})
+	}
+	opts = append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithPerRPCCredentials(token(secret)),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(Codec{})),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                time.Minute,
+			Timeout:             20 * time.Second,
+			PermitWithoutStream: true,
+		}),
+	}, opts...)
+	conn, err := grpc.Dial(address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return New(conn, fallback), nil
+}
+
+// Close closes the grpc connection.
+func (c *Client) Close() error {
+	close(c.done)
+	return c.conn.Close()
+}
+
+// Request requests the next available build stage for
+// execution. Stages are pushed by the server over a long-lived
+// stream that is shared by all callers with the same filter.
+func (c *Client) Request(ctx context.Context, args *client.Filter) (*drone.Stage, error) {
+	if atomic.LoadInt32(&c.nostream) == 1 {
+		return c.Client.Request(ctx, args)
+	}
+	s := c.open(args)
+	select {
+	case stage := <-s.stages:
+		return stage, nil
+	case <-s.done:
+		c.reset(s)
+		if status.Code(s.err) == codes.Unimplemented {
+			atomic.StoreInt32(&c.nostream, 1)
+			return c.Client.Request(ctx, args)
+		}
+		return nil, s.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Batch batch writes logs to the build logs.
+func (c *Client) Batch(ctx context.Context, step int64, lines []*drone.Line) error {
+	err := c.invoke(ctx, methodBatch, step, lines)
+	if err == errFallback {
+		return c.Client.Batch(ctx, step, lines)
+	}
+	return err
+}
+
+// Upload uploads the full logs to the server.
+func (c *Client) Upload(ctx context.Context, step int64, lines []*drone.Line) error {
+	err := c.invoke(ctx, methodUpload, step, lines)
+	if err == errFallback {
+		return c.Client.Upload(ctx, step, lines)
+	}
+	return err
+}
+
+// Renew renews the machine-scoped stage lease, and updates
+// the stage version.
+func (c *Client) Renew(ctx context.Context, stage *drone.Stage) error {
+	out := new(drone.Stage)
+	err := c.conn.Invoke(ctx, methodLease, stage, out)
+	switch status.Code(err) {
+	case codes.OK:
+		stage.Updated = out.Updated
+		stage.Version = out.Version
+		return nil
+	case codes.Unimplemented:
+		return lease.ErrNotSupported
+	case codes.FailedPrecondition:
+		return lease.ErrLost
+	}
+	return err
+}
+
+// helper function invokes the log method, and returns
+// errFallback if the server does not implement the method.
+func (c *Client) invoke(ctx context.Context, method string, step int64, lines []*drone.Line) error {
+	if atomic.LoadInt32(&c.nologs) == 1 {
+		return errFallback
+	}
+	in := &logs{Step: step, Lines: lines}
+	if c.compress(lines) {
+		err := c.conn.Invoke(ctx, method, in, new(empty), grpc.UseCompressor(c.Compressor))
+		if status.Code(err) != codes.Unimplemented {
+			return err
+		}
+		// the server does not support the compressor, or does
+		// not implement the method, in which case the request
+		// is retried uncompressed.
+		atomic.StoreInt32(&c.nocompress, 1)
+	}
+	err := c.conn.Invoke(ctx, method, in, new(empty))
+	if status.Code(err) == codes.Unimplemented {
+		atomic.StoreInt32(&c.nologs, 1)
+		return errFallback
+	}
+	return err
+}
+
+// helper function returns true if the log lines should be
+// compressed.
+func (c *Client) compress(lines []*drone.Line) bool {
+	if c.Compressor == "" || atomic.LoadInt32(&c.nocompress) == 1 {
+		return false
+	}
+	var size int
+	for _, line := range lines {
+		size += len(line.Message)
+	}
+	return size >= c.Threshold
+}
+
+// helper function returns the open stage stream for the
+// filter, opening a new stream if none exists. The server
+// only pushes stages matching the filter sent when the stream
+// is opened, so callers with different filters never share
+// a stream.
+func (c *Client) open(args *client.Filter) *stream {
+	key := filterKey(args)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.streams[key]
+	if !ok {
+		s = newStream(key)
+		c.streams[key] = s
+		go s.run(c.conn, args, c.done)
+	}
+	return s
+}
+
+// helper function resets the closed stage stream, so the
+// next request with the same filter opens a new stream.
+func (c *Client) reset(s *stream) {
+	c.mu.Lock()
+	if c.streams[s.key] == s {
+		delete(c.streams, s.key)
+	}
+	c.mu.Unlock()
+}
+
+// helper function returns the key of the filter, which
+// identifies the stream of the filter. The labels are
+// encoded in key order.
+func filterKey(args *client.Filter) string {
+	data, _ := json.Marshal(args)
+	return string(data)
+}
+
+// stream receives stages pushed by the server.
+type stream struct {
+	key    string
+	stages chan *drone.Stage
+	done   chan struct{}
+	err    error
+}
+
+func newStream(key string) *stream {
+	return &stream{
+		key:    key,
+		stages: make(chan *drone.Stage),
+		done:   make(chan struct{}),
+	}
+}
+
+// run receives stages until the stream is closed. Each stage
+// is handed to the next waiting caller.
+func (s *stream) run(conn *grpc.ClientConn, args *client.Filter, closed <-chan struct{}) {
+	defer close(s.done)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	desc := &grpc.StreamDesc{ServerStreams: true}
+	cs, err := conn.NewStream(ctx, desc, methodStages)
+	if err != nil {
+		s.err = err
+		return
+	}
+	if err := cs.SendMsg(args); err != nil {
+		s.err = err
+		return
+	}
+	if err := cs.CloseSend(); err != nil {
+		s.err = err
+		return
+	}
+	for {
+		stage := new(drone.Stage)
+		if err := cs.RecvMsg(stage); err != nil {
+			s.err = err
+			return
+		}
+		select {
+		case s.stages <- stage:
+		case <-closed:
+			s.err = grpc.ErrClientConnClosing
+			return
+		}
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/compress"
+	"github.com/drone-runners/drone-runner-exec/internal/lease"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRequest(t *testing.T) {
+	srv := &fakeServer{stages: []*drone.Stage{{ID: 1}, {ID: 2}}}
+	c := dial(t, srv)
+	defer c.Close()
+
+	for _, want := range []int64{1, 2} {
+		stage, err := c.Request(context.Background(), &client.Filter{Kind: "pipeline"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stage.ID != want {
+			t.Errorf("Want stage %d, got %d", want, stage.ID)
+		}
+	}
+	if got := srv.filter.Kind; got != "pipeline" {
+		t.Errorf("Want filter sent to server, got kind %q", got)
+	}
+	if got := srv.token; got != "correct-horse-battery-staple" {
+		t.Errorf("Want token sent to server, got %q", got)
+	}
+}
+
+func TestRequest_Filters(t *testing.T) {
+	srv := &fakeServer{stages: []*drone.Stage{
+		{ID: 1, OS: "linux"},
+		{ID: 2, OS: "windows"},
+		{ID: 3, OS: "linux"},
+		{ID: 4, OS: "windows"},
+	}}
+	c := dial(t, srv)
+	defer c.Close()
+
+	for _, test := range []struct {
+		os   string
+		want int64
+	}{
+		{"linux", 1},
+		{"windows", 2},
+		{"linux", 3},
+		{"windows", 4},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		stage, err := c.Request(ctx, &client.Filter{Kind: "pipeline", OS: test.os})
+		cancel()
+		if err != nil {
+			t.Fatalf("Want stage %d for filter %s, got %v", test.want, test.os, err)
+		}
+		if stage.ID != test.want || stage.OS != test.os {
+			t.Errorf("Want stage %d for filter %s, got stage %d for %s", test.want, test.os, stage.ID, stage.OS)
+		}
+	}
+}
+
+func TestRequest_Timeout(t *testing.T) {
+	c := dial(t, &fakeServer{})
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Request(ctx, &client.Filter{}); err != context.DeadlineExceeded {
+		t.Errorf("Want deadline exceeded, got %v", err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	srv := &fakeServer{}
+	c := dial(t, srv)
+	defer c.Close()
+
+	lines := []*drone.Line{{Number: 1, Message: "hello"}}
+	if err := c.Batch(context.Background(), 3, lines); err != nil {
+		t.Fatal(err)
+	}
+	if srv.logs == nil || srv.logs.Step != 3 || len(srv.logs.Lines) != 1 {
+		t.Errorf("Want logs uploaded to the server, got %v", srv.logs)
+	}
+}
+
+func TestBatch_Compressed(t *testing.T) {
+	srv := &fakeServer{}
+	c := dial(t, srv)
+	c.Compressor = compress.Zstd
+	defer c.Close()
+
+	lines := []*drone.Line{{Number: 1, Message: "hello"}}
+	if !c.compress(lines) {
+		t.Errorf("Expect lines compressed")
+	}
+	if err := c.Batch(context.Background(), 3, lines); err != nil {
+		t.Fatal(err)
+	}
+	if srv.logs == nil || len(srv.logs.Lines) != 1 {
+		t.Errorf("Want compressed logs uploaded to the server, got %v", srv.logs)
+	}
+	c.Threshold = 100
+	if c.compress(lines) {
+		t.Errorf("Expect lines below threshold uncompressed")
+	}
+}
+
+func TestFallback(t *testing.T) {
+	fallback := &fakeClient{}
+	c := dial(t, nil)
+	c.Client = fallback
+	defer c.Close()
+
+	stage, err := c.Request(context.Background(), &client.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stage.ID != 42 {
+		t.Errorf("Want stage requested from the fallback client")
+	}
+	if err := c.Batch(context.Background(), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Upload(context.Background(), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if fallback.requests != 1 || fallback.logs != 2 {
+		t.Errorf("Want fallback client used, got %d requests and %d logs",
+			fallback.requests, fallback.logs)
+	}
+}
+
+func TestRenew(t *testing.T) {
+	c := dial(t, &fakeServer{})
+	defer c.Close()
+
+	stage := &drone.Stage{ID: 1, Machine: "runner-1"}
+	if err := c.Renew(context.Background(), stage); err != nil {
+		t.Fatal(err)
+	}
+	if stage.Version != 2 {
+		t.Errorf("Want stage version updated")
+	}
+	stage.Machine = "runner-2"
+	if err := c.Renew(context.Background(), stage); err != lease.ErrLost {
+		t.Errorf("Want ErrLost when stage leased by another machine, got %v", err)
+	}
+}
+
+func TestRenew_NotSupported(t *testing.T) {
+	c := dial(t, nil)
+	defer c.Close()
+	if err := c.Renew(context.Background(), &drone.Stage{}); err != lease.ErrNotSupported {
+		t.Errorf("Want ErrNotSupported, got %v", err)
+	}
+}
+
+// helper function starts a grpc server with the fake runner
+// service, and returns a client connected to the server. A
+// nil server does not implement the runner service.
+func dial(t *testing.T, srv *fakeServer) *Client {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := []grpc.ServerOption{grpc.ForceServerCodec(Codec{})}
+	if srv != nil {
+		opts = append(opts, grpc.UnknownServiceHandler(srv.handle))
+	}
+	server := grpc.NewServer(opts...)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	secret := func() string { return "correct-horse-battery-staple" }
+	c, err := Dial(lis.Addr().String(), secret, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+type fakeServer struct {
+	sync.Mutex
+	stages []*drone.Stage
+	filter client.Filter
+	token  string
+	logs   *logs
+}
+
+func (s *fakeServer) handle(srv interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	s.Lock()
+	if v := md.Get("x-drone-token"); len(v) != 0 {
+		s.token = v[0]
+	}
+	s.Unlock()
+
+	switch method {
+	case methodStages:
+		filter := client.Filter{}
+		err := stream.RecvMsg(&filter)
+		s.Lock()
+		s.filter = filter
+		stages := s.stages
+		s.Unlock()
+		if err != nil {
+			return err
+		}
+		for _, stage := range stages {
+			// the server only pushes stages matching the
+			// filter of the stream.
+			if filter.OS != "" && filter.OS != stage.OS {
+				continue
+			}
+			if err := stream.SendMsg(stage); err != nil {
+				return err
+			}
+		}
+		<-stream.Context().Done()
+		return nil
+	case methodBatch, methodUpload:
+		in := new(logs)
+		if err := stream.RecvMsg(in); err != nil {
+			return err
+		}
+		s.Lock()
+		s.logs = in
+		s.Unlock()
+		return stream.SendMsg(new(empty))
+	case methodLease:
+		in := new(drone.Stage)
+		if err := stream.RecvMsg(in); err != nil {
+			return err
+		}
+		if in.Machine != "runner-1" {
+			return status.Error(codes.FailedPrecondition, "stage leased by another machine")
+		}
+		return stream.SendMsg(&drone.Stage{ID: in.ID, Version: 2})
+	}
+	return status.Error(codes.Unimplemented, method)
+}
+
+type fakeClient struct {
+	client.Client
+	requests int
+	logs     int
+}
+
+func (c *fakeClient) Request(context.Context, *client.Filter) (*drone.Stage, error) {
+	c.requests++
+	return &drone.Stage{ID: 42}, nil
+}
+
+func (c *fakeClient) Batch(context.Context, int64, []*drone.Line) error {
+	c.logs++
+	return nil
+}
+
+func (c *fakeClient) Upload(context.Context, int64, []*drone.Line) error {
+	c.logs++
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package sandbox provides templated macOS sandbox profiles
+// that restrict the filesystem and network access of step
+// processes launched with sandbox-exec.
+package sandbox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"text/template"
+)
+
+// Default is the name of the default profile.
+const Default = "default"
+
+// deny is the profile used if the profile cannot be rendered,
+// which denies all operations.
+const deny = "(version 1)\n(deny default)\n"
+
+// defaultProfile restricts writes to the pipeline root and the
+// temporary directories, restricts reads of user directories
+// to the pipeline root, and restricts inbound connections to
+// the loopback interface.
+const defaultProfile = `(version 1)
+(allow default)
+
+(deny file-write*)
+(allow file-write*
+    (subpath "{{ .Root }}")
+    (subpath "{{ .Temp }}")
+    (subpath "/private/tmp")
+    (literal "/dev/null")
+    (literal "/dev/zero")
+    (literal "/dev/dtracehelper")
+    (regex #"^/dev/fd/")
+    (regex #"^/dev/tty"))
+
+(deny file-read* (subpath "/Users"))
+(allow file-read* (subpath "{{ .Root }}"))
+
+(deny network-inbound)
+(allow network-inbound (local ip "localhost:*"))
+(deny network-bind)
+(allow network-bind (local ip "localhost:*"))
+`
+
+// Data provides the template data of the profile.
+type Data struct {
+	// Root is the pipeline root directory.
+	Root string
+
+	// Workspace is the pipeline workspace directory.
+	Workspace string
+
+	// Temp is the temporary directory of the host.
+	Temp string
+}
+
+// Profile is a templated sandbox profile.
+type Profile struct {
+	tmpl *template.Template
+}
+
+// Load returns the named profile. The name is either the
+// default profile, or the path to a profile template.
+func Load(name string) (*Profile, error) {
+	text := defaultProfile
+	if name != Default {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+	return Parse(text)
+}
+
+// Parse parses the profile template. The template is rendered
+// with placeholder data, so that unknown fields are reported
+// when the profile is loaded instead of when a step executes.
+func Parse(text string) (*Profile, error) {
+	tmpl, err := template.New("sandbox").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(ioutil.Discard, Data{}); err != nil {
+		return nil, err
+	}
+	return &Profile{tmpl: tmpl}, nil
+}
+
+// Render returns the profile rendered with the data. If the
+// profile cannot be rendered, a profile that denies all
+// operations is returned, so that the step fails closed.
+//
+// The sandbox matches resolved paths, and the data paths are
+// therefore resolved before rendering (e.g. /var is a symbolic
+// link to /private/var).
+func (p *Profile) Render(data Data) string {
+	data.Root = resolve(data.Root)
+	data.Workspace = resolve(data.Workspace)
+	data.Temp = resolve(data.Temp)
+
+	var buf bytes.Buffer
+	if err := p.tmpl.Execute(&buf, data); err != nil {
+		return deny
+	}
+	return buf.String()
+}
+
+// helper function resolves the symbolic links of the path. The
+// path may not exist yet, in which case the longest existing
+// parent directory is resolved.
+func resolve(path string) string {
+	if path == "" {
+		return path
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	dir, file := filepath.Split(filepath.Clean(path))
+	if dir == "" || dir == path {
+		return path
+	}
+	return filepath.Join(resolve(filepath.Clean(dir)), file)
+}
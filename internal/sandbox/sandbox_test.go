@@ -0,0 +1,48 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	profile, err := Load(Default)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	got := profile.Render(Data{Root: "/tmp/drone-abc", Temp: "/tmp"})
+	if !strings.Contains(got, `(subpath "/tmp/drone-abc")`) {
+		t.Errorf("Expect profile rendered with the pipeline root")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []string{
+		`(allow file-write* (subpath "{{ .Root }"))`,
+		`(allow file-write* (subpath "{{ .Unknown }}"))`,
+	}
+	for _, test := range tests {
+		if _, err := Parse(test); err == nil {
+			t.Errorf("Expect error parsing profile %s", test)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Symlink(dir, filepath.Join(dir, "link")); err != nil {
+		t.Skip(err)
+	}
+	resolved, _ := filepath.EvalSymlinks(dir)
+	got := resolve(filepath.Join(dir, "link", "drone-abc", "src"))
+	if want := filepath.Join(resolved, "drone-abc", "src"); got != want {
+		t.Errorf("Want resolved path %s, got %s", want, got)
+	}
+}
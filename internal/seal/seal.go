@@ -0,0 +1,119 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package seal encrypts build data that is persisted on the
+// local host, such as log spools and stage outputs, at rest
+// with aes-256-gcm.
+package seal
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// KeySize is the size of the encryption key in bytes.
+const KeySize = 32
+
+// ErrInvalidKey is returned when the key is not a base64 or hex
+// encoded 32 byte key.
+var ErrInvalidKey = errors.New("seal: key must be a base64 or hex encoded 32 byte key")
+
+// errMalformed is returned when the sealed data is truncated.
+var errMalformed = errors.New("seal: malformed ciphertext")
+
+// Key encrypts and decrypts data.
+type Key struct {
+	aead cipher.AEAD
+}
+
+// New returns a new Key from the raw 32 byte key.
+func New(key []byte) (*Key, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Key{aead: aead}, nil
+}
+
+// Parse returns a new Key from the base64 or hex encoded key.
+func Parse(s string) (*Key, error) {
+	s = strings.TrimSpace(s)
+	if raw, err := hex.DecodeString(s); err == nil && len(raw) == KeySize {
+		return New(raw)
+	}
+	if raw, err := base64.StdEncoding.DecodeString(s); err == nil && len(raw) == KeySize {
+		return New(raw)
+	}
+	return nil, ErrInvalidKey
+}
+
+// Load returns a new Key from the encoded key, the file that
+// contains the encoded key, or the output of the command. The
+// command is used to decrypt the key with a key management
+// service, for example with the aws command line tool, and is
+// split into fields without a shell.
+func Load(key, file, command string) (*Key, error) {
+	switch {
+	case key != "":
+		return Parse(key)
+	case file != "":
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		return Parse(string(data))
+	case strings.TrimSpace(command) != "":
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		var stdout, stderr bytes.Buffer
+		args := strings.Fields(command)
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("seal: key command: %s: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return Parse(stdout.String())
+	default:
+		return nil, errors.New("seal: missing key")
+	}
+}
+
+// Seal encrypts the plaintext, and returns the nonce followed
+// by the ciphertext.
+func (k *Key) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open decrypts the data returned by Seal.
+func (k *Key) Open(data []byte) ([]byte, error) {
+	size := k.aead.NonceSize()
+	if len(data) < size {
+		return nil, errMalformed
+	}
+	return k.aead.Open(nil, data[:size], data[size:], nil)
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package seal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestSeal(t *testing.T) {
+	key, err := New(bytes.Repeat([]byte{1}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := key.Seal([]byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("hello world")) {
+		t.Errorf("Want plaintext encrypted")
+	}
+	opened, err := key.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(opened), "hello world"; got != want {
+		t.Errorf("Want plaintext %q, got %q", want, got)
+	}
+
+	// data sealed with a different key cannot be opened.
+	other, _ := New(bytes.Repeat([]byte{2}, KeySize))
+	if _, err := other.Open(sealed); err == nil {
+		t.Errorf("Want error opening data sealed with a different key")
+	}
+	if _, err := key.Open([]byte("short")); err == nil {
+		t.Errorf("Want error opening malformed data")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	raw := bytes.Repeat([]byte{1}, KeySize)
+	path := filepath.Join(t.TempDir(), "key")
+	ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(raw)+"\n"), 0600)
+
+	if _, err := Load(hex.EncodeToString(raw), "", ""); err != nil {
+		t.Errorf("Want hex encoded key loaded, got %s", err)
+	}
+	if _, err := Load("", path, ""); err != nil {
+		t.Errorf("Want key loaded from file, got %s", err)
+	}
+	if _, err := Load("c2hvcnQ=", "", ""); err != ErrInvalidKey {
+		t.Errorf("Want ErrInvalidKey for short key, got %v", err)
+	}
+	if _, err := Load("", "", ""); err == nil {
+		t.Errorf("Want error without key")
+	}
+}
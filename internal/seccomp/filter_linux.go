@@ -0,0 +1,127 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux,amd64 linux,arm64
+
+package seccomp
+
+import (
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// seccomp constants that are not defined by the unix package.
+const (
+	modeFilter = 1 // SECCOMP_SET_MODE_FILTER
+	flagTsync  = 1 // SECCOMP_FILTER_FLAG_TSYNC
+
+	retKillProcess = 0x80000000
+	retKillThread  = 0x00000000
+	retErrno       = 0x00050000
+	retLog         = 0x7ffc0000
+	retAllow       = 0x7fff0000
+)
+
+// offsets of the seccomp_data fields.
+const (
+	offsetNr   = 0
+	offsetArch = 4
+)
+
+// system calls numbers of the x32 abi have this bit set, and
+// are rejected so that they cannot be used to bypass the
+// filter on amd64.
+const x32SyscallBit = 0x40000000
+
+// Apply installs the profile filter for all threads of the
+// current process. The filter is inherited by child processes
+// and cannot be removed, and the process cannot gain new
+// privileges once the filter is installed.
+func (p *Profile) Apply() error {
+	program := p.compile()
+	prog := unix.SockFprog{
+		Len:    uint16(len(program)),
+		Filter: &program[0],
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return err
+	}
+	_, _, errno := unix.Syscall(unix.SYS_SECCOMP, modeFilter, flagTsync, uintptr(unsafe.Pointer(&prog)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// helper function compiles the profile to a bpf program. Names
+// of system calls that do not exist on the host architecture
+// are ignored, consistent with docker.
+func (p *Profile) compile() []unix.SockFilter {
+	program := []unix.SockFilter{
+		load(offsetArch),
+		jump(auditArch, 1, 0),
+		ret(retKillProcess),
+		load(offsetNr),
+	}
+	if auditArch == unix.AUDIT_ARCH_X86_64 {
+		program = append(program,
+			unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, Jt: 0, Jf: 1, K: x32SyscallBit},
+			ret(retKillProcess),
+		)
+	}
+	for _, syscall := range p.Syscalls {
+		if syscall.Action == p.DefaultAction {
+			continue
+		}
+		action := syscall.Action.ret()
+		for _, name := range syscall.Names {
+			nr, ok := syscalls[name]
+			if !ok {
+				continue
+			}
+			program = append(program, jump(nr, 0, 1), ret(action))
+		}
+	}
+	return append(program, ret(p.DefaultAction.ret()))
+}
+
+// helper function returns the filter return value of the action.
+func (a Action) ret() uint32 {
+	switch a {
+	case ActErrno:
+		return retErrno | uint32(unix.EPERM)
+	case ActKill:
+		return retKillThread
+	case ActKillProcess:
+		return retKillProcess
+	case ActLog:
+		return retLog
+	default:
+		return retAllow
+	}
+}
+
+// helper function returns an instruction that loads the word
+// at the offset of the seccomp data.
+func load(offset uint32) unix.SockFilter {
+	return unix.SockFilter{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: offset}
+}
+
+// helper function returns an instruction that skips jt
+// instructions if the loaded word equals the value, and jf
+// instructions otherwise.
+func jump(value uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: jt, Jf: jf, K: value}
+}
+
+// helper function returns an instruction that returns the value.
+func ret(value uint32) unix.SockFilter {
+	return unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: value}
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux,amd64 linux,arm64
+
+package seccomp
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCompile(t *testing.T) {
+	profile := &Profile{
+		DefaultAction: ActAllow,
+		Syscalls: []*Syscall{
+			{Names: []string{"mount", "not_a_syscall"}, Action: ActErrno},
+			{Names: []string{"read"}, Action: ActAllow},
+		},
+	}
+	program := profile.compile()
+
+	if got, want := program[len(program)-1], ret(retAllow); got != want {
+		t.Errorf("Want default instruction %v, got %v", want, got)
+	}
+
+	var matched []uint32
+	for i, inst := range program {
+		if inst.Code == unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K && inst.K != auditArch {
+			matched = append(matched, inst.K)
+			if got, want := program[i+1], ret(retErrno|uint32(unix.EPERM)); got != want {
+				t.Errorf("Want errno instruction %v, got %v", want, got)
+			}
+		}
+	}
+	if len(matched) != 1 || matched[0] != unix.SYS_MOUNT {
+		t.Errorf("Want only the mount syscall matched, got %v", matched)
+	}
+}
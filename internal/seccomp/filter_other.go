@@ -0,0 +1,13 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux linux,!amd64,!arm64
+
+package seccomp
+
+// Apply returns an error. Seccomp filters are only supported
+// on linux amd64 and arm64.
+func (p *Profile) Apply() error {
+	return ErrUnsupported
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package seccomp provides seccomp profiles that restrict the
+// system calls of step processes. Profiles use a subset of the
+// docker seccomp profile format.
+package seccomp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Default is the name of the default profile.
+const Default = "default"
+
+// Action defines the action taken when a system call matches.
+type Action string
+
+// Action enumeration.
+const (
+	ActAllow       Action = "SCMP_ACT_ALLOW"
+	ActErrno       Action = "SCMP_ACT_ERRNO"
+	ActKill        Action = "SCMP_ACT_KILL"
+	ActKillProcess Action = "SCMP_ACT_KILL_PROCESS"
+	ActLog         Action = "SCMP_ACT_LOG"
+)
+
+// ErrUnsupported is returned when seccomp filters are not
+// supported by the host platform.
+var ErrUnsupported = errors.New("seccomp is not supported on this platform")
+
+type (
+	// Profile defines the seccomp profile.
+	Profile struct {
+		DefaultAction Action     `json:"defaultAction"`
+		Syscalls      []*Syscall `json:"syscalls"`
+	}
+
+	// Syscall defines the action taken for the named
+	// system calls.
+	Syscall struct {
+		Names  []string `json:"names"`
+		Action Action   `json:"action"`
+	}
+)
+
+// DefaultProfile returns the default profile, which permits
+// system calls by default, and denies system calls that mount
+// filesystems, load kernel modules, change the system clock,
+// escape the process namespaces, or inspect other processes.
+func DefaultProfile() *Profile {
+	return &Profile{
+		DefaultAction: ActAllow,
+		Syscalls: []*Syscall{
+			{
+				Action: ActErrno,
+				Names: []string{
+					"acct",
+					"add_key",
+					"bpf",
+					"clock_adjtime",
+					"clock_settime",
+					"delete_module",
+					"finit_module",
+					"init_module",
+					"kexec_file_load",
+					"kexec_load",
+					"keyctl",
+					"mount",
+					"move_mount",
+					"open_by_handle_at",
+					"perf_event_open",
+					"pivot_root",
+					"process_vm_readv",
+					"process_vm_writev",
+					"ptrace",
+					"reboot",
+					"request_key",
+					"setns",
+					"settimeofday",
+					"swapoff",
+					"swapon",
+					"umount2",
+					"unshare",
+					"userfaultfd",
+				},
+			},
+		},
+	}
+}
+
+// Load returns the named profile. The name is either the
+// default profile, or the path to a json profile.
+func Load(name string) (*Profile, error) {
+	if name == Default {
+		return DefaultProfile(), nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates the json profile.
+func Parse(data []byte) (*Profile, error) {
+	profile := new(Profile)
+	if err := json.Unmarshal(data, profile); err != nil {
+		return nil, fmt.Errorf("cannot parse seccomp profile: %s", err)
+	}
+	if err := profile.validate(); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// helper function returns an error if the profile uses an
+// unsupported action.
+func (p *Profile) validate() error {
+	if p.DefaultAction == "" {
+		return errors.New("seccomp profile requires a default action")
+	}
+	if !p.DefaultAction.valid() {
+		return fmt.Errorf("unsupported seccomp action %q", p.DefaultAction)
+	}
+	for _, syscall := range p.Syscalls {
+		if !syscall.Action.valid() {
+			return fmt.Errorf("unsupported seccomp action %q", syscall.Action)
+		}
+	}
+	return nil
+}
+
+// helper function returns true if the action is supported.
+func (a Action) valid() bool {
+	switch a {
+	case ActAllow, ActErrno, ActKill, ActKillProcess, ActLog:
+		return true
+	default:
+		return false
+	}
+}
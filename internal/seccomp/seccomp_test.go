@@ -0,0 +1,52 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package seccomp
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	profile, err := Parse([]byte(`{
+		"defaultAction": "SCMP_ACT_ERRNO",
+		"syscalls": [{"names": ["read", "write"], "action": "SCMP_ACT_ALLOW"}]
+	}`))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := profile.DefaultAction, ActErrno; got != want {
+		t.Errorf("Want default action %s, got %s", want, got)
+	}
+	if got, want := len(profile.Syscalls), 1; got != want {
+		t.Errorf("Want %d syscall rules, got %d", want, got)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []string{
+		`{`,
+		`{"syscalls": []}`,
+		`{"defaultAction": "SCMP_ACT_TRAP"}`,
+		`{"defaultAction": "SCMP_ACT_ALLOW", "syscalls": [{"names": ["mount"], "action": "SCMP_ACT_TRACE"}]}`,
+	}
+	for _, test := range tests {
+		if _, err := Parse([]byte(test)); err == nil {
+			t.Errorf("Expect error parsing profile %s", test)
+		}
+	}
+}
+
+func TestLoad_Default(t *testing.T) {
+	profile, err := Load(Default)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := profile.validate(); err != nil {
+		t.Error(err)
+	}
+	if got, want := profile.DefaultAction, ActAllow; got != want {
+		t.Errorf("Want default action %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package secretmeta provides the expiry and rotation metadata
+// of secrets, which is used to warn when a build uses a secret
+// that is nearly expired.
+package secretmeta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/buildkite/yaml"
+)
+
+// Metadata describes the lifecycle of a secret.
+type Metadata struct {
+	// Name is the secret name, which may be a glob pattern.
+	Name string `yaml:"name"`
+
+	// Repo is an optional repository slug, which may be a glob
+	// pattern. If empty, the metadata applies to all
+	// repositories.
+	Repo string `yaml:"repo"`
+
+	// Expires is the time the secret expires.
+	Expires time.Time `yaml:"-"`
+
+	// Rotated is the time the secret was last rotated.
+	Rotated time.Time `yaml:"-"`
+}
+
+// Provider provides the metadata of secrets. Secret providers
+// that track the lifecycle of secrets may implement Provider.
+type Provider interface {
+	// Find returns the metadata of the named secret, or nil
+	// if the metadata is unknown.
+	Find(ctx context.Context, repo, name string) (*Metadata, error)
+}
+
+// file is the yaml representation of the metadata, where
+// times are formatted as RFC 3339 timestamps or dates.
+type file struct {
+	Metadata `yaml:",inline"`
+	Expires  string `yaml:"expires"`
+	Rotated  string `yaml:"rotated"`
+}
+
+// Load loads the secret metadata from a yaml file.
+func Load(path string) (Provider, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []*file
+	if err := yaml.Unmarshal(raw, &files); err != nil {
+		return nil, err
+	}
+	var items []*Metadata
+	for _, src := range files {
+		dst := src.Metadata
+		if dst.Name == "" {
+			return nil, errors.New("invalid or missing secret name")
+		}
+		if _, err := filepath.Match(dst.Name, ""); err != nil {
+			return nil, fmt.Errorf("secret %q: invalid name pattern", dst.Name)
+		}
+		if dst.Expires, err = parseTime(src.Expires); err != nil {
+			return nil, fmt.Errorf("secret %q: invalid expiry: %s", dst.Name, err)
+		}
+		if dst.Rotated, err = parseTime(src.Rotated); err != nil {
+			return nil, fmt.Errorf("secret %q: invalid rotation: %s", dst.Name, err)
+		}
+		items = append(items, &dst)
+	}
+	return Static(items), nil
+}
+
+// Static returns a Provider that finds the secret metadata in
+// a static list. The first matching item is returned.
+func Static(items []*Metadata) Provider {
+	return static(items)
+}
+
+type static []*Metadata
+
+func (s static) Find(ctx context.Context, repo, name string) (*Metadata, error) {
+	for _, item := range s {
+		if ok, _ := filepath.Match(item.Name, name); !ok {
+			continue
+		}
+		if item.Repo != "" {
+			if ok, _ := filepath.Match(item.Repo, repo); !ok {
+				continue
+			}
+		}
+		return item, nil
+	}
+	return nil, nil
+}
+
+// helper function parses the RFC 3339 timestamp or date.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
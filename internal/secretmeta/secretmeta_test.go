@@ -0,0 +1,69 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package secretmeta
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.yml")
+	ioutil.WriteFile(path, []byte(`
+- name: aws_*
+  repo: octocat/*
+  expires: 2030-01-02T15:04:05Z
+  rotated: 2029-01-01
+- name: docker_password
+  expires: 2030-06-01
+`), 0600)
+
+	provider, err := Load(path)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	meta, err := provider.Find(context.Background(), "octocat/hello-world", "aws_access_key")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if meta == nil {
+		t.Errorf("Want metadata for matching secret")
+		return
+	}
+	if got, want := meta.Expires, time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Want expiry %s, got %s", want, got)
+	}
+	if got, want := meta.Rotated, time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Want rotation %s, got %s", want, got)
+	}
+
+	// the metadata is scoped to the repository pattern.
+	if meta, _ := provider.Find(context.Background(), "spaceghost/hello-world", "aws_access_key"); meta != nil {
+		t.Errorf("Want no metadata for unmatched repository")
+	}
+	if meta, _ := provider.Find(context.Background(), "spaceghost/hello-world", "docker_password"); meta == nil {
+		t.Errorf("Want metadata for secret without repository pattern")
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []string{
+		`- expires: 2030-01-01`,
+		`- { name: token, expires: tomorrow }`,
+		`- { name: "[", expires: 2030-01-01 }`,
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "secrets.yml")
+		ioutil.WriteFile(path, []byte(test), 0600)
+		if _, err := Load(path); err == nil {
+			t.Errorf("Expect error loading metadata %s", test)
+		}
+	}
+}
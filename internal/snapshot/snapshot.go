@@ -0,0 +1,175 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package snapshot records the state of the host machine when
+// a stage starts, so that differences in host state between
+// consecutive builds can be reported.
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timeout for each command used to snapshot the host.
+const commandTimeout = 10 * time.Second
+
+// Config configures the host snapshot.
+type Config struct {
+	// Packages enables listing the installed package versions
+	// using the host package manager.
+	Packages bool
+
+	// Tools maps tool names to the command used to print the
+	// tool version (e.g. go:go version).
+	Tools map[string]string
+}
+
+// Snapshot is the recorded host state.
+type Snapshot struct {
+	Packages map[string]string `json:"packages,omitempty"`
+	Tools    map[string]string `json:"tools,omitempty"`
+	Environ  []string          `json:"environ,omitempty"`
+}
+
+// Take records the host state. Commands that fail are
+// ignored, since the snapshot is diagnostic.
+func Take(ctx context.Context, config Config) *Snapshot {
+	snapshot := &Snapshot{
+		Tools: map[string]string{},
+	}
+	for name, command := range config.Tools {
+		args := strings.Fields(command)
+		if len(args) == 0 {
+			continue
+		}
+		out, err := run(ctx, args[0], args[1:]...)
+		if err != nil {
+			snapshot.Tools[name] = "not found"
+			continue
+		}
+		line, _, _ := strings.Cut(strings.TrimSpace(out), "\n")
+		snapshot.Tools[name] = strings.TrimSpace(line)
+	}
+	if config.Packages {
+		snapshot.Packages = packages(ctx)
+	}
+	// only the variable names are recorded, since the values
+	// may be sensitive.
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		snapshot.Environ = append(snapshot.Environ, name)
+	}
+	sort.Strings(snapshot.Environ)
+	return snapshot
+}
+
+// Diff returns the differences between the previous and the
+// next snapshot, in sorted order.
+func Diff(prev, next *Snapshot) []string {
+	var diff []string
+	diff = append(diff, diffMap("package", prev.Packages, next.Packages)...)
+	diff = append(diff, diffMap("tool", prev.Tools, next.Tools)...)
+
+	names := map[string]bool{}
+	for _, name := range prev.Environ {
+		names[name] = false
+	}
+	for _, name := range next.Environ {
+		if _, ok := names[name]; !ok {
+			diff = append(diff, fmt.Sprintf("environment variable %s added", name))
+		}
+		names[name] = true
+	}
+	for _, name := range prev.Environ {
+		if !names[name] {
+			diff = append(diff, fmt.Sprintf("environment variable %s removed", name))
+		}
+	}
+	return diff
+}
+
+// helper function returns the differences between two maps of
+// versions, in sorted order.
+func diffMap(kind string, prev, next map[string]string) []string {
+	var diff []string
+	for name, version := range next {
+		old, ok := prev[name]
+		switch {
+		case !ok:
+			diff = append(diff, fmt.Sprintf("%s %s added (%s)", kind, name, version))
+		case old != version:
+			diff = append(diff, fmt.Sprintf("%s %s changed from %s to %s", kind, name, old, version))
+		}
+	}
+	for name := range prev {
+		if _, ok := next[name]; !ok {
+			diff = append(diff, fmt.Sprintf("%s %s removed", kind, name))
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// package managers used to list the installed packages, in
+// order of preference. The output is parsed as name=version
+// lines, or name version lines.
+var managers = [][]string{
+	{"dpkg-query", "-W", "-f", "${Package}=${Version}\n"},
+	{"rpm", "-qa", "--qf", "%{NAME}=%{VERSION}-%{RELEASE}\n"},
+	{"pkg", "query", "%n=%v"},
+	{"brew", "list", "--versions"},
+}
+
+// helper function returns the installed package versions
+// using the first package manager found on the host.
+func packages(ctx context.Context) map[string]string {
+	for _, args := range managers {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		out, err := run(ctx, args[0], args[1:]...)
+		if err != nil {
+			continue
+		}
+		return parsePackages(out)
+	}
+	return nil
+}
+
+// helper function parses the package list.
+func parsePackages(out string) map[string]string {
+	packages := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		name, version, ok := strings.Cut(line, "=")
+		if !ok {
+			name, version, ok = strings.Cut(line, " ")
+		}
+		if ok && name != "" {
+			packages[name] = strings.TrimSpace(version)
+		}
+	}
+	return packages
+}
+
+// helper function runs the command and returns the output.
+func run(ctx context.Context, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+	var buf bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	err := cmd.Run()
+	return buf.String(), err
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package snapshot
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiff(t *testing.T) {
+	prev := &Snapshot{
+		Packages: map[string]string{"git": "2.39.2", "openssl": "3.0.11", "curl": "7.88.1"},
+		Tools:    map[string]string{"go": "go version go1.21.1 linux/amd64"},
+		Environ:  []string{"HOME", "PATH", "GOPATH"},
+	}
+	next := &Snapshot{
+		Packages: map[string]string{"git": "2.39.2", "openssl": "3.0.13", "jq": "1.6"},
+		Tools:    map[string]string{"go": "go version go1.22.0 linux/amd64"},
+		Environ:  []string{"HOME", "PATH", "GOFLAGS"},
+	}
+	want := []string{
+		"package curl removed",
+		"package jq added (1.6)",
+		"package openssl changed from 3.0.11 to 3.0.13",
+		"tool go changed from go version go1.21.1 linux/amd64 to go version go1.22.0 linux/amd64",
+		"environment variable GOFLAGS added",
+		"environment variable GOPATH removed",
+	}
+	if diff := cmp.Diff(want, Diff(prev, next)); diff != "" {
+		t.Errorf("Unexpected snapshot diff")
+		t.Log(diff)
+	}
+	if got := Diff(next, next); len(got) != 0 {
+		t.Errorf("Expect no diff for identical snapshots, got %v", got)
+	}
+}
+
+func TestParsePackages(t *testing.T) {
+	got := parsePackages("git=1:2.39.2-1\nopenssl=3.0.11\n\nnode 20.5.0 18.17.1\n")
+	want := map[string]string{
+		"git":     "1:2.39.2-1",
+		"openssl": "3.0.11",
+		"node":    "20.5.0 18.17.1",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Unexpected packages")
+		t.Log(diff)
+	}
+}
+
+func TestDir(t *testing.T) {
+	store := Dir(t.TempDir())
+	first := &Snapshot{Tools: map[string]string{"go": "go1.21"}}
+	prev, err := store.Swap("octocat/hello-world", first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prev != nil {
+		t.Errorf("Expect no previous snapshot")
+	}
+	prev, err = store.Swap("octocat/hello-world", &Snapshot{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(first, prev); diff != "" {
+		t.Errorf("Expect previous snapshot returned")
+		t.Log(diff)
+	}
+}
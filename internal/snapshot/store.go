@@ -0,0 +1,89 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package snapshot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store stores the most recent snapshot of each repository.
+type Store interface {
+	// Swap stores the snapshot, and returns the previous
+	// snapshot of the repository, or nil if not found.
+	Swap(repo string, snapshot *Snapshot) (*Snapshot, error)
+}
+
+// Memory returns a Store that stores the snapshots in memory.
+func Memory() Store {
+	return &memory{items: map[string]*Snapshot{}}
+}
+
+type memory struct {
+	mu    sync.Mutex
+	items map[string]*Snapshot
+}
+
+func (m *memory) Swap(repo string, snapshot *Snapshot) (*Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prev := m.items[repo]
+	m.items[repo] = snapshot
+	return prev, nil
+}
+
+// Dir returns a Store that stores the snapshots in a directory,
+// which can be shared by runners using a network file system
+// to compare host state across runners.
+func Dir(path string) Store {
+	return &dir{path: path}
+}
+
+type dir struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (d *dir) Swap(repo string, snapshot *Snapshot) (*Snapshot, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	path := filepath.Join(d.path, filepath.FromSlash(repo)+".json")
+	var prev *Snapshot
+	if data, err := ioutil.ReadFile(path); err == nil {
+		prev = new(Snapshot)
+		if err := json.Unmarshal(data, prev); err != nil {
+			prev = nil
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return prev, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return prev, err
+	}
+	// the snapshot is written to a temporary file which is
+	// renamed, so that readers never observe a partial write.
+	temp, err := ioutil.TempFile(filepath.Dir(path), ".snapshot")
+	if err != nil {
+		return prev, err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return prev, err
+	}
+	if err := temp.Close(); err != nil {
+		return prev, err
+	}
+	return prev, os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,189 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package sso
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// cookie names.
+const (
+	sessionCookie = "drone_session"
+	loginCookie   = "drone_login"
+)
+
+var errInvalidCookie = errors.New("sso: invalid cookie")
+
+// Session is an authenticated dashboard session.
+type Session struct {
+	ID      string   `json:"id"`
+	User    string   `json:"user"`
+	Groups  []string `json:"groups,omitempty"`
+	Expires int64    `json:"expires"`
+}
+
+// Token returns the csrf token of the session, which must be
+// included with administrative actions performed with the
+// session.
+func (p *Provider) Token(session *Session) string {
+	return p.sign("csrf:" + session.ID)
+}
+
+// VerifyToken returns true if the token is the csrf token of
+// the session.
+func (p *Provider) VerifyToken(session *Session, token string) bool {
+	return token != "" && hmac.Equal([]byte(token), []byte(p.Token(session)))
+}
+
+// Revoke revokes the session, so that the session cookie is
+// rejected if replayed after logout.
+func (p *Provider) Revoke(session *Session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now().Unix()
+	for id, expires := range p.revoked {
+		if now > expires {
+			delete(p.revoked, id)
+		}
+	}
+	p.revoked[session.ID] = session.Expires
+}
+
+// helper function returns true if the session is revoked.
+func (p *Provider) isRevoked(session *Session) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.revoked[session.ID]
+	return ok
+}
+
+// helper function returns true if the user is a member of
+// any of the groups.
+func (s *Session) member(groups []string) bool {
+	for _, group := range groups {
+		for _, g := range s.Groups {
+			if g == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// helper function returns the cookie. The cookie is marked
+// secure when the callback is served over https.
+func (p *Provider) cookie(name, value string, maxAge time.Duration) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(p.config.RedirectURL, "https:"),
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(maxAge / time.Second),
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// helper function encodes and signs the value.
+func (p *Provider) encode(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + p.sign(payload), nil
+}
+
+// helper function verifies and decodes the value.
+func (p *Provider) decode(s string, v interface{}) error {
+	i := strings.LastIndexByte(s, '.')
+	if i == -1 {
+		return errInvalidCookie
+	}
+	payload, sig := s[:i], s[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(p.sign(payload))) {
+		return errInvalidCookie
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return errInvalidCookie
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (p *Provider) sign(payload string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// claims are the identity token claims.
+type claims map[string]interface{}
+
+func (c claims) string(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// helper function returns the user name, preferring the
+// username over the email address and subject.
+func (c claims) user() string {
+	for _, name := range []string{"preferred_username", "email", "sub"} {
+		if s := c.string(name); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// helper function returns the groups listed by the claim,
+// which may be a list or a single string.
+func (c claims) groups(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var groups []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+// helper function returns true if the audience includes the
+// client id. The audience may be a list or a single string.
+func (c claims) audience(clientID string) bool {
+	switch v := c["aud"].(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, item := range v {
+			if item == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c claims) expired(now time.Time) bool {
+	exp, ok := c["exp"].(float64)
+	return !ok || now.Unix() > int64(exp)
+}
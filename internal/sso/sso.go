@@ -0,0 +1,399 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package sso implements dashboard login using the openid
+// connect authorization code flow. The identity token is
+// received directly from the token endpoint over tls, and is
+// therefore not verified using the provider signing keys, as
+// permitted by the openid connect core specification.
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Endpoint paths.
+const (
+	LoginPath    = "/auth/login"
+	CallbackPath = "/auth/callback"
+	LogoutPath   = "/auth/logout"
+	SessionPath  = "/auth/session"
+)
+
+// TokenHeader is the request header that carries the csrf
+// token. The token may also be submitted as the csrf_token
+// form value.
+const TokenHeader = "X-CSRF-Token"
+
+// Config configures the openid connect provider.
+type Config struct {
+	// Issuer is the provider issuer url, used to discover the
+	// authorization and token endpoints.
+	Issuer string
+
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is the absolute url of the callback
+	// endpoint, registered with the provider.
+	RedirectURL string
+
+	// Scopes are the requested scopes, defaults to openid,
+	// profile and email.
+	Scopes []string
+
+	// GroupsClaim is the identity token claim that lists the
+	// user groups, defaults to groups.
+	GroupsClaim string
+
+	// Groups optionally limits dashboard access to members of
+	// the groups. If empty, all authenticated users have access.
+	Groups []string
+
+	// AdminGroups limits administrative actions to members of
+	// the groups. If empty, administrative actions are denied.
+	AdminGroups []string
+
+	// Secret is the key used to sign session cookies. If empty,
+	// a random key is generated, and sessions do not survive
+	// a restart.
+	Secret string
+
+	// Timeout is the session timeout, defaults to 8 hours.
+	Timeout time.Duration
+
+	// Client is the http client, defaults to the default
+	// http client.
+	Client *http.Client
+}
+
+// Provider implements dashboard login with the openid connect
+// provider.
+type Provider struct {
+	config   Config
+	key      []byte
+	authURL  string
+	tokenURL string
+
+	mu      sync.Mutex
+	revoked map[string]int64
+}
+
+// New returns a new Provider. The provider endpoints are
+// discovered using the issuer url.
+func New(ctx context.Context, config Config) (*Provider, error) {
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 8 * time.Hour
+	}
+	key := []byte(config.Secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	endpoint := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := config.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sso: cannot discover provider: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		return nil, fmt.Errorf("sso: cannot discover provider: unexpected status code %d", res.StatusCode)
+	}
+	out := new(discovery)
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("sso: cannot discover provider: %s", err)
+	}
+	if out.AuthURL == "" || out.TokenURL == "" {
+		return nil, errors.New("sso: provider does not advertise the authorization and token endpoints")
+	}
+	return &Provider{
+		config:   config,
+		key:      key,
+		authURL:  out.AuthURL,
+		tokenURL: out.TokenURL,
+		revoked:  map[string]int64{},
+	}, nil
+}
+
+type discovery struct {
+	AuthURL  string `json:"authorization_endpoint"`
+	TokenURL string `json:"token_endpoint"`
+}
+
+// Handler returns an http.Handler that serves the login,
+// callback, logout and session endpoints.
+func (p *Provider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(LoginPath, p.handleLogin)
+	mux.HandleFunc(CallbackPath, p.handleCallback)
+	mux.HandleFunc(LogoutPath, p.handleLogout)
+	mux.HandleFunc(SessionPath, p.handleSession)
+	return mux
+}
+
+// Session returns the session of the request, or nil if the
+// request has no valid session.
+func (p *Provider) Session(r *http.Request) *Session {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil
+	}
+	session := new(Session)
+	if err := p.decode(cookie.Value, session); err != nil {
+		return nil
+	}
+	if time.Now().Unix() > session.Expires || p.isRevoked(session) {
+		return nil
+	}
+	return session
+}
+
+// RequestToken returns the csrf token submitted with the
+// request.
+func RequestToken(r *http.Request) string {
+	if token := r.Header.Get(TokenHeader); token != "" {
+		return token
+	}
+	return r.FormValue("csrf_token")
+}
+
+// CanView returns true if the session user is permitted to
+// view the dashboard.
+func (p *Provider) CanView(session *Session) bool {
+	return len(p.config.Groups) == 0 ||
+		session.member(p.config.Groups) ||
+		session.member(p.config.AdminGroups)
+}
+
+// CanAdmin returns true if the session user is permitted to
+// perform administrative actions.
+func (p *Provider) CanAdmin(session *Session) bool {
+	return session.member(p.config.AdminGroups)
+}
+
+// LoginURL returns the url of the login endpoint, which
+// returns to the path after login.
+func LoginURL(path string) string {
+	return LoginPath + "?return=" + url.QueryEscape(path)
+}
+
+func (p *Provider) handleLogin(w http.ResponseWriter, r *http.Request) {
+	login := &login{
+		State:  random(),
+		Nonce:  random(),
+		Return: safeReturn(r.FormValue("return")),
+	}
+	value, err := p.encode(login)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, p.cookie(loginCookie, value, 10*time.Minute))
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.config.ClientID)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("scope", strings.Join(p.config.Scopes, " "))
+	v.Set("state", login.State)
+	v.Set("nonce", login.Nonce)
+	sep := "?"
+	if strings.Contains(p.authURL, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, p.authURL+sep+v.Encode(), http.StatusFound)
+}
+
+func (p *Provider) handleCallback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(loginCookie)
+	if err != nil {
+		http.Error(w, "sso: login expired", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, p.cookie(loginCookie, "", -1))
+	login := new(login)
+	if err := p.decode(cookie.Value, login); err != nil || login.State != r.FormValue("state") {
+		http.Error(w, "sso: invalid login state", http.StatusBadRequest)
+		return
+	}
+	if msg := r.FormValue("error"); msg != "" {
+		http.Error(w, "sso: "+msg, http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := p.exchange(r.Context(), r.FormValue("code"), login.Nonce)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	session := &Session{
+		ID:      random(),
+		User:    claims.user(),
+		Groups:  claims.groups(p.config.GroupsClaim),
+		Expires: time.Now().Add(p.config.Timeout).Unix(),
+	}
+	if !p.CanView(session) {
+		http.Error(w, "sso: access denied", http.StatusForbidden)
+		return
+	}
+	value, err := p.encode(session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, p.cookie(sessionCookie, value, p.config.Timeout))
+	http.Redirect(w, r, login.Return, http.StatusFound)
+}
+
+// the logout endpoint requires the csrf token, to prevent
+// other sites from ending the session.
+func (p *Provider) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if session := p.Session(r); session != nil {
+		if !p.VerifyToken(session, RequestToken(r)) {
+			http.Error(w, "sso: invalid csrf token", http.StatusForbidden)
+			return
+		}
+		p.Revoke(session)
+	}
+	http.SetCookie(w, p.cookie(sessionCookie, "", -1))
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// the session endpoint returns the session user, and the csrf
+// token required to perform administrative actions.
+func (p *Provider) handleSession(w http.ResponseWriter, r *http.Request) {
+	session := p.Session(r)
+	if session == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(&sessionResponse{
+		User:    session.User,
+		Groups:  session.Groups,
+		Admin:   p.CanAdmin(session),
+		Expires: session.Expires,
+		Token:   p.Token(session),
+	})
+}
+
+type sessionResponse struct {
+	User    string   `json:"user"`
+	Groups  []string `json:"groups,omitempty"`
+	Admin   bool     `json:"admin"`
+	Expires int64    `json:"expires"`
+	Token   string   `json:"csrf_token"`
+}
+
+// helper function exchanges the authorization code for the
+// identity token, and returns the validated token claims.
+func (p *Provider) exchange(ctx context.Context, code, nonce string) (claims, error) {
+	v := url.Values{}
+	v.Set("grant_type", "authorization_code")
+	v.Set("code", code)
+	v.Set("redirect_uri", p.config.RedirectURL)
+	v.Set("client_id", p.config.ClientID)
+	v.Set("client_secret", p.config.ClientSecret)
+	req, err := http.NewRequestWithContext(ctx, "POST", p.tokenURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	res, err := p.config.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sso: cannot exchange code: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		return nil, fmt.Errorf("sso: cannot exchange code: unexpected status code %d", res.StatusCode)
+	}
+	out := new(tokenResponse)
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("sso: cannot exchange code: %s", err)
+	}
+
+	parts := strings.Split(out.IDToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("sso: malformed identity token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("sso: malformed identity token")
+	}
+	c := claims{}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return nil, errors.New("sso: malformed identity token")
+	}
+	switch {
+	case strings.TrimSuffix(c.string("iss"), "/") != strings.TrimSuffix(p.config.Issuer, "/"):
+		return nil, errors.New("sso: identity token has an invalid issuer")
+	case !c.audience(p.config.ClientID):
+		return nil, errors.New("sso: identity token has an invalid audience")
+	case c.string("nonce") != nonce:
+		return nil, errors.New("sso: identity token has an invalid nonce")
+	case c.expired(time.Now()):
+		return nil, errors.New("sso: identity token is expired")
+	}
+	return c, nil
+}
+
+type tokenResponse struct {
+	IDToken string `json:"id_token"`
+}
+
+type login struct {
+	State  string `json:"state"`
+	Nonce  string `json:"nonce"`
+	Return string `json:"return"`
+}
+
+// helper function returns a random url-safe string.
+func random() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// helper function returns the path if it is a local path, to
+// prevent redirects to other sites.
+func safeReturn(path string) string {
+	if !strings.HasPrefix(path, "/") ||
+		strings.HasPrefix(path, "//") ||
+		strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,194 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package sso
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestLogin(t *testing.T) {
+	var nonce string
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"authorization_endpoint": ts.URL + "/authorize",
+				"token_endpoint":         ts.URL + "/token",
+			})
+		case "/token":
+			if r.FormValue("code") != "valid-code" || r.FormValue("client_secret") != "correct-horse" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{
+				"id_token": token(map[string]interface{}{
+					"iss":                ts.URL,
+					"aud":                []string{"runner"},
+					"exp":                time.Now().Add(time.Minute).Unix(),
+					"nonce":              nonce,
+					"preferred_username": "octocat",
+					"groups":             []string{"developers", "sre"},
+				}),
+			})
+		}
+	}))
+	defer ts.Close()
+
+	provider, err := New(context.Background(), Config{
+		Issuer:       ts.URL,
+		ClientID:     "runner",
+		ClientSecret: "correct-horse",
+		RedirectURL:  "http://runner.company.com/auth/callback",
+		Groups:       []string{"developers"},
+		AdminGroups:  []string{"sre"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := provider.Handler()
+
+	// the login endpoint redirects to the provider.
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/auth/login?return=/view?id=1", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("Want login redirect, got status %d", w.Code)
+	}
+	location, _ := url.Parse(w.Header().Get("Location"))
+	if got, want := location.Path, "/authorize"; got != want {
+		t.Errorf("Want redirect to %s, got %s", want, got)
+	}
+	state := location.Query().Get("state")
+	nonce = location.Query().Get("nonce")
+	login := w.Result().Cookies()[0]
+
+	// the callback endpoint rejects a mismatched state.
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/auth/callback?code=valid-code&state=forged", nil)
+	r.AddCookie(login)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Want mismatched state rejected, got status %d", w.Code)
+	}
+
+	// the callback endpoint creates the session.
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/auth/callback?code=valid-code&state="+state, nil)
+	r.AddCookie(login)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Want redirect after login, got status %d: %s", w.Code, w.Body)
+	}
+	if got, want := w.Header().Get("Location"), "/view?id=1"; got != want {
+		t.Errorf("Want redirect to %s, got %s", want, got)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == sessionCookie {
+			r.AddCookie(cookie)
+		}
+	}
+	session := provider.Session(r)
+	if session == nil {
+		t.Fatalf("Want session")
+	}
+	if session.User != "octocat" {
+		t.Errorf("Want session user octocat, got %s", session.User)
+	}
+	if !provider.CanView(session) || !provider.CanAdmin(session) {
+		t.Errorf("Want session permitted to view and administer")
+	}
+
+	// the session endpoint returns the csrf token.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, withCookies(httptest.NewRequest("GET", "/auth/session", nil), r))
+	out := new(sessionResponse)
+	json.NewDecoder(w.Body).Decode(out)
+	if out.User != "octocat" || !out.Admin || !provider.VerifyToken(session, out.Token) {
+		t.Errorf("Unexpected session response %+v", out)
+	}
+
+	// the logout endpoint requires the csrf token.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, withCookies(httptest.NewRequest("POST", "/auth/logout", nil), r))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Want logout without csrf token rejected, got status %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	logout := withCookies(httptest.NewRequest("POST", "/auth/logout", nil), r)
+	logout.Header.Set(TokenHeader, out.Token)
+	handler.ServeHTTP(w, logout)
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("Want logout redirect, got status %d", w.Code)
+	}
+	if provider.Session(r) != nil {
+		t.Errorf("Want session revoked after logout")
+	}
+}
+
+// helper function copies the request cookies.
+func withCookies(r, from *http.Request) *http.Request {
+	for _, cookie := range from.Cookies() {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+func TestSession_Forged(t *testing.T) {
+	provider := &Provider{key: []byte("correct-horse")}
+	value, _ := (&Provider{key: []byte("battery-staple")}).encode(&Session{
+		User:    "octocat",
+		Expires: time.Now().Add(time.Hour).Unix(),
+	})
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+	if provider.Session(r) != nil {
+		t.Errorf("Want forged session rejected")
+	}
+}
+
+func TestSession_Expired(t *testing.T) {
+	provider := &Provider{key: []byte("correct-horse")}
+	value, _ := provider.encode(&Session{
+		User:    "octocat",
+		Expires: time.Now().Add(-time.Hour).Unix(),
+	})
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: value})
+	if provider.Session(r) != nil {
+		t.Errorf("Want expired session rejected")
+	}
+}
+
+func TestSafeReturn(t *testing.T) {
+	tests := map[string]string{
+		"":                    "/",
+		"/view?id=1":          "/view?id=1",
+		"//evil.com":          "/",
+		"/\\evil.com":         "/",
+		"https://evil.com/":   "/",
+		"javascript:alert(1)": "/",
+	}
+	for path, want := range tests {
+		if got := safeReturn(path); got != want {
+			t.Errorf("Want return path %q for %q, got %q", want, path, got)
+		}
+	}
+}
+
+// helper function returns an unsigned identity token.
+func token(claims map[string]interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	data, _ := json.Marshal(claims)
+	return header + "." + base64.RawURLEncoding.EncodeToString(data) + "."
+}
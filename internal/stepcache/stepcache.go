@@ -0,0 +1,78 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package stepcache records the input hashes of successful
+// pipeline steps, so that steps with unchanged inputs can be
+// skipped.
+package stepcache
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Key identifies a successful run of a step.
+type Key struct {
+	Repo string // repository slug
+	Step string // step name
+	Hash string // hash of the step inputs
+}
+
+// Store records the successful runs of pipeline steps.
+type Store interface {
+	// Has returns true if the step previously succeeded with
+	// the same inputs.
+	Has(ctx context.Context, key Key) (bool, error)
+
+	// Put records a successful run of the step.
+	Put(ctx context.Context, key Key) error
+}
+
+// Dir returns a Store that records the successful runs in a
+// directory. Records older than the ttl are ignored, if the
+// ttl is greater than zero.
+func Dir(path string, ttl time.Duration) Store {
+	return &dir{path: path, ttl: ttl}
+}
+
+type dir struct {
+	path string
+	ttl  time.Duration
+}
+
+func (d *dir) file(key Key) string {
+	return filepath.Join(
+		d.path,
+		filepath.FromSlash(key.Repo),
+		url.PathEscape(key.Step),
+		key.Hash,
+	)
+}
+
+func (d *dir) Has(ctx context.Context, key Key) (bool, error) {
+	info, err := os.Stat(d.file(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if d.ttl > 0 && time.Since(info.ModTime()) > d.ttl {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (d *dir) Put(ctx context.Context, key Key) error {
+	path := d.file(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// the record is rewritten to refresh the modification
+	// time used to expire the record.
+	return ioutil.WriteFile(path, []byte(time.Now().UTC().Format(time.RFC3339)), 0600)
+}
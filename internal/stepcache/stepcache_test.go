@@ -0,0 +1,41 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package stepcache
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDir(t *testing.T) {
+	store := Dir(t.TempDir(), time.Hour)
+	key := Key{Repo: "octocat/hello-world", Step: "generate protos", Hash: "3a7bd3e2"}
+
+	if ok, err := store.Has(context.Background(), key); err != nil || ok {
+		t.Errorf("Want no record before the step succeeds, got %v, %v", ok, err)
+	}
+	if err := store.Put(context.Background(), key); err != nil {
+		t.Error(err)
+		return
+	}
+	if ok, err := store.Has(context.Background(), key); err != nil || !ok {
+		t.Errorf("Want record after the step succeeds, got %v, %v", ok, err)
+	}
+
+	other := key
+	other.Hash = "9f86d081"
+	if ok, _ := store.Has(context.Background(), other); ok {
+		t.Errorf("Want no record for changed inputs")
+	}
+
+	// records older than the ttl are ignored.
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(store.(*dir).file(key), old, old)
+	if ok, _ := store.Has(context.Background(), key); ok {
+		t.Errorf("Want expired record ignored")
+	}
+}
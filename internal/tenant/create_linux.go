@@ -0,0 +1,31 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package tenant
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// helper function creates a system user and group without a
+// home directory or login shell. Pipelines use the home
+// directory created in the pipeline root.
+func create(name string) error {
+	out, err := exec.Command("useradd",
+		"--system",
+		"--user-group",
+		"--no-create-home",
+		"--home-dir", "/nonexistent",
+		"--shell", "/usr/sbin/nologin",
+		name,
+	).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
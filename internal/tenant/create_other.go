@@ -0,0 +1,16 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux
+
+package tenant
+
+import "errors"
+
+// helper function returns an error, since users can only be
+// created on demand on linux. Users must be mapped on other
+// platforms.
+func create(name string) error {
+	return errors.New("creating users is only supported on linux")
+}
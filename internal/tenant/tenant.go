@@ -0,0 +1,133 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package tenant maps repository namespaces to dedicated
+// operating system users, so that the pipelines of different
+// namespaces cannot access each other's files and processes.
+package tenant
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+
+	"github.com/buildkite/yaml"
+)
+
+// maximum length of a created user name.
+const maxName = 32
+
+// length of the namespace hash in a created user name.
+const hashLen = 8
+
+// Config configures the namespace users.
+type Config struct {
+	// Users maps namespaces to user names.
+	Users map[string]string
+
+	// Create creates users on demand for namespaces that are
+	// not mapped. The user name is the prefix, the namespace
+	// and a hash of the namespace.
+	Create bool
+	Prefix string
+}
+
+// Users maps repository namespaces to operating system users.
+type Users struct {
+	mu     sync.Mutex
+	config Config
+}
+
+// New returns a new namespace user mapping.
+func New(config Config) *Users {
+	return &Users{config: config}
+}
+
+// Load loads the mapping of namespaces to user names from the
+// yaml file.
+func Load(path string) (map[string]string, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	users := map[string]string{}
+	if err := yaml.Unmarshal(raw, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// Lookup returns the user of the namespace. If the namespace is
+// not mapped, the user is created if configured, and an error
+// is returned otherwise.
+func (u *Users) Lookup(namespace string) (*engine.User, error) {
+	name, ok := u.config.Users[namespace]
+	if !ok && !u.config.Create {
+		return nil, fmt.Errorf("no user is mapped to namespace %q", namespace)
+	}
+	if !ok {
+		name = Name(u.config.Prefix, namespace)
+	}
+
+	// users are created sequentially, so that concurrent
+	// stages of the same namespace create the user once.
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	found, err := user.Lookup(name)
+	if _, unknown := err.(user.UnknownUserError); unknown && !ok {
+		if err := create(name); err != nil {
+			return nil, fmt.Errorf("cannot create user %s: %s", name, err)
+		}
+		found, err = user.Lookup(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseUint(found.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid for user %s", name)
+	}
+	gid, err := strconv.ParseUint(found.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid for user %s", name)
+	}
+	if uid == 0 {
+		return nil, fmt.Errorf("cannot run namespace %q as the root user", namespace)
+	}
+	return &engine.User{
+		Name: found.Username,
+		UID:  uint32(uid),
+		GID:  uint32(gid),
+	}, nil
+}
+
+// Name returns the name of the user created for the namespace.
+// Characters that are not permitted in user names are replaced
+// with a dash, and the name is truncated to the maximum length.
+// The name ends with a hash of the exact namespace, so that
+// different namespaces are never mapped to the same user.
+func Name(prefix, namespace string) string {
+	sum := sha256.Sum256([]byte(namespace))
+	hash := hex.EncodeToString(sum[:])[:hashLen]
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '-'
+		}
+	}, strings.ToLower(prefix+namespace))
+	if max := maxName - hashLen - 1; len(name) > max {
+		name = name[:max]
+	}
+	return name + "-" + hash
+}
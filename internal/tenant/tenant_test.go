@@ -0,0 +1,89 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package tenant
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("namespace users are not supported on windows")
+	}
+	users := New(Config{
+		Users: map[string]string{
+			"octocat": "nobody",
+			"admin":   "root",
+		},
+	})
+	user, err := users.Lookup("octocat")
+	if err != nil {
+		t.Skipf("cannot lookup the nobody user: %s", err)
+	}
+	if user.Name != "nobody" || user.UID == 0 {
+		t.Errorf("Unexpected user %+v", user)
+	}
+	if _, err := users.Lookup("admin"); err == nil {
+		t.Errorf("Want namespace mapped to root rejected")
+	}
+	if _, err := users.Lookup("spaceghost"); err == nil {
+		t.Errorf("Want unmapped namespace rejected")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.yml")
+	ioutil.WriteFile(path, []byte("octocat: drone-octocat\nspaceghost: drone-spaceghost\n"), 0600)
+	users, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := users["octocat"]; got != "drone-octocat" {
+		t.Errorf("Want user drone-octocat, got %q", got)
+	}
+	if _, err := Load(filepath.Join(os.TempDir(), "missing.yml")); err == nil {
+		t.Errorf("Want error loading missing file")
+	}
+}
+
+func TestName(t *testing.T) {
+	tests := map[string]string{
+		"octocat":      "drone-octocat-a6658157",
+		"Octo.Cat":     "drone-octo-cat-117536ab",
+		"space ghost/": "drone-space-ghost--4586d241",
+		"a-very-long-organization-name-exceeding-the-limit": "drone-a-very-long-organ-a605f6af",
+	}
+	for namespace, want := range tests {
+		if got := Name("drone-", namespace); got != want {
+			t.Errorf("Want user name %q for namespace %q, got %q", want, namespace, got)
+		}
+		if got := Name("drone-", namespace); len(got) > maxName {
+			t.Errorf("Want user name %q truncated to %d characters", got, maxName)
+		}
+	}
+}
+
+func TestName_Collision(t *testing.T) {
+	namespaces := []string{
+		"foo.bar",
+		"foo-bar",
+		"Foo.Bar",
+		"FOO-BAR",
+		"a-very-long-organization-name-exceeding-the-limit",
+		"a-very-long-organization-name-exceeding-the-limit-too",
+	}
+	seen := map[string]string{}
+	for _, namespace := range namespaces {
+		name := Name("drone-", namespace)
+		if other, ok := seen[name]; ok {
+			t.Errorf("Want distinct users for namespaces %q and %q, got %q", other, namespace, name)
+		}
+		seen[name] = namespace
+	}
+}
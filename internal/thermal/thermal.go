@@ -0,0 +1,99 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package thermal monitors the temperature and battery of the
+// host, so that runners on laptops and single board computers
+// can stop requesting stages when the host is too hot, or the
+// battery is nearly empty.
+package thermal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/drone/runner-go/logger"
+)
+
+// ErrNotSupported is returned when the sensors of the host
+// cannot be read on the host operating system.
+var ErrNotSupported = errors.New("thermal monitoring is not supported on this platform")
+
+// Reading is a reading of the host sensors.
+type Reading struct {
+	// Temperature is the highest temperature of the thermal
+	// zones in degrees celsius, or zero if unknown.
+	Temperature float64
+
+	// Battery is the remaining battery capacity in percent,
+	// or -1 if the host has no battery.
+	Battery int
+
+	// Discharging is true if the host is running on battery.
+	Discharging bool
+}
+
+// Limits defines the conditions under which the host is
+// throttled. A limit of zero is disabled.
+type Limits struct {
+	// Temperature throttles the host when a thermal zone
+	// reaches the temperature in degrees celsius. The host is
+	// resumed when the temperature falls to Resume, which
+	// prevents the host flapping at the limit.
+	Temperature float64
+	Resume      float64
+
+	// Battery throttles the host when discharging with the
+	// battery capacity at or below the percent. The host is
+	// resumed when charging.
+	Battery int
+}
+
+// Check returns true and the reason if the host is throttled.
+// The previous state is used to resume the host only once the
+// temperature falls below the resume temperature.
+func (l Limits) Check(r *Reading, throttled bool) (bool, string) {
+	temperature := l.Temperature
+	if throttled && l.Resume > 0 && l.Resume < temperature {
+		temperature = l.Resume
+	}
+	switch {
+	case temperature > 0 && r.Temperature >= temperature:
+		return true, fmt.Sprintf("temperature %.1f°C exceeds %.1f°C", r.Temperature, temperature)
+	case l.Battery > 0 && r.Battery >= 0 && r.Discharging && r.Battery <= l.Battery:
+		return true, fmt.Sprintf("battery %d%% at or below %d%%", r.Battery, l.Battery)
+	default:
+		return false, ""
+	}
+}
+
+// Watch reads the host sensors at the interval until the
+// context is cancelled, and calls the update function when the
+// host is throttled or resumed. A failed reading does not
+// change the state.
+func Watch(ctx context.Context, interval time.Duration, limits Limits, update func(throttled bool, reason string)) {
+	log := logger.FromContext(ctx)
+	var throttled bool
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		reading, err := read()
+		if err != nil {
+			log.WithError(err).Warnln("cannot read the host sensors")
+		} else if next, reason := limits.Check(reading, throttled); next != throttled {
+			throttled = next
+			update(throttled, reason)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// read reads the host sensors, and is a variable so that it
+// can be replaced in tests.
+var read = Read
@@ -0,0 +1,75 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build linux
+
+package thermal
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sysfs is the root of the linux sysfs filesystem.
+var sysfs = "/sys"
+
+// Read reads the thermal zones and batteries of the host.
+func Read() (*Reading, error) {
+	reading := &Reading{Battery: -1}
+
+	zones, err := filepath.Glob(filepath.Join(sysfs, "class/thermal/thermal_zone*/temp"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range zones {
+		millis, err := readInt(path)
+		if err != nil {
+			continue
+		}
+		if temp := float64(millis) / 1000; temp > reading.Temperature {
+			reading.Temperature = temp
+		}
+	}
+
+	supplies, err := filepath.Glob(filepath.Join(sysfs, "class/power_supply/*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range supplies {
+		if readString(filepath.Join(dir, "type")) != "Battery" {
+			continue
+		}
+		capacity, err := readInt(filepath.Join(dir, "capacity"))
+		if err != nil {
+			continue
+		}
+		// the lowest battery is reported if the host has
+		// multiple batteries.
+		if reading.Battery == -1 || int(capacity) < reading.Battery {
+			reading.Battery = int(capacity)
+		}
+		if readString(filepath.Join(dir, "status")) == "Discharging" {
+			reading.Discharging = true
+		}
+	}
+	return reading, nil
+}
+
+// helper function reads the trimmed contents of the file, or
+// an empty string if the file cannot be read.
+func readString(path string) string {
+	data, _ := ioutil.ReadFile(path)
+	return strings.TrimSpace(string(data))
+}
+
+// helper function reads the integer contents of the file.
+func readInt(path string) (int64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
@@ -0,0 +1,13 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !linux
+
+package thermal
+
+// Read reads the thermal zones and batteries of the host.
+// Thermal monitoring is only supported on linux.
+func Read() (*Reading, error) {
+	return nil, ErrNotSupported
+}
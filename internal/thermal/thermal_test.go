@@ -0,0 +1,76 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package thermal
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheck(t *testing.T) {
+	limits := Limits{Temperature: 85, Resume: 75, Battery: 20}
+	tests := []struct {
+		reading   Reading
+		throttled bool
+		want      bool
+	}{
+		{reading: Reading{Temperature: 60, Battery: -1}, want: false},
+		{reading: Reading{Temperature: 90, Battery: -1}, want: true},
+		// the host is not resumed until the temperature falls
+		// to the resume temperature.
+		{reading: Reading{Temperature: 80, Battery: -1}, throttled: true, want: true},
+		{reading: Reading{Temperature: 80, Battery: -1}, throttled: false, want: false},
+		{reading: Reading{Temperature: 70, Battery: -1}, throttled: true, want: false},
+		{reading: Reading{Battery: 15, Discharging: true}, want: true},
+		{reading: Reading{Battery: 15, Discharging: false}, want: false},
+		{reading: Reading{Battery: 50, Discharging: true}, want: false},
+	}
+	for i, test := range tests {
+		got, reason := limits.Check(&test.reading, test.throttled)
+		if got != test.want {
+			t.Errorf("Want throttled %v at index %d", test.want, i)
+		}
+		if got && reason == "" {
+			t.Errorf("Want throttle reason at index %d", i)
+		}
+	}
+
+	if got, _ := (Limits{}).Check(&Reading{Temperature: 100, Battery: 1, Discharging: true}, false); got {
+		t.Errorf("Want limits of zero disabled")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	defer func() { read = Read }()
+	readings := make(chan *Reading, 1)
+	read = func() (*Reading, error) {
+		select {
+		case r := <-readings:
+			return r, nil
+		default:
+			return &Reading{Temperature: 50, Battery: -1}, nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan bool)
+	go Watch(ctx, time.Millisecond, Limits{Temperature: 85}, func(throttled bool, reason string) {
+		updates <- throttled
+	})
+
+	readings <- &Reading{Temperature: 90, Battery: -1}
+	for _, want := range []bool{true, false} {
+		select {
+		case got := <-updates:
+			if got != want {
+				t.Errorf("Want throttled %v, got %v", want, got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Want throttle update")
+		}
+	}
+}
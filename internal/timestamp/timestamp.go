@@ -0,0 +1,96 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package timestamp prefixes each line of the step logs with
+// the time the line was written and the elapsed time since the
+// step started, so that users can see where time is spent
+// inside a long running step:
+//
+//	2019-10-01T15:04:05.123Z +12.345s npm install
+package timestamp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine/section"
+
+	"github.com/drone/runner-go/pipeline"
+)
+
+// format of the line timestamp.
+const format = "2006-01-02T15:04:05.000Z"
+
+// now returns the current time, and is replaced in tests.
+var now = time.Now
+
+var _ pipeline.Streamer = (*Streamer)(nil)
+
+// Streamer is a pipeline.Streamer that prefixes the lines
+// written by the step with a timestamp.
+type Streamer struct {
+	base pipeline.Streamer
+}
+
+// NewStreamer returns a new Streamer that wraps the base
+// streamer.
+func NewStreamer(base pipeline.Streamer) *Streamer {
+	return &Streamer{base: base}
+}
+
+// Stream returns an io.WriteCloser that prefixes the lines
+// written by the step.
+func (s *Streamer) Stream(ctx context.Context, state *pipeline.State, name string) io.WriteCloser {
+	return New(s.base.Stream(ctx, state, name))
+}
+
+// Writer is an io.Writer that prefixes each line with the
+// time the line was written and the elapsed time since the
+// writer was created. The elapsed time is measured with the
+// monotonic clock, and is not affected by changes to the
+// system time. Section markers are not prefixed, so that
+// sections can be collapsed.
+type Writer struct {
+	w     io.WriteCloser
+	start time.Time
+
+	mu  sync.Mutex
+	bol bool
+}
+
+// New returns a timestamp writer that wraps writer w.
+func New(w io.WriteCloser) *Writer {
+	return &Writer{w: w, start: now(), bol: true}
+}
+
+// Write writes p to the base writer, prefixing each line
+// that starts in p.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var b strings.Builder
+	for _, part := range strings.SplitAfter(string(p), "\n") {
+		if part == "" {
+			continue
+		}
+		if w.bol && !section.IsMarker(part) {
+			t := now()
+			fmt.Fprintf(&b, "%s +%.3fs ", t.UTC().Format(format), t.Sub(w.start).Seconds())
+		}
+		b.WriteString(part)
+		w.bol = strings.HasSuffix(part, "\n")
+	}
+	_, err := io.WriteString(w.w, b.String())
+	return len(p), err
+}
+
+// Close closes the base writer.
+func (w *Writer) Close() error {
+	return w.w.Close()
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package timestamp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine/section"
+)
+
+func TestWriter(t *testing.T) {
+	clock := time.Date(2019, 10, 1, 15, 4, 5, 0, time.UTC)
+	now = func() time.Time {
+		return clock
+	}
+	defer func() {
+		now = time.Now
+	}()
+
+	buf := new(bytes.Buffer)
+	w := New(&nopCloser{buf})
+
+	clock = clock.Add(1500 * time.Millisecond)
+	io.WriteString(w, "hello\nwor")
+	clock = clock.Add(time.Minute)
+	io.WriteString(w, "ld\n")
+	section.Group(w, "build")
+	io.WriteString(w, "make\n")
+	section.End(w)
+	w.Close()
+
+	want := "2019-10-01T15:04:06.500Z +1.500s hello\n" +
+		"2019-10-01T15:04:06.500Z +1.500s world\n" +
+		"##[group]build\n" +
+		"2019-10-01T15:05:06.500Z +61.500s make\n" +
+		"##[endgroup]\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Want prefixed output %q, got %q", want, got)
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (*nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package token provides the rpc secret loaded from a file,
+// which is reloaded when the file changes to support secret
+// rotation without restarting the runner.
+package token
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/drone/runner-go/logger"
+)
+
+// ErrEmpty is returned when the secret file is empty.
+var ErrEmpty = errors.New("token: secret file is empty")
+
+// File provides the secret loaded from a file.
+type File struct {
+	path string
+
+	mu     sync.RWMutex
+	secret string
+}
+
+// Load loads the secret from the file.
+func Load(path string) (*File, error) {
+	f := &File{path: path}
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Secret returns the current secret.
+func (f *File) Secret() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.secret
+}
+
+// Watch reloads the secret when the file changes, until the
+// context is cancelled. The file is polled at the interval,
+// since rotated files are often replaced using symlinks.
+func (f *File) Watch(ctx context.Context, interval time.Duration) {
+	log := logger.FromContext(ctx).WithField("path", f.path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		changed, err := f.reload()
+		if err != nil {
+			log.WithError(err).Warnln("cannot reload the rpc secret")
+		} else if changed {
+			log.Infoln("rpc secret reloaded")
+		}
+	}
+}
+
+// Transport returns an http.RoundTripper that authorizes
+// requests using the current secret.
+func (f *File) Transport(base http.RoundTripper) http.RoundTripper {
+	return Transport(base, f.Secret)
+}
+
+// Transport returns an http.RoundTripper that authorizes
+// requests using the secret returned by the secret function.
+func Transport(base http.RoundTripper, secret func() string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, secret: secret}
+}
+
+// helper function reloads the secret and returns true if the
+// secret changed. The existing secret is retained if the file
+// cannot be read or is empty.
+func (f *File) reload() (bool, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return false, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return false, ErrEmpty
+	}
+	secret := string(data)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.secret == secret {
+		return false, nil
+	}
+	f.secret = secret
+	return true, nil
+}
+
+type transport struct {
+	base   http.RoundTripper
+	secret func() string
+}
+
+// RoundTrip sets the token header to the current secret.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Drone-Token", t.secret())
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package token
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	ioutil.WriteFile(path, []byte("correct-horse\n"), 0600)
+
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.Secret(), "correct-horse"; got != want {
+		t.Errorf("Want secret %q, got %q", want, got)
+	}
+
+	ioutil.WriteFile(path, []byte(""), 0600)
+	if _, err := Load(path); err != ErrEmpty {
+		t.Errorf("Want ErrEmpty, got %v", err)
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("Want error when secret file missing")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	ioutil.WriteFile(path, []byte("correct-horse"), 0600)
+	f, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go f.Watch(ctx, time.Millisecond)
+
+	// an empty file is ignored, since the file may be
+	// truncated while it is being rotated.
+	ioutil.WriteFile(path, []byte(""), 0600)
+	time.Sleep(10 * time.Millisecond)
+	if got, want := f.Secret(), "correct-horse"; got != want {
+		t.Errorf("Want secret %q retained, got %q", want, got)
+	}
+
+	ioutil.WriteFile(path, []byte("battery-staple"), 0600)
+	for i := 0; i < 1000 && f.Secret() != "battery-staple"; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if got, want := f.Secret(), "battery-staple"; got != want {
+		t.Errorf("Want rotated secret %q, got %q", want, got)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var got string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("X-Drone-Token")
+	}))
+	defer ts.Close()
+
+	f := &File{secret: "battery-staple"}
+	client := &http.Client{Transport: f.Transport(nil)}
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Add("X-Drone-Token", "correct-horse")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if want := "battery-staple"; got != want {
+		t.Errorf("Want token header %q, got %q", want, got)
+	}
+}
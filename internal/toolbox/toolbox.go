@@ -0,0 +1,96 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package toolbox provides the pinned set of tools that the
+// runner exposes to pipeline steps. The tools are versioned
+// with the runner release, so that builds are reproducible
+// when the runner is updated.
+package toolbox
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Checksums is the name of the optional checksum file, in the
+// sha256sum format, that pins the tools of a release.
+const Checksums = "SHA256SUMS"
+
+// Open returns the toolbox directory of the runner version,
+// which is a subdirectory of the root directory. If the
+// directory contains a checksum file, the checksum of every
+// listed tool is verified.
+func Open(root, version string) (string, error) {
+	dir := filepath.Join(root, version)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("toolbox: cannot find tools of version %s: %s", version, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("toolbox: %s is not a directory", dir)
+	}
+	if err := verify(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// helper function verifies the tools listed in the checksum
+// file of the directory, if the file exists.
+func verify(dir string) error {
+	f, err := os.Open(filepath.Join(dir, Checksums))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("toolbox: malformed checksum line %q", scanner.Text())
+		}
+		// binary mode checksums prefix the name with an
+		// asterisk.
+		want, name := fields[0], strings.TrimPrefix(fields[1], "*")
+		if name != filepath.Base(name) {
+			return fmt.Errorf("toolbox: invalid tool name %q", name)
+		}
+		got, err := digest(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("toolbox: %s", err)
+		}
+		if !strings.EqualFold(got, want) {
+			return fmt.Errorf("toolbox: checksum mismatch for %s", name)
+		}
+	}
+	return scanner.Err()
+}
+
+// helper function returns the hex encoded sha256 digest of the
+// file contents.
+func digest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package toolbox
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	root, err := ioutil.TempDir("", "drone-toolbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if _, err := Open(root, "1.2.3"); err == nil {
+		t.Errorf("Expect error when the version is not provisioned")
+	}
+
+	dir := filepath.Join(root, "1.2.3")
+	os.MkdirAll(dir, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "jq"), []byte("jq-1.6"), 0755)
+	got, err := Open(root, "1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != dir {
+		t.Errorf("Want toolbox %s, got %s", dir, got)
+	}
+
+	sum := sha256.Sum256([]byte("jq-1.6"))
+	sums := filepath.Join(dir, Checksums)
+	ioutil.WriteFile(sums, []byte(fmt.Sprintf("%x *jq\n", sum)), 0644)
+	if _, err := Open(root, "1.2.3"); err != nil {
+		t.Errorf("Expect checksums verified, got %s", err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "jq"), []byte("jq-1.7"), 0755)
+	if _, err := Open(root, "1.2.3"); err == nil {
+		t.Errorf("Expect error when the checksum does not match")
+	}
+
+	ioutil.WriteFile(sums, []byte(fmt.Sprintf("%x ../jq\n", sum)), 0644)
+	if _, err := Open(root, "1.2.3"); err == nil {
+		t.Errorf("Expect error when the tool is outside the toolbox")
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package update updates the runner binary from signed
+// releases.
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// maximum size of a release binary.
+const maxSize = 512 << 20
+
+// Unknown is the version of a binary that is not built with
+// a release version.
+const Unknown = "0.0.0"
+
+// errors returned when updating the runner.
+var (
+	ErrInvalidKey       = errors.New("update: invalid public key")
+	ErrInvalidSignature = errors.New("update: invalid release signature")
+	ErrInvalidChecksum  = errors.New("update: release binary does not match the checksum")
+	ErrNoAsset          = errors.New("update: no release binary for this platform")
+	ErrNotNewer         = errors.New("update: release is not newer than the running version")
+	ErrUnknownVersion   = errors.New("update: the running version is unknown")
+)
+
+// Release describes a runner release. The release manifest is
+// published as json by the release endpoint.
+type Release struct {
+	Version string   `json:"version"`
+	Assets  []*Asset `json:"assets"`
+}
+
+// Asset is a release binary for a platform. The signature is
+// the base64-encoded ed25519 signature of the asset manifest,
+// which covers the release version, the platform and the
+// sha256 checksum of the binary, so that a signed binary cannot
+// be published as another version or for another platform.
+// The url may be relative to the release manifest.
+type Asset struct {
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"`
+}
+
+// Manifest returns the signed manifest of the release asset.
+func Manifest(version string, asset *Asset) []byte {
+	data, _ := json.Marshal(struct {
+		Version string `json:"version"`
+		OS      string `json:"os"`
+		Arch    string `json:"arch"`
+		SHA256  string `json:"sha256"`
+	}{
+		Version: version,
+		OS:      asset.OS,
+		Arch:    asset.Arch,
+		SHA256:  strings.ToLower(asset.SHA256),
+	})
+	return data
+}
+
+// Config configures the updater.
+type Config struct {
+	// Endpoint is the url of the release manifest.
+	Endpoint string
+
+	// PublicKey is the base64-encoded ed25519 public key that
+	// signs the release manifests.
+	PublicKey string
+
+	// Version is the running version. Releases that are not
+	// newer than the running version are refused.
+	Version string
+
+	// Client is the http client used to download releases.
+	Client *http.Client
+}
+
+// Updater downloads and installs signed runner releases.
+type Updater struct {
+	endpoint string
+	key      ed25519.PublicKey
+	version  string
+	client   *http.Client
+}
+
+// New returns a new updater. An error is returned if the
+// running version is unknown, since older releases could not
+// be refused.
+func New(config Config) (*Updater, error) {
+	key, err := ParseKey(config.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if config.Version == "" || config.Version == Unknown {
+		return nil, ErrUnknownVersion
+	}
+	client := config.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Updater{
+		endpoint: config.Endpoint,
+		key:      key,
+		version:  config.Version,
+		client:   client,
+	}, nil
+}
+
+// ParseKey parses the base64-encoded ed25519 public key.
+func ParseKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, ErrInvalidKey
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// Latest returns the latest release, and the release binary
+// for the host platform.
+func (u *Updater) Latest(ctx context.Context) (*Release, *Asset, error) {
+	body, err := u.get(ctx, u.endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	release := new(Release)
+	if err := json.Unmarshal(body, release); err != nil {
+		return nil, nil, err
+	}
+	for _, asset := range release.Assets {
+		if asset.OS == runtime.GOOS && asset.Arch == runtime.GOARCH {
+			return release, asset, nil
+		}
+	}
+	return release, nil, ErrNoAsset
+}
+
+// Download downloads the release binary. The signature of the
+// asset manifest is verified, and the release is refused if it
+// is not newer than the running version, or if the binary does
+// not match the signed checksum.
+func (u *Updater) Download(ctx context.Context, release *Release, asset *Asset) ([]byte, error) {
+	if asset.OS != runtime.GOOS || asset.Arch != runtime.GOARCH {
+		return nil, ErrNoAsset
+	}
+	sig, err := base64.StdEncoding.DecodeString(asset.Signature)
+	if err != nil || !ed25519.Verify(u.key, Manifest(release.Version, asset), sig) {
+		return nil, ErrInvalidSignature
+	}
+	if !Newer(release.Version, u.version) {
+		return nil, ErrNotNewer
+	}
+	base, err := url.Parse(u.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	target, err := base.Parse(asset.URL)
+	if err != nil {
+		return nil, err
+	}
+	data, err := u.get(ctx, target.String())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != strings.ToLower(asset.SHA256) {
+		return nil, ErrInvalidChecksum
+	}
+	return data, nil
+}
+
+func (u *Updater) get(ctx context.Context, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode > 299 {
+		return nil, fmt.Errorf("update: cannot download %s: %s", target, res.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSize {
+		return nil, fmt.Errorf("update: %s exceeds the maximum size", target)
+	}
+	return data, nil
+}
+
+// Install replaces the binary at the path. The binary is
+// written alongside the existing binary and renamed, so that
+// the existing binary is replaced atomically. The existing
+// binary is renamed with the .old suffix first, since a
+// running binary cannot be replaced on windows.
+func Install(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	next := path + ".new"
+	if err := os.WriteFile(next, data, info.Mode().Perm()); err != nil {
+		return err
+	}
+	prev := path + ".old"
+	os.Remove(prev)
+	if err := os.Rename(path, prev); err != nil {
+		os.Remove(next)
+		return err
+	}
+	if err := os.Rename(next, path); err != nil {
+		os.Rename(prev, path)
+		return err
+	}
+	// the previous binary cannot be removed while running on
+	// windows, and is removed by the next update.
+	os.Remove(prev)
+	return nil
+}
+
+// Executable returns the path of the running binary, with
+// symbolic links resolved.
+func Executable() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(path)
+}
+
+// Newer returns true if the version is newer than the current
+// version. Versions are compared as dot-separated numbers,
+// and an optional v prefix and pre-release suffix are ignored.
+func Newer(version, current string) bool {
+	a, b := parse(version), parse(current)
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
+
+func parse(version string) []int {
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i != -1 {
+		version = version[:i]
+	}
+	var parts []int
+	for _, s := range strings.Split(version, ".") {
+		n, _ := strconv.Atoi(s)
+		parts = append(parts, n)
+	}
+	return parts
+}
@@ -0,0 +1,163 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	binary := []byte("#!/bin/sh\necho 1.1.0\n")
+	sum := sha256.Sum256(binary)
+	asset := &Asset{
+		OS:     runtime.GOOS,
+		Arch:   runtime.GOARCH,
+		URL:    "1.1.0/drone-runner-exec",
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+	asset.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(private, Manifest("1.1.0", asset)))
+	forged := *asset
+	forged.URL = "1.1.0/forged"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases/latest.json":
+			json.NewEncoder(w).Encode(&Release{
+				Version: "1.1.0",
+				Assets:  []*Asset{asset, &forged},
+			})
+		case "/releases/1.1.0/drone-runner-exec":
+			w.Write(binary)
+		case "/releases/1.1.0/forged":
+			w.Write([]byte("forged"))
+		}
+	}))
+	defer ts.Close()
+
+	updater, err := New(Config{
+		Endpoint:  ts.URL + "/releases/latest.json",
+		PublicKey: base64.StdEncoding.EncodeToString(public),
+		Version:   "1.0.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release, latest, err := updater.Latest(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Version != "1.1.0" {
+		t.Errorf("Want version 1.1.0, got %s", release.Version)
+	}
+	data, err := updater.Download(context.Background(), release, latest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = updater.Download(context.Background(), release, release.Assets[1])
+	if err != ErrInvalidChecksum {
+		t.Errorf("Want forged binary rejected, got error %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "drone-runner-exec")
+	os.WriteFile(path, []byte("1.0.0"), 0755)
+	if err := Install(path, data); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(path)
+	if string(got) != string(binary) {
+		t.Errorf("Want binary replaced")
+	}
+	if info, _ := os.Stat(path); runtime.GOOS != "windows" && info.Mode().Perm() != 0755 {
+		t.Errorf("Want binary mode preserved, got %s", info.Mode())
+	}
+}
+
+func TestDownload_Refused(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	asset := &Asset{
+		OS:     runtime.GOOS,
+		Arch:   runtime.GOARCH,
+		URL:    "drone-runner-exec",
+		SHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+	}
+	asset.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(private, Manifest("1.1.0", asset)))
+
+	updater, err := New(Config{
+		Endpoint:  "http://localhost/releases/latest.json",
+		PublicKey: base64.StdEncoding.EncodeToString(public),
+		Version:   "1.1.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the signed release is refused if not newer than the
+	// running version.
+	_, err = updater.Download(context.Background(), &Release{Version: "1.1.0"}, asset)
+	if err != ErrNotNewer {
+		t.Errorf("Want release not newer refused, got error %v", err)
+	}
+
+	// the signed binary cannot be published as another version
+	// or for another platform.
+	_, err = updater.Download(context.Background(), &Release{Version: "1.2.0"}, asset)
+	if err != ErrInvalidSignature {
+		t.Errorf("Want relabeled version rejected, got error %v", err)
+	}
+	other := *asset
+	other.Arch = "forged"
+	_, err = updater.Download(context.Background(), &Release{Version: "1.1.0"}, &other)
+	if err != ErrNoAsset {
+		t.Errorf("Want binary for another platform rejected, got error %v", err)
+	}
+}
+
+func TestNew_InvalidKey(t *testing.T) {
+	if _, err := New(Config{PublicKey: "Y29ycmVjdC1ob3JzZQ=="}); err != ErrInvalidKey {
+		t.Errorf("Want invalid key rejected, got error %v", err)
+	}
+}
+
+func TestNew_UnknownVersion(t *testing.T) {
+	public, _, _ := ed25519.GenerateKey(nil)
+	key := base64.StdEncoding.EncodeToString(public)
+	for _, version := range []string{"", Unknown} {
+		if _, err := New(Config{PublicKey: key, Version: version}); err != ErrUnknownVersion {
+			t.Errorf("Want unknown version %q refused, got error %v", version, err)
+		}
+	}
+}
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		version, current string
+		newer            bool
+	}{
+		{"1.1.0", "1.0.0", true},
+		{"v1.10.0", "1.9.3", true},
+		{"1.0.0", "1.0.0", false},
+		{"1.0", "1.0.1", false},
+		{"2.0.0-rc.1", "1.9.0", true},
+		{"1.0.0", "0.0.0", true},
+	}
+	for _, test := range tests {
+		if got := Newer(test.version, test.current); got != test.newer {
+			t.Errorf("Want Newer(%q, %q) %v", test.version, test.current, test.newer)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package usage accounts the execution time of stages by
+// repository namespace and month, for internal chargeback,
+// and enforces optional soft and hard quotas of the monthly
+// execution time.
+package usage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default is the quota key that applies to namespaces without
+// a quota.
+const Default = "*"
+
+// Status values.
+const (
+	StatusOK       = "ok"
+	StatusWarning  = "warning"
+	StatusExceeded = "exceeded"
+)
+
+// Quota defines the monthly execution time of a namespace. The
+// runner warns when the soft quota is exceeded, and declines
+// stages when the hard quota is exceeded. A quota of zero is
+// disabled.
+type Quota struct {
+	Soft time.Duration
+	Hard time.Duration
+}
+
+// Usage reports the execution time of a namespace in a month.
+type Usage struct {
+	Namespace string  `json:"namespace"`
+	Period    string  `json:"period"`
+	Seconds   float64 `json:"seconds"`
+	Minutes   float64 `json:"minutes"`
+	Stages    int     `json:"stages"`
+	Soft      float64 `json:"soft_quota_minutes,omitempty"`
+	Hard      float64 `json:"hard_quota_minutes,omitempty"`
+	Status    string  `json:"status"`
+}
+
+// entry is the execution time of a namespace in a month.
+type entry struct {
+	Seconds float64 `json:"seconds"`
+	Stages  int     `json:"stages"`
+}
+
+// now returns the current time, and is a variable so that it
+// can be replaced in tests.
+var now = time.Now
+
+// Period returns the month of the time, in which the execution
+// time is accounted.
+func Period(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// Ledger records the execution time of each namespace by
+// month. The ledger is optionally persisted to a file, so that
+// the execution time is retained when the runner restarts.
+type Ledger struct {
+	mu sync.Mutex
+
+	path    string
+	quotas  map[string]Quota
+	periods map[string]map[string]*entry
+}
+
+// New returns a new ledger with the quotas, keyed by namespace.
+// If the path is not empty, the ledger is loaded from and
+// persisted to the file.
+func New(path string, quotas map[string]Quota) (*Ledger, error) {
+	l := &Ledger{
+		path:    path,
+		quotas:  quotas,
+		periods: map[string]map[string]*entry{},
+	}
+	if path == "" {
+		return l, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &l.periods); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record records the execution time of a stage of the
+// namespace in the current month.
+func (l *Ledger) Record(namespace string, d time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	period := Period(now())
+	namespaces, ok := l.periods[period]
+	if !ok {
+		namespaces = map[string]*entry{}
+		l.periods[period] = namespaces
+	}
+	e, ok := namespaces[namespace]
+	if !ok {
+		e = new(entry)
+		namespaces[namespace] = e
+	}
+	e.Seconds += d.Seconds()
+	e.Stages++
+	return l.save()
+}
+
+// Check returns the quota status of the namespace in the
+// current month.
+func (l *Ledger) Check(namespace string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var seconds float64
+	if e := l.periods[Period(now())][namespace]; e != nil {
+		seconds = e.Seconds
+	}
+	return status(l.quota(namespace), seconds)
+}
+
+// Report returns the execution time of each namespace in the
+// month, ordered by namespace.
+func (l *Ledger) Report(period string) []*Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := []*Usage{}
+	for namespace, e := range l.periods[period] {
+		quota := l.quota(namespace)
+		out = append(out, &Usage{
+			Namespace: namespace,
+			Period:    period,
+			Seconds:   e.Seconds,
+			Minutes:   e.Seconds / 60,
+			Stages:    e.Stages,
+			Soft:      quota.Soft.Minutes(),
+			Hard:      quota.Hard.Minutes(),
+			Status:    status(quota, e.Seconds),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Namespace < out[j].Namespace
+	})
+	return out
+}
+
+// helper function returns the quota of the namespace, or the
+// default quota. The mutex must be held.
+func (l *Ledger) quota(namespace string) Quota {
+	if quota, ok := l.quotas[namespace]; ok {
+		return quota
+	}
+	return l.quotas[Default]
+}
+
+// helper function writes the ledger to the file. The ledger
+// is written to a temporary file which is renamed, so that the
+// file is never partially written. The mutex must be held.
+func (l *Ledger) save() error {
+	if l.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(l.periods)
+	if err != nil {
+		return err
+	}
+	temp, err := ioutil.TempFile(filepath.Dir(l.path), ".usage")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), l.path)
+}
+
+// helper function returns the quota status of the execution
+// time in seconds.
+func status(quota Quota, seconds float64) string {
+	switch {
+	case quota.Hard > 0 && seconds >= quota.Hard.Seconds():
+		return StatusExceeded
+	case quota.Soft > 0 && seconds >= quota.Soft.Seconds():
+		return StatusWarning
+	default:
+		return StatusOK
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package usage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLedger(t *testing.T) {
+	defer func() { now = time.Now }()
+	now = func() time.Time {
+		return time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	}
+
+	path := filepath.Join(t.TempDir(), "usage.json")
+	quotas := map[string]Quota{
+		"octocat": {Soft: 10 * time.Minute, Hard: 20 * time.Minute},
+		Default:   {Hard: time.Hour},
+	}
+	ledger, err := New(path, quotas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ledger.Check("octocat"); got != StatusOK {
+		t.Errorf("Want status %s, got %s", StatusOK, got)
+	}
+	ledger.Record("octocat", 15*time.Minute)
+	if got := ledger.Check("octocat"); got != StatusWarning {
+		t.Errorf("Want status %s, got %s", StatusWarning, got)
+	}
+	ledger.Record("octocat", 5*time.Minute)
+	if got := ledger.Check("octocat"); got != StatusExceeded {
+		t.Errorf("Want status %s, got %s", StatusExceeded, got)
+	}
+	ledger.Record("spaceghost", 30*time.Minute)
+	if got := ledger.Check("spaceghost"); got != StatusOK {
+		t.Errorf("Want default quota applied, got status %s", got)
+	}
+
+	// the ledger is reloaded from the file, as if the runner
+	// restarted.
+	ledger, err = New(path, quotas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := ledger.Report("2026-10")
+	if len(report) != 2 {
+		t.Fatalf("Want usage of 2 namespaces, got %d", len(report))
+	}
+	if got := report[0]; got.Namespace != "octocat" || got.Minutes != 20 || got.Stages != 2 || got.Hard != 20 {
+		t.Errorf("Unexpected usage %+v", got)
+	}
+	if got := ledger.Report("2026-09"); len(got) != 0 {
+		t.Errorf("Want no usage in previous month")
+	}
+
+	// the execution time is accounted by month.
+	now = func() time.Time {
+		return time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if got := ledger.Check("octocat"); got != StatusOK {
+		t.Errorf("Want quota reset in the next month, got status %s", got)
+	}
+}
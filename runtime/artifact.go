@@ -0,0 +1,80 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/internal/artifact"
+)
+
+// handoff transfers the artifacts of a stage to dependent
+// stages using the artifact backend.
+type handoff struct {
+	backend   artifact.Backend
+	key       artifact.Key
+	dependsOn []string
+}
+
+// download downloads the artifacts of the upstream stages to
+// the artifacts directory, in a sub-directory per stage.
+func (h *handoff) download(ctx context.Context, spec *engine.Spec) error {
+	for _, name := range h.dependsOn {
+		key := h.key
+		key.Stage = name
+		dst := filepath.Join(spec.Artifacts.Dir, stageDir(name))
+		if err := h.backend.Download(ctx, key, dst); err != nil {
+			return fmt.Errorf("cannot download artifacts of stage %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// upload uploads the artifact paths declared by the pipeline.
+func (h *handoff) upload(ctx context.Context, spec *engine.Spec) error {
+	if len(spec.Artifacts.Paths) == 0 {
+		return nil
+	}
+	temp, err := ioutil.TempDir("", "drone-artifact")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(temp)
+	if err := artifact.Collect(spec.Artifacts.Source, spec.Artifacts.Paths, temp); err != nil {
+		return fmt.Errorf("cannot collect artifacts: %s", err)
+	}
+	if err := h.backend.Upload(ctx, temp, h.key); err != nil {
+		return fmt.Errorf("cannot upload artifacts: %s", err)
+	}
+	return nil
+}
+
+// helper function returns the directory name for the stage,
+// replacing path separators in the stage name.
+func stageDir(name string) string {
+	return strings.NewReplacer("/", "-", `\`, "-").Replace(name)
+}
+
+type handoffKey struct{}
+
+// helper function returns a context that carries the artifact
+// handoff, so that artifacts are transferred while the stage
+// workspace exists.
+func withHandoff(ctx context.Context, h *handoff) context.Context {
+	return context.WithValue(ctx, handoffKey{}, h)
+}
+
+// helper function returns the artifact handoff carried by the
+// context, or nil if the context does not carry a handoff.
+func handoffFrom(ctx context.Context) *handoff {
+	h, _ := ctx.Value(handoffKey{}).(*handoff)
+	return h
+}
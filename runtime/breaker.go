@@ -0,0 +1,177 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/runtime/event"
+)
+
+// BreakerStatus reports the state of the circuit breaker.
+type BreakerStatus struct {
+	Tripped  bool   `json:"tripped"`
+	Failures int    `json:"failures"`
+	Reason   string `json:"reason,omitempty"`
+	Since    int64  `json:"since,omitempty"`
+	Until    int64  `json:"until,omitempty"`
+}
+
+// Breaker stops the pollers from requesting stages after the
+// maximum number of consecutive stages fail for an
+// infrastructure reason attributable to the runner. The breaker
+// is reset by an operator, or once the optional cool-down
+// elapses. Running stages are not affected.
+type Breaker struct {
+	mu      sync.Mutex
+	status  BreakerStatus
+	changed chan struct{}
+
+	threshold int
+	cooldown  time.Duration
+	events    *event.Bus
+}
+
+// NewBreaker returns a new circuit breaker that trips after the
+// number of consecutive infrastructure failures. The breaker is
+// reset after the cool-down, if greater than zero. The optional
+// event bus is notified when the breaker trips or resets.
+func NewBreaker(threshold int, cooldown time.Duration, events *event.Bus) *Breaker {
+	return &Breaker{
+		changed:   make(chan struct{}),
+		threshold: threshold,
+		cooldown:  cooldown,
+		events:    events,
+	}
+}
+
+// Status returns the state of the circuit breaker.
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+	return b.status
+}
+
+// Tripped returns true if the circuit breaker is tripped.
+func (b *Breaker) Tripped() bool {
+	return b.Status().Tripped
+}
+
+// Reset resets the circuit breaker and the consecutive
+// infrastructure failures.
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reset("reset by operator")
+}
+
+// record records the outcome of a stage. The reason is empty if
+// the stage did not fail for an infrastructure reason.
+func (b *Breaker) record(reason string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+	if reason == "" {
+		b.status.Failures = 0
+		return
+	}
+	b.status.Failures++
+	if b.status.Tripped || b.threshold <= 0 || b.status.Failures < b.threshold {
+		return
+	}
+	now := time.Now()
+	b.status.Tripped = true
+	b.status.Reason = fmt.Sprintf("%d consecutive infrastructure failures: %s", b.status.Failures, reason)
+	b.status.Since = now.Unix()
+	if b.cooldown > 0 {
+		b.status.Until = now.Add(b.cooldown).Unix()
+	}
+	b.publish(event.RunnerTripped, b.status.Reason)
+}
+
+// wait blocks until the circuit breaker is not tripped. It
+// returns false if the context is cancelled.
+func (b *Breaker) wait(ctx context.Context) bool {
+	for {
+		b.mu.Lock()
+		b.expire()
+		tripped, until, changed := b.status.Tripped, b.status.Until, b.changed
+		b.mu.Unlock()
+		if !tripped {
+			return true
+		}
+		var expired <-chan time.Time
+		var timer *time.Timer
+		if until != 0 {
+			timer = time.NewTimer(time.Until(time.Unix(until, 0)))
+			expired = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+	}
+}
+
+// helper function resets the breaker if the cool-down elapsed.
+// The caller must hold the lock.
+func (b *Breaker) expire() {
+	if b.status.Tripped && b.status.Until != 0 && time.Now().Unix() >= b.status.Until {
+		b.reset("cool-down elapsed")
+	}
+}
+
+// helper function resets the breaker. The caller must hold the
+// lock.
+func (b *Breaker) reset(message string) {
+	tripped := b.status.Tripped
+	b.status = BreakerStatus{}
+	close(b.changed)
+	b.changed = make(chan struct{})
+	if tripped {
+		b.publish(event.RunnerReset, message)
+	}
+}
+
+// helper function notifies the event bus.
+func (b *Breaker) publish(typ event.Type, message string) {
+	if b.events == nil {
+		return
+	}
+	b.events.Publish(&event.Event{
+		Type:    typ,
+		Time:    time.Now().Unix(),
+		Message: message,
+	})
+}
+
+type breakerKey struct{}
+
+// helper function returns a context that carries the circuit
+// breaker.
+func withBreaker(ctx context.Context, b *Breaker) context.Context {
+	return context.WithValue(ctx, breakerKey{}, b)
+}
+
+// helper function returns the circuit breaker carried by the
+// context, or nil if the context does not carry a breaker.
+func breakerFrom(ctx context.Context) *Breaker {
+	b, _ := ctx.Value(breakerKey{}).(*Breaker)
+	return b
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/runtime/event"
+)
+
+func TestBreaker(t *testing.T) {
+	bus := event.New()
+	events, cancel := bus.Subscribe(10)
+	defer cancel()
+
+	b := NewBreaker(2, 0, bus)
+	b.record(reasonInfra)
+	b.record("")
+	b.record(reasonInfra)
+	if b.Tripped() {
+		t.Errorf("Want breaker not tripped after non-consecutive failures")
+	}
+	b.record(reasonOOM)
+	if !b.Tripped() {
+		t.Errorf("Want breaker tripped after consecutive failures")
+	}
+	if e := <-events; e.Type != event.RunnerTripped || e.Message == "" {
+		t.Errorf("Want tripped event with reason, got %+v", e)
+	}
+
+	ctx, cancelctx := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelctx()
+	if b.wait(ctx) {
+		t.Errorf("Want wait blocked while breaker tripped")
+	}
+
+	b.Reset()
+	if b.Tripped() {
+		t.Errorf("Want breaker reset")
+	}
+	if e := <-events; e.Type != event.RunnerReset {
+		t.Errorf("Want reset event, got %+v", e)
+	}
+	if !b.wait(context.Background()) {
+		t.Errorf("Want wait unblocked once breaker reset")
+	}
+}
+
+func TestBreaker_Cooldown(t *testing.T) {
+	b := NewBreaker(1, time.Second, nil)
+	b.record(reasonInfra)
+	if !b.Tripped() {
+		t.Fatalf("Want breaker tripped")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !b.wait(ctx) {
+		t.Errorf("Want wait unblocked once cool-down elapsed")
+	}
+	if b.Tripped() {
+		t.Errorf("Want breaker reset after cool-down")
+	}
+}
+
+func TestBreaker_Nil(t *testing.T) {
+	var b *Breaker
+	b.record(reasonInfra)
+}
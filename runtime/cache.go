@@ -0,0 +1,164 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/internal/stepcache"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/drone/runner-go/logger"
+)
+
+// stepCache skips steps with a cache key if the step inputs
+// are unchanged since a previous successful run.
+type stepCache struct {
+	store stepcache.Store
+	repo  string
+}
+
+// check returns the hash of the step inputs, and true if the
+// step previously succeeded with the same inputs. An empty hash
+// is returned if the step does not define a cache key, or the
+// inputs cannot be hashed.
+func (c *stepCache) check(ctx context.Context, spec *engine.Spec, step *engine.Step, envs map[string]string) (string, bool) {
+	if c == nil || step.Cache == nil {
+		return "", false
+	}
+	log := logger.FromContext(ctx)
+
+	// the workspace of a stage executed on a remote host is
+	// not accessible to the runner.
+	if spec.Remote != nil {
+		log.Debug("cannot hash step inputs on a remote host")
+		return "", false
+	}
+	hash, err := hashInputs(spec, step, envs)
+	if err != nil {
+		log.WithError(err).Warn("cannot hash step inputs")
+		return "", false
+	}
+	ok, err := c.store.Has(ctx, c.key(step, hash))
+	if err != nil {
+		log.WithError(err).Warn("cannot check step cache")
+		return hash, false
+	}
+	return hash, ok
+}
+
+// record records a successful run of the step with the hash of
+// the step inputs.
+func (c *stepCache) record(ctx context.Context, step *engine.Step, hash string) {
+	if c == nil || hash == "" {
+		return
+	}
+	if err := c.store.Put(ctx, c.key(step, hash)); err != nil {
+		logger.FromContext(ctx).
+			WithError(err).
+			Warn("cannot record step cache")
+	}
+}
+
+func (c *stepCache) key(step *engine.Step, hash string) stepcache.Key {
+	return stepcache.Key{Repo: c.repo, Step: step.Name, Hash: hash}
+}
+
+// helper function returns the hash of the step command, the
+// step scripts, the named environment variables and the files
+// matching the cache key patterns.
+func hashInputs(spec *engine.Spec, step *engine.Step, envs map[string]string) (string, error) {
+	h := sha256.New()
+
+	// the pipeline root is random, and is excluded from the
+	// command arguments.
+	fmt.Fprintf(h, "command %q\n", step.Command)
+	for _, arg := range step.Args {
+		fmt.Fprintf(h, "arg %q\n", strings.Replace(arg, spec.Root, "", -1))
+	}
+	for _, file := range step.Files {
+		fmt.Fprintf(h, "script %x\n", sha256.Sum256(file.Data))
+	}
+
+	names := append([]string{}, step.Cache.Env...)
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "env %q %q\n", name, envs[name])
+	}
+
+	seen := map[string]struct{}{}
+	var paths []string
+	for _, pattern := range step.Cache.Files {
+		matches, err := doublestar.Glob(filepath.Join(step.WorkingDir, pattern))
+		if err != nil {
+			return "", err
+		}
+		for _, match := range matches {
+			if _, ok := seen[match]; !ok {
+				seen[match] = struct{}{}
+				paths = append(paths, match)
+			}
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		sum, err := hashFile(path)
+		if err != nil {
+			return "", err
+		}
+		if sum == nil {
+			continue
+		}
+		rel, _ := filepath.Rel(step.WorkingDir, path)
+		fmt.Fprintf(h, "file %q %x\n", filepath.ToSlash(rel), sum)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// helper function returns the hash of the file contents, or nil
+// if the path is a directory.
+func hashFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+type cacheKey struct{}
+
+// helper function returns a context that carries the step
+// cache.
+func withCache(ctx context.Context, c *stepCache) context.Context {
+	return context.WithValue(ctx, cacheKey{}, c)
+}
+
+// helper function returns the step cache carried by the
+// context, or nil if the context does not carry a cache.
+func cacheFrom(ctx context.Context) *stepCache {
+	c, _ := ctx.Value(cacheKey{}).(*stepCache)
+	return c
+}
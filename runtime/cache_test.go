@@ -0,0 +1,68 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/internal/stepcache"
+)
+
+func TestStepCache(t *testing.T) {
+	root := t.TempDir()
+	workspace := filepath.Join(root, "drone", "src")
+	os.MkdirAll(filepath.Join(workspace, "proto", "v1"), 0700)
+	ioutil.WriteFile(filepath.Join(workspace, "proto", "v1", "api.proto"), []byte("syntax = \"proto3\";"), 0600)
+	ioutil.WriteFile(filepath.Join(workspace, "README.md"), []byte("# hello"), 0600)
+
+	spec := &engine.Spec{Root: root}
+	step := &engine.Step{
+		Name:       "generate",
+		Command:    "/bin/sh",
+		Args:       []string{filepath.Join(root, "opt", "generate")},
+		Files:      []*engine.File{{Data: []byte("buf generate")}},
+		WorkingDir: workspace,
+		Cache: &engine.Cache{
+			Files: []string{"proto/**/*.proto"},
+			Env:   []string{"BUF_VERSION"},
+		},
+	}
+	envs := map[string]string{"BUF_VERSION": "1.28.1"}
+
+	cache := &stepCache{store: stepcache.Dir(t.TempDir(), 0), repo: "octocat/hello-world"}
+	hash, hit := cache.check(context.Background(), spec, step, envs)
+	if hash == "" || hit {
+		t.Errorf("Want cache miss before the step succeeds")
+	}
+	cache.record(context.Background(), step, hash)
+
+	// files that do not match the cache key are excluded
+	// from the hash.
+	ioutil.WriteFile(filepath.Join(workspace, "README.md"), []byte("# changed"), 0600)
+	if _, hit := cache.check(context.Background(), spec, step, envs); !hit {
+		t.Errorf("Want cache hit with unchanged inputs")
+	}
+
+	ioutil.WriteFile(filepath.Join(workspace, "proto", "v1", "api.proto"), []byte("syntax = \"proto2\";"), 0600)
+	if _, hit := cache.check(context.Background(), spec, step, envs); hit {
+		t.Errorf("Want cache miss with changed files")
+	}
+
+	envs["BUF_VERSION"] = "1.29.0"
+	if other, _ := hashInputs(spec, step, envs); other == hash {
+		t.Errorf("Want hash changed with changed environment")
+	}
+
+	// steps executed on a remote host are never skipped.
+	spec.Remote = &engine.Remote{Host: "mac-1"}
+	if hash, _ := cache.check(context.Background(), spec, step, envs); hash != "" {
+		t.Errorf("Want no hash for remote steps")
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/drone/runner-go/logger"
+)
+
+// changes provides the files changed by the build, which are
+// computed from the git diff of the build commit range once
+// the repository is cloned.
+type changes struct {
+	before string
+	after  string
+
+	once  sync.Once
+	files []string
+	err   error
+}
+
+// match returns true if the files changed by the build match
+// the path conditions of the step. The step is executed if the
+// changed files are unknown, for example when the build does
+// not have a commit range.
+func (c *changes) match(ctx context.Context, spec *engine.Spec, step *engine.Step) bool {
+	if c == nil || len(step.Paths) == 0 {
+		return true
+	}
+	c.once.Do(func() {
+		c.files, c.err = c.diff(ctx, spec, step.WorkingDir)
+	})
+	if c.err != nil {
+		logger.FromContext(ctx).
+			WithError(c.err).
+			Debug("cannot evaluate path conditions")
+		return true
+	}
+	for _, paths := range step.Paths {
+		if !matchPaths(paths, c.files) {
+			return false
+		}
+	}
+	return true
+}
+
+// helper function returns the files changed between the
+// before and after commits of the build.
+func (c *changes) diff(ctx context.Context, spec *engine.Spec, dir string) ([]string, error) {
+	switch {
+	case spec.Remote != nil:
+		return nil, fmt.Errorf("cannot compute changed files on a remote host")
+	case c.before == "" || strings.Trim(c.before, "0") == "":
+		return nil, fmt.Errorf("build does not have a commit range")
+	case c.after == "":
+		return nil, fmt.Errorf("build does not have a commit")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", "-c", "safe.directory=*", "diff", "--name-only", "-z", c.before, c.after)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	var files []string
+	for _, name := range strings.Split(stdout.String(), "\x00") {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// helper function returns true if a changed file matches an
+// include pattern, and does not match an exclude pattern. If
+// no include patterns are defined, all files are included.
+func matchPaths(paths *engine.Paths, files []string) bool {
+	for _, file := range files {
+		if matchAny(paths.Exclude, file) {
+			continue
+		}
+		if len(paths.Include) == 0 || matchAny(paths.Include, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns true if the file matches any of the
+// patterns.
+func matchAny(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := doublestar.Match(pattern, file); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type changesKey struct{}
+
+// helper function returns a context that carries the changed
+// files of the build.
+func withChanges(ctx context.Context, c *changes) context.Context {
+	return context.WithValue(ctx, changesKey{}, c)
+}
+
+// helper function returns the changed files of the build
+// carried by the context, or nil if the context does not carry
+// the changed files.
+func changesFrom(ctx context.Context) *changes {
+	c, _ := ctx.Value(changesKey{}).(*changes)
+	return c
+}
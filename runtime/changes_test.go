@@ -0,0 +1,95 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+)
+
+func TestMatchPaths(t *testing.T) {
+	paths := &engine.Paths{
+		Include: []string{"pkg/**"},
+		Exclude: []string{"docs/**", "**/*.md"},
+	}
+	tests := []struct {
+		files []string
+		match bool
+	}{
+		{[]string{"pkg/api/server.go"}, true},
+		{[]string{"docs/index.md", "pkg/api/server.go"}, true},
+		{[]string{"docs/index.md"}, false},
+		{[]string{"pkg/README.md"}, false},
+		{[]string{"main.go"}, false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if got, want := matchPaths(paths, test.files), test.match; got != want {
+			t.Errorf("Want match %v for files %v", want, test.files)
+		}
+	}
+
+	// if no include patterns are defined, all files that are
+	// not excluded are included.
+	excludeOnly := &engine.Paths{Exclude: []string{"docs/**"}}
+	if !matchPaths(excludeOnly, []string{"main.go"}) {
+		t.Errorf("Want match for files not excluded")
+	}
+}
+
+func TestChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=drone", "GIT_AUTHOR_EMAIL=drone@localhost",
+			"GIT_COMMITTER_NAME=drone", "GIT_COMMITTER_EMAIL=drone@localhost",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s: %s", args[0], err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("# hello"), 0600)
+	git("add", "-A")
+	git("commit", "-q", "-m", "initial commit")
+	before := git("rev-parse", "HEAD")
+	os.MkdirAll(filepath.Join(dir, "docs"), 0700)
+	ioutil.WriteFile(filepath.Join(dir, "docs", "index.md"), []byte("# docs"), 0600)
+	git("add", "-A")
+	git("commit", "-q", "-m", "add docs")
+	after := git("rev-parse", "HEAD")
+
+	spec := &engine.Spec{Root: dir}
+	build := &engine.Step{Name: "build", WorkingDir: dir, Paths: []*engine.Paths{{Include: []string{"pkg/**"}}}}
+	docs := &engine.Step{Name: "docs", WorkingDir: dir, Paths: []*engine.Paths{{Include: []string{"docs/**"}}}}
+
+	c := &changes{before: before, after: after}
+	if c.match(context.Background(), spec, build) {
+		t.Errorf("Want build step skipped when only docs changed")
+	}
+	if !c.match(context.Background(), spec, docs) {
+		t.Errorf("Want docs step executed when docs changed")
+	}
+
+	// steps are executed if the changed files are unknown.
+	c = &changes{before: "0000000000000000000000000000000000000000", after: after}
+	if !c.match(context.Background(), spec, build) {
+		t.Errorf("Want step executed without a commit range")
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"sync"
+)
+
+// Control controls the capacity and labels of a poller while
+// the runner is running. The poller stops requesting stages
+// when drained, and running stages are not interrupted.
+type Control struct {
+	mu sync.Mutex
+
+	name     string
+	capacity int
+	labels   map[string]string
+	drained  bool
+	changed  chan struct{}
+}
+
+// NewControl returns a new poller control with the initial
+// capacity and labels.
+func NewControl(name string, capacity int, labels map[string]string) *Control {
+	return &Control{
+		name:     name,
+		capacity: capacity,
+		labels:   copyLabels(labels),
+		changed:  make(chan struct{}),
+	}
+}
+
+// Name returns the name of the controlled runner.
+func (c *Control) Name() string {
+	return c.name
+}
+
+// Capacity returns the number of stages the runner requests
+// concurrently.
+func (c *Control) Capacity() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.capacity
+}
+
+// SetCapacity updates the number of stages the runner requests
+// concurrently. Running stages in excess of the capacity are
+// not interrupted.
+func (c *Control) SetCapacity(capacity int) {
+	c.mu.Lock()
+	c.capacity = capacity
+	c.notify()
+	c.mu.Unlock()
+}
+
+// Labels returns a copy of the labels used to request stages.
+func (c *Control) Labels() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return copyLabels(c.labels)
+}
+
+// SetLabels updates the labels used to request stages. The
+// labels apply to the next request, and requests in progress
+// are not interrupted.
+func (c *Control) SetLabels(labels map[string]string) {
+	c.mu.Lock()
+	c.labels = copyLabels(labels)
+	c.notify()
+	c.mu.Unlock()
+}
+
+// Drained returns true if the runner is drained.
+func (c *Control) Drained() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.drained
+}
+
+// Drain stops or resumes requesting stages.
+func (c *Control) Drain(drained bool) {
+	c.mu.Lock()
+	c.drained = drained
+	c.notify()
+	c.mu.Unlock()
+}
+
+// wait blocks until the poller thread is permitted to request
+// a stage. The backlog permits threads in excess of the
+// capacity, unless the capacity is zero. It returns false if
+// the context is cancelled.
+func (c *Control) wait(ctx context.Context, thread, backlog int) bool {
+	for {
+		c.mu.Lock()
+		ok := !c.drained && c.capacity > 0 && thread < c.capacity+backlog
+		changed := c.changed
+		c.mu.Unlock()
+		if ok {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
+
+// watch returns a channel that is closed when the control
+// changes.
+func (c *Control) watch() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changed
+}
+
+// notify wakes the goroutines waiting for a change. The mutex
+// must be held.
+func (c *Control) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// helper function returns a copy of the labels.
+func copyLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestControl_Wait(t *testing.T) {
+	control := NewControl("default", 1, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if !control.wait(ctx, 0, 0) {
+		t.Errorf("Want thread within capacity permitted")
+	}
+
+	done := make(chan bool)
+	go func() { done <- control.wait(ctx, 1, 0) }()
+	select {
+	case <-done:
+		t.Fatalf("Want thread in excess of capacity blocked")
+	case <-time.After(10 * time.Millisecond):
+	}
+	control.SetCapacity(2)
+	if !<-done {
+		t.Errorf("Want thread permitted after capacity increased")
+	}
+}
+
+func TestControl_Drain(t *testing.T) {
+	control := NewControl("default", 1, nil)
+	control.Drain(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if control.wait(ctx, 0, 0) {
+		t.Errorf("Want drained thread blocked")
+	}
+}
+
+func TestControl_Labels(t *testing.T) {
+	labels := map[string]string{"os": "linux"}
+	control := NewControl("default", 1, labels)
+	labels["os"] = "darwin"
+	if got := control.Labels()["os"]; got != "linux" {
+		t.Errorf("Want labels copied, got os %s", got)
+	}
+}
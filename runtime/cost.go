@@ -0,0 +1,115 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+
+	"github.com/docker/go-units"
+)
+
+// cache status of a step reported in the cost summary.
+const (
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+)
+
+// stepCost is the cost of a completed step.
+type stepCost struct {
+	Name   string  `json:"name"`
+	Wall   float64 `json:"wall_seconds"`
+	CPU    float64 `json:"cpu_seconds"`
+	MaxRSS int64   `json:"peak_rss_bytes"`
+	Cache  string  `json:"cache,omitempty"`
+}
+
+// costs records the cost of the completed steps of a stage,
+// which is written to the log of the summary step once the
+// other steps complete.
+type costs struct {
+	mu    sync.Mutex
+	steps map[string]*stepCost
+}
+
+// record records the cost of the step. The process state is
+// nil if the step did not execute a process.
+func (c *costs) record(step *engine.Step, wall time.Duration, state *engine.State, cache string) {
+	cost := &stepCost{
+		Name:  step.Name,
+		Wall:  wall.Seconds(),
+		Cache: cache,
+	}
+	if state != nil {
+		cost.CPU = state.CPU.Seconds()
+		cost.MaxRSS = state.MaxRSS
+	}
+	c.mu.Lock()
+	if c.steps == nil {
+		c.steps = map[string]*stepCost{}
+	}
+	c.steps[step.Name] = cost
+	c.mu.Unlock()
+}
+
+// write writes the cost of the completed steps, in pipeline
+// order, as a table followed by a single line json document.
+func (c *costs) write(w io.Writer, spec *engine.Spec) {
+	c.mu.Lock()
+	out := struct {
+		Steps []*stepCost `json:"steps"`
+	}{Steps: []*stepCost{}}
+	for _, step := range spec.Steps {
+		if cost, ok := c.steps[step.Name]; ok {
+			out.Steps = append(out.Steps, cost)
+		}
+	}
+	c.mu.Unlock()
+
+	// the summary is buffered and written at once, since the
+	// tabwriter writes the table cell by cell.
+	buf := new(bytes.Buffer)
+	tw := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tWALL\tCPU\tPEAK RSS\tCACHE")
+	for _, cost := range out.Steps {
+		rss, cache := "-", cost.Cache
+		if cost.MaxRSS > 0 {
+			rss = units.BytesSize(float64(cost.MaxRSS))
+		}
+		if cache == "" {
+			cache = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%.1fs\t%.1fs\t%s\t%s\n", cost.Name, cost.Wall, cost.CPU, rss, cache)
+	}
+	tw.Flush()
+
+	data, _ := json.Marshal(out)
+	fmt.Fprintf(buf, "%s\n", data)
+	w.Write(buf.Bytes())
+}
+
+type costsKey struct{}
+
+// helper function returns a context that carries the costs.
+func withCosts(ctx context.Context, c *costs) context.Context {
+	return context.WithValue(ctx, costsKey{}, c)
+}
+
+// helper function returns the costs carried by the context,
+// or new costs if the context does not carry costs.
+func costsFrom(ctx context.Context) *costs {
+	if c, ok := ctx.Value(costsKey{}).(*costs); ok {
+		return c
+	}
+	return new(costs)
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCosts(t *testing.T) {
+	build := &engine.Step{Name: "build"}
+	test := &engine.Step{Name: "test"}
+	spec := &engine.Spec{Steps: []*engine.Step{build, test, {Name: "summary", Summary: true}}}
+
+	c := new(costs)
+	c.record(test, 0, nil, cacheHit)
+	c.record(build, 90*time.Second, &engine.State{CPU: 150 * time.Second, MaxRSS: 2 << 20}, cacheMiss)
+
+	buf := new(bytes.Buffer)
+	c.write(buf, spec)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Want header, 2 steps and json, got %d lines", len(lines))
+	}
+	if got, want := strings.Fields(lines[1]), []string{"build", "90.0s", "150.0s", "2MiB", "miss"}; !cmp.Equal(got, want) {
+		t.Errorf("Want table row %q, got %q", want, got)
+	}
+	if got, want := strings.Fields(lines[2]), []string{"test", "0.0s", "0.0s", "-", "hit"}; !cmp.Equal(got, want) {
+		t.Errorf("Want table row %q, got %q", want, got)
+	}
+
+	var out struct {
+		Steps []*stepCost `json:"steps"`
+	}
+	if err := json.Unmarshal([]byte(lines[3]), &out); err != nil {
+		t.Fatal(err)
+	}
+	want := []*stepCost{
+		{Name: "build", Wall: 90, CPU: 150, MaxRSS: 2 << 20, Cache: cacheMiss},
+		{Name: "test", Cache: cacheHit},
+	}
+	if diff := cmp.Diff(out.Steps, want); diff != "" {
+		t.Errorf("Unexpected json summary")
+		t.Log(diff)
+	}
+}
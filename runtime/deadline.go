@@ -0,0 +1,49 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+type deadlineKey struct{}
+
+// deadline tracks the runner-level maximum duration of a
+// stage, which is enforced independent of the build timeout
+// provided by the server.
+type deadline struct {
+	max      time.Duration
+	exceeded int32
+}
+
+// withMaxDuration returns a context that is cancelled when the
+// maximum duration is exceeded. Use maxDurationExceeded to
+// determine whether the context was cancelled because the
+// maximum duration was exceeded.
+func withMaxDuration(ctx context.Context, max time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	d := &deadline{max: max}
+	timer := time.AfterFunc(max, func() {
+		atomic.StoreInt32(&d.exceeded, 1)
+		cancel()
+	})
+	return context.WithValue(ctx, deadlineKey{}, d), func() {
+		timer.Stop()
+		cancel()
+	}
+}
+
+// maxDurationExceeded returns an error if the context was
+// cancelled because the maximum duration was exceeded.
+func maxDurationExceeded(ctx context.Context) error {
+	d, ok := ctx.Value(deadlineKey{}).(*deadline)
+	if !ok || atomic.LoadInt32(&d.exceeded) == 0 {
+		return nil
+	}
+	return fmt.Errorf("exceeded runner limit of %s", d.max)
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMaxDuration(t *testing.T) {
+	ctx, cancel := withMaxDuration(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	<-ctx.Done()
+	err := maxDurationExceeded(ctx)
+	if err == nil {
+		t.Fatalf("Expect error when maximum duration exceeded")
+	}
+	if got, want := err.Error(), "exceeded runner limit of 10ms"; got != want {
+		t.Errorf("Want error %q, got %q", want, got)
+	}
+}
+
+func TestMaxDuration_Cancel(t *testing.T) {
+	ctx, cancel := withMaxDuration(context.Background(), time.Hour)
+	cancel()
+
+	<-ctx.Done()
+	if err := maxDurationExceeded(ctx); err != nil {
+		t.Errorf("Expect no error when context cancelled, got %s", err)
+	}
+	if err := maxDurationExceeded(context.Background()); err != nil {
+		t.Errorf("Expect no error when maximum duration not configured")
+	}
+}
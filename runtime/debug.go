@@ -0,0 +1,89 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"sort"
+	"sync"
+)
+
+// Debugs stores the stages and repositories that an
+// administrator marked for debugging. The debug session is
+// enabled for the next failure of a marked stage or of a stage
+// of a marked repository, regardless of the pipeline
+// configuration, and the mark is removed once the stage fails.
+type Debugs struct {
+	sync.Mutex
+
+	stages map[int64]struct{}
+	repos  map[string]struct{}
+}
+
+// Marks lists the stages and repositories marked for
+// debugging.
+type Marks struct {
+	Stages []int64  `json:"stages"`
+	Repos  []string `json:"repos"`
+}
+
+// NewDebugs returns a new debug mark store.
+func NewDebugs() *Debugs {
+	return &Debugs{
+		stages: map[int64]struct{}{},
+		repos:  map[string]struct{}{},
+	}
+}
+
+// MarkStage marks the stage for debugging.
+func (d *Debugs) MarkStage(stage int64) {
+	d.Lock()
+	d.stages[stage] = struct{}{}
+	d.Unlock()
+}
+
+// MarkRepo marks the repository for debugging.
+func (d *Debugs) MarkRepo(slug string) {
+	d.Lock()
+	d.repos[slug] = struct{}{}
+	d.Unlock()
+}
+
+// Marked returns true if the stage or the repository is marked
+// for debugging.
+func (d *Debugs) Marked(stage int64, slug string) bool {
+	d.Lock()
+	defer d.Unlock()
+	_, a := d.stages[stage]
+	_, b := d.repos[slug]
+	return a || b
+}
+
+// Clear removes the debug marks of the stage and the
+// repository.
+func (d *Debugs) Clear(stage int64, slug string) {
+	d.Lock()
+	delete(d.stages, stage)
+	delete(d.repos, slug)
+	d.Unlock()
+}
+
+// List returns the debug marks.
+func (d *Debugs) List() *Marks {
+	d.Lock()
+	defer d.Unlock()
+	out := &Marks{
+		Stages: []int64{},
+		Repos:  []string{},
+	}
+	for stage := range d.stages {
+		out.Stages = append(out.Stages, stage)
+	}
+	for slug := range d.repos {
+		out.Repos = append(out.Repos, slug)
+	}
+	sort.Slice(out.Stages, func(i, j int) bool { return out.Stages[i] < out.Stages[j] })
+	sort.Strings(out.Repos)
+	return out
+}
@@ -0,0 +1,36 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDebugs(t *testing.T) {
+	debugs := NewDebugs()
+	if debugs.Marked(1, "octocat/hello-world") {
+		t.Errorf("Expect stage not marked")
+	}
+
+	debugs.MarkStage(1)
+	debugs.MarkRepo("octocat/hello-world")
+	if !debugs.Marked(1, "octocat/spoon-knife") {
+		t.Errorf("Expect stage marked")
+	}
+	if !debugs.Marked(2, "octocat/hello-world") {
+		t.Errorf("Expect repository marked")
+	}
+	want := &Marks{Stages: []int64{1}, Repos: []string{"octocat/hello-world"}}
+	if diff := cmp.Diff(want, debugs.List()); diff != "" {
+		t.Errorf(diff)
+	}
+
+	debugs.Clear(1, "octocat/hello-world")
+	if debugs.Marked(1, "octocat/hello-world") {
+		t.Errorf("Expect marks cleared")
+	}
+}
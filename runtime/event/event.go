@@ -0,0 +1,102 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package event publishes pipeline lifecycle events to
+// subscribers, so that extensions can observe pipeline
+// execution without changes to the core execution code.
+package event
+
+import (
+	"sync"
+
+	"github.com/drone/drone-go/drone"
+)
+
+// Type identifies the event type.
+type Type string
+
+// Event type enumeration.
+const (
+	StageAccepted   Type = "stage.accepted"
+	StageCompleted  Type = "stage.completed"
+	StepStarted     Type = "step.started"
+	StepCompleted   Type = "step.completed"
+	LineLogged      Type = "line.logged"
+	RunnerTripped   Type = "runner.tripped"
+	RunnerReset     Type = "runner.reset"
+	RunnerThrottled Type = "runner.throttled"
+	RunnerResumed   Type = "runner.resumed"
+)
+
+// Event is a pipeline lifecycle event. The stage, step and line
+// are copies, and may be retained by the subscriber.
+type Event struct {
+	Type  Type         `json:"type"`
+	Time  int64        `json:"time"`
+	Repo  string       `json:"repo"`
+	Build int64        `json:"build"`
+	Stage *drone.Stage `json:"stage,omitempty"`
+	Step  *drone.Step  `json:"step,omitempty"`
+	Line  *drone.Line  `json:"line,omitempty"`
+
+	// Elapsed is the time in milliseconds since the step
+	// started that the line was logged, measured with the
+	// monotonic clock.
+	Elapsed int64 `json:"elapsed,omitempty"`
+
+	// Message describes runner events, such as the reason
+	// the circuit breaker tripped or the host is throttled.
+	Message string `json:"message,omitempty"`
+}
+
+// Bus publishes events to subscribers.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[chan *Event]struct{}
+}
+
+// New returns a new event bus.
+func New() *Bus {
+	return &Bus{subs: map[chan *Event]struct{}{}}
+}
+
+// Subscribe returns a channel that receives published events,
+// and a function that cancels the subscription. Publishing does
+// not block, and events are discarded if the channel buffer is
+// full.
+func (b *Bus) Subscribe(buffer int) (<-chan *Event, func()) {
+	c := make(chan *Event, buffer)
+	b.mu.Lock()
+	b.subs[c] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, c)
+			b.mu.Unlock()
+			close(c)
+		})
+	}
+}
+
+// Publish publishes the event to the subscribers.
+func (b *Bus) Publish(event *Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for c := range b.subs {
+		select {
+		case c <- event:
+		default:
+		}
+	}
+}
+
+// Subscribed returns true if the bus has subscribers.
+func (b *Bus) Subscribed() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.subs) != 0
+}
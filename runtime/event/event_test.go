@@ -0,0 +1,268 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package event
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+)
+
+func TestBus(t *testing.T) {
+	bus := New()
+	if bus.Subscribed() {
+		t.Errorf("Expect no subscribers")
+	}
+	events, cancel := bus.Subscribe(1)
+	bus.Publish(&Event{Type: StageAccepted})
+	bus.Publish(&Event{Type: StageCompleted}) // discarded, buffer full
+	if got := <-events; got.Type != StageAccepted {
+		t.Errorf("Want event %s, got %s", StageAccepted, got.Type)
+	}
+	cancel()
+	cancel()
+	if _, ok := <-events; ok {
+		t.Errorf("Expect channel closed when cancelled")
+	}
+	bus.Publish(&Event{Type: StageAccepted})
+}
+
+func TestReporter(t *testing.T) {
+	bus := New()
+	events, cancel := bus.Subscribe(10)
+	defer cancel()
+
+	state := &pipeline.State{
+		Repo:  &drone.Repo{Slug: "octocat/hello-world"},
+		Build: &drone.Build{Number: 42},
+		Stage: &drone.Stage{
+			Status: drone.StatusRunning,
+			Steps:  []*drone.Step{{Name: "build", Status: drone.StatusRunning}},
+		},
+	}
+	reporter := NewReporter(pipeline.NopReporter(), bus)
+	streamer := NewStreamer(pipeline.NopStreamer(), bus)
+
+	reporter.ReportStep(context.Background(), state, "build")
+	w := streamer.Stream(context.Background(), state, "build")
+	w.Write([]byte("go build\ngo test\n"))
+	w.Close()
+	state.Stage.Steps[0].Status = drone.StatusPassing
+	reporter.ReportStep(context.Background(), state, "build")
+	reporter.ReportStage(context.Background(), state) // still running
+	state.Stage.Status = drone.StatusPassing
+	reporter.ReportStage(context.Background(), state)
+
+	want := []Type{StepStarted, LineLogged, LineLogged, StepCompleted, StageCompleted}
+	for i, typ := range want {
+		got := <-events
+		if got.Type != typ {
+			t.Errorf("Want event %d type %s, got %s", i, typ, got.Type)
+		}
+		if got.Repo != "octocat/hello-world" || got.Build != 42 {
+			t.Errorf("Expect event %d includes the repository and build", i)
+		}
+	}
+	if len(events) != 0 {
+		t.Errorf("Expect no further events")
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	received := make(chan *Event, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer correct-horse" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		event := new(Event)
+		json.NewDecoder(r.Body).Decode(event)
+		received <- event
+	}))
+	defer ts.Close()
+
+	events := make(chan *Event, 2)
+	events <- &Event{Type: LineLogged}
+	events <- &Event{Type: StageCompleted}
+	close(events)
+	Webhook(context.Background(), events, ts.URL, "correct-horse", []string{"stage.completed"})
+
+	if got := <-received; got.Type != StageCompleted {
+		t.Errorf("Want event %s posted, got %s", StageCompleted, got.Type)
+	}
+}
+
+func TestKafka(t *testing.T) {
+	received := make(chan *kafkaRecords, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/topics/builds" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		records := new(kafkaRecords)
+		json.NewDecoder(r.Body).Decode(records)
+		received <- records
+	}))
+	defer ts.Close()
+
+	events := make(chan *Event, 2)
+	events <- &Event{Type: LineLogged}
+	events <- &Event{Type: StageCompleted, Repo: "octocat/hello-world"}
+	close(events)
+	Kafka(context.Background(), events, KafkaConfig{
+		Endpoint: ts.URL,
+		Topic:    "builds",
+		Types:    []string{"stage.completed"},
+	})
+
+	got := <-received
+	if len(got.Records) != 1 {
+		t.Fatalf("Want 1 record, got %d", len(got.Records))
+	}
+	if got.Records[0].Key != "octocat/hello-world" {
+		t.Errorf("Want record keyed by repository, got %q", got.Records[0].Key)
+	}
+	if got.Records[0].Value.Type != StageCompleted {
+		t.Errorf("Want event %s published, got %s", StageCompleted, got.Records[0].Value.Type)
+	}
+}
+
+func TestNATS(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "INFO {}\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "CONNECT"):
+				if !strings.Contains(line, `"auth_token":"correct-horse"`) {
+					fmt.Fprint(conn, "-ERR 'Authorization Violation'\r\n")
+					return
+				}
+			case strings.HasPrefix(line, "PING"):
+				fmt.Fprint(conn, "PONG\r\n")
+			case strings.HasPrefix(line, "PUB"):
+				payload, _ := r.ReadString('\n')
+				received <- line + payload
+			}
+		}
+	}()
+
+	events := make(chan *Event, 2)
+	events <- &Event{Type: LineLogged}
+	events <- &Event{Type: StepCompleted}
+	close(events)
+	NATS(context.Background(), events, NATSConfig{
+		URL:     "nats://" + l.Addr().String(),
+		Token:   "correct-horse",
+		Subject: "drone",
+		Types:   []string{"step.completed"},
+	})
+
+	got := <-received
+	if !strings.HasPrefix(got, "PUB drone.step.completed ") {
+		t.Errorf("Want event published to subject drone.step.completed, got %q", got)
+	}
+	if !strings.Contains(got, `"type":"step.completed"`) {
+		t.Errorf("Want event payload, got %q", got)
+	}
+}
+
+func TestNATS_Error(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "INFO {}\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, "PING"):
+				fmt.Fprint(conn, "PONG\r\n")
+			case strings.HasPrefix(line, "PUB"):
+				r.ReadString('\n')
+				fmt.Fprint(conn, "-ERR 'Permissions Violation for Publish to \"drone.step.completed\"'\r\n")
+			}
+		}
+	}()
+
+	conn, err := dialNATS(context.Background(), NATSConfig{URL: "nats://" + l.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.close()
+	err = conn.publish("drone.step.completed", []byte("{}"))
+	if err == nil || !strings.Contains(err.Error(), "Permissions Violation") {
+		t.Errorf("Want permissions violation error, got %v", err)
+	}
+}
+
+// This test verifies that the connection is upgraded to tls
+// if required by the server.
+func TestNATS_TLSRequired(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	handshake := make(chan byte, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "INFO {\"tls_required\":true}\r\n")
+		b := make([]byte, 1)
+		conn.Read(b)
+		handshake <- b[0]
+	}()
+
+	_, err = dialNATS(context.Background(), NATSConfig{URL: "nats://" + l.Addr().String()})
+	if err == nil {
+		t.Errorf("Want tls handshake error")
+	}
+	// 0x16 is the tls handshake record type.
+	if got, want := <-handshake, byte(0x16); got != want {
+		t.Errorf("Want tls handshake record %#x, got %#x", want, got)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// KafkaConfig configures the Kafka publisher.
+type KafkaConfig struct {
+	// Endpoint is the address of the Kafka REST proxy.
+	Endpoint string
+
+	// Token is the optional bearer token.
+	Token string
+
+	// Topic is the topic to which events are published.
+	Topic string
+
+	// Types optionally limits the events that are published.
+	Types []string
+}
+
+// Kafka publishes the subscribed events to the Kafka topic
+// using the Kafka REST proxy, until the context is cancelled.
+// Events are keyed by repository, so that the events of a
+// repository are published to the same partition in order.
+func Kafka(ctx context.Context, events <-chan *Event, config KafkaConfig) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	endpoint := strings.TrimSuffix(config.Endpoint, "/") + "/topics/" + url.PathEscape(config.Topic)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if !Match(event, config.Types) {
+				continue
+			}
+			if err := produce(ctx, client, endpoint, config.Token, event); err != nil {
+				logrus.WithError(err).
+					WithField("event", event.Type).
+					Debugln("cannot publish event to kafka")
+			}
+		}
+	}
+}
+
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key"`
+	Value *Event `json:"value"`
+}
+
+func produce(ctx context.Context, client *http.Client, endpoint, token string, event *Event) error {
+	data, err := json.Marshal(&kafkaRecords{
+		Records: []kafkaRecord{{Key: event.Repo, Value: event}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package event
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+)
+
+var _ pipeline.Reporter = (*Reporter)(nil)
+
+// Reporter is a pipeline.Reporter that publishes step and
+// stage lifecycle events.
+type Reporter struct {
+	base pipeline.Reporter
+	bus  *Bus
+}
+
+// NewReporter returns a new Reporter that wraps the base
+// reporter.
+func NewReporter(base pipeline.Reporter, bus *Bus) *Reporter {
+	return &Reporter{base: base, bus: bus}
+}
+
+// ReportStage reports the stage status, and publishes an event
+// when the stage is completed.
+func (r *Reporter) ReportStage(ctx context.Context, state *pipeline.State) error {
+	err := r.base.ReportStage(ctx, state)
+	state.Lock()
+	event := newEvent(StageCompleted, state)
+	state.Unlock()
+	if !isRunning(event.Stage.Status) {
+		r.bus.Publish(event)
+	}
+	return err
+}
+
+// ReportStep reports the named step status, and publishes an
+// event when the step is started or completed.
+func (r *Reporter) ReportStep(ctx context.Context, state *pipeline.State, name string) error {
+	err := r.base.ReportStep(ctx, state, name)
+	state.Lock()
+	event := newEvent(StepCompleted, state)
+	for _, step := range state.Stage.Steps {
+		if step.Name == name {
+			copy := *step
+			event.Step = &copy
+		}
+	}
+	state.Unlock()
+	if event.Step == nil {
+		return err
+	}
+	if event.Step.Status == drone.StatusRunning {
+		event.Type = StepStarted
+	}
+	r.bus.Publish(event)
+	return err
+}
+
+var _ pipeline.Streamer = (*Streamer)(nil)
+
+// Streamer is a pipeline.Streamer that publishes an event for
+// each line logged by a step.
+type Streamer struct {
+	base pipeline.Streamer
+	bus  *Bus
+}
+
+// NewStreamer returns a new Streamer that wraps the base
+// streamer.
+func NewStreamer(base pipeline.Streamer, bus *Bus) *Streamer {
+	return &Streamer{base: base, bus: bus}
+}
+
+// Stream returns an io.WriteCloser that publishes the lines
+// written by the step.
+func (s *Streamer) Stream(ctx context.Context, state *pipeline.State, name string) io.WriteCloser {
+	state.Lock()
+	event := newEvent(LineLogged, state)
+	for _, step := range state.Stage.Steps {
+		if step.Name == name {
+			copy := *step
+			event.Step = &copy
+		}
+	}
+	state.Unlock()
+	return &writer{
+		base:  s.base.Stream(ctx, state, name),
+		bus:   s.bus,
+		event: *event,
+		start: time.Now(),
+	}
+}
+
+type writer struct {
+	base  io.WriteCloser
+	bus   *Bus
+	event Event
+	start time.Time
+
+	mu  sync.Mutex
+	num int
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.base.Write(p)
+	if !w.bus.Subscribed() {
+		return n, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, part := range strings.SplitAfter(string(p), "\n") {
+		if part == "" {
+			continue
+		}
+		elapsed := time.Since(w.start)
+		event := w.event
+		event.Time = time.Now().Unix()
+		event.Elapsed = elapsed.Milliseconds()
+		event.Line = &drone.Line{
+			Number:    w.num,
+			Message:   part,
+			Timestamp: int64(elapsed.Seconds()),
+		}
+		w.num++
+		w.bus.Publish(&event)
+	}
+	return n, err
+}
+
+func (w *writer) Close() error {
+	return w.base.Close()
+}
+
+// helper function returns a new event for the pipeline state.
+// The pipeline state must be locked.
+func newEvent(typ Type, state *pipeline.State) *Event {
+	stage := *state.Stage
+	stage.Steps = nil
+	return &Event{
+		Type:  typ,
+		Time:  time.Now().Unix(),
+		Repo:  state.Repo.Slug,
+		Build: state.Build.Number,
+		Stage: &stage,
+	}
+}
+
+// helper function returns true if the status indicates the
+// stage is pending or running.
+func isRunning(status string) bool {
+	switch status {
+	case drone.StatusPending, drone.StatusRunning:
+		return true
+	default:
+		return false
+	}
+}
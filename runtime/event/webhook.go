@@ -0,0 +1,79 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Webhook posts the subscribed events to the endpoint until
+// the context is cancelled. The optional types limit the events
+// that are posted.
+func Webhook(ctx context.Context, events <-chan *Event, endpoint, token string, types []string) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if !Match(event, types) {
+				continue
+			}
+			if err := post(ctx, client, endpoint, token, event); err != nil {
+				logrus.WithError(err).
+					WithField("event", event.Type).
+					Debugln("cannot post event to webhook")
+			}
+		}
+	}
+}
+
+// Match returns true if the event type is in the list of
+// types, or if the list is empty.
+func Match(event *Event, types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, typ := range types {
+		if Type(typ) == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+func post(ctx context.Context, client *http.Client, endpoint, token string, event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
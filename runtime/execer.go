@@ -8,10 +8,18 @@ package runtime
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"sync"
+	"time"
 
 	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/engine/debug"
+	"github.com/drone-runners/drone-runner-exec/engine/probe"
 	"github.com/drone-runners/drone-runner-exec/engine/replacer"
+	"github.com/drone-runners/drone-runner-exec/engine/section"
+	"github.com/drone-runners/drone-runner-exec/internal/metrics"
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/environ"
 	"github.com/drone/runner-go/logger"
@@ -29,25 +37,36 @@ type Execer interface {
 }
 
 type execer struct {
-	mu       sync.Mutex
-	engine   engine.Engine
-	reporter pipeline.Reporter
-	streamer pipeline.Streamer
-	sem      *semaphore.Weighted
+	mu         sync.Mutex
+	engine     engine.Engine
+	reporter   pipeline.Reporter
+	streamer   pipeline.Streamer
+	workspaces *Workspaces
+	gates      *Gates
+	sem        *semaphore.Weighted
+	run        StepFunc
 }
 
-// NewExecer returns a new execer used
+// NewExecer returns a new execer used. The optional middleware
+// wraps the execution of each pipeline step, where the first
+// middleware is the outermost.
 func NewExecer(
 	reporter pipeline.Reporter,
 	streamer pipeline.Streamer,
 	engine engine.Engine,
+	workspaces *Workspaces,
+	gates *Gates,
 	procs int64,
+	middleware ...Middleware,
 ) Execer {
 	exec := &execer{
-		reporter: reporter,
-		streamer: streamer,
-		engine:   engine,
+		reporter:   reporter,
+		streamer:   streamer,
+		engine:     engine,
+		workspaces: workspaces,
+		gates:      gates,
 	}
+	exec.run = chain(exec.step, middleware)
 	if procs > 0 {
 		// optional semaphor that limits the number of steps
 		// that can execute concurrently.
@@ -59,12 +78,101 @@ func NewExecer(
 // Exec executes the intermediate representation of the pipeline
 // and returns an error if execution fails.
 func (e *execer) Exec(ctx context.Context, spec *engine.Spec, state *pipeline.State) error {
-	defer e.engine.Destroy(noContext, spec)
+	defer e.cleanup(spec, state)
 
+	var result error
+
+	// stages that fail for an infrastructure reason attributable
+	// to the runner are retried with a new pipeline environment,
+	// if configured, instead of failing the build.
+	retries := retriesFrom(ctx)
+	for {
+		err := e.setup(ctx, spec)
+		if err == nil {
+			if err := e.steps(ctx, spec, state); err != nil {
+				multierror.Append(result, err)
+			}
+		}
+		// cancelled stages are neither retried nor recorded by
+		// the circuit breaker.
+		if ctx.Err() == nil {
+			reason := infraFailure(state, err)
+			if reason != "" && retries > 0 {
+				retries--
+				logger.FromContext(ctx).
+					WithField("stage.failure", reason).
+					WithField("retries", retries).
+					Warn("retrying stage after infrastructure failure")
+				e.engine.Destroy(noContext, spec)
+				resetState(state)
+				continue
+			}
+			breakerFrom(ctx).record(reason)
+		}
+		if err != nil {
+			state.FailAll(err)
+			return e.reporter.ReportStage(noContext, state)
+		}
+		break
+	}
+
+	// artifacts are uploaded for consumption by dependent
+	// stages, unless the stage failed.
+	handoff := handoffFrom(ctx)
+	if handoff != nil && spec.Artifacts != nil && !state.Failed() && !state.Cancelled() {
+		if err := handoff.upload(noContext, spec); err != nil {
+			logger.FromContext(ctx).WithError(err).Error("cannot upload artifacts")
+			state.FailAll(err)
+		}
+	}
+
+	// once pipeline execution completes, notify the state
+	// manageer that all steps are finished.
+	state.FinishAll()
+
+	// the signed provenance of the stage is recorded once all
+	// steps are finished, while the workspace exists.
+	if recorder := provenanceFrom(ctx); recorder != nil {
+		recordProvenance(logger.WithContext(noContext, logger.FromContext(ctx)), recorder, spec, state)
+	}
+	if err := e.reporter.ReportStage(noContext, state); err != nil {
+		multierror.Append(result, err)
+	}
+	return result
+}
+
+// helper function prepares the pipeline environment, and
+// downloads the artifacts produced by the upstream stages.
+func (e *execer) setup(ctx context.Context, spec *engine.Spec) error {
 	if err := e.engine.Setup(noContext, spec); err != nil {
-		state.FailAll(err)
-		return e.reporter.ReportStage(noContext, state)
+		return err
+	}
+	handoff := handoffFrom(ctx)
+	if handoff != nil && spec.Artifacts != nil {
+		if err := handoff.download(ctx, spec); err != nil {
+			logger.FromContext(ctx).WithError(err).Error("cannot download artifacts")
+			return err
+		}
 	}
+	return nil
+}
+
+// helper function executes the pipeline steps, and returns
+// once all pipeline steps complete.
+func (e *execer) steps(ctx context.Context, spec *engine.Spec, state *pipeline.State) error {
+	// detached steps and services run until all pipeline steps
+	// complete, at which point they are torn down.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+
+	// values exported by pipeline steps are injected into
+	// subsequent pipeline steps.
+	outputs := outputsFrom(ctx)
+
+	// the cost of the steps is recorded for the summary step,
+	// and is reset when the stage is retried.
+	ctx = withCosts(ctx, new(costs))
 
 	// create a directed graph, where each vertex in the graph
 	// is a pipeline step.
@@ -72,7 +180,7 @@ func (e *execer) Exec(ctx context.Context, spec *engine.Spec, state *pipeline.St
 	for _, s := range spec.Steps {
 		step := s
 		d.AddVertex(step.Name, func() error {
-			return e.exec(ctx, state, spec, step)
+			return e.exec(ctx, state, spec, step, &wg, outputs)
 		})
 	}
 
@@ -84,21 +192,25 @@ func (e *execer) Exec(ctx context.Context, spec *engine.Spec, state *pipeline.St
 		}
 	}
 
-	var result error
-	if err := d.Run(); err != nil {
-		multierror.Append(result, err)
-	}
+	err := d.Run()
 
-	// once pipeline execution completes, notify the state
-	// manageer that all steps are finished.
-	state.FinishAll()
-	if err := e.reporter.ReportStage(noContext, state); err != nil {
-		multierror.Append(result, err)
+	// terminate detached steps and services, and wait for the
+	// processes to exit.
+	cancel()
+	wg.Wait()
+	return err
+}
+
+// helper function destroys the pipeline environment, unless the
+// workspace is preserved by the cleanup policy.
+func (e *execer) cleanup(spec *engine.Spec, state *pipeline.State) {
+	if e.workspaces != nil && e.workspaces.Preserve(spec, state) {
+		return
 	}
-	return result
+	e.engine.Destroy(noContext, spec)
 }
 
-func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step) error {
+func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step, wg *sync.WaitGroup, outputs *outputs) error {
 	var result error
 
 	select {
@@ -149,6 +261,28 @@ func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.S
 		return e.reporter.ReportStep(noContext, state, step.Name)
 	}
 
+	// steps with path conditions are skipped if the files
+	// changed by the build do not match.
+	if !changesFrom(ctx).match(ctx, spec, step) {
+		log.Debug("skipped step with unmatched path conditions")
+		state.Skip(step.Name)
+		return e.reporter.ReportStep(noContext, state, step.Name)
+	}
+
+	// steps with a cache key are skipped if the inputs are
+	// unchanged since a previous successful run.
+	cache := cacheFrom(ctx)
+	hash, hit := cache.check(ctx, spec, step, environ.Combine(step.Envs, outputs.environ()))
+	if hit {
+		log.WithField("step.cache", hash).Debug("skipped step with unchanged inputs")
+		state.Skip(step.Name)
+		wc := e.streamer.Stream(noContext, state, step.Name)
+		fmt.Fprintf(wc, "skipped: inputs unchanged since a previous successful run (%.12s)\n", hash)
+		wc.Close()
+		costsFrom(ctx).record(step, 0, nil, cacheHit)
+		return e.reporter.ReportStep(noContext, state, step.Name)
+	}
+
 	state.Start(step.Name)
 	err := e.reporter.ReportStep(noContext, state, step.Name)
 	if err != nil {
@@ -158,10 +292,12 @@ func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.S
 	copy := cloneStep(step)
 
 	// the pipeline environment variables need to be updated to
-	// reflect the current state of the build and stage.
+	// reflect the current state of the build and stage, and to
+	// include values exported by previous steps.
 	state.Lock()
 	copy.Envs = environ.Combine(
 		copy.Envs,
+		outputs.environ(),
 		environ.Build(state.Build),
 		environ.Stage(state.Stage),
 		environ.Step(findStep(state, step.Name)),
@@ -170,20 +306,96 @@ func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.S
 
 	// writer used to stream build logs.
 	wc := e.streamer.Stream(noContext, state, step.Name)
-	wc = replacer.New(wc, step.Secrets)
+	wc = section.New(replacer.New(wc, step.Secrets))
+
+	// the stage preamble is written to the log of the first
+	// step that starts.
+	preambleFrom(ctx).write(wc)
+
+	// steps that use a nearly expired secret write a warning
+	// to the step log.
+	auditFrom(ctx).warn(wc, step)
+
+	// the output of generated steps, such as the clone step,
+	// is written to a collapsible log section.
+	if step.Group != "" {
+		section.Group(wc, step.Group)
+	}
 
 	// if the step is configured as a daemon, it is detached
 	// from the main process and executed separately.
 	// todo(bradrydzewski) this code is still experimental.
 	if step.Detach {
+		// the readiness probe is cancelled if the detached
+		// process exits before it is ready, and the log stream
+		// remains open until the probe completes.
+		exited := make(chan struct{})
+		probed := make(chan struct{})
+		wg.Add(1)
 		go func() {
-			e.engine.Run(ctx, spec, copy, wc)
+			e.run(ctx, state, spec, copy, wc)
+			close(exited)
+			<-probed
 			wc.Close()
+			wg.Done()
 		}()
+		defer close(probed)
+
+		// if the step defines a readiness probe, block until
+		// the step is ready to accept connections.
+		ctxprobe, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-exited:
+				cancel()
+			case <-ctxprobe.Done():
+			}
+		}()
+		if err := probe.Wait(ctxprobe, copy); err != nil {
+			select {
+			case <-exited:
+				err = fmt.Errorf("%s exited before it was ready", step.Name)
+			default:
+			}
+			log.WithError(err).Debug("readiness probe failed")
+			fmt.Fprintf(wc, "readiness probe failed: %s\n", err)
+			state.Fail(step.Name, err)
+			return e.reporter.ReportStep(noContext, state, step.Name)
+		}
 		return nil
 	}
 
-	exited, err := e.engine.Run(ctx, spec, copy, wc)
+	started := time.Now()
+	exited, err := e.run(ctx, state, spec, copy, wc)
+	if !step.Summary {
+		status := ""
+		if step.Cache != nil {
+			status = cacheMiss
+		}
+		costsFrom(ctx).record(step, time.Since(started), exited, status)
+	}
+	if step.Group != "" {
+		section.End(wc)
+	}
+
+	// if debugging is enabled, the environment of the failed
+	// step is kept alive in a debug session before the step
+	// completes and the pipeline environment is destroyed.
+	if spec.Debug != nil && step.Pause == nil && exited != nil && exited.ExitCode != 0 && !step.IgnoreErr {
+		if err := debug.Session(ctx, spec, copy, wc); err != nil {
+			log.WithError(err).Warn("cannot start debug session")
+		}
+	}
+
+	// values exported by the step are parsed from the outputs
+	// file once the step exits.
+	if exited != nil {
+		if err := outputs.load(copy.Envs["DRONE_OUTPUT"]); err != nil {
+			log.WithError(err).Debug("cannot parse step outputs")
+			fmt.Fprintf(wc, "cannot parse step outputs: %s\n", err)
+		}
+	}
 
 	// close the stream. If the session is a remote session, the
 	// full log buffer is uploaded to the remote server.
@@ -192,7 +404,15 @@ func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.S
 	}
 
 	if exited != nil {
+		if exited.ExitCode == 0 {
+			cache.record(ctx, step, hash)
+		}
 		state.Finish(step.Name, exited.ExitCode)
+		observe(state, step.Name)
+		if reason, message := classifyExit(exited); reason != "" {
+			log.WithField("step.failure", reason).Debug("step failed")
+			recordFailure(state, step.Name, reason, message)
+		}
 		err := e.reporter.ReportStep(noContext, state, step.Name)
 		if err != nil {
 			multierror.Append(result, err)
@@ -207,13 +427,28 @@ func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.S
 
 	switch err {
 	case context.Canceled, context.DeadlineExceeded:
+		// if the runner limit is exceeded the stage is errored,
+		// to distinguish from a build that is cancelled or
+		// exceeds the build timeout.
+		if err := maxDurationExceeded(ctx); err != nil {
+			state.Fail(step.Name, err)
+			state.FailAll(err)
+			recordFailure(state, step.Name, reasonTimeout, err.Error())
+			if err := e.reporter.ReportStep(noContext, state, step.Name); err != nil {
+				multierror.Append(result, err)
+			}
+			return result
+		}
 		state.Cancel()
+		recordFailure(state, step.Name, classifyError(err), err.Error())
 		return nil
 	}
 
 	// if the step failed with an internal error (as oppsed to a
 	// runtime error) the step is failed.
 	state.Fail(step.Name, err)
+	log.WithError(err).WithField("step.failure", reasonInfra).Debug("step failed")
+	recordFailure(state, step.Name, reasonInfra, err.Error())
 	err = e.reporter.ReportStep(noContext, state, step.Name)
 	if err != nil {
 		multierror.Append(result, err)
@@ -221,6 +456,74 @@ func (e *execer) exec(ctx context.Context, state *pipeline.State, spec *engine.S
 	return result
 }
 
+// helper function executes the step. Pause steps wait for
+// approval, and the summary step writes the cost of the other
+// steps, instead of executing a command.
+func (e *execer) step(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step, output io.Writer) (*engine.State, error) {
+	if step.Pause != nil {
+		return e.pause(ctx, state, step, output)
+	}
+	if step.Summary {
+		costsFrom(ctx).write(output, spec)
+		return &engine.State{Exited: true}, nil
+	}
+	return e.engine.Run(ctx, spec, step, output)
+}
+
+// helper function pauses the step until the step is approved
+// or rejected, and records the decision in the step logs. The
+// step fails if rejected, or if the timeout is exceeded.
+func (e *execer) pause(ctx context.Context, state *pipeline.State, step *engine.Step, w io.Writer) (*engine.State, error) {
+	if e.gates == nil {
+		return nil, errors.New("approval gates are not supported by this runner")
+	}
+	state.Lock()
+	gate := &Gate{
+		Stage:   state.Stage.ID,
+		Repo:    state.Repo.Slug,
+		Build:   state.Build.Number,
+		Step:    step.Name,
+		Message: step.Pause.Message,
+	}
+	state.Unlock()
+
+	if gate.Message != "" {
+		fmt.Fprintln(w, gate.Message)
+	}
+	fmt.Fprintln(w, "waiting for approval")
+
+	decision, err := e.gates.Wait(ctx, gate, step.Pause.Timeout)
+	if err == ErrGateTimeout {
+		fmt.Fprintln(w, err)
+		return &engine.State{ExitCode: 1, Exited: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log := logger.FromContext(ctx).
+		WithField("approved", decision.Approved).
+		WithField("user", decision.User).
+		WithField("name", decision.Name).
+		WithField("comment", decision.Comment)
+	log.Info("paused step decided")
+
+	exited := &engine.State{Exited: true}
+	if decision.Approved {
+		fmt.Fprintf(w, "approved by %s\n", decision.User)
+	} else {
+		fmt.Fprintf(w, "rejected by %s\n", decision.User)
+		exited.ExitCode = 1
+	}
+	if decision.Name != "" {
+		fmt.Fprintf(w, "name: %s\n", decision.Name)
+	}
+	if decision.Comment != "" {
+		fmt.Fprintf(w, "comment: %s\n", decision.Comment)
+	}
+	return exited, nil
+}
+
 // helper function to clone a step. The runner mutates a step to
 // update the environment variables to reflect the current
 // pipeline state.
@@ -231,6 +534,20 @@ func cloneStep(src *engine.Step) *engine.Step {
 	return dst
 }
 
+// helper function records the duration of the completed step.
+func observe(state *pipeline.State, name string) {
+	state.Lock()
+	defer state.Unlock()
+	step := findStep(state, name)
+	duration := time.Duration(step.Stopped-step.Started) * time.Second
+	labels := exemplar(state.Build, state.Stage)
+	if name == "clone" {
+		metrics.CloneDuration.Observe(duration, labels, state.Repo.Slug)
+	} else {
+		metrics.StepDuration.Observe(duration, labels, state.Repo.Slug, name)
+	}
+}
+
 // helper function returns the named step from the state.
 func findStep(state *pipeline.State, name string) *drone.Step {
 	for _, step := range state.Stage.Steps {
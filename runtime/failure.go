@@ -0,0 +1,72 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/internal/metrics"
+
+	"github.com/drone/runner-go/pipeline"
+)
+
+// Failure reasons classify why a step failed, so that test
+// failures can be distinguished from infrastructure failures.
+// The reason prefixes the step error reported to the server.
+const (
+	reasonExitCode  = "exit_code"
+	reasonSignal    = "signal"
+	reasonTimeout   = "timeout"
+	reasonOOM       = "oom"
+	reasonCancelled = "cancelled"
+	reasonInfra     = "infra"
+)
+
+// helper function returns the failure reason and message of
+// the exited step, or an empty reason if the step passed. Exit
+// codes above 128 are reported by a shell when the command is
+// terminated by a signal.
+func classifyExit(state *engine.State) (reason, message string) {
+	switch {
+	case state.ExitCode == 0, state.ExitCode == 78:
+		return "", ""
+	case state.OOMKilled:
+		return reasonOOM, "killed by the out of memory killer"
+	case state.Signal != "":
+		return reasonSignal, "terminated by signal: " + state.Signal
+	case state.ExitCode > 128 && state.ExitCode <= 128+64:
+		return reasonSignal, fmt.Sprintf("terminated by signal %d", state.ExitCode-128)
+	default:
+		return reasonExitCode, fmt.Sprintf("exit code %d", state.ExitCode)
+	}
+}
+
+// helper function returns the failure reason of the error
+// returned when the step did not exit.
+func classifyError(err error) string {
+	switch err {
+	case context.DeadlineExceeded:
+		return reasonTimeout
+	case context.Canceled:
+		return reasonCancelled
+	default:
+		return reasonInfra
+	}
+}
+
+// helper function records the failure reason of the named
+// step in the step error and the failure metrics.
+func recordFailure(state *pipeline.State, name, reason, message string) {
+	state.Lock()
+	defer state.Unlock()
+	step := findStep(state, name)
+	step.Error = reason + ": " + message
+	duration := time.Duration(step.Stopped-step.Started) * time.Second
+	labels := exemplar(state.Build, state.Stage)
+	metrics.StepFailures.Observe(duration, labels, state.Repo.Slug, name, reason)
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+)
+
+func TestClassifyExit(t *testing.T) {
+	tests := []struct {
+		state  *engine.State
+		reason string
+	}{
+		{state: &engine.State{ExitCode: 0}, reason: ""},
+		{state: &engine.State{ExitCode: 78}, reason: ""},
+		{state: &engine.State{ExitCode: 1}, reason: reasonExitCode},
+		{state: &engine.State{ExitCode: 255}, reason: reasonExitCode},
+		{state: &engine.State{ExitCode: 137}, reason: reasonSignal},
+		{state: &engine.State{ExitCode: 143, Signal: "terminated"}, reason: reasonSignal},
+		{state: &engine.State{ExitCode: 137, Signal: "killed", OOMKilled: true}, reason: reasonOOM},
+	}
+	for _, test := range tests {
+		if got, _ := classifyExit(test.state); got != test.reason {
+			t.Errorf("Want reason %q for exit code %d, got %q", test.reason, test.state.ExitCode, got)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	if got, want := classifyError(context.DeadlineExceeded), reasonTimeout; got != want {
+		t.Errorf("Want reason %q, got %q", want, got)
+	}
+	if got, want := classifyError(context.Canceled), reasonCancelled; got != want {
+		t.Errorf("Want reason %q, got %q", want, got)
+	}
+	if got, want := classifyError(errors.New("no such file")), reasonInfra; got != want {
+		t.Errorf("Want reason %q, got %q", want, got)
+	}
+}
+
+func TestRecordFailure(t *testing.T) {
+	state := &pipeline.State{
+		Build: &drone.Build{},
+		Repo:  &drone.Repo{Slug: "octocat/hello-world"},
+		Stage: &drone.Stage{
+			Steps: []*drone.Step{{Name: "test", Status: drone.StatusRunning}},
+		},
+	}
+	state.Finish("test", 137)
+	recordFailure(state, "test", reasonOOM, "killed by the out of memory killer")
+	if got, want := state.Stage.Steps[0].Error, "oom: killed by the out of memory killer"; got != want {
+		t.Errorf("Want step error %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// errors returned when approving a paused pipeline step.
+var (
+	ErrGateNotFound = errors.New("paused step not found")
+	ErrGateTimeout  = errors.New("timeout waiting for approval")
+)
+
+// Gate is a paused pipeline step awaiting approval.
+type Gate struct {
+	Stage   int64     `json:"stage_id"`
+	Repo    string    `json:"repo"`
+	Build   int64     `json:"build"`
+	Step    string    `json:"step"`
+	Message string    `json:"message,omitempty"`
+	Created time.Time `json:"created"`
+
+	done chan *Decision
+}
+
+// Decision records the approval or rejection of a paused step.
+type Decision struct {
+	Approved bool   `json:"approved"`
+	User     string `json:"user"`
+	Name     string `json:"name,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Gates stores the paused pipeline steps awaiting approval.
+type Gates struct {
+	sync.Mutex
+
+	items []*Gate
+}
+
+// NewGates returns a new approval gate store.
+func NewGates() *Gates {
+	return new(Gates)
+}
+
+// Wait pauses until the step is approved or rejected, or the
+// timeout is exceeded. A zero timeout waits until the context
+// is cancelled.
+func (g *Gates) Wait(ctx context.Context, gate *Gate, timeout time.Duration) (*Decision, error) {
+	gate.Created = time.Now()
+	gate.done = make(chan *Decision, 1)
+	g.Lock()
+	g.items = append(g.items, gate)
+	g.Unlock()
+	defer g.remove(gate)
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-expired:
+		return nil, ErrGateTimeout
+	case decision := <-gate.done:
+		return decision, nil
+	}
+}
+
+// Decide approves or rejects the paused step.
+func (g *Gates) Decide(stage int64, step string, decision *Decision) error {
+	g.Lock()
+	defer g.Unlock()
+	for i, gate := range g.items {
+		if gate.Stage == stage && gate.Step == step {
+			g.items = append(g.items[:i:i], g.items[i+1:]...)
+			gate.done <- decision
+			return nil
+		}
+	}
+	return ErrGateNotFound
+}
+
+// List returns the paused steps.
+func (g *Gates) List() []*Gate {
+	g.Lock()
+	defer g.Unlock()
+	return append([]*Gate(nil), g.items...)
+}
+
+func (g *Gates) remove(gate *Gate) {
+	g.Lock()
+	defer g.Unlock()
+	for i, item := range g.items {
+		if item == gate {
+			g.items = append(g.items[:i:i], g.items[i+1:]...)
+			return
+		}
+	}
+}
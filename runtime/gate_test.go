@@ -0,0 +1,46 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGates(t *testing.T) {
+	gates := NewGates()
+	if err := gates.Decide(1, "deploy", &Decision{Approved: true}); err != ErrGateNotFound {
+		t.Errorf("Want error %s, got %v", ErrGateNotFound, err)
+	}
+
+	go func() {
+		for len(gates.List()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		gates.Decide(1, "deploy", &Decision{Approved: true, User: "octocat"})
+	}()
+	decision, err := gates.Wait(context.Background(), &Gate{Stage: 1, Step: "deploy"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decision.Approved || decision.User != "octocat" {
+		t.Errorf("Unexpected decision %+v", decision)
+	}
+	if len(gates.List()) != 0 {
+		t.Errorf("Expect gate removed once decided")
+	}
+}
+
+func TestGates_Timeout(t *testing.T) {
+	gates := NewGates()
+	_, err := gates.Wait(context.Background(), &Gate{Stage: 1, Step: "deploy"}, time.Millisecond)
+	if err != ErrGateTimeout {
+		t.Errorf("Want error %s, got %v", ErrGateTimeout, err)
+	}
+	if len(gates.List()) != 0 {
+		t.Errorf("Expect gate removed on timeout")
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"io"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone/runner-go/pipeline"
+)
+
+// StepFunc executes a pipeline step, and returns the step exit
+// state. The pipeline state must be locked when accessed.
+type StepFunc func(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step, output io.Writer) (*engine.State, error)
+
+// Middleware wraps the execution of pipeline steps, allowing
+// custom runner binaries to add behavior before, after or
+// around each step.
+type Middleware func(next StepFunc) StepFunc
+
+// Before returns a Middleware that invokes the function before
+// each step executes. If the function returns an error the step
+// is not executed, and fails with the error.
+func Before(fn func(ctx context.Context, state *pipeline.State, step *engine.Step) error) Middleware {
+	return func(next StepFunc) StepFunc {
+		return func(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step, output io.Writer) (*engine.State, error) {
+			if err := fn(ctx, state, step); err != nil {
+				return nil, err
+			}
+			return next(ctx, state, spec, step, output)
+		}
+	}
+}
+
+// After returns a Middleware that invokes the function after
+// each step executes, with the step exit state and error.
+func After(fn func(ctx context.Context, state *pipeline.State, step *engine.Step, exited *engine.State, err error)) Middleware {
+	return func(next StepFunc) StepFunc {
+		return func(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step, output io.Writer) (*engine.State, error) {
+			exited, err := next(ctx, state, spec, step, output)
+			fn(ctx, state, step, exited, err)
+			return exited, err
+		}
+	}
+}
+
+// helper function chains the middleware, where the first
+// middleware is the outermost.
+func chain(base StepFunc, middleware []Middleware) StepFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		base = middleware[i](base)
+	}
+	return base
+}
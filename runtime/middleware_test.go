@@ -0,0 +1,56 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone/runner-go/pipeline"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMiddleware(t *testing.T) {
+	var calls []string
+	base := func(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step, output io.Writer) (*engine.State, error) {
+		calls = append(calls, "run "+step.Name)
+		return &engine.State{Exited: true}, nil
+	}
+	around := func(next StepFunc) StepFunc {
+		return func(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step, output io.Writer) (*engine.State, error) {
+			calls = append(calls, "around")
+			return next(ctx, state, spec, step, output)
+		}
+	}
+	before := Before(func(ctx context.Context, state *pipeline.State, step *engine.Step) error {
+		calls = append(calls, "before")
+		if step.Name == "deploy" {
+			return errors.New("denied by policy")
+		}
+		return nil
+	})
+	after := After(func(ctx context.Context, state *pipeline.State, step *engine.Step, exited *engine.State, err error) {
+		calls = append(calls, "after")
+	})
+
+	run := chain(base, []Middleware{around, after, before})
+	if _, err := run(context.Background(), nil, nil, &engine.Step{Name: "build"}, nil); err != nil {
+		t.Error(err)
+	}
+	if _, err := run(context.Background(), nil, nil, &engine.Step{Name: "deploy"}, nil); err == nil {
+		t.Errorf("Expect error when step denied by middleware")
+	}
+	want := []string{
+		"around", "before", "run build", "after",
+		"around", "before", "after",
+	}
+	if diff := cmp.Diff(want, calls); diff != "" {
+		t.Errorf("Unexpected middleware order")
+		t.Log(diff)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// maximum size of the step outputs file.
+const maxOutputSize = 1048576 // 1MB
+
+// regular expression to validate output names, which are
+// exported as environment variables.
+var outputName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// outputs stores the values exported by pipeline steps using
+// the outputs file, which are injected as environment variables
+// into subsequent pipeline steps.
+type outputs struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+// environ returns the exported values.
+func (o *outputs) environ() map[string]string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	envs := map[string]string{}
+	for k, v := range o.values {
+		envs[k] = v
+	}
+	return envs
+}
+
+type outputsKey struct{}
+
+// helper function returns a context that carries the outputs,
+// so that the values exported by the pipeline steps can be
+// published once the stage completes.
+func withOutputs(ctx context.Context, o *outputs) context.Context {
+	return context.WithValue(ctx, outputsKey{}, o)
+}
+
+// helper function returns the outputs carried by the context,
+// or new outputs if the context does not carry outputs.
+func outputsFrom(ctx context.Context) *outputs {
+	if o, ok := ctx.Value(outputsKey{}).(*outputs); ok {
+		return o
+	}
+	return new(outputs)
+}
+
+// load loads the values exported by the step from the outputs
+// file. It is not an error if the step does not create the file.
+func (o *outputs) load(path string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	values, err := parseOutputs(io.LimitReader(f, maxOutputSize))
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	if o.values == nil {
+		o.values = map[string]string{}
+	}
+	for k, v := range values {
+		o.values[k] = v
+	}
+	o.mu.Unlock()
+	return nil
+}
+
+// helper function parses the outputs file. Each line defines a
+// name=value pair. Multi-line values use a heredoc delimiter,
+// in which case the value is terminated by the delimiter line:
+//
+//	changelog<<EOF
+//	first line
+//	second line
+//	EOF
+func parseOutputs(r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxOutputSize)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if name, delim, ok := strings.Cut(line, "<<"); ok && !strings.Contains(name, "=") {
+			var lines []string
+			for {
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("output %s: missing delimiter %s", name, delim)
+				}
+				next := strings.TrimSuffix(scanner.Text(), "\r")
+				if next == delim {
+					break
+				}
+				lines = append(lines, next)
+			}
+			if !outputName.MatchString(name) {
+				return nil, fmt.Errorf("invalid output name %q", name)
+			}
+			values[name] = strings.Join(lines, "\n")
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || !outputName.MatchString(name) {
+			return nil, fmt.Errorf("invalid output %q", line)
+		}
+		values[name] = value
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseOutputs(t *testing.T) {
+	input := "version=1.2.3\r\n\nurl=https://example.com/?a=b\nchangelog<<EOF\nfirst\n\nsecond\nEOF\nversion=1.2.4\n"
+	got, err := parseOutputs(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"version":   "1.2.4",
+		"url":       "https://example.com/?a=b",
+		"changelog": "first\n\nsecond",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func TestParseOutputs_Invalid(t *testing.T) {
+	tests := []string{
+		"version",
+		"1version=1.2.3",
+		"my-version=1.2.3",
+		"changelog<<EOF\nfirst\n",
+	}
+	for _, test := range tests {
+		if _, err := parseOutputs(strings.NewReader(test)); err == nil {
+			t.Errorf("Expect error parsing outputs %q", test)
+		}
+	}
+}
+
+func TestOutputs(t *testing.T) {
+	dir := t.TempDir()
+	o := new(outputs)
+	if err := o.load(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("Expect missing outputs file ignored, got %s", err)
+	}
+
+	path := filepath.Join(dir, "build.output")
+	ioutil.WriteFile(path, []byte("version=1.2.3\n"), 0600)
+	if err := o.load(path); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := o.environ()["version"], "1.2.3"; got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+}
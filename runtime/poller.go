@@ -9,6 +9,7 @@ package runtime
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/drone/runner-go/client"
 	"github.com/drone/runner-go/logger"
@@ -22,55 +23,171 @@ type Poller struct {
 	Client client.Client
 	Filter *client.Filter
 	Runner *Runner
+
+	// Interval defines the interval between requests for
+	// pending stages.
+	Interval time.Duration
+
+	// Timeout defines the maximum duration of a long-poll
+	// request, after which the request is re-established.
+	Timeout time.Duration
+
+	// BackoffMin and BackoffMax define the bounds of the
+	// exponential backoff applied when requests fail.
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+
+	// Burst configures the poller to request the next stage
+	// immediately, without waiting for the request interval,
+	// after a stage is received. This drains queued stages
+	// faster when capacity is free.
+	Burst bool
+
+	// Control optionally controls the capacity and labels of
+	// the poller while running, and drains the poller.
+	Control *Control
+
+	// Backlog defines the number of stages requested in
+	// excess of the capacity. The stages wait in the Queue of
+	// the Runner until capacity is free, so that the queue can
+	// schedule stages fairly across namespaces.
+	Backlog int
+
+	// Breaker optionally stops the poller from requesting
+	// stages after consecutive infrastructure failures.
+	Breaker *Breaker
+
+	// Throttle optionally lowers the number of stages the
+	// poller requests concurrently while the host is
+	// throttled.
+	Throttle *Throttle
 }
 
 // Poll opens N connections to the server to poll for pending
 // stages for execution. Pending stages are dispatched to a
-// Runner for execution.
+// Runner for execution. If the poller is controlled, the
+// number of connections follows the controlled capacity.
 func (p *Poller) Poll(ctx context.Context, n int) {
 	var wg sync.WaitGroup
-	for i := 0; i < n; i++ {
-		wg.Add(1)
-		go func(i int) {
-			for {
-				select {
-				case <-ctx.Done():
-					wg.Done()
-					return
-				default:
-					p.poll(ctx, i+1)
-				}
-			}
-		}(i)
+	var started int
+	for {
+		var changed <-chan struct{}
+		if p.Control != nil {
+			changed = p.Control.watch()
+			n = p.Control.Capacity()
+		}
+		for ; started < n+p.Backlog; started++ {
+			wg.Add(1)
+			go p.thread(ctx, &wg, started)
+		}
+		if changed == nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-changed:
+		}
 	}
 
 	wg.Wait()
 }
 
+// thread polls the server for pending stages until the context
+// is cancelled.
+func (p *Poller) thread(ctx context.Context, wg *sync.WaitGroup, i int) {
+	defer wg.Done()
+	var backoff time.Duration
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		if p.Control != nil && !p.Control.wait(ctx, i, p.Backlog) {
+			return
+		}
+		if p.Breaker != nil && !p.Breaker.wait(ctx) {
+			return
+		}
+		if p.Throttle != nil && !p.Throttle.wait(ctx, i) {
+			return
+		}
+
+		received, err := p.poll(ctx, i+1)
+		delay := p.Interval
+		switch {
+		case err != nil:
+			backoff = p.backoff(backoff)
+			delay = backoff
+		case received && p.Burst:
+			backoff = 0
+			delay = 0
+		default:
+			backoff = 0
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+	}
+}
+
 // poll requests a stage for execution from the server, and then
-// dispatches for execution.
-func (p *Poller) poll(ctx context.Context, thread int) error {
+// dispatches for execution. It returns true if a stage was
+// received, and returns an error if the request failed.
+func (p *Poller) poll(ctx context.Context, thread int) (bool, error) {
 	log := logger.FromContext(ctx).WithField("thread", thread)
 	log.WithField("thread", thread).Debug("request stage from remote server")
 
+	// the long-poll request is re-established after the
+	// optional timeout is exceeded.
+	ctxreq := ctx
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctxreq, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
 	// request a new build stage for execution from the central
 	// build server.
-	stage, err := p.Client.Request(ctx, p.Filter)
+	filter := p.Filter
+	if p.Control != nil {
+		controlled := *p.Filter
+		controlled.Labels = p.Control.Labels()
+		filter = &controlled
+	}
+	stage, err := p.Client.Request(ctxreq, filter)
 	if err == context.Canceled || err == context.DeadlineExceeded {
 		log.WithError(err).Trace("no stage returned")
-		return nil
+		return false, nil
 	}
 	if err != nil {
 		log.WithError(err).Error("cannot request stage")
-		return err
+		return false, err
 	}
 
 	// exit if a nil or empty stage is returned from the system
 	// and allow the runner to retry.
 	if stage == nil || stage.ID == 0 {
-		return nil
+		return false, nil
 	}
 
-	return p.Runner.Run(
-		logger.WithContext(noContext, log), stage)
+	p.Runner.Run(
+		withBreaker(logger.WithContext(noContext, log), p.Breaker), stage)
+	return true, nil
+}
+
+// helper function returns the next backoff duration.
+func (p *Poller) backoff(prev time.Duration) time.Duration {
+	next := prev * 2
+	if next < p.BackoffMin {
+		next = p.BackoffMin
+	}
+	if p.BackoffMax > 0 && next > p.BackoffMax {
+		next = p.BackoffMax
+	}
+	return next
 }
@@ -8,6 +8,7 @@ package runtime
 
 import (
 	"testing"
+	"time"
 )
 
 func TestPoll(t *testing.T) {
@@ -25,3 +26,23 @@ func TestPoll_EmptyStage(t *testing.T) {
 func TestPoll_RequestError(t *testing.T) {
 	t.Skip()
 }
+
+func TestPoll_Backoff(t *testing.T) {
+	p := &Poller{
+		BackoffMin: time.Second,
+		BackoffMax: 4 * time.Second,
+	}
+	tests := []struct {
+		prev, next time.Duration
+	}{
+		{0, time.Second},
+		{time.Second, 2 * time.Second},
+		{2 * time.Second, 4 * time.Second},
+		{4 * time.Second, 4 * time.Second},
+	}
+	for _, test := range tests {
+		if got, want := p.backoff(test.prev), test.next; got != want {
+			t.Errorf("Want backoff %s, got %s", want, got)
+		}
+	}
+}
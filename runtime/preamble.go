@@ -0,0 +1,47 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/drone-runners/drone-runner-exec/engine/section"
+)
+
+// preamble is written once to the log of the first pipeline
+// step that starts.
+type preamble struct {
+	once sync.Once
+	text string
+}
+
+// write writes the preamble to a collapsible section of the
+// step log, if not already written to the log of another step.
+func (p *preamble) write(w io.Writer) {
+	if p == nil {
+		return
+	}
+	p.once.Do(func() {
+		section.Group(w, "host")
+		io.WriteString(w, p.text)
+		section.End(w)
+	})
+}
+
+type preambleKey struct{}
+
+// helper function returns a context that carries the preamble.
+func withPreamble(ctx context.Context, text string) context.Context {
+	return context.WithValue(ctx, preambleKey{}, &preamble{text: text})
+}
+
+// helper function returns the preamble carried by the context,
+// or nil if the context does not carry a preamble.
+func preambleFrom(ctx context.Context) *preamble {
+	p, _ := ctx.Value(preambleKey{}).(*preamble)
+	return p
+}
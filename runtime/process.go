@@ -0,0 +1,86 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone/runner-go/pipeline"
+)
+
+// Process is the process of a running pipeline step.
+type Process struct {
+	Stage   int64  `json:"stage_id"`
+	Repo    string `json:"repo"`
+	Build   int64  `json:"build"`
+	Step    string `json:"step"`
+	PID     int    `json:"pid"`
+	Started int64  `json:"started"`
+}
+
+// Processes tracks the processes of running pipeline steps.
+type Processes struct {
+	mu    sync.Mutex
+	items map[int]*Process
+}
+
+// NewProcesses returns a new process tracker.
+func NewProcesses() *Processes {
+	return &Processes{items: map[int]*Process{}}
+}
+
+// Middleware returns a Middleware that tracks the process of
+// each pipeline step while the step is running.
+func (p *Processes) Middleware() Middleware {
+	return func(next StepFunc) StepFunc {
+		return func(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step, output io.Writer) (*engine.State, error) {
+			state.Lock()
+			proc := Process{
+				Stage: state.Stage.ID,
+				Repo:  state.Repo.Slug,
+				Build: state.Build.Number,
+				Step:  step.Name,
+			}
+			state.Unlock()
+			ctx = engine.WithProcessFunc(ctx, func(pid int, running bool) {
+				p.mu.Lock()
+				defer p.mu.Unlock()
+				if !running {
+					delete(p.items, pid)
+					return
+				}
+				copy := proc
+				copy.PID = pid
+				copy.Started = time.Now().Unix()
+				p.items[pid] = &copy
+			})
+			return next(ctx, state, spec, step, output)
+		}
+	}
+}
+
+// List returns the processes of running pipeline steps,
+// ordered by start time.
+func (p *Processes) List() []*Process {
+	p.mu.Lock()
+	var out []*Process
+	for _, proc := range p.items {
+		copy := *proc
+		out = append(out, &copy)
+	}
+	p.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Started == out[j].Started {
+			return out[i].PID < out[j].PID
+		}
+		return out[i].Started < out[j].Started
+	})
+	return out
+}
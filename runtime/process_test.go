@@ -0,0 +1,59 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// +build !windows
+
+package runtime
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+)
+
+func TestProcesses(t *testing.T) {
+	processes := NewProcesses()
+	run := chain(func(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step, output io.Writer) (*engine.State, error) {
+		return engine.New().Run(ctx, spec, step, output)
+	}, []Middleware{processes.Middleware()})
+
+	state := &pipeline.State{
+		Build: &drone.Build{Number: 1},
+		Repo:  &drone.Repo{Slug: "octocat/hello-world"},
+		Stage: &drone.Stage{ID: 42},
+	}
+	step := &engine.Step{
+		Name:    "test",
+		Command: "/bin/sh",
+		Args:    []string{"-c", "sleep 1"},
+	}
+	done := make(chan struct{})
+	go func() {
+		run(context.Background(), state, &engine.Spec{}, step, ioutil.Discard)
+		close(done)
+	}()
+
+	var procs []*Process
+	for i := 0; i < 50 && len(procs) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		procs = processes.List()
+	}
+	if len(procs) != 1 {
+		t.Fatalf("Want running step process tracked")
+	}
+	if got := procs[0]; got.Stage != 42 || got.Step != "test" || got.Repo != "octocat/hello-world" || got.PID == 0 {
+		t.Errorf("Unexpected process %+v", got)
+	}
+
+	<-done
+	if len(processes.List()) != 0 {
+		t.Errorf("Want exited step process removed")
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/internal/provenance"
+
+	"github.com/drone/runner-go/logger"
+	"github.com/drone/runner-go/pipeline"
+)
+
+// helper function records the signed provenance of the stage.
+// Errors are logged, and do not fail the stage.
+func recordProvenance(ctx context.Context, recorder *provenance.Recorder, spec *engine.Spec, state *pipeline.State) {
+	state.Lock()
+	key := provenance.Key{
+		Repo:  state.Repo.Slug,
+		Build: state.Build.Number,
+		Stage: state.Stage.Name,
+	}
+	statement := newStatement(recorder.Builder, spec, state)
+	state.Unlock()
+
+	// the statement subjects are the stage artifacts, or the
+	// commit if the stage does not declare artifacts.
+	if spec.Artifacts != nil && len(spec.Artifacts.Paths) != 0 {
+		subjects, err := artifactSubjects(spec.Artifacts.Source, spec.Artifacts.Paths)
+		if err != nil {
+			logger.FromContext(ctx).WithError(err).Warn("cannot digest artifacts")
+		} else if len(subjects) != 0 {
+			statement.Subject = subjects
+		}
+	}
+
+	if err := recorder.Record(ctx, key, statement); err != nil {
+		logger.FromContext(ctx).WithError(err).Error("cannot record provenance")
+	}
+}
+
+// helper function returns the provenance statement of the
+// stage. The pipeline state must be locked by the caller.
+func newStatement(builder string, spec *engine.Spec, state *pipeline.State) *provenance.Statement {
+	repo, build, stage := state.Repo, state.Build, state.Stage
+	source := &provenance.Resource{
+		URI:    fmt.Sprintf("git+%s@%s", repo.HTTPURL, build.Ref),
+		Digest: map[string]string{"gitCommit": build.After},
+	}
+
+	var steps []*provenance.Step
+	for _, src := range stage.Steps {
+		step := &provenance.Step{
+			Name:     src.Name,
+			Status:   src.Status,
+			ExitCode: src.ExitCode,
+		}
+		if s := specStep(spec, src.Name); s != nil {
+			step.Command = digestCommand(spec, s)
+			step.Environment = digestEnviron(s)
+		}
+		steps = append(steps, step)
+	}
+
+	finished := time.Now().UTC()
+	started := finished
+	if stage.Started != 0 {
+		started = time.Unix(stage.Started, 0).UTC()
+	}
+
+	return &provenance.Statement{
+		Type: provenance.StatementType,
+		Subject: []*provenance.Subject{
+			{Name: repo.Slug, Digest: source.Digest},
+		},
+		PredicateType: provenance.PredicateType,
+		Predicate: &provenance.Predicate{
+			BuildDefinition: &provenance.BuildDefinition{
+				BuildType: provenance.BuildType,
+				ExternalParameters: map[string]interface{}{
+					"repository": repo.Slug,
+					"ref":        build.Ref,
+					"commit":     build.After,
+					"event":      build.Event,
+					"build":      build.Number,
+					"stage":      stage.Name,
+				},
+				InternalParameters: map[string]interface{}{
+					"machine":  stage.Machine,
+					"platform": stage.OS + "/" + stage.Arch,
+					"steps":    steps,
+				},
+				ResolvedDependencies: []*provenance.Resource{source},
+			},
+			RunDetails: &provenance.RunDetails{
+				Builder: &provenance.Builder{ID: builder},
+				Metadata: &provenance.Metadata{
+					InvocationID: fmt.Sprintf("%s/%d/%d", repo.Slug, build.Number, stage.Number),
+					StartedOn:    started,
+					FinishedOn:   finished,
+				},
+			},
+		},
+	}
+}
+
+// helper function returns the named step of the spec.
+func specStep(spec *engine.Spec, name string) *engine.Step {
+	for _, step := range spec.Steps {
+		if step.Name == name {
+			return step
+		}
+	}
+	return nil
+}
+
+// helper function returns the digest of the step command and
+// scripts. The pipeline root is random, and is excluded from
+// the command arguments.
+func digestCommand(spec *engine.Spec, step *engine.Step) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "command %q\n", step.Command)
+	for _, arg := range step.Args {
+		fmt.Fprintf(h, "arg %q\n", strings.Replace(arg, spec.Root, "", -1))
+	}
+	for _, file := range step.Files {
+		fmt.Fprintf(h, "script %x\n", sha256.Sum256(file.Data))
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// helper function returns the digest of the step environment.
+// Secrets are not part of the step environment.
+func digestEnviron(step *engine.Step) string {
+	var names []string
+	for name := range step.Envs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%q=%q\n", name, step.Envs[name])
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// helper function returns the subjects of the artifact files
+// matching the glob patterns, relative to the workspace.
+func artifactSubjects(src string, patterns []string) ([]*provenance.Subject, error) {
+	var subjects []*provenance.Subject
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(src, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			err := filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil || !info.Mode().IsRegular() {
+					return err
+				}
+				sum, err := digestFile(path)
+				if err != nil {
+					return err
+				}
+				rel, _ := filepath.Rel(src, path)
+				subjects = append(subjects, &provenance.Subject{
+					Name:   filepath.ToSlash(rel),
+					Digest: map[string]string{"sha256": sum},
+				})
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return subjects, nil
+}
+
+// helper function returns the hex encoded sha256 digest of the
+// file contents.
+func digestFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type provenanceKey struct{}
+
+// helper function returns a context that carries the provenance
+// recorder.
+func withProvenance(ctx context.Context, r *provenance.Recorder) context.Context {
+	return context.WithValue(ctx, provenanceKey{}, r)
+}
+
+// helper function returns the provenance recorder carried by
+// the context, or nil if the context does not carry a recorder.
+func provenanceFrom(ctx context.Context) *provenance.Recorder {
+	r, _ := ctx.Value(provenanceKey{}).(*provenance.Recorder)
+	return r
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+)
+
+func TestNewStatement(t *testing.T) {
+	state := &pipeline.State{
+		Repo:  &drone.Repo{Slug: "octocat/hello-world", HTTPURL: "https://github.com/octocat/hello-world.git"},
+		Build: &drone.Build{Number: 42, Ref: "refs/heads/master", After: "a6586b3db244fb6b1198f2b25c213ded5b44f9fa"},
+		Stage: &drone.Stage{
+			Name:   "default",
+			Number: 1,
+			Steps:  []*drone.Step{{Name: "build", Status: drone.StatusPassing}},
+		},
+	}
+	spec := &engine.Spec{
+		Root: "/tmp/drone-abc",
+		Steps: []*engine.Step{
+			{Name: "build", Command: "/bin/sh", Args: []string{"/tmp/drone-abc/opt/build"}, Envs: map[string]string{"CI": "true"}},
+		},
+	}
+	statement := newStatement("https://ci.example.com", spec, state)
+	if got, want := statement.Subject[0].Digest["gitCommit"], state.Build.After; got != want {
+		t.Errorf("Want commit subject %s, got %s", want, got)
+	}
+	if got, want := statement.Predicate.RunDetails.Builder.ID, "https://ci.example.com"; got != want {
+		t.Errorf("Want builder id %s, got %s", want, got)
+	}
+	if got, want := statement.Predicate.BuildDefinition.ResolvedDependencies[0].URI, "git+https://github.com/octocat/hello-world.git@refs/heads/master"; got != want {
+		t.Errorf("Want source uri %s, got %s", want, got)
+	}
+
+	// the command digest excludes the random pipeline root.
+	other := &engine.Spec{Root: "/tmp/drone-xyz", Steps: []*engine.Step{{Name: "build", Command: "/bin/sh", Args: []string{"/tmp/drone-xyz/opt/build"}}}}
+	if digestCommand(spec, spec.Steps[0]) != digestCommand(other, other.Steps[0]) {
+		t.Errorf("Want command digest independent of the pipeline root")
+	}
+}
+
+func TestArtifactSubjects(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "dist"), 0700)
+	ioutil.WriteFile(filepath.Join(dir, "dist", "app"), []byte("hello"), 0600)
+
+	subjects, err := artifactSubjects(dir, []string{"dist"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(subjects) != 1 {
+		t.Errorf("Want 1 subject, got %d", len(subjects))
+		return
+	}
+	if got, want := subjects[0].Name, "dist/app"; got != want {
+		t.Errorf("Want subject name %s, got %s", want, got)
+	}
+	if got, want := subjects[0].Digest["sha256"], "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"; got != want {
+		t.Errorf("Want subject digest %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Queue schedules accepted stages for execution across
+// repository namespaces using weighted fair queuing, instead
+// of in the order the stages are accepted, so that a burst of
+// builds from one namespace cannot monopolize the runner. The
+// number of stages executed concurrently follows the capacity
+// of the control.
+type Queue struct {
+	mu sync.Mutex
+
+	control *Control
+	weights map[string]int
+	vtime   float64
+	finish  map[string]float64
+	seq     int
+	waiting []*queued
+	running int
+	changed chan struct{}
+}
+
+// queued is a stage waiting for execution.
+type queued struct {
+	namespace string
+	start     float64
+	tag       float64
+	seq       int
+}
+
+// NewQueue returns a new fair queue. The weights define the
+// share of the capacity of each namespace relative to other
+// namespaces, and namespaces without a weight have a weight
+// of one.
+func NewQueue(control *Control, weights map[string]int) *Queue {
+	return &Queue{
+		control: control,
+		weights: weights,
+		finish:  map[string]float64{},
+		changed: make(chan struct{}),
+	}
+}
+
+// Acquire blocks until the stage of the namespace is scheduled
+// for execution. It returns an error if the context is
+// cancelled before the stage is scheduled.
+func (q *Queue) Acquire(ctx context.Context, namespace string) error {
+	q.mu.Lock()
+	item := q.push(namespace)
+	q.mu.Unlock()
+
+	for {
+		// the control is watched before the capacity is read,
+		// so that a capacity change is never missed.
+		resized := q.control.watch()
+		capacity := q.control.Capacity()
+
+		q.mu.Lock()
+		if q.waiting[0] == item && q.running < capacity {
+			q.waiting = q.waiting[1:]
+			q.running++
+			q.vtime = item.start
+			q.prune()
+			q.notify()
+			q.mu.Unlock()
+			return nil
+		}
+		changed := q.changed
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			q.mu.Lock()
+			q.remove(item)
+			q.notify()
+			q.mu.Unlock()
+			return ctx.Err()
+		case <-changed:
+		case <-resized:
+		}
+	}
+}
+
+// Release releases the execution slot of a stage once the
+// stage completes.
+func (q *Queue) Release() {
+	q.mu.Lock()
+	q.running--
+	q.notify()
+	q.mu.Unlock()
+}
+
+// push adds the stage to the waiting stages, ordered by the
+// virtual finish time. The mutex must be held.
+func (q *Queue) push(namespace string) *queued {
+	weight := q.weights[namespace]
+	if weight <= 0 {
+		weight = 1
+	}
+	start := q.vtime
+	if finish := q.finish[namespace]; finish > start {
+		start = finish
+	}
+	q.seq++
+	item := &queued{
+		namespace: namespace,
+		start:     start,
+		tag:       start + 1/float64(weight),
+		seq:       q.seq,
+	}
+	q.finish[namespace] = item.tag
+	i := sort.Search(len(q.waiting), func(i int) bool {
+		w := q.waiting[i]
+		return w.tag > item.tag || (w.tag == item.tag && w.seq > item.seq)
+	})
+	q.waiting = append(q.waiting, nil)
+	copy(q.waiting[i+1:], q.waiting[i:])
+	q.waiting[i] = item
+	return item
+}
+
+// remove removes the stage from the waiting stages. The mutex
+// must be held.
+func (q *Queue) remove(item *queued) {
+	for i, w := range q.waiting {
+		if w == item {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// prune removes the finish times of idle namespaces, which no
+// longer affect the schedule. The mutex must be held.
+func (q *Queue) prune() {
+	for namespace, finish := range q.finish {
+		if finish <= q.vtime {
+			delete(q.finish, namespace)
+		}
+	}
+}
+
+// notify wakes the goroutines waiting for a change. The mutex
+// must be held.
+func (q *Queue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
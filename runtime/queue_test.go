@@ -0,0 +1,102 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestQueue_Order(t *testing.T) {
+	tests := []struct {
+		weights map[string]int
+		want    []string
+	}{
+		{
+			weights: nil,
+			want:    []string{"octocat", "spaceghost", "octocat", "octocat"},
+		},
+		{
+			weights: map[string]int{"octocat": 2},
+			want:    []string{"octocat", "octocat", "spaceghost", "octocat"},
+		},
+	}
+	for _, test := range tests {
+		q := NewQueue(NewControl("default", 1, nil), test.weights)
+		q.push("octocat")
+		q.push("octocat")
+		q.push("octocat")
+		q.push("spaceghost")
+
+		var got []string
+		for _, item := range q.waiting {
+			got = append(got, item.namespace)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("Unexpected schedule with weights %v", test.weights)
+			t.Log(diff)
+		}
+	}
+}
+
+func TestQueue_Acquire(t *testing.T) {
+	control := NewControl("default", 1, nil)
+	q := NewQueue(control, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := q.Acquire(ctx, "octocat"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- q.Acquire(ctx, "spaceghost") }()
+	select {
+	case <-done:
+		t.Fatalf("Want stage in excess of capacity blocked")
+	case <-time.After(10 * time.Millisecond):
+	}
+	q.Release()
+	if err := <-done; err != nil {
+		t.Errorf("Want stage scheduled after release, got %s", err)
+	}
+
+	go func() { done <- q.Acquire(ctx, "octocat") }()
+	select {
+	case <-done:
+		t.Fatalf("Want stage in excess of capacity blocked")
+	case <-time.After(10 * time.Millisecond):
+	}
+	control.SetCapacity(2)
+	if err := <-done; err != nil {
+		t.Errorf("Want stage scheduled after capacity increased, got %s", err)
+	}
+}
+
+func TestQueue_Cancel(t *testing.T) {
+	q := NewQueue(NewControl("default", 1, nil), nil)
+	if err := q.Acquire(context.Background(), "octocat"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Acquire(ctx, "spaceghost"); err == nil {
+		t.Errorf("Want error when context cancelled")
+	}
+	if len(q.waiting) != 0 {
+		t.Errorf("Want cancelled stage removed from the queue")
+	}
+
+	// the cancelled stage must not block the stages queued
+	// after it.
+	q.Release()
+	if err := q.Acquire(context.Background(), "octocat"); err != nil {
+		t.Errorf("Want stage scheduled after cancelled stage, got %s", err)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"strings"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+)
+
+// helper function returns the failure reason if the stage
+// failed for an infrastructure reason attributable to the
+// runner, or an empty string. The stage fails for such a
+// reason if the pipeline environment cannot be prepared, if
+// the clone step fails, or if a step fails with an internal
+// error or is killed by the out of memory killer.
+func infraFailure(state *pipeline.State, err error) string {
+	if err != nil {
+		return reasonInfra
+	}
+	state.Lock()
+	defer state.Unlock()
+	for _, step := range state.Stage.Steps {
+		if step.ErrIgnore {
+			continue
+		}
+		switch step.Status {
+		case drone.StatusFailing, drone.StatusError:
+		default:
+			continue
+		}
+		switch {
+		case strings.HasPrefix(step.Error, reasonInfra+":"):
+			return reasonInfra
+		case strings.HasPrefix(step.Error, reasonOOM+":"):
+			return reasonOOM
+		case step.Name == "clone":
+			return reasonInfra
+		}
+	}
+	return ""
+}
+
+// helper function resets the stage and steps to the running
+// and pending state, so that the stage can be retried.
+func resetState(state *pipeline.State) {
+	state.Lock()
+	defer state.Unlock()
+	state.Build.Status = drone.StatusRunning
+	state.Stage.Status = drone.StatusRunning
+	state.Stage.Error = ""
+	state.Stage.ExitCode = 0
+	state.Stage.Stopped = 0
+	for _, step := range state.Stage.Steps {
+		step.Status = drone.StatusPending
+		step.Error = ""
+		step.ExitCode = 0
+		step.Started = 0
+		step.Stopped = 0
+	}
+}
+
+type retriesKey struct{}
+
+// helper function returns a context that carries the number
+// of times a stage is retried after an infrastructure failure.
+func withRetries(ctx context.Context, retries int) context.Context {
+	return context.WithValue(ctx, retriesKey{}, retries)
+}
+
+// helper function returns the number of retries carried by the
+// context, or zero if the context does not carry retries.
+func retriesFrom(ctx context.Context) int {
+	n, _ := ctx.Value(retriesKey{}).(int)
+	return n
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+)
+
+func TestInfraFailure(t *testing.T) {
+	tests := []struct {
+		step   *drone.Step
+		reason string
+	}{
+		{step: &drone.Step{Name: "test", Status: drone.StatusPassing}, reason: ""},
+		{step: &drone.Step{Name: "test", Status: drone.StatusFailing, Error: "exit_code: exit code 1"}, reason: ""},
+		{step: &drone.Step{Name: "test", Status: drone.StatusError, Error: "infra: no such file"}, reason: reasonInfra},
+		{step: &drone.Step{Name: "test", Status: drone.StatusFailing, Error: "oom: killed"}, reason: reasonOOM},
+		{step: &drone.Step{Name: "test", Status: drone.StatusFailing, Error: "oom: killed", ErrIgnore: true}, reason: ""},
+		{step: &drone.Step{Name: "clone", Status: drone.StatusFailing, Error: "exit_code: exit code 128"}, reason: reasonInfra},
+	}
+	for _, test := range tests {
+		state := &pipeline.State{Stage: &drone.Stage{Steps: []*drone.Step{test.step}}}
+		if got := infraFailure(state, nil); got != test.reason {
+			t.Errorf("Want reason %q for step error %q, got %q", test.reason, test.step.Error, got)
+		}
+	}
+	state := &pipeline.State{Stage: &drone.Stage{}}
+	if got, want := infraFailure(state, errors.New("cannot create workspace")), reasonInfra; got != want {
+		t.Errorf("Want reason %q for setup error, got %q", want, got)
+	}
+}
+
+func TestExec_Retry(t *testing.T) {
+	eng := &fakeEngine{setupErr: errors.New("no space left on device"), failures: 1}
+	reporter := &fakeReporter{}
+	exec := NewExecer(reporter, nil, eng, nil, nil, 0)
+	state := &pipeline.State{
+		Build: &drone.Build{Status: drone.StatusRunning},
+		Repo:  &drone.Repo{},
+		Stage: &drone.Stage{Status: drone.StatusRunning},
+	}
+
+	ctx := withRetries(context.Background(), 1)
+	if err := exec.Exec(ctx, &engine.Spec{}, state); err != nil {
+		t.Error(err)
+	}
+	if got, want := eng.setups, 2; got != want {
+		t.Errorf("Want %d setup attempts, got %d", want, got)
+	}
+	if got, want := state.Stage.Status, drone.StatusPassing; got != want {
+		t.Errorf("Want stage status %s, got %s", want, got)
+	}
+}
+
+func TestExec_RetryExhausted(t *testing.T) {
+	eng := &fakeEngine{setupErr: errors.New("no space left on device"), failures: 2}
+	reporter := &fakeReporter{}
+	exec := NewExecer(reporter, nil, eng, nil, nil, 0)
+	state := &pipeline.State{
+		Build: &drone.Build{Status: drone.StatusRunning},
+		Repo:  &drone.Repo{},
+		Stage: &drone.Stage{Status: drone.StatusRunning},
+	}
+
+	ctx := withRetries(context.Background(), 1)
+	exec.Exec(ctx, &engine.Spec{}, state)
+	if got, want := eng.setups, 2; got != want {
+		t.Errorf("Want %d setup attempts, got %d", want, got)
+	}
+	if got, want := state.Stage.Status, drone.StatusError; got != want {
+		t.Errorf("Want stage status %s, got %s", want, got)
+	}
+}
+
+// fakeEngine is a stub implementation of the engine, where
+// the pipeline setup fails the configured number of times.
+type fakeEngine struct {
+	setupErr error
+	failures int
+	setups   int
+}
+
+func (e *fakeEngine) Setup(context.Context, *engine.Spec) error {
+	e.setups++
+	if e.setups <= e.failures {
+		return e.setupErr
+	}
+	return nil
+}
+
+func (e *fakeEngine) Run(context.Context, *engine.Spec, *engine.Step, io.Writer) (*engine.State, error) {
+	return &engine.State{Exited: true}, nil
+}
+
+func (e *fakeEngine) Create(context.Context, *engine.Spec, *engine.Step) error { return nil }
+func (e *fakeEngine) Start(context.Context, *engine.Spec, *engine.Step) error  { return nil }
+func (e *fakeEngine) Destroy(context.Context, *engine.Spec) error              { return nil }
+
+func (e *fakeEngine) Wait(context.Context, *engine.Spec, *engine.Step) (*engine.State, error) {
+	return &engine.State{Exited: true}, nil
+}
+
+func (e *fakeEngine) Tail(context.Context, *engine.Spec, *engine.Step) (io.ReadCloser, error) {
+	return nil, nil
+}
@@ -10,12 +10,32 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/drone-runners/drone-runner-exec/engine"
 	"github.com/drone-runners/drone-runner-exec/engine/compiler"
 	"github.com/drone-runners/drone-runner-exec/engine/resource"
+	"github.com/drone-runners/drone-runner-exec/engine/script"
+	"github.com/drone-runners/drone-runner-exec/internal/affinity"
+	"github.com/drone-runners/drone-runner-exec/internal/artifact"
+	"github.com/drone-runners/drone-runner-exec/internal/egress"
+	"github.com/drone-runners/drone-runner-exec/internal/kv"
+	"github.com/drone-runners/drone-runner-exec/internal/lease"
+	"github.com/drone-runners/drone-runner-exec/internal/machine"
+	"github.com/drone-runners/drone-runner-exec/internal/match"
+	"github.com/drone-runners/drone-runner-exec/internal/metrics"
+	"github.com/drone-runners/drone-runner-exec/internal/port"
+	"github.com/drone-runners/drone-runner-exec/internal/provenance"
+	"github.com/drone-runners/drone-runner-exec/internal/remote"
+	"github.com/drone-runners/drone-runner-exec/internal/sandbox"
+	"github.com/drone-runners/drone-runner-exec/internal/secretmeta"
+	"github.com/drone-runners/drone-runner-exec/internal/snapshot"
+	"github.com/drone-runners/drone-runner-exec/internal/stepcache"
+	"github.com/drone-runners/drone-runner-exec/internal/tenant"
+	"github.com/drone-runners/drone-runner-exec/internal/usage"
+	"github.com/drone-runners/drone-runner-exec/runtime/event"
 
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/envsubst"
@@ -49,6 +69,14 @@ type Runner struct {
 	// machine executing the pipeline.
 	Machine string
 
+	// Host provides the runner with facts about the host
+	// machine that are added to every pipeline step.
+	Host *machine.Facts
+
+	// Version provides the host operating system version, used
+	// to evaluate the pipeline platform version constraint.
+	Version string
+
 	// Match is an optional function that returns true if the
 	// repository or build match user-defined criteria. This is
 	// intended as a security measure to prevent a runner from
@@ -58,6 +86,23 @@ type Runner struct {
 	// Secret provides the compiler with secrets.
 	Secret secret.Provider
 
+	// SecretTargets provides optional deployment target scopes
+	// for secrets, keyed by secret name pattern. Scoped secrets
+	// are only provided to promote and rollback builds that
+	// deploy to a matching target.
+	SecretTargets map[string]string
+
+	// SecretRules provides optional rules that restrict the
+	// events, branches and repositories that can resolve the
+	// matching secrets.
+	SecretRules []*match.SecretRule
+
+	// SecretMetadata provides optional expiry and rotation
+	// metadata of secrets. Steps that use a secret expiring
+	// within SecretExpiry write a warning to the step log.
+	SecretMetadata secretmeta.Provider
+	SecretExpiry   time.Duration
+
 	// Root defines the optional build root path, defaults to
 	// temp directory.
 	Root string
@@ -65,6 +110,180 @@ type Runner struct {
 	// Symlinks provides an optional list of symlinks that are
 	// created and linked to the pipeline workspace.
 	Symlinks map[string]string
+
+	// Plugins provides an optional lookup table that maps
+	// plugin images to plugin binaries installed on the host.
+	Plugins map[string]string
+
+	// HostAliases provides an optional lookup table that maps
+	// hostnames to ip addresses for the duration of each stage.
+	HostAliases map[string]string
+
+	// Toolbox provides the optional directory of the pinned
+	// tools provided by the runner, which is added to the step
+	// path.
+	Toolbox string
+
+	// Umask provides an optional octal umask for step
+	// processes and files created by the runner.
+	Umask string
+
+	// Priority provides an optional cpu and io scheduling
+	// priority for step processes.
+	Priority *engine.Priority
+
+	// Ulimits provides optional resource limits for step
+	// processes.
+	Ulimits map[string]int64
+
+	// Security provides an optional selinux context or
+	// apparmor profile for step processes.
+	Security *engine.Security
+
+	// Seccomp provides an optional seccomp profile for the
+	// step processes of untrusted repositories.
+	Seccomp string
+
+	// Sandbox provides an optional macos sandbox profile for
+	// the step processes of untrusted repositories, and
+	// SandboxTrusted for trusted repositories.
+	Sandbox        *sandbox.Profile
+	SandboxTrusted *sandbox.Profile
+
+	// Job provides optional limits of the windows job object
+	// that contains the step processes.
+	Job *engine.Job
+
+	// Jail optionally executes the step processes in an
+	// ephemeral freebsd jail cloned from a template.
+	Jail *engine.Jail
+
+	// Zone optionally executes the step processes in an
+	// ephemeral illumos zone cloned from a template zone.
+	Zone *engine.Zone
+
+	// CredentialHelper configures git to request the netrc
+	// credentials from a runner-managed socket, instead of
+	// writing the credentials to disk.
+	CredentialHelper bool
+
+	// Store provides an optional store used to publish the
+	// values exported by the stage to dependent stages, which
+	// may run on other runners.
+	Store kv.Store
+
+	// Artifacts provides an optional backend used to hand off
+	// the artifacts produced by the stage to dependent stages,
+	// which may run on other runners.
+	Artifacts artifact.Backend
+
+	// Provenance optionally records the signed provenance of
+	// each stage once the stage completes.
+	Provenance *provenance.Recorder
+
+	// Events provides an optional event bus used to publish
+	// the stage accepted event. Step and stage events are
+	// published by the reporter.
+	Events *event.Bus
+
+	// Snapshot optionally configures a snapshot of the host
+	// state taken when the stage starts. The snapshot summary
+	// is written to the build logs.
+	Snapshot *snapshot.Config
+
+	// Snapshots provides an optional store used to compare the
+	// host snapshot with the previous build of the repository.
+	Snapshots snapshot.Store
+
+	// Ports provides an optional port allocator used to assign
+	// unique ports to the pipeline.
+	Ports *port.Allocator
+
+	// CPUs provides an optional pool of disjoint cpu sets.
+	// The steps of each stage are pinned to a cpu set that is
+	// not shared with other running stages.
+	CPUs *affinity.Pool
+
+	// Tenants provides an optional mapping of repository
+	// namespaces to operating system users. The steps of the
+	// namespace run as the user, and the pipeline root is only
+	// accessible to the user.
+	Tenants *tenant.Users
+
+	// Cache provides an optional store of the successful runs
+	// of steps with a cache key. Steps are skipped if the
+	// inputs are unchanged since a previous successful run.
+	Cache stepcache.Store
+
+	// Queue provides an optional fair queue of accepted
+	// stages. Stages wait in the queue until capacity is free,
+	// and are scheduled across repository namespaces.
+	Queue *Queue
+
+	// Usage provides an optional ledger of the execution time
+	// of each repository namespace. Stages are declined when
+	// the namespace exceeds the hard quota.
+	Usage *usage.Ledger
+
+	// Hosts provides an optional pool of remote hosts. Each
+	// stage is executed on a remote host that matches the
+	// stage labels, instead of the local host.
+	Hosts *remote.Pool
+
+	// Verifier optionally verifies the checkout of the clone
+	// step before any user step is executed.
+	Verifier *Verifier
+
+	// Egress optionally routes the step traffic through a
+	// stage-scoped proxy, which only allows requests to the
+	// domains of the matching allowlist rules, and logs the
+	// outbound requests.
+	Egress *egress.Policy
+
+	// Worktrees provides optional persistent base clones of
+	// repositories. The stage workspace is added as a git
+	// worktree of the base clone, instead of cloning the
+	// repository for each stage.
+	Worktrees *Worktrees
+
+	// Summary adds a final step to each stage that writes the
+	// cost of the other steps to the step log.
+	Summary bool
+
+	// Debug defines how long the environment of a failed step
+	// is kept alive in a debug session. Debug sessions are
+	// disabled if zero.
+	Debug time.Duration
+
+	// Debugs optionally provides the stages and repositories
+	// marked for debugging by an administrator. The debug
+	// session is enabled for marked stages regardless of the
+	// pipeline configuration.
+	Debugs *Debugs
+
+	// AcceptTimeout defines the deadline for starting a stage
+	// once accepted. If the stage cannot be started before the
+	// deadline is exceeded, the stage is errored on the server
+	// to prevent the stage remaining pending indefinitely.
+	AcceptTimeout time.Duration
+
+	// MaxDuration defines the maximum duration of a stage,
+	// enforced regardless of the build timeout. If the maximum
+	// duration is exceeded, the stage is errored.
+	MaxDuration time.Duration
+
+	// Retries defines the number of times a stage is retried
+	// with a new pipeline environment, if the stage fails for
+	// an infrastructure reason attributable to the runner, such
+	// as a workspace or clone failure. Retries are disabled if
+	// zero.
+	Retries int
+
+	// LeaseInterval defines the interval at which the lease
+	// of a running stage is renewed. If the lease is lost to
+	// another machine the stage is cancelled to prevent
+	// duplicate execution. Leases are disabled if zero.
+	LeaseInterval time.Duration
 }
 
 // Run runs the pipeline stage.
@@ -82,17 +301,31 @@ func (s *Runner) Run(ctx context.Context, stage *drone.Stage) error {
 
 	stage.Machine = s.Machine
 	err := s.Client.Accept(ctx, stage)
+	if err == client.ErrOptimisticLock && lease.Renew(ctx, s.Client, stage) == nil {
+		// the stage is leased by this machine, which means the
+		// stage was accepted but the response was lost, for
+		// example, due to a network partition.
+		log.Debug("stage already accepted by this machine")
+		err = nil
+	}
 	if err != nil {
 		log.WithError(err).Error("cannot accept stage")
 		return err
 	}
 
 	log.Debug("stage accepted")
+	accepted := time.Now()
 
-	data, err := s.Client.Detail(ctx, stage)
+	// once accepted, the stage is owned by this runner. If the
+	// stage cannot be started before the deadline it is errored,
+	// otherwise it would remain pending on the server.
+	ctxstart, cancelstart := s.startContext(ctx)
+	defer cancelstart()
+
+	data, err := s.Client.Detail(ctxstart, stage)
 	if err != nil {
 		log.WithError(err).Error("cannot get stage details")
-		return err
+		return s.abort(ctx, &pipeline.State{Stage: stage}, fmt.Errorf("cannot get stage details: %s", err))
 	}
 
 	log = log.WithField("repo.id", data.Repo.ID).
@@ -103,14 +336,39 @@ func (s *Runner) Run(ctx context.Context, stage *drone.Stage) error {
 
 	log.Debug("stage details fetched")
 
-	ctxdone, cancel := context.WithCancel(ctx)
-	defer cancel()
+	if s.Events != nil {
+		copy := *stage
+		copy.Steps = nil
+		s.Events.Publish(&event.Event{
+			Type:  event.StageAccepted,
+			Time:  accepted.Unix(),
+			Repo:  data.Repo.Slug,
+			Build: data.Build.Number,
+			Stage: &copy,
+		})
+	}
 
-	timeout := time.Duration(data.Repo.Timeout) * time.Minute
-	ctxtimeout, cancel := context.WithTimeout(ctxdone, timeout)
+	if stage.Created > 0 {
+		metrics.QueueLatency.Observe(
+			accepted.Sub(time.Unix(stage.Created, 0)),
+			exemplar(data.Build, stage),
+			data.Repo.Slug,
+		)
+	}
+
+	// the pipeline state guards the stage, which is updated
+	// concurrently by the reporter and the lease renewal.
+	state := &pipeline.State{
+		Build:  data.Build,
+		Stage:  stage,
+		Repo:   data.Repo,
+		System: data.System,
+	}
+
+	ctxdone, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	ctxcancel, cancel := context.WithCancel(ctxtimeout)
+	ctxcancel, cancel := context.WithCancel(ctxdone)
 	defer cancel()
 
 	// next we opens a connection to the server to watch for
@@ -126,8 +384,51 @@ func (s *Runner) Run(ctx context.Context, stage *drone.Stage) error {
 		}
 	}()
 
+	// renew the stage lease while the stage is running. If the
+	// lease is lost the stage is owned by another machine and
+	// local execution is cancelled.
+	if s.LeaseInterval > 0 {
+		go lease.Keepalive(ctxdone, s.Client, stage, state, s.LeaseInterval, func() {
+			log.Errorln("stage leased by another machine, cancelling")
+			cancel()
+		})
+	}
+
+	// the stage waits for a free execution slot, which is
+	// assigned to the accepted stages across repository
+	// namespaces by weighted fair queuing. The stage is watched
+	// for cancellation and its lease is renewed while queued.
+	if s.Queue != nil {
+		if err := s.Queue.Acquire(ctxcancel, data.Repo.Namespace); err != nil {
+			if ctx.Err() == nil {
+				// the build was cancelled or the lease was lost
+				// while the stage was queued, in which case the
+				// stage is no longer owned by this runner.
+				log.Debugln("stage cancelled while queued")
+				return nil
+			}
+			log.WithError(err).Error("cannot schedule stage")
+			return s.abort(ctx, state, fmt.Errorf("cannot schedule stage: %s", err))
+		}
+		defer s.Queue.Release()
+
+		// the deadline for starting the stage is measured from
+		// when the stage is dequeued.
+		cancelstart()
+		ctxstart, cancelstart = s.startContext(ctx)
+		defer cancelstart()
+	}
+	dequeued := time.Now()
+
+	// host machine facts are overridden by the custom,
+	// global environment variables.
+	globals := s.Environ
+	if s.Host != nil {
+		globals = environ.Combine(s.Host.Environ(), s.Environ)
+	}
+
 	envs := environ.Combine(
-		s.Environ,
+		globals,
 		environ.System(data.System),
 		environ.Repo(data.Repo),
 		environ.Build(data.Build),
@@ -147,13 +448,6 @@ func (s *Runner) Run(ctx context.Context, stage *drone.Stage) error {
 		return v
 	}
 
-	state := &pipeline.State{
-		Build:  data.Build,
-		Stage:  stage,
-		Repo:   data.Repo,
-		System: data.System,
-	}
-
 	// evaluates whether or not the agent can process the
 	// pipeline. An agent may choose to reject a repository
 	// or build for security reasons.
@@ -163,6 +457,22 @@ func (s *Runner) Run(ctx context.Context, stage *drone.Stage) error {
 		return s.Reporter.ReportStage(noContext, state)
 	}
 
+	// stages are declined when the repository namespace has
+	// exceeded the hard quota of execution time, and a warning
+	// is logged when the soft quota is exceeded.
+	if s.Usage != nil {
+		switch s.Usage.Check(data.Repo.Namespace) {
+		case usage.StatusExceeded:
+			log.WithField("namespace", data.Repo.Namespace).
+				Error("cannot process stage, execution time quota exceeded")
+			state.FailAll(fmt.Errorf("namespace %s exceeded the execution time quota", data.Repo.Namespace))
+			return s.Reporter.ReportStage(noContext, state)
+		case usage.StatusWarning:
+			log.WithField("namespace", data.Repo.Namespace).
+				Warn("namespace exceeded the soft execution time quota")
+		}
+	}
+
 	// evaluates string replacement expressions and returns an
 	// update configuration file string.
 	config, err := envsubst.Eval(string(data.Config.Data), subf)
@@ -188,29 +498,260 @@ func (s *Runner) Run(ctx context.Context, stage *drone.Stage) error {
 		return s.Reporter.ReportStage(noContext, state)
 	}
 
+	// the build parameters are validated against the
+	// parameters declared by the pipeline, and the defaults
+	// are applied, before the pipeline is compiled.
+	params, err := resource.ResolveParams(data.Build.Event, data.Build.Params)
+	if err != nil {
+		log.WithError(err).Error("cannot resolve build parameters")
+		state.FailAll(err)
+		return s.Reporter.ReportStage(noContext, state)
+	}
+	data.Build.Params = params
+
+	// evaluates whether or not the host operating system
+	// version satisfies the pipeline platform constraint. The
+	// server does not route stages by version, so the stage
+	// is errored if the host cannot run the pipeline.
+	if constraint := resource.Platform.Version; constraint != "" {
+		ok, err := match.Version(constraint, s.Version)
+		if err != nil {
+			log.WithError(err).Error("cannot match platform version")
+			state.FailAll(err)
+			return s.Reporter.ReportStage(noContext, state)
+		}
+		if !ok {
+			log.WithField("version", s.Version).
+				WithField("constraint", constraint).
+				Error("cannot process stage, platform version mismatch")
+			state.FailAll(fmt.Errorf("host version %s does not satisfy platform version %s", s.Version, constraint))
+			return s.Reporter.ReportStage(noContext, state)
+		}
+	}
+
+	// the pipeline optionally overrides the stage behavior
+	// for builds of the event.
+	override := resource.Override(data.Build.Event)
+
+	// the build timeout is provided by the server, unless the
+	// pipeline overrides the timeout for the event, and is
+	// measured from when the stage is dequeued. An invalid
+	// timeout is ignored, in which case the stage is limited by
+	// the runner maximum duration only.
+	timeout := time.Duration(data.Repo.Timeout) * time.Minute
+	if override.Timeout > 0 {
+		timeout = time.Duration(override.Timeout)
+	}
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctxcancel, cancelTimeout = context.WithDeadline(ctxcancel, dequeued.Add(timeout))
+		defer cancelTimeout()
+	} else {
+		log.WithField("timeout", data.Repo.Timeout).
+			Warn("invalid build timeout")
+	}
+
+	// the runner maximum duration is enforced regardless of
+	// the build timeout.
+	if s.MaxDuration > 0 {
+		var cancelMax context.CancelFunc
+		ctxcancel, cancelMax = withMaxDuration(ctxcancel, s.MaxDuration)
+		defer cancelMax()
+	}
+
+	// the checkout is verified after the clone step, and the
+	// stage cannot be verified if the clone step is disabled.
+	if s.Verifier != nil && resource.Clone.Disable {
+		log.Error("cannot verify checkout, clone is disabled")
+		state.FailAll(errors.New("checkout verification requires the clone step"))
+		return s.Reporter.ReportStage(noContext, state)
+	}
+
+	// allocate the named ports requested by the pipeline. The
+	// ports are released when the pipeline completes.
+	var ports map[string]int
+	if s.Ports != nil && len(resource.Ports) > 0 {
+		ports, err = s.Ports.Allocate(resource.Ports)
+		if err != nil {
+			log.WithError(err).Error("cannot allocate ports")
+			state.FailAll(err)
+			return s.Reporter.ReportStage(noContext, state)
+		}
+		defer s.Ports.Release(ports)
+	}
+
+	// the steps of the repository namespace run as the
+	// dedicated user, if configured.
+	var user *engine.User
+	if s.Tenants != nil {
+		user, err = s.Tenants.Lookup(data.Repo.Namespace)
+		if err != nil {
+			log.WithError(err).
+				WithField("namespace", data.Repo.Namespace).
+				Error("cannot find namespace user")
+			state.FailAll(err)
+			return s.Reporter.ReportStage(noContext, state)
+		}
+	}
+
+	// the stage is executed on a remote host matching the
+	// stage labels, if configured. The stage waits until a
+	// matching host has free capacity.
+	root := s.Root
+	var host *remote.Host
+	var hostErr error
+	var shell *script.Shell
+	if s.Hosts != nil {
+		host, err = s.Hosts.Acquire(ctxstart, stage.Labels)
+		if err != nil {
+			log.WithError(err).Error("cannot acquire remote host")
+			state.FailAll(err)
+			return s.Reporter.ReportStage(noContext, state)
+		}
+		defer func() {
+			s.Hosts.Release(host, hostErr)
+		}()
+		root = host.Root
+		log = log.WithField("host", host.Name)
+
+		// windows hosts execute the steps with powershell,
+		// regardless of the runner platform.
+		if host.Protocol == remote.ProtocolWinRM {
+			shell = script.Powershell
+		}
+	}
+
+	// the steps are pinned to a cpu set of the local host,
+	// if configured. Stages in excess of the cpu sets, for
+	// example after the capacity is increased, are not pinned.
+	var cpus []int
+	if s.CPUs != nil && host == nil {
+		var ok bool
+		if cpus, ok = s.CPUs.Acquire(); ok {
+			defer s.CPUs.Release(cpus)
+			log = log.WithField("cpus", affinity.Format(cpus))
+		} else {
+			log.Warn("cannot pin stage, no free cpu set")
+		}
+	}
+
+	// values published by the upstream stages are injected
+	// into the pipeline steps.
+	upstream, err := s.upstream(ctxstart, data, stage)
+	if err != nil {
+		log.WithError(err).Error("cannot fetch upstream stage outputs")
+		state.FailAll(err)
+		return s.Reporter.ReportStage(noContext, state)
+	}
+
 	secrets := secret.Combine(
 		secret.Static(data.Secrets),
 		secret.Encrypted(),
 		s.Secret,
 	)
 
+	// secrets scoped to deployment targets are only provided
+	// to builds that deploy to a matching target, and secrets
+	// restricted by rules to builds that satisfy the rules.
+	if len(s.SecretTargets) != 0 || len(s.SecretRules) != 0 {
+		secrets = &scoped{provider: secrets, targets: s.SecretTargets, rules: s.SecretRules}
+	}
+
+	// the secrets requested by the build are audited, and the
+	// steps warn when a nearly expired secret is used.
+	audit := newAudited(secrets, s.SecretMetadata, s.SecretExpiry)
+	secrets = audit
+
+	// the runner helpers and toolbox are installed on the host
+	// machine, and are not available on remote hosts, jails and
+	// zones.
+	helpers := host == nil && s.Jail == nil && s.Zone == nil
+
 	// compile the yaml configuration file to an intermediate
 	// representation, and then
 	comp := &compiler.Compiler{
 		Pipeline: resource,
 		Manifest: manifest,
-		Environ:  s.Environ,
+		Environ:  environ.Combine(globals, upstream),
 		Build:    data.Build,
 		Stage:    stage,
 		Repo:     data.Repo,
 		System:   data.System,
 		Netrc:    data.Netrc,
 		Secret:   secrets,
-		Root:     s.Root,
+		Root:     root,
+		Shell:    shell,
 		Symlinks: s.Symlinks,
+		Ports:    ports,
+		Debug:    s.Debug,
+		Summary:  s.Summary,
+		Plugins:  s.Plugins,
+		Umask:    s.Umask,
+		Priority: s.Priority,
+		CPUs:     cpus,
+		Ulimits:  s.Ulimits,
+		Security: s.Security,
+		Seccomp:  s.Seccomp,
+		Job:      s.Job,
+		Jail:     s.Jail,
+		Zone:     s.Zone,
+
+		Sandbox:        s.Sandbox,
+		SandboxTrusted: s.SandboxTrusted,
+		HostAliases:    s.HostAliases,
+
+		CredentialHelper: s.CredentialHelper,
+		Artifacts:        s.Artifacts != nil,
+		Helpers:          helpers,
+	}
+	if s.Debugs != nil {
+		comp.DebugMarked = s.Debugs.Marked(stage.ID, data.Repo.Slug)
+	}
+	if s.Worktrees != nil && !override.FreshWorkspace {
+		comp.Worktree = s.Worktrees.Base(data.Repo.Slug)
+	}
+	if helpers {
+		comp.Toolbox = s.Toolbox
 	}
 
-	spec := comp.Compile(ctx)
+	spec := comp.Compile(ctxstart)
+	if err := ctxstart.Err(); err != nil {
+		log.WithError(err).Error("cannot compile pipeline")
+		return s.abort(ctx, state, fmt.Errorf("cannot compile pipeline: %s", err))
+	}
+	if host != nil {
+		spec.Remote = &engine.Remote{Host: host.Name}
+	}
+	if user != nil {
+		spec.User = user
+		for _, step := range spec.Steps {
+			step.Envs["USER"] = user.Name
+			step.Envs["LOGNAME"] = user.Name
+		}
+	}
+	// the step traffic of untrusted repositories is routed
+	// through the egress proxy, if configured. The git server
+	// is always allowed, so that the repository can be cloned.
+	if s.Egress != nil && (!data.Repo.Trusted || s.Egress.Trusted) {
+		var hosts []string
+		if u, err := url.Parse(data.Repo.HTTPURL); err == nil && u.Hostname() != "" {
+			hosts = append(hosts, u.Hostname())
+		}
+		proxy, err := egress.Start(s.Egress.Rules, data.Repo.Slug, hosts, log)
+		if err != nil {
+			log.WithError(err).Error("cannot start egress proxy")
+			return s.abort(ctx, state, fmt.Errorf("cannot start egress proxy: %s", err))
+		}
+		defer proxy.Close()
+		for _, step := range spec.Steps {
+			envs, err := proxy.Environ(step.Name)
+			if err != nil {
+				log.WithError(err).Error("cannot issue egress proxy token")
+				return s.abort(ctx, state, fmt.Errorf("cannot issue egress proxy token: %s", err))
+			}
+			step.Envs = environ.Combine(step.Envs, envs)
+		}
+	}
 	for _, src := range spec.Steps {
 		// steps that are skipped are ignored and are not stored
 		// in the drone database, nor displayed in the UI.
@@ -226,17 +767,82 @@ func (s *Runner) Run(ctx context.Context, stage *drone.Stage) error {
 		})
 	}
 
-	stage.Started = time.Now().Unix()
+	started := time.Now()
+	stage.Started = started.Unix()
 	stage.Status = drone.StatusRunning
-	if err := s.Client.Update(ctx, stage); err != nil {
+	state.Lock()
+	err = s.Client.Update(ctxstart, stage)
+	state.Unlock()
+	if err != nil {
 		log.WithError(err).Error("cannot update stage")
-		return err
+		return s.abort(ctx, state, fmt.Errorf("cannot start stage: %s", err))
 	}
+	cancelstart()
 
 	log.Debug("updated stage to running")
 
+	outputs := new(outputs)
 	ctxcancel = logger.WithContext(ctxcancel, log)
+	ctxcancel = withOutputs(ctxcancel, outputs)
+	if s.Snapshot != nil {
+		ctxcancel = withPreamble(ctxcancel, s.snapshot(ctxcancel, data.Repo.Slug))
+	}
+	ctxcancel = withRetries(ctxcancel, s.Retries)
+	ctxcancel = withChanges(ctxcancel, &changes{
+		before: data.Build.Before,
+		after:  data.Build.After,
+	})
+	if s.Cache != nil && !override.FreshWorkspace {
+		ctxcancel = withCache(ctxcancel, &stepCache{store: s.Cache, repo: data.Repo.Slug})
+	}
+	if s.Provenance != nil {
+		ctxcancel = withProvenance(ctxcancel, s.Provenance)
+	}
+	audit.record(ctxcancel)
+	ctxcancel = withAudit(ctxcancel, audit)
+	if s.Artifacts != nil {
+		ctxcancel = withHandoff(ctxcancel, &handoff{
+			backend:   s.Artifacts,
+			key:       artifact.Key{Repo: data.Repo.Slug, Build: data.Build.Number, Stage: stage.Name},
+			dependsOn: stage.DependsOn,
+		})
+	}
 	err = s.Execer.Exec(ctxcancel, spec, state)
+
+	// the debug marks are removed once the marked stage fails,
+	// so that the debug session is only enabled for the next
+	// failure.
+	if comp.DebugMarked && state.Failed() {
+		s.Debugs.Clear(stage.ID, data.Repo.Slug)
+	}
+
+	// the execution time of the stage is accounted to the
+	// repository namespace.
+	elapsed := time.Since(started)
+	metrics.StageDuration.Observe(elapsed, exemplar(data.Build, stage), data.Repo.Namespace)
+	if s.Usage != nil {
+		if err := s.Usage.Record(data.Repo.Namespace, elapsed); err != nil {
+			log.WithError(err).Error("cannot record stage execution time")
+		}
+	}
+
+	// errors executing the stage, excluding cancellation and
+	// timeouts, are recorded as failures of the remote host.
+	if host != nil && err != nil && ctxcancel.Err() == nil {
+		hostErr = err
+	}
+
+	// values exported by the stage are published to the store
+	// for consumption by dependent stages.
+	if s.Store != nil {
+		if values := outputs.environ(); len(values) != 0 {
+			key := kv.Key{Repo: data.Repo.Slug, Build: data.Build.Number, Stage: stage.Name}
+			if err := s.Store.Put(noContext, key, values); err != nil {
+				log.WithError(err).Error("cannot publish stage outputs")
+			}
+		}
+	}
+
 	if err != nil {
 		log.WithError(err).Debug("stage failed")
 		return err
@@ -244,3 +850,69 @@ func (s *Runner) Run(ctx context.Context, stage *drone.Stage) error {
 	log.Debug("updated stage to complete")
 	return nil
 }
+
+// helper function returns the context used to start the stage,
+// which is cancelled once the accept timeout is exceeded.
+func (s *Runner) startContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.AcceptTimeout > 0 {
+		return context.WithTimeout(ctx, s.AcceptTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// helper function returns the values published by the upstream
+// stages. If multiple upstream stages publish the same value,
+// the value is taken from the last stage listed in depends_on.
+func (s *Runner) upstream(ctx context.Context, data *client.Context, stage *drone.Stage) (map[string]string, error) {
+	values := map[string]string{}
+	if s.Store == nil {
+		return values, nil
+	}
+	for _, name := range stage.DependsOn {
+		key := kv.Key{Repo: data.Repo.Slug, Build: data.Build.Number, Stage: name}
+		found, err := s.Store.Get(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot fetch outputs of stage %s: %s", name, err)
+		}
+		for k, v := range found {
+			values[k] = v
+		}
+	}
+	return values, nil
+}
+
+// helper function errors an accepted stage that cannot be
+// started, and records the reason on the server.
+func (s *Runner) abort(ctx context.Context, state *pipeline.State, err error) error {
+	state.Lock()
+	defer state.Unlock()
+	stage := state.Stage
+	now := time.Now().Unix()
+	if stage.Started == 0 {
+		stage.Started = now
+	}
+	stage.Stopped = now
+	stage.Status = drone.StatusError
+	stage.Error = err.Error()
+	for _, step := range stage.Steps {
+		if step.Status == drone.StatusPending {
+			step.Status = drone.StatusSkipped
+		}
+	}
+	if uerr := s.Client.Update(noContext, stage); uerr != nil {
+		logger.FromContext(ctx).
+			WithError(uerr).
+			WithField("stage.id", stage.ID).
+			Error("cannot error stage")
+	}
+	return err
+}
+
+// helper function returns the exemplar labels that identify
+// the observed build and stage.
+func exemplar(build *drone.Build, stage *drone.Stage) map[string]string {
+	return map[string]string{
+		"build_id": fmt.Sprint(build.ID),
+		"stage_id": fmt.Sprint(stage.ID),
+	}
+}
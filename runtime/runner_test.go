@@ -5,3 +5,308 @@
 // that can be found in the LICENSE file.
 
 package runtime
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/internal/kv"
+	"github.com/drone-runners/drone-runner-exec/internal/lease"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+	"github.com/drone/runner-go/pipeline"
+	"github.com/drone/runner-go/pipeline/remote"
+)
+
+func TestRun_DetailError(t *testing.T) {
+	cli := &fakeClient{detailErr: errors.New("connection refused")}
+	runner := &Runner{Client: cli}
+	if err := runner.Run(noContext, &drone.Stage{ID: 1}); err == nil {
+		t.Errorf("Expect error when stage details cannot be fetched")
+	}
+	stage := cli.last()
+	if stage == nil {
+		t.Errorf("Expect accepted stage errored on the server")
+		return
+	}
+	if got, want := stage.Status, drone.StatusError; got != want {
+		t.Errorf("Want stage status %s, got %s", want, got)
+	}
+	if !strings.Contains(stage.Error, "connection refused") {
+		t.Errorf("Expect diagnostics in stage error, got %q", stage.Error)
+	}
+	if stage.Started == 0 || stage.Stopped == 0 {
+		t.Errorf("Expect stage started and stopped timestamps")
+	}
+}
+
+func TestRun_AcceptTimeout(t *testing.T) {
+	cli := &fakeClient{detailBlock: true}
+	runner := &Runner{
+		Client:        cli,
+		AcceptTimeout: 10 * time.Millisecond,
+	}
+	if err := runner.Run(noContext, &drone.Stage{ID: 1}); err == nil {
+		t.Errorf("Expect error when stage cannot be started before deadline")
+	}
+	stage := cli.last()
+	if stage == nil {
+		t.Errorf("Expect accepted stage errored on the server")
+		return
+	}
+	if got, want := stage.Status, drone.StatusError; got != want {
+		t.Errorf("Want stage status %s, got %s", want, got)
+	}
+	if !strings.Contains(stage.Error, context.DeadlineExceeded.Error()) {
+		t.Errorf("Expect deadline in stage error, got %q", stage.Error)
+	}
+}
+
+func TestRun_AcceptError(t *testing.T) {
+	cli := &fakeClient{acceptErr: errors.New("optimistic lock error")}
+	runner := &Runner{Client: cli}
+	if err := runner.Run(noContext, &drone.Stage{ID: 1}); err == nil {
+		t.Errorf("Expect error when stage cannot be accepted")
+	}
+	if cli.last() != nil {
+		t.Errorf("Expect stage owned by another runner is not updated")
+	}
+}
+
+func TestRun_AcceptLeased(t *testing.T) {
+	cli := &fakeClient{
+		acceptErr: client.ErrOptimisticLock,
+		detailErr: errors.New("connection refused"),
+		leased:    true,
+	}
+	runner := &Runner{Client: cli, Machine: "runner-1"}
+	runner.Run(noContext, &drone.Stage{ID: 1})
+	if cli.last() == nil {
+		t.Errorf("Expect stage leased by this machine is accepted")
+	}
+}
+
+func TestRun_CancelledQueued(t *testing.T) {
+	queue := NewQueue(NewControl("default", 1, nil), nil)
+	if err := queue.Acquire(noContext, "octocat"); err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Release()
+
+	cli := &fakeClient{
+		detail: &client.Context{
+			Repo:   &drone.Repo{Namespace: "octocat"},
+			Build:  &drone.Build{},
+			System: &drone.System{},
+		},
+		cancelled: true,
+	}
+	runner := &Runner{Client: cli, Queue: queue}
+
+	done := make(chan error)
+	go func() { done <- runner.Run(noContext, &drone.Stage{ID: 1}) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expect cancelled stage dequeued without error, got %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expect stage cancelled while queued")
+	}
+	if cli.last() != nil {
+		t.Errorf("Expect cancelled stage is not updated")
+	}
+}
+
+func TestRun_LeaseRenewed(t *testing.T) {
+	cli := &fakeClient{
+		detail: &client.Context{
+			Repo:   &drone.Repo{},
+			Build:  &drone.Build{},
+			System: &drone.System{},
+		},
+		leased: true,
+	}
+	runner := &Runner{
+		Client:        cli,
+		Reporter:      remote.New(cli),
+		Machine:       "runner-1",
+		LeaseInterval: time.Millisecond,
+		// the stage is reported once the lease is renewed.
+		Match: func(*drone.Repo, *drone.Build) bool {
+			for cli.renewed() < 2 {
+				time.Sleep(time.Millisecond)
+			}
+			return false
+		},
+	}
+	if err := runner.Run(noContext, &drone.Stage{ID: 1}); err != nil {
+		t.Errorf("Want stage reported after lease renewal, got %s", err)
+	}
+	if cli.last() == nil {
+		t.Errorf("Expect stage updated on the server")
+	}
+}
+
+func TestRun_PlatformVersion(t *testing.T) {
+	config := "kind: pipeline\ntype: exec\nname: default\nplatform:\n  os: macos\n  version: \">=12\"\n"
+	cli := &fakeClient{
+		detail: &client.Context{
+			Repo:   &drone.Repo{},
+			Build:  &drone.Build{},
+			System: &drone.System{},
+			Config: &client.File{Data: []byte(config)},
+		},
+	}
+	reporter := &fakeReporter{}
+	runner := &Runner{Client: cli, Reporter: reporter, Version: "11.7.10"}
+	runner.Run(noContext, &drone.Stage{ID: 1, Name: "default", Status: drone.StatusPending})
+	if reporter.state == nil {
+		t.Fatalf("Expect stage reported")
+	}
+	if got, want := reporter.state.Stage.Status, drone.StatusError; got != want {
+		t.Errorf("Want stage status %s, got %s", want, got)
+	}
+	if !strings.Contains(reporter.state.Stage.Error, ">=12") {
+		t.Errorf("Expect constraint in stage error, got %q", reporter.state.Stage.Error)
+	}
+}
+
+func TestRunner_Upstream(t *testing.T) {
+	store := kv.Dir(t.TempDir())
+	data := &client.Context{
+		Repo:  &drone.Repo{Slug: "octocat/hello-world"},
+		Build: &drone.Build{Number: 42},
+	}
+	store.Put(noContext, kv.Key{Repo: "octocat/hello-world", Build: 42, Stage: "build"}, map[string]string{"version": "1.2.3"})
+	store.Put(noContext, kv.Key{Repo: "octocat/hello-world", Build: 41, Stage: "test"}, map[string]string{"coverage": "80"})
+
+	runner := &Runner{Store: store}
+	got, err := runner.upstream(noContext, data, &drone.Stage{DependsOn: []string{"build", "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["version"] != "1.2.3" {
+		t.Errorf("Want values published by upstream stage")
+	}
+	if _, ok := got["coverage"]; ok {
+		t.Errorf("Expect values published by other builds ignored")
+	}
+}
+
+func TestAbort(t *testing.T) {
+	cli := &fakeClient{}
+	runner := &Runner{Client: cli}
+	stage := &drone.Stage{
+		ID: 1,
+		Steps: []*drone.Step{
+			{Name: "build", Status: drone.StatusPending},
+		},
+	}
+	err := runner.abort(noContext, &pipeline.State{Stage: stage}, errors.New("cannot start stage"))
+	if err == nil {
+		t.Errorf("Expect abort returns the error")
+	}
+	if got, want := stage.Steps[0].Status, drone.StatusSkipped; got != want {
+		t.Errorf("Want pending step status %s, got %s", want, got)
+	}
+	if cli.last() != stage {
+		t.Errorf("Expect errored stage updated on the server")
+	}
+}
+
+// fakeClient is a stub implementation of the client used to
+// simulate failures when starting a stage.
+type fakeClient struct {
+	client.Client
+
+	sync.Mutex
+	acceptErr   error
+	detail      *client.Context
+	detailErr   error
+	detailBlock bool
+	leased      bool
+	cancelled   bool
+	updates     []*drone.Stage
+	version     int64
+	renewals    int
+}
+
+func (c *fakeClient) Renew(ctx context.Context, stage *drone.Stage) error {
+	if c.leased && stage.Machine == "runner-1" {
+		c.Lock()
+		c.version++
+		c.renewals++
+		stage.Version = c.version
+		c.Unlock()
+		return nil
+	}
+	return lease.ErrLost
+}
+
+func (c *fakeClient) renewed() int {
+	c.Lock()
+	defer c.Unlock()
+	return c.renewals
+}
+
+func (c *fakeClient) Accept(ctx context.Context, stage *drone.Stage) error {
+	return c.acceptErr
+}
+
+func (c *fakeClient) Detail(ctx context.Context, stage *drone.Stage) (*client.Context, error) {
+	if c.detailBlock {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return c.detail, c.detailErr
+}
+
+func (c *fakeClient) Update(ctx context.Context, stage *drone.Stage) error {
+	c.Lock()
+	defer c.Unlock()
+	if stage.Version != c.version {
+		return client.ErrOptimisticLock
+	}
+	c.version++
+	stage.Version = c.version
+	c.updates = append(c.updates, stage)
+	return nil
+}
+
+func (c *fakeClient) Watch(ctx context.Context, build int64) (bool, error) {
+	if c.cancelled {
+		return true, nil
+	}
+	<-ctx.Done()
+	return false, nil
+}
+
+func (c *fakeClient) last() *drone.Stage {
+	c.Lock()
+	defer c.Unlock()
+	if len(c.updates) == 0 {
+		return nil
+	}
+	return c.updates[len(c.updates)-1]
+}
+
+// fakeReporter is a stub implementation of the reporter used
+// to capture the reported stage.
+type fakeReporter struct {
+	state *pipeline.State
+}
+
+func (r *fakeReporter) ReportStage(ctx context.Context, state *pipeline.State) error {
+	r.state = state
+	return nil
+}
+
+func (r *fakeReporter) ReportStep(ctx context.Context, state *pipeline.State, name string) error {
+	return nil
+}
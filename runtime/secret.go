@@ -0,0 +1,178 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/internal/match"
+	"github.com/drone-runners/drone-runner-exec/internal/secretmeta"
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/logger"
+	"github.com/drone/runner-go/secret"
+)
+
+// scoped is a secret provider that withholds secrets scoped to
+// deployment targets from builds that do not deploy to a
+// matching target, and secrets restricted by the runner rules
+// from builds that do not satisfy the rules. Secrets are
+// withheld before the provider is called.
+type scoped struct {
+	provider secret.Provider
+	targets  map[string]string
+	rules    []*match.SecretRule
+}
+
+func (s *scoped) Find(ctx context.Context, in *secret.Request) (*drone.Secret, error) {
+	if !match.Target(in.Name, in.Build, s.targets) {
+		logger.FromContext(ctx).
+			WithField("secret", in.Name).
+			WithField("target", in.Build.Deploy).
+			Warn("secret is not available to the deployment target")
+		return nil, nil
+	}
+	if !match.Secret(in.Name, in.Repo, in.Build, s.rules) {
+		logger.FromContext(ctx).
+			WithField("secret", in.Name).
+			WithField("event", in.Build.Event).
+			WithField("branch", in.Build.Target).
+			Warn("secret is not available to the build")
+		return nil, nil
+	}
+	return s.provider.Find(ctx, in)
+}
+
+// audited is a secret provider that records the secrets
+// requested by the build, and the secrets that are nearly
+// expired.
+type audited struct {
+	provider secret.Provider
+	metadata secretmeta.Provider
+	warning  time.Duration
+
+	mu       sync.Mutex
+	found    map[string]struct{}
+	missing  map[string]struct{}
+	expiring map[string]*secretmeta.Metadata
+}
+
+// helper function returns a new secret audit.
+func newAudited(provider secret.Provider, metadata secretmeta.Provider, warning time.Duration) *audited {
+	return &audited{
+		provider: provider,
+		metadata: metadata,
+		warning:  warning,
+		found:    map[string]struct{}{},
+		missing:  map[string]struct{}{},
+		expiring: map[string]*secretmeta.Metadata{},
+	}
+}
+
+func (a *audited) Find(ctx context.Context, in *secret.Request) (*drone.Secret, error) {
+	found, err := a.provider.Find(ctx, in)
+	if err != nil {
+		return found, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if found == nil {
+		a.missing[in.Name] = struct{}{}
+		return nil, nil
+	}
+	a.found[in.Name] = struct{}{}
+
+	if _, ok := a.expiring[in.Name]; ok || a.metadata == nil {
+		return found, nil
+	}
+	meta, err := a.metadata.Find(ctx, in.Repo.Slug, in.Name)
+	if err != nil {
+		logger.FromContext(ctx).
+			WithError(err).
+			WithField("secret", in.Name).
+			Warn("cannot find secret metadata")
+		return found, nil
+	}
+	if meta != nil && !meta.Expires.IsZero() && time.Until(meta.Expires) < a.warning {
+		a.expiring[in.Name] = meta
+	}
+	return found, nil
+}
+
+// record logs the audit record of the secrets requested by
+// the build.
+func (a *audited) record(ctx context.Context) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.found) == 0 && len(a.missing) == 0 {
+		return
+	}
+	var expiring []string
+	for name := range a.expiring {
+		expiring = append(expiring, name)
+	}
+	sort.Strings(expiring)
+	logger.FromContext(ctx).
+		WithField("audit", "secret").
+		WithField("secrets", joinNames(a.found)).
+		WithField("missing", joinNames(a.missing)).
+		WithField("expiring", strings.Join(expiring, ",")).
+		Info("secrets requested by build")
+}
+
+// helper function returns the sorted, comma-separated names.
+func joinNames(set map[string]struct{}) string {
+	var names []string
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// warn writes a warning to the step log for each nearly expired
+// secret used by the step.
+func (a *audited) warn(w io.Writer, step *engine.Step) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, s := range step.Secrets {
+		meta, ok := a.expiring[s.Name]
+		if !ok {
+			continue
+		}
+		if time.Now().After(meta.Expires) {
+			fmt.Fprintf(w, "warning: secret %s expired on %s\n", s.Name, meta.Expires.Format(time.RFC3339))
+		} else {
+			fmt.Fprintf(w, "warning: secret %s expires on %s\n", s.Name, meta.Expires.Format(time.RFC3339))
+		}
+		if !meta.Rotated.IsZero() {
+			fmt.Fprintf(w, "warning: secret %s was last rotated on %s\n", s.Name, meta.Rotated.Format(time.RFC3339))
+		}
+	}
+}
+
+type auditedKey struct{}
+
+// helper function returns a context that carries the secret
+// audit.
+func withAudit(ctx context.Context, a *audited) context.Context {
+	return context.WithValue(ctx, auditedKey{}, a)
+}
+
+// helper function returns the secret audit carried by the
+// context, or nil if the context does not carry an audit.
+func auditFrom(ctx context.Context) *audited {
+	a, _ := ctx.Value(auditedKey{}).(*audited)
+	return a
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/internal/secretmeta"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/secret"
+)
+
+func TestAudited(t *testing.T) {
+	provider := secret.Static([]*drone.Secret{
+		{Name: "token", Data: "secret"},
+		{Name: "password", Data: "secret"},
+	})
+	metadata := secretmeta.Static([]*secretmeta.Metadata{
+		{Name: "token", Expires: time.Now().Add(24 * time.Hour)},
+		{Name: "password", Expires: time.Now().Add(90 * 24 * time.Hour)},
+	})
+	audit := newAudited(provider, metadata, 7*24*time.Hour)
+
+	repo := &drone.Repo{Slug: "octocat/hello-world"}
+	build := &drone.Build{Event: drone.EventPush}
+	for _, name := range []string{"token", "password", "token", "missing"} {
+		audit.Find(noContext, &secret.Request{Name: name, Repo: repo, Build: build})
+	}
+	if got, want := joinNames(audit.found), "password,token"; got != want {
+		t.Errorf("Want found secrets %s, got %s", want, got)
+	}
+	if got, want := joinNames(audit.missing), "missing"; got != want {
+		t.Errorf("Want missing secrets %s, got %s", want, got)
+	}
+
+	var buf bytes.Buffer
+	audit.warn(&buf, &engine.Step{
+		Secrets: []*engine.Secret{{Name: "token"}, {Name: "password"}},
+	})
+	if !strings.Contains(buf.String(), "warning: secret token expires on") {
+		t.Errorf("Want expiry warning for nearly expired secret, got %q", buf.String())
+	}
+	if strings.Contains(buf.String(), "password") {
+		t.Errorf("Want no expiry warning for secret expiring later")
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-exec/internal/snapshot"
+	"github.com/drone/runner-go/logger"
+)
+
+// helper function snapshots the host state, and returns a
+// summary of the snapshot, and of the differences from the
+// previous snapshot taken for the repository.
+func (s *Runner) snapshot(ctx context.Context, repo string) string {
+	next := snapshot.Take(ctx, *s.Snapshot)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "host %s: %d packages, %d environment variables\n",
+		s.Machine, len(next.Packages), len(next.Environ))
+	var tools []string
+	for name := range next.Tools {
+		tools = append(tools, name)
+	}
+	sort.Strings(tools)
+	for _, name := range tools {
+		fmt.Fprintf(&b, "host tool %s: %s\n", name, next.Tools[name])
+	}
+
+	if s.Snapshots == nil {
+		return b.String()
+	}
+	log := logger.FromContext(ctx)
+	prev, err := s.Snapshots.Swap(repo, next)
+	if err != nil {
+		log.WithError(err).Warn("cannot store host snapshot")
+	}
+	if prev == nil {
+		return b.String()
+	}
+	diff := snapshot.Diff(prev, next)
+	if len(diff) != 0 {
+		log.WithField("changes", len(diff)).
+			Warn("host state changed since the previous build")
+	}
+	for _, line := range diff {
+		fmt.Fprintf(&b, "warning: host state changed since the previous build: %s\n", line)
+	}
+	return b.String()
+}
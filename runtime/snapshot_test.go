@@ -0,0 +1,37 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/internal/snapshot"
+)
+
+func TestRunner_Snapshot(t *testing.T) {
+	runner := &Runner{
+		Machine:   "runner-1",
+		Snapshot:  &snapshot.Config{},
+		Snapshots: snapshot.Memory(),
+	}
+	got := runner.snapshot(context.Background(), "octocat/hello-world")
+	if !strings.HasPrefix(got, "host runner-1:") {
+		t.Errorf("Expect host snapshot summary, got %q", got)
+	}
+	if strings.Contains(got, "warning") {
+		t.Errorf("Expect no warning for the first build, got %q", got)
+	}
+
+	os.Setenv("DRONE_TEST_SNAPSHOT", "true")
+	defer os.Unsetenv("DRONE_TEST_SNAPSHOT")
+
+	got = runner.snapshot(context.Background(), "octocat/hello-world")
+	if !strings.Contains(got, "environment variable DRONE_TEST_SNAPSHOT added") {
+		t.Errorf("Expect warning when host state changed, got %q", got)
+	}
+}
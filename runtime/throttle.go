@@ -0,0 +1,100 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/runtime/event"
+)
+
+// ThrottleStatus reports the state of the throttle.
+type ThrottleStatus struct {
+	Throttled bool   `json:"throttled"`
+	Reason    string `json:"reason,omitempty"`
+	Since     int64  `json:"since,omitempty"`
+}
+
+// Throttle lowers the number of stages the pollers request
+// concurrently while the host is throttled, for example when
+// the host is too hot or the battery is nearly empty. Running
+// stages are not affected.
+type Throttle struct {
+	mu      sync.Mutex
+	status  ThrottleStatus
+	changed chan struct{}
+
+	capacity int
+	events   *event.Bus
+}
+
+// NewThrottle returns a new throttle that limits each poller
+// to the capacity while throttled. The pollers stop requesting
+// stages while throttled if the capacity is zero. The optional
+// event bus is notified when the host is throttled or resumed.
+func NewThrottle(capacity int, events *event.Bus) *Throttle {
+	return &Throttle{
+		changed:  make(chan struct{}),
+		capacity: capacity,
+		events:   events,
+	}
+}
+
+// Status returns the state of the throttle.
+func (t *Throttle) Status() ThrottleStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+// Set throttles or resumes the pollers. The reason describes
+// why the host is throttled.
+func (t *Throttle) Set(throttled bool, reason string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.status.Throttled == throttled {
+		return
+	}
+	typ := event.RunnerResumed
+	t.status = ThrottleStatus{}
+	if throttled {
+		typ = event.RunnerThrottled
+		t.status = ThrottleStatus{
+			Throttled: true,
+			Reason:    reason,
+			Since:     time.Now().Unix(),
+		}
+	}
+	close(t.changed)
+	t.changed = make(chan struct{})
+	if t.events != nil {
+		t.events.Publish(&event.Event{
+			Type:    typ,
+			Time:    time.Now().Unix(),
+			Message: reason,
+		})
+	}
+}
+
+// wait blocks until the poller thread is permitted to request
+// a stage. It returns false if the context is cancelled.
+func (t *Throttle) wait(ctx context.Context, thread int) bool {
+	for {
+		t.mu.Lock()
+		ok := !t.status.Throttled || thread < t.capacity
+		changed := t.changed
+		t.mu.Unlock()
+		if ok {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/runtime/event"
+)
+
+func TestThrottle(t *testing.T) {
+	bus := event.New()
+	events, unsubscribe := bus.Subscribe(2)
+	defer unsubscribe()
+
+	throttle := NewThrottle(1, bus)
+	throttle.Set(true, "temperature 90.0°C exceeds 85.0°C")
+	if e := <-events; e.Type != event.RunnerThrottled || e.Message == "" {
+		t.Errorf("Want throttled event with reason")
+	}
+	if !throttle.Status().Throttled {
+		t.Errorf("Want throttle status throttled")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if !throttle.wait(ctx, 0) {
+		t.Errorf("Want thread within throttled capacity permitted")
+	}
+
+	done := make(chan bool)
+	go func() { done <- throttle.wait(ctx, 1) }()
+	select {
+	case <-done:
+		t.Fatalf("Want thread in excess of throttled capacity blocked")
+	case <-time.After(10 * time.Millisecond):
+	}
+	throttle.Set(false, "")
+	if !<-done {
+		t.Errorf("Want thread permitted once resumed")
+	}
+	if e := <-events; e.Type != event.RunnerResumed {
+		t.Errorf("Want resumed event")
+	}
+}
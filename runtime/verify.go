@@ -0,0 +1,129 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+
+	"github.com/drone/runner-go/pipeline"
+)
+
+// errVerify is returned when the checkout cannot be verified.
+var errVerify = errors.New("cannot verify checkout")
+
+// Verifier verifies the checkout of the clone step before any
+// user step is executed. The checked-out commit must match the
+// build commit and, if keys are configured, must be signed by
+// an allowed key.
+type Verifier struct {
+	gpgHome string
+	signers string
+}
+
+// NewVerifier returns a new checkout verifier. The commit
+// signature is verified against the keys of the gnupg home
+// directory and the ssh allowed signers file, if provided.
+func NewVerifier(gpgHome, signers string) *Verifier {
+	return &Verifier{
+		gpgHome: gpgHome,
+		signers: signers,
+	}
+}
+
+// Middleware returns a Middleware that verifies the checkout
+// when the clone step succeeds. If the checkout cannot be
+// verified, the clone step fails and the remaining steps of
+// the stage are skipped.
+func (v *Verifier) Middleware() Middleware {
+	return func(next StepFunc) StepFunc {
+		return func(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step, output io.Writer) (*engine.State, error) {
+			exited, err := next(ctx, state, spec, step, output)
+			if step.Name != "clone" || err != nil || exited == nil || exited.ExitCode != 0 {
+				return exited, err
+			}
+			state.Lock()
+			commit := state.Build.After
+			ref := state.Build.Ref
+			state.Unlock()
+
+			if err := v.verify(ctx, step, commit, ref, output); err != nil {
+				fmt.Fprintln(output, err)
+				state.SkipAll()
+				return nil, errVerify
+			}
+			return exited, nil
+		}
+	}
+}
+
+// helper function verifies the checked-out commit, and the
+// signature of the commit.
+func (v *Verifier) verify(ctx context.Context, step *engine.Step, commit, ref string, output io.Writer) error {
+	if commit == "" {
+		return errors.New("build does not have a commit")
+	}
+	head, err := v.git(ctx, step.WorkingDir, "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	// the pull request commit is merged into the target
+	// branch, and is the second parent of the merge commit,
+	// unless the merge is a fast-forward.
+	if head != commit && isPullRequest(ref) {
+		head, _ = v.git(ctx, step.WorkingDir, "rev-parse", "HEAD^2")
+	}
+	if head != commit {
+		return fmt.Errorf("checked-out commit %s does not match build commit %s", head, commit)
+	}
+	fmt.Fprintf(output, "verified commit %s\n", commit)
+
+	if v.gpgHome == "" && v.signers == "" {
+		return nil
+	}
+	if _, err := v.git(ctx, step.WorkingDir, "verify-commit", commit); err != nil {
+		return fmt.Errorf("commit %s does not have a valid signature from an allowed key: %s", commit, err)
+	}
+	fmt.Fprintf(output, "verified signature of commit %s\n", commit)
+	return nil
+}
+
+// helper function runs the git command in the directory, and
+// returns the trimmed standard output.
+func (v *Verifier) git(ctx context.Context, dir string, args ...string) (string, error) {
+	args = append([]string{"-c", "safe.directory=*"}, args...)
+	if v.signers != "" {
+		args = append([]string{"-c", "gpg.ssh.allowedSignersFile=" + v.signers}, args...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = os.Environ()
+	if v.gpgHome != "" {
+		cmd.Env = append(cmd.Env, "GNUPGHOME="+v.gpgHome)
+	}
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// helper function returns true if the git reference is a pull
+// request reference.
+func isPullRequest(ref string) bool {
+	return strings.HasPrefix(ref, "refs/pull/") ||
+		strings.HasPrefix(ref, "refs/pull-requests/") ||
+		strings.HasPrefix(ref, "refs/merge-requests/")
+}
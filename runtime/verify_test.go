@@ -0,0 +1,86 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/pipeline"
+)
+
+func TestVerifier(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=drone", "GIT_AUTHOR_EMAIL=drone@localhost",
+			"GIT_COMMITTER_NAME=drone", "GIT_COMMITTER_EMAIL=drone@localhost",
+		)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s: %s", args[0], err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "initial commit")
+	commit := git("rev-parse", "HEAD")
+
+	signers := filepath.Join(t.TempDir(), "allowed_signers")
+	ioutil.WriteFile(signers, nil, 0600)
+
+	tests := []struct {
+		verifier *Verifier
+		commit   string
+		valid    bool
+	}{
+		{NewVerifier("", ""), commit, true},
+		{NewVerifier("", ""), "a6586b3db244fb6b1198f2b25c213ded5b44f9fa", false},
+		{NewVerifier("", ""), "", false},
+		// the commit is not signed by an allowed key.
+		{NewVerifier("", signers), commit, false},
+	}
+	for i, test := range tests {
+		state := &pipeline.State{
+			Build: &drone.Build{After: test.commit, Ref: "refs/heads/master"},
+			Stage: &drone.Stage{
+				Steps: []*drone.Step{
+					{Name: "clone", Status: drone.StatusRunning},
+					{Name: "build", Status: drone.StatusPending},
+				},
+			},
+		}
+		next := func(context.Context, *pipeline.State, *engine.Spec, *engine.Step, io.Writer) (*engine.State, error) {
+			return &engine.State{Exited: true}, nil
+		}
+		step := &engine.Step{Name: "clone", WorkingDir: dir}
+		_, err := test.verifier.Middleware()(next)(context.Background(), state, &engine.Spec{}, step, ioutil.Discard)
+		if test.valid && err != nil {
+			t.Errorf("Want checkout verified at index %d, got %s", i, err)
+		}
+		if !test.valid {
+			if err == nil {
+				t.Errorf("Want checkout verification error at index %d", i)
+			}
+			if got, want := state.Stage.Steps[1].Status, drone.StatusSkipped; got != want {
+				t.Errorf("Want remaining steps skipped at index %d, got %s", i, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/engine/replacer"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+	"github.com/drone/runner-go/pipeline"
+)
+
+// Cleanup policy enumeration.
+const (
+	CleanupAlways    = "always"
+	CleanupOnSuccess = "on-success"
+	CleanupNever     = "never"
+)
+
+// default number of preserved workspaces.
+const defaultWorkspaceLimit = 10
+
+// errors returned when re-running a pipeline step.
+var (
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	ErrStepNotFound      = errors.New("step not found")
+)
+
+// Workspace is the preserved workspace of a completed stage.
+type Workspace struct {
+	sync.Mutex
+
+	Spec  *engine.Spec
+	Stage int64
+	Repo  string
+	Build int64
+
+	// steps maps the step names to the step ids, and logs
+	// stores the uploaded log of each step, so that the output
+	// of a re-run step is appended to the step log.
+	steps map[string]int64
+	logs  map[int64][]*drone.Line
+}
+
+// Workspaces stores the workspaces of completed stages that
+// are preserved according to the cleanup policy. Once the limit
+// is exceeded, the oldest workspace is destroyed.
+type Workspaces struct {
+	sync.Mutex
+
+	engine engine.Engine
+	policy string
+	limit  int
+	items  []*Workspace
+
+	// client and logs record the step logs uploaded by the
+	// client, until the workspace is preserved or destroyed.
+	client client.Client
+	logs   map[int64][]*drone.Line
+}
+
+// NewWorkspaces returns a new workspace store.
+func NewWorkspaces(engine engine.Engine, policy string, limit int) *Workspaces {
+	if limit == 0 {
+		limit = defaultWorkspaceLimit
+	}
+	return &Workspaces{
+		engine: engine,
+		policy: policy,
+		limit:  limit,
+		logs:   map[int64][]*drone.Line{},
+	}
+}
+
+// Client returns a client that records the step logs uploaded
+// to the server, so that the output of a re-run step can be
+// appended to the step log. The logs are only recorded if the
+// cleanup policy preserves workspaces, and are retained in
+// memory with the preserved workspace.
+func (w *Workspaces) Client(c client.Client) client.Client {
+	w.Lock()
+	w.client = c
+	w.Unlock()
+	if w.policy != CleanupNever && w.policy != CleanupOnSuccess {
+		return c
+	}
+	return &recorder{Client: c, workspaces: w}
+}
+
+// Preserve preserves the workspace if permitted by the cleanup
+// policy, and returns false if the workspace should be
+// destroyed.
+func (w *Workspaces) Preserve(spec *engine.Spec, state *pipeline.State) bool {
+	state.Lock()
+	item := &Workspace{
+		Spec:  spec,
+		Stage: state.Stage.ID,
+		Repo:  state.Repo.Slug,
+		Build: state.Build.Number,
+		steps: map[string]int64{},
+		logs:  map[int64][]*drone.Line{},
+	}
+	for _, step := range state.Stage.Steps {
+		item.steps[step.Name] = step.ID
+	}
+	state.Unlock()
+
+	// the recorded step logs are moved to the workspace, or
+	// discarded if the workspace is not preserved.
+	w.Lock()
+	for _, id := range item.steps {
+		if lines, ok := w.logs[id]; ok {
+			item.logs[id] = lines
+			delete(w.logs, id)
+		}
+	}
+	w.Unlock()
+
+	switch w.policy {
+	case CleanupNever:
+	case CleanupOnSuccess:
+		if state.Failed() == false {
+			return false
+		}
+	default:
+		return false
+	}
+
+	w.Lock()
+	w.items = append(w.items, item)
+	var evicted []*Workspace
+	if len(w.items) > w.limit {
+		n := len(w.items) - w.limit
+		evicted = w.items[:n]
+		w.items = w.items[n:]
+	}
+	w.Unlock()
+
+	for _, item := range evicted {
+		item.Lock()
+		w.engine.Destroy(noContext, item.Spec)
+		item.Unlock()
+	}
+	return true
+}
+
+// Find returns the preserved workspace for the stage.
+func (w *Workspaces) Find(stage int64) *Workspace {
+	w.Lock()
+	defer w.Unlock()
+	for _, item := range w.items {
+		if item.Stage == stage {
+			return item
+		}
+	}
+	return nil
+}
+
+// List returns the preserved workspaces.
+func (w *Workspaces) List() []*Workspace {
+	w.Lock()
+	defer w.Unlock()
+	items := make([]*Workspace, len(w.items))
+	copy(items, w.items)
+	return items
+}
+
+// Rerun re-executes the named step against the preserved
+// workspace of the stage, and writes the step output to out.
+// The output and exit code of the re-run step are appended to
+// the step log on the server.
+func (w *Workspaces) Rerun(ctx context.Context, stage int64, name string, out io.WriteCloser) (*engine.State, error) {
+	item := w.Find(stage)
+	if item == nil {
+		return nil, ErrWorkspaceNotFound
+	}
+
+	item.Lock()
+	defer item.Unlock()
+
+	for _, step := range item.Spec.Steps {
+		if step.Name != name {
+			continue
+		}
+		buf := new(bytes.Buffer)
+		wc := replacer.New(&teeCloser{out, buf}, step.Secrets)
+		started := time.Now()
+		state, err := w.engine.Run(ctx, item.Spec, cloneStep(step), wc)
+		wc.Close()
+
+		if id, ok := item.steps[name]; ok && w.client != nil {
+			lines := item.append(id, buf.String(), state, err, time.Since(started))
+			w.client.Upload(noContext, id, lines)
+		}
+		return state, err
+	}
+	return nil, ErrStepNotFound
+}
+
+// helper function appends the output and exit code of the
+// re-run step to the step log, and returns the full log.
+func (w *Workspace) append(id int64, output string, state *engine.State, err error, elapsed time.Duration) []*drone.Line {
+	lines := w.logs[id]
+	var timestamp int64
+	if len(lines) != 0 {
+		timestamp = lines[len(lines)-1].Timestamp
+	}
+	timestamp += int64(elapsed.Seconds())
+
+	messages := []string{"\n", "re-running step\n"}
+	if output != "" {
+		messages = append(messages, strings.SplitAfter(strings.TrimSuffix(output, "\n"), "\n")...)
+		messages[len(messages)-1] += "\n"
+	}
+	switch {
+	case state != nil:
+		messages = append(messages, fmt.Sprintf("exit code %d\n", state.ExitCode))
+	case err != nil:
+		messages = append(messages, fmt.Sprintf("error: %s\n", err))
+	}
+	for _, message := range messages {
+		lines = append(lines, &drone.Line{
+			Number:    len(lines),
+			Message:   message,
+			Timestamp: timestamp,
+		})
+	}
+	w.logs[id] = lines
+	return append(lines[:0:0], lines...)
+}
+
+// recorder is a client that records the uploaded step logs.
+type recorder struct {
+	client.Client
+	workspaces *Workspaces
+}
+
+func (r *recorder) Upload(ctx context.Context, step int64, lines []*drone.Line) error {
+	r.workspaces.Lock()
+	r.workspaces.logs[step] = lines
+	r.workspaces.Unlock()
+	return r.Client.Upload(ctx, step, lines)
+}
+
+// teeCloser writes to the io.WriteCloser and the buffer.
+type teeCloser struct {
+	io.WriteCloser
+	buf *bytes.Buffer
+}
+
+func (t *teeCloser) Write(p []byte) (int, error) {
+	t.buf.Write(p)
+	return t.WriteCloser.Write(p)
+}
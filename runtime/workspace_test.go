@@ -0,0 +1,162 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+	"github.com/drone-runners/drone-runner-exec/internal/mock"
+
+	"github.com/drone/drone-go/drone"
+	"github.com/drone/runner-go/client"
+	"github.com/drone/runner-go/pipeline"
+	"github.com/golang/mock/gomock"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWorkspaces_Preserve(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	passing := testState(1, drone.StatusPassing)
+	failing := testState(2, drone.StatusFailing)
+
+	w := NewWorkspaces(nil, CleanupAlways, 0)
+	if w.Preserve(&engine.Spec{}, failing) {
+		t.Errorf("Expect workspace destroyed when policy is always")
+	}
+
+	w = NewWorkspaces(nil, CleanupOnSuccess, 0)
+	if w.Preserve(&engine.Spec{}, passing) {
+		t.Errorf("Expect passing workspace destroyed when policy is on-success")
+	}
+	if !w.Preserve(&engine.Spec{}, failing) {
+		t.Errorf("Expect failing workspace preserved when policy is on-success")
+	}
+	if w.Find(2) == nil {
+		t.Errorf("Expect preserved workspace found")
+	}
+
+	// the oldest workspace is destroyed when the limit is
+	// exceeded.
+	spec := &engine.Spec{Root: "/tmp/drone-1"}
+	mockEngine := mock.NewMockEngine(controller)
+	mockEngine.EXPECT().Destroy(gomock.Any(), spec)
+
+	w = NewWorkspaces(mockEngine, CleanupNever, 1)
+	w.Preserve(spec, passing)
+	w.Preserve(&engine.Spec{}, failing)
+	if w.Find(1) != nil {
+		t.Errorf("Expect oldest workspace evicted")
+	}
+	if len(w.List()) != 1 {
+		t.Errorf("Expect workspace limit enforced")
+	}
+}
+
+func TestWorkspaces_Rerun(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	step := &engine.Step{Name: "test"}
+	spec := &engine.Spec{Steps: []*engine.Step{step}}
+	want := &engine.State{ExitCode: 1, Exited: true}
+
+	mockEngine := mock.NewMockEngine(controller)
+	mockEngine.EXPECT().Run(gomock.Any(), spec, gomock.Any(), gomock.Any()).Return(want, nil)
+
+	w := NewWorkspaces(mockEngine, CleanupNever, 0)
+	w.Preserve(spec, testState(1, drone.StatusFailing))
+
+	out := nopCloser{new(bytes.Buffer)}
+	got, err := w.Rerun(noContext, 1, "test", out)
+	if err != nil {
+		t.Error(err)
+	}
+	if got != want {
+		t.Errorf("Expect step state returned")
+	}
+	if _, err := w.Rerun(noContext, 1, "deploy", out); err != ErrStepNotFound {
+		t.Errorf("Expect step not found error")
+	}
+	if _, err := w.Rerun(noContext, 2, "test", out); err != ErrWorkspaceNotFound {
+		t.Errorf("Expect workspace not found error")
+	}
+}
+
+// This test verifies that the output and exit code of a re-run
+// step are appended to the uploaded step log.
+func TestWorkspaces_RerunLogs(t *testing.T) {
+	controller := gomock.NewController(t)
+	defer controller.Finish()
+
+	step := &engine.Step{Name: "test"}
+	spec := &engine.Spec{Steps: []*engine.Step{step}}
+
+	mockEngine := mock.NewMockEngine(controller)
+	mockEngine.EXPECT().Run(gomock.Any(), spec, gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, spec *engine.Spec, step *engine.Step, w io.Writer) (*engine.State, error) {
+			io.WriteString(w, "ok\n")
+			return &engine.State{ExitCode: 0, Exited: true}, nil
+		},
+	)
+
+	cli := &logClient{uploads: map[int64][]*drone.Line{}}
+	w := NewWorkspaces(mockEngine, CleanupNever, 0)
+	rec := w.Client(cli)
+	rec.Upload(noContext, 10, []*drone.Line{{Number: 0, Message: "FAIL\n", Timestamp: 2}})
+
+	state := testState(1, drone.StatusFailing)
+	state.Stage.Steps = []*drone.Step{{ID: 10, Name: "test"}}
+	w.Preserve(spec, state)
+
+	out := nopCloser{new(bytes.Buffer)}
+	if _, err := w.Rerun(noContext, 1, "test", out); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "ok\n"; got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+	want := []*drone.Line{
+		{Number: 0, Message: "FAIL\n", Timestamp: 2},
+		{Number: 1, Message: "\n", Timestamp: 2},
+		{Number: 2, Message: "re-running step\n", Timestamp: 2},
+		{Number: 3, Message: "ok\n", Timestamp: 2},
+		{Number: 4, Message: "exit code 0\n", Timestamp: 2},
+	}
+	if diff := cmp.Diff(want, cli.uploads[10]); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func testState(id int64, status string) *pipeline.State {
+	return &pipeline.State{
+		Build: &drone.Build{},
+		Repo:  &drone.Repo{},
+		Stage: &drone.Stage{ID: id, Status: status},
+	}
+}
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// logClient is a stub implementation of the client that
+// records the uploaded step logs.
+type logClient struct {
+	client.Client
+	uploads map[int64][]*drone.Line
+}
+
+func (c *logClient) Upload(ctx context.Context, step int64, lines []*drone.Line) error {
+	c.uploads[step] = lines
+	return nil
+}
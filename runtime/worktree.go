@@ -0,0 +1,131 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-exec/engine"
+
+	"github.com/drone/runner-go/logger"
+	"github.com/drone/runner-go/pipeline"
+)
+
+// Worktrees manages the persistent base clones of repositories.
+// The stage workspace is added as a git worktree of the base
+// clone, instead of cloning the repository for each stage.
+type Worktrees struct {
+	dir string
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewWorktrees returns a new worktree manager that stores the
+// base clones in the directory.
+func NewWorktrees(dir string) *Worktrees {
+	return &Worktrees{
+		dir:   dir,
+		locks: map[string]*sync.Mutex{},
+	}
+}
+
+// Base returns the path of the base clone of the repository.
+func (w *Worktrees) Base(repo string) string {
+	return filepath.Join(w.dir, filepath.FromSlash(repo)+".git")
+}
+
+// Middleware returns a Middleware that serializes the clone
+// steps of the same repository, since concurrent fetches into
+// the base clone conflict.
+func (w *Worktrees) Middleware() Middleware {
+	return func(next StepFunc) StepFunc {
+		return func(ctx context.Context, state *pipeline.State, spec *engine.Spec, step *engine.Step, output io.Writer) (*engine.State, error) {
+			if step.Name != "clone" {
+				return next(ctx, state, spec, step, output)
+			}
+			state.Lock()
+			base := w.Base(state.Repo.Slug)
+			state.Unlock()
+
+			lock := w.lock(base)
+			lock.Lock()
+			defer lock.Unlock()
+
+			// the modification time of the base clone records
+			// the last use, which is used to prune base clones
+			// that are no longer used.
+			now := time.Now()
+			os.Chtimes(base, now, now)
+			return next(ctx, state, spec, step, output)
+		}
+	}
+}
+
+// Prune removes the base clones that were not used within the
+// ttl, and removes the stale worktrees of the remaining base
+// clones.
+func (w *Worktrees) Prune(ctx context.Context, ttl time.Duration) {
+	log := logger.FromContext(ctx)
+	filepath.Walk(w.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() || path == w.dir {
+			return nil
+		}
+		if !strings.HasSuffix(path, ".git") {
+			return nil
+		}
+		lock := w.lock(path)
+		lock.Lock()
+		defer lock.Unlock()
+
+		if ttl > 0 && time.Since(info.ModTime()) > ttl {
+			log.WithField("path", path).Debug("remove unused base clone")
+			if err := os.RemoveAll(path); err != nil {
+				log.WithError(err).WithField("path", path).Warn("cannot remove base clone")
+			}
+			return filepath.SkipDir
+		}
+		cmd := exec.CommandContext(ctx, "git", "-C", path, "worktree", "prune")
+		cmd.Stdout = ioutil.Discard
+		cmd.Stderr = ioutil.Discard
+		if err := cmd.Run(); err != nil {
+			log.WithError(err).WithField("path", path).Warn("cannot prune worktrees")
+		}
+		return filepath.SkipDir
+	})
+}
+
+// Monitor prunes the base clones at the interval, until the
+// context is cancelled.
+func (w *Worktrees) Monitor(ctx context.Context, interval, ttl time.Duration) {
+	for {
+		w.Prune(ctx, ttl)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// helper function returns the lock of the base clone.
+func (w *Worktrees) lock(base string) *sync.Mutex {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	lock, ok := w.locks[base]
+	if !ok {
+		lock = new(sync.Mutex)
+		w.locks[base] = lock
+	}
+	return lock
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWorktrees_Base(t *testing.T) {
+	w := NewWorktrees("/var/lib/drone/worktrees")
+	if got, want := w.Base("octocat/hello-world"), filepath.FromSlash("/var/lib/drone/worktrees/octocat/hello-world.git"); got != want {
+		t.Errorf("Want base clone %s, got %s", want, got)
+	}
+}
+
+func TestWorktrees_Prune(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWorktrees(dir)
+
+	stale := w.Base("octocat/stale")
+	fresh := w.Base("octocat/fresh")
+	os.MkdirAll(stale, 0700)
+	os.MkdirAll(fresh, 0700)
+	past := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(stale, past, past)
+
+	w.Prune(noContext, 24*time.Hour)
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Want unused base clone removed")
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("Want recently used base clone kept")
+	}
+}
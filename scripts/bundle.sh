@@ -37,5 +37,8 @@ tar -cvzf release/drone_runner_exec_dragonfly_amd64.tar.gz -C release/dragonfly/
 # solaris
 tar -cvzf release/drone_runner_exec_solaris_amd64.tar.gz -C release/solaris/amd64  drone-runner-exec
 
+# illumos
+tar -cvzf release/drone_runner_exec_illumos_amd64.tar.gz -C release/illumos/amd64  drone-runner-exec
+
 # generate shas for tar files
 shasum release/*.tar.gz > release/drone_runner_exec_checksums.txt